@@ -17,113 +17,2450 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"go/ast"
 	"go/build"
 	"go/constant"
 	"go/token"
+	"io"
+	"io/ioutil"
+	"math"
 	"math/big"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	r "reflect"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	. "github.com/cosmos72/gomacro/ast2"
-	. "github.com/cosmos72/gomacro/base"
-	"github.com/cosmos72/gomacro/base/reflect"
-	"github.com/cosmos72/gomacro/base/untyped"
-	"github.com/cosmos72/gomacro/classic"
-	"github.com/cosmos72/gomacro/fast"
-	"github.com/cosmos72/gomacro/go/etoken"
-	"github.com/cosmos72/gomacro/go/parser"
-	xr "github.com/cosmos72/gomacro/xreflect"
-)
+	. "github.com/cosmos72/gomacro/ast2"
+	. "github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/base/genimport"
+	"github.com/cosmos72/gomacro/base/reflect"
+	"github.com/cosmos72/gomacro/base/untyped"
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/cmd"
+	"github.com/cosmos72/gomacro/fast"
+	"github.com/cosmos72/gomacro/fast/debug"
+	"github.com/cosmos72/gomacro/fast/safeexpr"
+	"github.com/cosmos72/gomacro/go/etoken"
+	"github.com/cosmos72/gomacro/go/parser"
+	"github.com/cosmos72/gomacro/imports"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+var enable_generics_v2_cti = func() bool {
+	// enable generics v2 CTI before creating test cases
+	etoken.GENERICS = etoken.GENERICS_V2_CTI
+	return true
+}()
+
+type TestFor int
+
+const (
+	S      TestFor = 1 << iota // set option OptDebugSleepOnSwitch
+	C                          // test for classic interpreter
+	F                          // test for fast interpreter
+	G1                         // test requires generics v1 (C++-style)
+	G2                         // test requires generics v2 "contracts are interfaces"
+	U                          // test returns untyped constant (relevant only for fast interpreter)
+	Go1_13                     // test for Go 1.3 number literals: 0b... binary, 0o... octal, 1.2p3 hex floating point, 1_23 underscore digit separator
+	Z                          // temporary override: run only these tests, on fast interpreter only
+	I                          // set option OptAutoImport (relevant only for fast interpreter)
+	A      = C | F             // test for both interpreters
+	G      = G1 | G2
+)
+
+type TestCase struct {
+	testfor TestFor
+	name    string
+	program string
+	result0 interface{}
+	results []interface{}
+}
+
+var canRunGo1_13 = func() bool {
+	for _, tag := range build.Default.ReleaseTags {
+		if tag == "go1.13" {
+			return true
+		}
+	}
+	return false
+}()
+
+func (tc *TestCase) shouldRun(interp TestFor) bool {
+	if tc.testfor&interp == 0 {
+		return false
+	}
+	if tc.testfor&Go1_13 != 0 && !canRunGo1_13 {
+		return false
+	}
+	if tc.testfor&G1 != 0 && etoken.GENERICS.V1_CXX() {
+		return true
+	}
+	if tc.testfor&G2 != 0 && etoken.GENERICS.V2_CTI() {
+		return true
+	}
+	return tc.testfor&(G1|G2) == 0
+}
+
+var foundZ bool
+
+func init() {
+	for i := range testcases {
+		if testcases[i].testfor&Z != 0 {
+			foundZ = true
+		}
+	}
+}
+
+func TestClassic(t *testing.T) {
+	if foundZ {
+		t.Skip("one or more tests marked with 'Z' i.e. run only those and only on fast interpreter")
+	}
+	ir := classic.New()
+	// ir.Options |= OptDebugCallStack | OptDebugPanicRecover
+	for i := range testcases {
+		test := &testcases[i]
+		if test.shouldRun(C) {
+			t.Run(test.name, func(t *testing.T) { test.classic(t, ir) })
+		}
+	}
+}
+
+func TestFast(t *testing.T) {
+	ir := fast.New()
+	for i := range testcases {
+		test := &testcases[i]
+		if (!foundZ || test.testfor&Z != 0) && test.shouldRun(F) {
+			t.Run(test.name, func(t *testing.T) { test.fast(t, ir) })
+		}
+	}
+}
+
+func TestFastBind(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import "fmt"; var db = "global"`)
+	undo := ir.Bind(map[string]interface{}{"req": 7, "db": "request", "none": nil})
+	if v, _ := ir.Eval1(`fmt.Sprint(req, db, none)`); v.Interface() != "7request<nil>" {
+		t.Errorf("expecting %q, found %v", "7request<nil>", v)
+	}
+	undo()
+	if v, _ := ir.Eval1(`db`); v.Interface() != "global" {
+		t.Errorf("expecting %q, found %v", "global", v)
+	}
+	if sym := ir.Comp.TryResolve("req"); sym != nil {
+		t.Errorf("expecting req to be unbound, found %v", sym)
+	}
+	// slots released by undo are reused
+	bindnum, intbindnum := ir.Comp.BindNum, ir.Comp.IntBindNum
+	for i := 0; i < 100; i++ {
+		undo = ir.Bind(map[string]interface{}{"req": i, "db": "request", "c": complex(float64(i), 0)})
+		if v, _ := ir.Eval1(`fmt.Sprint(req, db, real(c))`); v.Interface() != fmt.Sprint(i, "request", i) {
+			t.Errorf("expecting %q, found %v", fmt.Sprint(i, "request", i), v)
+		}
+		undo()
+	}
+	if ir.Comp.BindNum > bindnum+1 || ir.Comp.IntBindNum > intbindnum+3 {
+		t.Errorf("expecting Bind to reuse the released slots, found BindNum %d -> %d, IntBindNum %d -> %d",
+			bindnum, ir.Comp.BindNum, intbindnum, ir.Comp.IntBindNum)
+	}
+	// functions and pointers created while the variables are bound keep their values,
+	// as captured variables in Go: their slots are not reused
+	undo = ir.Bind(map[string]interface{}{"req": "first", "n": 1})
+	ir.Eval(`func h() string { return fmt.Sprint(req, n) }; var p = &n`)
+	undo()
+	undo = ir.Bind(map[string]interface{}{"req": "second", "n": 2})
+	if v, _ := ir.Eval1(`fmt.Sprint(h(), " ", *p, " ", req, n)`); v.Interface() != "first1 1 second2" {
+		t.Errorf("expecting %q, found %v", "first1 1 second2", v)
+	}
+	undo()
+	undo = ir.Bind(map[string]interface{}{"req": "third", "n": 3})
+	if v, _ := ir.Eval1(`fmt.Sprint(h(), " ", *p, " ", req, n)`); v.Interface() != "first1 1 third3" {
+		t.Errorf("expecting %q, found %v", "first1 1 third3", v)
+	}
+	undo()
+	ir.Unbind("db")
+	if sym := ir.Comp.TryResolve("db"); sym != nil {
+		t.Errorf("expecting db to be unbound, found %v", sym)
+	}
+}
+
+func TestFastPrintfWarnings(t *testing.T) {
+	ir := fast.New()
+	var buf bytes.Buffer
+	ir.Comp.Stderr = &buf
+	ir.Eval(`import ("errors"; "fmt"); type Tree struct { Kids []Tree; Name string }`)
+	for _, test := range []struct {
+		src, warning string
+	}{
+		{`fmt.Sprintf("%d", 1)`, ""},
+		{`fmt.Sprintf("%5.2f %*d %% %v", 1.5, 3, 4, nil)`, ""},
+		{`fmt.Sprintf("%s", []byte("abc"))`, ""},
+		{`fmt.Sprintf("%d", "hi")`, "// warning: fmt.Sprintf format %d has arg \"hi\" of wrong type string\n"},
+		{`fmt.Sprintf("%d %s", 1)`, "// warning: fmt.Sprintf format %s reads arg #2, but call has 1 args\n"},
+		{`fmt.Sprintf("%d", 1, 2)`, "// warning: fmt.Sprintf call needs 1 args but has 2 args\n"},
+		{`fmt.Sprintf("%z", 1)`, "// warning: fmt.Sprintf format %z has unknown verb z\n"},
+		{`fmt.Sprintf("%s", Tree{})`, ""},
+		{`fmt.Sprintf("%d", Tree{})`, "// warning: fmt.Sprintf format %d has arg Tree{} of wrong type main.Tree\n"},
+		{`fmt.Errorf("wrapped: %w", errors.New("x"))`, ""},
+		{`fmt.Errorf("wrapped: %w", 1)`, "// warning: fmt.Errorf format %w has arg 1 of wrong type int\n"},
+	} {
+		buf.Reset()
+		ir.Eval(test.src)
+		if buf.String() != test.warning {
+			t.Errorf("%s: expecting warning %q, found %q", test.src, test.warning, buf.String())
+		}
+	}
+}
+
+func TestFastPrint(t *testing.T) {
+	rpipe, wpipe, err := os.Pipe()
+	if err != nil {
+		t.Skip(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = wpipe
+	defer func() {
+		os.Stderr = stderr
+	}()
+	ir := fast.New()
+	ir.Eval(`type T int; var p *int; var s []int; var e interface{}
+	print(1, true, "x", 'a', 2.5, 1e100, 3+4i, T(7), float32(0.1), "\n")
+	println(uint8(200), 1e-7, 123456789.0, complex64(complex(0.1, -0.2)), 1.0/3)
+	println(p, s, e)`)
+	wpipe.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(rpipe)
+	expected := "1truex972.51e+100(3+4i)70.1\n" +
+		"200 1e-07 1.23456789e+08 (0.1-0.2i) 0.3333333333333333\n" +
+		"0x0 [0/0]0x0 (0x0,0x0)\n"
+	if buf.String() != expected {
+		t.Errorf("expecting %q, found %q", expected, buf.String())
+	}
+}
+
+func TestFastPrintCycles(t *testing.T) {
+	ir := fast.New()
+	var buf bytes.Buffer
+	ir.Comp.Stdout = &buf
+	ir.Comp.Options |= OptShowEval
+	ir.Comp.Options &^= OptShowEvalType
+	for _, test := range []struct {
+		src, expected string
+	}{
+		{`type Node struct { V int; Next *Node }; n := &Node{V: 1}; n.Next = &Node{V: 2, Next: n}; n`, "#1=&{V:1 Next:&{V:2 Next:&↩#1}}"},
+		{`s := []interface{}{1, nil}; s[1] = s; s`, "#1=[1 &↩#1]"},
+		{`m := map[string]interface{}{"a": 1}; m["self"] = m; m`, "#1=map[a:1 self:&↩#1]"},
+		{`type T struct { M map[int]interface{} }; x := T{map[int]interface{}{}}; x.M[0] = x.M; x`, "{M:#1=map[0:&↩#1]}"},
+		{`[]interface{}{1, []int{2, 3}}`, "[1 [2 3]]"},
+	} {
+		buf.Reset()
+		ir.ParseEvalPrint(test.src)
+		if expected := test.expected + "\n"; buf.String() != expected {
+			t.Errorf("%s: expecting %q, found %q", test.src, expected, buf.String())
+		}
+	}
+}
+
+func TestFastPrelude(t *testing.T) {
+	ir := fast.New()
+	if err := ir.LoadPrelude("std"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		src      string
+		expected interface{}
+	}{
+		{`sh("echo hello")`, "hello"},
+		{`toJSON([]int{1, 2})`, "[\n  1,\n  2\n]"},
+		{`fromJSON("{\"a\": true}").(map[string]interface{})["a"]`, true},
+		{`dur("1h30m") + 3*sec`, 90*time.Minute + 3*time.Second},
+		{`date("2020-01-02").Year()`, 2020},
+	} {
+		if v, _ := ir.Eval1(test.src); v.Interface() != test.expected {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, v)
+		}
+	}
+	if err := ir.LoadPrelude("nonexistent"); err == nil {
+		t.Errorf("expecting error loading unknown prelude")
+	}
+}
+
+func TestNotebook(t *testing.T) {
+	src := "# Notebook\n\n```go\nimport \"fmt\"\nfmt.Sprint(\"hello\", 42)\n```\n\n```output\nstale\n```\n\n```text\nnot executed\n```\n"
+	expected := "# Notebook\n\n```go\nimport \"fmt\"\nfmt.Sprint(\"hello\", 42)\n```\n\n```output\nhello42\n```\n\n```text\nnot executed\n```\n"
+	c := cmd.New()
+	c.Interp.Comp.Options &^= OptShowEvalType
+	var buf bytes.Buffer
+	if err := c.EvalNotebook(&buf, strings.NewReader(src), false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expecting %q, found %q", expected, buf.String())
+	}
+}
+
+func TestKernel(t *testing.T) {
+	ports := make([]int, 5)
+	for i := range ports {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports[i] = ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+	}
+	const key = "secret"
+	connfile := filepath.Join(t.TempDir(), "connection.json")
+	conn, _ := json.Marshal(map[string]interface{}{
+		"transport": "tcp", "ip": "127.0.0.1", "key": key, "signature_scheme": "hmac-sha256",
+		"shell_port": ports[0], "control_port": ports[1], "stdin_port": ports[2], "iopub_port": ports[3], "hb_port": ports[4],
+	})
+	if err := ioutil.WriteFile(connfile, conn, 0600); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.New().Main([]string{"kernel", "--connection-file=" + connfile})
+	}()
+	shell := dialZmtp(t, ports[0], "DEALER")
+	defer shell.Close()
+	iopub := dialZmtp(t, ports[3], "SUB")
+	defer iopub.Close()
+
+	control := dialZmtp(t, ports[1], "DEALER")
+	defer control.Close()
+
+	sendTo := func(c net.Conn, msgtype string, content string) {
+		header := fmt.Sprintf(`{"msg_id":%q,"session":"test","msg_type":%q,"version":"5.3"}`, msgtype, msgtype)
+		parts := []string{header, "{}", "{}", content}
+		mac := hmac.New(sha256.New, []byte(key))
+		for _, part := range parts {
+			mac.Write([]byte(part))
+		}
+		writeZmtp(t, c, append([]string{"<IDS|MSG>", hex.EncodeToString(mac.Sum(nil))}, parts...))
+	}
+	send := func(msgtype string, content string) {
+		sendTo(shell, msgtype, content)
+	}
+	// return message type and content
+	recv := func(c net.Conn) (string, map[string]interface{}) {
+		frames := readZmtp(t, c)
+		for len(frames) != 0 && frames[0] != "<IDS|MSG>" {
+			frames = frames[1:]
+		}
+		var header struct {
+			MsgType string `json:"msg_type"`
+		}
+		var content map[string]interface{}
+		if len(frames) < 6 || json.Unmarshal([]byte(frames[2]), &header) != nil || json.Unmarshal([]byte(frames[5]), &content) != nil {
+			t.Fatalf("invalid Jupyter message: %q", frames)
+		}
+		return header.MsgType, content
+	}
+	send("kernel_info_request", "{}")
+	if msgtype, content := recv(shell); msgtype != "kernel_info_reply" || content["implementation"] != "gomacro" {
+		t.Errorf("unexpected reply to kernel_info_request: %s %v", msgtype, content)
+	}
+	send("execute_request", `{"code":"import \"fmt\"\nfmt.Print(\"hello\")\nlen(\"abc\")"}`)
+	if msgtype, content := recv(shell); msgtype != "execute_reply" || content["status"] != "ok" {
+		t.Errorf("unexpected reply to execute_request: %s %v", msgtype, content)
+	}
+	var stream, result string
+	for started := false; ; {
+		msgtype, content := recv(iopub)
+		if msgtype == "execute_input" {
+			started = true
+		} else if !started {
+			// skip messages about kernel_info_request
+		} else if msgtype == "stream" {
+			stream += content["text"].(string)
+		} else if msgtype == "execute_result" {
+			result = content["data"].(map[string]interface{})["text/plain"].(string)
+		} else if msgtype == "status" && content["execution_state"] == "idle" {
+			break
+		}
+	}
+	if stream != "hello" || result != "3\t// int" {
+		t.Errorf("unexpected output of execute_request: stream %q, result %q", stream, result)
+	}
+	send("complete_request", `{"code":"fmt.Sprin","cursor_pos":9}`)
+	if msgtype, content := recv(shell); msgtype != "complete_reply" || content["cursor_start"] != 4.0 ||
+		fmt.Sprint(content["matches"]) != "[Sprint Sprintf Sprintln]" {
+		t.Errorf("unexpected reply to complete_request: %s %v", msgtype, content)
+	} else if types, _ := content["metadata"].(map[string]interface{})["_jupyter_types_experimental"].([]interface{}); len(types) != 3 ||
+		types[0].(map[string]interface{})["type"] != "func" {
+		t.Errorf("unexpected metadata in reply to complete_request: %v", content["metadata"])
+	}
+	send("inspect_request", `{"code":"fmt.Sprint(1)","cursor_pos":5}`)
+	if msgtype, content := recv(shell); msgtype != "inspect_reply" || content["found"] != true ||
+		!strings.HasPrefix(content["data"].(map[string]interface{})["text/plain"].(string), "fmt.Sprint = ") {
+		t.Errorf("unexpected reply to inspect_request: %s %v", msgtype, content)
+	}
+	send("execute_request", `{"code":"for {}"}`)
+	time.Sleep(100 * time.Millisecond)
+	sendTo(control, "interrupt_request", "{}")
+	if msgtype, _ := recv(control); msgtype != "interrupt_reply" {
+		t.Errorf("unexpected reply to interrupt_request: %s", msgtype)
+	}
+	if msgtype, content := recv(shell); msgtype != "execute_reply" || content["status"] != "error" {
+		t.Errorf("unexpected reply to interrupted execute_request: %s %v", msgtype, content)
+	}
+	send("is_complete_request", `{"code":"func f() {"}`)
+	if msgtype, content := recv(shell); msgtype != "is_complete_reply" || content["status"] != "incomplete" {
+		t.Errorf("unexpected reply to is_complete_request: %s %v", msgtype, content)
+	}
+	send("shutdown_request", `{"restart":false}`)
+	if msgtype, _ := recv(shell); msgtype != "shutdown_reply" {
+		t.Errorf("unexpected reply to shutdown_request: %s", msgtype)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("kernel did not shutdown")
+	}
+}
+
+// connect to a ZMTP 3.0 socket, as libzmq does
+func dialZmtp(t *testing.T, port int, kind string) net.Conn {
+	var c net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if c, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9], greeting[10] = 0xFF, 0x7F, 3
+	copy(greeting[12:], "NULL")
+	c.Write(greeting)
+	if _, err = io.ReadFull(c, greeting); err != nil {
+		t.Fatal(err)
+	}
+	ready := "\x05READY\x0bSocket-Type\x00\x00\x00" + string(rune(len(kind))) + kind
+	c.Write(append([]byte{0x04, byte(len(ready))}, ready...))
+	readZmtp(t, c) // peer READY
+	return c
+}
+
+func writeZmtp(t *testing.T, c net.Conn, frames []string) {
+	var buf bytes.Buffer
+	for i, frame := range frames {
+		flags := byte(0x02)
+		if i != len(frames)-1 {
+			flags |= 0x01
+		}
+		buf.WriteByte(flags)
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(frame)))
+		buf.Write(size[:])
+		buf.WriteString(frame)
+	}
+	if _, err := c.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read a message or a command
+func readZmtp(t *testing.T, c net.Conn) []string {
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var frames []string
+	for {
+		var header [9]byte
+		if _, err := io.ReadFull(c, header[:2]); err != nil {
+			t.Fatal(err)
+		}
+		size := uint64(header[1])
+		if header[0]&0x02 != 0 {
+			if _, err := io.ReadFull(c, header[2:]); err != nil {
+				t.Fatal(err)
+			}
+			size = binary.BigEndian.Uint64(header[1:])
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(c, frame); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, string(frame))
+		if header[0]&0x01 == 0 {
+			return frames
+		}
+	}
+}
+
+func TestWebServer(t *testing.T) {
+	s := cmd.NewWebServer()
+	s.Timeout = 200 * time.Millisecond
+	server := httptest.NewServer(s)
+	defer server.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	eval := func(src string) (result struct {
+		Output string
+		Errors []string
+		Status string
+	}) {
+		reply, err := client.Post(server.URL+"/eval", "text/plain", strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reply.Body.Close()
+		if err = json.NewDecoder(reply.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	for _, test := range []struct {
+		src, status, output string
+	}{
+		{`import "strings"; webx := strings.Repeat("ab", 2)`, "ok", ""},
+		{`webx + "!"`, "ok", "abab!"},
+		{`import "os"`, "error", `import "os" not allowed`},
+		{`:env`, "error", ""},
+		{`for {}`, "timeout", ""},
+		{`len(webx)`, "ok", "4"},
+		{`import "fmt"; fmt.Println("hello"); println("world")`, "ok", "hello\nworld\n"},
+		{`go func() {}()`, "error", "go statements are not allowed"},
+		{`import "time"; time.AfterFunc(0, func() {})`, "error", "time.AfterFunc is not allowed"},
+		{`make([]byte, 1<<34)`, "error", "allocation exceeds the limit"},
+		{`new([1<<34]byte)`, "error", "allocation exceeds the limit"},
+		{`len(make([]byte, 1000))`, "ok", "1000"},
+	} {
+		result := eval(test.src)
+		if result.Status != test.status || !strings.Contains(result.Output, test.output) {
+			t.Errorf("eval %q: expecting status %q and output containing %q, found %q and %q",
+				test.src, test.status, test.output, result.Status, result.Output)
+		}
+	}
+}
+
+func TestWebServerConcurrent(t *testing.T) {
+	s := cmd.NewWebServer()
+	s.Timeout = 2 * time.Second
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	eval := func(src string) string {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		reply, err := client.Post(server.URL+"/eval", "text/plain", strings.NewReader(src))
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		defer reply.Body.Close()
+		var result struct{ Output, Status string }
+		if err = json.NewDecoder(reply.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		return result.Status + " " + result.Output
+	}
+	slow := make(chan string)
+	go func() {
+		slow <- eval(`for {}`)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// another session must not wait for the first one
+	if result := eval(`import "fmt"; fmt.Print("fast")`); !strings.HasPrefix(result, "ok fast") {
+		t.Errorf("expecting %q, found %q", "ok fast...", result)
+	}
+	select {
+	case result := <-slow:
+		t.Errorf("evaluation in the other session completed too early: %q", result)
+	default:
+	}
+	if result := <-slow; !strings.HasPrefix(result, "timeout") {
+		t.Errorf("expecting timeout, found %q", result)
+	}
+}
+
+// evaluations waiting for a session discarded because it could not be interrupted must not start
+func TestWebServerDeadSession(t *testing.T) {
+	s := cmd.NewWebServer()
+	s.Timeout = 100 * time.Millisecond
+	server := httptest.NewServer(s)
+	defer server.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	eval := func(src string) string {
+		reply, err := client.Post(server.URL+"/eval", "text/plain", strings.NewReader(src))
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		defer reply.Body.Close()
+		var result struct{ Output, Status string }
+		if err = json.NewDecoder(reply.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		return result.Status + " " + result.Output
+	}
+	// create the session cookie
+	if result := eval(`import "time"; webn := 1`); result != "ok " {
+		t.Fatalf("expecting %q, found %q", "ok ", result)
+	}
+	stuck := make(chan string)
+	go func() {
+		stuck <- eval(`time.Sleep(3 * time.Second)`)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if result := eval(`webn`); !strings.HasPrefix(result, "error session discarded") {
+		t.Errorf("expecting %q, found %q", "error session discarded...", result)
+	}
+	if result := <-stuck; !strings.HasPrefix(result, "timeout") {
+		t.Errorf("expecting timeout, found %q", result)
+	}
+	// a new session is created
+	if result := eval(`webn`); !strings.HasPrefix(result, "error") || !strings.Contains(result, "undefined identifier: webn") {
+		t.Errorf("expecting %q, found %q", "error ... undefined identifier: webn", result)
+	}
+}
+
+func TestDapServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomacro_dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	program := filepath.Join(dir, "dap.gomacro")
+	src := "func dapf(n int) int {\n\tm := n * 2\n\treturn m\n}\ndapz := dapf(3)\n"
+	if err = ioutil.WriteFile(program, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// client -> server and server -> client pipes
+	inr, inw := io.Pipe()
+	outr, outw := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		// interpreted code must run in the goroutine that created the interpreter
+		s := debug.NewDapServer(fast.New(), inr, outw)
+		served <- s.Serve()
+		outw.Close()
+	}()
+
+	type message struct {
+		Type       string
+		Command    string
+		Event      string
+		RequestSeq int `json:"request_seq"`
+		Success    bool
+		Body       json.RawMessage
+	}
+	messages := make(chan message, 100)
+	go func() {
+		defer close(messages)
+		in := bufio.NewReader(outr)
+		for {
+			var length int
+			if _, err := fmt.Fscanf(in, "Content-Length: %d\r\n\r\n", &length); err != nil {
+				return
+			}
+			buf := make([]byte, length)
+			if _, err := io.ReadFull(in, buf); err != nil {
+				return
+			}
+			var msg message
+			if err := json.Unmarshal(buf, &msg); err != nil {
+				t.Error(err)
+				return
+			}
+			messages <- msg
+		}
+	}()
+	seq := 0
+	request := func(command string, args interface{}) int {
+		seq++
+		buf, _ := json.Marshal(map[string]interface{}{"seq": seq, "type": "request", "command": command, "arguments": args})
+		fmt.Fprintf(inw, "Content-Length: %d\r\n\r\n%s", len(buf), buf)
+		return seq
+	}
+	// wait for the response to request reqseq, or for event. Skip other messages
+	expect := func(reqseq int, event string) message {
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					t.Fatalf("connection closed while expecting response %d or event %q", reqseq, event)
+				}
+				if msg.Type == "response" && msg.RequestSeq == reqseq {
+					if !msg.Success {
+						t.Fatalf("request %q failed: %s", msg.Command, msg.Body)
+					}
+					return msg
+				} else if msg.Type == "event" && msg.Event == event {
+					return msg
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("timeout while expecting response %d or event %q", reqseq, event)
+			}
+		}
+	}
+
+	msg := expect(request("initialize", map[string]interface{}{"adapterID": "gomacro"}), "")
+	var caps map[string]bool
+	json.Unmarshal(msg.Body, &caps)
+	if !caps["supportsConfigurationDoneRequest"] {
+		t.Errorf("initialize: expecting supportsConfigurationDoneRequest, found %s", msg.Body)
+	}
+	expect(-1, "initialized")
+	expect(request("launch", map[string]interface{}{"program": program}), "")
+
+	msg = expect(request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": program},
+		"breakpoints": []map[string]int{{"line": 2}},
+	}), "")
+	var bps struct {
+		Breakpoints []struct {
+			Verified bool
+			Line     int
+		}
+	}
+	json.Unmarshal(msg.Body, &bps)
+	if len(bps.Breakpoints) != 1 || !bps.Breakpoints[0].Verified || bps.Breakpoints[0].Line != 2 {
+		t.Errorf("setBreakpoints: expecting a verified breakpoint at line 2, found %s", msg.Body)
+	}
+	expect(request("configurationDone", nil), "")
+
+	msg = expect(-1, "stopped")
+	var stopped struct{ Reason string }
+	json.Unmarshal(msg.Body, &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("expecting stop reason %q, found %s", "breakpoint", msg.Body)
+	}
+
+	msg = expect(request("stackTrace", map[string]int{"threadId": 1}), "")
+	var trace struct {
+		StackFrames []struct {
+			Name   string
+			Line   int
+			Source struct{ Path string }
+		}
+	}
+	json.Unmarshal(msg.Body, &trace)
+	if frames := trace.StackFrames; len(frames) != 2 ||
+		frames[0].Name != "dapf" || frames[0].Line != 2 || frames[0].Source.Path != program ||
+		frames[1].Name != "main" || frames[1].Line != 5 {
+		t.Errorf("stackTrace: expecting frames dapf at line 2 and main at line 5, found %s", msg.Body)
+	}
+
+	expect(request("continue", map[string]int{"threadId": 1}), "")
+	msg = expect(-1, "exited")
+	var exited struct{ ExitCode int }
+	json.Unmarshal(msg.Body, &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("expecting exit code 0, found %s", msg.Body)
+	}
+	expect(-1, "terminated")
+	expect(request("disconnect", nil), "")
+	if err = <-served; err != nil {
+		t.Error(err)
+	}
+	inw.Close()
+}
+
+func TestDapListen(t *testing.T) {
+	for _, args := range [][]string{{"dap", "--listen"}, {"dap", "-l", ""}} {
+		if err := cmd.New().Main(args); err == nil || !strings.Contains(err.Error(), "requires an ADDRESS") {
+			t.Errorf("%q: expecting error about missing ADDRESS, found %v", args, err)
+		}
+	}
+}
+
+func TestLocalImport(t *testing.T) {
+	imp := genimport.DefaultImporter(nil)
+	for _, test := range []struct {
+		relpath, dir, expected string
+	}{
+		{"./base/lineedit", ".", "github.com/cosmos72/gomacro/base/lineedit"},
+		{"../paths", "base/genimport", "github.com/cosmos72/gomacro/base/paths"},
+		{".", ".", "github.com/cosmos72/gomacro"},
+	} {
+		pkgpath, err := imp.LocalImport(test.relpath, test.dir)
+		if err != nil {
+			t.Errorf("LocalImport(%q, %q) failed: %v", test.relpath, test.dir, err)
+		} else if pkgpath != test.expected {
+			t.Errorf("LocalImport(%q, %q): expecting %q, found %q", test.relpath, test.dir, test.expected, pkgpath)
+		}
+	}
+}
+
+func TestLocalImportInternal(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"mod/go.mod":                "module example.com/mod\n",
+		"mod/internal/util/util.go": "package util\n",
+		"mod/cmd/x/x.go":            "package main\n",
+		"other/other.go":            "package other\n",
+	} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imp := genimport.DefaultImporter(nil)
+	pkgpath, err := imp.LocalImport("../../internal/util", filepath.Join(root, "mod/cmd/x"))
+	if err != nil {
+		t.Errorf("LocalImport of internal package from the same module failed: %v", err)
+	} else if pkgpath != "example.com/mod/internal/util" {
+		t.Errorf("LocalImport of internal package: expecting %q, found %q", "example.com/mod/internal/util", pkgpath)
+	}
+	if _, err = imp.LocalImport("../mod/internal/util", filepath.Join(root, "other")); err == nil {
+		t.Errorf("LocalImport of internal package from outside its module should fail")
+	}
+}
+
+func TestFastEvents(t *testing.T) {
+	ir := fast.New()
+	var buf bytes.Buffer
+	ir.Comp.Stdout = &buf
+	ir.Comp.Stderr = &buf
+	ir.Comp.Options |= OptShowEval
+	var kinds []fast.EventKind
+	var result interface{}
+	var output string
+	ir.SetEventHandler(func(event fast.Event) {
+		kinds = append(kinds, event.Kind)
+		if event.Kind == fast.EventResult && len(event.Values) == 1 {
+			result = event.Values[0].Interface()
+		} else if event.Kind == fast.EventOutput && event.Stderr {
+			output += string(event.Data)
+		}
+	})
+	for _, test := range []struct {
+		src   string
+		kinds []fast.EventKind
+	}{
+		{"1+2", []fast.EventKind{fast.EventInput, fast.EventExecStart, fast.EventResult, fast.EventOutput, fast.EventDone}},
+		{"(", []fast.EventKind{fast.EventInput, fast.EventParseError, fast.EventOutput, fast.EventDone}},
+		{"undefinedIdent", []fast.EventKind{fast.EventInput, fast.EventCompileError, fast.EventOutput, fast.EventDone}},
+		{"panic(1)", []fast.EventKind{fast.EventInput, fast.EventExecStart, fast.EventRuntimeError, fast.EventOutput, fast.EventDone}},
+	} {
+		kinds = nil
+		ir.ParseEvalPrint(test.src)
+		if !r.DeepEqual(kinds, test.kinds) {
+			t.Errorf("%s: expecting events %v, found %v", test.src, test.kinds, kinds)
+		}
+	}
+	// errors printed by the REPL are reported as EventOutput too
+	output = ""
+	ir.ParseEvalPrint(`panic("event error")`)
+	if !strings.Contains(output, "event error") {
+		t.Errorf("expecting EventOutput on Stderr containing %q, found %q", "event error", output)
+	}
+	ir.SetEventHandler(nil)
+	if result != 3 {
+		t.Errorf("expecting result 3, found %v", result)
+	}
+}
+
+func TestFastInterruptibleChan(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptInterruptibleChan
+	ir.Eval(`ich := make(chan int, 1)`)
+	if v, _ := ir.Eval1(`ich <- 7; <-ich`); v.Interface() != 7 {
+		t.Errorf("expecting 7, found %v", v)
+	}
+	ir.Eval(`ich <- 8; iv, iok := <-ich`)
+	if v, _ := ir.Eval1(`iv == 8 && iok`); v.Interface() != true {
+		t.Errorf("expecting true, found %v", v)
+	}
+	if v, _ := ir.Eval1(`isel := 1; select { case <-make(chan int): isel = 2; default: isel = 3 }; isel`); v.Interface() != 3 {
+		t.Errorf("select with default: expecting 3, found %v", v)
+	}
+	ir.Eval(`func iblock() int { return <-make(chan int) }`)
+	// evaluate src, interrupting it until it returns
+	eval := func(src string) (rec interface{}) {
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(20 * time.Millisecond):
+					ir.Interrupt(os.Interrupt)
+				}
+			}
+		}()
+		defer close(done)
+		defer func() {
+			rec = recover()
+		}()
+		ir.Eval(src)
+		return nil
+	}
+	for _, src := range []string{
+		`<-make(chan int)`,
+		`make(chan string) <- "x"`,
+		`select { case <-make(chan int): case make(chan bool) <- iok: }`,
+		`for range make(chan int) {}`,
+		`for x := range make(chan int) { _ = x }`,
+		`iblock()`,
+	} {
+		if rec := eval(src); rec != SigInterrupt {
+			t.Errorf("%s: expecting panic %v, found %v", src, SigInterrupt, rec)
+		}
+		// interpreted functions called from another goroutine execute with its Run
+		result := make(chan interface{})
+		go func() {
+			result <- eval(src)
+		}()
+		if rec := <-result; rec != SigInterrupt {
+			t.Errorf("%s in another goroutine: expecting panic %v, found %v", src, SigInterrupt, rec)
+		}
+	}
+}
+
+func TestFastCtrlC(t *testing.T) {
+	ir := fast.New()
+	var out bytes.Buffer
+	ir.Comp.Stdout, ir.Comp.Stderr = &out, &out
+	ir.Comp.Options |= OptTrapPanic
+	ir.Eval(`import "time"`)
+	eval := func(src string, delays ...time.Duration) bool {
+		ir.Comp.Readline = MakeBufReadline(bufio.NewReader(strings.NewReader(src)))
+		go func() {
+			for _, delay := range delays {
+				time.Sleep(delay)
+				ir.CtrlC(os.Interrupt)
+			}
+		}()
+		return ir.ReadParseEvalPrint()
+	}
+	var exits int32
+	ir.Comp.CtrlCExit = func() { atomic.AddInt32(&exits, 1) }
+
+	// the first Ctrl+C interrupts the evaluation, and the REPL continues
+	if !eval("for {}\n", 50*time.Millisecond) || atomic.LoadInt32(&exits) != 0 {
+		t.Errorf("expecting Ctrl+C to interrupt the evaluation without exiting")
+	}
+	// a second Ctrl+C exits, even if the evaluation cannot be interrupted
+	eval("time.Sleep(300 * time.Millisecond)\n", 50*time.Millisecond, 50*time.Millisecond)
+	if n := atomic.LoadInt32(&exits); n != 1 {
+		t.Errorf("expecting a second Ctrl+C to exit, found %d exits", n)
+	}
+	// a Ctrl+C after the evaluation does not interrupt the next one
+	ir.CtrlC(os.Interrupt)
+	if v, _ := ir.Eval1("1 + 2"); v.Interface() != 3 {
+		t.Errorf("expecting 3, found %v", v)
+	}
+
+	// while waiting for input, Ctrl+C discards the statement being typed
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		ir.Repl(bufio.NewReader(pr))
+		close(done)
+	}()
+	io.WriteString(pw, "ctrlx := 1\n")
+	io.WriteString(pw, "func ctrlf() {\n")
+	time.Sleep(50 * time.Millisecond)
+	ir.CtrlC(os.Interrupt)
+	io.WriteString(pw, "ctrly := 2\n")
+	pw.Close()
+	<-done
+	if v, _ := ir.Eval1("ctrlx + ctrly"); v.Interface() != 3 {
+		t.Errorf("expecting 3, found %v", v)
+	}
+	if _, err := ir.KindOf("ctrlf"); err == nil {
+		t.Errorf("expecting ctrlf to be discarded by Ctrl+C")
+	}
+}
+
+// branches never executed are type-checked, but their statements are not compiled
+func TestFastDeadCode(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`const debug = false; var x int; var i interface{}`)
+	for _, src := range []string{
+		`if debug { x++; x++; x++ }`,
+		`if !debug { } else { x++; x++; x++ }`,
+		`for debug { x++; x++; x++ }`,
+		`for ; debug; x++ { x++ }`,
+		`if debug { switch x { case 1: x++; case 2: x-- } }`,
+		`if debug { switch i.(type) { case int: x++ } }`,
+	} {
+		before := ir.Stats().Stmts
+		ir.Eval(src)
+		if n := ir.Stats().Stmts - before; n != 0 {
+			t.Errorf("%s: expecting no compiled statements, found %d", src, n)
+		}
+	}
+	if v, _ := ir.Eval1(`x`); v.Interface() != 0 {
+		t.Errorf("expecting 0, found %v", v)
+	}
+}
+
+func TestFastStats(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`func add3(a, b, c int) int { return a + b + c }`)
+	stats := ir.Stats()
+	if stats.Stmts == 0 || stats.Exprs == 0 || stats.TypedExprs+stats.ReflectExprs != stats.Exprs {
+		t.Errorf("unexpected compile statistics: %v", stats)
+	}
+	listing, err := ir.Disasm("add3")
+	if err != nil {
+		t.Errorf("Disasm(add3) failed: %v", err)
+	} else if !strings.HasPrefix(listing, "// func add3: ") || !strings.Contains(listing, "stmtReturn") {
+		t.Errorf("unexpected Disasm(add3) output:\n%s", listing)
+	}
+	if _, err = ir.Disasm("undefinedFunc"); err == nil {
+		t.Errorf("expecting Disasm(undefinedFunc) to fail")
+	}
+	// only the listings of the most recently compiled functions are kept
+	for i := 0; i < 300; i++ {
+		ir.Eval(fmt.Sprintf("func disasm%d() int { return %d }", i, i))
+	}
+	if _, err = ir.Disasm("add3"); err == nil {
+		t.Errorf("expecting Disasm(add3) to fail after compiling many other functions")
+	}
+	if _, err = ir.Disasm("disasm299"); err != nil {
+		t.Errorf("Disasm(disasm299) failed: %v", err)
+	}
+}
+
+func TestFastTrim(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`func twice(a int) int { return a * 2 }; x := twice(3)`)
+	ir.Eval(`func twice(a int) int { return a + a }`)
+	ir.Trim()
+	if v, _ := ir.Eval1(`x + twice(4)`); v.Interface() != 14 {
+		t.Errorf("expecting x + twice(4) == 14 after Trim, found %v", v)
+	}
+	if _, err := ir.Disasm("twice"); err != nil {
+		t.Errorf("Disasm(twice) failed after Trim: %v", err)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	ir := fast.New()
+	ir.Eval("type Inner struct { X int; y string }\n" +
+		"type Level int\n" +
+		"func (l Level) MarshalText() ([]byte, error) { return []byte(\"L\" + string('0' + rune(l))), nil }\n" +
+		"func (l Level) String() string { return \"level\" }\n" +
+		"type P struct { Name string `json:\"name\"`; age int; Inner; Tags []string `json:\"tags,omitempty\"`; " +
+		"Ptr *Inner; N int `json:\",string\"`; L Level; M map[Level]bool; Skip int `json:\"-\"` }")
+	v, typ := ir.Eval1(`P{Name: "bob", age: 3, Inner: Inner{X: 1, y: "q"}, Ptr: &Inner{X: 2}, N: 7, L: 4, M: map[Level]bool{2: true}}`)
+
+	expect := `{"name":"bob","X":1,"Ptr":{"X":2},"N":"7","L":"L4","M":{"L2":true}}`
+	data, err := xr.MarshalJSON(v, typ)
+	if err != nil || string(data) != expect {
+		t.Errorf("xreflect.MarshalJSON: expecting %s, found %s, error %v", expect, data, err)
+	}
+	data, err = json.Marshal([]interface{}{xr.JSONMarshaler(v, typ)})
+	if err != nil || string(data) != "["+expect+"]" {
+		t.Errorf("json.Marshal(xreflect.JSONMarshaler): expecting [%s], found %s, error %v", expect, data, err)
+	}
+	expect = `{Name:bob age:3 Inner:{X:1 y:q} Tags:[] Ptr:0x`
+	if str := fmt.Sprintf("%+v", xr.Formatter(v, typ)); !strings.HasPrefix(str, expect) ||
+		!strings.HasSuffix(str, ` N:7 L:level M:map[level:true] Skip:0}`) {
+		t.Errorf("fmt.Sprintf(xreflect.Formatter): expecting %s... found %s", expect, str)
+	}
+}
+
+func TestFastLazyImport(t *testing.T) {
+	const path = "example.com/gomacro/lazyimport"
+	ir := fast.New()
+	ir.Eval(`func answer() int { import "` + path + `"; return lazyimport.Answer() }`)
+	if ir.Comp.Importer.IsLoaded(path) {
+		t.Fatalf("package %q should not be loaded by a function declaration", path)
+	}
+	// simulate a package loaded from a plugin
+	imports.Packages[path] = imports.Package{
+		Name:  "lazyimport",
+		Binds: map[string]r.Value{"Answer": r.ValueOf(func() int { return 42 })},
+	}
+	defer delete(imports.Packages, path)
+	for i := 0; i < 2; i++ {
+		if v, _ := ir.Eval1(`answer()`); v.Interface() != 42 {
+			t.Errorf("expecting answer() == 42, found %v", v)
+		}
+	}
+}
+
+func TestFastImportHook(t *testing.T) {
+	const mockpath = "example.com/gomacro/mockstrings"
+	imports.Packages[mockpath] = imports.Package{
+		Name:  "strings",
+		Binds: map[string]r.Value{"ToUpper": r.ValueOf(func(s string) string { return "mock " + s })},
+	}
+	defer delete(imports.Packages, mockpath)
+
+	ir := fast.New()
+	var hooked []string
+	ir.Comp.Importer.Hook = func(pkgpath string) (bool, string, error) {
+		hooked = append(hooked, pkgpath)
+		switch pkgpath {
+		case "strings":
+			return true, mockpath, nil
+		case "os":
+			return false, "", nil
+		case "net":
+			return false, "", errors.New("no network allowed")
+		}
+		return true, "", nil
+	}
+	if v, _ := ir.Eval1(`import "strings"; strings.ToUpper("x")`); v.Interface() != "mock x" {
+		t.Errorf("expecting substitute package %q to be imported, found strings.ToUpper(\"x\") = %v", mockpath, v)
+	}
+	if _, err := ir.ImportPackageOrError("", "os"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("expecting import \"os\" to be not allowed, found error %v", err)
+	}
+	if _, err := ir.ImportPackageOrError("", "net"); err == nil || err.Error() != "no network allowed" {
+		t.Errorf("expecting import \"net\" to fail with hook error, found %v", err)
+	}
+	if v, _ := ir.Eval1(`import "unicode"; unicode.IsUpper('X')`); v.Interface() != true {
+		t.Errorf("expecting unicode.IsUpper('X') == true, found %v", v)
+	}
+	if expected := []string{"strings", "os", "net", "unicode"}; !r.DeepEqual(hooked, expected) {
+		t.Errorf("expecting hook invoked for %v, found %v", expected, hooked)
+	}
+}
+
+func TestFastComplete(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import "strings"
+		const answer = 42
+		var anything string
+		type pair struct { First, Second int }
+		func (p pair) Sum() int { return p.First + p.Second }
+		var p pair`)
+	for _, test := range []struct {
+		src      string
+		expected []fast.Candidate
+	}{
+		{"an", []fast.Candidate{
+			{Name: "answer", Kind: fast.CandidateConst, Type: "untyped.Lit", Doc: "= {int 42}"},
+			{Name: "anything", Kind: fast.CandidateVar, Type: "string"},
+		}},
+		{"strings.ToUpp", []fast.Candidate{
+			{Name: "ToUpper", Kind: fast.CandidateFunc, Type: "func(string) string"},
+			{Name: "ToUpperSpecial", Kind: fast.CandidateFunc, Type: "func(unicode.SpecialCase, string) string"},
+		}},
+		{"pai", []fast.Candidate{{Name: "pair", Kind: fast.CandidateType, Type: "struct{First int; Second int}"}}},
+		{"Fir", nil},
+	} {
+		if actual := ir.Complete(test.src+" // ignored", len(test.src)); !r.DeepEqual(actual, test.expected) {
+			t.Errorf("Complete(%q): expecting %v, found %v", test.src, test.expected, actual)
+		}
+	}
+	// other candidates are also available, as the methods that CTI generics add to basic types
+	for _, test := range []struct {
+		src      string
+		expected fast.Candidate
+	}{
+		{"str", fast.Candidate{Name: "strings", Kind: fast.CandidatePackage, Doc: `import "strings"`}},
+		{"pa", fast.Candidate{Name: "package", Kind: fast.CandidateKeyword, Doc: "Go keyword"}},
+		{"pa", fast.Candidate{Name: "panic", Kind: fast.CandidateFunc, Doc: "builtin function"}},
+		{"1 + p.", fast.Candidate{Name: "Second", Kind: fast.CandidateField, Type: "int"}},
+		{"1 + p.", fast.Candidate{Name: "Sum", Kind: fast.CandidateMethod, Type: "func() int"}},
+	} {
+		found := false
+		actual := ir.Complete(test.src, len(test.src))
+		for _, candidate := range actual {
+			if candidate == test.expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Complete(%q): expecting %v among %v", test.src, test.expected, actual)
+		}
+	}
+}
+
+func TestFastPrewarm(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Importer.SetImportFilter(func(pkgpath string) bool { return pkgpath != "os" })
+	var dones []int
+	var failed []string
+	errs := ir.Prewarm([]string{"strings", "os", "unicode", "strings"}, func(pkgpath string, done, total int, err error) {
+		if total != 3 {
+			t.Errorf("prewarm progress: expecting total == 3, found %d", total)
+		}
+		dones = append(dones, done)
+		if err != nil {
+			failed = append(failed, pkgpath)
+		}
+	})
+	if len(errs) != 4 || errs[0] != nil || errs[1] == nil || errs[2] != nil || errs[3] != nil {
+		t.Errorf("prewarm: expecting only \"os\" to fail, found errors %v", errs)
+	}
+	if expected := []int{1, 2, 3}; !r.DeepEqual(dones, expected) {
+		t.Errorf("prewarm progress: expecting done == %v, found %v", expected, dones)
+	}
+	if expected := []string{"os"}; !r.DeepEqual(failed, expected) {
+		t.Errorf("prewarm progress: expecting failed packages %v, found %v", expected, failed)
+	}
+	if ir.Comp.KnownImports["unicode"] == nil {
+		t.Errorf("prewarm: expecting package \"unicode\" to be known")
+	}
+	if v, _ := ir.Eval1(`import "unicode"; unicode.IsUpper('X')`); v.Interface() != true {
+		t.Errorf("expecting unicode.IsUpper('X') == true, found %v", v)
+	}
+}
+
+func TestDumbReadline(t *testing.T) {
+	var out bytes.Buffer
+	ir := fast.New()
+	tty := MakeDumbReadline(strings.NewReader("x := 1 +\n2\nx * 3\n"), &out)
+	ir.Comp.Readline = tty
+	ir.Comp.Options |= OptShowPrompt
+	ir.Comp.Stdout = ioutil.Discard
+	tty.SetWordCompleter(ir.CompleteWords)
+	for ir.ReadParseEvalPrint() {
+	}
+	if expected := "gomacro> . . . .  gomacro> gomacro> "; out.String() != expected {
+		t.Errorf("dumb readline: expecting output %q, found %q", expected, out.String())
+	}
+	if v, _ := ir.Eval1("x"); v.Interface() != 3 {
+		t.Errorf("dumb readline: expecting x == 3, found %v", v)
+	}
+	for _, name := range []string{"auto", "ansi", "dumb"} {
+		if mode, err := ParseTerminalMode(name); err != nil || mode.String() != name {
+			t.Errorf("ParseTerminalMode(%q) returned %v, %v", name, mode, err)
+		}
+	}
+	if err := cmd.New().Main([]string{"--terminal=vt100"}); err == nil {
+		t.Errorf("expecting error for invalid option --terminal=vt100")
+	}
+}
+
+func TestFastRegisterCommand(t *testing.T) {
+	var targets []string
+	err := fast.RegisterCommand("deploy", `deploy TARGET     deploy to TARGET`,
+		func(ir *fast.Interp, arg string) {
+			targets = append(targets, strings.TrimSpace(arg))
+		}, func(ir *fast.Interp, arg string) []string {
+			return []string{"staging", "production"}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Commands.Del("deploy")
+	if err := fast.RegisterCommand("1deploy", "", func(*fast.Interp, string) {}, nil); err == nil {
+		t.Errorf("RegisterCommand: expecting error for invalid name \"1deploy\"")
+	}
+	var out bytes.Buffer
+	ir := fast.New()
+	ir.Comp.Stdout = &out
+	ir.ParseEvalPrint(":dep staging")
+	ir.ParseEvalPrint(":help")
+	if expected := []string{"staging"}; !r.DeepEqual(targets, expected) {
+		t.Errorf("expecting :deploy to receive %v, found %v", expected, targets)
+	}
+	if !strings.Contains(out.String(), ":deploy TARGET     deploy to TARGET\n") {
+		t.Errorf("expecting :help to show :deploy, found %q", out.String())
+	}
+	for _, test := range []struct {
+		line, head  string
+		completions []string
+	}{
+		{":depl", ":", []string{"deploy"}},
+		{":deploy pro", ":deploy ", []string{"production"}},
+		{":deploy ", ":deploy ", []string{"production", "staging"}},
+		{":set ext la", ":set ext ", []string{"lambdas"}},
+		{":prelude s", ":prelude ", []string{"std"}},
+	} {
+		head, completions, _ := ir.CompleteWords(test.line, len(test.line))
+		if head != test.head || !r.DeepEqual(completions, test.completions) {
+			t.Errorf("CompleteWords(%q): expecting %q, %v, found %q, %v", test.line, test.head, test.completions, head, completions)
+		}
+	}
+	// commands can also be registered by interpreted code
+	ir.Eval(`import "github.com/cosmos72/gomacro/fast"
+		var greeted string
+		fast.RegisterCommand("greet", "greet NAME        say hello", func(ir *fast.Interp, arg string) {
+			greeted = "hello " + arg
+		}, nil)`)
+	defer fast.Commands.Del("greet")
+	ir.ParseEvalPrint(":greet world")
+	if v, _ := ir.Eval1("greeted"); v.Interface() != "hello world" {
+		t.Errorf("expecting greeted == \"hello world\", found %v", v)
+	}
+}
+
+func TestFastImportedGenericFunc(t *testing.T) {
+	// as written by import bindings for func Max[S ~[]E, E cmp.Ordered](s S) E
+	max := func(s []int) int {
+		m := s[0]
+		for _, x := range s[1:] {
+			if x > m {
+				m = x
+			}
+		}
+		return m
+	}
+	imports.Packages["gomacro.test/generic"] = imports.Package{
+		Name: "generic",
+		Binds: map[string]r.Value{
+			"Max[[]int]":      r.ValueOf(max),
+			"Max[[]int, int]": r.ValueOf(max),
+			"Table":           r.ValueOf(&[]int{7, 8}).Elem(),
+		},
+	}
+	defer delete(imports.Packages, "gomacro.test/generic")
+
+	ir := fast.New()
+	ir.Eval(`import "gomacro.test/generic"`)
+	for src, expected := range map[string]int{
+		`generic.Max[[]int]([]int{3, 9, 2})`:                     9,
+		`generic.Max[[]int, int]([]int{3, 9, 2})`:                9,
+		`type Ints = []int; f := generic.Max[Ints]; f([]int{5})`: 5,
+		`generic.Table[1]`:                                       8,
+	} {
+		if v, _ := ir.Eval1(src); v.Interface() != expected {
+			t.Errorf("%s: expecting %v, found %v", src, expected, v)
+		}
+	}
+	func() {
+		defer func() {
+			rec := recover()
+			if rec == nil || !strings.Contains(fmt.Sprint(rec), "no compiled instantiation [[]string]") {
+				t.Errorf("expecting error about missing instantiation, found %v", rec)
+			}
+		}()
+		ir.Eval(`generic.Max[[]string]`)
+	}()
+}
+
+func TestFastLoadAllErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "load.go")
+	write := func(src string) {
+		if err := ioutil.WriteFile(file, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("var x = 1\n\nfunc f() int {\n\treturn y\n}\n\nvar z string = true\nx = 7\n")
+
+	ir := fast.New()
+	err := ir.LoadFile(file, false)
+	if err == nil || !strings.HasSuffix(err.Error(), "load.go:4:9: undefined identifier: y") {
+		t.Errorf("expecting only the first error, found %v", err)
+	}
+	if v, _ := ir.Eval1("x"); v.Interface() != 1 {
+		t.Errorf("expecting x == 1, found %v", v)
+	}
+
+	ir = fast.New()
+	err = ir.LoadFile(file, true)
+	errs, _ := err.(fast.CompileErrors)
+	if len(errs) != 2 || !strings.HasSuffix(errs[0].Error(), "load.go:4:9: undefined identifier: y") ||
+		!strings.Contains(errs[1].Error(), "load.go:7: cannot convert untyped constant") {
+		t.Errorf("expecting two compile errors, found %v", err)
+	}
+	if v, _ := ir.Eval1("x"); v.Interface() != 0 {
+		t.Errorf("expecting x == 0, i.e. file not executed, found %v", v)
+	}
+
+	write("var x = 1\n\nfunc f() int {\n\treturn x\n}\n\nx = f() + 6\n")
+	ir = fast.New()
+	ir.Comp.Stderr = ioutil.Discard
+	ir.ParseEvalPrint(":set allerrors on")
+	ir.ParseEvalPrint(":load " + file)
+	if v, _ := ir.Eval1("x"); v.Interface() != 7 {
+		t.Errorf("expecting x == 7, found %v", v)
+	}
+}
+
+func TestFastUnused(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "load.go")
+	src := "import (\n\t\"fmt\"\n\tstr \"strings\"\n)\n\nfunc f() int {\n" +
+		"\ty := 0\n\ty = 1\n\tvar w int\n\tz := 0\n\tz++\n\tx, z := 1, 2\n" +
+		"\tif false {\n\t\tfmt.Println(w)\n\t}\n" +
+		"\tk := 3\n\tg := func() int { return k }\n\treturn g() + z\n}\n"
+	if err := ioutil.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ir := fast.New()
+	err := ir.LoadFile(file, true)
+	errs, _ := err.(fast.CompileErrors)
+	if len(errs) != 1 || !strings.HasSuffix(errs[0].Error(), "load.go:7:2: declared and not used: y\n"+file+":12:2: declared and not used: x") {
+		t.Errorf("expecting unused variables y and x, found %v", err)
+	}
+	// unused imports are reported only if there are no other errors
+	file2 := filepath.Join(filepath.Dir(file), "load2.go")
+	src2 := "import (\n\t\"fmt\"\n\tstr \"strings\"\n)\n\nfunc g() {\n\tfmt.Println()\n}\n"
+	if err := ioutil.WriteFile(file2, []byte(src2), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, allErrors := range []bool{false, true} {
+		ir = fast.New()
+		err = ir.LoadFile(file2, allErrors)
+		if err == nil || !strings.HasSuffix(err.Error(), `load2.go:3:2: "strings" imported as str and not used`) {
+			t.Errorf("expecting unused import strings, found %v", err)
+		}
+	}
+
+	// REPL relaxes the rule: warnings only
+	var buf bytes.Buffer
+	ir = fast.New()
+	ir.Comp.Stderr = &buf
+	ir.Eval(src)
+	if v, _ := ir.Eval1("f()"); v.Interface() != 5 {
+		t.Errorf("expecting f() == 5, found %v", v)
+	}
+	if warn := buf.String(); !strings.Contains(warn, "declared and not used: y") || strings.Contains(warn, "imported") {
+		t.Errorf("expecting a warning about unused variable y, found %q", warn)
+	}
+
+	for _, mode := range []fast.UnusedMode{fast.UnusedOff, fast.UnusedWarn} {
+		buf.Reset()
+		ir = fast.New()
+		ir.Comp.Stderr = &buf
+		ir.Comp.Unused = mode
+		if err := ir.LoadFile(file, false); err != nil {
+			t.Errorf("unused %v: unexpected error %v", mode, err)
+		}
+		if warned := strings.Contains(buf.String(), "imported as str and not used"); warned != (mode == fast.UnusedWarn) {
+			t.Errorf("unused %v: unexpected warnings %q", mode, buf.String())
+		}
+	}
+
+	ir = fast.New()
+	ir.Comp.Stderr = ioutil.Discard
+	ir.ParseEvalPrint(":set unused error")
+	func() {
+		defer func() {
+			if rec := recover(); rec == nil || !strings.Contains(fmt.Sprint(rec), "declared and not used: a") {
+				t.Errorf("expecting error about unused variable a, found %v", rec)
+			}
+		}()
+		ir.Eval("func h() { a := 1 }")
+	}()
+}
+
+func TestFastLoadDirBuildConstraints(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go":            "var common = true\n",
+		"b_linux.go":      "var onLinux = true\n",
+		"b_windows.go":    "var onWindows = true\n",
+		"c.go":            "//go:build mytag\n\npackage main\n\nvar tagged = true\n",
+		"d.gomacro":       "//go:build !mytag\n\nvar untagged = true\n",
+		"e_arm64.gomacro": "var onArm64 = true\n",
+		"f_test.go":       "var testing = true\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ir := fast.New()
+	ir.Comp.Stderr = ioutil.Discard
+	ir.ParseEvalPrint(":set goos windows")
+	ir.ParseEvalPrint(":set goarch arm64")
+	ir.ParseEvalPrint(":set buildtags foo,mytag")
+	ir.ParseEvalPrint(":load " + dir)
+	for name, expected := range map[string]bool{
+		"common": true, "onLinux": false, "onWindows": true, "tagged": true,
+		"untagged": false, "onArm64": true, "testing": false,
+	} {
+		if found := ir.Comp.TryResolve(name) != nil; found != expected {
+			t.Errorf("expecting %s to be defined = %v, found %v", name, expected, found)
+		}
+	}
+}
+
+func TestFastProjectImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "geom"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range map[string]string{
+		"go.mod":       "module gomacro.test/proj\n",
+		"geom/geom.go": "package geom\n\nconst Answer = 42\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// pretend the package was already compiled, to avoid building a plugin
+	imports.PackagesLock.Lock()
+	imports.Packages["gomacro.test/proj/geom"] = imports.Package{
+		Name:  "geom",
+		Binds: map[string]r.Value{"Answer": r.ValueOf(42)},
+	}
+	imports.PackagesLock.Unlock()
+	defer func() {
+		imports.PackagesLock.Lock()
+		delete(imports.Packages, "gomacro.test/proj/geom")
+		imports.PackagesLock.Unlock()
+	}()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(filepath.Join(dir, "geom")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	ir := fast.New()
+	ir.ParseEvalPrint(":set project on")
+	if v, _ := ir.Eval1("geom.Answer"); v.Interface() != 42 {
+		t.Errorf("expecting geom.Answer == 42, found %v", v)
+	}
+	if proj := ir.Comp.Project(); proj == nil || proj.Module != "gomacro.test/proj" {
+		t.Errorf("expecting project %q, found %v", "gomacro.test/proj", proj)
+	}
+}
+
+func TestFastImportsRegistry(t *testing.T) {
+	imports.PackagesLock.Lock()
+	imports.Packages["gomacro.test/shared"] = imports.Package{
+		Name:  "shared",
+		Binds: map[string]r.Value{"Answer": r.ValueOf(42)},
+	}
+	imports.PackagesLock.Unlock()
+	defer func() {
+		imports.PackagesLock.Lock()
+		delete(imports.Packages, "gomacro.test/shared")
+		imports.PackagesLock.Unlock()
+	}()
+
+	ir1, ir2 := fast.New(), fast.New()
+	ir1.Comp.Universe.Imports.MergePackage("gomacro.test/private", imports.PackageUnderlying{
+		Name:  "private",
+		Binds: map[string]r.Value{"Answer": r.ValueOf(7)},
+	})
+	if v, _ := ir1.Eval1(`import "gomacro.test/private"; private.Answer`); v.Interface() != 7 {
+		t.Errorf("expecting private.Answer == 7, found %v", v)
+	}
+	if ir2.Comp.Importer.IsLoaded("gomacro.test/private") {
+		t.Errorf("package registered in an interpreter should not be visible from other interpreters")
+	}
+	// unloading a global package only hides it from the interpreter that unloads it
+	ir1.Comp.Stderr = ioutil.Discard
+	ir1.Comp.UnloadPackage("gomacro.test/shared")
+	if ir1.Comp.Importer.IsLoaded("gomacro.test/shared") {
+		t.Errorf("expecting package \"gomacro.test/shared\" to be unloaded")
+	}
+	if v, _ := ir2.Eval1(`import "gomacro.test/shared"; shared.Answer`); v.Interface() != 42 {
+		t.Errorf("expecting shared.Answer == 42, found %v", v)
+	}
+
+	// registries can be used concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			registry := ir2.Comp.Universe.Imports
+			for j := 0; j < 100; j++ {
+				path := fmt.Sprintf("gomacro.test/concurrent%d_%d", i, j)
+				registry.MergePackage(path, imports.PackageUnderlying{})
+				if _, found := registry.Lookup(path); !found {
+					t.Errorf("package %q not found after registering it", path)
+				}
+				registry.Paths()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestFastPartialEval(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import ("math"; "strings"); const n = 3; var x int; var s string; type T struct{ n int }`)
+	tests := []struct {
+		src, expected string
+	}{
+		{"x + (2 * n)", "x + 6"},
+		{`strings.ToUpper("ab") + s`, `"AB" + s`},
+		{"int8(n) + 4", "int8(7)"},
+		{"math.Sqrt(4) < 1", "false"},
+		{"'a' + 1", "'b'"},
+		{"T{n: n * n}", "T{n: 9}"},
+		{"s[len(\"ab\"):]", "s[2:]"},
+		{`strings.Repeat("a", -1)`, ""}, // panics at runtime: not evaluated at compile time
+		{"x", ""},
+	}
+	for _, test := range tests {
+		node := UnwrapTrivialAst(ir.Parse(test.src).Get(0)).Interface().(ast.Expr)
+		out, changed := ir.Comp.PartialEval(node)
+		if test.expected == "" {
+			if changed || out != node {
+				t.Errorf("PartialEval(%s): expecting no changes, found %s", test.src, ir.Comp.Sprintf("%v", out))
+			}
+		} else if str := ir.Comp.Sprintf("%v", out); !changed || str != test.expected {
+			t.Errorf("PartialEval(%s): expecting %s, found %s", test.src, test.expected, str)
+		}
+	}
+	// macros can use it too
+	ir.Eval(`macro simplify(expr interface{}) interface{} { e, _ := PartialEval(expr); return e }`)
+	if v, _ := ir.Eval1(`simplify; x + n*n`); v.Interface() != 9 {
+		t.Errorf("expecting x + n*n == 9, found %v", v)
+	}
+}
+
+func TestFastUndefinedIdentifier(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`var counter int; type Point struct{}; import "fmt"`)
+	evalError := func(src string) (err *fast.UndefinedIdentifierError) {
+		defer func() {
+			err, _ = recover().(*fast.UndefinedIdentifierError)
+		}()
+		ir.Eval(src)
+		return nil
+	}
+	tests := []struct {
+		src        string
+		suggestion string // best suggestion
+		importpath string
+	}{
+		{"countr", "counter", ""},
+		{"var p point", "Point", ""},
+		{"fmt.Prinln", "Println", ""},
+		{"strings.ToUpper", "string", "strings"},
+		{"xyzzy", "", ""},
+	}
+	for _, test := range tests {
+		err := evalError(test.src)
+		if err == nil {
+			t.Errorf("%s: expecting *fast.UndefinedIdentifierError, found none", test.src)
+			continue
+		}
+		var suggestion string
+		if len(err.Suggestions) != 0 {
+			suggestion = err.Suggestions[0]
+		}
+		if suggestion != test.suggestion || err.Import != test.importpath {
+			t.Errorf("%s: expecting suggestion %q and import %q, found %q and %q in error: %v",
+				test.src, test.suggestion, test.importpath, suggestion, err.Import, err)
+		}
+	}
+	expected := "undefined identifier: countr, did you mean counter?"
+	if msg := evalError("countr").Error(); !strings.HasSuffix(msg, expected) {
+		t.Errorf("expecting error message %q, found %q", expected, msg)
+	}
+}
+
+func TestFastImportAlias(t *testing.T) {
+	ir := fast.New()
+	var buf bytes.Buffer
+	ir.Comp.Stderr = &buf
+	ir.Eval(`import "math/rand"; import "crypto/rand"`)
+	expected := "// warning: import \"crypto/rand\": package name rand already refers to \"math/rand\", imported as rand2\n"
+	if buf.String() != expected {
+		t.Errorf("expecting warning %q, found %q", expected, buf.String())
+	}
+	if v, _ := ir.Eval1(`rand2.Reader != nil && rand.Intn(1) == 0`); v.Interface() != true {
+		t.Errorf("expecting rand2 to refer to \"crypto/rand\" and rand to \"math/rand\", found %v", v)
+	}
+	// importing again reuses the same alias
+	ir.Eval(`import "crypto/rand"`)
+	if sym := ir.Comp.TryResolve("rand3"); sym != nil {
+		t.Errorf("expecting rand3 to be unbound, found %v", sym)
+	}
+
+	ir = fast.New()
+	ir.Comp.Options |= OptStrictImportAlias
+	ir.Eval(`import "math/rand"`)
+	_, err := ir.ImportPackageOrError("", "crypto/rand")
+	if aerr, ok := err.(*fast.ImportAliasError); !ok {
+		t.Errorf("expecting *fast.ImportAliasError, found %v", err)
+	} else if aerr.OtherPath != "math/rand" || !r.DeepEqual(aerr.Suggested, []string{"cryptorand", "rand2"}) {
+		t.Errorf("expecting suggested aliases [cryptorand rand2] for \"crypto/rand\", found %v", aerr)
+	}
+}
+
+func TestFastTimeout(t *testing.T) {
+	ir := fast.New()
+	var stdout, stderr bytes.Buffer
+	ir.Comp.Stdout = &stdout
+	ir.Comp.Stderr = &stderr
+	ir.Comp.Options |= OptShowEval
+	ir.ParseEvalPrint(":set timeout 100ms")
+	if ir.Comp.Timeout != 100*time.Millisecond {
+		t.Errorf("expecting timeout 100ms, found %v", ir.Comp.Timeout)
+	}
+	ir.ParseEvalPrint("var i int; for { i++ }")
+	if expected := "evaluation interrupted: exceeded timeout 100ms\n"; stderr.String() != expected {
+		t.Errorf("expecting %q, found %q", expected, stderr.String())
+	}
+	// later evaluations must not be affected
+	stdout.Reset()
+	ir.ParseEvalPrint("i > 0")
+	if expected := "true\n"; stdout.String() != expected {
+		t.Errorf("expecting %q, found %q", expected, stdout.String())
+	}
+	ir.ParseEvalPrint(":set timeout off")
+	if ir.Comp.Timeout != 0 {
+		t.Errorf("expecting no timeout, found %v", ir.Comp.Timeout)
+	}
+}
+
+func TestFastDeterministicMapRange(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Stderr = &bytes.Buffer{} // ignore warnings about redefined identifiers
+	ir.ParseEvalPrint(":set deterministic-map-range on")
+	if ir.Comp.Options&OptDeterministicMapRange == 0 {
+		t.Fatalf("expecting option %v to be set", OptDeterministicMapRange)
+	}
+	ir.Eval(`import "fmt"`)
+	for _, test := range []struct {
+		src, expected string
+	}{
+		{`m := map[string]int{"c": 3, "a": 1, "d": 4, "b": 2}`, "a=1 b=2 c=3 d=4 "},
+		{`m := map[int]string{10: "x", -3: "y", 7: "z", 0: "w"}`, "-3=y 0=w 7=z 10=x "},
+		{`m := map[float64]bool{2.5: true, -1: false, 0.5: true}`, "-1=false 0.5=true 2.5=true "},
+		{`m := map[[2]int]int{{2, 1}: 1, {1, 9}: 2, {1, 2}: 3}`, "[1 2]=3 [1 9]=2 [2 1]=1 "},
+	} {
+		src := test.src + `; s := ""; for k, v := range m { s += fmt.Sprintf("%v=%v ", k, v) }; s`
+		for i := 0; i < 5; i++ {
+			if v, _ := ir.Eval1(src); v.Interface() != test.expected {
+				t.Errorf("%s: expecting deterministic range %q, found %v", test.src, test.expected, v)
+				break
+			}
+		}
+	}
+	// removed entries are skipped, modified entries show the current value
+	v, _ := ir.Eval1(`m := map[int]int{1: 1, 2: 2, 3: 3, 4: 4}; s := ""
+		for k, v := range m {
+			if k == 1 { delete(m, 4); m[2] = 20 }
+			s += fmt.Sprintf("%v=%v ", k, v)
+		}
+		s`)
+	if expected := "1=1 2=20 3=3 "; v.Interface() != expected {
+		t.Errorf("expecting deterministic range %q, found %v", expected, v)
+	}
+}
+
+func TestFastWhence(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptTrackProvenance
+	for _, test := range []struct {
+		src, name, expected string
+	}{
+		{"var x int", "x", "var x int"},
+		{"x = 3", "x", "x = 3"},
+		{"func f() { x += 2 }", "x", "x = 3"},
+		{"f()", "x", "func f() { x += 2 }"},
+		{"var s string; s, x = \"a\", 9", "x", "var s string; s, x = \"a\", 9"},
+		{"func g() (int, int) { return 1, 2 }; m, n := g()", "n", "func g() (int, int) { return 1, 2 }; m, n := g()"},
+		{"func h() { x := 1; x++ }; h()", "x", "var s string; s, x = \"a\", 9"},
+	} {
+		ir.Eval(test.src)
+		if _, source, _ := ir.Whence(test.name); source != test.expected {
+			t.Errorf("after %s: expecting %s last written by %q, found %q", test.src, test.name, test.expected, source)
+		}
+	}
+	ir.Comp.Options &^= OptTrackProvenance
+	ir.Eval("var y = 1")
+	if pos, source, ok := ir.Whence("y"); ok {
+		t.Errorf("expecting no recorded writes to y, found %v: %q", pos, source)
+	}
+}
+
+func TestFastLambdas(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptExtLambdas
+	ir.Eval("func apply(xs []int, f func(int) int) []int { ys := make([]int, len(xs)); for i, x := range xs { ys[i] = f(x) }; return ys }")
+	for _, test := range []struct {
+		src      string
+		expected interface{}
+	}{
+		{"apply([]int{1, 2, 3}, x => x * 2)", []int{2, 4, 6}},
+		{"apply([]int{1, 2, 3}, \\x -> x + 10)", []int{11, 12, 13}},
+		{"var g func(int, int) int = (a, b) => a * b; g(6, 7)", 42},
+		{"var h func() string; h = () => \"hi\"; h()", "hi"},
+		{"type Pred func(string) bool; var p Pred = s => len(s) > 2; p(\"abc\")", true},
+		{"func mk() func(int) int { return x => { y := x + 1; return y * y } }; mk()(2)", 9},
+		{"[]func(int) int{x => x + 1, x => x + 2}[1](1)", 3},
+	} {
+		v, _ := ir.Eval1(test.src)
+		if actual := v.Interface(); !r.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, actual)
+		}
+	}
+	fails := func(src string) (failed bool) {
+		defer func() {
+			failed = recover() != nil
+		}()
+		ir.Eval(src)
+		return false
+	}
+	if !fails("w := x => x") {
+		t.Errorf("expecting error for lambda without expected function type")
+	}
+	ir.Comp.Options &^= OptExtLambdas
+	if !fails("apply([]int{1}, x => x)") {
+		t.Errorf("expecting syntax error for lambda with syntax extension disabled")
+	}
+}
+
+func TestFastExtBigNums(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptExtBigNums
+	for _, test := range []struct {
+		src      string
+		expected string
+	}{
+		{"x := 123456789012345678901234567890n; x * x", "15241578753238836750495351562536198787501905199875019052100"},
+		{"x + 1", "123456789012345678901234567891"},
+		{"x % 7n", "0"},
+		{"-x << 2", "-493827156049382715604938271560"},
+		{"var k uint = 100; 1n << k", "1267650600228229401496703205376"},
+		{"x += 10; x++; x", "123456789012345678901234567901"},
+		{"y := 1.5n; y / 3", "1/2"},
+		{"y *= 1.0n / 3; y--; y", "-1/2"},
+		{"0x10n", "16"},
+	} {
+		v, _ := ir.Eval1(test.src)
+		if actual := fmt.Sprint(v.Interface()); actual != test.expected {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, actual)
+		}
+	}
+	for _, test := range []struct {
+		src      string
+		expected bool
+	}{
+		{"x > 1e29", true},
+		{"2n == 2", true},
+		{"y < -0.75", false},
+		{"import \"math/big\"; var z *big.Int; z == nil", true},
+	} {
+		v, _ := ir.Eval1(test.src)
+		if actual := v.Interface(); actual != test.expected {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, actual)
+		}
+	}
+	fails := func(src string) (failed bool) {
+		defer func() {
+			failed = recover() != nil
+		}()
+		ir.Eval(src)
+		return false
+	}
+	if !fails("x + y") {
+		t.Errorf("expecting error for mismatched *big.Int and *big.Rat operands")
+	}
+	if !fails("x + 0.5") {
+		t.Errorf("expecting error for non-integer constant added to *big.Int")
+	}
+	ir.Comp.Options &^= OptExtBigNums
+	if !fails("5n") {
+		t.Errorf("expecting syntax error for big number literal with syntax extension disabled")
+	}
+}
+
+func TestFastLoadURL(t *testing.T) {
+	saveCacheDir := fast.URLCacheDir
+	fast.URLCacheDir = t.TempDir()
+	defer func() {
+		fast.URLCacheDir = saveCacheDir
+	}()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/snippet.go":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, "package snippet\n\nimport \"strings\"\n\nfunc Shout(s string) string { return strings.ToUpper(s) + \"!\" }\n")
+		case "/gist.html":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html></html>")
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	snippet := srv.URL + "/snippet.go"
+
+	ir := fast.New()
+	if err := ir.LoadURL(snippet, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := ir.Eval1(`Shout("hi")`); v.Interface() != "HI!" {
+		t.Errorf(`Shout("hi"): expecting "HI!", found %v`, v)
+	}
+	for _, path := range []string{"/gist.html", "/missing.go"} {
+		if err := ir.LoadURL(srv.URL+path, false); err == nil {
+			t.Errorf("LoadURL(%q): expecting error, found nil", path)
+		}
+	}
+
+	ir = fast.New()
+	fails := func(src string) (failed bool) {
+		defer func() {
+			failed = recover() != nil
+		}()
+		ir.Eval(src)
+		return false
+	}
+	if !fails(`import "` + snippet + `"`) {
+		t.Errorf("expecting error for import of URL with option %v disabled", OptImportURL)
+	}
+	ir.Comp.Options |= OptImportURL
+	ir.Eval(`import "` + snippet + `"`)
+	if v, _ := ir.Eval1(`snippet.Shout("x")`); v.Interface() != "X!" {
+		t.Errorf(`snippet.Shout("x"): expecting "X!", found %v`, v)
+	}
+
+	// once the server is unreachable, the cached copy is used
+	srv.Close()
+	ir = fast.New()
+	if err := ir.LoadURL(snippet, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := ir.Eval1(`Shout("bye")`); v.Interface() != "BYE!" {
+		t.Errorf(`Shout("bye"): expecting "BYE!", found %v`, v)
+	}
+}
+
+func TestFastRuntimeError(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptDebugger // keep the names of interpreted functions
+	lib := ir.Library()
+	if _, _, err := lib.Eval(`func f(s []int, i int) int {
+	return s[i]
+}
+func g(i int) int {
+	x := []int{1, 2, 3}
+	if i > 0 {
+		return f(x, i)
+	}
+	return 0
+}
+func safe() (rec interface{}) {
+	defer func() {
+		rec = recover()
+	}()
+	g(4)
+	return nil
+}`); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := lib.Eval("g(5)")
+	var rerr *fast.InterpRuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expecting *fast.InterpRuntimeError, found %v <%T>", err, err)
+	}
+	expected := []fast.StackFrame{{Func: "f"}, {Func: "g"}, {Func: ""}}
+	lines := []int{2, 7, 0}
+	if len(rerr.Stack) != len(expected) {
+		t.Fatalf("expecting %d stack frames, found %d:\n%s", len(expected), len(rerr.Stack), rerr.StackTrace())
+	}
+	for i, frame := range rerr.Stack {
+		if frame.Func != expected[i].Func || (lines[i] != 0 && frame.Pos.Line != lines[i]) {
+			t.Errorf("stack frame %d: expecting function %q at line %d, found %v", i, expected[i].Func, lines[i], frame)
+		}
+	}
+	var e *fast.Error
+	if errors.As(err, &e) && e.Pos.Line != 2 {
+		t.Errorf("expecting error at line 2, found %v", e.Pos)
+	}
+
+	// the original runtime.Error is preserved
+	_, _, err = lib.Eval("var m map[string]int; m[\"a\"] = 1")
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expecting *fast.InterpRuntimeError, found %v <%T>", err, err)
+	} else if _, ok := rerr.Err.(runtime.Error); !ok || !strings.Contains(err.Error(), "nil map") {
+		t.Errorf("expecting wrapped runtime.Error, found %v <%T>", rerr.Err, rerr.Err)
+	}
+
+	// interpreted code recovers the original value, and panics not caused by runtime errors are unchanged
+	if v, _, err := lib.Eval1("safe()"); err != nil || v.IsNil() {
+		t.Errorf("safe(): expecting recovered value, found %v, error %v", v, err)
+	} else if _, ok := v.Interface().(*fast.InterpRuntimeError); ok {
+		t.Errorf("safe(): expecting original panic value, found %v", v)
+	}
+	if _, _, err = lib.Eval(`panic("boom")`); errors.As(err, &rerr) {
+		t.Errorf("panic(\"boom\"): expecting no *fast.InterpRuntimeError, found %v", err)
+	}
+}
+
+func TestFastMock(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import "strings"; func upper(s string) string { return strings.ToUpper(s) }; f := strings.ToUpper`)
+	restore, err := ir.Mock("strings.ToUpper", func(s string) string { return "mock " + s })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{`upper("a")`, `strings.ToUpper("a")`} {
+		if v, _ := ir.Eval1(src); v.String() != "mock a" {
+			t.Errorf("%s: expecting %q, found %q", src, "mock a", v.String())
+		}
+	}
+	// functions extracted before Mock() are not affected
+	if v, _ := ir.Eval1(`f("a")`); v.String() != "A" {
+		t.Errorf("f(\"a\"): expecting %q, found %q", "A", v.String())
+	}
+	restore()
+	if v, _ := ir.Eval1(`upper("a")`); v.String() != "A" {
+		t.Errorf("upper(\"a\") after restore: expecting %q, found %q", "A", v.String())
+	}
+	if _, err := ir.Mock("strings.ToUpper", func(int) int { return 0 }); err == nil {
+		t.Errorf("expecting error when mocking strings.ToUpper with a function of a different type")
+	}
+	if _, err := ir.Mock("strings.NoSuchFunc", strings.ToLower); err == nil {
+		t.Errorf("expecting error when mocking a nonexistent symbol")
+	}
+}
+
+func TestFastOutputMux(t *testing.T) {
+	f, err := ioutil.TempFile("", "gomacro-mux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	save := os.Stdout
+	os.Stdout = f
+	defer func() {
+		os.Stdout = save
+	}()
+
+	ir := fast.New()
+	ir.Eval(`import ("fmt"; "sync")`)
+	if err := ir.MultiplexOutput(true); err != nil {
+		t.Fatal(err)
+	}
+	ir.Eval(`
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				fmt.Print("hello ")
+				fmt.Print("world")
+				fmt.Println()
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Println("done")`)
+	ir.StopMultiplexOutput()
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if n := len(lines); n != 201 {
+		t.Fatalf("expecting 201 lines, found %d", n)
+	}
+	for _, line := range lines[:200] {
+		if !strings.HasPrefix(line, "[goroutine ") || !strings.HasSuffix(line, "] hello world") {
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+	// lines printed by the goroutine that called MultiplexOutput have no prefix
+	if lines[200] != "done" {
+		t.Errorf("expecting %q, found %q", "done", lines[200])
+	}
+	if ir.Mux() != nil {
+		t.Errorf("expecting nil Interp.Mux() after StopMultiplexOutput")
+	}
+}
+
+func TestFastKindOf(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`type T struct{ A int; R [2]int }; var x int; var m map[string]T; var p *T; n := 0; func f() (int, error) { n++; return n, nil }`)
+	for _, test := range []struct {
+		src      string
+		expected string
+	}{
+		{"x", "int (addressable, assignable)"},
+		{"x + 1", "int"},
+		{"1 << 10", "untyped int (constant)"},
+		{"int8(3)", "int8 (constant)"},
+		{"nil", "untyped nil"},
+		{"f()", "(int, error)"},
+		{"f", "func() (int, error)"},
+		{`m["a"]`, "main.T (assignable)"},
+		{`m["a"].A`, "int"},
+		{"p.R[1]", "int (addressable, assignable)"},
+		{"*p", "main.T (addressable, assignable)"},
+		{"T{}", "main.T"},
+		{"T{}.A", "int"},
+		{"[]int{1}[0]", "int (addressable, assignable)"},
+	} {
+		info, err := ir.KindOf(test.src)
+		if err != nil {
+			t.Errorf("KindOf(%q) failed: %v", test.src, err)
+		} else if actual := info.String(); actual != test.expected {
+			t.Errorf("KindOf(%q): expecting %q, found %q", test.src, test.expected, actual)
+		}
+	}
+	// f() must not be executed
+	if v, _ := ir.Eval1("n"); v.Int() != 0 {
+		t.Errorf("KindOf executed its argument: n = %v", v)
+	}
+	if typ, err := ir.TypeOfExpr("1.5"); err != nil || typ == nil || typ.Kind() != r.Float64 {
+		t.Errorf(`TypeOfExpr("1.5"): expecting float64, found %v, %v`, typ, err)
+	}
+	for _, src := range []string{"x := 1", "undefinedIdentifier"} {
+		if _, err := ir.KindOf(src); err == nil {
+			t.Errorf("KindOf(%q): expecting error", src)
+		}
+	}
+}
+
+func TestFastRecordReplayRandom(t *testing.T) {
+	const src = `
+	func run() string {
+		a := []int{1, 2, 3, 4, 5}
+		rand.Shuffle(len(a), func(i, j int) { a[i], a[j] = a[j], a[i] })
+		b := make([]byte, 4)
+		crand.Read(b)
+		n, _ := crand.Int(crand.Reader, big.NewInt(1000))
+		return fmt.Sprint(time.Now().UnixNano(), rand.Intn(1000), rand.Float64(), rand.Perm(4), a, b, n)
+	}`
+	newInterp := func() *fast.Interp {
+		ir := fast.New()
+		ir.Eval(`import (crand "crypto/rand"; "fmt"; "math/big"; "math/rand"; "time")`)
+		ir.Eval(src)
+		return ir
+	}
+	var log bytes.Buffer
+	ir := newInterp()
+	rec, err := ir.RecordRandom(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := ir.Eval1("run()")
+	recorded := v.String()
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	ir = newInterp()
+	rec, err = ir.ReplayRandom(bytes.NewReader(log.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := ir.Eval1("run()"); v.String() != recorded {
+		t.Errorf("replay: expecting %q, found %q", recorded, v.String())
+	}
+	if n := rec.Remaining(); n != 0 {
+		t.Errorf("replay: expecting all events to be consumed, %d remaining", n)
+	}
+	// the log is exhausted
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("replay: expecting panic calling rand.Intn after the log is exhausted")
+			}
+		}()
+		ir.Eval(`rand.Intn(10)`)
+	}()
+	rec.Stop()
+	ir.Eval(`rand.Intn(10)`)
+}
+
+func TestFastDevirtualize(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import ("fmt"; "io")
+	type A struct { s string }
+	func (a A) String() string { return "A" + a.s }
+	type B struct{}
+	func (b *B) String() string { return "B" }
+	type W struct { n int }
+	func (w *W) Write(p []byte) (int, error) { w.n += len(p); return len(p), nil }`)
+	for _, test := range []struct {
+		src      string
+		expected interface{}
+	}{
+		{`(func() string { var s fmt.Stringer = A{"x"}; return s.String() })()`, "Ax"},
+		{`(func() string { var s fmt.Stringer = &A{"y"}; return s.String() })()`, "Ay"},
+		{`(func() int { w := &W{}; var out io.Writer = w; out.Write([]byte("abc")); n, _ := out.Write([]byte("de")); return w.n*10 + n })()`, 52},
+		// assigning a different concrete type disables devirtualization
+		{`(func() string { var s fmt.Stringer = A{"x"}; r := s.String(); s = &B{}; return r + s.String() })()`, "AxB"},
+		// calls compiled before the assignment check the concrete type at runtime
+		{`(func() string { var s fmt.Stringer = A{"z"}; r := ""; for i := 0; i < 3; i++ { r += s.String(); s = &B{} }; return r })()`, "AzBB"},
+		{`(func() string { var s fmt.Stringer = A{"c"}; set := func() { s = &B{} }; r := s.String(); set(); return r + s.String() })()`, "AcB"},
+		{`(func() (r bool) { defer func() { r = recover() != nil }(); var s fmt.Stringer = A{}; s = nil; s.String(); return })()`, true},
+	} {
+		if v, _ := ir.Eval1(test.src); !v.IsValid() || v.Interface() != test.expected {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, v)
+		}
+	}
+}
 
-var enable_generics_v2_cti = func() bool {
-	// enable generics v2 CTI before creating test cases
-	etoken.GENERICS = etoken.GENERICS_V2_CTI
-	return true
-}()
+func TestFastValueCache(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`import ("math"; "time")
+	var i, i8, u, big = -5, int8(-128), uint(255), 1000
+	var d = time.Duration(7)
+	var f, negz = 0.0, math.Copysign(0, -1)
+	var b, s = true, ""`)
+	for _, test := range []struct {
+		src      string
+		expected interface{}
+	}{
+		{"i", -5},
+		{"i8", int8(-128)},
+		{"u", uint(255)},
+		{"big", 1000},
+		{"d", time.Duration(7)},
+		{"f", 0.0},
+		{"b", true},
+		{"s", ""},
+	} {
+		fun := ir.Compile(test.src).AsX1()
+		env := ir.PrepareEnv()
+		if v := fun(env); v.Interface() != test.expected {
+			t.Errorf("%s: expecting %v <%T>, found %v <%v>", test.src, test.expected, test.expected, v, v.Type())
+		}
+		if test.src == "big" {
+			continue
+		}
+		if allocs := testing.AllocsPerRun(100, func() { fun(env) }); allocs != 0 {
+			t.Errorf("%s: expecting no allocations, found %v", test.src, allocs)
+		}
+	}
+	// negative zero is not cached
+	if v, _ := ir.Eval1("negz"); !math.Signbit(v.Float()) {
+		t.Errorf("negz: expecting -0, found %v", v)
+	}
+}
 
-type TestFor int
+func TestFastLibrary(t *testing.T) {
+	lib := fast.New().Library()
+	if v, _, err := lib.Eval1("1 + 2"); err != nil || v.Interface() != 3 {
+		t.Errorf("expecting 3, found %v, error %v", v, err)
+	}
+	for _, test := range []struct {
+		src   string
+		phase fast.EventKind
+		line  int
+	}{
+		{"x := (", fast.EventParseError, 1},
+		{"var y int\ny = \"a\"", fast.EventCompileError, 2},
+		{"undefinedFunc()", fast.EventCompileError, 1},
+		{`panic("boom")`, fast.EventRuntimeError, 0},
+		{"var s []int; s[3]", fast.EventRuntimeError, 0},
+	} {
+		_, _, err := lib.Eval(test.src)
+		var e *fast.Error
+		if !errors.As(err, &e) {
+			t.Errorf("%q: expecting *fast.Error, found %v <%T>", test.src, err, err)
+			continue
+		}
+		if e.Phase != test.phase {
+			t.Errorf("%q: expecting phase %v, found %v: %v", test.src, test.phase, e.Phase, err)
+		}
+		if test.line != 0 && e.Pos.Line != test.line {
+			t.Errorf("%q: expecting error at line %d, found %v: %v", test.src, test.line, e.Pos, err)
+		}
+	}
+	var e *fast.Error
+	if _, _, err := lib.Eval(`panic("boom")`); !errors.As(err, &e) || e.Panic != "boom" {
+		t.Errorf("expecting panic value %q, found %v", "boom", err)
+	}
+	var undef *fast.UndefinedIdentifierError
+	if _, err := lib.ValueOf("nosuchvar"); !errors.As(err, &undef) || undef.Name != "nosuchvar" {
+		t.Errorf("expecting UndefinedIdentifierError, found %v", err)
+	}
+	if err := lib.DeclConst("c", nil, []int{}); err == nil {
+		t.Errorf("declaring a non-constant constant: expecting error, found nil")
+	}
+	// the interpreter is still usable
+	if v, _, err := lib.Eval1("y + 1"); err != nil || v.Interface() != 1 {
+		t.Errorf("expecting 1, found %v, error %v", v, err)
+	}
+}
 
-const (
-	S      TestFor = 1 << iota // set option OptDebugSleepOnSwitch
-	C                          // test for classic interpreter
-	F                          // test for fast interpreter
-	G1                         // test requires generics v1 (C++-style)
-	G2                         // test requires generics v2 "contracts are interfaces"
-	U                          // test returns untyped constant (relevant only for fast interpreter)
-	Go1_13                     // test for Go 1.3 number literals: 0b... binary, 0o... octal, 1.2p3 hex floating point, 1_23 underscore digit separator
-	Z                          // temporary override: run only these tests, on fast interpreter only
-	A      = C | F             // test for both interpreters
-	G      = G1 | G2
-)
+type receiverBase struct {
+	Currency string
+}
 
-type TestCase struct {
-	testfor TestFor
-	name    string
-	program string
-	result0 interface{}
-	results []interface{}
+type receiverOrder struct {
+	receiverBase
+	Price    float64
+	Quantity int
+	Limit    float64
+	Total    float64
+	note     string
 }
 
-var canRunGo1_13 = func() bool {
-	for _, tag := range build.Default.ReleaseTags {
-		if tag == "go1.13" {
-			return true
+func (o *receiverOrder) Discount(percent float64) float64 {
+	return o.Price * float64(o.Quantity) * percent / 100
+}
+
+func TestFastEvalWithReceiver(t *testing.T) {
+	ir := fast.New()
+	ir.Eval("var Limit = 1.0; var outside = 7")
+	order := &receiverOrder{receiverBase{"EUR"}, 2.5, 4, 20, 0, "private"}
+	for _, test := range []struct {
+		src      string
+		expected interface{}
+	}{
+		{"Price * float64(Quantity) > Limit", false},
+		{"Price * float64(Quantity) <= Limit", true},
+		{"Discount(10)", 1.0},
+		{"Currency", "EUR"},
+		{"outside + Quantity", 11},
+		{"Limit := 5.0; Limit", 5.0},
+	} {
+		if vs, _ := ir.EvalWithReceiver(test.src, order); len(vs) == 0 || vs[0].Interface() != test.expected {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, vs)
 		}
 	}
-	return false
-}()
-
-func (tc *TestCase) shouldRun(interp TestFor) bool {
-	if tc.testfor&interp == 0 {
-		return false
+	// assignments modify *order
+	ir.EvalWithReceiver("Total = Price * float64(Quantity); Quantity++", order)
+	if order.Total != 10 || order.Quantity != 5 {
+		t.Errorf("expecting Total = 10, Quantity = 5, found %v, %v", order.Total, order.Quantity)
 	}
-	if tc.testfor&Go1_13 != 0 && !canRunGo1_13 {
-		return false
+	// but not a struct passed by value
+	ir.EvalWithReceiver("Quantity = 100", *order)
+	if order.Quantity != 5 {
+		t.Errorf("expecting Quantity = 5, found %v", order.Quantity)
 	}
-	if tc.testfor&G1 != 0 && etoken.GENERICS.V1_CXX() {
-		return true
+	// fields are not in scope after EvalWithReceiver returns
+	if v, _ := ir.Eval1("Limit"); v.Interface() != 1.0 {
+		t.Errorf("expecting Limit = 1, found %v", v)
 	}
-	if tc.testfor&G2 != 0 && etoken.GENERICS.V2_CTI() {
-		return true
+	lib := ir.Library()
+	if _, _, err := lib.EvalWithReceiver("note", order); err == nil {
+		t.Errorf("unexported fields should not be in scope")
+	}
+	if _, _, err := lib.EvalWithReceiver("Price", 42); err == nil {
+		t.Errorf("expecting error for a receiver that is not a struct")
 	}
-	return tc.testfor&(G1|G2) == 0
 }
 
-var foundZ bool
-
-func init() {
-	for i := range testcases {
-		if testcases[i].testfor&Z != 0 {
-			foundZ = true
+func TestFastLazyBuiltins(t *testing.T) {
+	ir := fast.New()
+	// creating an interpreter must not import the metadata of compiled packages: it's slow
+	for path := range ir.Comp.Universe.Packages {
+		if path != "fast" && path != "main" && path != "untyped" {
+			t.Errorf("fast.New() imported the metadata of package %q", path)
 		}
 	}
+	if v, _ := ir.Eval1("Eval(~quote{1 + 2})"); v.Interface() != 3 {
+		t.Errorf("expecting Eval(~quote{1 + 2}) = 3, found %v", v)
+	}
+	lib := ir.Library()
+	if _, _, err := lib.Eval("Evl(1)"); err == nil || !strings.Contains(err.Error(), "did you mean Eval") {
+		t.Errorf("expecting suggestion Eval for undefined identifier Evl, found %v", err)
+	}
+	if _, _, err := lib.Eval("MacroExpand := 1; MacroExpand"); err != nil {
+		t.Errorf("builtins declared on first use should be shadowed by local declarations: %v", err)
+	}
 }
 
-func TestClassic(t *testing.T) {
-	if foundZ {
-		t.Skip("one or more tests marked with 'Z' i.e. run only those and only on fast interpreter")
+func TestFastUntypedFormat(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptKeepUntyped
+	for _, test := range []struct {
+		src      string
+		format   untyped.Format
+		expected string
+	}{
+		{"1/3.0", untyped.Format{}, "{float64 1/3}"},
+		{"1/3.0", untyped.Format{Mode: untyped.FormatDecimal}, "{float64 0.33333333333333333333}"},
+		{"1/3.0", untyped.Format{Mode: untyped.FormatDecimal, Digits: 5}, "{float64 0.33333}"},
+		{"1/3.0", untyped.Format{Mode: untyped.FormatLiteral}, "{float64 1.0/3}"},
+		{"-5/4.0", untyped.Format{Mode: untyped.FormatLiteral}, "{float64 -1.25}"},
+		{"2.0", untyped.Format{Mode: untyped.FormatLiteral}, "{float64 2.0}"},
+		{"1e400/3", untyped.Format{Mode: untyped.FormatLiteral}, "{float64 1e+400/3}"},
+		{"1e400/3", untyped.Format{Mode: untyped.FormatDecimal, Digits: 3}, "{float64 3.33e+399}"},
+		{"(1+2i)/4", untyped.Format{Mode: untyped.FormatLiteral}, "{complex128 (0.25 + 0.5i)}"},
+		{"1<<70", untyped.Format{Mode: untyped.FormatDecimal}, "{int 1180591620717411303424}"},
+	} {
+		v, _ := ir.Eval1(test.src)
+		lit, ok := v.Interface().(untyped.Lit)
+		if !ok {
+			t.Errorf("%s: expecting untyped constant, found %v <%T>", test.src, v, v.Interface())
+		} else if actual := lit.StringWith(test.format); actual != test.expected {
+			t.Errorf("%s: expecting %s formatted as %v, found %s", test.src, test.expected, test.format, actual)
+		}
 	}
-	ir := classic.New()
-	// ir.Options |= OptDebugCallStack | OptDebugPanicRecover
-	for i := range testcases {
-		test := &testcases[i]
-		if test.shouldRun(C) {
-			t.Run(test.name, func(t *testing.T) { test.classic(t, ir) })
+	for _, s := range []string{"decimal 0", "decimal x", "go", "exact 3"} {
+		if _, err := untyped.ParseFormat(s); err == nil {
+			t.Errorf("expecting error parsing untyped format %q", s)
 		}
 	}
 }
 
-func TestFast(t *testing.T) {
+func TestFastEvalReader(t *testing.T) {
 	ir := fast.New()
-	for i := range testcases {
-		test := &testcases[i]
-		if (!foundZ || test.testfor&Z != 0) && test.shouldRun(F) {
-			t.Run(test.name, func(t *testing.T) { test.fast(t, ir) })
+	ch := make(chan int)
+	ir.DeclVar("ch", nil, ch)
+	pr, pw := io.Pipe()
+	first := make(chan struct{})
+	go func() {
+		pw.Write([]byte("ch <- 1\n"))
+		// the first statement must be executed before the stream continues
+		<-first
+		pw.Write([]byte("// comment\nch <- 2\nfunc f() {\n"))
+		pw.Close()
+	}()
+	done := make(chan error)
+	go func() {
+		_, err := ir.EvalReader(pr)
+		done <- err
+	}()
+	for i := 1; i <= 2; i++ {
+		if n := <-ch; n != i {
+			t.Errorf("expecting %d from statement %d, found %d", i, i, n)
+		}
+		if i == 1 {
+			close(first)
 		}
 	}
+	err := <-done
+	if err == nil || !strings.Contains(err.Error(), ":4: unexpected EOF, incomplete statement: func f() {") {
+		t.Errorf("expecting incomplete statement at line 4, found error %v", err)
+	}
+}
+
+func TestFastSpeculate(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`sx := 1`)
+	errFail := errors.New("fail")
+	err := ir.Speculate(func(ir *fast.Interp) error {
+		ir.Eval(`sx = 2; sy := "y"`)
+		return errFail
+	})
+	if err != errFail {
+		t.Errorf("expecting error %v, found %v", errFail, err)
+	}
+	if v, _ := ir.Eval1(`sx`); v.Interface() != 1 {
+		t.Errorf("expecting sx == 1 after failed Speculate, found %v", v)
+	}
+	if ir.Comp.TryResolve("sy") != nil {
+		t.Errorf("expecting sy to be undeclared after failed Speculate")
+	}
+	err = ir.Speculate(func(ir *fast.Interp) error {
+		ir.Eval(`sx = 3; sy := "y"`)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("expecting nil error, found %v", err)
+	}
+	if v, _ := ir.Eval1(`sx`); v.Interface() != 3 {
+		t.Errorf("expecting sx == 3 after successful Speculate, found %v", v)
+	}
+	if v, _ := ir.Eval1(`sy`); v.Interface() != "y" {
+		t.Errorf("expecting sy == \"y\" after successful Speculate, found %v", v)
+	}
 }
 
 type shouldpanic struct{}
@@ -164,6 +2501,11 @@ func (test *TestCase) fast(t *testing.T, ir *fast.Interp) {
 	} else {
 		ir.Comp.Options &^= OptKeepUntyped
 	}
+	if test.testfor&I != 0 {
+		ir.Comp.Options |= OptAutoImport
+	} else {
+		ir.Comp.Options &^= OptAutoImport
+	}
 
 	panicking := true
 	if test.result0 == panics {
@@ -460,7 +2802,9 @@ var testcases = []TestCase{
 	TestCase{A, "1+1", "1+1", 1 + 1, nil},
 	TestCase{A, "1+'A'", "1+'A'", 'B', nil}, // rune i.e. int32 should win over untyped constant (or int)
 	TestCase{A, "int8+1", "int8(1)+1", int8(1) + 1, nil},
-	TestCase{A, "int8_overflow", "int8(64)+64", int8(-128), nil},
+	TestCase{C, "int8_overflow", "int8(64)+64", int8(-128), nil},
+	TestCase{F, "int8_overflow", "var i8 int8 = 64; i8+64", int8(-128), nil},
+	TestCase{F, "int8_overflow_const", "int8(64)+64", panics, nil},
 	TestCase{A, "string", "\"foobar\"", "foobar", nil},
 	TestCase{A, "expr_and", "3 & 6", 3 & 6, nil},
 	TestCase{A, "expr_or", "7 | 8", 7 | 8, nil},
@@ -560,6 +2904,56 @@ var testcases = []TestCase{
 	TestCase{A, "var_signed_shift_7", "v0 >>= int(1); v0", int(11) >> 1, nil},
 	TestCase{A, "var_signed_shift_8", "v0 <<= int(1); v0", int(11) >> 1 << 1, nil},
 	TestCase{A, "var_shift_overflow", "v3 << 13", uint16(32768), nil},
+	TestCase{F, "var_shift_float_count", "v3 << 1.0", uint16(12) << 1, nil},
+	TestCase{F, "var_shift_float_count_invalid", "v3 << 1.5", panics, nil},
+	TestCase{F, "const_shift_typed_count", "const c7 int8 = 7; 1 << c7", 1 << 7, nil},
+	TestCase{F, "const_shift_overflow_1", "uint8(1) << 8", panics, nil},
+	TestCase{F, "const_shift_overflow_2", "uint64(1) << 64", panics, nil},
+	// adapted from the examples in https://golang.org/ref/spec#Operators
+	TestCase{F, "shift_spec_1", "var ss uint = 33; var si = 1<<ss; si", 1 << 33, nil},
+	TestCase{F, "shift_spec_2", "var sj int32 = 1<<ss; sj", int32(0), nil},
+	TestCase{F, "shift_spec_3", "var sk = uint64(1<<ss); sk", uint64(1 << 33), nil},
+	TestCase{F, "shift_spec_4", "var sm int = 1.0<<ss; sm", 1 << 33, nil},
+	TestCase{F, "shift_spec_5", "var sn = 1.0<<ss == sj; sn", true, nil},
+	TestCase{F, "shift_spec_6", "var so = 1<<ss == 2<<ss; so", false, nil},
+	TestCase{F, "shift_spec_7", "var sp = 1<<ss == 1<<33; sp", true, nil},
+	TestCase{F, "shift_spec_8", "var su = 1.0<<ss", panics, nil},
+	TestCase{F, "shift_spec_9", "var su1 = 1.0<<ss != 0", panics, nil},
+	TestCase{F, "shift_spec_10", "var su2 = 1<<ss != 1.0", panics, nil},
+	TestCase{F, "shift_spec_11", "var sv1 float32 = 1<<ss", panics, nil},
+	TestCase{F, "shift_spec_12", "var sw int64 = 1.0<<33; sw", int64(1 << 33), nil},
+	TestCase{F, "shift_spec_13", "ss = 4; var sa [1024]byte; sa[5.0<<ss] = 7; sa[80]", byte(7), nil},
+	TestCase{F, "shift_spec_14", "var sb = make([]byte, 1.0<<ss); len(sb)", 16, nil},
+	TestCase{F, "shift_spec_15", "var sr = 'a'<<ss; sr", int32('a') << 4, nil},
+	TestCase{F, "shift_spec_16", "sj = 2; sj + 1<<ss", int32(18), nil},
+	TestCase{F, "shift_negative_count_1", "1 << -1", panics, nil},
+	TestCase{F, "shift_negative_count_2", "sj << -1", panics, nil},
+	TestCase{F, "shift_negative_count_3", "const c9 int = -1; sj >> c9", panics, nil},
+	TestCase{F, "shift_negative_count_4", "sj <<= -1", panics, nil},
+	TestCase{F, "shift_negative_count_5", "var sneg = -1; sj << sneg", panics, nil},
+	TestCase{F, "shift_huge_count_1", "1 << 2000", panics, nil},
+	TestCase{F, "shift_huge_count_2", "int8(1) << 2000", panics, nil},
+	TestCase{F, "shift_huge_count_3", "sj << (1<<70)", panics, nil},
+	TestCase{F, "shift_huge_count_4", "var shuge uint = 100; sj << shuge", int32(0), nil},
+	TestCase{F, "shift_huge_count_5", "sj = -3; sj >> shuge", int32(-1), nil},
+	TestCase{F, "shift_untyped_float_1", "1e3 << 2", 4000, nil},
+	TestCase{F, "shift_untyped_float_2", "1.5 << 2", panics, nil},
+	TestCase{F, "shift_place_1", "var sx = []int8{1, 2}; sx[0] <<= ss; sx[0]", int8(16), nil},
+	TestCase{F, "shift_place_2", "sx[1] >>= int64(1); sx[1]", int8(1), nil},
+	TestCase{F, "shift_place_3", "sx[1] <<= -1", panics, nil},
+	TestCase{F, "const_mul_overflow", "const c8 int8 = 100; c8 * 2", panics, nil},
+	TestCase{F, "const_sub_overflow", "uint(0) - 1", panics, nil},
+	TestCase{F, "const_quo_overflow", "int8(-128) / int8(-1)", panics, nil},
+	TestCase{F, "const_quo_zero", "5 / 0", panics, nil},
+	TestCase{F, "const_rem_zero", "int16(5) % 0", panics, nil},
+	TestCase{F, "const_neg_overflow_1", "-int8(-128)", panics, nil},
+	TestCase{F, "const_neg_overflow_2", "-uint(1)", panics, nil},
+	TestCase{F, "const_conv_overflow_1", "const c16 int16 = 300; int8(c16)", panics, nil},
+	TestCase{F, "const_conv_overflow_2", "float32(1e39)", panics, nil},
+	TestCase{F, "const_conv_overflow_3", "float64(1e309)", panics, nil},
+	TestCase{F, "const_conv_overflow_4", "float32(float64(1e300))", panics, nil},
+	TestCase{F, "const_mul_overflow_float", "float32(1e38) * 10", panics, nil},
+	TestCase{F, "const_conv_bigint_float", "float64(1 << 100)", float64(1 << 100), nil},
 	// test division by constant power-of-two
 	TestCase{C, "var_div_1", "v3 = 11; v3 / 2", uint64(11) / 2, nil}, // classic interpreter is not type-accurate here
 	TestCase{C, "var_div_2", "v3 = 63; v3 / 8", uint64(63) / 8, nil},
@@ -579,6 +2973,27 @@ var testcases = []TestCase{
 	TestCase{A, "var_div_12", "v0 =-63; v0 /+8", -63 / +8, nil},
 	TestCase{A, "var_div_13", "v0 =-63; v0 /-8", -63 / -8, nil},
 
+	// test division by constant non-power-of-two
+	TestCase{A, "var_div_14", "v0 =-100; v0 /+7", -100 / +7, nil},
+	TestCase{A, "var_div_15", "v0 =-100; v0 /-7", -100 / -7, nil},
+	TestCase{F, "var_div_16", "v3 = 65535; v3 / 10", uint16(65535) / 10, nil},
+	TestCase{F, "var_div_max", "var vmax uint64 = 5; vmax / 18446744073709551615", uint64(0), nil},
+	TestCase{F, "var_div_check", `func quoCheck() int {
+		bad := 0
+		var d7, dm9 int32 = 7, -9
+		var u7 uint64 = 1000000007
+		for i := int32(-70000); i <= 70000; i += 13 {
+			if i/7 != i/d7 || i%7 != i%d7 || i/-9 != i/dm9 || i%-9 != i%dm9 {
+				bad++
+			}
+			if u := uint64(i) * 0x9E3779B97F4A7C15; u/1000000007 != u/u7 || u%1000000007 != u%u7 {
+				bad++
+			}
+		}
+		return bad
+	}
+	quoCheck()`, 0, nil},
+
 	// test remainder by constant power-of-two
 	TestCase{C, "var_rem_1", "v3 = 17; v3 % 4", uint64(17) % 4, nil}, // classic interpreter is not type-accurate here
 	TestCase{C, "var_rem_2", "v3 = 61; v3 % 8", uint64(61) % 8, nil},
@@ -591,6 +3006,8 @@ var testcases = []TestCase{
 	TestCase{A, "var_rem_6", "v0 =+61; v0 %-8", +61 % -8, nil},
 	TestCase{A, "var_rem_7", "v0 =-61; v0 %+8", -61 % +8, nil},
 	TestCase{A, "var_rem_8", "v0 =-61; v0 %-8", -61 % -8, nil},
+	TestCase{A, "var_rem_9", "v0 =-100; v0 %+7", -100 % +7, nil},
+	TestCase{A, "var_rem_10", "v0 =+100; v0 %-7", +100 % -7, nil},
 
 	TestCase{A, "eql_nil_1", "err == nil", true, nil},
 	TestCase{A, "eql_nil_2", "vp == nil", true, nil},
@@ -711,6 +3128,11 @@ var testcases = []TestCase{
 
 	TestCase{A, "if_1", "v2 = 1; if v2 < 1 { v2 = v2-1 } else { v2 = v2+1 }; v2", uint8(2), nil},
 	TestCase{A, "if_2", "if v2 < 5 { v2 = v2+2 } else { v2 = v2-2 }; v2", uint8(4), nil},
+	TestCase{A, "if_const_false", "const ifDebug = false; v2 = 7; if ifDebug { v2 = 8 } else { v2++ }; v2", uint8(8), nil},
+	TestCase{F, "if_const_dead_code", "if ifDebug && v2 > 0 { v2 = undefinedIfDeadCode() }; v2", panics, nil},
+	TestCase{F, "if_const_dead_else", "if !ifDebug { v2++ } else { v2 = undefinedElseDeadCode() }; v2", panics, nil},
+	TestCase{F, "for_const_dead_code", "for false { v2 = undefinedForDeadCode() }; v2", panics, nil},
+	TestCase{A, "if_const_dead_code_ok", "if ifDebug && v2 > 0 { v2 = 9 }; for false { v2 = 10 }; v2", uint8(8), nil},
 	TestCase{A, "for_1", "var i, j, k int; for i=1; i<=2; i=i+1 { if i<2 {j=i} else {k=i} }; i", 3, nil},
 	TestCase{A, "for_2", "j", 1, nil},
 	TestCase{A, "for_3", "k", 2, nil},
@@ -738,6 +3160,13 @@ var testcases = []TestCase{
 		('x' + 'y' + 'z') * 2, nil},
 	TestCase{A, "for_range_slice", `v0 = 0; for _, s := range [ ]string{"a", "bc"} { v0 += len(s); continue }; v0`, 3, nil},
 	TestCase{A, "for_range_string", `vrune = 0; for i, r := range "abc\u00ff" { vrune += r << (uint8(i)*8); continue }; vrune`, for_range_string("abc\u00ff"), nil},
+	TestCase{F, "for_range_int_1", `v0 = 0; for i := range 10 { v0 += i }; v0`, 45, nil},
+	TestCase{F, "for_range_int_2", `v0 = 0; for range 5 { v0++ }; v0`, 5, nil},
+	TestCase{F, "for_range_int_3", `v0 = 0; for i := range 3 { i += 10; v0 += i }; v0`, 33, nil},
+	TestCase{F, "for_range_int_4", `var vu8 uint8; for i := range uint8(4) { vu8 += i }; vu8`, uint8(6), nil},
+	TestCase{F, "for_range_int_5", `v0 = 0; var vri int; for vri = range 4 { v0 += vri; continue }; v0 + vri*100`, 306, nil},
+	TestCase{F, "for_range_int_6", `v0 = 0; for i := range -3 { v0 += i }; v0`, 0, nil},
+	TestCase{F, "for_range_int_7", `for i, j := range 3 { }`, panics, nil},
 
 	TestCase{A, "function_0", "func nop() { }; nop()", nil, none},
 	TestCase{A, "function_1", "func seven() int { return 7 }; seven()", 7, nil},
@@ -755,6 +3184,21 @@ var testcases = []TestCase{
 	TestCase{A, "function_variadic_2", "si := make([]interface{}, 4); si[1]=1; si[2]=2; si[3]=3; list_args(si...)", []interface{}{nil, 1, 2, 3}, nil},
 	TestCase{A, "fibonacci", fibonacci_source_string + "; fibonacci(13)", 233, nil},
 	TestCase{A, "function_literal", "adder := func(a,b int) int { return a+b }; adder(-7,-9)", -16, nil},
+	TestCase{F, "function_hotswap_1", "func hot() int { return 1 }; func usehot() int { return hot() }; hotv := hot; hots := []func() int{hot}", nil, none},
+	TestCase{F, "function_hotswap_2", "func hot() int { return 2 }; []int{hot(), usehot(), hotv(), hots[0]()}", []int{2, 2, 2, 2}, nil},
+	TestCase{F, "function_hotswap_3", "func hot(x int) int { return x }; []int{hot(3), usehot(), hotv()}", []int{3, 2, 2}, nil},
+
+	TestCase{F, "init_order_1", "var io_order []string; func io_trace(s string, v int) int { io_order = append(io_order, s); return v }; " +
+		"type IoT struct{}; func (IoT) M() int { return io_trace(`M`, io_y) }; var io_x = IoT.M; var io_y = io_trace(`y`, 7); " +
+		"var io_t IoT; var io_z = io_t.M(); var _ = io_trace(`blank1`, 1); var io_w = io_trace(`w`, 2); var _ = io_trace(`blank2`, 3); " +
+		"func init() { io_order = append(io_order, `init1`) }; func init() { io_order = append(io_order, `init2`) }; io_order",
+		[]string{"y", "M", "blank1", "w", "blank2", "init1", "init2"}, nil},
+	TestCase{F, "init_order_2", "var (io_a = io_c + io_b; io_b = io_f(); io_c = io_f(); io_d = 3); func io_f() int { io_d++; return io_d }; []int{io_a, io_b, io_c, io_d}",
+		[]int{9, 4, 5, 5}, nil},
+	TestCase{F, "init_order_3", "var io_e = io_even(10); func io_even(n int) bool { if n == 0 { return true }; return io_odd(n-1) }; " +
+		"func io_odd(n int) bool { if n == 0 { return false }; return io_even(n-1) }; io_e", true, nil},
+	TestCase{F, "init_order_4", "func io_g() int { return io_v }; var io_v = io_g()", panics, nil},
+	TestCase{F, "init_order_5", "func init(x int) { }", panics, nil},
 
 	TestCase{F, "y_combinator_1", "type F func(F); var f F; &f", make_y_combinator_1(), nil},
 	TestCase{F, "y_combinator_2", "func Y(f F) { }; Y", func(xr.Forward) {}, nil}, // avoid the infinite recursion, only check the types
@@ -780,6 +3224,45 @@ var testcases = []TestCase{
 			}()
 		}
 		test_closure_2()`, 2, nil},
+	// closures capture by value the variables never reassigned: check the semantics are unchanged
+	TestCase{F, "closure_capture_1", `
+		func test_closure_capture_1(s string) []func() string {
+			k := "-"
+			var fs []func() string
+			for i := 0; i < 3; i++ {
+				j := i * 10
+				if j >= 0 {
+					fs = append(fs, func() string { return s + k + string(rune('0' + j/10)) })
+				}
+			}
+			return fs
+		}
+		ccfs := test_closure_capture_1("x")
+		ccfs[0]() + ccfs[2]()`, "x-0x-2", nil},
+	TestCase{F, "closure_capture_2", `
+		func test_closure_capture_2() (int, int, int) {
+			a, b, c := 1, 2, 3
+			pc := &c
+			var fa, fb, fc func() int
+			if x := 0; x == 0 {
+				fa = func() int { return a + x }
+				fb = func() int { return b + x }
+				fc = func() int { return c + x }
+			}
+			a = 4
+			b, d := 5, 6
+			*pc = d
+			return fa(), fb(), fc()
+		}
+		test_closure_capture_2()`, nil, []interface{}{4, 5, 6}},
+	TestCase{F, "closure_capture_3", `
+		func test_closure_capture_3(n int) func() func() int {
+			{
+				m := n * 2
+				return func() func() int { return func() int { return n + m } }
+			}
+		}
+		test_closure_capture_3(3)()()`, 9, nil},
 
 	TestCase{A, "setvar_deref_1", `vstr := "foo"; pvstr := &vstr; *pvstr = "bar"; vstr`, "bar", nil},
 	TestCase{A, "setvar_deref_2", `vint := 5; pvint := &vint; *pvint = 6; vint`, 6, nil},
@@ -822,6 +3305,14 @@ var testcases = []TestCase{
 	TestCase{F, "field_set_embedded_1", `triple.A, triple.B = 'b', "xy"; triple.Pair`, Pair{'b', "xy"}, nil},
 	TestCase{F, "field_addr_1", "ppair := &triple.Pair; ppair.A", 'b', nil},
 	TestCase{F, "field_addr_2", "ppair.A++; triple.Pair.A", 'c', nil},
+	TestCase{F, "field_shim_1", `type Shim struct { X uint8; Pair; P *Pair; F float32; S string }; var shim Shim
+		shim.X = 200; shim.A = 'q'; shim.F = 1.5; shim.S = "s"; []interface{}{shim.X, shim.A, shim.F, shim.S}`,
+		[]interface{}{uint8(200), 'q', float32(1.5), "s"}, nil},
+	TestCase{F, "field_shim_2", "pshim := &shim; pshim.P = &Pair{}; pshim.P.A = 'z'; pshim.X++; []interface{}{shim.P.A, pshim.X}",
+		[]interface{}{'z', uint8(201)}, nil},
+	TestCase{F, "field_shim_3", "func mkshim() Shim { return Shim{X: 7} }; mshim := map[int]Shim{1: {X: 9}}; []uint8{mkshim().X, mshim[1].X}",
+		[]uint8{7, 9}, nil},
+	TestCase{F, "field_shim_4", "var nilshim *Shim; nilshim.X = 1", panics, nil},
 
 	TestCase{F, "infer_type_compositelit_1", `[]Pair{{'a', "b"}, {'c', "d"}}`, []Pair{{'a', "b"}, {'c', "d"}}, nil},
 	TestCase{F, "infer_type_compositelit_2", `[]*Pair{{'a', "b"}, {'c', "d"}}`, []*Pair{{'a', "b"}, {'c', "d"}}, nil},
@@ -832,7 +3323,16 @@ var testcases = []TestCase{
 
 	TestCase{A, "import", `import ( "errors"; "fmt"; "io"; "math/big"; "math/rand"; "net/http"; "reflect"; "time" )`, nil, none},
 	TestCase{A, "import_name", `import _big "math/big"; _big.MaxBase`, big.MaxBase, nil},
+	TestCase{F, "import_group", `import ( sfmt "fmt"; "unicode/utf8" ); sfmt.Sprint(utf8.RuneLen('x'))`, "1", nil},
 	TestCase{A, "import_constant", `const micro = time.Microsecond; micro`, time.Microsecond, nil},
+	TestCase{F, "import_scoped_1", `func fimport1() string { import su "strings"; return su.ToUpper("a") }; fimport1()`, "A", nil},
+	TestCase{F, "import_scoped_2", `su.ToUpper("a")`, panics, nil},
+	TestCase{F, "import_scoped_3", `func fimport3() string { { import su "strings"; _ = su.ToUpper }; return su.ToUpper("b") }`, panics, nil},
+	TestCase{F | I, "autoimport_func", `unicode.IsUpper('X')`, true, nil},
+	TestCase{F | I, "autoimport_type", `var aib bufio.Reader; aib.Buffered()`, 0, nil},
+	TestCase{F | I, "autoimport_ambiguous", `template.HTMLEscapeString`, panics, nil},
+	TestCase{F | I, "autoimport_exported", `rand.Intn(1)`, 0, nil},
+	TestCase{F, "autoimport_disabled", `utf16.IsSurrogate(0)`, panics, nil},
 	TestCase{A, "dot_import_1", `import . "errors"`, nil, none},
 	TestCase{A, "dot_import_2", `reflect.ValueOf(New) == reflect.ValueOf(errors.New)`, true, nil}, // a small but very strict check... good
 
@@ -844,6 +3344,11 @@ var testcases = []TestCase{
 
 	TestCase{A, "builtin_append_1", "append(vbs,0,1,2)", []byte{0, 1, 2}, nil},
 	TestCase{A, "builtin_append_2", "append(vns,3,4)", []byte{3, 4}, nil},
+	TestCase{F, "builtin_append_3", `append([]string{"a"}, "b", "c")`, []string{"a", "b", "c"}, nil},
+	TestCase{F, "builtin_append_4", "append([]float64{1}, []float64{2, 3}...)", []float64{1, 2, 3}, nil},
+	TestCase{F, "builtin_append_5", `append([]byte("ab"), "cd"...)`, []byte("abcd"), nil},
+	TestCase{F, "builtin_append_6", "append(vns, vns...)", ([]byte)(nil), nil},
+	TestCase{F, "builtin_append_7", "type pt struct { x []int }; var vpt pt; vpt.x = append(vpt.x, 1, 2); vpt.x", []int{1, 2}, nil},
 	TestCase{A, "builtin_cap", "cap(va)", 2, nil},
 	TestCase{A, "builtin_len_1", "len(vs)", len("8y57riuh@#$"), nil},
 	TestCase{A, "builtin_len_2", "{ a := [...]int{1,2,3}; len(a) }", nil, none},
@@ -858,6 +3363,7 @@ var testcases = []TestCase{
 	TestCase{A, "builtin_copy_1", "copy(vbs, vs)", 5, nil},
 	TestCase{A, "builtin_copy_2", "vbs", []byte("8y57r"), nil},
 	TestCase{A, "builtin_copy_3", "ints1 := []int{1,2,3}; ints2 := []int{0,0,0}; copy(ints2,ints1); ints2", []int{1, 2, 3}, nil},
+	TestCase{F, "builtin_copy_4", "ncopy := copy(ints2, []int{7}); ncopy", 1, nil},
 	TestCase{A, "builtin_delete_1", "delete(mi,64); mi", map[rune]byte{'a': 7}, nil},
 	TestCase{A, "builtin_real_1", "real(0.5+1.75i)", real(0.5 + 1.75i), nil},
 	TestCase{A, "builtin_real_2", "const cplx complex64 = 1.5+0.25i; real(cplx)", real(complex64(1.5 + 0.25i)), nil},
@@ -865,6 +3371,19 @@ var testcases = []TestCase{
 	TestCase{A, "builtin_imag_2", "imag(cplx)", imag(complex64(1.5 + 0.25i)), nil},
 	TestCase{A, "builtin_complex_1", "complex(0,1)", complex(0, 1), nil},
 	TestCase{A, "builtin_complex_2", "v6 = 0.1; complex(v6,-v6)", complex(float32(0.1), -float32(0.1)), nil},
+	TestCase{F, "builtin_clear_1", "mclear := map[int]int{1: 2, 3: 4}; clear(mclear); len(mclear)", 0, nil},
+	TestCase{F, "builtin_clear_2", "sclear := []string{\"a\", \"b\"}; clear(sclear); sclear", []string{"", ""}, nil},
+	TestCase{F, "builtin_min_1", "min(3, 1, 2)", 1, nil},
+	TestCase{F, "builtin_min_2", "min(3, 1.5, 2)", 1.5, nil},
+	TestCase{F, "builtin_min_3", "var vmin uint8 = 200; min(vmin, 7)", uint8(7), nil},
+	TestCase{F, "builtin_min_4", "import \"math\"; math.Signbit(min(0.0, math.Copysign(0, -1)))", true, nil},
+	TestCase{F, "builtin_min_5", "math.IsNaN(min(1.0, math.NaN()))", true, nil},
+	TestCase{F, "builtin_min_6", "min(1, int64(2))", int64(1), nil},
+	TestCase{F, "builtin_min_7", "min(1, \"a\")", panics, nil},
+	TestCase{F, "builtin_max_1", "max(\"ab\", \"c\", \"b\")", "c", nil},
+	TestCase{F, "builtin_max_2", "var vmax float32 = 2.5; max(vmax, 1, -3)", float32(2.5), nil},
+	TestCase{F, "builtin_max_3", "const kmax = max(int16(3), 4); kmax", int16(4), nil},
+	TestCase{F, "builtin_max_4", "var vmax2 int; max(vmax2, int32(1))", panics, nil},
 
 	TestCase{F | U, "untyped_builtin_real_1", "real(0.5+1.75i)",
 		untyped.MakeLit(untyped.Float, constant.MakeFloat64(0.5), nil), // 0.5 is exactly representable by float64
@@ -910,6 +3429,31 @@ var testcases = []TestCase{
 	TestCase{A, "literal_slice_address", "&[]rune{'x','y'}", &[]rune{'x', 'y'}, nil},
 	TestCase{A, "literal_struct", `Pair{A: 0x73, B: "\x94"}`, Pair{A: 0x73, B: "\x94"}, nil},
 	TestCase{A, "literal_struct_address", `&Pair{1,"2"}`, &Pair{A: 1, B: "2"}, nil},
+	TestCase{F, "literal_const_array_fresh", `lca := func() [2]int { return [2]int{1, 2} }; lca1 := lca(); lca1[0] = 9; lca()`, [2]int{1, 2}, nil},
+	TestCase{F, "literal_const_slice_fresh", `lcs := func() []int { return []int{1, 2} }; lcs()[0] = 9; lcs()`, []int{1, 2}, nil},
+	TestCase{F, "literal_const_map_fresh", `lcm := func() map[int]string { return map[int]string{1: "x"} }; lcm()[1] = "y"; lcm()`, map[int]string{1: "x"}, nil},
+	TestCase{F, "literal_const_struct_fresh", `lcp := func() *Pair { return &Pair{1, "2"} }; lcp().A = 9; lcp()`, &Pair{A: 1, B: "2"}, nil},
+
+	// arrays have value semantics: copied on assignment, passing and binding, compared element-wise
+	TestCase{A, "array_copy_assign", `avs := [3]int{1, 2, 3}; avt := avs; avt[0] = 9; avs`, [3]int{1, 2, 3}, nil},
+	TestCase{A, "array_copy_arg", `func avf(x [3]int) int { x[1] = 7; return x[1] }; avf(avs); avs`, [3]int{1, 2, 3}, nil},
+	TestCase{A, "array_copy_return", `avg := func() [3]int { return avs }; avr := avg(); avs[2] = 0; avr`, [3]int{1, 2, 3}, nil},
+	TestCase{A, "array_copy_field", `type AvS struct { A [2]int }; avx := AvS{}; avy := avx; avy.A[0] = 1; avx.A`, [2]int{}, nil},
+	TestCase{F, "array_copy_nested", `avn := [2][2]int{{1, 2}, {3, 4}}; avm := avn; avm[1][1] = 0; avn`, [2][2]int{{1, 2}, {3, 4}}, nil},
+	TestCase{F, "array_copy_slice_elem", `avl := [][2]int{{1, 2}}; ave := avl[0]; ave[0] = 5; avl[0]`, [2]int{1, 2}, nil},
+	TestCase{F, "array_copy_map_elem", `avk := map[int][2]int{1: {3, 4}}; avv := avk[1]; avv[0] = 0; avv = avk[1]; avv`, [2]int{3, 4}, nil},
+	TestCase{A, "array_copy_interface", `var avi interface{} = avs; avs[0] = 42; avi`, [3]int{1, 2, 0}, nil},
+	TestCase{A, "array_copy_deref", `avp := &avs; avq := *avp; avq[0] = 11; avs`, [3]int{42, 2, 0}, nil},
+	TestCase{A, "array_copy_range", `v0 = 0; ava := [3]int{1, 2, 3}; for i, e := range ava { if i == 0 { ava[1] = 100 }; v0 += e }; v0`, 6, nil},
+	TestCase{F, "array_copy_method_value", `type AvA [2]int; func (a AvA) First() int { return a[0] }; avb := AvA{1, 2}; avfn := avb.First; avb[0] = 7; avfn()`, 1, nil},
+	TestCase{F, "array_copy_method_value_struct", `func (a AvS) First() int { return a.A[0] }; avw := AvS{}; avwf := avw.First; avw.A[0] = 3; avwf()`, 0, nil},
+	TestCase{F, "array_copy_method_value_deref", `avb = AvA{1, 2}; avpb := &avb; avpf := avpb.First; avb[0] = 7; avpf()`, 1, nil},
+	TestCase{A, "array_equal", `[3]int{1, 2, 3} == ava`, false, nil},
+	TestCase{A, "array_not_equal", `avs != [3]int{42, 2, 0}`, false, nil},
+	TestCase{F, "array_equal_struct", `[2]Pair{{1, "a"}} == [2]Pair{{1, "a"}}`, true, nil},
+	TestCase{A, "array_equal_interface_panic", `[1]interface{}{[]int{}} == [1]interface{}{[]int{}}`, panics, nil},
+	TestCase{A, "array_map_key", `avkm := map[[2]string]int{}; avkk := [2]string{"a", "b"}; avkm[avkk] = 5; avkk[0] = "z"; v0 = avkm[[2]string{"a", "b"}]; v0`, 5, nil},
+	TestCase{A, "array_uncomparable", `[1][]int{} == [1][]int{}`, panics, nil},
 
 	// issue #103
 	TestCase{A, "named_const_type_1", `type Int int
@@ -918,6 +3462,19 @@ var testcases = []TestCase{
 	TestCase{A, "named_func_type_1", `import "context"
 				 _, cancel := context.WithCancel(context.Background())
 				 cancel()`, nil, none},
+	TestCase{F, "named_func_type_2", `type FuncA func(int) int; type FuncB func(int) int
+				 var fna FuncA = func(a int) int { return a * 3 }
+				 FuncB(fna)(4) + (func(int) int)(fna)(5)`, 27, nil},
+	TestCase{F, "named_func_type_3", `type IntA int; type IntB int; type FuncIA func(IntA); type FuncIB func(IntB)
+				 var fnia FuncIA; FuncIB(fnia)`, panics, nil},
+	TestCase{F, "named_func_type_4", `type PtrInt *int; type FuncPtr func(PtrInt); var fnp FuncPtr; (func(*int))(fnp)`, panics, nil},
+	TestCase{F, "named_func_type_5", `import ("os"; "path/filepath")
+				 type MyWalkFunc func(string, os.FileInfo, error) error
+				 var mwf MyWalkFunc = func(path string, info os.FileInfo, err error) error { return err }
+				 filepath.Walk("/nonexistent/gomacro", filepath.WalkFunc(mwf)) != nil`, true, nil},
+	TestCase{F, "named_func_type_6", `var wf filepath.WalkFunc = func(path string, info os.FileInfo, err error) error { return nil }
+				 MyWalkFunc(wf)("", nil, nil) == nil`, true, nil},
+	TestCase{F, "named_func_type_7", `filepath.Walk("/nonexistent/gomacro", mwf)`, panics, nil},
 
 	TestCase{A, "method_decl_1", `func (p *Pair) SetA(a rune) { p.A = a }; nil`, nil, nil},
 	TestCase{A, "method_decl_2", `func (p Pair) SetAV(a rune) { p.A = a }; nil`, nil, nil},
@@ -957,6 +3514,19 @@ var testcases = []TestCase{
 		var ia IncAdd
 		var ii Int = 7`, nil, none},
 	TestCase{F, "interface_5", `ia = &ii`, nil, none},
+	// method sets: methods with pointer receiver belong to *T but not to T
+	TestCase{F, "interface_method_set_1", `
+		type msP struct { }
+		func (p *msP) String() string { return "msP" }
+		type msV struct { n int }
+		func (v msV) String() string { return fmt.Sprint("msV", v.n) }
+		type msEP struct { *msP }`, nil, none},
+	TestCase{F, "interface_method_set_2", `var msp fmt.Stringer = msP{}`, panics, nil},
+	TestCase{F, "interface_method_set_3", `var msp fmt.Stringer = &msP{}; msp.String()`, "msP", nil},
+	TestCase{F, "interface_method_set_4", `var msv fmt.Stringer = &msV{3}; msv.String()`, "msV3", nil},
+	TestCase{F, "interface_method_set_5", `var msep fmt.Stringer = msEP{&msP{}}; msep.String()`, "msP", nil},
+	TestCase{F, "interface_method_set_6", `var msist IStringer = &msV{4}; msist.(fmt.Stringer).String()`, "msV4", nil},
+	TestCase{F, "interface_method_set_7", `_, msok := IStringer(&msP{}).(fmt.Stringer); msok`, true, nil},
 
 	TestCase{F, "interface_method_to_func_1", "f1 := fmt.Stringer.String; f1(time.Hour)", "1h0m0s", nil},
 	TestCase{F, "interface_method_to_func_2", "f2 := io.ReadWriter.Read; f2 != nil", true, nil},
@@ -973,6 +3543,22 @@ var testcases = []TestCase{
 		}
 		var xe error = xerror{}
 		xe.Error()`, "some error", nil},
+	TestCase{F, "interface_embed_host_1", `
+		import "strings"
+		type IEmbedLen interface { io.Reader; Len() int }
+		var iel IEmbedLen = strings.NewReader("abc")
+		_, ielok := iel.(*strings.Reader)
+		ielok && iel.Len() == 3`, true, nil},
+	TestCase{F, "interface_embed_host_2", `
+		type IEmbedScan interface { IEmbedLen; io.ByteScanner }
+		var ies IEmbedScan = strings.NewReader("xyz")
+		ieb, _ := ies.ReadByte()
+		iel = ies
+		ieb == 'x' && iel.Len() == 2`, true, nil},
+	TestCase{F, "interface_embed_host_3", `
+		var ier io.Reader = ies
+		ien, _ := ier.Read(make([]byte, 5))
+		ien`, 2, nil},
 
 	TestCase{A, "multiple_values_1", "func twins(x float32) (float32,float32) { return x, x+1 }; twins(17.0)", nil, []interface{}{float32(17.0), float32(18.0)}},
 	TestCase{A, "multiple_values_2", "func twins2(x float32) (float32,float32) { return twins(x) }; twins2(19.0)", nil, []interface{}{float32(19.0), float32(20.0)}},
@@ -1125,6 +3711,17 @@ var testcases = []TestCase{
 			case time.Duration: vi = 6
 			case fmt.Stringer:  vi = 7
 		}; vi`, 6, nil},
+	// type switches on proxies and emulated interfaces, with interpreted and compiled cases
+	TestCase{F, "typeswitch_7", `type TS struct { Val int }; func (t TS) String() string { return "TS" }
+		type US struct { Val int }; func (u US) String() string { return "US" }
+		type IS interface { String() string }; type JS interface { String() string; Foo() }; nil`, nil, nil},
+	TestCase{F, "typeswitch_8", `var s fmt.Stringer = TS{}; switch v := s.(type) { case JS: vi = 0; case IS: vi = "8" + v.String() }; vi`, "8TS", nil},
+	TestCase{F, "typeswitch_9", `switch s.(type) { case US, JS: vi = 0; case TS, IS: vi = 9 }; vi`, 9, nil},
+	TestCase{F, "typeswitch_10", `var is IS = TS{}; switch v := is.(type) { case fmt.Stringer: vi = "10" + v.String() }; vi`, "10TS", nil},
+	TestCase{F, "typeswitch_11", `switch v := is.(type) { case US, TS: vi = "11" + v.String() }; vi`, "11TS", nil},
+	TestCase{F, "typeswitch_12", `is = nil; switch is.(type) { case fmt.Stringer, JS: vi = 0; case nil: vi = 12 }; vi`, 12, nil},
+	TestCase{F, "typeswitch_13", `s = nil; switch s.(type) { case IS, JS: vi = 0; case TS, nil: vi = 13 }; vi`, 13, nil},
+	TestCase{F, "typeswitch_14", `s = TS{}; switch v := s.(type) { case nil: vi = 0; default: vi = "14" + v.String() }; vi`, "14TS", nil},
 
 	TestCase{A, "typeassert_1", `var xi interface{} = "abc"; yi := xi.(string); yi`, "abc", nil},
 	TestCase{A, "typeassert_2", `xi.(string)`, nil, []interface{}{"abc", true}},
@@ -1212,6 +3809,22 @@ var testcases = []TestCase{
 	TestCase{A, "macro", "~macro second_arg(a,b,c interface{}) interface{} { return b }; v = 98; v", uint32(98), nil},
 	TestCase{A, "macro_call", "second_arg;1;v;3", uint32(98), nil},
 	TestCase{A, "macro_nested", "second_arg;1;{second_arg;2;3;4};5", 3, nil},
+	TestCase{F, "macro_type", "~macro type_of(x interface{}) interface{} { return MacroType(x).String() }; type mtPair struct { A, B int }; var mt float32", nil, none},
+	TestCase{F, "macro_type_var", "type_of; mt", "float32", nil},
+	TestCase{F, "macro_type_struct", "type_of; mtPair{}", "main.mtPair", nil},
+	TestCase{F, "macro_type_untyped", "type_of; 1.5", "float64", nil},
+	TestCase{F, "typed_hole", "~macro twice_int(x interface{}) interface{} { return ~\"{~,x:int * 2} }; type thInt int; var thi thInt = 5", nil, none},
+	TestCase{F, "typed_hole_const", "twice_int; 21", 42, nil},
+	TestCase{F, "typed_hole_untyped_float", "twice_int; 3.0", 6.0, nil},
+	TestCase{F, "typed_hole_mismatch_1", `twice_int; "abc"`, panics, nil},
+	TestCase{F, "typed_hole_mismatch_2", "twice_int; thi", panics, nil},
+	TestCase{F, "typed_hole_named", "~macro neg_thi(x interface{}) interface{} { return ~\"{-~,{x}:thInt} }", nil, none},
+	TestCase{F, "typed_hole_named_var", "neg_thi; thi", -5, nil},
+	TestCase{F, "derive_decl", "derive; {Stringer; Equal}; type dPoint struct { X, Y int; Tags []string }", nil, none},
+	TestCase{F, "derive_stringer", "dPoint{1, 2, nil}.String()", "dPoint{X:1 Y:2 Tags:[]}", nil},
+	TestCase{F, "derive_equal", `dPoint{1, 2, []string{"a"}}.Equal(dPoint{1, 2, []string{"a"}})`, true, nil},
+	TestCase{F, "derive_json", "derive; JSON; type dCelsius float64", nil, none},
+	TestCase{F, "derive_json_marshal", "dJson, _ := dCelsius(3.5).MarshalJSON(); string(dJson)", "3.5", nil},
 	TestCase{C, "values", "Values(3,4,5)", nil, []interface{}{3, 4, 5}},
 	TestCase{A, "eval", "Eval(~quote{1+2})", 3, nil},
 	TestCase{C, "eval_quote", "Eval(~quote{Values(3,4,5)})", nil, []interface{}{3, 4, 5}},
@@ -1776,3 +4389,521 @@ func (c *TestCase) compareUntyped(t *testing.T, actual untyped.Lit, expected unt
 func (c *TestCase) fail(t *testing.T, actual interface{}, expected interface{}) {
 	t.Errorf("expecting %v <%T>, found %v <%T>\n", expected, expected, actual, actual)
 }
+
+type safeExprUser struct {
+	Name  string
+	Age   int
+	Roles []string
+}
+
+func TestFastSafeExpr(t *testing.T) {
+	hasRole := func(u safeExprUser, role string) bool {
+		for _, r := range u.Roles {
+			if r == role {
+				return true
+			}
+		}
+		return false
+	}
+	env := safeexpr.Env{
+		Vars:  map[string]interface{}{"user": safeExprUser{}, "limit": 0},
+		Funcs: map[string]interface{}{"hasRole": hasRole},
+	}
+	expr, err := safeexpr.Compile(`user.Age >= limit && (hasRole(user, "admin") || len(user.Name) > 3)`, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.Type() != r.TypeOf(false) {
+		t.Errorf("expecting type bool, found %v", expr.Type())
+	}
+	for _, test := range []struct {
+		user     safeExprUser
+		limit    int
+		expected bool
+	}{
+		{safeExprUser{"bob", 20, []string{"admin"}}, 18, true},
+		{safeExprUser{"bob", 20, nil}, 18, false},
+		{safeExprUser{"alice", 20, nil}, 18, true},
+		{safeExprUser{"alice", 16, []string{"admin"}}, 18, false},
+	} {
+		result, err := expr.Eval(map[string]interface{}{"user": test.user, "limit": test.limit})
+		if err != nil || result != test.expected {
+			t.Errorf("Eval(%v, %d): expecting %v, found %v, error %v", test.user, test.limit, test.expected, result, err)
+		}
+	}
+	// omitted variables are reset to their zero value
+	if result, err := expr.Eval(map[string]interface{}{"user": safeExprUser{Name: "carol"}}); err != nil || result != true {
+		t.Errorf("Eval with omitted variable: expecting true, found %v, error %v", result, err)
+	}
+	if _, err := expr.Eval(map[string]interface{}{"limit": "x"}); err == nil {
+		t.Errorf("Eval with wrong variable type: expecting error")
+	}
+
+	if expr, err := safeexpr.Compile(`float64(limit) / 2 + 1.5`, env); err != nil {
+		t.Error(err)
+	} else if result, err := expr.Eval(map[string]interface{}{"limit": 3}); err != nil || result != 3.0 {
+		t.Errorf("expecting 3.0, found %v, error %v", result, err)
+	}
+	if expr, err := safeexpr.Compile(`user.Roles[limit]`, env); err != nil {
+		t.Error(err)
+	} else if _, err := expr.Eval(map[string]interface{}{"limit": 5}); err == nil {
+		t.Errorf("index out of range: expecting error")
+	}
+
+	for _, src := range []string{
+		`println("x")`,
+		`func() int { return 1 }()`,
+		`user.Roles[0:1][0] == "x" && os.Exit`,
+		`strings.ToUpper(user.Name)`,
+		`[]int{1, 2}`,
+		`user.(int)`,
+		`*(&limit)`,
+		`limit(3)`,
+		`Eval("1")`,
+		`1 << 1000000`,
+		`1 << (1 << 20)`,
+		`1e1000000000`,
+		`limit = 3`,
+	} {
+		if _, err := safeexpr.Compile(src, env); err == nil {
+			t.Errorf("Compile(%q): expecting error", src)
+		}
+	}
+	env.MaxCost = 5
+	if _, err := safeexpr.Compile(`limit + limit + limit + limit`, env); err == nil {
+		t.Errorf("expecting error for expression exceeding MaxCost")
+	}
+}
+
+func TestFastMethodMismatch(t *testing.T) {
+	ir := fast.New()
+	lib := ir.Library()
+	if _, _, err := lib.Eval(`import "io"
+type T struct{}; func (t *T) Read(p []byte) (int, error) { return 0, nil }
+type U struct{}; func (U) Read(p []byte) int { return 0 }; func (U) Close() {}
+type V struct{}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		src      string
+		expected []string
+	}{
+		{"var r io.Reader = T{}", []string{"main.T does not implement io.Reader: method Read has pointer receiver"}},
+		{"var rc io.ReadCloser = U{}", []string{
+			"main.U does not implement io.ReadCloser:\n",
+			"\n\t\twrong type for method Close: have Close(), want Close() error\n",
+			"\n\t\twrong type for method Read: have Read([]uint8) int, want Read(p []uint8) (n int, err error)"}},
+		{"func f(rw io.ReadWriter) {}; f(V{})", []string{"\n\t\tmissing method Read\n\t\tmissing method Write"}},
+		{"var x io.Reader; _ = x.(U)", []string{"impossible type assertion: <main.U> does not implement <io.Reader>: wrong type for method Read"}},
+	} {
+		_, _, err := lib.Eval(test.src)
+		if err == nil {
+			t.Errorf("%s: expecting error", test.src)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: expecting error containing %q, found %q", test.src, expected, err.Error())
+			}
+		}
+	}
+
+	tread := ir.TypeOf((*io.Reader)(nil)).Elem()
+	mismatches := xr.MethodMismatches(ir.TypeOf(0), tread)
+	if len(mismatches) != 1 || mismatches[0].Kind != xr.MethodMissing || mismatches[0].Want.Name != "Read" {
+		t.Errorf("MethodMismatches(int, io.Reader): expecting missing method Read, found %v", mismatches)
+	}
+	if mismatches := xr.MethodMismatches(ir.TypeOf(&bytes.Buffer{}), tread); len(mismatches) != 0 {
+		t.Errorf("MethodMismatches(*bytes.Buffer, io.Reader): expecting none, found %v", mismatches)
+	}
+}
+
+func TestFastSplitStatements(t *testing.T) {
+	ir := fast.New()
+	var stdout, stderr bytes.Buffer
+	ir.Comp.Stdout = &stdout
+	ir.Comp.Stderr = &stderr
+	ir.Comp.Options |= OptShowEval | OptTrapPanic
+	ir.ParseEvalPrint(":set split on")
+	if ir.Comp.Options&OptSplitStatements == 0 {
+		t.Fatalf("expecting option %v to be set", OptSplitStatements)
+	}
+	for _, test := range []struct {
+		src, stdout, stderr string
+	}{
+		{"a := 1; b := 2; a+b", "3\n", ""},
+		{"var s = 1; s; s = 2; s", "1\n2\n", ""},
+		{"s;; s+1", "2\n3\n", ""},
+		// consecutive declarations can reference each other out of order
+		{"func f() int { return g() }; func g() int { return 3 }; f()", "3\n", ""},
+		{"c := 1; c; d; c = 5", "1\n", "undefined identifier: d\n"},
+		{"c", "1\n", ""},
+		{"var p = []int{1}; a; p[3]; b", "1\n", "index out of range"},
+	} {
+		stdout.Reset()
+		stderr.Reset()
+		ir.ParseEvalPrint(test.src)
+		if stdout.String() != test.stdout {
+			t.Errorf("%s: expecting output %q, found %q", test.src, test.stdout, stdout.String())
+		}
+		if errs := stderr.String(); test.stderr == "" && errs != "" || !strings.Contains(errs, test.stderr) {
+			t.Errorf("%s: expecting error %q, found %q", test.src, test.stderr, errs)
+		}
+	}
+	// without split, only the last result is printed
+	ir.ParseEvalPrint(":set split off")
+	stdout.Reset()
+	ir.ParseEvalPrint("s; s+1")
+	if expected := "3\n"; stdout.String() != expected {
+		t.Errorf("expecting output %q, found %q", expected, stdout.String())
+	}
+}
+
+func TestFastEvalSteps(t *testing.T) {
+	ir := fast.New()
+	task := ir.EvalSteps(`
+		func sum(n int) int {
+			s := 0
+			for i := 1; i <= n; i++ {
+				s += i
+			}
+			return s
+		}
+		x := sum(100)`, 10)
+	n := 1
+	for !task.Resume() {
+		n++
+	}
+	if n < 10 {
+		t.Errorf("expecting EvalSteps to suspend at least 10 times, it suspended %d times", n)
+	}
+	if v, _ := ir.Eval1("x"); v.Interface() != 5050 {
+		t.Errorf("expecting 5050, found %v", v)
+	}
+
+	// once complete, Result returns the values
+	task = ir.EvalSteps("x = 0; x++; x *= 3; x", 100)
+	if !task.Done() {
+		t.Fatalf("expecting EvalSteps to complete")
+	}
+	if values, _ := task.Result(); len(values) != 1 || values[0].Interface() != 3 {
+		t.Errorf("expecting [3], found %v", values)
+	}
+
+	// canceled tasks execute deferred functions
+	task = ir.EvalSteps("var deferred bool; func loop() { defer func() { deferred = true }(); for { x++ } }; loop()", 50)
+	task.Resume()
+	task.Cancel()
+	if !task.Done() {
+		t.Errorf("expecting canceled task to be done")
+	}
+	if v, _ := ir.Eval1("deferred"); v.Interface() != true {
+		t.Errorf("expecting canceled task to execute deferred functions")
+	}
+
+	// panics propagate to Resume
+	task = ir.EvalSteps(`for i := 0; i < 3; i++ { x++ }; panic("boom")`, 1)
+	var rec interface{}
+	func() {
+		defer func() {
+			rec = recover()
+		}()
+		for !task.Resume() {
+		}
+	}()
+	if rec != "boom" {
+		t.Errorf("expecting Resume to panic with \"boom\", found %v", rec)
+	}
+	// the interpreter is usable again after a Task completes
+	if v, _ := ir.Eval1("x + 1"); v.Interface() == nil {
+		t.Errorf("expecting an int, found %v", v)
+	}
+
+	// abandoned tasks are canceled by a finalizer, which releases their goroutine
+	before := runtime.NumGoroutine()
+	func() {
+		ir.EvalSteps("for { x++ }", 10)
+	}()
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("expecting abandoned task to release its goroutine, found %d goroutines instead of %d", n, before)
+	}
+
+	// the finalizer cancels abandoned tasks in another goroutine:
+	// deferred functions that block must not stall the other finalizers
+	unblock := make(chan struct{})
+	ir.DeclVar("unblock", nil, unblock)
+	func() {
+		ir.EvalSteps("func block() { defer func() { <-unblock }(); for { x++ } }; block()", 10)
+	}()
+	runtime.GC()
+	time.Sleep(10 * time.Millisecond)
+	finalized := make(chan struct{})
+	obj := &struct{ p *int }{}
+	runtime.SetFinalizer(obj, func(interface{}) { close(finalized) })
+	obj = nil
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		select {
+		case <-finalized:
+			i = 100
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	select {
+	case <-finalized:
+	default:
+		t.Errorf("expecting finalizers to run while a canceled task executes its deferred functions")
+	}
+	close(unblock)
+}
+
+func TestFastSessionEnv(t *testing.T) {
+	ir := fast.New()
+	if err := ir.Setenv("GREETING", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ir.SetConfig("LEVEL", "3"); err != nil {
+		t.Fatal(err)
+	}
+	ir.Eval(`import "env"`)
+	for _, test := range []struct {
+		src      string
+		expected interface{}
+	}{
+		{`env.Get("GREETING") + " world"`, "hello world"},
+		{`env.Get("LEVEL")`, "3"},
+		{`env.Set("LEVEL", "4") != nil`, true},
+		{`env.Unset("LEVEL") != nil`, true},
+		{`env.IsReadOnly("LEVEL")`, true},
+		{`env.Set("RESULT", "42") == nil`, true},
+		{`_, ok := env.Lookup("MISSING"); ok`, false},
+		{`len(env.Environ())`, 3},
+	} {
+		if v, _ := ir.Eval1(test.src); v.Interface() != test.expected {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, v)
+		}
+	}
+	if value := ir.Getenv("RESULT"); value != "42" {
+		t.Errorf("expecting session variable RESULT=42, found %q", value)
+	}
+	if _, ok := os.LookupEnv("RESULT"); ok {
+		t.Errorf("session variables must not modify the process environment")
+	}
+	if err := ir.Setenv("LEVEL", "5"); err == nil {
+		t.Errorf("expecting error setting read-only session variable")
+	}
+	if err := ir.Unsetenv("GREETING"); err != nil {
+		t.Error(err)
+	}
+	if expected := []string{"LEVEL=3", "RESULT=42"}; !r.DeepEqual(ir.Environ(), expected) {
+		t.Errorf("expecting %v, found %v", expected, ir.Environ())
+	}
+	// session variables are not shared among interpreters
+	if v, _ := fast.New().Eval1(`import "env"; env.Get("LEVEL")`); v.Interface() != "" {
+		t.Errorf("expecting empty session variable in a new interpreter, found %v", v)
+	}
+}
+
+func TestFastParseErrors(t *testing.T) {
+	ir := fast.New()
+	var err error
+	func() {
+		defer func() {
+			err, _ = recover().(error)
+		}()
+		ir.Eval("a := ; b := 2; c := )\nd := (1 +\n  2) +\ne := 3")
+	}()
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expecting *base.ParseError, found %v <%T>", err, err)
+	}
+	// one error per statement, and the statements after them still get diagnostics
+	if len(perr.List) != 3 {
+		t.Fatalf("expecting 3 syntax errors, found %d: %v", len(perr.List), perr)
+	}
+	lines := strings.Split(perr.Error(), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("expecting 9 lines, found %d: %q", len(lines), lines)
+	}
+	for i, expected := range []string{
+		"a := ; b := 2; c := )",
+		"     ^^^",
+		"a := ; b := 2; c := )",
+		"                    ^^^",
+		"e := 3",
+		"  ^^^",
+	} {
+		if line := lines[1+i+i/2]; line != expected {
+			t.Errorf("line %d: expecting %q, found %q", 1+i+i/2, expected, line)
+		}
+	}
+	// later inputs are parsed normally
+	if v, _ := ir.Eval1("x := 3; x * 2"); v.Interface() != 6 {
+		t.Errorf("expecting 6, found %v", v)
+	}
+}
+
+func TestFastVecLoops(t *testing.T) {
+	const src = `
+		fs := []float64{0.1, 0.2, 0.3, 1e16, -1e16, 0.7}
+		gs := []float64{3, 1.0 / 3, 7, 1e-3, 2, 5}
+		is := []int{1, 2, 3, 4, 5}
+		js := []int{5, 4, 3, 2, 1, 0}
+		fsum, fsum2, fdot := 0.5, 0.25, 0.0
+		isum, idot := 7, 0
+		for _, x := range fs { fsum += x }
+		for i := range gs { fsum2 += gs[i] }
+		for i := range fs { fdot += gs[i] * fs[i] }
+		for _, x := range is { isum += x }
+		for i := range is { idot += is[i] * js[i] }
+		k := 3
+		for i := range is { is[i] *= k }
+		for i := range fs { fs[i] *= 0.5 }
+		var named []float32 = []float32{1, 2}
+		var nsum float32
+		for _, x := range named { nsum += x }`
+	const results = "[]interface{}{fsum, fsum2, fdot, isum, idot, is, fs, nsum}"
+
+	plain := fast.New()
+	plain.Eval(src)
+	expected, _ := plain.Eval1(results)
+
+	ir := fast.New()
+	ir.ParseEvalPrint(":set vec-loops on")
+	if ir.Comp.Options&OptVecLoops == 0 {
+		t.Fatalf("expecting option %v to be set", OptVecLoops)
+	}
+	ir.Eval(src)
+	actual, _ := ir.Eval1(results)
+	if e, a := expected.Interface(), actual.Interface(); !r.DeepEqual(e, a) {
+		t.Errorf("expecting %v, found %v", e, a)
+	}
+
+	// a dot product on a shorter slice updates acc, then panics
+	ir.Eval("short := []int{1, 2}; idot = 0")
+	func() {
+		defer func() {
+			if rec := recover(); rec == nil {
+				t.Errorf("expecting index out of range")
+			}
+		}()
+		ir.Eval("for i := range js { idot += js[i] * short[i] }")
+	}()
+	if v, _ := ir.Eval1("idot"); v.Interface() != 13 {
+		t.Errorf("expecting 13, found %v", v)
+	}
+
+	// routed loops run in a single statement
+	ir.Eval("big := make([]float64, 1000)")
+	if task := ir.EvalSteps("for i := range big { big[i] *= 2 }", 20); !task.Done() {
+		task.Cancel()
+		t.Errorf("expecting routed loop to complete within 20 steps")
+	}
+}
+
+func TestFastHotspots(t *testing.T) {
+	ir := fast.New()
+	var buf bytes.Buffer
+	ir.Comp.Stdout = &buf
+	ir.ParseEvalPrint(":set hotspots 2")
+	if ir.Comp.Options&OptHotspots == 0 {
+		t.Fatalf("expecting option %v to be set", OptHotspots)
+	}
+	ir.Eval(`func sumTo(n int) int {
+		s := 0
+		for i := 0; i < n; i++ {
+			s += i
+		}
+		return s
+	}`)
+	ir.ResetHotspots()
+	ir.Eval1("sumTo(1000)")
+	counts := make(map[string]uint64)
+	for _, spot := range ir.Hotspots(0) {
+		counts[spot.Source] = spot.Count
+	}
+	// each line may compile to several statements
+	if n := counts["s += i"]; n < 1000 || n%1000 != 0 {
+		t.Errorf("expecting a multiple of 1000 statements executed on line s += i, found %d", n)
+	}
+	if n := counts["for i := 0; i < n; i++ {"]; n < 1000 {
+		t.Errorf("expecting at least 1000 statements executed on the loop line, found %d", n)
+	}
+	if n := counts["return s"]; n == 0 || n >= 1000 {
+		t.Errorf("expecting a few statements executed on line return s, found %d", n)
+	}
+
+	// the REPL reports the 2 most expensive lines after each evaluation
+	buf.Reset()
+	ir.ParseEvalPrint("sumTo(500)")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "// hotspots:") || !strings.Contains(buf.String(), "s += i") {
+		t.Errorf("unexpected hotspots report:\n%s", buf.String())
+	}
+
+	ir.ParseEvalPrint(":set hotspots off")
+	buf.Reset()
+	ir.ParseEvalPrint("sumTo(500)")
+	if strings.Contains(buf.String(), "hotspots") {
+		t.Errorf("unexpected hotspots report after :set hotspots off:\n%s", buf.String())
+	}
+}
+
+func TestFastSession(t *testing.T) {
+	ir := fast.New()
+	ir.Comp.Options |= OptCollectDeclarations
+	ir.Eval(`
+		import "strings"
+		type Point struct { X, Y int; Name string }
+		const K = 3
+		func (p Point) Sum() int { return p.X + p.Y }
+		func scale(x int) int { return x * K }
+		n := 42
+		f := 0.1
+		pts := []Point{{1, 2, "a"}, {3, 4, "b"}}
+		m := map[string]int{"b": 2, "a": 1}
+		var nilp *Point
+		type Base struct { Z int }
+		type Outer struct { *Base; Point; W int }
+		emb := Outer{nil, Point{1, 2, "e"}, 7}
+		cb := func() string { return strings.ToUpper("x") }
+		ch := make(chan int)`)
+
+	var buf bytes.Buffer
+	err := ir.SaveSession(&buf)
+	serr, ok := err.(*fast.SessionError)
+	if !ok || len(serr.Items) != 2 || serr.Items[0].Name != "cb" || serr.Items[1].Name != "ch" {
+		t.Fatalf("expecting SaveSession to report variables cb and ch, found %v", err)
+	}
+	saved := buf.String()
+
+	ir2 := fast.New()
+	err = ir2.RestoreSession(strings.NewReader(saved))
+	if serr, ok := err.(*fast.SessionError); !ok || !serr.Restore || len(serr.Items) != 2 ||
+		!strings.Contains(serr.Items[0].Reason, "host state") {
+		t.Fatalf("expecting RestoreSession to report variables cb and ch, found %v", err)
+	}
+	for src, expected := range map[string]interface{}{
+		"pts[1].Sum() + scale(n)":        133,
+		`m["a"]*10 + m["b"]`:             12,
+		"f":                              0.1,
+		"nilp == nil":                    true,
+		`strings.Repeat(pts[0].Name, K)`: "aaa",
+		"emb.X + emb.W":                  8,
+		"emb.Base == nil":                true,
+	} {
+		if v, _ := ir2.Eval1(src); v.Interface() != expected {
+			t.Errorf("%s: expecting %v, found %v", src, expected, v)
+		}
+	}
+
+	// sessions saved by newer releases are rejected without evaluating anything
+	newer := strings.Replace(saved, `"version": 1`, `"version": 2`, 1)
+	if err := fast.New().RestoreSession(strings.NewReader(newer)); err == nil || !strings.Contains(err.Error(), "newer gomacro release") {
+		t.Errorf("expecting RestoreSession to reject a newer session version, found %v", err)
+	}
+}
@@ -31,7 +31,9 @@ const (
 	Const
 	Expr
 	Func
+	FuncFwd
 	Import
+	Init
 	Macro
 	Method
 	Package
@@ -47,7 +49,9 @@ var kinds = map[Kind]string{
 	Const:    "Const",
 	Expr:     "Expr",
 	Func:     "Func",
+	FuncFwd:  "FuncFwd", // forward function declaration
 	Import:   "Import",
+	Init:     "Init", // func init() { ... }
 	Macro:    "Macro",
 	Method:   "Method",
 	Package:  "Package",
@@ -133,4 +137,6 @@ func NewSorter() *Sorter {
 // declaration order by analyzing their dependencies.
 //
 // also resolves top-level var initialization order
-// analyzing their dependencies.
+// analyzing their dependencies, as described in Go specs "Package initialization":
+// variables also depend on the variables referenced by the functions and methods they reference,
+// and func init() are executed after all other declarations, in source order.
@@ -24,6 +24,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"strings"
 
 	"github.com/cosmos72/gomacro/base/output"
 )
@@ -83,6 +84,113 @@ func (m DeclMap) RemoveUnresolvableDeps() {
 	}
 }
 
+// replace dependencies "var.method" with "type.method" if the type of var is known:
+// a method value depends on the method declaration
+func (m DeclMap) resolveMethodValues() {
+	vartypes := make(map[string]string)
+	for name, list := range m {
+		for _, decl := range list {
+			if decl.Kind == Var && decl.Extra != nil {
+				if typ := m.varTypeName(decl.Extra); typ != "" {
+					vartypes[name] = typ
+				}
+			}
+		}
+	}
+	if len(vartypes) == 0 {
+		return
+	}
+	for _, list := range m {
+		for _, decl := range list {
+			deps := decl.Deps
+			for _, dep := range deps {
+				if dot := strings.IndexByte(dep, '.'); dot > 0 {
+					if typ, ok := vartypes[dep[:dot]]; ok {
+						decl.Deps = append(decl.Deps, typ+dep[dot:])
+					}
+				}
+			}
+			if len(decl.Deps) != len(deps) {
+				decl.Deps = sort_unique_inplace(decl.Deps)
+			}
+		}
+	}
+}
+
+// return the name of the type declared in m of a variable with type T or *T,
+// or initialized with T{...}, &T{...} or new(T)
+func (m DeclMap) varTypeName(extra *Extra) string {
+	var ident *ast.Ident
+	if extra.Type != nil {
+		ident = selectorBase(extra.Type)
+	} else if call, ok := extra.Value.(*ast.CallExpr); ok {
+		if fun, ok := call.Fun.(*ast.Ident); ok && fun.Name == "new" && len(call.Args) == 1 {
+			ident = selectorBase(call.Args[0])
+		}
+	} else if extra.Value != nil {
+		ident = selectorBase(extra.Value)
+		if _, ok := extra.Value.(*ast.Ident); ok {
+			ident = nil // var x = y: type of y is not known here
+		}
+	}
+	if ident == nil {
+		return ""
+	}
+	for _, decl := range m[ident.Name] {
+		if decl.Kind == Type {
+			return ident.Name
+		}
+	}
+	return ""
+}
+
+// add to variables the dependencies of the functions and methods they reference, transitively:
+// Go specs "Package initialization" states that a reference to a function or method
+// is a dependency on the variables referenced by its body
+func (m DeclMap) addIndirectDeps() {
+	for _, list := range m {
+		for _, decl := range list {
+			if decl.Kind != Var && decl.Kind != VarMulti {
+				continue
+			}
+			seen := make(set)
+			deps := decl.Deps
+			for _, dep := range deps {
+				seen[dep] = void{}
+			}
+			for i := 0; i < len(deps); i++ {
+				for _, fun := range m[deps[i]] {
+					if fun.Kind != Func && fun.Kind != Method {
+						continue
+					}
+					for _, dep := range fun.Deps {
+						if _, ok := seen[dep]; !ok {
+							seen[dep] = void{}
+							deps = append(deps, dep)
+						}
+					}
+				}
+			}
+			decl.Deps = sort_unique_inplace(deps)
+		}
+	}
+}
+
+// remove from m the func init() declarations and return them, sorted by position
+func (m DeclMap) removeInits() DeclList {
+	var inits DeclList
+	for name, list := range m {
+		for _, decl := range list {
+			if decl.Kind == Init {
+				inits = append(inits, decl)
+				delete(m, name)
+				break
+			}
+		}
+	}
+	return inits.SortByPos()
+}
+
 func (m DeclMap) Print() {
 	m.List().SortByPos().Print()
 }
@@ -53,7 +53,10 @@ func (g *graph) Sort() DeclList {
 		if len(buf) == 0 {
 			buf = g.RemoveTypeFwd()
 			if len(buf) == 0 {
-				g.circularDependencyError()
+				buf = g.RemoveFuncFwd()
+				if len(buf) == 0 {
+					g.circularDependencyError()
+				}
 			}
 		}
 		g.RemoveUnresolvableDeps()
@@ -121,8 +124,10 @@ func (g *graph) RemoveDeps(m DeclMap) {
 	}
 }
 
-// for nodes with Kind 'k', remove from g.Edges dependencies that are in m
-func (g *graph) RemoveDepsFor(k Kind, m DeclMap) {
+// for nodes with Kind 'k', remove from g.Edges dependencies that are in m.
+// return the number of removed dependencies
+func (g *graph) RemoveDepsFor(k Kind, m DeclMap) int {
+	n := 0
 	for name, list := range g.Nodes {
 		for _, decl := range list {
 			if decl.Kind != k {
@@ -133,16 +138,44 @@ func (g *graph) RemoveDepsFor(k Kind, m DeclMap) {
 					if _, ok := m[edge]; ok {
 						// node in m, drop the edge
 						delete(edges, edge)
+						n++
 					}
 				}
 			}
 		}
 	}
+	return n
 }
 
 // return forward declarations for some types that hopefully break
-// as many circular dependencies as possible
+// as many circular dependencies as possible.
+// return nil if they break no dependency
 func (g *graph) RemoveTypeFwd() DeclList {
+	list := g.removeFwd(Type, TypeFwd)
+	if g.RemoveDepsFor(Type, list.Map()) == 0 {
+		return nil
+	}
+	return list
+}
+
+// return forward declarations for some functions that hopefully break
+// as many circular dependencies as possible, as for example mutually recursive functions.
+// only dependencies of functions and methods are broken: variables must still
+// wait for the functions they reference to be completely declared,
+// thus cycles through a variable are not broken.
+// return nil if they break no dependency, otherwise Sort() would loop forever
+func (g *graph) RemoveFuncFwd() DeclList {
+	list := g.removeFwd(Func, FuncFwd)
+	m := list.Map()
+	if g.RemoveDepsFor(Func, m)+g.RemoveDepsFor(Method, m) == 0 {
+		return nil
+	}
+	return list
+}
+
+// return forward declarations, with Kind 'fwdKind', for the nodes with Kind 'k'
+// that appear most often in circular dependencies
+func (g *graph) removeFwd(k Kind, fwdKind Kind) DeclList {
 	ctx := visitCtx{
 		visiting: make(map[string]int),
 		visited:  make(map[string]int),
@@ -160,7 +193,7 @@ func (g *graph) RemoveTypeFwd() DeclList {
 	most := 1
 	for name, count := range ctx.visited {
 		for _, decl := range g.Nodes[name] {
-			if decl == nil || decl.Kind != Type || count < most {
+			if decl == nil || decl.Kind != k || count < most {
 				continue
 			}
 			if count > most {
@@ -173,13 +206,12 @@ func (g *graph) RemoveTypeFwd() DeclList {
 	if len(list) == 0 {
 		return nil
 	}
-	// change Kind of returned Decls to TypeFwd
+	// change Kind of returned Decls to fwdKind
 	for i, e := range list {
 		fwd := *e
-		fwd.Kind = TypeFwd
+		fwd.Kind = fwdKind
 		list[i] = &fwd
 	}
-	g.RemoveDepsFor(Type, list.Map())
 	return list
 }
 
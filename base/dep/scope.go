@@ -251,7 +251,7 @@ func (s *Scope) Vars(node ast.Spec) []string {
 func (s *Scope) varsMultiValueExpr(node *ast.ValueSpec) []string {
 	deps := append(s.Expr(node.Type), s.Expr(node.Values[0])...)
 	for _, ident := range node.Names {
-		s.add(NewDeclVarMulti(ident, node, deps))
+		s.add(s.uniqueBlank(NewDeclVarMulti(ident, node, deps)))
 		node = nil // store node only in the first VarMulti
 	}
 	return deps
@@ -259,7 +259,18 @@ func (s *Scope) varsMultiValueExpr(node *ast.ValueSpec) []string {
 
 // variable
 func (s *Scope) Var(ident *ast.Ident, node ast.Spec, typ ast.Expr, value ast.Expr, deps []string) *Decl {
-	return s.add(NewDeclVar(ident, node, typ, value, deps))
+	return s.add(s.uniqueBlank(NewDeclVar(ident, node, typ, value, deps)))
+}
+
+// there can be many variables named "_", and nothing can refer to them:
+// give each one a unique name, so they are initialized in source order
+// instead of being merged together
+func (s *Scope) uniqueBlank(decl *Decl) *Decl {
+	if decl.Name == "_" {
+		decl.Name = fmt.Sprintf("<_%d>", s.Gensym)
+		s.Gensym++
+	}
+	return decl
 }
 
 // function or method
@@ -267,7 +278,7 @@ func (s *Scope) Func(node *ast.FuncDecl) []string {
 	inner := NewScope(s)
 
 	name := node.Name.Name
-	deps := inner.Expr(node.Type)
+	deps := inner.funcType(node.Type)
 
 	kind := Func
 	if node.Recv != nil && len(node.Recv.List) != 0 {
@@ -275,9 +286,8 @@ func (s *Scope) Func(node *ast.FuncDecl) []string {
 		// method names are not global!
 		// without this, a method Foo.String would overwrite a func String in s.Decls[]
 		//
-		// also makes it impossible to depend on a method, but nothing can depend on a method,
-		// Except the constant returned by unsafe.Sizeof(type.method),
-		// but we do not support unsafe.Sizeof() yet and all methods have the same size anyway
+		// method values and method expressions depend on "type.method",
+		// see Scope.selectorExpr() and DeclMap.resolveMethodValues()
 		if len(types) == 1 {
 			name = fmt.Sprintf("%s.%s", types[0], name)
 		} else {
@@ -287,6 +297,11 @@ func (s *Scope) Func(node *ast.FuncDecl) []string {
 
 		deps = append(deps, types...)
 		kind = Method
+	} else if name == "init" && s.Outer == nil {
+		// there can be many init() functions, and nothing can refer to them
+		name = fmt.Sprintf("<init%d>", s.Gensym)
+		s.Gensym++
+		kind = Init
 	}
 	// support recursive functions: forward-declare the function
 	// decl := &Decl{Kind: kind, Name: name}
@@ -299,6 +314,22 @@ func (s *Scope) Func(node *ast.FuncDecl) []string {
 	return deps
 }
 
+// declare in s the parameters and results of a function,
+// and compute dependencies for their types.
+// Do not use s.Expr(node): it would declare them in a new scope, invisible to the function body
+func (s *Scope) funcType(node *ast.FuncType) []string {
+	var deps []string
+	for _, list := range []*ast.FieldList{node.Params, node.Results} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			deps = append(deps, s.Expr(field)...)
+		}
+	}
+	return sort_unique_inplace(deps)
+}
+
 // type
 func (s *Scope) Type(node ast.Spec) []string {
 	var deps []string
@@ -338,10 +369,10 @@ func (s *Scope) AstExpr(in ast2.Ast) []string {
 	var deps []string
 	switch node := in.Interface().(type) {
 	case *ast.FuncLit:
-		deps = append(deps, s.Expr(node.Type)...)
-		in = ast2.BlockStmt{node.Body}
-		// open a new scope
+		// open a new scope, containing the parameters and results
 		s = NewScope(s)
+		deps = append(deps, s.funcType(node.Type)...)
+		in = ast2.BlockStmt{node.Body}
 	case *ast.BlockStmt, *ast.FuncType, *ast.InterfaceType, *ast.StructType:
 		// open a new scope
 		s = NewScope(s)
@@ -379,29 +410,51 @@ func (s *Scope) AstExpr(in ast2.Ast) []string {
 
 // return true if name refers to a local declaration
 func (s *Scope) isLocal(name string) bool {
-	outer := s.Outer
-	// outer == nil is top-level scope: not local
-	for ; outer != nil; s = outer {
+	// s.Outer == nil is top-level scope: not local
+	for ; s != nil && s.Outer != nil; s = s.Outer {
 		if _, ok := s.Decls[name]; ok {
 			return true
 		}
-		outer = outer.Outer
 	}
 	return false
 }
 
-// compute dependencies for: package.symbol, type.method, type.field.
+// compute dependencies for: package.symbol, type.method, type.field,
+// and also var.method, (*type).method, (&var).method, type{...}.method.
 // only the part *before* the dot may be a local declaration,
 // but dependency from type.method is stronger than dependency from type,
-// so keep both
+// so keep both. var.method is later replaced by type.method, see DeclMap.resolveMethodValues()
 func (s *Scope) selectorExpr(node *ast.SelectorExpr) []string {
 	deps := s.Expr(node.X)
-	if typ, ok := node.X.(*ast.Ident); ok && typ != nil && !s.isLocal(typ.Name) {
+	if typ := selectorBase(node.X); typ != nil && !s.isLocal(typ.Name) {
 		deps = append(deps, typ.Name+"."+node.Sel.Name)
 	}
 	return deps
 }
 
+// return the identifier x in expressions x, (x), *x, &x and x{...}
+func selectorBase(expr ast.Expr) *ast.Ident {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.UnaryExpr:
+			if e.Op != token.AND {
+				return nil
+			}
+			expr = e.X
+		case *ast.CompositeLit:
+			expr = e.Type
+		default:
+			return nil
+		}
+	}
+}
+
 func (s *Scope) add(decl *Decl) *Decl {
 	return s.Decls.add(decl)
 }
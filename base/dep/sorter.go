@@ -157,16 +157,21 @@ loop:
 	s.scope.Decls = make(DeclMap)
 
 	s.scope.Nodes(nodes)
+	s.scope.Decls.resolveMethodValues()
 	s.scope.Decls.RemoveUnresolvableDeps()
 	m := s.scope.Decls.Dup()
 
 	s.scope.Decls = nil
 
+	m.addIndirectDeps()
+	// func init() are executed after all other declarations, in source order
+	inits := m.removeInits()
+
 	g := graph{
 		Nodes: m,
 		Edges: m.depMap(),
 	}
-	return g.Sort()
+	return append(g.Sort(), inits...)
 }
 
 func (s *Sorter) popStmts() []*Decl {
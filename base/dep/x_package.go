@@ -16,7 +16,9 @@ func init() {
 		"DEBUG_GRAPH":	r.ValueOf(DEBUG_GRAPH),
 		"Expr":	r.ValueOf(Expr),
 		"Func":	r.ValueOf(Func),
+		"FuncFwd":	r.ValueOf(FuncFwd),
 		"Import":	r.ValueOf(Import),
+		"Init":	r.ValueOf(Init),
 		"Macro":	r.ValueOf(Macro),
 		"Method":	r.ValueOf(Method),
 		"NewDecl":	r.ValueOf(NewDecl),
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/cosmos72/gomacro/go/etoken"
@@ -63,6 +64,7 @@ func TestSorter(t *testing.T) {
 		{"z_test_data_1", "z_test_data_1.txt"},
 		{"z_test_data_2", "z_test_data_2.txt"},
 		{"z_test_data_3", "z_test_data_3.txt"},
+		{"z_test_data_4", "z_test_data_4.txt"},
 		{"fast_global", "../../fast/global.go"},
 	}
 	for _, test := range tests {
@@ -100,3 +102,39 @@ func _testSorter(t *testing.T, filename string) {
 		sorted.Print()
 	}
 }
+
+// a cycle var -> func -> var cannot be broken by forward declarations
+// and must be reported as an error, not loop forever
+func TestSorterVarFuncCycle(t *testing.T) {
+	src := `package test
+
+var x = f()
+
+func f() int {
+	return g()
+}
+
+func g() int {
+	return x
+}
+`
+	var p parser.Parser
+	p.Init(etoken.NewFileSet(), "cycle.go", 0, []byte(src))
+	nodes, err := p.Parse()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	s := NewSorter()
+	s.LoadNodes(nodes)
+
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			t.Errorf("expecting declaration loop error, found none")
+		} else if msg := fmt.Sprint(rec); !strings.Contains(msg, "declaration loop") {
+			t.Errorf("expecting declaration loop error, found: %v", msg)
+		}
+	}()
+	for len(s.Some()) != 0 {
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * bindings.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"bytes"
+	"go/types"
+	"io/ioutil"
+	"strings"
+)
+
+// Bindings describes the package-level declarations of a type-checked package
+// that its generated import file makes available to interpreted code.
+//
+// Analyze and Render are the pure layer of genimport: they only inspect a *types.Package,
+// and never read or write files nor execute the go toolchain.
+// Tests and other tools can use them to generate import files hermetically
+type Bindings struct {
+	Path string // import path of the package
+	Name string // name of the package
+	// sorted names of the exported declarations to bind.
+	// Callers can remove some of them before calling Render, as import filters do
+	Names []string
+	// problems found while analyzing the package, as generic functions that cannot be instantiated
+	// or integer constants that overflow both int64 and uint64
+	Warnings []string
+	pkg      *types.Package
+}
+
+// Analyze returns the Bindings of type-checked package pkg
+func Analyze(pkg *types.Package) Bindings {
+	b := Bindings{Path: pkg.Path(), Name: pkg.Name(), pkg: pkg}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name); obj.(type) {
+		case *types.Const, *types.Var, *types.Func, *types.TypeName:
+			if obj.Exported() {
+				b.Names = append(b.Names, name)
+			}
+		}
+	}
+	if len(b.Names) != 0 {
+		// the warnings are detected while writing the import file: write it once, and collect them
+		var buf, stderr bytes.Buffer
+		writeImportFile(&Output{Stdout: ioutil.Discard, Stderr: &stderr}, &buf, b.Path, pkg, b.Names, ImPlugin)
+		for _, line := range strings.Split(stderr.String(), "\n") {
+			if line = strings.TrimPrefix(line, "// warning: "); len(line) != 0 {
+				b.Warnings = append(b.Warnings, line)
+			}
+		}
+	}
+	return b
+}
+
+// Render returns the Go source file that allows interpreted code to import b.Path,
+// as written by import _b, import _i or the plugin mechanism depending on mode.
+// The output is deterministic: it only depends on b and mode.
+// b must be returned by Analyze, possibly with fewer Names.
+// Returns nil if b.Names is empty, or lists no constants, functions, types or variables
+func Render(b Bindings, mode ImportMode) []byte {
+	if len(b.Names) == 0 || b.pkg == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	o := &Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	if writeImportFile(o, &buf, b.Path, b.pkg, b.Names, mode) {
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,210 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * clean.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/base/paths"
+)
+
+// MaxImportsSize is the maximum total size, in bytes, of the directories in $GOPATH/src/gomacro.imports:
+// after compiling a new plugin, the least recently used ones are removed until the total fits.
+// Zero or negative means unlimited
+var MaxImportsSize int64 = 4 << 30
+
+// directories without a compiled plugin are removed only if older than orphanGrace:
+// another gomacro process may be compiling them right now
+const orphanGrace = time.Hour
+
+// ImportsEntry describes a directory in $GOPATH/src/gomacro.imports,
+// created to compile the plugin of an imported package
+type ImportsEntry struct {
+	Dir      string    // absolute path of the directory
+	PkgPath  string    // import path of the package
+	Size     int64     // total size of the files in Dir, excluding subdirectories
+	LastUsed time.Time // when the plugin was last compiled or loaded
+	Orphaned bool      // true if Dir contains no compiled plugin, or the plugin cache does not know it
+}
+
+// CleanOptions specify which directories of $GOPATH/src/gomacro.imports are removed by CleanImports
+type CleanOptions struct {
+	OlderThan time.Duration // if positive, remove entries not used for longer than OlderThan
+	MaxSize   int64         // if positive, then remove the least recently used entries until the total size fits
+	DryRun    bool          // only return the entries that would be removed
+}
+
+// return the directory containing the plugins of imported packages
+func importsDir() string {
+	return paths.Subdir(paths.GoSrcDir, "gomacro.imports")
+}
+
+// ListImports returns the directories in $GOPATH/src/gomacro.imports, least recently used first
+func ListImports() ([]ImportsEntry, error) {
+	root := importsDir()
+	pluginCacheLock.Lock()
+	cache := readPluginCache()
+	pluginCacheLock.Unlock()
+
+	var list []ImportsEntry
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && dir == root {
+				return filepath.SkipDir
+			}
+			return err
+		} else if !info.IsDir() || dir == root {
+			return nil
+		}
+		entry, ok := readImportsEntry(root, dir)
+		if ok {
+			_, known := cache[entry.PkgPath]
+			entry.Orphaned = entry.Orphaned || !known
+			list = append(list, entry)
+		}
+		return nil
+	})
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].LastUsed.Before(list[j].LastUsed)
+	})
+	return list, err
+}
+
+// describe directory dir. Returns ok == false if it contains no files
+func readImportsEntry(root string, dir string) (entry ImportsEntry, ok bool) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return entry, false
+	}
+	entry.Dir = dir
+	entry.PkgPath = filepath.ToSlash(strings.TrimPrefix(dir, root+string(filepath.Separator)))
+	entry.Orphaned = true
+	var newest time.Time
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		ok = true
+		entry.Size += info.Size()
+		if strings.HasSuffix(info.Name(), ".so") {
+			// its modification time is updated each time the plugin is loaded
+			entry.Orphaned = false
+			entry.LastUsed = info.ModTime()
+		} else if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	if entry.Orphaned {
+		entry.LastUsed = newest
+	}
+	return entry, ok
+}
+
+// CleanImports removes from $GOPATH/src/gomacro.imports the orphaned directories, i.e. without a compiled plugin,
+// and the directories selected by opts. Returns the removed entries, or the entries that would be removed
+// if opts.DryRun is true. Packages whose directory is removed will be compiled again when imported
+func CleanImports(opts CleanOptions) ([]ImportsEntry, error) {
+	list, err := ListImports()
+	if err != nil {
+		return nil, err
+	}
+	return removeImports(selectImports(list, opts, time.Now(), ""), opts.DryRun)
+}
+
+// return the entries of list, sorted by LastUsed, to be removed according to opts.
+// The entry for pkgpath keep is never selected
+func selectImports(list []ImportsEntry, opts CleanOptions, now time.Time, keep string) []ImportsEntry {
+	var selected []ImportsEntry
+	var total int64
+	kept := list[:0:0]
+	for _, entry := range list {
+		age := now.Sub(entry.LastUsed)
+		if entry.PkgPath != keep && (entry.Orphaned && age > orphanGrace || opts.OlderThan > 0 && age > opts.OlderThan) {
+			selected = append(selected, entry)
+		} else {
+			kept = append(kept, entry)
+			total += entry.Size
+		}
+	}
+	// kept is sorted by LastUsed too: remove the least recently used first,
+	// skipping recent orphans that may still be compiling
+	for _, entry := range kept {
+		if opts.MaxSize <= 0 || total <= opts.MaxSize {
+			break
+		} else if entry.PkgPath != keep && !entry.Orphaned {
+			selected = append(selected, entry)
+			total -= entry.Size
+		}
+	}
+	return selected
+}
+
+// remove the files of each entry, then its directory and its parents if empty
+func removeImports(list []ImportsEntry, dryRun bool) ([]ImportsEntry, error) {
+	if dryRun {
+		return list, nil
+	}
+	root := importsDir()
+	for i, entry := range list {
+		infos, err := ioutil.ReadDir(entry.Dir)
+		for _, info := range infos {
+			if err == nil && !info.IsDir() {
+				err = os.Remove(filepath.Join(entry.Dir, info.Name()))
+			}
+		}
+		if err != nil {
+			return list[:i], err
+		}
+		ForgetCachedPlugin(entry.PkgPath)
+		for dir := entry.Dir; dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				// not empty
+				break
+			}
+		}
+	}
+	return list, nil
+}
+
+// touchPlugin records that the plugin soname was just used, for the least recently used policy of MaxImportsSize
+func touchPlugin(soname string) {
+	now := time.Now()
+	os.Chtimes(soname, now, now)
+}
+
+// enforce MaxImportsSize after compiling the plugin for pkgpath, which is never removed
+func (imp *Importer) limitImportsSize(pkgpath string) {
+	if MaxImportsSize <= 0 {
+		return
+	}
+	list, err := ListImports()
+	if err == nil {
+		opts := CleanOptions{MaxSize: MaxImportsSize}
+		list, err = removeImports(selectImports(list, opts, time.Now(), pkgpath), false)
+		for _, entry := range list {
+			imp.output.Debugf("removed least recently used import directory %q", entry.Dir)
+		}
+	}
+	if err != nil {
+		imp.output.Debugf("cannot limit the size of %q: %v", importsDir(), err)
+	}
+}
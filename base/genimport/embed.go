@@ -0,0 +1,49 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * embed.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cosmos72/gomacro/base/paths"
+)
+
+// EmbedPackage writes into directory dir the file x_embed_$PKGPATH.go, in package filepkg,
+// whose init() registers pkgpath with imports.Register.
+// Compiling such file into the application that embeds gomacro allows its interpreters
+// to import pkgpath without the go toolchain, see Importer.SetToolchain and "gomacro gen --embed".
+// Returns the name of the written file, or the empty string if pkgpath exports nothing
+func (imp *Importer) EmbedPackage(pkgpath, filepkg, dir string) (string, error) {
+	if err := imp.checkAllowed(pkgpath); err != nil {
+		return "", err
+	}
+	gpkg, err := imp.Load(pkgpath, true /*enableModule*/)
+	if err != nil {
+		return "", imp.wrapImportError(pkgpath, true, err)
+	}
+	src := GenerateEmbedFile(imp.output, pkgpath, gpkg, imp.only[pkgpath], filepkg)
+	if len(src) == 0 {
+		imp.output.Warnf("package %q exports zero constants, functions, types and variables", pkgpath)
+		return "", nil
+	}
+	f := paths.Subdir(dir, computeImportFilename(imp.output, pkgpath, ImEmbed))
+	if err = ioutil.WriteFile(f, []byte(src), os.FileMode(0o644)); err != nil {
+		return "", err
+	}
+	return f, nil
+}
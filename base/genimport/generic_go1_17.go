@@ -0,0 +1,45 @@
+// +build !go1.18
+
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * generic_go1_17.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"go/types"
+)
+
+// Go < 1.18 has no generics
+func isGeneric(obj types.Object) bool {
+	return false
+}
+
+func isConstraint(obj types.Object) bool {
+	return false
+}
+
+func (gen *genimport) instantiate(obj types.Object) (targs string, ok bool) {
+	return "", false
+}
+
+type instance struct {
+	targs string
+	keys  []string
+}
+
+func (gen *genimport) instances(obj types.Object) []instance {
+	return nil
+}
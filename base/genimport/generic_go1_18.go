@@ -0,0 +1,509 @@
+// +build go1.18
+
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * generic_go1_18.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+)
+
+// return the type parameters of a generic function or generic named type,
+// or nil if obj is not generic
+func typeParams(obj types.Object) *types.TypeParamList {
+	switch obj := obj.(type) {
+	case *types.Func:
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.TypeParams().Len() != 0 {
+			return sig.TypeParams()
+		}
+	case *types.TypeName:
+		if obj.IsAlias() {
+			return nil
+		}
+		if t, ok := obj.Type().(*types.Named); ok && t.TypeParams().Len() != 0 {
+			return t.TypeParams()
+		}
+	}
+	return nil
+}
+
+func isGeneric(obj types.Object) bool {
+	return typeParams(obj) != nil
+}
+
+// return true if obj is an interface that can only be used as a type constraint,
+// because it contains a union of types or embeds comparable
+func isConstraint(obj types.Object) bool {
+	if _, ok := obj.(*types.TypeName); ok {
+		if iface, ok := obj.Type().Underlying().(*types.Interface); ok {
+			return !iface.IsMethodSet()
+		}
+	}
+	return false
+}
+
+// the interpreter cannot instantiate compiled generics: choose one instantiation
+// of generic obj, and return its type arguments as Go source, including the brackets.
+//
+// Each type parameter is instantiated with interface{} if its constraint is
+// any or comparable, with the constraint itself if it only contains methods,
+// and with its core type if the constraint is a single term as ~[]E or ~map[K]V.
+// Other constraints, as unions of types, cannot be satisfied by a single choice:
+// return ok == false for them.
+func (gen *genimport) instantiate(obj types.Object) (targs string, ok bool) {
+	tparams := typeParams(obj)
+	if tparams == nil {
+		return "", false
+	}
+	n := tparams.Len()
+	chosen := make(map[*types.TypeParam]types.Type, n)
+	for progress := true; progress && len(chosen) < n; {
+		progress = false
+		for i := 0; i < n; i++ {
+			tparam := tparams.At(i)
+			if chosen[tparam] != nil {
+				continue
+			}
+			if t := chooseTypeArg(tparam, chosen); t != nil {
+				chosen[tparam] = t
+				progress = true
+			}
+		}
+	}
+	if len(chosen) < n {
+		return "", false
+	}
+	list := make([]types.Type, n)
+	for i := range list {
+		list[i] = chosen[tparams.At(i)]
+		if !gen.typeImported(list[i]) {
+			return "", false
+		}
+	}
+	if _, err := types.Instantiate(nil, obj.Type(), list, true); err != nil {
+		return "", false
+	}
+	return gen.typeList(list), true
+}
+
+// return the Go source of type arguments list, including the brackets
+func (gen *genimport) typeList(list []types.Type) string {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, t := range list {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		types.WriteType(&buf, t, gen.packageNameQualifier)
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
+
+// type arguments of the explicit instantiations written for each generic function,
+// as slices.Sort[int]. Other type arguments cannot be used from interpreted code
+var commonTypeArgs = []types.Type{
+	types.Typ[types.Bool],
+	types.Typ[types.Int], types.Typ[types.Int8], types.Typ[types.Int16], types.Typ[types.Int32], types.Typ[types.Int64],
+	types.Typ[types.Uint], types.Typ[types.Uint8], types.Typ[types.Uint16], types.Typ[types.Uint32], types.Typ[types.Uint64],
+	types.Typ[types.Uintptr],
+	types.Typ[types.Float32], types.Typ[types.Float64],
+	types.Typ[types.Complex64], types.Typ[types.Complex128],
+	types.Typ[types.String],
+	emptyInterface,
+}
+
+// maximum number of explicit instantiations written for each generic function:
+// functions that would need more of them get none
+const maxInstances = 64
+
+// instance is an explicit instantiation of a generic function
+type instance struct {
+	targs string   // Go source of the type arguments, including the brackets
+	keys  []string // names of the instantiation in Package.Binds, as Sort[int] or Index[[]int]
+}
+
+// the interpreter cannot instantiate compiled generics: list the explicit instantiations of
+// generic function obj with commonTypeArgs, that interpreted code can use as pkg.Func[T1, T2...]
+//
+// Each type parameter constrained by a single term, as ~[]E or ~map[K]V, is computed from that term,
+// while each other type parameter is instantiated with all the commonTypeArgs that satisfy its constraint.
+func (gen *genimport) instances(obj types.Object) []instance {
+	fun, ok := obj.(*types.Func)
+	if !ok {
+		return nil
+	}
+	tparams := typeParams(fun)
+	if tparams == nil {
+		return nil
+	}
+	n := tparams.Len()
+	var free []*types.TypeParam
+	var candidates [][]types.Type
+	count := 1
+	for i := 0; i < n; i++ {
+		tparam := tparams.At(i)
+		if coreTerm(tparam) != nil {
+			continue
+		}
+		var list []types.Type
+		for _, t := range commonTypeArgs {
+			if satisfies(t, tparam.Constraint()) {
+				list = append(list, t)
+			}
+		}
+		count *= len(list)
+		if count == 0 || count > maxInstances {
+			return nil
+		}
+		free = append(free, tparam)
+		candidates = append(candidates, list)
+	}
+	var insts []instance
+	idx := make([]int, len(free))
+	for {
+		chosen := make(map[*types.TypeParam]types.Type, n)
+		for i, tparam := range free {
+			chosen[tparam] = candidates[i][idx[i]]
+		}
+		if inst, ok := gen.instance(fun, tparams, chosen); ok {
+			insts = append(insts, inst)
+		}
+		// advance to the next combination of free type arguments
+		i := len(idx) - 1
+		for i >= 0 {
+			if idx[i]++; idx[i] < len(candidates[i]) {
+				break
+			}
+			idx[i] = 0
+			i--
+		}
+		if i < 0 {
+			break
+		}
+	}
+	return insts
+}
+
+// complete the type arguments chosen for the free type parameters of fun,
+// and return the resulting instance
+func (gen *genimport) instance(fun *types.Func, tparams *types.TypeParamList, chosen map[*types.TypeParam]types.Type) (instance, bool) {
+	n := tparams.Len()
+	for progress := true; progress && len(chosen) < n; {
+		progress = false
+		for i := 0; i < n; i++ {
+			tparam := tparams.At(i)
+			if chosen[tparam] != nil {
+				continue
+			}
+			if t := substTypeParams(coreTerm(tparam), chosen); t != nil {
+				chosen[tparam] = t
+				progress = true
+			}
+		}
+	}
+	if len(chosen) < n {
+		return instance{}, false
+	}
+	list := make([]types.Type, n)
+	for i := range list {
+		list[i] = chosen[tparams.At(i)]
+		if !gen.typeImported(list[i]) {
+			return instance{}, false
+		}
+	}
+	if _, err := types.Instantiate(nil, fun.Type(), list, true); err != nil {
+		return instance{}, false
+	}
+	name := fun.Name()
+	var keys []string
+	// as Go, also accept the shorter lists of type arguments that allow inferring the others
+	for k := 1; k <= n; k++ {
+		if k == n || inferable(tparams, k) {
+			keys = append(keys, name+reflectTypeList(list[:k]))
+		}
+	}
+	return instance{targs: gen.typeList(list), keys: keys}, true
+}
+
+// return the single term of tparam constraint, as ~[]E or ~map[K]V,
+// or nil if the constraint is not a single term
+func coreTerm(tparam *types.TypeParam) types.Type {
+	iface, ok := tparam.Constraint().Underlying().(*types.Interface)
+	if !ok || iface.NumMethods() != 0 || iface.NumEmbeddeds() != 1 {
+		return nil
+	}
+	union, ok := iface.EmbeddedType(0).(*types.Union)
+	if !ok || union.Len() != 1 {
+		return nil
+	}
+	return union.Term(0).Type()
+}
+
+// return true if the type parameters after the first k can be inferred from the first k
+// by constraint type inference, i.e. by unifying each type parameter with its single term
+func inferable(tparams *types.TypeParamList, k int) bool {
+	n := tparams.Len()
+	known := make(map[*types.TypeParam]bool, n)
+	for i := 0; i < k; i++ {
+		known[tparams.At(i)] = true
+	}
+	for progress := true; progress && len(known) < n; {
+		progress = false
+		for i := 0; i < n; i++ {
+			tparam := tparams.At(i)
+			term := coreTerm(tparam)
+			if term == nil {
+				continue
+			}
+			inner := collectTypeParams(term)
+			if known[tparam] {
+				// unifying a known type with its single term infers the type parameters inside the term
+				for _, t := range inner {
+					if !known[t] {
+						known[t] = true
+						progress = true
+					}
+				}
+			} else if allKnown(inner, known) {
+				// a single term whose type parameters are all known infers the type parameter
+				known[tparam] = true
+				progress = true
+			}
+		}
+	}
+	return len(known) == n
+}
+
+func allKnown(list []*types.TypeParam, known map[*types.TypeParam]bool) bool {
+	for _, t := range list {
+		if !known[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// return the type parameters inside t
+func collectTypeParams(t types.Type) []*types.TypeParam {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return []*types.TypeParam{t}
+	case *types.Pointer:
+		return collectTypeParams(t.Elem())
+	case *types.Slice:
+		return collectTypeParams(t.Elem())
+	case *types.Array:
+		return collectTypeParams(t.Elem())
+	case *types.Chan:
+		return collectTypeParams(t.Elem())
+	case *types.Map:
+		return append(collectTypeParams(t.Key()), collectTypeParams(t.Elem())...)
+	}
+	return nil
+}
+
+// return true if t satisfies constraint.
+// Only supports the constraints that commonTypeArgs can satisfy:
+// any, comparable, and unions of types without methods
+func satisfies(t types.Type, constraint types.Type) bool {
+	if types.Identical(constraint, comparableType) {
+		return types.Comparable(t)
+	}
+	iface, ok := constraint.Underlying().(*types.Interface)
+	if !ok || iface.NumMethods() != 0 {
+		return false
+	}
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		switch embedded := iface.EmbeddedType(i).(type) {
+		case *types.Union:
+			found := false
+			for j := 0; j < embedded.Len() && !found; j++ {
+				term := embedded.Term(j)
+				if term.Tilde() {
+					found = types.Identical(t.Underlying(), term.Type().Underlying())
+				} else {
+					found = types.Identical(t, term.Type())
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			if !satisfies(t, embedded) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// return the type arguments list formatted as reflect.Type.String() does, including the brackets.
+// The interpreter formats explicit type arguments in the same way to find the instantiation
+func reflectTypeList(list []types.Type) string {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, t := range list {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		writeReflectType(&buf, t)
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
+
+func writeReflectType(buf *bytes.Buffer, t types.Type) {
+	switch t := t.(type) {
+	case *types.Basic:
+		// byte and rune are aliases, reflect shows uint8 and int32
+		buf.WriteString(types.Typ[t.Kind()].Name())
+	case *types.Interface:
+		if t.Empty() {
+			buf.WriteString("interface {}")
+		} else {
+			buf.WriteString(t.String())
+		}
+	case *types.Pointer:
+		buf.WriteByte('*')
+		writeReflectType(buf, t.Elem())
+	case *types.Slice:
+		buf.WriteString("[]")
+		writeReflectType(buf, t.Elem())
+	case *types.Array:
+		fmt.Fprintf(buf, "[%d]", t.Len())
+		writeReflectType(buf, t.Elem())
+	case *types.Chan:
+		switch t.Dir() {
+		case types.SendRecv:
+			buf.WriteString("chan ")
+		case types.SendOnly:
+			buf.WriteString("chan<- ")
+		case types.RecvOnly:
+			buf.WriteString("<-chan ")
+		}
+		writeReflectType(buf, t.Elem())
+	case *types.Map:
+		buf.WriteString("map[")
+		writeReflectType(buf, t.Key())
+		buf.WriteByte(']')
+		writeReflectType(buf, t.Elem())
+	case *types.Named:
+		if pkg := t.Obj().Pkg(); pkg != nil {
+			buf.WriteString(pkg.Name())
+			buf.WriteByte('.')
+		}
+		buf.WriteString(t.Obj().Name())
+	default:
+		buf.WriteString(t.String())
+	}
+}
+
+var (
+	emptyInterface = types.NewInterfaceType(nil, nil).Complete()
+	comparableType = types.Universe.Lookup("comparable").Type()
+)
+
+// return the type argument to use for tparam, or nil if it cannot be chosen (yet)
+func chooseTypeArg(tparam *types.TypeParam, chosen map[*types.TypeParam]types.Type) types.Type {
+	constraint := tparam.Constraint()
+	if types.Identical(constraint, comparableType) {
+		return emptyInterface
+	}
+	iface, ok := constraint.Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+	if iface.IsMethodSet() {
+		if iface.NumMethods() == 0 {
+			return emptyInterface
+		}
+		return substTypeParams(constraint, chosen)
+	}
+	if iface.NumMethods() != 0 || iface.NumEmbeddeds() != 1 {
+		return nil
+	}
+	union, ok := iface.EmbeddedType(0).(*types.Union)
+	if !ok || union.Len() != 1 {
+		return nil
+	}
+	return substTypeParams(union.Term(0).Type(), chosen)
+}
+
+// replace the type parameters inside t with the chosen type arguments.
+// return nil if some type parameter is not chosen yet,
+// or if t contains types that we do not know how to rebuild
+func substTypeParams(t types.Type, chosen map[*types.TypeParam]types.Type) types.Type {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t
+	case *types.TypeParam:
+		return chosen[t]
+	case *types.Named:
+		if t.TypeArgs().Len() != 0 {
+			return nil
+		}
+		return t
+	case *types.Interface:
+		if t.NumMethods() == 0 && t.NumEmbeddeds() == 0 {
+			return t
+		}
+		return nil
+	case *types.Pointer:
+		if elem := substTypeParams(t.Elem(), chosen); elem != nil {
+			return types.NewPointer(elem)
+		}
+	case *types.Slice:
+		if elem := substTypeParams(t.Elem(), chosen); elem != nil {
+			return types.NewSlice(elem)
+		}
+	case *types.Array:
+		if elem := substTypeParams(t.Elem(), chosen); elem != nil {
+			return types.NewArray(elem, t.Len())
+		}
+	case *types.Chan:
+		if elem := substTypeParams(t.Elem(), chosen); elem != nil {
+			return types.NewChan(t.Dir(), elem)
+		}
+	case *types.Map:
+		key := substTypeParams(t.Key(), chosen)
+		elem := substTypeParams(t.Elem(), chosen)
+		if key != nil && elem != nil {
+			return types.NewMap(key, elem)
+		}
+	}
+	return nil
+}
+
+// return true if all the named types inside t are predeclared
+// or declared in the package we are generating the import file for:
+// the generated file does not import other packages for type arguments
+func (gen *genimport) typeImported(t types.Type) bool {
+	ok := true
+	traverseType(gen.output, "", t, func(t types.Type) bool {
+		if t, isNamed := t.(*types.Named); isNamed {
+			if pkg := t.Obj().Pkg(); pkg != nil && pkg.Path() != gen.path {
+				ok = false
+			}
+			return false
+		}
+		return ok
+	})
+	return ok
+}
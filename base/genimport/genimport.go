@@ -22,6 +22,7 @@ import (
 	"go/constant"
 	"go/types"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -43,11 +44,27 @@ type genimport struct {
 	name, name_ string
 	proxyprefix string
 	reflect     string
+	filepkg     string // package of the generated file in ImEmbed mode, "main" if empty
 }
 
-func writeImportFile(o *Output, out *bytes.Buffer, path string, gpkg *types.Package, mode ImportMode) (isEmpty bool) {
+// GenerateImportFile returns the Go source file that allows interpreted code to import pkgpath,
+// as written by import _b, import _i or the plugin mechanism depending on mode:
+// pkg is the type-checked package, as returned by Importer.Load.
+// If only is not empty, the file contains bindings only for the package-level declarations it lists.
+// The output is deterministic: it only depends on pkg, only and mode.
+// Returns the empty string if the package exports no constants, functions, types or variables
+func GenerateImportFile(o *Output, pkgpath string, pkg *types.Package, only []string, mode ImportMode) string {
+	var buf bytes.Buffer
+	if writeImportFile(o, &buf, pkgpath, pkg, only, mode) {
+		return ""
+	}
+	return buf.String()
+}
+
+// if only is not empty, write bindings only for the package-level declarations it lists
+func writeImportFile(o *Output, out *bytes.Buffer, path string, gpkg *types.Package, only []string, mode ImportMode) (isEmpty bool) {
 
-	gen := newGenImport(o, out, path, gpkg, mode)
+	gen := newGenImport(o, out, path, gpkg, only, mode)
 	if gen == nil {
 		return true
 	}
@@ -55,9 +72,26 @@ func writeImportFile(o *Output, out *bytes.Buffer, path string, gpkg *types.Pack
 	return false
 }
 
-func newGenImport(o *Output, out *bytes.Buffer, path string, gpkg *types.Package, mode ImportMode) *genimport {
+// GenerateEmbedFile returns the Go source file, in package filepkg of the application that embeds gomacro,
+// whose init() registers pkgpath with imports.Register: see ImEmbed.
+// Returns the empty string if the package exports no constants, functions, types or variables
+func GenerateEmbedFile(o *Output, pkgpath string, pkg *types.Package, only []string, filepkg string) string {
+	var buf bytes.Buffer
+	gen := newGenImport(o, &buf, pkgpath, pkg, only, ImEmbed)
+	if gen == nil {
+		return ""
+	}
+	gen.filepkg = filepkg
+	gen.write()
+	return buf.String()
+}
+
+func newGenImport(o *Output, out *bytes.Buffer, path string, gpkg *types.Package, only []string, mode ImportMode) *genimport {
 	scope := gpkg.Scope()
 	names := scope.Names()
+	if len(only) != 0 {
+		names = filterNames(o, path, scope, only)
+	}
 
 	isEmpty := true
 	for _, name := range names {
@@ -75,8 +109,10 @@ func newGenImport(o *Output, out *bytes.Buffer, path string, gpkg *types.Package
 
 	gen := &genimport{output: o, mode: mode, gpkg: gpkg, scope: scope, names: names, out: out, path: path}
 
-	if mode == ImInception {
+	if mode == ImInception || mode == ImEmbed {
 		gen.reflect = "r."
+	}
+	if mode == ImInception {
 		gen.name = gpkg.Name()
 	}
 	if mode == ImPlugin {
@@ -87,6 +123,21 @@ func newGenImport(o *Output, out *bytes.Buffer, path string, gpkg *types.Package
 	return gen
 }
 
+// return the sorted subset of names that are declared in scope.
+// warn about the missing ones
+func filterNames(o *Output, path string, scope *types.Scope, names []string) []string {
+	ret := make([]string, 0, len(names))
+	for _, name := range names {
+		if scope.Lookup(name) == nil {
+			o.Warnf("package %q does not declare %q, ignoring it", path, name)
+		} else {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 func (gen *genimport) write() {
 
 	gen.writePreamble()
@@ -97,10 +148,33 @@ func (gen *genimport) write() {
 	gen.writeUntypeds()
 	gen.writeWrappers()
 
-	gen.out.WriteString("\n\t}\n}\n")
+	if gen.mode == ImEmbed {
+		gen.out.WriteString("\n\t})\n}\n")
+	} else {
+		gen.out.WriteString("\n\t}\n}\n")
+	}
 	gen.writeInterfaceProxies()
 }
 
+// return the type arguments needed to use obj in the generated file:
+// an empty string if obj is not generic.
+// return ok == false if obj is an interface usable only as type constraint.
+// return ok == false if obj is generic and cannot be instantiated, and also warn if requested
+func (gen *genimport) typeArgs(obj types.Object, warn bool) (targs string, ok bool) {
+	if isConstraint(obj) {
+		// only usable as a type constraint, skip it
+		return "", false
+	}
+	if !isGeneric(obj) {
+		return "", true
+	}
+	targs, ok = gen.instantiate(obj)
+	if !ok && warn {
+		gen.output.Warnf("package %q: cannot instantiate generic %s, ignoring it", gen.path, obj.Name())
+	}
+	return targs, ok
+}
+
 type mapdecl struct {
 	out  *bytes.Buffer
 	head string
@@ -140,7 +214,7 @@ func (d *mapdecl) footer1(comma bool) {
 }
 
 func (gen *genimport) collectPackageImportsWithRename(requireAllInterfaceMethodsExported bool) {
-	gen.pkgrenames = collectPackageImportsWithRename(gen.output, gen.gpkg, requireAllInterfaceMethodsExported)
+	gen.pkgrenames = collectPackageImportsWithRename(gen.output, gen.gpkg, gen.names, requireAllInterfaceMethodsExported, gen.mode == ImInception)
 	gen.name = gen.pkgrenames[gen.path]
 	if gen.name == "" {
 		gen.name = packageSanitizedName(gen.path)
@@ -154,6 +228,7 @@ func (gen *genimport) writePreamble() {
 	mode := gen.mode
 	out := gen.out
 
+	command := "import "
 	var alias, filepkg string
 	switch mode {
 	case ImBuiltin:
@@ -166,29 +241,41 @@ func (gen *genimport) writePreamble() {
 	case ImInception:
 		alias = "_i "
 		filepkg = gen.name
+	case ImEmbed:
+		command = "gomacro gen --embed "
+		filepkg = gen.filepkg
+		if len(filepkg) == 0 {
+			filepkg = "main"
+		}
 	}
 
-	fmt.Fprintf(gen.out, `// this file was generated by gomacro command: import %s%q
+	fmt.Fprintf(gen.out, `// this file was generated by gomacro command: %s%s%q
 // DO NOT EDIT! Any change will be lost when the file is re-generated
 
 package %s
 
-import (`, alias, gen.path, filepkg)
+import (`, command, alias, gen.path, filepkg)
 
 	var imports string
-	if mode == ImInception {
+	if mode == ImInception || mode == ImEmbed {
 		fmt.Fprintf(gen.out, "\n\tr \"reflect\"\n\t\"github.com/cosmos72/gomacro/imports\"")
 		imports = "imports."
 	} else {
 		fmt.Fprintf(out, "\n\t. \"reflect\"")
 	}
 	gen.collectPackageImportsWithRename(true)
-	for path, name := range gen.pkgrenames {
+	// iterate on sorted paths: map iteration order is random, and the output must be deterministic
+	pathlist := make([]string, 0, len(gen.pkgrenames))
+	for path := range gen.pkgrenames {
+		pathlist = append(pathlist, path)
+	}
+	sort.Strings(pathlist)
+	for _, path := range pathlist {
 		if mode == ImInception && path == gen.path {
 			continue // writing inside the package: it should not import itself
 		} else {
 			// always name the imported package: its name may differ from paths.FileName(path)
-			fmt.Fprintf(out, "\n\t%s %q", name, path)
+			fmt.Fprintf(out, "\n\t%s %q", gen.pkgrenames[path], path)
 		}
 	}
 	fmt.Fprintf(out, "\n)\n")
@@ -216,6 +303,15 @@ func main() {
 `)
 	}
 
+	if mode == ImEmbed {
+		fmt.Fprintf(out, `
+// reflection: allow interpreted code to import %q
+func init() {
+	imports.Register(%q, imports.Package{
+	Name: %q,
+	`, gen.path, gen.path, gen.gpkg.Name())
+		return
+	}
 	fmt.Fprintf(out, `
 // reflection: allow interpreted code to import %q
 func init() {
@@ -247,8 +343,26 @@ func (gen *genimport) writeBinds() {
 				d.header()
 				fmt.Fprintf(gen.out, "\n\t\t%q:\t%sValueOf(&%s%s).Elem(),", name, gen.reflect, gen.name_, name)
 			case *types.Func:
+				// explicit instantiations, as Sort[int]
+				instances := gen.instances(obj)
+				for _, inst := range instances {
+					for _, key := range inst.keys {
+						d.header()
+						fmt.Fprintf(gen.out, "\n\t\t%q:\t%sValueOf(%s%s%s),", key, gen.reflect, gen.name_, name, inst.targs)
+					}
+				}
+				targs, ok := gen.typeArgs(obj, len(instances) == 0)
+				if !ok {
+					continue
+				}
 				d.header()
-				fmt.Fprintf(gen.out, "\n\t\t%q:\t%sValueOf(%s%s),", name, gen.reflect, gen.name_, name)
+				fmt.Fprintf(gen.out, "\n\t\t%q:\t%sValueOf(%s%s%s),", name, gen.reflect, gen.name_, name, targs)
+			case *types.TypeName:
+				if gen.sealedInterface(name) != nil {
+					adapt := sealedAdaptName(name)
+					d.header()
+					fmt.Fprintf(gen.out, "\n\t\t%q:\t%sValueOf(%s),", adapt, gen.reflect, adapt)
+				}
 			}
 		}
 	}
@@ -262,11 +376,23 @@ func (gen *genimport) writeTypes() {
 		if obj := gen.scope.Lookup(name); obj.Exported() {
 			switch obj.(type) {
 			case *types.TypeName:
+				targs, ok := gen.typeArgs(obj, true)
+				if !ok {
+					continue
+				}
 				d.header()
-				fmt.Fprintf(gen.out, "\n\t\t%q:\t%sTypeOf((*%s%s)(nil)).Elem(),", name, gen.reflect, gen.name_, name)
+				fmt.Fprintf(gen.out, "\n\t\t%q:\t%sTypeOf((*%s%s%s)(nil)).Elem(),", name, gen.reflect, gen.name_, name, targs)
+				if gen.sealedInterface(name) != nil {
+					shim := sealedShimName(name)
+					fmt.Fprintf(gen.out, "\n\t\t%q:\t%sTypeOf((*%s)(nil)).Elem(),", shim, gen.reflect, shim)
+				}
 			}
 		}
 	}
+	for _, opaque := range gen.opaqueTypes() {
+		d.header()
+		fmt.Fprintf(gen.out, "\n\t\t%q:\t%s,", opaqueTypeName(opaque.name), opaque.expr)
+	}
 	d.footer()
 }
 
@@ -278,6 +404,10 @@ func (gen *genimport) writeProxies() {
 			if t := extractInterface(obj, true); t != nil {
 				d.header()
 				fmt.Fprintf(gen.out, "\n\t\t%q:\t%sTypeOf((*%s%s)(nil)).Elem(),", name, gen.reflect, gen.proxyprefix, name)
+			} else if gen.sealedInterface(name) != nil {
+				shim := sealedShimName(name)
+				d.header()
+				fmt.Fprintf(gen.out, "\n\t\t%q:\t%sTypeOf((*%s%s)(nil)).Elem(),", shim, gen.reflect, gen.proxyprefix, shim)
 			}
 		}
 	}
@@ -313,7 +443,7 @@ func (gen *genimport) writeWrappers() {
 		if obj := gen.scope.Lookup(name); obj.Exported() {
 			switch obj.(type) {
 			case *types.TypeName:
-				if t, ok := obj.Type().(*types.Named); ok {
+				if t, ok := obj.Type().(*types.Named); ok && !isGeneric(obj) {
 					// only structs can have embedded fields, and thus wrapper methods for embedded fields
 					if _, ok := t.Underlying().(*types.Struct); ok {
 						wrappers := new(analyzer).Analyze(t)
@@ -340,6 +470,8 @@ func (gen *genimport) writeInterfaceProxies() {
 		obj := gen.scope.Lookup(name)
 		if t := extractInterface(obj, true); t != nil {
 			gen.writeInterfaceProxy(path, name, t)
+		} else if t := gen.sealedInterface(name); t != nil {
+			gen.writeSealedShims(path, name, t)
 		}
 	}
 }
@@ -0,0 +1,127 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * gocmd.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// MaxGoCmdAttempts is the maximum number of times a go command is executed
+// if it keeps failing with transient errors, as the network errors reported by "go get" on network blips
+var MaxGoCmdAttempts = 3
+
+// delay before the first retry of a go command. Doubled at each further retry
+var goCmdRetryDelay = time.Second
+
+// error messages printed by the go toolchain that indicate a transient failure,
+// usually a network problem while downloading modules
+var transientErrors = []string{
+	"connection refused",
+	"connection reset",
+	"context deadline exceeded",
+	"i/o timeout",
+	"network is unreachable",
+	"server misbehaving",
+	"temporary failure in name resolution",
+	"tls handshake timeout",
+	"unexpected eof",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// isTransientError returns true if msg contains one of the transientErrors
+func isTransientError(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, s := range transientErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// injectFault, if not nil, is invoked before each attempt to execute a go command,
+// with the command arguments. If it returns a non-nil error, the command is not executed
+// and fails with such error. Used by tests to simulate network blips and toolchain failures
+var injectFault func(args []string) error
+
+// runGoCmd executes "go args..." in directory dir with environment env,
+// copying its output to o.Stdout and o.Stderr.
+// If the command fails with a transient error, it is retried up to MaxGoCmdAttempts times in total
+func runGoCmd(o *Output, dir string, env []string, args ...string) error {
+	gocmd := chooseGoCmd()
+	delay := goCmdRetryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		var errbuf bytes.Buffer
+		if err = injectedFault(args); err != nil {
+			errbuf.WriteString(err.Error())
+		} else {
+			cmd := exec.Command(gocmd, args...)
+			cmd.Dir = dir
+			cmd.Env = env
+			cmd.Stdin = nil
+			cmd.Stdout = o.Stdout
+			cmd.Stderr = &errbuf
+			if o.Stderr != nil {
+				cmd.Stderr = io.MultiWriter(o.Stderr, &errbuf)
+			}
+			if err = cmd.Run(); err == nil {
+				return nil
+			}
+		}
+		if attempt >= MaxGoCmdAttempts || !isTransientError(errbuf.String()) {
+			break
+		}
+		o.Warnf("\"go %s\" failed with a transient error, retrying in %v (attempt %d of %d)",
+			strings.Join(args, " "), delay, attempt+1, MaxGoCmdAttempts)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return fmt.Errorf("error executing \"%s %s\" in directory %q: %v", gocmd, strings.Join(args, " "), dir, err)
+}
+
+// retryTransient invokes fun until it succeeds, fails with a non-transient error,
+// or fails MaxGoCmdAttempts times. Used for go commands executed by other packages,
+// as "go list" executed by packages.Load()
+func retryTransient(o *Output, what string, fun func() error) error {
+	delay := goCmdRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := fun()
+		if err == nil || attempt >= MaxGoCmdAttempts || !isTransientError(err.Error()) {
+			return err
+		}
+		o.Warnf("%s failed with a transient error, retrying in %v (attempt %d of %d): %v",
+			what, delay, attempt+1, MaxGoCmdAttempts, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// return the fault injected before executing "go args...", if any
+func injectedFault(args []string) error {
+	if injectFault == nil {
+		return nil
+	}
+	return injectFault(args)
+}
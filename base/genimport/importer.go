@@ -17,7 +17,6 @@
 package genimport
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -29,7 +28,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	r "reflect"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cosmos72/gomacro/base/output"
 	"github.com/cosmos72/gomacro/base/paths"
@@ -64,6 +66,13 @@ const (
 	// 2. invoke "go build -buildmode=plugin" on the file to create a shared library
 	// 3. load such shared library with plugin.Open().Lookup("Packages")
 	ImPlugin
+
+	// ImEmbed import mechanism is:
+	// 1. write a file x_embed_$PKGPATH.go *inside* the application that embeds gomacro,
+	//    containing a single func init() that calls imports.Register
+	// 2. the application is compiled with the file, and interpreters created by it
+	//    can import $PKGPATH without the go toolchain. See Importer.EmbedPackage
+	ImEmbed
 )
 
 type PackageRef struct {
@@ -84,15 +93,93 @@ type Importer struct {
 	mode       types.ImportMode
 	PluginOpen r.Value // = reflect.ValueOf(plugin.Open)
 	output     *Output
+	only       map[string][]string // map[pkgpath]names of symbols to bind
+	local      map[string]modInfo  // map[module path]local module, see LocalImport()
+	visible    map[string]bool     // internal packages imported with a relative path, see LocalImport()
+	allow      func(string) bool   // if not nil, returns false for packages that cannot be imported
+	dirs       map[string][]string // map[pkgpath]source directories, found by Load(). see savePluginCache()
+	registry   *imports.Registry   // packages already imported, see SetRegistry()
+	require    map[string]string   // map[module path]version, see Require()
+	timings    map[string]*ImportTiming
+	lock       sync.Mutex // serializes accesses to PluginOpen, local, dirs, require and timings
+	notool     bool       // if true, never execute the go toolchain nor load plugins, see SetToolchain()
+
+	// Hook, if not nil, is invoked before resolving each import not rejected by SetImportFilter.
+	// If it returns a non-nil err, the import fails with such error.
+	// Otherwise, if it returns allow == false, the import is not allowed.
+	// Otherwise, if it returns a non-empty substitute, the package at path substitute
+	// is imported instead, as if it was at pkgpath: useful to redirect imports
+	// to bindings already present in imports.Packages, or to supply mock packages in tests.
+	// It may be invoked concurrently, see ImportPackagesOrError
+	Hook func(pkgpath string) (allow bool, substitute string, err error)
 }
 
 func DefaultImporter(o *Output) *Importer {
-	return &Importer{output: o}
+	return &Importer{output: o, registry: imports.NewRegistry()}
+}
+
+// SetRegistry sets where the Importer looks up the packages already imported
+// and stores the packages it imports. Interpreters set it to the registry of their xreflect.Universe
+func (imp *Importer) SetRegistry(registry *imports.Registry) {
+	imp.registry = registry
+}
+
+// Registry returns where the Importer looks up and stores imported packages
+func (imp *Importer) Registry() *imports.Registry {
+	return imp.registry
+}
+
+// SetImportOnly restricts the bindings generated when importing pkgpath
+// to the package-level declarations listed in names:
+// useful to reduce the size and compile time of the plugin for huge packages.
+// Calling it without names removes the restriction.
+// It has no effect on packages already imported.
+func (imp *Importer) SetImportOnly(pkgpath string, names ...string) {
+	if len(names) == 0 {
+		delete(imp.only, pkgpath)
+		return
+	}
+	if imp.only == nil {
+		imp.only = make(map[string][]string)
+	}
+	imp.only[pkgpath] = names
+}
+
+// SetImportFilter restricts the packages that can be imported
+// to the ones for which allow(pkgpath) returns true.
+// Importing any other package fails, even if it was already imported by a different Importer:
+// useful to run untrusted code. Use nil to remove the restriction.
+func (imp *Importer) SetImportFilter(allow func(pkgpath string) bool) {
+	imp.allow = allow
+}
+
+// SetToolchain enables or disables the go toolchain and plugins.
+// If disabled, only the packages compiled into the application can be imported,
+// as the ones registered with imports.Register by files written by EmbedPackage:
+// importing any other package fails instead of executing "go list" and "go build".
+// Useful to embedders that ship their allowed package set inside their binary.
+func (imp *Importer) SetToolchain(enable bool) {
+	imp.notool = !enable
+}
+
+func (imp *Importer) checkAllowed(pkgpath string) error {
+	if imp.allow != nil && !imp.allow(pkgpath) {
+		return imp.output.MakeRuntimeError("import %q not allowed", pkgpath)
+	}
+	return nil
+}
+
+// IsLoaded returns true if package pkgpath is already linked into gomacro
+// or was already loaded from a plugin, i.e. importing it is fast
+func (imp *Importer) IsLoaded(pkgpath string) bool {
+	_, found := imp.registry.Lookup(pkgpath)
+	return found
 }
 
 func (imp *Importer) havePluginOpen() bool {
 	if !imp.PluginOpen.IsValid() {
-		imp.PluginOpen = imports.Packages["plugin"].Binds["Open"]
+		pkg, _ := imp.registry.Lookup("plugin")
+		imp.PluginOpen = pkg.Binds["Open"]
 		if !imp.PluginOpen.IsValid() {
 			imp.PluginOpen = reflect.NoneR // cache the failure
 		}
@@ -100,8 +187,10 @@ func (imp *Importer) havePluginOpen() bool {
 	return imp.PluginOpen != reflect.NoneR
 }
 
-// LookupPackage returns a package if already present in cache
+// LookupPackage returns a package if already present in the global imports.Packages
 func LookupPackage(alias, path string) *PackageRef {
+	imports.PackagesLock.Lock()
+	defer imports.PackagesLock.Unlock()
 	pkg, found := imports.Packages[path]
 	if !found {
 		return nil
@@ -111,10 +200,16 @@ func LookupPackage(alias, path string) *PackageRef {
 		pkg.DefaultName(path)
 		imports.Packages[path] = pkg
 	}
-	if len(alias) == 0 {
-		// import "foo" => get alias from package name
-		alias = pkg.DefaultName(path)
+	return &PackageRef{Package: pkg, Path: path}
+}
+
+// lookupPackage returns a package if already present in the registry of imp
+func (imp *Importer) lookupPackage(path string) *PackageRef {
+	pkg, found := imp.registry.Lookup(path)
+	if !found {
+		return nil
 	}
+	pkg.DefaultName(path) // initialize pkg.Name if missing
 	return &PackageRef{Package: pkg, Path: path}
 }
 
@@ -139,15 +234,62 @@ func (imp *Importer) ImportPackage(alias, path string, enableModule bool) *Packa
 }
 
 func (imp *Importer) ImportPackageOrError(alias, pkgpath string, enableModule bool) (*PackageRef, error) {
+	if err := imp.checkAllowed(pkgpath); err != nil {
+		return nil, err
+	}
+	if imp.Hook == nil {
+		return imp.importPackageOrError(alias, pkgpath, enableModule)
+	}
+	allow, substitute, err := imp.Hook(pkgpath)
+	if err != nil {
+		return nil, err
+	} else if !allow {
+		return nil, imp.output.MakeRuntimeError("import %q not allowed", pkgpath)
+	} else if len(substitute) == 0 || substitute == pkgpath {
+		return imp.importPackageOrError(alias, pkgpath, enableModule)
+	}
+	ref, err := imp.importPackageOrError(alias, substitute, enableModule)
+	if err != nil {
+		return nil, err
+	}
+	return &PackageRef{Package: ref.Package, Path: pkgpath}, nil
+}
 
-	ref := LookupPackage(alias, pkgpath)
+func (imp *Importer) importPackageOrError(alias, pkgpath string, enableModule bool) (*PackageRef, error) {
+	ref := imp.lookupPackage(pkgpath)
 	if ref != nil {
+		imp.setImportTiming(pkgpath, nil)
 		return ref, nil
+	} else if imp.notool {
+		return nil, imp.output.MakeRuntimeError(
+			"import %q: package is not compiled into the application, and the go toolchain is disabled", pkgpath)
 	}
 	paths.GetImportsSrcDir() // warns if GOPATH or paths.ImportsDir may be wrong
 
+	timing := newImportTiming(pkgpath)
+	start := timing.lastStage
+	defer func() {
+		timing.Total = time.Since(start)
+		imp.setImportTiming(pkgpath, timing)
+	}()
+
+	switch alias {
+	case "_b", "_i", "_3":
+	default:
+		// skip "go list" and "go build" if the plugin was already compiled, even by another process
+		if ref = imp.importCachedPlugin(pkgpath, enableModule); ref != nil {
+			timing.Cached = true
+			timing.endStage(&timing.Open)
+			return ref, nil
+		}
+		timing.lastStage = time.Now()
+	}
 	o := imp.output
-	gpkg, err := imp.Load(pkgpath, enableModule) // loads names and types, not the values!
+	// create go.mod, the import file and the plugin in a temporary directory,
+	// and move them to the plugin directory only if the import succeeds
+	tx := beginImportTx(o, computeImportDir(o, pkgpath, ImPlugin))
+	defer tx.rollback()
+	gpkg, err := imp.load(pkgpath, enableModule, tx.tmp, timing) // loads names and types, not the values!
 	if err != nil {
 		return nil, imp.wrapImportError(pkgpath, enableModule, err)
 	}
@@ -163,55 +305,123 @@ func (imp *Importer) ImportPackageOrError(alias, pkgpath string, enableModule bo
 		if len(alias) == 0 {
 			alias = gpkg.Name()
 		}
-		if imp.havePluginOpen() {
+		imp.lock.Lock()
+		havePluginOpen := imp.havePluginOpen()
+		imp.lock.Unlock()
+		if havePluginOpen {
 			mode = ImPlugin
 		} else {
 			mode = ImThirdParty
 		}
 	}
-	file := createImportFile(imp.output, pkgpath, gpkg, mode, enableModule)
+	file := createImportFile(imp.output, pkgpath, gpkg, imp.only[pkgpath], mode, enableModule, tx.tmp, timing)
 	ref = &PackageRef{Path: pkgpath}
 	if len(file) == 0 || mode != ImPlugin {
 		// either the package exports nothing, or user must rebuild gomacro.
 		// in both cases, still cache it to avoid recreating the file.
-		imports.Packages[pkgpath] = ref.Package
+		tx.commit(o)
+		imp.registry.Store(pkgpath, ref.Package)
 		return ref, nil
 	}
-	soname := compilePlugin(o, file, enableModule, o.Stdout, o.Stderr)
-	ipkgs := imp.loadPluginSymbol(soname, "Packages")
-	pkgs := *ipkgs.(*map[string]imports.PackageUnderlying)
+	soname := compilePlugin(o, file, enableModule)
+	timing.endStage(&timing.Build)
+	tx.commit(o)
+	soname = tx.finalPath(soname)
 
-	// cache *all* packages found for future use
-	imports.Packages.Merge(pkgs)
-
-	// but return only requested one
-	pkg, found := imports.Packages[pkgpath]
-	if !found {
-		return nil, imp.output.MakeRuntimeError(
-			"error loading package %q: the compiled plugin %q does not contain it! internal error? %v",
-			pkgpath, soname)
+	pkg, err := imp.loadPluginPackage(soname, pkgpath)
+	if err != nil {
+		return nil, err
 	}
+	timing.endStage(&timing.Open)
+	imp.savePluginCache(pkgpath, soname, enableModule)
+	imp.limitImportsSize(pkgpath)
 	ref.Package = pkg
 	return ref, nil
 }
 
-func createImportFile(o *Output, pkgpath string, pkg *types.Package, mode ImportMode, enableModule bool) string {
-	dir := computeImportDir(o, pkgpath, mode)
-	if mode == ImPlugin {
-		createDir(o, dir)
-		removeAllFilesInDirExcept(o, dir, []string{"go.mod", "go.sum"})
+// ImportPackagesOrError imports multiple packages concurrently:
+// loading, generating and compiling independent packages is slow, so doing it in parallel
+// can save a lot of time. At most runtime.GOMAXPROCS(0) packages are imported at the same time.
+// aliases and pkgpaths must have the same length and pkgpaths must not contain duplicates.
+// Returns the imported packages and the errors in the same order as pkgpaths.
+func (imp *Importer) ImportPackagesOrError(aliases, pkgpaths []string, enableModule bool) ([]*PackageRef, []error) {
+	return imp.importPackagesOrError(aliases, pkgpaths, enableModule, nil)
+}
+
+// ImportProgress is invoked by Prewarm each time a package has been imported or failed to import.
+// done is the number of packages processed so far, out of total.
+// Invocations are serialized, thus it does not need to be safe for concurrent use
+type ImportProgress func(pkgpath string, done, total int, err error)
+
+// Prewarm imports multiple packages concurrently, as ImportPackagesOrError does,
+// without declaring them anywhere: later imports of the same packages will be fast.
+// Useful to load, generate and compile plugins at startup, before they are needed.
+// If progress is not nil, it is invoked each time a package has been imported or failed to import.
+// pkgpaths must not contain duplicates.
+// Returns the imported packages and the errors in the same order as pkgpaths.
+func (imp *Importer) Prewarm(pkgpaths []string, enableModule bool, progress ImportProgress) ([]*PackageRef, []error) {
+	return imp.importPackagesOrError(make([]string, len(pkgpaths)), pkgpaths, enableModule, progress)
+}
+
+func (imp *Importer) importPackagesOrError(aliases, pkgpaths []string, enableModule bool, progress ImportProgress) ([]*PackageRef, []error) {
+	n := len(pkgpaths)
+	refs := make([]*PackageRef, n)
+	errs := make([]error, n)
+	if n == 0 {
+		return refs, errs
+	}
+	paths.GetImportsSrcDir() // initialize it before starting the goroutines
+
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	var progressLock sync.Mutex
+	var done int
+	wg.Add(n)
+	for i := range pkgpaths {
+		go func(i int) {
+			sem <- struct{}{}
+			defer func() {
+				// Output.Errorf() panics: convert it to an error,
+				// otherwise it would crash the whole program
+				if rec := recover(); rec != nil {
+					if err, ok := rec.(error); ok {
+						errs[i] = err
+					} else {
+						errs[i] = imp.output.MakeRuntimeError("%v", rec)
+					}
+				}
+				<-sem
+				if progress != nil {
+					progressLock.Lock()
+					done++
+					progress(pkgpaths[i], done, n, errs[i])
+					progressLock.Unlock()
+				}
+				wg.Done()
+			}()
+			refs[i], errs[i] = imp.ImportPackageOrError(aliases[i], pkgpaths[i], enableModule)
+		}(i)
+	}
+	wg.Wait()
+	return refs, errs
+}
+
+// create the import file for pkgpath. In mode ImPlugin, create it in plugindir
+func createImportFile(o *Output, pkgpath string, pkg *types.Package, only []string, mode ImportMode, enableModule bool, plugindir string, timing *ImportTiming) string {
+	dir := plugindir
+	if mode != ImPlugin {
+		dir = computeImportDir(o, pkgpath, mode)
 	}
 	f := computeImportFilename(o, pkgpath, mode)
 	f = paths.Subdir(dir, f)
 
-	buf := bytes.Buffer{}
-	isEmpty := writeImportFile(o, &buf, pkgpath, pkg, mode)
-	if isEmpty {
+	src := GenerateImportFile(o, pkgpath, pkg, only, mode)
+	if len(src) == 0 {
 		o.Warnf("package %q exports zero constants, functions, types and variables", pkgpath)
 		return ""
 	}
 
-	err := ioutil.WriteFile(f, buf.Bytes(), os.FileMode(0o644))
+	err := writeFileAtomic(f, []byte(src), os.FileMode(0o644))
 	if err != nil {
 		o.Errorf("error writing file %q: %v", f, err)
 	}
@@ -220,7 +430,9 @@ func createImportFile(o *Output, pkgpath string, pkg *types.Package, mode Import
 		o.Warnf("created file %q, recompile gomacro to use it", f)
 	case ImInception:
 		o.Warnf("created file %q, recompile %s to use it", f, pkgpath)
-	case ImPlugin:
+	}
+	timing.endStage(&timing.Generate)
+	if mode == ImPlugin {
 		// if needed, go.mod file was created already by Importer.Load()
 		env := environForCompiler(enableModule)
 		runGoModTidyIfNeeded(o, pkgpath, dir, env)
@@ -274,9 +486,10 @@ func removeAllFilesInDirExcept(o *Output, dir string, except_list []string) {
 	}
 }
 
-func createPluginGoModFile(o *Output, pkgpath string, dir string) string {
+func (imp *Importer) createPluginGoModFile(pkgpath string, modpath string, dir string) string {
+	o := imp.output
 	file := modfile.File{}
-	err := file.AddModuleStmt("gomacro.imports/" + pkgpath)
+	err := file.AddModuleStmt(modpath)
 	if err != nil {
 		o.Errorf("error setting module in go.mod", err)
 	}
@@ -291,7 +504,16 @@ func createPluginGoModFile(o *Output, pkgpath string, dir string) string {
 
 		o.Debugf("importing %s from local %s", pkgpath, pkgModFileInfo.GoMod)
 		goModReplaceDirectives(o, pkgModFileInfo, file)
+	} else if mod, ok := imp.localModule(pkgpath); ok {
+		// relative import, see Importer.LocalImport().
+		// also require the module, since "go get" cannot resolve its version
+		o.Debugf("importing %s from local %s", pkgpath, mod.GoMod)
+		if err := file.AddRequire(mod.Path, localModuleVersion); err != nil {
+			o.Debugf("error adding require directive for %s, %v", mod.Path, err)
+		}
+		goModReplaceDirectives(o, mod, file)
 	}
+	imp.addRequirements(&file)
 
 	gomod := paths.Subdir(dir, "go.mod")
 
@@ -460,6 +682,8 @@ func computeImportFilename(o *Output, pkgpath string, mode ImportMode) string {
 		return "x_package.go"
 	case ImPlugin:
 		return sanitizeIdent(paths.FileName(pkgpath)) + ".go"
+	case ImEmbed:
+		return "x_embed_" + sanitizeIdent(pkgpath) + ".go"
 	default:
 		o.Errorf("unknown import mode: %v", mode)
 		return ""
@@ -17,12 +17,16 @@
 package genimport
 
 import (
+	"bytes"
 	"fmt"
 	"go/build"
 	"go/importer"
 	"go/types"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/tools/go/packages"
 )
@@ -30,8 +34,24 @@ import (
 const GoModuleSupported bool = true
 
 func (imp *Importer) Load(pkgpath string, enableModule bool) (p *types.Package, err error) {
+	o := imp.output
+	// the go.mod created to load pkgpath is not needed afterwards
+	tx := beginImportTx(o, computeImportDir(o, pkgpath, ImPlugin))
+	defer tx.rollback()
+	return imp.load(pkgpath, enableModule, tx.tmp, newImportTiming(pkgpath))
+}
+
+// as Load, using dir to create go.mod and also recording in timing
+// the duration of "go get", "go list" and type loading
+func (imp *Importer) load(pkgpath string, enableModule bool, dir string, timing *ImportTiming) (p *types.Package, err error) {
 	if !enableModule {
-		return importer.Default().Import(pkgpath)
+		defer timing.endStage(&timing.TypeLoad)
+		if p, err = importer.Default().Import(pkgpath); err == nil {
+			if dirs, err := buildSourceDirs(pkgpath); err == nil {
+				imp.setSourceDirs(pkgpath, dirs)
+			}
+		}
+		return p, err
 	}
 
 	defer func() {
@@ -46,27 +66,55 @@ func (imp *Importer) Load(pkgpath string, enableModule bool) (p *types.Package,
 	}()
 
 	o := imp.output
+	modpath, err := imp.pluginModulePath(pkgpath)
+	if err != nil {
+		return nil, err
+	}
+	modpath = versionedModulePath(modpath)
 	// Go >= 1.14 requires a valid go.mod file in the directory used for packages.Config.Dir
-	dir := computeImportDir(o, pkgpath, ImPlugin)
-	createDir(o, dir)
-	removeAllFilesInDir(o, dir)
-	createPluginGoModFile(o, pkgpath, dir)
+	imp.createPluginGoModFile(pkgpath, modpath, dir)
 
 	env := environForCompiler(enableModule)
 
 	// Go >= 1.16 usually requires running "go get ..." before "go list ..."
-	// to start updating go.mod
-	if err := runGoGetIfNeeded(o, pkgpath, dir, env); err != nil {
-		return nil, err
+	// to start updating go.mod. Not needed for local modules, already required in go.mod
+	if _, local := imp.localModule(pkgpath); !local {
+		if err := runGoGetIfNeeded(o, imp.goGetQuery(pkgpath), dir, env); err != nil {
+			return nil, err
+		}
 	}
+	timing.endStage(&timing.GoGet)
 
+	// packages.Load() logs the end of each go command it runs:
+	// the time after the last one is spent loading types
+	var golistEnd time.Time
+	var golistLock sync.Mutex // go commands may run concurrently
 	cfg := packages.Config{
-		Mode: packages.NeedName | packages.NeedTypes | packages.NeedImports | packages.NeedModule,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedImports | packages.NeedModule,
 		Env:  env,
 		Dir:  dir,
-		Logf: nil, // imp.output.Debugf,
+		Logf: func(format string, args ...interface{}) {
+			golistLock.Lock()
+			golistEnd = time.Now()
+			golistLock.Unlock()
+			// imp.output.Debugf(format, args...)
+		},
+	}
+	var list []*packages.Package
+	err = retryTransient(o, "\"go list "+pkgpath+"\"", func() (err error) {
+		if err = injectedFault([]string{"list", pkgpath}); err == nil {
+			list, err = packages.Load(&cfg, "pattern="+pkgpath)
+		}
+		return err
+	})
+	if golistEnd.IsZero() {
+		// nothing logged: cannot tell go commands from type loading
+		timing.endStage(&timing.GoList)
+	} else {
+		timing.GoList += golistEnd.Sub(timing.lastStage)
+		timing.lastStage = golistEnd
+		timing.endStage(&timing.TypeLoad)
 	}
-	list, err := packages.Load(&cfg, "pattern="+pkgpath)
 	if err != nil {
 		return nil, err
 	}
@@ -76,12 +124,79 @@ func (imp *Importer) Load(pkgpath string, enableModule bool) (p *types.Package,
 				err = errorList{pkg.Errors, mergeErrorMessages(pkg.Errors)}
 				return nil, err
 			}
+			// pkg.GoFiles are not enough: the plugin is stale also when a dependency changes,
+			// as a module replaced by a local directory
+			dirs, err := listSourceDirs(o, pkgpath, dir, env)
+			if err != nil {
+				o.Debugf("cannot list the source directories of package %q and its dependencies, its plugin will not be cached: %v", pkgpath, err)
+			}
+			imp.setSourceDirs(pkgpath, dirs)
 			return pkg.Types, nil
 		}
 	}
 	return nil, fmt.Errorf("packages.Load() could not find package %q", pkgpath)
 }
 
+// remember the source directories of pkgpath, needed to detect when its compiled plugin becomes stale
+func (imp *Importer) setSourceDirs(pkgpath string, dirs []string) {
+	imp.lock.Lock()
+	if imp.dirs == nil {
+		imp.dirs = make(map[string][]string)
+	}
+	imp.dirs[pkgpath] = dirs
+	imp.lock.Unlock()
+}
+
+// listSourceDirs executes "go list -deps" in directory dir with environment env
+// and returns the absolute paths of the directories of pkgpath and of all its dependencies,
+// except for the standard library ones
+func listSourceDirs(o *Output, pkgpath string, dir string, env []string) ([]string, error) {
+	const format = `{{if not .Standard}}{{.Dir}}{{end}}`
+	var buf bytes.Buffer
+	out := *o
+	out.Stdout, out.Stderr = &buf, nil
+	if err := runGoCmd(&out, dir, env, "list", "-deps", "-f", format, pkgpath); err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.TrimRight(line, "\r"); len(line) != 0 {
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs, nil
+}
+
+// buildSourceDirs returns the absolute paths of the directories of pkgpath
+// and of all its dependencies, except for the standard library ones.
+// Used when modules are disabled
+func buildSourceDirs(pkgpath string) ([]string, error) {
+	var dirs []string
+	visited := make(map[string]bool)
+	var visit func(pkgpath string, srcdir string) error
+	visit = func(pkgpath string, srcdir string) error {
+		if pkgpath == "C" || visited[pkgpath] {
+			return nil
+		}
+		visited[pkgpath] = true
+		bpkg, err := build.Default.Import(pkgpath, srcdir, 0)
+		if err != nil {
+			return err
+		} else if bpkg.Goroot {
+			return nil
+		}
+		dirs = append(dirs, bpkg.Dir)
+		for _, dep := range bpkg.Imports {
+			if err = visit(dep, bpkg.Dir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := visit(pkgpath, "")
+	return dirs, err
+}
+
 type errorList struct {
 	errors []packages.Error
 	str    string
@@ -100,9 +215,11 @@ func mergeErrorMessages(errors []packages.Error) string {
 }
 
 func environForCompiler(enableModule bool) []string {
+	// use GOOS and GOARCH of the running gomacro, ignoring $GOOS and $GOARCH:
+	// plugins compiled for a different platform cannot be loaded
 	env := append(os.Environ(),
-		"GOARCH="+build.Default.GOARCH,
-		"GOOS="+build.Default.GOOS,
+		"GOARCH="+runtime.GOARCH,
+		"GOOS="+runtime.GOOS,
 		"GOROOT="+build.Default.GOROOT)
 	if enableModule {
 		env = append(env, "GO111MODULE=on")
@@ -18,11 +18,6 @@
 
 package genimport
 
-import (
-	"fmt"
-	"os/exec"
-)
-
 // if the package and the version to import is NOT listed in go.mod,
 // Go >= 1.16 requires to run "go get pkg/to/be/imported" or "go install ..."
 // before "go list ..." in order to update go.mod
@@ -31,20 +26,7 @@ func runGoGetIfNeeded(output *Output, pkgpath string, dir string, env []string)
 
 	output.Debugf("running \"go get %s\" ...", pkgpath)
 
-	gocmd := chooseGoCmd()
-
-	cmd := exec.Command(gocmd, "get", pkgpath)
-	cmd.Dir = dir
-	cmd.Env = env
-	cmd.Stdin = nil
-	cmd.Stdout = output.Stdout
-	cmd.Stderr = output.Stderr
-
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error executing \"%s get %s\" in directory %q: %v", gocmd, pkgpath, dir, err)
-	}
-	return nil
+	return runGoCmd(output, dir, env, "get", pkgpath)
 }
 
 // Go >= 1.16 requires to run "go mod tidy" before "go build ..."
@@ -53,18 +35,5 @@ func runGoModTidyIfNeeded(output *Output, pkgpath string, dir string, env []stri
 
 	output.Debugf("running \"go mod tidy\" ...")
 
-	gocmd := chooseGoCmd()
-
-	cmd := exec.Command(gocmd, "mod", "tidy")
-	cmd.Dir = dir
-	cmd.Env = env
-	cmd.Stdin = nil
-	cmd.Stdout = output.Stdout
-	cmd.Stderr = output.Stderr
-
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error executing \"%s mod tidy\" in directory %q: %v", gocmd, dir, err)
-	}
-	return nil
+	return runGoCmd(output, dir, env, "mod", "tidy")
 }
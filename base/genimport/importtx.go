@@ -0,0 +1,139 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * importtx.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cosmos72/gomacro/base/paths"
+)
+
+// importTx makes the creation of a plugin directory transactional:
+// go.mod, go.sum, the import file and the compiled plugin are created in a temporary directory,
+// and moved into the plugin directory with atomic renames only after the import succeeded.
+// Thus an import that fails or is interrupted, for example by a network error during "go get",
+// never leaves a half-written plugin directory behind.
+// Temporary directories left by crashed processes are orphans, removed by CleanImports
+type importTx struct {
+	dir string // final directory
+	tmp string // temporary directory, empty after commit or rollback
+}
+
+// return the directory containing the temporary directories of imports in progress
+func importsTmpDir() string {
+	// not ".tmp": Go rejects import paths containing elements that start with a dot
+	return paths.Subdir(importsDir(), "_tmp")
+}
+
+// beginImportTx creates a temporary directory that will replace the contents of dir on commit
+func beginImportTx(o *Output, dir string) *importTx {
+	parent := importsTmpDir()
+	createDir(o, parent)
+	tmp, err := ioutil.TempDir(parent, sanitizeIdent(filepath.Base(dir))+"_")
+	if err != nil {
+		o.Errorf("error creating temporary directory: %v", err)
+	}
+	return &importTx{dir: dir, tmp: tmp}
+}
+
+// commit moves the files of the temporary directory into the final directory,
+// replacing the files already there. Does nothing if the temporary directory is empty.
+// Subdirectories of the final directory are preserved: they belong to other packages
+func (tx *importTx) commit(o *Output) {
+	if len(tx.tmp) == 0 {
+		return
+	}
+	infos := listDir(o, tx.tmp)
+	if len(infos) != 0 {
+		createDir(o, tx.dir)
+		removeAllFilesInDir(o, tx.dir)
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		src, dst := paths.Subdir(tx.tmp, info.Name()), paths.Subdir(tx.dir, info.Name())
+		if err := os.Rename(src, dst); err != nil {
+			o.Errorf("error renaming %q to %q: %v", src, dst, err)
+		}
+	}
+	tx.rollback()
+}
+
+// rollback removes the temporary directory, leaving the final directory unchanged.
+// Does nothing after commit
+func (tx *importTx) rollback() {
+	if len(tx.tmp) != 0 {
+		os.RemoveAll(tx.tmp)
+		tx.tmp = ""
+	}
+}
+
+// finalPath returns the path that file, created in the temporary directory, has after commit
+func (tx *importTx) finalPath(file string) string {
+	return paths.Subdir(tx.dir, filepath.Base(file))
+}
+
+// writeFileAtomic writes data to filename through a temporary file in the same directory,
+// then renames it: readers, including the go toolchain, never see a partially written file
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// RemoveImportFiles removes the files generated to import pkgpath as a plugin,
+// including its compiled plugin, and forgets it from the cache of compiled plugins:
+// the next import of pkgpath rebuilds it from scratch, see ":import --force".
+// Subdirectories are preserved: they belong to other packages
+func RemoveImportFiles(pkgpath string) error {
+	ForgetCachedPlugin(pkgpath)
+	dir := paths.Subdir(importsDir(), pkgpath)
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		if err := os.Remove(paths.Subdir(dir, info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
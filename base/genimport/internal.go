@@ -0,0 +1,105 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * internal.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// if pkgpath contains an "internal" path element, return the path prefix
+// before the last one and true. Otherwise return "" and false.
+//
+// Go only allows importing such package from packages rooted at the returned prefix
+func internalParent(pkgpath string) (string, bool) {
+	if pkgpath == "internal" || strings.HasPrefix(pkgpath, "internal/") {
+		return "", true
+	}
+	if i := strings.LastIndex(pkgpath, "/internal/"); i >= 0 {
+		return pkgpath[:i], true
+	}
+	if strings.HasSuffix(pkgpath, "/internal") {
+		return pkgpath[:len(pkgpath)-len("/internal")], true
+	}
+	return "", false
+}
+
+// return true if importerpath is equal to prefix, or starts with prefix + "/"
+func hasPathPrefix(importerpath string, prefix string) bool {
+	return importerpath == prefix || strings.HasPrefix(importerpath, prefix+"/")
+}
+
+// return the import path of the package in directory 'dir',
+// computed from the module containing it
+func importerPath(dir string) (string, error) {
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	mod, err := findModule(absdir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(mod.Dir, absdir)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return mod.Path, nil
+	}
+	return mod.Path + "/" + filepath.ToSlash(rel), nil
+}
+
+// pluginModulePath returns the module path of the plugin that wraps package 'pkgpath'.
+//
+// It is usually "gomacro.imports/" + pkgpath, but internal packages can only be imported
+// by packages rooted at the parent of the "internal" path element:
+// in such case, if the current directory belongs to a module rooted there
+// (or if the package was imported with a relative path from such a directory)
+// the plugin module path is placed inside the same tree.
+// Otherwise, returns an error mirroring the go command rules about internal packages
+func (imp *Importer) pluginModulePath(pkgpath string) (string, error) {
+	parent, internal := internalParent(pkgpath)
+	if !internal {
+		return "gomacro.imports/" + pkgpath, nil
+	}
+	imp.lock.Lock()
+	visible := imp.visible[pkgpath]
+	imp.lock.Unlock()
+	if !visible {
+		if err := checkInternal(pkgpath, "."); err != nil {
+			return "", err
+		}
+	}
+	return parent + "/gomacro.imports/" + pkgpath, nil
+}
+
+// checkInternal returns an error if the internal package 'pkgpath'
+// cannot be imported by the package in directory 'dir'
+func checkInternal(pkgpath string, dir string) error {
+	parent, internal := internalParent(pkgpath)
+	if !internal {
+		return nil
+	}
+	if len(parent) != 0 {
+		if importer, err := importerPath(dir); err == nil && hasPathPrefix(importer, parent) {
+			return nil
+		}
+	}
+	return fmt.Errorf("use of internal package %q not allowed: directory %q is not inside the module tree rooted at %q", pkgpath, dir, parent)
+}
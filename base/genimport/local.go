@@ -0,0 +1,221 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * local.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/cosmos72/gomacro/base/paths"
+)
+
+// the version of modules replaced by a local directory
+const localModuleVersion = "v0.0.0-00010101000000-000000000000"
+
+// IsLocalImport returns true if path is a relative import path
+// as ".", "..", "./foo" or "../foo"
+func IsLocalImport(path string) bool {
+	return path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+// LocalImport converts a relative import path, as "./foo" or "../foo",
+// into an import path that can be passed to ImportPackageOrError().
+// The relative path is resolved against directory 'dir'.
+//
+// If the resolved directory belongs to a Go module, returns the package path inside such module.
+// Otherwise synthesizes a module "gomacro.local/..." containing a copy of the directory's Go files:
+// useful for throwaway code in directories that are not Go modules.
+// In both cases, records the replace directive needed to load the package from local disk.
+func (imp *Importer) LocalImport(relpath string, dir string) (string, error) {
+	absdir, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(relpath)))
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(absdir); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("import %q: %s is not a directory", relpath, absdir)
+	}
+	var mod modInfo
+	var pkgpath string
+	if mod, err = findModule(absdir); err == nil {
+		rel, err := filepath.Rel(mod.Dir, absdir)
+		if err != nil {
+			return "", err
+		}
+		pkgpath = mod.Path
+		if rel != "." {
+			pkgpath += "/" + filepath.ToSlash(rel)
+		}
+	} else if mod, err = synthesizeModule(absdir); err == nil {
+		pkgpath = mod.Path
+	} else {
+		return "", err
+	}
+	_, internal := internalParent(pkgpath)
+	if internal {
+		if err = checkInternal(pkgpath, dir); err != nil {
+			return "", err
+		}
+	}
+	imp.lock.Lock()
+	if imp.local == nil {
+		imp.local = make(map[string]modInfo)
+	}
+	imp.local[mod.Path] = mod
+	if internal {
+		if imp.visible == nil {
+			imp.visible = make(map[string]bool)
+		}
+		imp.visible[pkgpath] = true
+	}
+	imp.lock.Unlock()
+	return pkgpath, nil
+}
+
+// return the local module containing pkgpath, if any
+func (imp *Importer) localModule(pkgpath string) (modInfo, bool) {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	for _, mod := range imp.local {
+		if pkgpath == mod.Path || strings.HasPrefix(pkgpath, mod.Path+"/") {
+			return mod, true
+		}
+	}
+	return modInfo{}, false
+}
+
+// find the go.mod file in dir or in its parent directories
+func findModule(dir string) (modInfo, error) {
+	for {
+		gomod := filepath.Join(dir, "go.mod")
+		if data, err := ioutil.ReadFile(gomod); err == nil {
+			path := modfile.ModulePath(data)
+			if len(path) == 0 {
+				return modInfo{}, fmt.Errorf("missing module statement in %s", gomod)
+			}
+			return modInfo{Path: path, Dir: dir, GoMod: gomod}, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return modInfo{}, fmt.Errorf("directory %s is not part of a module", dir)
+		}
+		dir = parent
+	}
+}
+
+// create a module "gomacro.local/..." containing a copy of the Go files in dir.
+// The copy is refreshed each time, so that changes to dir are picked up
+// by unloading and importing the package again
+func synthesizeModule(dir string) (modInfo, error) {
+	modpath := "gomacro.local/" + sanitizeModulePath(filepath.ToSlash(dir))
+	moddir := paths.Subdir(paths.GoSrcDir, modpath)
+	if err := os.MkdirAll(moddir, 0o700); err != nil {
+		return modInfo{}, err
+	}
+	infos, err := ioutil.ReadDir(moddir)
+	if err != nil {
+		return modInfo{}, err
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			os.Remove(filepath.Join(moddir, info.Name()))
+		}
+	}
+	infos, err = ioutil.ReadDir(dir)
+	if err != nil {
+		return modInfo{}, err
+	}
+	n := 0
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return modInfo{}, err
+		}
+		if err = ioutil.WriteFile(filepath.Join(moddir, name), data, 0o644); err != nil {
+			return modInfo{}, err
+		}
+		n++
+	}
+	if n == 0 {
+		return modInfo{}, fmt.Errorf("no Go files in %s", dir)
+	}
+	gomod := filepath.Join(moddir, "go.mod")
+	content := "module " + modpath + "\n"
+	if version := goVersion(); len(version) != 0 {
+		content += "\ngo " + version + "\n"
+	}
+	if err = ioutil.WriteFile(gomod, []byte(content), 0o644); err != nil {
+		return modInfo{}, err
+	}
+	return modInfo{Path: modpath, Dir: moddir, GoMod: gomod}, nil
+}
+
+// replace the characters not allowed in module paths
+func sanitizeModulePath(path string) string {
+	var buf strings.Builder
+	for _, elem := range strings.Split(path, "/") {
+		if len(elem) == 0 {
+			continue
+		}
+		if buf.Len() != 0 {
+			buf.WriteByte('/')
+		}
+		if elem == "internal" {
+			// do not trigger Go rules about internal packages
+			elem = "internal_"
+		}
+		for i, ch := range elem {
+			if ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_' || (ch == '.' && i != 0) {
+				buf.WriteRune(ch)
+			} else {
+				buf.WriteByte('_')
+			}
+		}
+	}
+	return buf.String()
+}
+
+// return the Go language version of the running toolchain, as "1.16"
+func goVersion() string {
+	version := runtime.Version()
+	if !strings.HasPrefix(version, "go") {
+		return "" // devel version
+	}
+	version = version[2:]
+	// keep only major and minor version
+	dot := strings.IndexByte(version, '.')
+	if dot < 0 {
+		return ""
+	}
+	end := dot + 1
+	for end < len(version) && version[end] >= '0' && version[end] <= '9' {
+		end++
+	}
+	return version[:end]
+}
@@ -0,0 +1,167 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * opaque.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+)
+
+// Unexported types can appear in the exported API of a package, as in func Open() *handle.
+// Interpreted code can call such functions and use the values they return,
+// but it cannot name their types to declare variables, parameters or fields.
+//
+// For each unexported type reachable from the exported API, the generated import file
+// also lists an exported opaque type X_<name> in Package.Types, so that interpreted code
+// can write for example var h *pkg.X_handle.
+// Outside the package, its reflect.Type is extracted from the exported declaration
+// where it appears, as r.TypeOf(pkg.Open).Out(0).Elem()
+
+type opaqueType struct {
+	name string // name of the unexported type
+	expr string // Go expression that returns its reflect.Type
+}
+
+type opaqueFinder struct {
+	gen   *genimport
+	found map[string]string // unexported type name -> expression that returns its reflect.Type
+}
+
+// name of the opaque type that interpreted code can use instead of unexported type 'name'
+func opaqueTypeName(name string) string {
+	return "X_" + name
+}
+
+// return the unexported types appearing in the exported API of the package, sorted by name
+func (gen *genimport) opaqueTypes() []opaqueType {
+	f := opaqueFinder{gen: gen, found: make(map[string]string)}
+	for _, name := range gen.names {
+		if obj := gen.scope.Lookup(name); obj.Exported() && !isGeneric(obj) {
+			f.visitObj(obj)
+		}
+	}
+	list := make([]opaqueType, 0, len(f.found))
+	for name, expr := range f.found {
+		if gen.scope.Lookup(opaqueTypeName(name)) != nil {
+			gen.output.Warnf("package %q: cannot declare opaque type %s for unexported type %s, name is already used",
+				gen.path, opaqueTypeName(name), name)
+			continue
+		}
+		list = append(list, opaqueType{name, expr})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+func (f *opaqueFinder) visitObj(obj types.Object) {
+	gen := f.gen
+	name := gen.name_ + obj.Name()
+	switch obj := obj.(type) {
+	case *types.Const:
+		f.visit(obj.Type(), fmt.Sprintf("%sTypeOf(%s)", gen.reflect, name))
+	case *types.Var:
+		f.visit(obj.Type(), fmt.Sprintf("%sTypeOf(&%s).Elem()", gen.reflect, name))
+	case *types.Func:
+		f.visit(obj.Type(), fmt.Sprintf("%sTypeOf(%s)", gen.reflect, name))
+	case *types.TypeName:
+		if obj.IsAlias() {
+			return
+		}
+		t, ok := obj.Type().(*types.Named)
+		if !ok {
+			return
+		}
+		expr := fmt.Sprintf("%sTypeOf((*%s)(nil)).Elem()", gen.reflect, name)
+		switch u := t.Underlying().(type) {
+		case *types.Interface:
+			for i, n := 0, u.NumMethods(); i < n; i++ {
+				if m := u.Method(i); m.Exported() {
+					f.visitMethod(m, fmt.Sprintf("%sTypeOf(%s.%s)", gen.reflect, name, m.Name()))
+				}
+			}
+			return
+		default:
+			f.visit(u, expr)
+		}
+		for i, n := 0, t.NumMethods(); i < n; i++ {
+			m := t.Method(i)
+			if !m.Exported() {
+				continue
+			}
+			recv := name
+			if _, ok := m.Type().(*types.Signature).Recv().Type().(*types.Pointer); ok {
+				recv = "(*" + name + ")"
+			}
+			f.visitMethod(m, fmt.Sprintf("%sTypeOf(%s.%s)", gen.reflect, recv, m.Name()))
+		}
+	}
+}
+
+// visit the signature of method m, whose method expression has reflect.Type expr:
+// the receiver is its first parameter
+func (f *opaqueFinder) visitMethod(m *types.Func, expr string) {
+	sig := m.Type().(*types.Signature)
+	f.visitTuple(sig.Params(), expr, "In", 1)
+	f.visitTuple(sig.Results(), expr, "Out", 0)
+}
+
+func (f *opaqueFinder) visitTuple(tuple *types.Tuple, expr string, method string, offset int) {
+	for i, n := 0, tuple.Len(); i < n; i++ {
+		f.visit(tuple.At(i).Type(), fmt.Sprintf("%s.%s(%d)", expr, method, i+offset))
+	}
+}
+
+// visit type t, whose reflect.Type is returned by expr
+func (f *opaqueFinder) visit(t types.Type, expr string) {
+	switch t := t.(type) {
+	case *types.Named:
+		obj := t.Obj()
+		// local types cannot be named even inside the package
+		if obj.Pkg() != f.gen.gpkg || obj.Exported() || f.gen.scope.Lookup(obj.Name()) != obj || isGeneric(obj) {
+			return
+		}
+		if _, found := f.found[obj.Name()]; !found {
+			if f.gen.mode == ImInception {
+				expr = fmt.Sprintf("%sTypeOf((*%s)(nil)).Elem()", f.gen.reflect, obj.Name())
+			}
+			f.found[obj.Name()] = expr
+		}
+	case *types.Array:
+		f.visit(t.Elem(), expr+".Elem()")
+	case *types.Chan:
+		f.visit(t.Elem(), expr+".Elem()")
+	case *types.Map:
+		f.visit(t.Key(), expr+".Key()")
+		f.visit(t.Elem(), expr+".Elem()")
+	case *types.Pointer:
+		f.visit(t.Elem(), expr+".Elem()")
+	case *types.Slice:
+		f.visit(t.Elem(), expr+".Elem()")
+	case *types.Signature:
+		f.visitTuple(t.Params(), expr, "In", 0)
+		f.visitTuple(t.Results(), expr, "Out", 0)
+	case *types.Struct:
+		for i, n := 0, t.NumFields(); i < n; i++ {
+			if field := t.Field(i); field.Exported() {
+				f.visit(field.Type(), fmt.Sprintf("%s.Field(%d).Type", expr, i))
+			}
+		}
+	}
+}
@@ -17,11 +17,18 @@
 package genimport
 
 import (
-	"io"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	r "reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cosmos72/gomacro/base/paths"
 )
@@ -40,7 +47,7 @@ func chooseGoCmd() string {
 	return gocmd
 }
 
-func compilePlugin(o *Output, filePath string, enableModule bool, stdout io.Writer, stderr io.Writer) string {
+func compilePlugin(o *Output, filePath string, enableModule bool) string {
 	gosrcdir := paths.GoSrcDir
 	gosrclen := len(gosrcdir)
 	filelen := len(filePath)
@@ -48,45 +55,117 @@ func compilePlugin(o *Output, filePath string, enableModule bool, stdout io.Writ
 		o.Errorf("source %q is in unsupported directory, cannot compile it: should be inside %q", filePath, gosrcdir)
 	}
 	gocmd := chooseGoCmd()
+	env := environForPlugin(enableModule)
+	checkPluginToolchain(o, gocmd, env)
 
-	cmd := exec.Command(gocmd, "build", "-buildmode=plugin")
-	cmd.Dir = paths.DirName(filePath)
-	cmd.Env = environForCompiler(enableModule)
-	cmd.Stdin = nil
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+	dir := paths.DirName(filePath)
 
 	o.Debugf("compiling %q ...", filePath)
-	err := cmd.Run()
-	if err != nil {
-		o.Errorf("error executing \"%s build -buildmode=plugin\" in directory %q: %v", gocmd, cmd.Dir, err)
+	if err := runGoCmd(o, dir, env, pluginBuildArgs()...); err != nil {
+		o.Errorf("%v", err)
+	}
+	return findSharedObject(o, paths.RemoveLastByte(dir))
+}
+
+// return the arguments of "go build" needed to create a plugin loadable by the running gomacro
+func pluginBuildArgs() []string {
+	args := []string{"build", "-buildmode=plugin"}
+	if raceEnabled {
+		args = append(args, "-race")
+	}
+	return args
+}
+
+// return the environment to create a plugin loadable by the running gomacro
+func environForPlugin(enableModule bool) []string {
+	// "go build -buildmode=plugin" requires cgo
+	return append(environForCompiler(enableModule), "CGO_ENABLED=1")
+}
+
+var pluginToolchain struct {
+	once sync.Once
+	err  string
+}
+
+// checkPluginToolchain verifies that gocmd has the same version as the Go toolchain
+// that compiled the running gomacro: otherwise the plugins it creates cannot be loaded,
+// and plugin.Open() fails with a cryptic error after a possibly long compilation
+func checkPluginToolchain(o *Output, gocmd string, env []string) {
+	pluginToolchain.once.Do(func() {
+		cmd := exec.Command(gocmd, "env", "GOVERSION")
+		cmd.Env = env
+		out, err := cmd.Output()
+		if err != nil {
+			// let "go build" report the error
+			return
+		}
+		version := firstField(string(out))
+		ourVersion := firstField(runtime.Version())
+		// Go < 1.16 does not support "go env GOVERSION",
+		// and development versions are not comparable
+		if len(version) == 0 || version == ourVersion || strings.HasPrefix(ourVersion, "devel") {
+			return
+		}
+		pluginToolchain.err = fmt.Sprintf(
+			"cannot import packages at runtime: %q is %s, while gomacro was compiled by %s.\n"+
+				"\tPlugins must be compiled by the same Go version as gomacro:"+
+				" either set $GOROOT or $PATH to use %s, or recompile gomacro with %s",
+			gocmd, version, ourVersion, ourVersion, version)
+	})
+	if len(pluginToolchain.err) != 0 {
+		o.Errorf("%s", pluginToolchain.err)
+	}
+}
+
+func firstField(str string) string {
+	if fields := strings.Fields(str); len(fields) != 0 {
+		return fields[0]
 	}
+	return ""
+}
 
-	dir := paths.RemoveLastByte(paths.DirName(filePath))
+var pluginBuilds uint64
 
-	return findSharedObject(o, dir)
+// versionedModulePath appends to modpath a suffix unique to each build, as "/build_0123456789ab".
+//
+// Go refuses to load a plugin whose path, i.e. the module path of its main package,
+// was already loaded, and plugin.Open() returns the already loaded plugin if the file name is the same.
+// Unique module paths, and thus unique file names of the compiled plugins,
+// allow importing again an updated package in the same process
+func versionedModulePath(modpath string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %d %d %d", modpath, os.Getpid(), time.Now().UnixNano(), atomic.AddUint64(&pluginBuilds, 1))
+	return modpath + "/build_" + hex.EncodeToString(h.Sum(nil))[:12]
 }
 
+// return the most recent shared object in dir, and remove the superseded ones
 func findSharedObject(o *Output, dir string) string {
-	var ret string
+	var ret os.FileInfo
+	var superseded []string
 	for _, info := range listDir(o, dir) {
-		if !info.Mode().IsRegular() {
+		if !info.Mode().IsRegular() || !strings.HasSuffix(info.Name(), ".so") {
 			continue
 		}
-		name := info.Name()
-		n := len(name)
-		if n <= 3 || name[n-3:n] != ".so" {
+		if ret == nil {
+			ret = info
 			continue
+		} else if info.ModTime().After(ret.ModTime()) {
+			info, ret = ret, info
 		}
-		if ret != "" {
-			o.Errorf("multiple shared objects found in directory %q - do not know which one to load: %q or %q ?", dir, ret, name)
-		}
-		ret = name
+		superseded = append(superseded, info.Name())
 	}
-	if ret == "" {
+	if ret == nil {
 		o.Errorf("no shared objects found in directory %q - compiler error?", dir)
 	}
-	return paths.Subdir(dir, ret)
+	for _, name := range superseded {
+		// plugins already loaded by this or other processes are not affected
+		if err := os.Remove(paths.Subdir(dir, name)); err != nil {
+			o.Debugf("error removing superseded plugin: %v", err)
+		} else {
+			o.Debugf("removed superseded plugin %q", paths.Subdir(dir, name))
+		}
+	}
+	return paths.Subdir(dir, ret.Name())
 }
 
 func (imp *Importer) loadPluginSymbol(soname string, symbolName string) interface{} {
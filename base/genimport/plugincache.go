@@ -0,0 +1,273 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * plugincache.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/base/paths"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// pluginCacheEntry describes a compiled import plugin.
+// Entries are persisted in the file returned by pluginCacheFile(),
+// so that later gomacro processes can load the plugin directly,
+// without running "go list" and "go build" again
+type pluginCacheEntry struct {
+	SoName string   // absolute path of the shared object
+	SoHash string   // sha256 of the shared object contents
+	Digest string   // sha256 of the toolchain, the import options and the contents of the source directories
+	Dirs   []string // absolute paths of the directories of the package and its non-standard dependencies
+}
+
+// map[pkgpath]entry
+type pluginCache map[string]pluginCacheEntry
+
+// serializes accesses to pluginCacheFile() from the same process.
+// different processes may still race: the last one to write wins,
+// which is harmless because all entries are validated before use
+var pluginCacheLock sync.Mutex
+
+func pluginCacheFile() string {
+	return paths.Subdir(paths.GoSrcDir, "gomacro.imports", "plugins.json")
+}
+
+func readPluginCache() pluginCache {
+	cache := make(pluginCache)
+	data, err := ioutil.ReadFile(pluginCacheFile())
+	if err == nil {
+		// ignore corrupted files, they will be overwritten
+		_ = json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+func writePluginCache(cache pluginCache) error {
+	data, err := json.MarshalIndent(cache, "", "\t")
+	if err != nil {
+		return err
+	}
+	filename := pluginCacheFile()
+	dir := filepath.Dir(filename)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// write a temporary file then rename it, for atomicity
+	f, err := ioutil.TempFile(dir, "plugins.*.json")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// ForgetCachedPlugin removes pkgpath from the persistent cache of compiled plugins:
+// the next gomacro process that imports it will recompile it
+func ForgetCachedPlugin(pkgpath string) {
+	pluginCacheLock.Lock()
+	defer pluginCacheLock.Unlock()
+	cache := readPluginCache()
+	if _, found := cache[pkgpath]; found {
+		delete(cache, pkgpath)
+		writePluginCache(cache)
+	}
+}
+
+// lookupCachedPlugin returns the shared object of a previously compiled plugin for pkgpath,
+// or "" if it's not found or if its sources, its build options or the shared object itself changed.
+// Files added to the source directories, as a new file of the package or a new dependency
+// imported by it, change the digest too
+func (imp *Importer) lookupCachedPlugin(pkgpath string, enableModule bool) string {
+	pluginCacheLock.Lock()
+	entry, found := readPluginCache()[pkgpath]
+	pluginCacheLock.Unlock()
+	if !found || len(entry.Dirs) == 0 {
+		return ""
+	}
+	if sohash, err := hashFile(entry.SoName); err != nil || sohash != entry.SoHash {
+		return ""
+	}
+	if digest, err := imp.pluginDigest(pkgpath, entry.Dirs, enableModule); err != nil || digest != entry.Digest {
+		return ""
+	}
+	return entry.SoName
+}
+
+// savePluginCache records that soname is the compiled plugin for pkgpath
+func (imp *Importer) savePluginCache(pkgpath string, soname string, enableModule bool) {
+	imp.lock.Lock()
+	dirs := imp.dirs[pkgpath]
+	imp.lock.Unlock()
+	if len(dirs) == 0 {
+		// cannot detect when the package changes
+		return
+	}
+	digest, err := imp.pluginDigest(pkgpath, dirs, enableModule)
+	if err == nil {
+		var sohash string
+		if sohash, err = hashFile(soname); err == nil {
+			pluginCacheLock.Lock()
+			cache := readPluginCache()
+			cache[pkgpath] = pluginCacheEntry{SoName: soname, SoHash: sohash, Digest: digest, Dirs: dirs}
+			err = writePluginCache(cache)
+			pluginCacheLock.Unlock()
+		}
+	}
+	if err != nil {
+		imp.output.Debugf("cannot save compiled plugin %q of package %q in cache: %v", soname, pkgpath, err)
+	}
+}
+
+// importCachedPlugin loads pkgpath from a previously compiled plugin, if possible.
+// It never panics: on failure, the caller must compile the plugin again
+func (imp *Importer) importCachedPlugin(pkgpath string, enableModule bool) (ref *PackageRef) {
+	imp.lock.Lock()
+	havePluginOpen := imp.havePluginOpen()
+	imp.lock.Unlock()
+	if !havePluginOpen {
+		return nil
+	}
+	soname := imp.lookupCachedPlugin(pkgpath, enableModule)
+	if len(soname) == 0 {
+		return nil
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			imp.output.Debugf("cannot load cached plugin %q of package %q: %v", soname, pkgpath, rec)
+			ref = nil
+		}
+	}()
+	imp.output.Debugf("loading cached plugin %q ...", soname)
+	pkg, err := imp.loadPluginPackage(soname, pkgpath)
+	if err != nil {
+		imp.output.Debugf("%v", err)
+		return nil
+	}
+	touchPlugin(soname)
+	return &PackageRef{Package: pkg, Path: pkgpath}
+}
+
+// loadPluginPackage loads the plugin soname, caches all the packages it contains
+// and returns the one at pkgpath
+func (imp *Importer) loadPluginPackage(soname string, pkgpath string) (imports.Package, error) {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	ipkgs := imp.loadPluginSymbol(soname, "Packages")
+	pkgs := *ipkgs.(*map[string]imports.PackageUnderlying)
+
+	// cache *all* packages found for future use
+	imp.registry.Merge(pkgs)
+
+	// but return only requested one
+	pkg, found := imp.registry.Lookup(pkgpath)
+	if !found {
+		return pkg, imp.output.MakeRuntimeError(
+			"error loading package %q: the compiled plugin %q does not contain it! internal error?",
+			pkgpath, soname)
+	}
+	return pkg, nil
+}
+
+// pluginDigest computes a digest of everything that, if changed, requires recompiling the plugin for pkgpath:
+// the Go toolchain, the import options, the modules pinned by Importer.Require,
+// the names and contents of the files in the directories of the package and its non-standard dependencies
+// (which include the modules replaced by a local directory), and the go.mod and go.sum of the plugin,
+// which list the exact version of each dependency
+func (imp *Importer) pluginDigest(pkgpath string, dirs []string, enableModule bool) (string, error) {
+	h := sha256.New()
+	only := append([]string(nil), imp.only[pkgpath]...)
+	sort.Strings(only)
+	fmt.Fprintf(h, "%s %s %s race=%v module=%v only=%q require=%v\n",
+		runtime.Version(), runtime.GOOS, runtime.GOARCH, raceEnabled, enableModule, only, imp.requirements())
+	for _, dir := range dirs {
+		if err := hashSourceDir(h, dir); err != nil {
+			return "", err
+		}
+	}
+	if enableModule {
+		dir := computeImportDir(imp.output, pkgpath, ImPlugin)
+		for _, name := range []string{"go.mod", "go.sum"} {
+			data, err := ioutil.ReadFile(paths.Subdir(dir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s %d\n", name, len(data))
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashSourceDir writes to h the name and contents of each file in dir that can affect the build:
+// all regular files, except for tests and the files ignored by the go command
+func hashSourceDir(h io.Writer, dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+			strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%q %d\n", filepath.Join(dir, name), info.Size())
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
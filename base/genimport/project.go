@@ -0,0 +1,158 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * project.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+
+	"github.com/cosmos72/gomacro/imports/util"
+)
+
+// Project describes the Go module containing a directory,
+// and the packages that code in such directory can import
+type Project struct {
+	Module string // module path, from go.mod
+	Dir    string // module root directory
+	// package name -> import path of the module's own packages
+	// and of the root packages of its direct dependencies.
+	// If a name is ambiguous, the module's own packages are preferred,
+	// then the shortest import path
+	Packages map[string]string
+}
+
+// FindProject searches dir and its parents for a go.mod file,
+// and returns the packages of the Go module it describes.
+// Returns nil and an error if dir is not part of a Go module
+func FindProject(dir string) (*Project, error) {
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := findModule(absdir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(mod.GoMod)
+	if err != nil {
+		return nil, err
+	}
+	file, err := modfile.ParseLax(mod.GoMod, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	proj := &Project{Module: mod.Path, Dir: mod.Dir, Packages: make(map[string]string)}
+	proj.addOwnPackages()
+	for _, req := range file.Require {
+		if !req.Indirect {
+			proj.addPackage(dependencyName(req.Mod.Path), req.Mod.Path, false)
+		}
+	}
+	return proj, nil
+}
+
+// Names returns the sorted names of the project packages
+func (proj *Project) Names() []string {
+	names := make([]string, 0, len(proj.Packages))
+	for name := range proj.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// add the importable packages found in the module directory and its subdirectories,
+// skipping nested modules, testdata and vendor directories
+func (proj *Project) addOwnPackages() {
+	filepath.Walk(proj.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != proj.Dir {
+			name := info.Name()
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				// nested module
+				return filepath.SkipDir
+			}
+		}
+		name := packageClause(path)
+		if len(name) == 0 || name == "main" {
+			return nil
+		}
+		pkgpath := proj.Module
+		if rel, err := filepath.Rel(proj.Dir, path); err == nil && rel != "." {
+			pkgpath += "/" + filepath.ToSlash(rel)
+		}
+		if _, internal := internalParent(pkgpath); !internal {
+			proj.addPackage(name, pkgpath, true)
+		}
+		return nil
+	})
+}
+
+func (proj *Project) addPackage(name string, pkgpath string, own bool) {
+	if len(name) == 0 || name == "_" {
+		return
+	}
+	if old, ok := proj.Packages[name]; ok {
+		oldown := old == proj.Module || strings.HasPrefix(old, proj.Module+"/")
+		if oldown && !own || oldown == own && (len(old) < len(pkgpath) || len(old) == len(pkgpath) && old < pkgpath) {
+			return
+		}
+	}
+	proj.Packages[name] = pkgpath
+}
+
+// return the package name declared by the first non-test Go file in dir
+func packageClause(dir string) string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	fset := token.NewFileSet()
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err == nil {
+			return file.Name.Name
+		}
+	}
+	return ""
+}
+
+// guess the package name of a dependency's root package from its module path,
+// ignoring major version suffixes as in "example.com/foo/v2" and "gopkg.in/yaml.v3"
+func dependencyName(modpath string) string {
+	if prefix, _, ok := module.SplitPathVersion(modpath); ok {
+		modpath = prefix
+	}
+	return util.TailIdentifier(util.FileName(modpath))
+}
@@ -0,0 +1,118 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * require.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// the magic comment that pins the version of a module imported by a script
+const requireDirective = "//gomacro:require"
+
+// Require pins the version of the module modpath: the go.mod files generated
+// to import its packages, or packages depending on it, will require such version
+// instead of the latest one. Requiring again the same module replaces its version.
+// It has no effect on packages already imported.
+func (imp *Importer) Require(modpath, version string) error {
+	if err := module.Check(modpath, version); err != nil {
+		return err
+	} else if semver.Canonical(version) != strings.TrimSuffix(version, "+incompatible") {
+		// reject abbreviations as v1.16: go.mod only contains canonical versions
+		return fmt.Errorf("%s: version %q is not canonical, expecting for example %q",
+			modpath, version, semver.Canonical(version))
+	}
+	imp.lock.Lock()
+	if imp.require == nil {
+		imp.require = make(map[string]string)
+	}
+	imp.require[modpath] = version
+	imp.lock.Unlock()
+	return nil
+}
+
+// RequireDirectives scans src for lines "//gomacro:require MODULE VERSION",
+// usually found in the comments at the top of a script,
+// and calls Importer.Require for each of them.
+// Returns the first malformed directive, with its line number
+func (imp *Importer) RequireDirectives(src string) error {
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, requireDirective) {
+			continue
+		}
+		rest := line[len(requireDirective):]
+		if len(rest) != 0 && rest[0] != ' ' && rest[0] != '\t' {
+			// a different directive, as //gomacro:requirefoo
+			continue
+		}
+		args := strings.Fields(rest)
+		var err error
+		if len(args) != 2 {
+			err = fmt.Errorf("expecting %s MODULE VERSION, found: %s", requireDirective, line)
+		} else {
+			err = imp.Require(args[0], args[1])
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// return the modules pinned by Importer.Require, sorted by path
+func (imp *Importer) requirements() []module.Version {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	list := make([]module.Version, 0, len(imp.require))
+	for modpath, version := range imp.require {
+		list = append(list, module.Version{Path: modpath, Version: version})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+// return the argument of "go get" needed to import pkgpath:
+// if its module was pinned by Importer.Require, append the required version
+func (imp *Importer) goGetQuery(pkgpath string) string {
+	var modpath, version string
+	for _, req := range imp.requirements() {
+		if (pkgpath == req.Path || strings.HasPrefix(pkgpath, req.Path+"/")) && len(req.Path) > len(modpath) {
+			modpath, version = req.Path, req.Version
+		}
+	}
+	if len(version) == 0 {
+		return pkgpath
+	}
+	return pkgpath + "@" + version
+}
+
+// add to file the modules pinned by Importer.Require
+func (imp *Importer) addRequirements(file *modfile.File) {
+	for _, req := range imp.requirements() {
+		if err := file.AddRequire(req.Path, req.Version); err != nil {
+			imp.output.Debugf("error adding require directive for %s, %v", req.Path, err)
+		}
+	}
+}
@@ -136,13 +136,17 @@ type importExtractor struct {
 	imports map[string]bool
 	seen    map[types.Type]bool
 	o       *Output
+	sealed  bool // also visit the sealed interfaces, see extractSealedInterface()
 }
 
-func (ie *importExtractor) visitPackage(pkg *types.Package, requireAllInterfaceMethodsExported bool) {
+func (ie *importExtractor) visitPackage(pkg *types.Package, names []string, requireAllInterfaceMethodsExported bool) {
 	scope := pkg.Scope()
-	for _, name := range scope.Names() {
+	for _, name := range names {
 		obj := scope.Lookup(name)
 		t := extractInterface(obj, requireAllInterfaceMethodsExported)
+		if t == nil && ie.sealed {
+			t = extractSealedInterface(obj)
+		}
 		if t != nil {
 			traverseType(ie.o, "", t, ie.visitType)
 		}
@@ -176,7 +180,7 @@ func (ie *importExtractor) visitType(t types.Type) bool {
 }
 
 func extractInterface(obj types.Object, requireAllMethodsAndTypesExported bool) *types.Interface {
-	if obj == nil || !obj.Exported() {
+	if obj == nil || !obj.Exported() || isGeneric(obj) || isConstraint(obj) {
 		return nil
 	}
 	switch obj.(type) {
@@ -300,14 +304,18 @@ func structExported(s *types.Struct) bool {
 // To avoid naming conflicts when importing two different packages
 // that end with the same name, as for example image/draw and golang.org/x/image/draw,
 // we rename conflicting packages and return a map[path]renamed
-func collectPackageImportsWithRename(o *Output, pkg *types.Package, requireAllInterfaceMethodsExported bool) map[string]string {
+//
+// only the package-level declarations listed in names are visited.
+// if sealed is true, also visit the sealed interfaces whose shims will be generated
+func collectPackageImportsWithRename(o *Output, pkg *types.Package, names []string, requireAllInterfaceMethodsExported bool, sealed bool) map[string]string {
 	ie := importExtractor{
 		// we always need to import the package itself
 		imports: map[string]bool{pkg.Path(): true},
 		o:       o,
+		sealed:  sealed,
 	}
 	// output.Debugf("before visitPackage: imports = %v", ie.imports)
-	ie.visitPackage(pkg, requireAllInterfaceMethodsExported)
+	ie.visitPackage(pkg, names, requireAllInterfaceMethodsExported)
 	// output.Debugf("after  visitPackage: imports = %v", ie.imports)
 
 	// for deterministic renaming, use a sorted []string instead of a map[string]bool
@@ -0,0 +1,141 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * sealed.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"fmt"
+	"go/types"
+)
+
+// An interface with unexported methods is "sealed": only the types declared
+// in its package can implement it, and interpreted types never can.
+//
+// When writing inside the package, i.e. in ImInception mode, for each sealed interface I
+// we also generate the exported shims:
+//
+//	type X_I interface   // the methods of I, with each unexported method m renamed X_m
+//	func X_AdaptI(X_I) I // wraps an X_I into a type declared in the package, which implements I
+//
+// plus the proxy of X_I, so that interpreted types can implement X_I and be converted to I
+
+// return the interface declared by obj if it is sealed and we can generate its shims:
+// all its unexported methods must be declared in the package of obj, all its method signatures
+// must contain only exported types, and the package must not already declare the shim names
+func extractSealedInterface(obj types.Object) *types.Interface {
+	t := extractInterface(obj, false)
+	if t == nil || interfaceExported(t) {
+		return nil
+	}
+	pkg := obj.Pkg()
+	for i, n := 0, t.NumMethods(); i < n; i++ {
+		m := t.Method(i)
+		if !m.Exported() && m.Pkg() != pkg || !signatureExported(m.Type().(*types.Signature)) {
+			return nil
+		}
+	}
+	name := obj.Name()
+	scope := pkg.Scope()
+	for _, shim := range []string{sealedShimName(name), sealedAdaptName(name), sealedAdapterName(name)} {
+		if scope.Lookup(shim) != nil {
+			return nil
+		}
+	}
+	return t
+}
+
+// name of the exported interface that interpreted types can implement instead of sealed interface 'name'
+func sealedShimName(name string) string {
+	return "X_" + name
+}
+
+// name of the function that converts an X_name to the sealed interface 'name'
+func sealedAdaptName(name string) string {
+	return "X_Adapt" + name
+}
+
+// name of the type returned by X_Adapt<name>
+func sealedAdapterName(name string) string {
+	return "x_" + name + "_adapter"
+}
+
+// name of method m in the shim of a sealed interface
+func sealedMethodName(m *types.Func) string {
+	if m.Exported() {
+		return m.Name()
+	}
+	return "X_" + m.Name()
+}
+
+// return the sealed interface 'name' if we must generate its shims, otherwise nil
+func (gen *genimport) sealedInterface(name string) *types.Interface {
+	if gen.mode != ImInception {
+		return nil
+	}
+	return extractSealedInterface(gen.scope.Lookup(name))
+}
+
+// return the exported interface X_name, i.e. sealed interface t with its unexported methods renamed
+func sealedShim(name string, t *types.Interface) *types.Interface {
+	n := t.NumMethods()
+	methods := make([]*types.Func, n)
+	for i := 0; i < n; i++ {
+		m := t.Method(i)
+		methods[i] = types.NewFunc(m.Pos(), m.Pkg(), sealedMethodName(m), m.Type().(*types.Signature))
+	}
+	return types.NewInterfaceType(methods, nil).Complete()
+}
+
+// write the shims of sealed interface 'name', and the proxy of X_name
+func (gen *genimport) writeSealedShims(pkgPath string, name string, t *types.Interface) {
+	out := gen.out
+	shim, adapter := sealedShimName(name), sealedAdapterName(name)
+	fmt.Fprintf(out, "\n// --------------- shims for sealed interface %s.%s ---------------\ntype %s interface {", pkgPath, name, shim)
+	n := t.NumMethods()
+	for i := 0; i < n; i++ {
+		m := t.Method(i)
+		sig := m.Type().(*types.Signature)
+		fmt.Fprintf(out, "\n\t%s(", sealedMethodName(m))
+		gen.writeTypeTuple(sig.Params(), lastParamIsVariadic(sig.Variadic())|writeIncludeParamTypes)
+		out.WriteString(") ")
+		gen.writeTypeTupleOut(sig.Results())
+	}
+	fmt.Fprintf(out, "\n}\ntype %s struct {\n\t%s\n}\n", adapter, shim)
+	// exported methods are promoted from the embedded X_name, forward the unexported ones
+	for i := 0; i < n; i++ {
+		m := t.Method(i)
+		if m.Exported() {
+			continue
+		}
+		sig := m.Type().(*types.Signature)
+		params, results := sig.Params(), sig.Results()
+		variadic := lastParamIsVariadic(sig.Variadic())
+		fmt.Fprintf(out, "func (A %s) %s(", adapter, m.Name())
+		gen.writeTypeTuple(params, variadic|writeForceParamNames|writeIncludeParamTypes)
+		out.WriteString(") ")
+		gen.writeTypeTupleOut(results)
+		out.WriteString(" {\n\t")
+		if results != nil && results.Len() > 0 {
+			out.WriteString("return ")
+		}
+		fmt.Fprintf(out, "A.%s.%s(", shim, sealedMethodName(m))
+		gen.writeTypeTuple(params, variadic|writeForceParamNames)
+		out.WriteString(")\n}\n")
+	}
+	fmt.Fprintf(out, "func %s(impl %s) %s {\n\treturn %s{impl}\n}\n", sealedAdaptName(name), shim, name, adapter)
+
+	gen.writeInterfaceProxy(pkgPath, shim, sealedShim(name, t))
+}
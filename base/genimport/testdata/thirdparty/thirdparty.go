@@ -0,0 +1,86 @@
+// Package thirdparty is a fixture for the golden tests of the generated import files:
+// it declares every kind of exported symbol, and references two packages with the same name
+package thirdparty
+
+import (
+	htemplate "html/template"
+	"io"
+	"math/rand"
+	ttemplate "text/template"
+	"time"
+)
+
+const (
+	Version         = "1.2.3"
+	Big             = 1 << 40
+	Huge            = 1 << 70
+	Pi              = 3.14159
+	Typed   float32 = 0.5
+)
+
+var (
+	Timeout = 5 * time.Second
+	Default *Config
+)
+
+// Reader has a proxy in the generated file, which must import the packages
+// appearing in its methods, renaming one of the two "template"
+type Reader interface {
+	io.Reader
+	Rand() *rand.Rand
+	Text() *ttemplate.Template
+	HTML() *htemplate.Template
+	Wait(time.Duration)
+}
+
+// Sealed has an unexported method: only the file generated in ImInception mode
+// lets interpreted types implement it, through the adapter X_AdaptSealed
+type Sealed interface {
+	Level() Level
+	seal(at time.Time) bool
+}
+
+type Base struct{}
+
+func (Base) Name() string { return "base" }
+
+// Config embeds Base: the generated file lists its wrapper methods
+type Config struct {
+	Base
+	io.Reader
+	Rand *rand.Rand
+}
+
+type Level int
+
+func New(r io.Reader, seed int64) *Config {
+	return &Config{Reader: r, Rand: rand.New(rand.NewSource(seed))}
+}
+
+func Render(t *ttemplate.Template, h *htemplate.Template) error {
+	return nil
+}
+
+func (c *Config) Shuffle(n int, swap func(i, j int)) {
+	c.Rand.Shuffle(n, swap)
+}
+
+func unexported() {}
+
+// handle and state are unexported, but appear in the exported API:
+// the generated file lists them as the opaque types X_handle and X_state
+type handle struct {
+	id int
+}
+
+type state int
+
+func Open(name string) *handle {
+	return &handle{}
+}
+
+func (c *Config) Handles() map[string][]handle {
+	return nil
+}
+
+const Ready state = 1
@@ -0,0 +1,93 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * timing.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ImportTiming is the time spent in each stage of an import.
+// Stages that were not executed have zero duration
+type ImportTiming struct {
+	Path      string
+	Cached    bool          // the plugin compiled by a previous import was loaded, skipping the other stages
+	GoGet     time.Duration // "go get", to add the package to the go.mod of the plugin
+	GoList    time.Duration // "go list", to find the package and compile its export data
+	TypeLoad  time.Duration // loading the package types from export data or from sources
+	Generate  time.Duration // writing the import file
+	Build     time.Duration // "go mod tidy" and "go build -buildmode=plugin"
+	Open      time.Duration // opening the compiled plugin
+	Total     time.Duration
+	lastStage time.Time
+}
+
+func newImportTiming(pkgpath string) *ImportTiming {
+	return &ImportTiming{Path: pkgpath, lastStage: time.Now()}
+}
+
+// add the time elapsed since the end of the previous stage to *stage
+func (t *ImportTiming) endStage(stage *time.Duration) {
+	now := time.Now()
+	*stage += now.Sub(t.lastStage)
+	t.lastStage = now
+}
+
+func (t *ImportTiming) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%v", t.Total.Round(time.Millisecond))
+	if t.Cached {
+		buf.WriteString(", cached plugin")
+	}
+	sep := ": "
+	for _, stage := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"go get", t.GoGet}, {"go list", t.GoList}, {"type load", t.TypeLoad},
+		{"generate", t.Generate}, {"build", t.Build}, {"open", t.Open},
+	} {
+		if stage.d != 0 {
+			fmt.Fprintf(&buf, "%s%s %v", sep, stage.name, stage.d.Round(time.Millisecond))
+			sep = ", "
+		}
+	}
+	return buf.String()
+}
+
+// ImportTiming returns the time spent in each stage of the last import of pkgpath
+// that actually loaded the package, or nil if pkgpath was already loaded,
+// for example because it is compiled into the interpreter
+func (imp *Importer) ImportTiming(pkgpath string) *ImportTiming {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	return imp.timings[pkgpath]
+}
+
+func (imp *Importer) setImportTiming(pkgpath string, t *ImportTiming) {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	if t == nil {
+		delete(imp.timings, pkgpath)
+		return
+	}
+	if imp.timings == nil {
+		imp.timings = make(map[string]*ImportTiming)
+	}
+	imp.timings[pkgpath] = t
+}
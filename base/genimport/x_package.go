@@ -16,6 +16,7 @@ func init() {
 			"DefaultImporter":   r.ValueOf(DefaultImporter),
 			"GoModuleSupported": r.ValueOf(GoModuleSupported),
 			"ImBuiltin":         r.ValueOf(ImBuiltin),
+			"ImEmbed":           r.ValueOf(ImEmbed),
 			"ImInception":       r.ValueOf(ImInception),
 			"ImPlugin":          r.ValueOf(ImPlugin),
 			"ImThirdParty":      r.ValueOf(ImThirdParty),
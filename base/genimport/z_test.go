@@ -0,0 +1,865 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * z_test.go
+ *
+ *  Created on: Oct 16, 2026
+ *      Author: Massimiliano Ghilardi
+ */
+
+package genimport
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmos72/gomacro/base/output"
+	"github.com/cosmos72/gomacro/base/paths"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+func TestPluginCache(t *testing.T) {
+	const pkgpath = "example.com/gomacro/plugincache"
+	dir, err := ioutil.TempDir("", "gomacro_plugincache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saveGoSrcDir := paths.GoSrcDir
+	paths.GoSrcDir = dir
+	defer func() {
+		paths.GoSrcDir = saveGoSrcDir
+	}()
+
+	srcdir := filepath.Join(dir, "plugincache")
+	if err := os.Mkdir(srcdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(srcdir, "plugincache.go")
+	soname := filepath.Join(dir, "plugincache.so")
+	write := func(filename, content string) {
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(src, "package plugincache\n")
+	write(soname, "not really a shared object")
+
+	imp := DefaultImporter(&output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	imp.setSourceDirs(pkgpath, []string{srcdir})
+	imp.savePluginCache(pkgpath, soname, false)
+	if found := imp.lookupCachedPlugin(pkgpath, false); found != soname {
+		t.Errorf("expecting cached plugin %q, found %q", soname, found)
+	}
+	if found := imp.lookupCachedPlugin(pkgpath, true); found != "" {
+		t.Errorf("expecting no cached plugin when build options change, found %q", found)
+	}
+
+	// tests and files ignored by the go command do not matter
+	write(filepath.Join(srcdir, "plugincache_test.go"), "package plugincache\n")
+	write(filepath.Join(srcdir, ".plugincache.go.swp"), "")
+	if found := imp.lookupCachedPlugin(pkgpath, false); found != soname {
+		t.Errorf("expecting cached plugin %q after adding tests, found %q", soname, found)
+	}
+	// a new file of an already cached package requires recompiling it
+	extra := filepath.Join(srcdir, "extra.go")
+	write(extra, "package plugincache\n\nimport _ \"example.com/gomacro/newdep\"\n")
+	if found := imp.lookupCachedPlugin(pkgpath, false); found != "" {
+		t.Errorf("expecting no cached plugin after adding a source file, found %q", found)
+	}
+	if ref := imp.importCachedPlugin(pkgpath, false); ref != nil {
+		t.Errorf("expecting the cached plugin not to be imported after adding a source file, found %v", ref)
+	}
+	os.Remove(extra)
+	if found := imp.lookupCachedPlugin(pkgpath, false); found != soname {
+		t.Errorf("expecting cached plugin %q after removing the added file, found %q", soname, found)
+	}
+
+	write(src, "package plugincache // modified\n")
+	if found := imp.lookupCachedPlugin(pkgpath, false); found != "" {
+		t.Errorf("expecting no cached plugin after modifying sources, found %q", found)
+	}
+	imp.savePluginCache(pkgpath, soname, false)
+	write(soname, "another shared object")
+	if found := imp.lookupCachedPlugin(pkgpath, false); found != "" {
+		t.Errorf("expecting no cached plugin after modifying the shared object, found %q", found)
+	}
+	imp.savePluginCache(pkgpath, soname, false)
+	ForgetCachedPlugin(pkgpath)
+	if found := imp.lookupCachedPlugin(pkgpath, false); found != "" {
+		t.Errorf("expecting no cached plugin after forgetting it, found %q", found)
+	}
+}
+
+// the plugin cache must detect changes in the dependencies too, as a module replaced by a local directory
+func TestPluginCacheDeps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomacro_plugincachedeps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(filename, content string) {
+		filename = filepath.Join(dir, filepath.FromSlash(filename))
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a/go.mod", "module example.com/a\n\nrequire example.com/b v0.0.0\n\nreplace example.com/b => ../b\n")
+	write("a/a.go", "package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/b\"\n)\n\nvar A = fmt.Sprint(b.B)\n")
+	write("b/go.mod", "module example.com/b\n")
+	write("b/b.go", "package b\n\nvar B = 1\n")
+
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	env := append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod", "GOPROXY=off")
+	dirs, err := listSourceDirs(o, "example.com/a", filepath.Join(dir, "a"), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "b"), filepath.Join(dir, "a")}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Fatalf("expecting source directories %q, found %q", expected, dirs)
+	}
+
+	imp := DefaultImporter(o)
+	digest := func() string {
+		digest, err := imp.pluginDigest("example.com/a", dirs, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+	digest0 := digest()
+	// same size and modification time, different contents
+	bgo := filepath.Join(dir, "b", "b.go")
+	info, err := os.Stat(bgo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("b/b.go", "package b\n\nvar B = 2\n")
+	if err := os.Chtimes(bgo, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	digest1 := digest()
+	if digest1 == digest0 {
+		t.Errorf("expecting a different digest after modifying a dependency")
+	}
+	write("b/b2.go", "package b\n\nvar B2 = 2\n")
+	if digest() == digest1 {
+		t.Errorf("expecting a different digest after adding a file to a dependency")
+	}
+}
+
+func TestCleanImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomacro_cleanimports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saveGoSrcDir := paths.GoSrcDir
+	paths.GoSrcDir = dir
+	defer func() {
+		paths.GoSrcDir = saveGoSrcDir
+	}()
+
+	imp := DefaultImporter(&output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	now := time.Now()
+	// create a fake import directory, with files of size bytes and modification time now - age
+	create := func(pkgpath string, size int, age time.Duration, compiled bool) {
+		pkgdir := filepath.Join(importsDir(), filepath.FromSlash(pkgpath))
+		if err := os.MkdirAll(pkgdir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(pkgdir, "x_package.go")
+		files := []string{src}
+		if compiled {
+			files = append(files, filepath.Join(pkgdir, "x_package.so"))
+		}
+		for _, file := range files {
+			if err := ioutil.WriteFile(file, bytes.Repeat([]byte{'x'}, size/len(files)), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if compiled {
+			imp.setSourceDirs(pkgpath, []string{pkgdir})
+			imp.savePluginCache(pkgpath, files[1], false)
+		}
+		for _, file := range files {
+			if err := os.Chtimes(file, now.Add(-age), now.Add(-age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	day := 24 * time.Hour
+	create("example.com/old", 100, 40*day, true)
+	create("example.com/recent", 300, day, true)
+	create("example.com/new", 200, time.Minute, true)
+	create("example.com/orphan", 50, 2*time.Hour, false)
+	create("example.com/building", 50, 10*time.Minute, false)
+
+	names := func(list []ImportsEntry) string {
+		var buf []string
+		for _, entry := range list {
+			buf = append(buf, entry.PkgPath)
+		}
+		return strings.Join(buf, " ")
+	}
+	expect := func(what string, list []ImportsEntry, err error, expected string) {
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		} else if actual := names(list); actual != expected {
+			t.Errorf("%s: expecting %q, found %q", what, expected, actual)
+		}
+	}
+
+	list, err := ListImports()
+	expect("ListImports", list, err, "example.com/old example.com/recent example.com/orphan example.com/building example.com/new")
+	if len(list) == 5 && (!list[2].Orphaned || list[0].Orphaned || list[0].Size != 100) {
+		t.Errorf("ListImports: wrong entry details %+v", list)
+	}
+
+	list, err = CleanImports(CleanOptions{OlderThan: 30 * day, DryRun: true})
+	expect("dry run", list, err, "example.com/old example.com/orphan")
+	list, err = ListImports()
+	expect("after dry run", list, err, "example.com/old example.com/recent example.com/orphan example.com/building example.com/new")
+
+	list, err = CleanImports(CleanOptions{OlderThan: 30 * day})
+	expect("older than", list, err, "example.com/old example.com/orphan")
+	if _, err := os.Stat(filepath.Join(importsDir(), "example.com", "old")); !os.IsNotExist(err) {
+		t.Errorf("expecting removed directory, found error %v", err)
+	}
+	pluginCacheLock.Lock()
+	_, cached := readPluginCache()["example.com/old"]
+	pluginCacheLock.Unlock()
+	if cached {
+		t.Errorf("expecting removed package to be forgotten by the plugin cache")
+	}
+
+	list, err = ListImports()
+	if err == nil {
+		// the least recently used entry is removed first, and pkgpath keep never
+		selected := selectImports(list, CleanOptions{MaxSize: 300}, now, "example.com/recent")
+		expect("max size, keep", selected, nil, "example.com/new")
+	}
+	list, err = CleanImports(CleanOptions{MaxSize: 300})
+	expect("max size", list, err, "example.com/recent")
+	list, err = ListImports()
+	expect("remaining", list, err, "example.com/building example.com/new")
+}
+
+func TestImportTx(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomacro_importtx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saveGoSrcDir := paths.GoSrcDir
+	paths.GoSrcDir = dir
+	defer func() {
+		paths.GoSrcDir = saveGoSrcDir
+	}()
+
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	pkgdir := filepath.Join(importsDir(), "example.com", "importtx")
+	subdir := filepath.Join(pkgdir, "sub")
+	if err := os.MkdirAll(subdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	write := func(filename, content string) {
+		if err := writeFileAtomic(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(filename string) string {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "<" + err.Error() + ">"
+		}
+		return string(data)
+	}
+	write(filepath.Join(pkgdir, "go.mod"), "old")
+	write(filepath.Join(pkgdir, "stale.go"), "old")
+	write(filepath.Join(subdir, "x_package.go"), "sub")
+
+	// an interrupted import leaves pkgdir unchanged
+	tx := beginImportTx(o, pkgdir)
+	write(filepath.Join(tx.tmp, "go.mod"), "new")
+	tmp := tx.tmp
+	tx.rollback()
+	if got := read(filepath.Join(pkgdir, "go.mod")); got != "old" {
+		t.Errorf("after rollback, go.mod contains %q, expecting %q", got, "old")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("after rollback, temporary directory %q still exists", tmp)
+	}
+
+	// a successful import replaces the files in pkgdir, preserving its subdirectories
+	tx = beginImportTx(o, pkgdir)
+	write(filepath.Join(tx.tmp, "go.mod"), "new")
+	write(filepath.Join(tx.tmp, "x_package.so"), "plugin")
+	tx.commit(o)
+	tx.rollback() // must do nothing
+	for file, expect := range map[string]string{
+		"go.mod":                             "new",
+		"x_package.so":                       "plugin",
+		filepath.Join("sub", "x_package.go"): "sub",
+	} {
+		if got := read(filepath.Join(pkgdir, file)); got != expect {
+			t.Errorf("after commit, %s contains %q, expecting %q", file, got, expect)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(pkgdir, "stale.go")); !os.IsNotExist(err) {
+		t.Errorf("after commit, stale.go still exists")
+	}
+	if got := tx.finalPath(filepath.Join(tmp, "x_package.so")); got != filepath.Join(pkgdir, "x_package.so") {
+		t.Errorf("finalPath returned %q, expecting %q", got, filepath.Join(pkgdir, "x_package.so"))
+	}
+
+	if err := RemoveImportFiles("example.com/importtx"); err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := ioutil.ReadDir(pkgdir); len(infos) != 1 || infos[0].Name() != "sub" {
+		t.Errorf("after RemoveImportFiles, %q contains %d entries, expecting only the subdirectory", pkgdir, len(infos))
+	}
+}
+
+func TestGoCmdRetry(t *testing.T) {
+	saveDelay := goCmdRetryDelay
+	goCmdRetryDelay = 0
+	defer func() {
+		goCmdRetryDelay = saveDelay
+		injectFault = nil
+	}()
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	dir := os.TempDir()
+	env := os.Environ()
+
+	for _, test := range []struct {
+		fault    string
+		failures int // number of attempts that fail with fault
+		attempts int // expected number of attempts
+		ok       bool
+	}{
+		{"", 0, 1, true},
+		{"dial tcp: lookup proxy.golang.org: i/o timeout", 2, 3, true},
+		{"dial tcp: lookup proxy.golang.org: i/o timeout", MaxGoCmdAttempts, MaxGoCmdAttempts, false},
+		{"module example.com/missing: reading 404 Not Found", 1, 1, false},
+	} {
+		attempts := 0
+		injectFault = func(args []string) error {
+			attempts++
+			if attempts <= test.failures {
+				return fmt.Errorf("%s", test.fault)
+			}
+			return nil
+		}
+		err := runGoCmd(o, dir, env, "version")
+		if attempts != test.attempts || (err == nil) != test.ok {
+			t.Errorf("fault %q failing %d times: got %d attempts and error %v, expecting %d attempts and success = %v",
+				test.fault, test.failures, attempts, err, test.attempts, test.ok)
+		}
+	}
+}
+
+func TestPluginVersioning(t *testing.T) {
+	const modpath = "gomacro.imports/example.com/foo"
+	v1, v2 := versionedModulePath(modpath), versionedModulePath(modpath)
+	if v1 == v2 || !strings.HasPrefix(v1, modpath+"/build_") || !strings.HasPrefix(v2, modpath+"/build_") {
+		t.Errorf("versionedModulePath(%q): expecting two unique paths, found %q and %q", modpath, v1, v2)
+	}
+
+	dir, err := ioutil.TempDir("", "gomacro_pluginversion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	for i, name := range []string{"build_old.so", "build_new.so", "build_older.so", "foo.go"} {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-time.Duration(i) * time.Minute)
+		if name == "build_new.so" {
+			mtime = now.Add(time.Minute)
+		}
+		os.Chtimes(file, mtime, mtime)
+	}
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	if soname := findSharedObject(o, dir); soname != filepath.Join(dir, "build_new.so") {
+		t.Errorf("findSharedObject: expecting the most recent plugin, found %q", soname)
+	}
+	var names []string
+	for _, info := range listDir(o, dir) {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "build_new.so foo.go" {
+		t.Errorf("findSharedObject: expecting superseded plugins to be removed, found %v", names)
+	}
+}
+
+func TestGenericInstances(t *testing.T) {
+	const src = `package generic
+
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr | ~float32 | ~float64 | ~string
+}
+
+func Compare[T Ordered](a, b T) int { return 0 }
+func Max[S ~[]E, E Ordered](s S) (e E) { return }
+func Index[S ~[]E, E comparable](s S, e E) int { return -1 }
+func Keys[M ~map[K]V, K comparable, V any](m M) []K { return nil }
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "generic.go", src, 0)
+	if err != nil {
+		t.Skipf("generics not supported: %v", err)
+	}
+	pkg, err := new(types.Config).Check("example.com/generic", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Skipf("generics not supported: %v", err)
+	}
+	var buf bytes.Buffer
+	writeImportFile(&output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}, &buf, "example.com/generic", pkg, nil, ImPlugin)
+	out := buf.String()
+	for _, expected := range []string{
+		"\"Compare[int]\":\tValueOf(generic.Compare[int]),",
+		"\"Compare[string]\":\tValueOf(generic.Compare[string]),",
+		"\"Max[[]float64]\":\tValueOf(generic.Max[[]float64, float64]),",
+		"\"Max[[]float64, float64]\":\tValueOf(generic.Max[[]float64, float64]),",
+		"\"Index[[]interface {}]\":\tValueOf(generic.Index[[]interface{}, interface{}]),",
+		"\"Index\":\tValueOf(generic.Index[[]interface{}, interface{}]),",
+		"\"Keys\":\tValueOf(generic.Keys[map[interface{}]interface{}, interface{}, interface{}]),",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("generated import file does not contain %q:\n%s", expected, out)
+		}
+	}
+	for _, unexpected := range []string{"\"Compare[bool]\"", "\"Max[[]complex64]\"", "\"Keys["} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("generated import file contains %q:\n%s", unexpected, out)
+		}
+	}
+}
+
+func TestAnalyzeRender(t *testing.T) {
+	fset := token.NewFileSet()
+	pkg := checkPackage(t, fset, "example.com/thirdparty", filepath.Join("testdata", "thirdparty"))
+	b := Analyze(pkg)
+	if b.Path != "example.com/thirdparty" || b.Name != "thirdparty" {
+		t.Errorf("Analyze returned path %q and name %q", b.Path, b.Name)
+	}
+	names := strings.Join(b.Names, " ")
+	if expected := "Base Big Config Default Huge Level New Open Pi Reader Ready Render Sealed Timeout Typed Version"; names != expected {
+		t.Errorf("Analyze returned names %q, expecting %q", names, expected)
+	}
+	if len(b.Warnings) != 1 || !strings.Contains(b.Warnings[0], "Huge") {
+		t.Errorf("Analyze returned warnings %q, expecting one about constant Huge", b.Warnings)
+	}
+
+	b.Names = []string{"New", "Reader"}
+	src := string(Render(b, ImBuiltin))
+	if !strings.Contains(src, `"New":	ValueOf(thirdparty.New),`) || !strings.Contains(src, "type P_example_com_thirdparty_Reader struct") {
+		t.Errorf("rendered import file does not contain the requested bindings:\n%s", src)
+	}
+	if strings.Contains(src, `"Render"`) || strings.Contains(src, `"Timeout"`) {
+		t.Errorf("rendered import file contains bindings that were not requested:\n%s", src)
+	}
+	b.Names = nil
+	if src := Render(b, ImBuiltin); src != nil {
+		t.Errorf("rendered import file with no names is not empty:\n%s", src)
+	}
+}
+
+func TestSealedInterface(t *testing.T) {
+	const src = `package sealed
+
+type hidden int
+
+type Sealed interface {
+	Name() string
+	seal(n int) hidden
+}
+type Shimmable interface {
+	Name() string
+	seal(n int) bool
+}
+type Collides interface {
+	seal()
+}
+type X_Collides int
+
+type Open interface {
+	Name() string
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "sealed.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("example.com/sealed", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{"Sealed": false, "Shimmable": true, "Collides": false, "Open": false} {
+		if found := extractSealedInterface(pkg.Scope().Lookup(name)) != nil; found != expected {
+			t.Errorf("extractSealedInterface(%s) returned %v, expecting %v", name, found, expected)
+		}
+	}
+	var buf bytes.Buffer
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	writeImportFile(o, &buf, "example.com/sealed", pkg, nil, ImPlugin)
+	if out := buf.String(); strings.Contains(out, "X_Shimmable") {
+		t.Errorf("generated plugin file contains shims for sealed interfaces:\n%s", out)
+	}
+	buf.Reset()
+	writeImportFile(o, &buf, "example.com/sealed", pkg, nil, ImInception)
+	out := buf.String()
+	for _, expected := range []string{
+		"\"X_AdaptShimmable\":\tr.ValueOf(X_AdaptShimmable),",
+		"\"X_Shimmable\":\tr.TypeOf((*P_example_com_sealed_X_Shimmable)(nil)).Elem(),",
+		"func (A x_Shimmable_adapter) seal(n int) bool {\n\treturn A.X_Shimmable.X_seal(n)\n}",
+		"\tX_seal_\tfunc(_proxy_obj_ interface{}, n int) bool\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("generated import file does not contain %q:\n%s", expected, out)
+		}
+	}
+}
+
+func TestOpaqueTypes(t *testing.T) {
+	const src = `package opaque
+
+type handle struct{ id int }
+type level int
+type options struct{ verbose bool }
+type local int
+type X_local int
+
+type Pool struct {
+	Free   []*handle
+	hidden options
+}
+
+type Opener interface {
+	Open(name string) (handle, error)
+}
+
+func (p *Pool) Get(l level) *handle { return nil }
+func New(opts ...options) *Pool   { return nil }
+func Use(f func(local) bool)       {}
+func Local() interface{} {
+	type inner int
+	return inner(0)
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "opaque.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("example.com/opaque", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf, stderr bytes.Buffer
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: &stderr}
+	writeImportFile(o, &buf, "example.com/opaque", pkg, nil, ImPlugin)
+	out := buf.String()
+	for _, expected := range []string{
+		"\"X_handle\":\tTypeOf(opaque.Opener.Open).Out(0),",
+		"\"X_level\":\tTypeOf((*opaque.Pool).Get).In(1),",
+		"\"X_options\":\tTypeOf(opaque.New).In(0).Elem(),",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("generated import file does not contain %q:\n%s", expected, out)
+		}
+	}
+	// unexported fields are not part of the API, local types cannot be named, and X_local is already declared
+	for _, unexpected := range []string{"X_inner", "TypeOf(opaque.Use)"} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("generated import file contains %q:\n%s", unexpected, out)
+		}
+	}
+	if !strings.Contains(stderr.String(), "X_local") {
+		t.Errorf("expecting a warning about X_local, found %q", stderr.String())
+	}
+	buf.Reset()
+	writeImportFile(o, &buf, "example.com/opaque", pkg, nil, ImInception)
+	if out := buf.String(); !strings.Contains(out, "\"X_handle\":\tr.TypeOf((*handle)(nil)).Elem(),") {
+		t.Errorf("generated import file does not name unexported types directly in ImInception mode:\n%s", out)
+	}
+}
+
+func TestFindProject(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/proj\n\ngo 1.13\n\n" +
+			"require (\n\tgithub.com/mattn/go-runewidth v0.0.12\n\tgopkg.in/yaml.v3 v3.0.1\n" +
+			"\texample.com/util/v2 v2.0.0\n\tgolang.org/x/sys v0.1.0 // indirect\n)\n",
+		"main.go":                "package main\n",
+		"geom/geom.go":           "package geom\n",
+		"geom/geom_test.go":      "package geom_test\n",
+		"lib/util/util.go":       "package util\n",
+		"internal/priv/priv.go":  "package priv\n",
+		"testdata/data/data.go":  "package data\n",
+		"nested/go.mod":          "module example.com/nested\n",
+		"nested/nested.go":       "package nested\n",
+		"cmd/tool/tool.go":       "package main\n",
+		"renamed/dir/source.go":  "package other\n",
+		"geom/sub/geom/geom2.go": "package geom\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proj, err := FindProject(filepath.Join(dir, "geom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"geom":      "example.com/proj/geom",
+		"util":      "example.com/proj/lib/util", // own packages are preferred over dependencies
+		"other":     "example.com/proj/renamed/dir",
+		"runewidth": "github.com/mattn/go-runewidth",
+		"yaml":      "gopkg.in/yaml.v3",
+	}
+	if proj.Module != "example.com/proj" || len(proj.Packages) != len(expected) {
+		t.Errorf("expecting module %q with packages %v, found %q with %v", "example.com/proj", expected, proj.Module, proj.Packages)
+	}
+	for name, path := range expected {
+		if proj.Packages[name] != path {
+			t.Errorf("expecting package %s at %q, found %q", name, path, proj.Packages[name])
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	imp := DefaultImporter(&output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	src := "#!/usr/bin/env gomacro\n" +
+		"//gomacro:require github.com/fatih/color v1.16.0\n" +
+		"// gomacro:require example.com/ignored v1.0.0\n" +
+		"//gomacro:requirement example.com/ignored v1.0.0\n" +
+		"\t//gomacro:require   gopkg.in/yaml.v3 v3.0.1\n"
+	if err := imp.RequireDirectives(src); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[github.com/fatih/color@v1.16.0 gopkg.in/yaml.v3@v3.0.1]"
+	if found := fmt.Sprint(imp.requirements()); found != expected {
+		t.Errorf("expecting requirements %s, found %s", expected, found)
+	}
+	for pkgpath, query := range map[string]string{
+		"github.com/fatih/color":        "github.com/fatih/color@v1.16.0",
+		"github.com/fatih/color/sub":    "github.com/fatih/color/sub@v1.16.0",
+		"github.com/fatih/colorful":     "github.com/fatih/colorful",
+		"gopkg.in/yaml.v3":              "gopkg.in/yaml.v3@v3.0.1",
+		"github.com/mattn/go-runewidth": "github.com/mattn/go-runewidth",
+	} {
+		if found := imp.goGetQuery(pkgpath); found != query {
+			t.Errorf("expecting go get %s, found %s", query, found)
+		}
+	}
+	for _, bad := range []string{
+		"//gomacro:require github.com/fatih/color\n",
+		"//gomacro:require github.com/fatih/color 1.16\n",
+		"//gomacro:require github.com/fatih/color v1.16\n",
+		"\n//gomacro:require github.com/fatih/color v2.0.0\n",
+	} {
+		if err := imp.RequireDirectives(bad); err == nil {
+			t.Errorf("expecting an error for malformed directive %q", bad)
+		}
+	}
+
+	dir := t.TempDir()
+	gomod := imp.createPluginGoModFile("github.com/fatih/color", "gomacro.imports/github.com/fatih/color", dir)
+	data, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []string{"github.com/fatih/color v1.16.0", "gopkg.in/yaml.v3 v3.0.1"} {
+		if !strings.Contains(string(data), req) {
+			t.Errorf("expecting go.mod to require %s, found:\n%s", req, data)
+		}
+	}
+}
+
+func TestImportTiming(t *testing.T) {
+	timing := ImportTiming{
+		Path:     "example.com/pkg",
+		GoList:   1500 * time.Millisecond,
+		TypeLoad: 250 * time.Millisecond,
+		Build:    3 * time.Second,
+		Total:    4750 * time.Millisecond,
+	}
+	expected := "4.75s: go list 1.5s, type load 250ms, build 3s"
+	if found := timing.String(); found != expected {
+		t.Errorf("expecting %q, found %q", expected, found)
+	}
+	timing = ImportTiming{Cached: true, Open: 20 * time.Millisecond, Total: 20 * time.Millisecond}
+	expected = "20ms, cached plugin: open 20ms"
+	if found := timing.String(); found != expected {
+		t.Errorf("expecting %q, found %q", expected, found)
+	}
+
+	imp := DefaultImporter(&output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	if imp.ImportTiming("fmt") != nil {
+		t.Errorf("expecting no timing for a package compiled into the interpreter")
+	}
+}
+
+func TestSetToolchain(t *testing.T) {
+	imports.Register("example.com/embedded", imports.Package{
+		Binds: map[string]reflect.Value{"Answer": reflect.ValueOf(42)},
+	})
+	imp := DefaultImporter(&output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	imp.SetToolchain(false)
+	ref, err := imp.ImportPackageOrError("", "example.com/embedded", true)
+	if err != nil {
+		t.Fatal(err)
+	} else if name := ref.DefaultName(); name != "embedded" {
+		t.Errorf("expecting package name embedded, found %s", name)
+	} else if answer := ref.Binds["Answer"]; !answer.IsValid() || answer.Int() != 42 {
+		t.Errorf("expecting Answer = 42, found %v", answer)
+	}
+	_, err = imp.ImportPackageOrError("", "example.com/not/embedded", true)
+	if err == nil || !strings.Contains(err.Error(), "go toolchain is disabled") {
+		t.Errorf("expecting an error because the go toolchain is disabled, found %v", err)
+	}
+}
+
+func TestImportOnly(t *testing.T) {
+	const pkgpath = "container/list"
+	fset := token.NewFileSet()
+	list, err := importer.ForCompiler(fset, "source", nil).Import(pkgpath)
+	if err != nil {
+		t.Skipf("cannot import %s from sources: %v", pkgpath, err)
+	}
+	var stderr bytes.Buffer
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: &stderr}
+
+	names := filterNames(o, pkgpath, list.Scope(), []string{"New", "Unknown", "List"})
+	if expected := []string{"List", "New"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("filterNames: expecting %q, found %q", expected, names)
+	}
+	if !strings.Contains(stderr.String(), `does not declare "Unknown"`) {
+		t.Errorf("filterNames: expecting a warning about Unknown, found %q", stderr.String())
+	}
+
+	imp := DefaultImporter(o)
+	imp.SetImportOnly(pkgpath, "New", "Unknown")
+	src := GenerateImportFile(o, pkgpath, list, imp.only[pkgpath], ImBuiltin)
+	if !strings.Contains(src, `"New":`) {
+		t.Errorf("expecting a binding for New, found:\n%s", src)
+	}
+	for _, name := range []string{"Element", "List", "Unknown"} {
+		if strings.Contains(src, `"`+name+`":`) {
+			t.Errorf("expecting no binding for %s, found:\n%s", name, src)
+		}
+	}
+	imp.SetImportOnly(pkgpath, "Unknown")
+	if src = GenerateImportFile(o, pkgpath, list, imp.only[pkgpath], ImBuiltin); src != "" {
+		t.Errorf("expecting an empty import file when only unknown names are requested, found:\n%s", src)
+	}
+	imp.SetImportOnly(pkgpath)
+	if only, found := imp.only[pkgpath]; found {
+		t.Errorf("SetImportOnly without names: expecting no restriction, found %q", only)
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+// type-check the package in directory dir, importing the standard library from sources
+func checkPackage(t *testing.T, fset *token.FileSet, pkgpath string, dir string) *types.Package {
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []*ast.File
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			files = append(files, file)
+		}
+	}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := config.Check(pkgpath, fset, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestGoldenImportFiles(t *testing.T) {
+	fset := token.NewFileSet()
+	o := &output.Output{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	list, err := importer.ForCompiler(fset, "source", nil).Import("container/list")
+	if err != nil {
+		t.Skipf("cannot import container/list from sources: %v", err)
+	}
+	thirdparty := checkPackage(t, fset, "example.com/thirdparty", filepath.Join("testdata", "thirdparty"))
+
+	for _, test := range []struct {
+		golden string
+		pkg    *types.Package
+		mode   ImportMode
+	}{
+		{"container_list.golden", list, ImBuiltin},
+		{"thirdparty_plugin.golden", thirdparty, ImPlugin},
+		{"thirdparty_inception.golden", thirdparty, ImInception},
+		{"thirdparty_embed.golden", thirdparty, ImEmbed},
+	} {
+		src := GenerateImportFile(o, test.pkg.Path(), test.pkg, nil, test.mode)
+		if rendered := Render(Analyze(test.pkg), test.mode); string(rendered) != src {
+			t.Errorf("%s: Render(Analyze(pkg)) differs from GenerateImportFile:\n%s", test.golden, rendered)
+		}
+		// map iteration order changes at each run: generating again must produce the same output
+		for i := 0; i < 10; i++ {
+			if again := GenerateImportFile(o, test.pkg.Path(), test.pkg, nil, test.mode); again != src {
+				t.Fatalf("%s: generated import file is not deterministic:\n%s\n---- versus ----\n%s", test.golden, src, again)
+			}
+		}
+		golden := filepath.Join("testdata", test.golden)
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src != string(expected) {
+			t.Errorf("%s: generated import file differs from golden file, run go test -update to regenerate it. found:\n%s", test.golden, src)
+		}
+	}
+}
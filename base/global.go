@@ -19,6 +19,7 @@ package base
 import (
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/token"
 	"io"
 	"os"
@@ -29,9 +30,10 @@ import (
 	"github.com/cosmos72/gomacro/base/genimport"
 	"github.com/cosmos72/gomacro/base/output"
 	"github.com/cosmos72/gomacro/base/reflect"
+	"github.com/cosmos72/gomacro/base/untyped"
 	etoken "github.com/cosmos72/gomacro/go/etoken"
 	mp "github.com/cosmos72/gomacro/go/parser"
-	"github.com/cosmos72/gomacro/imports"
+	"github.com/cosmos72/gomacro/go/scanner"
 	xr "github.com/cosmos72/gomacro/xreflect"
 )
 
@@ -64,6 +66,14 @@ type Globals struct {
 	MacroChar    rune // prefix for macro-related keywords macro, quote, quasiquote, splice... The default is '~'
 	ReplCmdChar  byte // prefix for special REPL commands env, help, inspect, quit, unload... The default is ':'
 	Inspector    Inspector
+	// how to print untyped floating-point and complex constants.
+	// The zero value prints them as exact fractions
+	UntypedFormat untyped.Format
+	// which TermReadline implementation is used by interactive REPLs
+	Terminal TerminalMode
+	// GOOS, GOARCH and build tags used to choose which files to load from a directory.
+	// The default is build.Default, i.e. the platform gomacro is running on
+	BuildContext build.Context
 }
 
 func NewGlobals() *Globals {
@@ -94,6 +104,7 @@ func NewGlobals() *Globals {
 		ParserMode:   0,
 		MacroChar:    '~',
 		ReplCmdChar:  ':', // Jupyter and gophernotes would probably set this to '%'
+		BuildContext: build.Default,
 	}
 	g.Importer = genimport.DefaultImporter(&g.Output)
 	return g
@@ -161,17 +172,31 @@ func (g *Globals) ParseBytes(src []byte) []ast.Node {
 	} else {
 		mode &^= mp.Trace
 	}
-	if g.Options&OptDebugger != 0 {
-		// to show source code in debugger
+	if g.Options&(OptDebugger|OptTrackProvenance|OptHotspots) != 0 {
+		// to show source code in debugger, :whence and hotspots
 		mode |= mp.CopySources
 	} else {
 		mode &^= mp.CopySources
 	}
+	// needed by //go:embed directives
+	mode |= mp.ParseComments
+	if g.Options&OptExtLambdas != 0 {
+		mode |= mp.Lambdas
+	} else {
+		mode &^= mp.Lambdas
+	}
+	if g.Options&OptExtBigNums != 0 {
+		mode |= mp.BigNums
+	} else {
+		mode &^= mp.BigNums
+	}
 	parser.Configure(mode, g.MacroChar)
 	parser.Init(g.Fileset, g.Filepath, g.Line, src)
 
 	nodes, err := parser.Parse()
-	if err != nil {
+	if list, ok := err.(scanner.ErrorList); ok {
+		output.Error(&ParseError{List: list, Source: string(src), Line: g.Line})
+	} else if err != nil {
 		output.Error(err)
 	}
 	return nodes
@@ -189,11 +214,11 @@ func (g *Globals) PrintR(values []r.Value, types []xr.Type) {
 				} else {
 					ti = reflect.ValueTypeR(vi)
 				}
-				g.Fprintf(g.Stdout, "%v\t// %v\n", vi, ti)
+				g.Fprintf(g.Stdout, "%v\t// %v\n", g.Printable(vi), ti)
 			}
 		} else {
 			for _, vi := range values {
-				g.Fprintf(g.Stdout, "%v\n", vi)
+				g.Fprintf(g.Stdout, "%v\n", g.Printable(vi))
 			}
 		}
 	}
@@ -210,16 +235,27 @@ func (g *Globals) Print(values []xr.Value, types []xr.Type) {
 				} else {
 					ti = reflect.ValueType(vi)
 				}
-				g.Fprintf(g.Stdout, "%v\t// %v\n", vi.ReflectValue(), ti)
+				g.Fprintf(g.Stdout, "%v\t// %v\n", g.Printable(vi.ReflectValue()), ti)
 			}
 		} else {
 			for _, vi := range values {
-				g.Fprintf(g.Stdout, "%v\n", vi.ReflectValue())
+				g.Fprintf(g.Stdout, "%v\n", g.Printable(vi.ReflectValue()))
 			}
 		}
 	}
 }
 
+// Printable returns the value to print instead of v:
+// untyped constants are formatted according to g.UntypedFormat
+func (g *Globals) Printable(v r.Value) interface{} {
+	if v.IsValid() && v.CanInterface() {
+		if lit, ok := v.Interface().(untyped.Lit); ok {
+			return lit.StringWith(g.UntypedFormat)
+		}
+	}
+	return v
+}
+
 // remove package 'path' from the list of known packages.
 // later attempts to import it again will trigger a recompile.
 func (g *Globals) UnloadPackage(path string) {
@@ -227,14 +263,16 @@ func (g *Globals) UnloadPackage(path string) {
 		path = path[1 : n-1] // remove quotes
 	}
 	slash := strings.IndexByte(path, '/')
-	if _, found := imports.Packages[path]; !found {
+	registry := g.Importer.Registry()
+	if _, found := registry.Lookup(path); !found {
 		if slash < 0 {
 			g.Debugf("nothing to unload: cannot find imported package %q. Remember to specify the full package path, not only its name", path)
 		} else {
 			g.Debugf("nothing to unload: cannot find imported package %q", path)
 		}
 	}
-	delete(imports.Packages, path)
+	registry.Delete(path)
+	genimport.ForgetCachedPlugin(path)
 	dot := strings.IndexByte(path, '.')
 	if slash < 0 || dot > slash {
 		g.Warnf("unloaded standard library package %q. attempts to import it again will trigger a recompile", path)
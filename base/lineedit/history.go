@@ -0,0 +1,164 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * history.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package lineedit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expandHistory performs shell-style history expansion of text:
+//
+//	!!   the previous line
+//	!n   the line number n of the history, counting from 1
+//	!-n  the n-th previous line
+//	!$   the last argument of the previous line
+//
+// To preserve Go code as !!ok, !!(x) or x != y, "!!" is not expanded if followed
+// by an identifier character or '(', and nothing is expanded inside string
+// or rune literals and comments.
+// Returns an error if text refers to a missing history entry
+func (s *State) expandHistory(text string) (string, error) {
+	if strings.IndexByte(text, '!') < 0 {
+		return text, nil
+	}
+	var buf strings.Builder
+	var quote byte // the quote of the string or rune literal containing text[i], or 0
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote != '`' && i+1 < len(text) {
+				buf.WriteByte(ch)
+				i++
+				ch = text[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '`' || ch == '\'':
+			quote = ch
+		case ch == '/' && strings.HasPrefix(text[i:], "//"):
+			// comment up to the end of line
+			buf.WriteString(text[i:])
+			return buf.String(), nil
+		case ch == '!' && i+1 < len(text):
+			event, n := s.historyEvent(text[i+1:])
+			if n == 0 {
+				break
+			}
+			if len(event) == 0 {
+				return text, fmt.Errorf("%s: event not found", text[i:i+1+n])
+			}
+			buf.WriteString(event)
+			i += n
+			continue
+		}
+		buf.WriteByte(ch)
+	}
+	return buf.String(), nil
+}
+
+// parse the history reference after a '!' and return the text it expands to,
+// and the number of bytes of str it consumes. Returns n == 0 if str is not a history reference,
+// and an empty string if the history entry does not exist
+func (s *State) historyEvent(str string) (event string, n int) {
+	switch ch := str[0]; {
+	case ch == '!':
+		if len(str) > 1 && (isIdentByte(str[1]) || str[1] == '(') {
+			return "", 0
+		}
+		return s.historyEntry(len(s.history)), 1
+	case ch == '$':
+		return lastArg(s.historyEntry(len(s.history))), 1
+	case ch == '-' || ch >= '0' && ch <= '9':
+		n = 1
+		for n < len(str) && str[n] >= '0' && str[n] <= '9' {
+			n++
+		}
+		num, err := strconv.Atoi(str[:n])
+		if err != nil {
+			return "", 0
+		} else if num < 0 {
+			return s.historyEntry(len(s.history) + 1 + num), n
+		}
+		return s.historyEntry(num), n
+	}
+	return "", 0
+}
+
+// return the history entry number num, counting from 1, or the empty string if it does not exist
+func (s *State) historyEntry(num int) string {
+	if num < 1 || num > len(s.history) {
+		return ""
+	}
+	return s.history[num-1]
+}
+
+func isIdentByte(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch >= 0x80
+}
+
+// return the last argument of line: its last word, without the surrounding punctuation of Go calls.
+// For example, the last argument of "fmt.Println(a, b.c)" is "b.c"
+// and the last argument of ":load file.go" is "file.go"
+func lastArg(line string) string {
+	words := strings.Fields(line)
+	for i := len(words) - 1; i >= 0; i-- {
+		word := strings.TrimRight(words[i], ")]};,")
+		if pos := strings.LastIndexAny(word, "([{,"); pos >= 0 {
+			word = word[pos+1:]
+		}
+		if len(word) != 0 {
+			return word
+		}
+	}
+	return ""
+}
+
+// yankState remembers the argument inserted by the last Alt-.
+type yankState struct {
+	hist       int // history entry the argument was taken from
+	start, end int // position of the inserted argument in the line
+}
+
+// insert at cursor the last argument of the previous history entry, as Alt-. in bash.
+// If again is true, i.e. the previous key was also Alt-., replace the argument it inserted
+// with the last argument of the history entry before
+func (s *State) yankLastArg(l *line, y *yankState, again bool) bool {
+	hist := len(s.history)
+	if again {
+		hist = y.hist
+	}
+	for hist > 0 {
+		hist--
+		arg := lastArg(s.history[hist])
+		if len(arg) == 0 {
+			continue
+		}
+		if again {
+			l.text = l.text[:y.start] + l.text[y.end:]
+			l.pos = y.start
+		}
+		y.hist, y.start = hist, l.pos
+		l.insert(arg)
+		y.end = l.pos
+		return true
+	}
+	s.write("\a")
+	return again
+}
@@ -0,0 +1,224 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * line.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package lineedit
+
+import (
+	"bytes"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// line is the text being edited.
+// The cursor pos is a byte offset into text,
+// and it is always kept at a grapheme cluster boundary
+type line struct {
+	text string
+	pos  int
+}
+
+// return the byte offsets of grapheme cluster boundaries in text,
+// including 0 and len(text)
+func boundaries(text string) []int {
+	ret := []int{0}
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		_, end := g.Positions()
+		ret = append(ret, end)
+	}
+	return ret
+}
+
+func (l *line) set(text string) {
+	l.text = text
+	l.pos = len(text)
+}
+
+// insert s at cursor position, then move the cursor after it
+func (l *line) insert(s string) {
+	l.text = l.text[:l.pos] + s + l.text[l.pos:]
+	l.pos += len(s)
+	l.snap()
+}
+
+// move the cursor forward to the nearest grapheme cluster boundary.
+// needed after inserting combining characters or joiners
+func (l *line) snap() {
+	for _, b := range boundaries(l.text) {
+		if b >= l.pos {
+			l.pos = b
+			return
+		}
+	}
+	l.pos = len(l.text)
+}
+
+// return the grapheme cluster boundary before cursor
+func (l *line) prev() int {
+	prev := 0
+	for _, b := range boundaries(l.text) {
+		if b >= l.pos {
+			break
+		}
+		prev = b
+	}
+	return prev
+}
+
+// return the grapheme cluster boundary after cursor
+func (l *line) next() int {
+	for _, b := range boundaries(l.text) {
+		if b > l.pos {
+			return b
+		}
+	}
+	return len(l.text)
+}
+
+func (l *line) left() {
+	l.pos = l.prev()
+}
+
+func (l *line) right() {
+	l.pos = l.next()
+}
+
+func (l *line) home() {
+	l.pos = 0
+}
+
+func (l *line) end() {
+	l.pos = len(l.text)
+}
+
+// delete the grapheme cluster before cursor
+func (l *line) backspace() {
+	prev := l.prev()
+	l.text = l.text[:prev] + l.text[l.pos:]
+	l.pos = prev
+}
+
+// delete the grapheme cluster at cursor
+func (l *line) del() {
+	next := l.next()
+	l.text = l.text[:l.pos] + l.text[next:]
+}
+
+// delete from cursor to end of line
+func (l *line) killEnd() {
+	l.text = l.text[:l.pos]
+}
+
+// delete from start of line to cursor
+func (l *line) killStart() {
+	l.text = l.text[l.pos:]
+	l.pos = 0
+}
+
+func isWordChar(text string, pos int) bool {
+	r, _ := utf8.DecodeRuneInString(text[pos:])
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// return the start of the word before cursor
+func (l *line) wordStart() int {
+	bs := boundaries(l.text)
+	i := len(bs) - 1
+	for i > 0 && bs[i] > l.pos {
+		i--
+	}
+	// skip non-word clusters, then word clusters
+	for i > 0 && !isWordChar(l.text, bs[i-1]) {
+		i--
+	}
+	for i > 0 && isWordChar(l.text, bs[i-1]) {
+		i--
+	}
+	return bs[i]
+}
+
+// return the end of the word after cursor
+func (l *line) wordEnd() int {
+	bs := boundaries(l.text)
+	i := 0
+	for i < len(bs)-1 && bs[i] < l.pos {
+		i++
+	}
+	for i < len(bs)-1 && !isWordChar(l.text, bs[i]) {
+		i++
+	}
+	for i < len(bs)-1 && isWordChar(l.text, bs[i]) {
+		i++
+	}
+	return bs[i]
+}
+
+func (l *line) wordLeft() {
+	l.pos = l.wordStart()
+}
+
+func (l *line) wordRight() {
+	l.pos = l.wordEnd()
+}
+
+// delete the word before cursor
+func (l *line) killWordLeft() {
+	start := l.wordStart()
+	l.text = l.text[:start] + l.text[l.pos:]
+	l.pos = start
+}
+
+// delete the word after cursor
+func (l *line) killWordRight() {
+	end := l.wordEnd()
+	l.text = l.text[:l.pos] + l.text[end:]
+}
+
+// render the prompt followed by the portion of the line
+// that fits in a terminal with the given number of columns,
+// scrolling horizontally as needed to keep the cursor visible
+func (l *line) render(buf *bytes.Buffer, prompt string, columns int) {
+	avail := columns - DisplayWidth(prompt) - 1
+	if avail < 1 {
+		avail = 1
+	}
+	bs := boundaries(l.text)
+	// find the first visible cluster: the cursor must be visible
+	first := 0
+	for first < len(bs)-1 && bs[first] < l.pos && DisplayWidth(l.text[bs[first]:l.pos]) > avail {
+		first++
+	}
+	start := bs[first]
+	// find the last visible cluster
+	last := first
+	for last < len(bs)-1 && DisplayWidth(l.text[start:bs[last+1]]) <= avail {
+		last++
+	}
+	end := bs[last]
+
+	buf.WriteString("\r")
+	buf.WriteString(stripMarkers(prompt))
+	buf.WriteString(l.text[start:end])
+	buf.WriteString("\033[K\r")
+	if col := DisplayWidth(prompt) + DisplayWidth(l.text[start:l.pos]); col > 0 {
+		buf.WriteString("\033[")
+		buf.WriteString(strconv.Itoa(col))
+		buf.WriteString("C")
+	}
+}
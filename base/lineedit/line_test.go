@@ -0,0 +1,139 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * line_test.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package lineedit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	for _, test := range []struct {
+		s     string
+		width int
+	}{
+		{"gomacro> ", 9},
+		{"日本語", 6},
+		{"e\u0301", 1},              // e + combining acute accent
+		{"\U0001F44D\U0001F3FD", 2}, // thumbs up + skin tone modifier
+		{"\U0001F468\u200D\U0001F469\u200D\U0001F467", 2}, // family: ZWJ sequence
+		{"\U0001F1EE\U0001F1F9", 2},                       // flag: regional indicator pair
+		{"\033[1;32mgomacro>\033[0m ", 9},                 // ANSI colors
+		{"\001\033[1;32m\002gomacro>\001\033[0m\002 ", 9}, // GNU readline markers
+	} {
+		if width := DisplayWidth(test.s); width != test.width {
+			t.Errorf("DisplayWidth(%q): expecting %d, found %d", test.s, test.width, width)
+		}
+	}
+}
+
+func TestLineEdit(t *testing.T) {
+	var l line
+	l.insert("a日")
+	l.insert("e")
+	l.insert("\u0301") // combining accent joins the previous cluster
+	l.insert("👍")
+	if l.text != "a日e\u0301👍" || l.pos != len(l.text) {
+		t.Errorf("insert: found %q pos %d", l.text, l.pos)
+	}
+	l.left()
+	l.left()
+	if l.pos != len("a日") {
+		t.Errorf("left: expecting pos %d, found %d", len("a日"), l.pos)
+	}
+	l.del()
+	if l.text != "a日👍" {
+		t.Errorf("del: expecting %q, found %q", "a日👍", l.text)
+	}
+	l.backspace()
+	if l.text != "a👍" || l.pos != 1 {
+		t.Errorf("backspace: found %q pos %d", l.text, l.pos)
+	}
+	l.set("foo.bar baz")
+	l.killWordLeft()
+	if l.text != "foo.bar " {
+		t.Errorf("killWordLeft: expecting %q, found %q", "foo.bar ", l.text)
+	}
+	l.wordLeft()
+	if l.pos != len("foo.") {
+		t.Errorf("wordLeft: expecting pos %d, found %d", len("foo."), l.pos)
+	}
+}
+
+func TestLineRender(t *testing.T) {
+	l := line{text: "日本語日本語", pos: len("日本")}
+	var buf bytes.Buffer
+	l.render(&buf, "\001\033[1m\002> \001\033[0m\002", 80)
+	expected := "\r\033[1m> \033[0m日本語日本語\033[K\r\033[6C"
+	if buf.String() != expected {
+		t.Errorf("render: expecting %q, found %q", expected, buf.String())
+	}
+	// horizontal scrolling: 6 columns available, cursor at end
+	l.end()
+	buf.Reset()
+	l.render(&buf, "> ", 9)
+	expected = "\r> 日本語\033[K\r\033[8C"
+	if buf.String() != expected {
+		t.Errorf("render: expecting %q, found %q", expected, buf.String())
+	}
+}
+
+func TestHistoryExpansion(t *testing.T) {
+	s := &State{out: ioutil.Discard, history: []string{`:load "foo.go"`, "x := 7", "fmt.Println(a, b.c)"}}
+	for _, test := range []struct {
+		text, expected string
+	}{
+		{"!!", "fmt.Println(a, b.c)"},
+		{"y := !$ + 1", "y := b.c + 1"},
+		{"!1", `:load "foo.go"`},
+		{"!-2; x++", "x := 7; x++"},
+		{"!!ok && x != y", "!!ok && x != y"},
+		{"!!(x)", "!!(x)"},
+		{`"!!" + '!' // !!`, `"!!" + '!' // !!`},
+	} {
+		if actual, err := s.expandHistory(test.text); err != nil || actual != test.expected {
+			t.Errorf("expandHistory(%q): expecting %q, found %q, error %v", test.text, test.expected, actual, err)
+		}
+	}
+	for _, text := range []string{"!4", "!-4", "!0"} {
+		if _, err := s.expandHistory(text); err == nil {
+			t.Errorf("expandHistory(%q): expecting error, found nil", text)
+		}
+	}
+	if _, err := (&State{}).expandHistory("!!"); err == nil {
+		t.Errorf("expandHistory(%q) with empty history: expecting error, found nil", "!!")
+	}
+}
+
+func TestYankLastArg(t *testing.T) {
+	s := &State{out: ioutil.Discard, history: []string{`:load "foo.go"`, "x := f(y)", "  "}}
+	l := line{text: "g()", pos: 2}
+	var y yankState
+	again := s.yankLastArg(&l, &y, false)
+	if l.text != "g(y)" || l.pos != 3 {
+		t.Errorf("yankLastArg: found %q pos %d", l.text, l.pos)
+	}
+	again = s.yankLastArg(&l, &y, again)
+	if l.text != `g("foo.go")` || l.pos != len(`g("foo.go"`) {
+		t.Errorf("yankLastArg again: found %q pos %d", l.text, l.pos)
+	}
+	// no older entries: the line is unchanged
+	if !s.yankLastArg(&l, &y, again) || l.text != `g("foo.go")` {
+		t.Errorf("yankLastArg at oldest entry: found %q", l.text)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * lineedit.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+// Package lineedit is a line editor for terminals, aware of Unicode grapheme clusters
+// and wide characters: cursor movement and deletion operate on user-perceived characters,
+// and prompts may contain ANSI color escapes.
+package lineedit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// WordCompleter has the same signature as github.com/peterh/liner.WordCompleter:
+// it receives the line and the cursor position, and returns the text before the word
+// being completed, the possible completions and the text after the cursor
+type WordCompleter = func(line string, pos int) (head string, completions []string, tail string)
+
+// ErrUnsupported is returned by New if standard input or output is not a terminal,
+// or if the operating system is not supported
+var ErrUnsupported = errors.New("lineedit: standard input or output is not a supported terminal")
+
+// HistoryLimit is the maximum number of history lines kept in memory
+const HistoryLimit = 1000
+
+const (
+	ctrlA     = 'A' - '@'
+	ctrlB     = 'B' - '@'
+	ctrlC     = 'C' - '@'
+	ctrlD     = 'D' - '@'
+	ctrlE     = 'E' - '@'
+	ctrlF     = 'F' - '@'
+	ctrlH     = 'H' - '@'
+	tab       = 'I' - '@'
+	lf        = 'J' - '@'
+	ctrlK     = 'K' - '@'
+	ctrlL     = 'L' - '@'
+	cr        = 'M' - '@'
+	ctrlN     = 'N' - '@'
+	ctrlP     = 'P' - '@'
+	ctrlU     = 'U' - '@'
+	ctrlW     = 'W' - '@'
+	backspace = 0x7F
+)
+
+type State struct {
+	in        *bufio.Reader
+	out       io.Writer
+	fd        uintptr
+	history   []string
+	completer WordCompleter
+	columns   int
+}
+
+// New creates a line editor reading from standard input and writing to standard output.
+// Returns ErrUnsupported if they are not terminals
+func New() (*State, error) {
+	if !isTerminal(os.Stdin.Fd()) || !isTerminal(os.Stdout.Fd()) {
+		return nil, ErrUnsupported
+	}
+	return &State{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+		fd:  os.Stdin.Fd(),
+	}, nil
+}
+
+func (s *State) SetWordCompleter(completer WordCompleter) {
+	s.completer = completer
+}
+
+// AppendHistory adds line to the history, unless it's equal to the most recent entry
+func (s *State) AppendHistory(line string) {
+	if n := len(s.history); n != 0 && s.history[n-1] == line {
+		return
+	}
+	s.history = append(s.history, line)
+	if n := len(s.history); n > HistoryLimit {
+		s.history = s.history[n-HistoryLimit:]
+	}
+}
+
+// ReadHistory appends to the history the lines read from r.
+// Returns the number of lines read
+func (s *State) ReadHistory(r io.Reader) (int, error) {
+	n := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s.AppendHistory(scanner.Text())
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// WriteHistory writes the history to w, one entry per line.
+// Returns the number of lines written
+func (s *State) WriteHistory(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	for i, line := range s.history {
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return i, err
+		}
+	}
+	return len(s.history), bw.Flush()
+}
+
+// Close does nothing: the terminal is restored to its original mode
+// at the end of each Prompt()
+func (s *State) Close() error {
+	return nil
+}
+
+// Prompt displays prompt and returns the line typed by the user, without the final newline.
+// Returns io.EOF if the user presses Ctrl+D on an empty line.
+// Ctrl+C discards the current line and starts editing a new one.
+// Alt+. inserts the last argument of the previous line, and history references
+// as !! and !$ are expanded when pressing Enter, see expandHistory
+func (s *State) Prompt(prompt string) (string, error) {
+	orig, err := makeRaw(s.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore(s.fd, orig)
+	s.columns = terminalColumns(s.fd)
+
+	var l line
+	hist := len(s.history) // index of the history entry being edited
+	var saved string       // line being edited before browsing the history
+	var yank yankState     // argument inserted by the last Alt-.
+	var lastTab, lastYank bool
+	s.refresh(prompt, &l)
+	for {
+		r, _, err := s.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		isTab, isYank := false, false
+		switch r {
+		case cr, lf:
+			text, err := s.expandHistory(l.text)
+			if err != nil {
+				s.write("\r\n" + err.Error() + "\r\n")
+				break
+			} else if text != l.text {
+				// show the expanded line
+				l.set(text)
+				s.refresh(prompt, &l)
+			}
+			s.write("\r\n")
+			return text, nil
+		case ctrlA:
+			l.home()
+		case ctrlB:
+			l.left()
+		case ctrlC:
+			s.write("^C\r\n")
+			l = line{}
+			hist = len(s.history)
+		case ctrlD:
+			if len(l.text) == 0 {
+				s.write("\r\n")
+				return "", io.EOF
+			}
+			l.del()
+		case ctrlE:
+			l.end()
+		case ctrlF:
+			l.right()
+		case ctrlH, backspace:
+			l.backspace()
+		case tab:
+			isTab = true
+			s.complete(&l, lastTab)
+		case ctrlK:
+			l.killEnd()
+		case ctrlL:
+			s.write("\033[H\033[2J")
+		case ctrlN:
+			hist, saved = s.historyMove(&l, hist, +1, saved)
+		case ctrlP:
+			hist, saved = s.historyMove(&l, hist, -1, saved)
+		case ctrlU:
+			l.killStart()
+		case ctrlW:
+			l.killWordLeft()
+		case esc:
+			switch s.readEscape() {
+			case "[A", "OA":
+				hist, saved = s.historyMove(&l, hist, -1, saved)
+			case "[B", "OB":
+				hist, saved = s.historyMove(&l, hist, +1, saved)
+			case "[C", "OC":
+				l.right()
+			case "[D", "OD":
+				l.left()
+			case "[H", "OH", "[1~", "[7~":
+				l.home()
+			case "[F", "OF", "[4~", "[8~":
+				l.end()
+			case "[3~":
+				l.del()
+			case "b", "[1;5D", "[1;3D":
+				l.wordLeft()
+			case "f", "[1;5C", "[1;3C":
+				l.wordRight()
+			case "d":
+				l.killWordRight()
+			case "\177", "\b":
+				l.killWordLeft()
+			case ".", "_":
+				isYank = s.yankLastArg(&l, &yank, lastYank)
+			}
+		default:
+			if r >= ' ' {
+				l.insert(string(r))
+			}
+		}
+		lastTab, lastYank = isTab, isYank
+		s.refresh(prompt, &l)
+	}
+}
+
+// read the escape sequence following ESC, and return it without the initial ESC
+func (s *State) readEscape() string {
+	r, _, err := s.in.ReadRune()
+	if err != nil {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteRune(r)
+	switch r {
+	case '[':
+		// CSI: read until a final byte in 0x40 ... 0x7E
+		for {
+			r, _, err = s.in.ReadRune()
+			if err != nil {
+				break
+			}
+			buf.WriteRune(r)
+			if r >= 0x40 && r <= 0x7E {
+				break
+			}
+		}
+	case 'O':
+		if r, _, err = s.in.ReadRune(); err == nil {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// move to previous (delta < 0) or next (delta > 0) history entry.
+// returns the updated history index and saved line
+func (s *State) historyMove(l *line, hist int, delta int, saved string) (int, string) {
+	n := len(s.history)
+	next := hist + delta
+	if next < 0 || next > n {
+		s.write("\a")
+		return hist, saved
+	}
+	if hist == n {
+		saved = l.text
+	}
+	if next == n {
+		l.set(saved)
+	} else {
+		l.set(s.history[next])
+	}
+	return next, saved
+}
+
+// complete the word before cursor. if it cannot be extended
+// and the previous key was also TAB, list the possible completions
+func (s *State) complete(l *line, listAll bool) {
+	if s.completer == nil {
+		return
+	}
+	head, completions, tail := s.completer(l.text, l.pos)
+	switch len(completions) {
+	case 0:
+		s.write("\a")
+		return
+	case 1:
+		l.text = head + completions[0] + tail
+		l.pos = len(head) + len(completions[0])
+		return
+	}
+	prefix := commonPrefix(completions)
+	if len(head)+len(prefix) > l.pos {
+		l.text = head + prefix + tail
+		l.pos = len(head) + len(prefix)
+	} else if listAll {
+		var buf bytes.Buffer
+		buf.WriteString("\r\n")
+		for _, completion := range completions {
+			buf.WriteString(completion)
+			buf.WriteString("  ")
+		}
+		buf.WriteString("\r\n")
+		s.write(buf.String())
+	} else {
+		s.write("\a")
+	}
+}
+
+// return the longest common prefix of all strings, cut at a rune boundary
+func commonPrefix(strs []string) string {
+	prefix := []rune(strs[0])
+	for _, str := range strs[1:] {
+		i := 0
+		for _, r := range str {
+			if i >= len(prefix) || prefix[i] != r {
+				break
+			}
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return string(prefix)
+}
+
+func (s *State) refresh(prompt string, l *line) {
+	var buf bytes.Buffer
+	l.render(&buf, prompt, s.columns)
+	s.out.Write(buf.Bytes())
+}
+
+func (s *State) write(str string) {
+	io.WriteString(s.out, str)
+}
@@ -0,0 +1,140 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * width.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package lineedit
+
+import (
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	// GNU readline convention: bytes between markerStart and markerEnd
+	// are sent to the terminal but occupy no columns, as for example color escapes
+	markerStart = '\001'
+	markerEnd   = '\002'
+	esc         = '\033'
+	bel         = '\007'
+)
+
+// DisplayWidth returns the number of terminal columns occupied by s.
+// It is grapheme-cluster aware: combining marks, emoji ZWJ sequences
+// and flags are counted once, East Asian wide characters count twice.
+// ANSI escape sequences and the \001 ... \002 sections used by GNU readline
+// to delimit non-printing prompt characters occupy zero columns.
+func DisplayWidth(s string) int {
+	s = StripEscapes(s)
+	width := 0
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		width += clusterWidth(g.Runes())
+	}
+	return width
+}
+
+// return the number of columns occupied by a grapheme cluster
+func clusterWidth(cluster []rune) int {
+	if len(cluster) == 2 && isRegionalIndicator(cluster[0]) && isRegionalIndicator(cluster[1]) {
+		// flag
+		return 2
+	}
+	width := 0
+	for _, r := range cluster {
+		if r == '\uFE0F' {
+			// variation selector-16: emoji presentation, always two columns wide
+			return 2
+		} else if width == 0 {
+			width = runewidth.RuneWidth(r)
+		}
+	}
+	return width
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// StripEscapes removes from s the ANSI escape sequences
+// and the \001 ... \002 sections, returning only the printable text
+func StripEscapes(s string) string {
+	if strings.IndexByte(s, esc) < 0 && strings.IndexByte(s, markerStart) < 0 {
+		return s
+	}
+	var buf strings.Builder
+	for i, n := 0, len(s); i < n; {
+		switch s[i] {
+		case markerStart:
+			i++
+			for i < n && s[i] != markerEnd {
+				i++
+			}
+			i++
+		case esc:
+			i = skipEscape(s, i)
+		default:
+			buf.WriteByte(s[i])
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// remove the \001 and \002 markers from s, keeping everything else
+func stripMarkers(s string) string {
+	if strings.IndexByte(s, markerStart) < 0 && strings.IndexByte(s, markerEnd) < 0 {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if r == markerStart || r == markerEnd {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// s[i] is ESC: return the index of the first byte after the escape sequence
+func skipEscape(s string, i int) int {
+	n := len(s)
+	i++
+	if i >= n {
+		return n
+	}
+	switch s[i] {
+	case '[':
+		// CSI: parameters and intermediate bytes, terminated by a byte in 0x40 ... 0x7E
+		for i++; i < n; i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7E {
+				return i + 1
+			}
+		}
+		return n
+	case ']':
+		// OSC: terminated by BEL or by ESC \
+		for i++; i < n; i++ {
+			if s[i] == bel {
+				return i + 1
+			} else if s[i] == esc && i+1 < n && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return n
+	default:
+		// two-bytes escape sequence
+		return i + 1
+	}
+}
@@ -0,0 +1,280 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * cycle.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	r "reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/cosmos72/gomacro/ast2"
+)
+
+// identity of a pointer, map or slice visited while printing a value
+type cycleKey struct {
+	ptr uintptr
+	typ r.Type
+	len int
+}
+
+// cyclePrinter formats values that contain cycles, which would make fmt recurse forever.
+// Each pointer, map or slice referenced from inside itself is prefixed by a label #N=
+// and the references to it from inside itself are printed as &↩#N
+type cyclePrinter struct {
+	labels  map[cycleKey]int  // targets of back references
+	path    map[cycleKey]bool // pointers, maps and slices being visited
+	acyclic map[cycleKey]bool // pointers, maps and slices already visited and not part of a cycle
+	buf     bytes.Buffer
+}
+
+// return the identity of v, and true if v is a non-nil pointer, map or slice
+func cycleKeyOf(v r.Value) (cycleKey, bool) {
+	switch v.Kind() {
+	case r.Ptr, r.Map:
+		if !v.IsNil() {
+			return cycleKey{v.Pointer(), v.Type(), 0}, true
+		}
+	case r.Slice:
+		if v.Len() != 0 {
+			return cycleKey{v.Pointer(), v.Type(), v.Len()}, true
+		}
+	}
+	return cycleKey{}, false
+}
+
+// return false if values of type t cannot contain pointers, maps, slices or interfaces
+func mayContainRefs(t r.Type) bool {
+	switch t.Kind() {
+	case r.Array:
+		return mayContainRefs(t.Elem())
+	case r.Struct:
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if mayContainRefs(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case r.Ptr, r.Map, r.Slice, r.Interface:
+		return true
+	default:
+		// channels and functions are printed as addresses, strings do not contain references
+		return false
+	}
+}
+
+// findCycles visits v and labels the targets of back references.
+// Returns true if v contains at least one cycle
+func (p *cyclePrinter) findCycles(v r.Value) bool {
+	p.labels = nil
+	p.path = make(map[cycleKey]bool)
+	p.acyclic = make(map[cycleKey]bool)
+	p.visit(v)
+	p.path = nil
+	p.acyclic = nil
+	return len(p.labels) != 0
+}
+
+func (p *cyclePrinter) visit(v r.Value) {
+	if !v.IsValid() || !mayContainRefs(v.Type()) {
+		return
+	}
+	key, isref := cycleKeyOf(v)
+	if isref {
+		if p.path[key] {
+			if _, ok := p.labels[key]; !ok {
+				if p.labels == nil {
+					p.labels = make(map[cycleKey]int)
+				}
+				p.labels[key] = len(p.labels) + 1
+			}
+			return
+		} else if p.acyclic[key] {
+			return
+		}
+		p.path[key] = true
+	}
+	nlabels := len(p.labels)
+	switch v.Kind() {
+	case r.Array, r.Slice:
+		for i, n := 0, v.Len(); i < n; i++ {
+			p.visit(v.Index(i))
+		}
+	case r.Interface, r.Ptr:
+		p.visit(v.Elem())
+	case r.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			p.visit(iter.Key())
+			p.visit(iter.Value())
+		}
+	case r.Struct:
+		for i, n := 0, v.NumField(); i < n; i++ {
+			p.visit(v.Field(i))
+		}
+	}
+	if isref {
+		delete(p.path, key)
+		if len(p.labels) == nlabels {
+			p.acyclic[key] = true
+		}
+	}
+}
+
+// format v, which must have been passed to findCycles()
+func (p *cyclePrinter) format(v r.Value) string {
+	p.buf.Reset()
+	p.path = make(map[cycleKey]bool)
+	p.print(v)
+	p.path = nil
+	return p.buf.String()
+}
+
+func (p *cyclePrinter) print(v r.Value) {
+	buf := &p.buf
+	if !v.IsValid() {
+		buf.WriteString("<nil>")
+		return
+	}
+	key, isref := cycleKeyOf(v)
+	if label, ok := p.labels[key]; isref && ok {
+		if p.path[key] {
+			buf.WriteString("&↩#")
+			buf.WriteString(strconv.Itoa(label))
+			return
+		}
+		buf.WriteByte('#')
+		buf.WriteString(strconv.Itoa(label))
+		buf.WriteByte('=')
+		p.path[key] = true
+		defer delete(p.path, key)
+	} else if !mayContainRefs(v.Type()) {
+		p.printLeaf(v)
+		return
+	}
+	switch v.Kind() {
+	case r.Array, r.Slice:
+		buf.WriteByte('[')
+		for i, n := 0, v.Len(); i < n; i++ {
+			if i != 0 {
+				buf.WriteByte(' ')
+			}
+			p.print(v.Index(i))
+		}
+		buf.WriteByte(']')
+	case r.Interface:
+		p.print(v.Elem())
+	case r.Ptr:
+		switch elem := v.Elem(); elem.Kind() {
+		case r.Array, r.Map, r.Slice, r.Struct:
+			// unlike fmt, follow pointers also inside other values: they may be part of a cycle
+			buf.WriteByte('&')
+			p.print(elem)
+		default:
+			p.printLeaf(v)
+		}
+	case r.Map:
+		p.printMap(v)
+	case r.Struct:
+		t := v.Type()
+		buf.WriteByte('{')
+		for i, n := 0, v.NumField(); i < n; i++ {
+			if i != 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(t.Field(i).Name)
+			buf.WriteByte(':')
+			p.print(v.Field(i))
+		}
+		buf.WriteByte('}')
+	default:
+		p.printLeaf(v)
+	}
+}
+
+// print map entries sorted by key, as fmt does
+func (p *cyclePrinter) printMap(v r.Value) {
+	type entry struct {
+		key string
+		val r.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		entries = append(entries, entry{fmt.Sprint(iter.Key()), iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	buf := &p.buf
+	buf.WriteString("map[")
+	for i, e := range entries {
+		if i != 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(e.key)
+		buf.WriteByte(':')
+		p.print(e.val)
+	}
+	buf.WriteByte(']')
+}
+
+func (p *cyclePrinter) printLeaf(v r.Value) {
+	if v.Kind() == r.Ptr && v.IsNil() {
+		p.buf.WriteString("<nil>")
+		return
+	}
+	fmt.Fprint(&p.buf, v)
+}
+
+// return a string representation of value if it contains cycles,
+// otherwise return nil and let toPrintable() convert it as usual
+func (st *Stringer) cyclicToPrintable(format string, value interface{}) (ret interface{}) {
+	if len(format) != 0 && !strings.HasPrefix(format, "%v") && !strings.HasPrefix(format, "%s") {
+		return nil
+	}
+	if v, ok := value.(r.Value); ok {
+		if !v.IsValid() || !v.CanInterface() {
+			return nil
+		}
+		value = v.Interface()
+	}
+	switch value.(type) {
+	case nil, fmt.Formatter, fmt.Stringer, error, ast.Node, Ast, r.Type:
+		// printed by their own methods
+		return nil
+	}
+	v := r.ValueOf(value)
+	switch v.Kind() {
+	case r.Array, r.Map, r.Ptr, r.Slice, r.Struct:
+	default:
+		return nil
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			ret = nil
+		}
+	}()
+	var p cyclePrinter
+	if !p.findCycles(v) {
+		return nil
+	}
+	return p.format(v)
+}
@@ -0,0 +1,191 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * mux.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cosmos72/gomacro/gls"
+)
+
+// Mux multiplexes the output of concurrent goroutines on one or more streams.
+// The writers returned by Mux.Writer() buffer the output of each goroutine
+// until a complete line is available, so that lines written by different goroutines
+// never interleave. Lines written while an interactive prompt is displayed
+// are printed above it, and the prompt is redrawn.
+//
+// Goroutines are identified with gls.GoID()
+type Mux struct {
+	lock     sync.Mutex
+	term     io.Writer // where the prompt is displayed
+	prompt   string    // prompt currently displayed, empty if none
+	writers  []*muxWriter
+	prefixes map[uintptr]string
+	numbers  map[uintptr]int
+	owner    uintptr
+	// if true, lines written by goroutines without an explicit prefix,
+	// except the goroutine that created the Mux, are prefixed with "[goroutine N] ".
+	// Must be set before using the Mux
+	GoroutinePrefix bool
+	// if true, the terminal does not support ANSI escape sequences:
+	// the prompt is not erased before printing lines above it.
+	// Must be set before using the Mux
+	Dumb bool
+}
+
+type muxWriter struct {
+	mux     *Mux
+	out     io.Writer
+	partial map[uintptr][]byte // incomplete line of each goroutine
+}
+
+// NewMux creates a Mux for an interactive prompt displayed on term.
+// The goroutine that calls NewMux is the owner of the Mux
+func NewMux(term io.Writer) *Mux {
+	return &Mux{
+		term:     term,
+		prefixes: make(map[uintptr]string),
+		numbers:  make(map[uintptr]int),
+		owner:    gls.GoID(),
+	}
+}
+
+// Writer returns a goroutine-safe, line-buffered writer on out.
+// Calling it multiple times with the same out returns the same writer
+func (m *Mux) Writer(out io.Writer) io.Writer {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, w := range m.writers {
+		if w.out == out {
+			return w
+		}
+	}
+	w := &muxWriter{mux: m, out: out, partial: make(map[uintptr][]byte)}
+	m.writers = append(m.writers, w)
+	return w
+}
+
+// SetPrefix sets the prefix of lines written by the current goroutine.
+// An empty prefix removes it
+func (m *Mux) SetPrefix(prefix string) {
+	id := gls.GoID()
+	m.lock.Lock()
+	if len(prefix) == 0 {
+		delete(m.prefixes, id)
+	} else {
+		m.prefixes[id] = prefix
+	}
+	m.lock.Unlock()
+}
+
+// ShowPrompt must be called before displaying the prompt:
+// it writes all incomplete lines, then remembers the prompt for redrawing it
+func (m *Mux) ShowPrompt(prompt string) {
+	m.lock.Lock()
+	m.flush()
+	m.prompt = prompt
+	m.lock.Unlock()
+}
+
+// HidePrompt must be called after the prompt is no longer displayed,
+// i.e. after reading the user input
+func (m *Mux) HidePrompt() {
+	m.lock.Lock()
+	m.prompt = ""
+	m.lock.Unlock()
+}
+
+// Flush writes all incomplete lines
+func (m *Mux) Flush() {
+	m.lock.Lock()
+	m.flush()
+	m.lock.Unlock()
+}
+
+// must be called with m.lock held
+func (m *Mux) flush() {
+	for _, w := range m.writers {
+		for id, line := range w.partial {
+			w.emit(id, line)
+			delete(w.partial, id)
+		}
+	}
+}
+
+// must be called with m.lock held
+func (m *Mux) prefix(id uintptr) string {
+	if prefix, ok := m.prefixes[id]; ok {
+		return prefix
+	} else if !m.GoroutinePrefix || id == m.owner {
+		return ""
+	}
+	n, ok := m.numbers[id]
+	if !ok {
+		n = len(m.numbers) + 1
+		m.numbers[id] = n
+	}
+	return fmt.Sprintf("[goroutine %d] ", n)
+}
+
+func (w *muxWriter) Write(p []byte) (int, error) {
+	id := gls.GoID()
+	m := w.mux
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	buf := append(w.partial[id], p...)
+	for {
+		n := bytes.IndexByte(buf, '\n')
+		if n < 0 {
+			break
+		}
+		w.emit(id, buf[:n+1])
+		buf = buf[n+1:]
+	}
+	if len(buf) == 0 {
+		delete(w.partial, id)
+	} else {
+		w.partial[id] = buf
+	}
+	return len(p), nil
+}
+
+// write a line, printing it above the prompt if displayed.
+// must be called with m.lock held
+func (w *muxWriter) emit(id uintptr, line []byte) {
+	m := w.mux
+	if len(m.prompt) != 0 {
+		if m.Dumb {
+			io.WriteString(m.term, "\n")
+		} else {
+			// move to start of line and erase it
+			io.WriteString(m.term, "\r\x1b[K")
+		}
+	}
+	if prefix := m.prefix(id); len(prefix) != 0 {
+		io.WriteString(w.out, prefix)
+	}
+	w.out.Write(line)
+	if len(m.prompt) != 0 {
+		if line[len(line)-1] != '\n' {
+			io.WriteString(w.out, "\n")
+		}
+		io.WriteString(m.term, m.prompt)
+	}
+}
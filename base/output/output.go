@@ -218,7 +218,11 @@ func (st *Stringer) toPrintables(format string, values []interface{}) []interfac
 		if percent := strings.IndexByte(format, '%'); percent >= 0 {
 			format = format[percent:]
 		}
-		rets[i] = st.toPrintable(format, vi)
+		if cyclic := st.cyclicToPrintable(format, vi); cyclic != nil {
+			rets[i] = cyclic
+		} else {
+			rets[i] = st.toPrintable(format, vi)
+		}
 		switch len(format) {
 		case 0:
 		case 1, 2:
@@ -284,7 +288,9 @@ func (st *Stringer) toPrintable(format string, value interface{}) (ret interface
 			} else {
 				valuei := vi.Interface()
 				values[i] = st.toPrintable(format, valuei)
-				converted = converted || !vi.Type().Comparable() || valuei != values[i]
+				// vi.Type() may be an interface: check the comparability of its dynamic type
+				ti := r.TypeOf(valuei)
+				converted = converted || (ti != nil && !ti.Comparable()) || valuei != values[i]
 			}
 		}
 		// return []interface{} only if we actually converted some element
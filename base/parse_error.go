@@ -0,0 +1,68 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * parse_error.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package base
+
+import (
+	"strings"
+
+	"github.com/cosmos72/gomacro/go/scanner"
+)
+
+// ParseError contains all the syntax errors found while parsing some source code.
+// Its Error() method shows each of them, followed by the source line and a caret
+// pointing to the error position
+type ParseError struct {
+	List   scanner.ErrorList
+	Source string
+	Line   int // line number of Source first line, minus one
+}
+
+func (e *ParseError) Error() string {
+	var buf strings.Builder
+	lines := strings.Split(e.Source, "\n")
+	for i, err := range e.List {
+		if i != 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(err.Error())
+		n, col := err.Pos.Line-e.Line-1, err.Pos.Column-1
+		if n < 0 || n >= len(lines) || col < 0 {
+			continue
+		}
+		line := strings.TrimRight(lines[n], "\r")
+		if col > len(line) || len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		buf.WriteByte('\n')
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		// keep tabs, so that the caret is aligned with the source line
+		for _, ch := range []byte(line[:col]) {
+			if ch != '\t' {
+				ch = ' '
+			}
+			buf.WriteByte(ch)
+		}
+		buf.WriteString("^^^")
+	}
+	return buf.String()
+}
+
+// Unwrap returns the list of syntax errors
+func (e *ParseError) Unwrap() error {
+	return e.List
+}
@@ -141,6 +141,7 @@ func ReadMultiline(in Readline, opts ReadOptions, prompt string) (src string, fi
 	optPrompt := opts&ReadOptShowPrompt != 0
 	optAllComments := opts&ReadOptCollectAllComments != 0
 	ignorenl := false
+	directive := false // true if the last token is a //go:embed directive
 	var currPrompt string
 	if optPrompt {
 		currPrompt = prompt
@@ -153,6 +154,7 @@ func ReadMultiline(in Readline, opts ReadOptions, prompt string) (src string, fi
 				m != mLineComment && m != mComment && m != mCommentStar)
 	}
 	foundtoken := func(pos int) {
+		directive = false
 		lastToken = len(buf) + pos
 		if firstToken < 0 {
 			firstToken = lastToken
@@ -275,6 +277,11 @@ func ReadMultiline(in Readline, opts ReadOptions, prompt string) (src string, fi
 				switch ch {
 				case '/':
 					m = mLineComment
+					if isEmbedDirective(line, i-1) {
+						// keep the directive together with the declaration it applies to
+						foundtoken(i - 1)
+						directive = true
+					}
 					continue // no tokens
 				case '*':
 					m = mComment
@@ -340,7 +347,7 @@ func ReadMultiline(in Readline, opts ReadOptions, prompt string) (src string, fi
 			break
 		}
 		if paren <= 0 && !ignorenl && m == mNormal && (firstToken >= 0 || !optAllComments) {
-			if firstToken >= 0 && lastIsKeywordIgnoresNl(line, firstToken, lastToken) {
+			if firstToken >= 0 && (directive || lastIsKeywordIgnoresNl(line, firstToken, lastToken)) {
 				ignorenl = true
 			} else {
 				break
@@ -357,7 +364,7 @@ func ReadMultiline(in Readline, opts ReadOptions, prompt string) (src string, fi
 		}
 	}
 	if err != nil {
-		if err == io.EOF && paren > 0 {
+		if err == io.EOF && (paren > 0 || insideLiteralOrComment(m)) {
 			err = io.ErrUnexpectedEOF
 		}
 		return string(buf), firstToken, err
@@ -374,6 +381,27 @@ func ReadMultiline(in Readline, opts ReadOptions, prompt string) (src string, fi
 	return string(buf), firstToken, nil
 }
 
+// return true if m is inside a rune, string or comment
+// that must be terminated before the end of input
+func insideLiteralOrComment(m mode) bool {
+	switch m {
+	case mRune, mRuneEscape, mString, mStringEscape, mRawString, mComment, mCommentStar:
+		return true
+	}
+	return false
+}
+
+// return true if line contains a //go:embed directive starting at pos,
+// preceded only by whitespace
+func isEmbedDirective(line []byte, pos int) bool {
+	const prefix = "//go:embed"
+	if len(bytes.TrimSpace(line[:pos])) != 0 || !bytes.HasPrefix(line[pos:], []byte(prefix)) {
+		return false
+	}
+	rest := line[pos+len(prefix):]
+	return len(rest) != 0 && (rest[0] == ' ' || rest[0] == '\t')
+}
+
 func lastIsKeywordIgnoresNl(line []byte, first, last int) bool {
 	if last >= 0 && last < len(line) {
 		line = line[:last+1]
@@ -23,6 +23,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/cosmos72/gomacro/base/lineedit"
 	"github.com/peterh/liner"
 )
 
@@ -52,6 +53,164 @@ func (buf BufReadline) Read(prompt string) ([]byte, error) {
 	return line, err
 }
 
+// -------------------- TermReadline --------------------
+
+// TermReadline is a Readline for interactive terminals,
+// with history and word completion
+type TermReadline interface {
+	Readline
+	SetWordCompleter(completer func(line string, pos int) (head string, completions []string, tail string))
+	Close(historyfile string) error
+}
+
+// TerminalMode selects the TermReadline implementation used by interactive REPLs
+type TerminalMode uint8
+
+const (
+	TerminalAuto TerminalMode = iota // TerminalDumb if $TERM is "dumb", otherwise TerminalAnsi. The default
+	TerminalAnsi                     // EditReadline if supported, otherwise TtyReadline
+	TerminalDumb                     // DumbReadline: no escape sequences, history or word completion
+)
+
+func (mode TerminalMode) String() string {
+	switch mode {
+	case TerminalAnsi:
+		return "ansi"
+	case TerminalDumb:
+		return "dumb"
+	default:
+		return "auto"
+	}
+}
+
+// ParseTerminalMode parses the name of a TerminalMode: one of auto, ansi or dumb
+func ParseTerminalMode(s string) (TerminalMode, error) {
+	switch s {
+	case "auto":
+		return TerminalAuto, nil
+	case "ansi":
+		return TerminalAnsi, nil
+	case "dumb":
+		return TerminalDumb, nil
+	}
+	return TerminalAuto, fmt.Errorf("invalid terminal mode %q: expecting one of auto, ansi, dumb", s)
+}
+
+// MakeTermReadline returns the Unicode-aware line editor EditReadline if supported
+// by the operating system and the terminal, otherwise it falls back to TtyReadline
+func MakeTermReadline(historyfile string) TermReadline {
+	edit, _ := MakeEditReadline(historyfile)
+	if edit.Term != nil {
+		return edit
+	}
+	tty, _ := MakeTtyReadline(historyfile)
+	return tty
+}
+
+// MakeTermReadlineMode returns the TermReadline implementation selected by mode
+func MakeTermReadlineMode(historyfile string, mode TerminalMode) TermReadline {
+	if mode == TerminalAuto && os.Getenv("TERM") == "dumb" {
+		mode = TerminalDumb
+	}
+	if mode == TerminalDumb {
+		return MakeDumbReadline(os.Stdin, os.Stdout)
+	}
+	return MakeTermReadline(historyfile)
+}
+
+// -------------------- DumbReadline --------------------
+
+// a TermReadline implementation that never sends escape sequences to the terminal:
+// it only prints the prompt and reads a line. Useful for pipes, editors' inferior modes
+// and terminals with poor ANSI support. History and word completion are not supported
+type DumbReadline struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func MakeDumbReadline(in io.Reader, out io.Writer) DumbReadline {
+	return DumbReadline{bufio.NewReader(in), out}
+}
+
+func (dumb DumbReadline) Read(prompt string) ([]byte, error) {
+	if len(prompt) != 0 {
+		io.WriteString(dumb.out, prompt)
+	}
+	line, err := dumb.in.ReadBytes('\n')
+	line = bytes.Replace(line, paragraph_separator_bytes, nl_bytes, -1)
+	return line, err
+}
+
+func (dumb DumbReadline) SetWordCompleter(completer func(line string, pos int) (head string, completions []string, tail string)) {
+}
+
+func (dumb DumbReadline) Close(historyfile string) error {
+	return nil
+}
+
+// -------------------- EditReadline --------------------
+
+// a Readline implementation that uses the grapheme-cluster aware line editor lineedit.State
+type EditReadline struct {
+	Term *lineedit.State
+}
+
+func MakeEditReadline(historyfile string) (EditReadline, error) {
+	term, err := lineedit.New()
+	if err != nil {
+		return EditReadline{}, err
+	}
+	edit := EditReadline{term}
+	if len(historyfile) == 0 {
+		return edit, nil
+	}
+	f, err := os.Open(historyfile)
+	if err != nil {
+		return edit, nil // missing history file is not an error
+	}
+	defer f.Close()
+	_, err = term.ReadHistory(f)
+	return edit, err
+}
+
+func (edit EditReadline) Read(prompt string) ([]byte, error) {
+	line, err := edit.Term.Prompt(prompt)
+	if len(line) >= 3 {
+		edit.Term.AppendHistory(line)
+	}
+	if n := len(line); n != 0 || err != io.EOF {
+		b := make([]byte, n+1)
+		copy(b, line)
+		b[n] = '\n'
+		b = bytes.Replace(b, paragraph_separator_bytes, nl_bytes, -1)
+		return b, err
+	}
+	return nil, err
+}
+
+func (edit EditReadline) SetWordCompleter(completer func(line string, pos int) (head string, completions []string, tail string)) {
+	edit.Term.SetWordCompleter(completer)
+}
+
+func (edit EditReadline) Close(historyfile string) (err error) {
+	if len(historyfile) != 0 {
+		f, err1 := os.OpenFile(historyfile, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0666)
+		if err1 != nil {
+			err = fmt.Errorf("could not open %q to write history: %v", historyfile, err1)
+		} else {
+			defer f.Close()
+			_, err2 := edit.Term.WriteHistory(f)
+			if err2 != nil {
+				err = fmt.Errorf("could not write history to %q: %v", historyfile, err2)
+			}
+		}
+	}
+	if err3 := edit.Term.Close(); err3 != nil {
+		err = err3
+	}
+	return
+}
+
 // -------------------- TtyReadline --------------------
 
 type TtyReadline struct {
@@ -100,6 +259,10 @@ func (tty TtyReadline) Read(prompt string) ([]byte, error) {
 	return nil, err
 }
 
+func (tty TtyReadline) SetWordCompleter(completer func(line string, pos int) (head string, completions []string, tail string)) {
+	tty.Term.SetWordCompleter(completer)
+}
+
 func (tty TtyReadline) Close(historyfile string) (err error) {
 	if len(historyfile) == 0 {
 		return tty.Term.Close()
@@ -30,8 +30,23 @@ const (
 	OptCtrlCEnterDebugger // Ctrl+C enters the debugger instead of injecting a panic. requires OptDebugger
 	OptDebugger           // enable debugger support. "break" and _ = "break" are breakpoints and enter the debugger
 	OptKeepUntyped
-	OptMacroExpandOnly // do not compile or execute code, only parse and macroexpand it
-	OptModuleImport    // if built with Go >= 1.11, import "foo" will use modules
+	OptMacroExpandOnly       // do not compile or execute code, only parse and macroexpand it
+	OptModuleImport          // if built with Go >= 1.11, import "foo" will use modules
+	OptAutoImport            // referencing pkg.Name without importing pkg will import it automatically
+	OptStrictImportAlias     // importing two packages with the same name in the same scope fails, instead of auto-aliasing the second one
+	OptTrackProvenance       // record the statement that last wrote each toplevel variable, see :whence
+	OptInterruptibleChan     // compile channel send, receive, select and range so that Ctrl+C or Interp.Interrupt() can interrupt them
+	OptExtLambdas            // syntax extension: parse lambdas x => expr and \x -> expr, see :set ext
+	OptDeterministicMapRange // compile "for range" over maps to iterate in sorted key order, unlike Go
+	OptLoadAllErrors         // :load compiles the whole file reporting all errors, and executes it only if there are none
+	OptProjectImports        // referencing pkg.Name imports pkg from the Go module in the current directory or its direct dependencies
+	OptExtBigNums            // syntax extension: literals 123n and 1.5n are *big.Int and *big.Rat, operators on them call their methods, see :set ext
+	OptImportURL             // import "https://..." downloads a single Go file and evaluates it as an interpreted package
+	OptVerboseImports        // print the time spent in each stage of imports, see genimport.ImportTiming
+	OptSplitStatements       // the REPL compiles, executes and prints separately each statement of a line a := 1; b := 2; a+b
+	OptYieldPoints           // compile a yield point before each statement, where Interp.EvalSteps can suspend execution
+	OptVecLoops              // compile simple numeric "for range" loops on []float64 and []int as calls to package vec
+	OptHotspots              // count and sample the executed statements, and report the most expensive source lines after each evaluation
 	OptPanicStackTrace
 	OptTrapPanic
 	OptDebugCallStack
@@ -61,33 +76,48 @@ const (
 )
 
 var optNames = map[Options]string{
-	OptCollectDeclarations: "Declarations.Collect",
-	OptCollectStatements:   "Statements.Collect",
-	OptCtrlCEnterDebugger:  "CtrlC.Debugger.Enter",
-	OptDebugger:            "Debugger",
-	OptKeepUntyped:         "Untyped.Keep",
-	OptMacroExpandOnly:     "MacroExpandOnly",
-	OptModuleImport:        "Import.Uses.Module",
-	OptPanicStackTrace:     "StackTrace.OnPanic",
-	OptTrapPanic:           "Trap.Panic",
-	OptDebugCallStack:      "?CallStack.Debug",
-	OptDebugDebugger:       "?Debugger.Debug",
-	OptDebugField:          "?Field.Debug",
-	OptDebugFromReflect:    "?FromReflect.Debug",
-	OptDebugGenerics:       "?Generics.Debug",
-	OptDebugMacroExpand:    "?MacroExpand.Debug",
-	OptDebugMethod:         "?Method.Debug",
-	OptDebugParse:          "?Parse.Debug",
-	OptDebugRecover:        "?Recover.Debug",
-	OptDebugQuasiquote:     "?Quasiquote.Debug",
-	OptDebugSleepOnSwitch:  "?SwitchSleep.Debug",
-	OptShowCompile:         "Compile.Show",
-	OptShowEval:            "Eval.Show",
-	OptShowEvalType:        "Type.Eval.Show",
-	OptShowMacroExpand:     "MacroExpand.Show",
-	OptShowParse:           "Parse.Show",
-	OptShowPrompt:          "Prompt.Show",
-	OptShowTime:            "Time.Show",
+	OptCollectDeclarations:   "Declarations.Collect",
+	OptCollectStatements:     "Statements.Collect",
+	OptCtrlCEnterDebugger:    "CtrlC.Debugger.Enter",
+	OptDebugger:              "Debugger",
+	OptKeepUntyped:           "Untyped.Keep",
+	OptMacroExpandOnly:       "MacroExpandOnly",
+	OptModuleImport:          "Import.Uses.Module",
+	OptAutoImport:            "Import.Auto",
+	OptStrictImportAlias:     "Import.Alias.Strict",
+	OptTrackProvenance:       "Provenance.Track",
+	OptInterruptibleChan:     "Chan.Interruptible",
+	OptExtLambdas:            "Ext.Lambdas",
+	OptDeterministicMapRange: "MapRange.Deterministic",
+	OptLoadAllErrors:         "Load.AllErrors",
+	OptProjectImports:        "Import.Project",
+	OptExtBigNums:            "Ext.BigNums",
+	OptImportURL:             "Import.URL",
+	OptVerboseImports:        "Import.Verbose",
+	OptSplitStatements:       "Statements.Split",
+	OptYieldPoints:           "YieldPoints",
+	OptVecLoops:              "VecLoops",
+	OptHotspots:              "Hotspots",
+	OptPanicStackTrace:       "StackTrace.OnPanic",
+	OptTrapPanic:             "Trap.Panic",
+	OptDebugCallStack:        "?CallStack.Debug",
+	OptDebugDebugger:         "?Debugger.Debug",
+	OptDebugField:            "?Field.Debug",
+	OptDebugFromReflect:      "?FromReflect.Debug",
+	OptDebugGenerics:         "?Generics.Debug",
+	OptDebugMacroExpand:      "?MacroExpand.Debug",
+	OptDebugMethod:           "?Method.Debug",
+	OptDebugParse:            "?Parse.Debug",
+	OptDebugRecover:          "?Recover.Debug",
+	OptDebugQuasiquote:       "?Quasiquote.Debug",
+	OptDebugSleepOnSwitch:    "?SwitchSleep.Debug",
+	OptShowCompile:           "Compile.Show",
+	OptShowEval:              "Eval.Show",
+	OptShowEvalType:          "Type.Eval.Show",
+	OptShowMacroExpand:       "MacroExpand.Show",
+	OptShowParse:             "Parse.Show",
+	OptShowPrompt:            "Prompt.Show",
+	OptShowTime:              "Time.Show",
 }
 
 var optValues = map[string]Options{}
@@ -0,0 +1,192 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * format.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package untyped
+
+import (
+	"fmt"
+	"go/constant"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// FormatMode selects how untyped floating-point and complex constants are printed
+type FormatMode uint8
+
+const (
+	FormatExact   FormatMode = iota // exact fraction, as 1/3. The default
+	FormatDecimal                   // decimal with Format.Digits significant digits, as 0.33333333333333333333
+	FormatLiteral                   // Go constant expression with the same value, as 1.0/3
+)
+
+// default number of significant digits for FormatDecimal
+const DefaultDigits = 20
+
+// Format describes how untyped floating-point and complex constants are printed.
+// The zero value prints them as exact fractions
+type Format struct {
+	Mode   FormatMode
+	Digits int // significant digits for FormatDecimal. if <= 0, use DefaultDigits
+}
+
+func (f Format) String() string {
+	switch f.Mode {
+	case FormatDecimal:
+		return "decimal " + strconv.Itoa(f.digits())
+	case FormatLiteral:
+		return "literal"
+	default:
+		return "exact"
+	}
+}
+
+func (f Format) digits() int {
+	if f.Digits <= 0 {
+		return DefaultDigits
+	}
+	return f.Digits
+}
+
+// ParseFormat parses the description of a Format: one of exact, decimal [DIGITS] or literal
+func ParseFormat(s string) (Format, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 0 {
+		switch fields[0] {
+		case "exact":
+			if len(fields) == 1 {
+				return Format{Mode: FormatExact}, nil
+			}
+		case "literal":
+			if len(fields) == 1 {
+				return Format{Mode: FormatLiteral}, nil
+			}
+		case "decimal":
+			if len(fields) == 1 {
+				return Format{Mode: FormatDecimal, Digits: DefaultDigits}, nil
+			} else if len(fields) == 2 {
+				if digits, err := strconv.Atoi(fields[1]); err == nil && digits > 0 {
+					return Format{Mode: FormatDecimal, Digits: digits}, nil
+				}
+			}
+		}
+	}
+	return Format{}, fmt.Errorf("expecting exact, decimal [DIGITS] or literal, found %q", s)
+}
+
+// StringWith pretty-prints an untyped constant,
+// formatting floating-point and complex values as specified by f
+func (untyp Lit) StringWith(f Format) string {
+	if f.Mode == FormatExact || (untyp.Kind != Float && untyp.Kind != Complex) {
+		return untyp.String()
+	}
+	val := untyp.Val
+	var s string
+	switch val.Kind() {
+	case constant.Int, constant.Float:
+		s = f.formatReal(val)
+	case constant.Complex:
+		re, im := f.formatReal(constant.Real(val)), f.formatReal(constant.Imag(val))
+		if f.Mode == FormatLiteral && strings.IndexByte(im, '/') >= 0 {
+			s = fmt.Sprintf("(%s + (%s)*1i)", re, im)
+		} else {
+			s = fmt.Sprintf("(%s + %si)", re, im)
+		}
+	default:
+		return untyp.String()
+	}
+	return fmt.Sprintf("{%v %v}", untyp.Kind, s)
+}
+
+// format an integer or floating-point constant
+func (f Format) formatReal(val constant.Value) string {
+	switch x := constant.Val(constant.ToFloat(val)).(type) {
+	case int64:
+		return f.formatRat(new(big.Rat).SetInt64(x))
+	case *big.Int:
+		return f.formatRat(new(big.Rat).SetInt(x))
+	case *big.Rat:
+		return f.formatRat(x)
+	case *big.Float:
+		// too large or too small for *big.Rat: already approximated by go/constant
+		if f.Mode == FormatDecimal {
+			return x.Text('g', f.digits())
+		}
+		return x.Text('g', -1)
+	default:
+		return val.ExactString()
+	}
+}
+
+func (f Format) formatRat(x *big.Rat) string {
+	if f.Mode == FormatDecimal {
+		digits := f.digits()
+		// enough precision for the requested digits, plus some guard bits
+		prec := uint(digits)*4 + 64
+		return new(big.Float).SetPrec(prec).SetRat(x).Text('g', digits)
+	}
+	// FormatLiteral
+	if !x.IsInt() {
+		if decimals, ok := exactDecimals(x.Denom()); ok {
+			return strings.TrimRight(x.FloatString(decimals), "0")
+		}
+	}
+	num, float := literalInt(x.Num())
+	if !float {
+		num += ".0" // make it an untyped float constant
+	}
+	if x.IsInt() {
+		return num
+	}
+	den, _ := literalInt(x.Denom())
+	return num + "/" + den
+}
+
+// format an integer as Go literal, using exponential notation if it has many trailing zeros.
+// return true if the literal is a floating-point one
+func literalInt(n *big.Int) (string, bool) {
+	s := n.String()
+	zeros := len(s) - len(strings.TrimRight(s, "0"))
+	if zeros < 6 || zeros == len(s) {
+		return s, false
+	}
+	return s[:len(s)-zeros] + "e+" + strconv.Itoa(zeros), true
+}
+
+// if 1/den can be written exactly as a decimal number, return true
+// and the number of digits after the decimal point it needs
+func exactDecimals(den *big.Int) (int, bool) {
+	twos := int(den.TrailingZeroBits())
+	d := new(big.Int).Rsh(den, uint(twos))
+	five := big.NewInt(5)
+	var fives int
+	var q, mod big.Int
+	for {
+		q.QuoRem(d, five, &mod)
+		if mod.Sign() != 0 {
+			break
+		}
+		d.Set(&q)
+		fives++
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
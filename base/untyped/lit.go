@@ -19,6 +19,7 @@ package untyped
 import (
 	"go/constant"
 	"go/token"
+	"math"
 	"math/big"
 	r "reflect"
 
@@ -362,6 +363,10 @@ func (untyp *Lit) extractNumber(src constant.Value, t xr.Type) interface{} {
 			if !exact {
 				n, exact = constant.Uint64Val(src)
 			}
+			if !exact {
+				// integer too large for int64 and uint64, convert it to float64
+				n, exact = constant.Float64Val(constant.ToFloat(src))
+			}
 		}
 	case constant.Float:
 		n, exact = constant.Float64Val(src)
@@ -379,7 +384,11 @@ func (untyp *Lit) extractNumber(src constant.Value, t xr.Type) interface{} {
 	// allow inexact conversions to float64 and complex128:
 	// floating point is intrinsically inexact, and Go compiler allows them too
 	if !exact && (cat == r.Int || cat == r.Uint) {
-		output.Errorf("untyped constant %v overflows <%v>", untyp, t)
+		output.Errorf("constant %v overflows %v", src, t)
+		return nil
+	}
+	if f, ok := n.(float64); ok && math.IsInf(f, 0) {
+		output.Errorf("constant %v overflows %v", src, t)
 		return nil
 	}
 	return n
@@ -397,6 +406,11 @@ func ConvertLiteralCheckOverflow(src interface{}, to xr.Type) interface{} {
 		return vto.Interface() // no numeric conversion happened
 	}
 	c, cto := reflect.Category(k), reflect.Category(kto)
+	if (cto == r.Float64 || cto == r.Complex128) && isInf(vto) && !isInf(v) {
+		// conversion to float or complex overflowed
+		output.Errorf("constant %v overflows %v", src, to)
+		return nil
+	}
 	if cto == r.Int || cto == r.Uint {
 		if c == r.Float64 || c == r.Complex128 {
 			// float-to-integer conversion. check for truncation
@@ -411,10 +425,22 @@ func ConvertLiteralCheckOverflow(src interface{}, to xr.Type) interface{} {
 			t1 := reflect.ValueType(v)
 			vback := vto.Convert(t1)
 			if src != vback.Interface() {
-				output.Errorf("constant %v overflows <%v>", src, to)
+				output.Errorf("constant %v overflows %v", src, to)
 				return nil
 			}
 		}
 	}
 	return vto.Interface()
 }
+
+// return true if v is a floating point or complex number containing an infinity
+func isInf(v xr.Value) bool {
+	switch reflect.Category(v.Kind()) {
+	case r.Float64:
+		return math.IsInf(v.Float(), 0)
+	case r.Complex128:
+		z := v.Complex()
+		return math.IsInf(real(z), 0) || math.IsInf(imag(z), 0)
+	}
+	return false
+}
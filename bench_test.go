@@ -538,3 +538,55 @@ func BenchmarkSumClassic(b *testing.B) {
 		total += int(ir.EvalAst1(form).Int())
 	}
 }
+
+// ---------------- append --------------------
+
+func BenchmarkAppendCompiler(b *testing.B) {
+	var total int
+	for i := 0; i < b.N; i++ {
+		var s []int
+		for j := 0; j < sum_arg; j++ {
+			s = append(s, j)
+		}
+		total += len(s)
+	}
+	if verbose {
+		println(total)
+	}
+}
+
+func BenchmarkAppendFast(b *testing.B) {
+	ir := fast.New()
+	ir.Eval("var i int; var s []int")
+	ir.DeclConst("n", nil, int(sum_arg))
+
+	fun := ir.Compile("s = nil; for i = 0; i < n; i++ { s = append(s, i) }; len(s)").Fun.(func(*fast.Env) int)
+	env := ir.PrepareEnv()
+	fun(env)
+
+	var total int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		total += fun(env)
+	}
+	if verbose {
+		println(total)
+	}
+}
+
+// ---------------- struct fields --------------------
+
+func BenchmarkStructFieldFast(b *testing.B) {
+	ir := fast.New()
+	ir.Eval("type Point struct { X, Y int }; var i int; var p Point; var pp = &p")
+	ir.DeclConst("n", nil, int(sum_arg))
+
+	fun := ir.Compile("for i = 0; i < n; i++ { p.X = pp.Y + i; pp.Y = p.X - i + 1 }").AsX()
+	env := ir.PrepareEnv()
+	fun(env)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fun(env)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * bench_vec_test.go
+ *
+ *  Created on: Oct 16 2026
+ *      Author: Massimiliano Ghilardi
+ */
+package main
+
+import (
+	"testing"
+
+	. "github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/fast"
+	"github.com/cosmos72/gomacro/vec"
+)
+
+// ---------------------- numeric loops: package vec ------------------------
+
+var vec_arg = 1000
+
+const vec_source_string = `
+func vecSum(s []float64) float64 {
+	var acc float64
+	for _, x := range s {
+		acc += x
+	}
+	return acc
+}
+
+func vecDot(a, b []float64) float64 {
+	var acc float64
+	for i := range a {
+		acc += a[i] * b[i]
+	}
+	return acc
+}`
+
+func vecArgs() ([]float64, []float64) {
+	a, b := make([]float64, vec_arg), make([]float64, vec_arg)
+	for i := range a {
+		a[i], b[i] = float64(i), float64(vec_arg-i)
+	}
+	return a, b
+}
+
+// return the interpreted functions vecSum and vecDot,
+// compiled with or without option OptVecLoops
+func vecInterp(vecloops bool) (func([]float64) float64, func([]float64, []float64) float64) {
+	ir := fast.New()
+	if vecloops {
+		ir.Comp.Options |= OptVecLoops
+	}
+	ir.Eval(vec_source_string)
+	sum := ir.ValueOf("vecSum").Interface().(func([]float64) float64)
+	dot := ir.ValueOf("vecDot").Interface().(func([]float64, []float64) float64)
+	return sum, dot
+}
+
+func BenchmarkVecSumCompiler(b *testing.B) {
+	s, _ := vecArgs()
+	var total float64
+	for i := 0; i < b.N; i++ {
+		total += vec.SumFloat64(s)
+	}
+	if verbose {
+		println(total)
+	}
+}
+
+func BenchmarkVecSumFast(b *testing.B) {
+	s, _ := vecArgs()
+	sum, _ := vecInterp(false)
+	b.ResetTimer()
+	var total float64
+	for i := 0; i < b.N; i++ {
+		total += sum(s)
+	}
+}
+
+func BenchmarkVecSumFastVecLoops(b *testing.B) {
+	s, _ := vecArgs()
+	sum, _ := vecInterp(true)
+	b.ResetTimer()
+	var total float64
+	for i := 0; i < b.N; i++ {
+		total += sum(s)
+	}
+}
+
+func BenchmarkVecDotCompiler(b *testing.B) {
+	x, y := vecArgs()
+	var total float64
+	for i := 0; i < b.N; i++ {
+		total += vec.DotFloat64(x, y)
+	}
+	if verbose {
+		println(total)
+	}
+}
+
+func BenchmarkVecDotFast(b *testing.B) {
+	x, y := vecArgs()
+	_, dot := vecInterp(false)
+	b.ResetTimer()
+	var total float64
+	for i := 0; i < b.N; i++ {
+		total += dot(x, y)
+	}
+}
+
+func BenchmarkVecDotFastVecLoops(b *testing.B) {
+	x, y := vecArgs()
+	_, dot := vecInterp(true)
+	b.ResetTimer()
+	var total float64
+	for i := 0; i < b.N; i++ {
+		total += dot(x, y)
+	}
+}
@@ -113,12 +113,14 @@ func (env *Env) ChangePackage(path string) *Env {
 		env.Warnf("ChangePackage: env.ThreadGlobals = %#v\n\tenv.FileEnv().ThreadGlobals = %#v", g, fenv.ThreadGlobals)
 	}
 
-	// FIXME really store into imports.Packages fenv's interpreted functions, types, variable and constants ?
-	// We need a way to find fenv by name later, but storing it in imports.Packages seems excessive.
-	imports.Packages.MergePackage(currpath, fenv.AsPackage())
+	// FIXME really store into the imports registry fenv's interpreted functions, types, variable and constants ?
+	// We need a way to find fenv by name later, but storing it in the imports registry seems excessive.
+	registry := g.Importer.Registry()
+	registry.MergePackage(currpath, fenv.AsPackage())
 
 	nenv := NewEnv(fenv.TopEnv(), path)
-	nenv.MergePackage(imports.Packages[path])
+	pkg, _ := registry.Lookup(path)
+	nenv.MergePackage(pkg)
 	nenv.ThreadGlobals = env.ThreadGlobals
 	nenv.ThreadGlobals.PackagePath = path
 
@@ -65,7 +65,17 @@ func (env *Env) evalForRange(node *ast.RangeStmt) (r.Value, []r.Value) {
 		return env.evalForRangeChannel(container, node)
 	case r.Map:
 		return env.evalForRangeMap(container, node)
-	case r.Slice, r.Array:
+	case r.Slice:
+		return env.evalForRangeSlice(container, node)
+	case r.Array:
+		// Golang specs https://golang.org/ref/spec#RangeClause
+		// "The range expression x is evaluated once before beginning the loop"
+		// i.e. ranging over an array iterates on a copy of it
+		if container.CanAddr() {
+			dup := r.New(container.Type()).Elem()
+			dup.Set(container)
+			container = dup
+		}
 		return env.evalForRangeSlice(container, node)
 	case r.String:
 		// Golang specs https://golang.org/ref/spec#RangeClause
@@ -57,7 +57,7 @@ func (ir *Interp) ReplStdin() {
 // Type %chelp for help
 `, g.ReplCmdChar)
 	}
-	tty, _ := MakeTtyReadline(historyfile)
+	tty := MakeTermReadlineMode(historyfile, g.Terminal)
 	defer tty.Close(historyfile) // restore normal tty mode
 
 	c := StartSignalHandler(ir.Interrupt)
@@ -0,0 +1,119 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * cleanimports.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/base/genimport"
+)
+
+// CleanImports removes the stale directories of $GOPATH/src/gomacro.imports, see "gomacro clean-imports"
+func (cmd *Cmd) CleanImports(args []string) error {
+	var opts genimport.CleanOptions
+	for len(args) > 0 {
+		var err error
+		switch arg := args[0]; {
+		case arg == "-n" || arg == "--dry-run":
+			opts.DryRun = true
+		case arg == "--older-than" && len(args) > 1:
+			opts.OlderThan, err = parseAge(args[1])
+			args = args[1:]
+		case strings.HasPrefix(arg, "--older-than="):
+			opts.OlderThan, err = parseAge(arg[len("--older-than="):])
+		case arg == "--max-size" && len(args) > 1:
+			opts.MaxSize, err = parseSize(args[1])
+			args = args[1:]
+		case strings.HasPrefix(arg, "--max-size="):
+			opts.MaxSize, err = parseSize(arg[len("--max-size="):])
+		default:
+			return fmt.Errorf("gomacro clean-imports: unrecognized option '%s'.\nTry 'gomacro --help' for more information", arg)
+		}
+		if err != nil {
+			return fmt.Errorf("gomacro clean-imports: %v", err)
+		}
+		args = args[1:]
+	}
+	list, err := genimport.CleanImports(opts)
+	g := &cmd.Interp.Comp.Globals
+	verb := "removed"
+	if opts.DryRun {
+		verb = "would remove"
+	}
+	var total int64
+	now := time.Now()
+	for _, entry := range list {
+		reason := ""
+		if entry.Orphaned {
+			reason = ", orphaned"
+		}
+		g.Fprintf(g.Stdout, "%s %s (%s, last used %s ago%s)\n", verb, entry.Dir,
+			formatSize(entry.Size), now.Sub(entry.LastUsed).Round(time.Minute), reason)
+		total += entry.Size
+	}
+	g.Fprintf(g.Stdout, "// %s %d directories, %s\n", verb, len(list), formatSize(total))
+	return err
+}
+
+// parse a duration as time.ParseDuration does, also accepting days as "30d"
+func parseAge(str string) (time.Duration, error) {
+	if days := strings.TrimSuffix(str, "d"); days != str {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q, expecting for example 30d or 12h", str)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, expecting for example 30d or 12h", str)
+	}
+	return d, nil
+}
+
+var sizeSuffixes = []struct {
+	suffix string
+	scale  int64
+}{{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40}}
+
+// parse a size in bytes, accepting the suffixes K M G T as powers of 1024
+func parseSize(str string) (int64, error) {
+	num, scale := strings.TrimSuffix(strings.ToUpper(str), "B"), int64(1)
+	for _, s := range sizeSuffixes {
+		if strings.HasSuffix(num, s.suffix) {
+			num, scale = num[:len(num)-1], s.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expecting for example 500M or 2G", str)
+	}
+	return int64(n * float64(scale)), nil
+}
+
+func formatSize(size int64) string {
+	for i := len(sizeSuffixes) - 1; i >= 0; i-- {
+		if s := sizeSuffixes[i]; size >= s.scale {
+			return fmt.Sprintf("%.1f%sB", float64(size)/float64(s.scale), s.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
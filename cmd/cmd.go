@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"strings"
 
@@ -68,6 +69,20 @@ func (cmd *Cmd) Main(args []string) (err error) {
 	ir := cmd.Interp
 	g := &ir.Comp.Globals
 
+	if len(args) > 0 && args[0] == "dap" {
+		return cmd.Dap(args[1:])
+	} else if len(args) > 0 && args[0] == "kernel" {
+		return cmd.Kernel(args[1:])
+	} else if len(args) > 0 && args[0] == "notebook" {
+		return cmd.Notebook(args[1:])
+	} else if len(args) > 0 && args[0] == "web" {
+		return cmd.Web(args[1:])
+	} else if len(args) > 0 && args[0] == "clean-imports" {
+		return cmd.CleanImports(args[1:])
+	} else if len(args) > 0 && args[0] == "gen" {
+		return cmd.Gen(args[1:])
+	}
+
 	var set, clear Options
 	var repl, forcerepl = true, false
 	cmd.WriteDeclsAndStmts = false
@@ -115,6 +130,9 @@ func (cmd *Cmd) Main(args []string) (err error) {
 		case "-t", "--trap":
 			set |= OptTrapPanic | OptPanicStackTrace
 			clear &= OptTrapPanic | OptPanicStackTrace
+		case "-p", "--project":
+			set |= OptProjectImports
+			clear &^= OptProjectImports
 		case "-s", "--silent":
 			set &^= OptShowPrompt | OptShowEval | OptShowEvalType
 			clear |= OptShowPrompt | OptShowEval | OptShowEvalType
@@ -124,6 +142,13 @@ func (cmd *Cmd) Main(args []string) (err error) {
 		case "-vv", "--very-verbose":
 			set |= OptShowEval | OptShowEvalType
 			clear &^= OptShowEval | OptShowEvalType
+		case "--terminal":
+			if len(args) > 1 {
+				if err := cmd.setTerminal(args[1]); err != nil {
+					return err
+				}
+				args = args[1:]
+			}
 		case "-w", "--write-decls":
 			cmd.WriteDeclsAndStmts = true
 		case "-x", "--exec":
@@ -131,6 +156,12 @@ func (cmd *Cmd) Main(args []string) (err error) {
 			set &^= OptMacroExpandOnly
 		default:
 			arg := args[0]
+			if strings.HasPrefix(arg, "--terminal=") {
+				if err := cmd.setTerminal(arg[len("--terminal="):]); err != nil {
+					return err
+				}
+				break
+			}
 			if len(arg) > 0 && arg[0] == '-' {
 				return fmt.Errorf("gomacro: unrecognized option '%s'.\nTry 'gomacro --help' for more information", arg)
 			}
@@ -146,6 +177,11 @@ func (cmd *Cmd) Main(args []string) (err error) {
 		}
 		args = args[1:]
 	}
+	if repl && !forcerepl && !stdinIsTerminal() {
+		// "generator | gomacro": execute each statement as soon as it arrives
+		g.Options = (g.Options | set) &^ clear
+		return cmd.EvalReader(os.Stdin)
+	}
 	if repl || forcerepl {
 		g.Options |= OptShowPrompt | OptShowEval | OptShowEvalType // set by default, overridden by -s, -v and -vv
 		g.Options = (g.Options | set) &^ clear
@@ -154,9 +190,30 @@ func (cmd *Cmd) Main(args []string) (err error) {
 	return nil
 }
 
+func (cmd *Cmd) setTerminal(name string) error {
+	mode, err := ParseTerminalMode(name)
+	if err != nil {
+		return fmt.Errorf("gomacro: %v.\nTry 'gomacro --help' for more information", err)
+	}
+	cmd.Interp.Comp.Globals.Terminal = mode
+	return nil
+}
+
+// return false if standard input is a pipe or a file
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err != nil || info.Mode()&os.ModeCharDevice != 0
+}
+
 func (cmd *Cmd) Usage() error {
 	g := &cmd.Interp.Comp.Globals
 	fmt.Fprint(g.Stdout, `usage: gomacro [OPTIONS] [files-and-dirs]
+       gomacro dap [--listen ADDRESS]
+       gomacro kernel --connection-file=FILE
+       gomacro notebook [--output FILE] markdown-files
+       gomacro web [--listen ADDRESS] [--timeout DURATION]
+       gomacro clean-imports [--older-than AGE] [--max-size SIZE] [--dry-run]
+       gomacro gen --embed [--package NAME] [--output DIR] package-paths
 
   Recognized options:
     -c,   --collect          collect declarations and statements, to print them later
@@ -167,10 +224,14 @@ func (cmd *Cmd) Usage() error {
                              Used in "//go:generate gomacro -g ." directives.
     -h,   --help             show this help and exit
     -i,   --repl             interactive. start a REPL after evaluating expression, files and dirs.
-                             default: start a REPL only if no expressions, files or dirs are specified
+                             default: start a REPL only if no expressions, files or dirs are specified.
+                             If standard input is a pipe or a file, it is executed as a stream instead:
+                             each statement runs as soon as it is read, as in "generator | gomacro"
     -m,   --macro-only       do not execute code, only parse and macroexpand it.
                              useful to run gomacro as a Go preprocessor
     -n,   --no-trap          do not trap panics in the interpreter
+    -p,   --project          when started inside a Go module, import its packages and the root packages
+                             of its direct dependencies on first reference as pkg.Name, using go.mod
     -t,   --trap             trap panics in the interpreter (default)
     -s,   --silent           silent. do NOT show startup message, prompt, and expressions results.
                              default when executing files and dirs.
@@ -178,18 +239,103 @@ func (cmd *Cmd) Usage() error {
                              default when executing an expression.
     -vv,  --very-verbose     as -v, and in addition show the type of expressions results.
                              default when executing a REPL
+          --terminal=MODE    select the line editor used by the REPL. MODE is one of:
+                             auto  dumb if $TERM is "dumb", otherwise ansi (default)
+                             ansi  full line editing, history and TAB completion
+                             dumb  only print the prompt and read lines: no escape sequences.
+                                   useful for pipes, editors and terminals with poor ANSI support
     -w,   --write-decls      write collected declarations and statements to *.go files.
                              implies -c
     -x,   --exec             execute parsed code (default). disabled by -m
 
     Options are processed in order, except for -i that is always processed as last.
 
+    "gomacro dap" starts a Debug Adapter Protocol server, used by VS Code and other
+    DAP clients to debug gomacro scripts. It communicates over standard input
+    and output, or over TCP if --listen ADDRESS is specified.
+
+    "gomacro kernel" is a Jupyter kernel: it implements the Jupyter messaging protocol
+    on the sockets listed in the connection FILE created by Jupyter. Install it with
+    a kernel.json containing "argv": ["gomacro", "kernel", "--connection-file={connection_file}"]
+
+    "gomacro notebook" executes in order the code blocks fenced by `+"```go"+` or `+"```gomacro"+`
+    in Markdown files, and adds the output of each block after it, inside an `+"```output"+`
+    block. Output blocks added by previous executions are replaced.
+    Markdown files are modified in place, unless --output FILE is specified:
+    use "-" for standard output, or a FILE ending in .html to render a HTML page.
+
+    "gomacro web" starts a HTTP server, by default on :8080, serving a minimal web REPL
+    for teaching environments. Each browser gets its own interpreter, which can only import
+    packages without access to files, network or processes. Each evaluation is interrupted
+    after --timeout DURATION, by default 5s.
+
+    "gomacro clean-imports" removes from $GOPATH/src/gomacro.imports the directories
+    without a compiled plugin, left by interrupted imports, and the plugins not used
+    for longer than --older-than AGE, as 30d or 12h. With --max-size SIZE, as 500M or 2G,
+    it also removes the least recently used plugins until the total size fits.
+    --dry-run only lists them. Removed packages are compiled again when imported.
+    After each new plugin, the least recently used ones are removed automatically
+    if the total exceeds 4G: embedders can change genimport.MaxImportsSize.
+
+    "gomacro gen --embed" writes into DIR, by default the current directory, a file
+    x_embed_PACKAGE.go for each package path, in package NAME, by default main.
+    Its init() calls imports.Register: an application that embeds gomacro and is compiled
+    with such files can import those packages without the Go toolchain at runtime.
+    Such applications can call Importer.SetToolchain(false) to forbid any other import.
+
     Collected declarations and statements can be also written to standard output
     or to a file with the REPL command :write
 `)
 	return nil
 }
 
+// Dap starts a Debug Adapter Protocol server, see "gomacro dap"
+func (cmd *Cmd) Dap(args []string) error {
+	var listen string
+	for len(args) > 0 {
+		switch args[0] {
+		case "-l", "--listen":
+			if len(args) < 2 || len(args[1]) == 0 {
+				return fmt.Errorf("gomacro dap: option '%s' requires an ADDRESS.\nTry 'gomacro --help' for more information", args[0])
+			}
+			listen = args[1]
+			args = args[1:]
+		default:
+			return fmt.Errorf("gomacro dap: unrecognized option '%s'.\nTry 'gomacro --help' for more information", args[0])
+		}
+		args = args[1:]
+	}
+	ir := cmd.Interp
+	if len(listen) == 0 {
+		// standard output is reserved for the protocol:
+		// redirect anything written to os.Stdout by interpreted code
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		defer func() {
+			os.Stdout = stdout
+			w.Close()
+		}()
+		s := debug.NewDapServer(ir, os.Stdin, stdout)
+		go io.Copy(s.Output("stdout"), r)
+		return s.Serve()
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	conn, err := ln.Accept()
+	ln.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return debug.NewDapServer(ir, conn, conn).Serve()
+}
+
 func (cmd *Cmd) EvalFilesAndDirs(filesAndDirs ...string) error {
 	for _, fileOrDir := range filesAndDirs {
 		err := cmd.EvalFileOrDir(fileOrDir)
@@ -0,0 +1,69 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * gen.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cosmos72/gomacro/base/genimport"
+)
+
+// Gen writes the bindings of packages to be compiled into an application that embeds gomacro,
+// see "gomacro gen --embed"
+func (cmd *Cmd) Gen(args []string) error {
+	var embed bool
+	filepkg, dir := "main", "."
+	var pkgpaths []string
+	for len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "--embed":
+			embed = true
+		case arg == "--package" && len(args) > 1:
+			filepkg = args[1]
+			args = args[1:]
+		case strings.HasPrefix(arg, "--package="):
+			filepkg = arg[len("--package="):]
+		case (arg == "-o" || arg == "--output") && len(args) > 1:
+			dir = args[1]
+			args = args[1:]
+		case strings.HasPrefix(arg, "--output="):
+			dir = arg[len("--output="):]
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("gomacro gen: unrecognized option '%s'.\nTry 'gomacro --help' for more information", arg)
+		default:
+			pkgpaths = append(pkgpaths, arg)
+		}
+		args = args[1:]
+	}
+	if !embed {
+		return fmt.Errorf("gomacro gen: missing option --embed.\nTry 'gomacro --help' for more information")
+	} else if len(pkgpaths) == 0 {
+		return fmt.Errorf("gomacro gen: missing package paths.\nTry 'gomacro --help' for more information")
+	}
+	g := &cmd.Interp.Comp.Globals
+	imp := genimport.DefaultImporter(&g.Output)
+	for _, pkgpath := range pkgpaths {
+		f, err := imp.EmbedPackage(pkgpath, filepkg, dir)
+		if err != nil {
+			return err
+		} else if len(f) != 0 {
+			g.Fprintf(g.Stdout, "// created file %s\n", f)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,610 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * kernel.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cosmos72/gomacro/ast2"
+	. "github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/fast"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// Jupyter messaging protocol version implemented by Kernel
+const kernelProtocolVersion = "5.3"
+
+// separates routing identities from the rest of a Jupyter message
+const kernelDelimiter = "<IDS|MSG>"
+
+// kernelConnection is the content of the connection file passed by Jupyter
+type kernelConnection struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	Key             string `json:"key"`
+	SignatureScheme string `json:"signature_scheme"`
+	ShellPort       int    `json:"shell_port"`
+	ControlPort     int    `json:"control_port"`
+	StdinPort       int    `json:"stdin_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	HBPort          int    `json:"hb_port"`
+}
+
+type kernelHeader struct {
+	MsgID    string `json:"msg_id"`
+	Username string `json:"username"`
+	Session  string `json:"session"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// kernelMessage is a received Jupyter message
+type kernelMessage struct {
+	conn    *zmtpConn
+	idents  [][]byte
+	header  kernelHeader
+	rawhdr  []byte // header as received, used as parent header of replies
+	content json.RawMessage
+}
+
+type kernelObject = map[string]interface{}
+
+// Kernel implements the Jupyter messaging protocol
+// https://jupyter-client.readthedocs.io/en/latest/messaging.html
+// on top of the interpreter, see "gomacro kernel".
+//
+// Code is executed by the goroutine that called Serve(), one shell request at a time,
+// while control requests as interrupt_request and shutdown_request are served by another goroutine.
+type Kernel struct {
+	interp  *fast.Interp
+	key     []byte // HMAC key. empty to disable message signing
+	session string
+
+	shell, control, stdin, iopub, hb *zmtpSocket
+
+	lock     sync.Mutex // serializes messages sent on iopub
+	count    int        // execution counter
+	quit     chan struct{}
+	shutdown sync.Once // closes quit
+}
+
+// Kernel starts a Jupyter kernel, see "gomacro kernel"
+func (cmd *Cmd) Kernel(args []string) error {
+	var filename string
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "--connection-file" && len(args) > 1:
+			filename = args[1]
+			args = args[1:]
+		case strings.HasPrefix(arg, "--connection-file="):
+			filename = arg[len("--connection-file="):]
+		default:
+			return fmt.Errorf("gomacro kernel: unrecognized option '%s'.\nTry 'gomacro --help' for more information", arg)
+		}
+		args = args[1:]
+	}
+	if len(filename) == 0 {
+		return fmt.Errorf("gomacro kernel: missing option --connection-file=FILE.\nTry 'gomacro --help' for more information")
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var conn kernelConnection
+	if err = json.Unmarshal(data, &conn); err != nil {
+		return fmt.Errorf("gomacro kernel: invalid connection file %q: %v", filename, err)
+	}
+	k, err := newKernel(cmd.Interp, &conn)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.Serve()
+}
+
+// create a Kernel that listens on the sockets described by the connection file
+func newKernel(ir *fast.Interp, conn *kernelConnection) (*Kernel, error) {
+	if len(conn.Key) != 0 && conn.SignatureScheme != "hmac-sha256" {
+		return nil, fmt.Errorf("gomacro kernel: unsupported signature scheme %q", conn.SignatureScheme)
+	}
+	k := &Kernel{
+		interp:  ir,
+		key:     []byte(conn.Key),
+		session: newWebToken(),
+		quit:    make(chan struct{}),
+	}
+	sockets := []struct {
+		p    **zmtpSocket
+		kind string
+		port int
+	}{
+		{&k.shell, "ROUTER", conn.ShellPort},
+		{&k.control, "ROUTER", conn.ControlPort},
+		{&k.stdin, "ROUTER", conn.StdinPort},
+		{&k.iopub, "PUB", conn.IOPubPort},
+		{&k.hb, "REP", conn.HBPort},
+	}
+	for _, sock := range sockets {
+		s, err := zmtpListen(sock.kind, conn.Transport, conn.IP, sock.port)
+		if err != nil {
+			k.Close()
+			return nil, err
+		}
+		*sock.p = s
+	}
+	g := &ir.Comp.Globals
+	g.Options |= OptTrapPanic | OptInterruptibleChan
+	g.Options &^= OptShowPrompt | OptShowEval | OptShowEvalType | OptDebugger | OptCtrlCEnterDebugger
+	return k, nil
+}
+
+func (k *Kernel) Close() {
+	for _, s := range []*zmtpSocket{k.shell, k.control, k.stdin, k.iopub, k.hb} {
+		if s != nil {
+			s.Close()
+		}
+	}
+}
+
+// Serve executes the requests received on shell socket, until a shutdown_request arrives
+func (k *Kernel) Serve() error {
+	// Jupyter sends SIGINT to interrupt kernels with interrupt_mode "signal"
+	ch := StartSignalHandler(k.interp.Interrupt)
+	defer StopSignalHandler(ch)
+
+	go k.serveControl()
+	k.publish(nil, "status", kernelObject{"execution_state": "starting"})
+	for {
+		select {
+		case <-k.quit:
+			return nil
+		case zmsg := <-k.shell.recv:
+			if msg := k.parse(zmsg); msg != nil {
+				k.handle(msg)
+			}
+		case <-k.stdin.recv:
+			// input_request is not supported: ignore input_reply
+		}
+	}
+}
+
+// serve requests received on control socket
+func (k *Kernel) serveControl() {
+	for {
+		select {
+		case <-k.quit:
+			return
+		case zmsg := <-k.control.recv:
+			if msg := k.parse(zmsg); msg != nil {
+				k.handle(msg)
+			}
+		}
+	}
+}
+
+func (k *Kernel) handle(msg *kernelMessage) {
+	k.publish(msg, "status", kernelObject{"execution_state": "busy"})
+	defer k.publish(msg, "status", kernelObject{"execution_state": "idle"})
+
+	switch msg.header.MsgType {
+	case "kernel_info_request":
+		k.reply(msg, "kernel_info_reply", k.kernelInfo())
+	case "execute_request":
+		k.execute(msg)
+	case "complete_request":
+		k.complete(msg)
+	case "inspect_request":
+		k.inspect(msg)
+	case "is_complete_request":
+		k.isComplete(msg)
+	case "history_request":
+		k.reply(msg, "history_reply", kernelObject{"status": "ok", "history": []interface{}{}})
+	case "comm_info_request":
+		k.reply(msg, "comm_info_reply", kernelObject{"status": "ok", "comms": kernelObject{}})
+	case "interrupt_request":
+		k.interp.Interrupt(os.Interrupt)
+		k.reply(msg, "interrupt_reply", kernelObject{"status": "ok"})
+	case "shutdown_request":
+		var content struct {
+			Restart bool `json:"restart"`
+		}
+		json.Unmarshal(msg.content, &content)
+		k.reply(msg, "shutdown_reply", kernelObject{"status": "ok", "restart": content.Restart})
+		k.shutdown.Do(func() {
+			close(k.quit)
+		})
+	default:
+		// unknown requests are ignored, as Jupyter specs suggest
+	}
+}
+
+func (k *Kernel) kernelInfo() kernelObject {
+	return kernelObject{
+		"status":                 "ok",
+		"protocol_version":       kernelProtocolVersion,
+		"implementation":         "gomacro",
+		"implementation_version": "",
+		"banner":                 "gomacro - A Go interpreter with Lisp-like macros",
+		"language_info": kernelObject{
+			"name":           "go",
+			"version":        strings.TrimPrefix(runtime.Version(), "go"),
+			"mimetype":       "text/x-go",
+			"file_extension": ".go",
+		},
+		"help_links": []kernelObject{
+			{"text": "gomacro", "url": "https://github.com/cosmos72/gomacro"},
+		},
+	}
+}
+
+// ============================ execute_request ================================
+
+func (k *Kernel) execute(msg *kernelMessage) {
+	var content struct {
+		Code   string `json:"code"`
+		Silent bool   `json:"silent"`
+	}
+	json.Unmarshal(msg.content, &content)
+	if !content.Silent {
+		k.count++
+		k.publish(msg, "execute_input", kernelObject{"code": content.Code, "execution_count": k.count})
+	}
+	values, types, errs := k.eval(msg, content.Code, content.Silent)
+
+	if len(errs) != 0 {
+		k.reply(msg, "execute_reply", kernelObject{
+			"status":          "error",
+			"execution_count": k.count,
+			"ename":           "Error",
+			"evalue":          errs[0],
+			"traceback":       errs,
+		})
+		return
+	}
+	if len(values) != 0 && !content.Silent {
+		k.publish(msg, "execute_result", kernelObject{
+			"execution_count": k.count,
+			"data":            kernelObject{"text/plain": k.format(values, types)},
+			"metadata":        kernelObject{},
+		})
+	}
+	k.reply(msg, "execute_reply", kernelObject{
+		"status":           "ok",
+		"execution_count":  k.count,
+		"user_expressions": kernelObject{},
+		"payload":          []interface{}{},
+	})
+}
+
+// evaluate code, sending its output to iopub as "stream" messages.
+// return the results of the last statement and the errors
+func (k *Kernel) eval(msg *kernelMessage, code string, silent bool) ([]xr.Value, []xr.Type, []string) {
+	ir := k.interp
+	g := &ir.Comp.Globals
+
+	outr, outw, err := os.Pipe()
+	if err != nil {
+		return nil, nil, []string{err.Error()}
+	}
+	errr, errw, err := os.Pipe()
+	if err != nil {
+		outr.Close()
+		outw.Close()
+		return nil, nil, []string{err.Error()}
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go k.stream(msg, "stdout", outr, silent, &wg)
+	go k.stream(msg, "stderr", errr, silent, &wg)
+
+	var values []xr.Value
+	var types []xr.Type
+	var errs []string
+	ir.SetEventHandler(func(event fast.Event) {
+		switch event.Kind {
+		case fast.EventParseError, fast.EventCompileError, fast.EventRuntimeError:
+			if event.Err != nil {
+				errs = append(errs, event.Err.Error())
+			}
+		case fast.EventResult:
+			values, types = event.Values, event.Types
+		}
+	})
+	saveStdout, saveStderr := os.Stdout, os.Stderr
+	saveOut, saveErr, saveReadline := g.Stdout, g.Stderr, g.Readline
+	os.Stdout, os.Stderr = outw, errw
+	g.Stdout, g.Stderr = outw, errw
+	g.Readline = MakeBufReadline(bufio.NewReader(strings.NewReader(code)))
+	g.Line = 0
+
+	for ir.ReadParseEvalPrint() {
+	}
+
+	ir.SetEventHandler(nil)
+	os.Stdout, os.Stderr = saveStdout, saveStderr
+	g.Stdout, g.Stderr, g.Readline = saveOut, saveErr, saveReadline
+	outw.Close()
+	errw.Close()
+	wg.Wait()
+	return values, types, errs
+}
+
+// forward what is written to pipe r as iopub "stream" messages
+func (k *Kernel) stream(msg *kernelMessage, name string, r io.ReadCloser, silent bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer r.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 && !silent {
+			k.publish(msg, "stream", kernelObject{"name": name, "text": string(buf[:n])})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// format values as Globals.Print() does
+func (k *Kernel) format(values []xr.Value, types []xr.Type) string {
+	g := &k.interp.Comp.Globals
+	var buf bytes.Buffer
+	for i, v := range values {
+		if i != 0 {
+			buf.WriteByte('\n')
+		}
+		if i < len(types) && types[i] != nil {
+			g.Fprintf(&buf, "%v\t// %v", g.Printable(v.ReflectValue()), types[i])
+		} else {
+			g.Fprintf(&buf, "%v", g.Printable(v.ReflectValue()))
+		}
+	}
+	return buf.String()
+}
+
+// ====================== complete_request, inspect_request =====================
+
+func (k *Kernel) complete(msg *kernelMessage) {
+	var content struct {
+		Code      string `json:"code"`
+		CursorPos int    `json:"cursor_pos"`
+	}
+	json.Unmarshal(msg.content, &content)
+	pos := kernelByteOffset(content.Code, content.CursorPos)
+	candidates := k.interp.Complete(content.Code, pos)
+	start := utf8.RuneCountInString(content.Code[:pos]) - utf8.RuneCountInString(fast.TailIdentifier(content.Code[:pos]))
+	matches := make([]string, len(candidates))
+	types := make([]kernelObject, len(candidates))
+	for i, candidate := range candidates {
+		matches[i] = candidate.Name
+		// format understood by JupyterLab to show the kind and type of each match
+		types[i] = kernelObject{
+			"start":     start,
+			"end":       content.CursorPos,
+			"text":      candidate.Name,
+			"type":      candidate.Kind.String(),
+			"signature": candidate.Type,
+		}
+	}
+	k.reply(msg, "complete_reply", kernelObject{
+		"status":       "ok",
+		"matches":      matches,
+		"cursor_start": start,
+		"cursor_end":   content.CursorPos,
+		"metadata":     kernelObject{"_jupyter_types_experimental": types},
+	})
+}
+
+func (k *Kernel) inspect(msg *kernelMessage) {
+	var content struct {
+		Code      string `json:"code"`
+		CursorPos int    `json:"cursor_pos"`
+	}
+	json.Unmarshal(msg.content, &content)
+	pos := kernelByteOffset(content.Code, content.CursorPos)
+	text := k.describe(kernelWordAt(content.Code, pos))
+	data := kernelObject{}
+	if len(text) != 0 {
+		data["text/plain"] = text
+	}
+	k.reply(msg, "inspect_reply", kernelObject{
+		"status":   "ok",
+		"found":    len(text) != 0,
+		"data":     data,
+		"metadata": kernelObject{},
+	})
+}
+
+// describe the type, and the value if any, of the identifier or selector 'word'.
+// return "" if it cannot be resolved
+func (k *Kernel) describe(word string) (text string) {
+	if len(word) == 0 {
+		return ""
+	}
+	defer func() {
+		if recover() != nil {
+			text = ""
+		}
+	}()
+	ir := k.interp
+	c := ir.Comp
+	g := &c.Globals
+	form := c.Parse(word)
+	if slice, ok := form.(ast2.AstWithSlice); ok && slice.Size() == 1 {
+		form = slice.Get(0)
+	}
+	expr, t := c.Expr1OrType(ast2.ToExpr(form))
+	if expr == nil {
+		if len(t.Name()) != 0 {
+			return g.Sprintf("type %s %v", word, t.GoType().Underlying())
+		}
+		return g.Sprintf("type %v", t)
+	}
+	// word contains only identifiers and dots: evaluating it has no side effects
+	val, t := ir.RunExpr1(expr)
+	return g.Sprintf("%s = %v\t// %v", word, val.ReflectValue(), t)
+}
+
+// return the identifier, optionally followed by .field or .method, around byte offset pos
+func kernelWordAt(code string, pos int) string {
+	isWord := func(ch byte) bool {
+		return ch == '_' || ch == '.' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= 0x80
+	}
+	start, end := pos, pos
+	for start > 0 && isWord(code[start-1]) {
+		start--
+	}
+	for end < len(code) && isWord(code[end]) && code[end] != '.' {
+		end++
+	}
+	return strings.Trim(code[start:end], ".")
+}
+
+// convert an offset in unicode code points, as used by Jupyter, to a byte offset
+func kernelByteOffset(code string, runes int) int {
+	for i := range code {
+		if runes <= 0 {
+			return i
+		}
+		runes--
+	}
+	return len(code)
+}
+
+// ============================ is_complete_request =============================
+
+func (k *Kernel) isComplete(msg *kernelMessage) {
+	var content struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(msg.content, &content)
+	status := "complete"
+	in := MakeBufReadline(bufio.NewReader(strings.NewReader(content.Code + "\n")))
+	for {
+		_, _, err := ReadMultiline(in, 0, "")
+		if err == io.ErrUnexpectedEOF {
+			status = "incomplete"
+			break
+		} else if err != nil {
+			break
+		}
+	}
+	reply := kernelObject{"status": status}
+	if status == "incomplete" {
+		reply["indent"] = ""
+	}
+	k.reply(msg, "is_complete_reply", reply)
+}
+
+// ============================== wire protocol =================================
+
+// decode and verify a received message. return nil if invalid
+func (k *Kernel) parse(zmsg zmtpMessage) *kernelMessage {
+	frames := zmsg.frames
+	delim := -1
+	for i, frame := range frames {
+		if string(frame) == kernelDelimiter {
+			delim = i
+			break
+		}
+	}
+	// delimiter, signature, header, parent header, metadata, content
+	if delim < 0 || len(frames) < delim+6 {
+		return nil
+	}
+	parts := frames[delim+2 : delim+6]
+	if len(k.key) != 0 {
+		expected, err := hex.DecodeString(string(frames[delim+1]))
+		if err != nil || !hmac.Equal(expected, k.sign(parts)) {
+			g := &k.interp.Comp.Globals
+			g.Warnf("gomacro kernel: discarding message with invalid signature")
+			return nil
+		}
+	}
+	msg := &kernelMessage{
+		conn:    zmsg.conn,
+		idents:  frames[:delim],
+		rawhdr:  parts[0],
+		content: parts[3],
+	}
+	if json.Unmarshal(parts[0], &msg.header) != nil {
+		return nil
+	}
+	return msg
+}
+
+func (k *Kernel) sign(parts [][]byte) []byte {
+	mac := hmac.New(sha256.New, k.key)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return mac.Sum(nil)
+}
+
+// encode a message with given parent, type and content.
+// parent can be nil
+func (k *Kernel) encode(idents [][]byte, parent *kernelMessage, msgtype string, content interface{}) [][]byte {
+	header, _ := json.Marshal(kernelHeader{
+		MsgID:    newWebToken(),
+		Username: "kernel",
+		Session:  k.session,
+		Date:     time.Now().UTC().Format(time.RFC3339Nano),
+		MsgType:  msgtype,
+		Version:  kernelProtocolVersion,
+	})
+	rawparent := []byte("{}")
+	if parent != nil {
+		rawparent = parent.rawhdr
+	}
+	body, _ := json.Marshal(content)
+	parts := [][]byte{header, rawparent, []byte("{}"), body}
+	var sig string
+	if len(k.key) != 0 {
+		sig = hex.EncodeToString(k.sign(parts))
+	}
+	frames := append(idents[:len(idents):len(idents)], []byte(kernelDelimiter), []byte(sig))
+	return append(frames, parts...)
+}
+
+// send a reply to msg on the connection it arrived from
+func (k *Kernel) reply(msg *kernelMessage, msgtype string, content interface{}) {
+	msg.conn.Send(k.encode(msg.idents, msg, msgtype, content))
+}
+
+// send a message on iopub, using msgtype as topic
+func (k *Kernel) publish(parent *kernelMessage, msgtype string, content interface{}) {
+	frames := k.encode([][]byte{[]byte(msgtype)}, parent, msgtype, content)
+	k.lock.Lock()
+	k.iopub.Publish(frames)
+	k.lock.Unlock()
+}
@@ -0,0 +1,353 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * notebook.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "github.com/cosmos72/gomacro/base"
+)
+
+// a Markdown text paragraph or a fenced code block
+type notebookBlock struct {
+	fence  string // opening fence, as "```" or "~~~~". empty for Markdown text
+	info   string // info string after the opening fence
+	text   string // Markdown text, or code block contents
+	line   int    // line number of the code block first line, starting from 0
+	exec   bool   // true for ```go and ```gomacro code blocks
+	output string // output of executing the code block
+}
+
+// Notebook executes the Go code blocks of Markdown files, see "gomacro notebook"
+func (cmd *Cmd) Notebook(args []string) error {
+	var outname string
+	var filenames []string
+	for len(args) > 0 {
+		switch args[0] {
+		case "-o", "--output":
+			if len(args) > 1 {
+				outname = args[1]
+				args = args[1:]
+			}
+		default:
+			if len(args[0]) > 1 && args[0][0] == '-' {
+				return fmt.Errorf("gomacro notebook: unrecognized option '%s'.\nTry 'gomacro --help' for more information", args[0])
+			}
+			filenames = append(filenames, args[0])
+		}
+		args = args[1:]
+	}
+	if len(filenames) == 0 {
+		return fmt.Errorf("gomacro notebook: missing Markdown file.\nTry 'gomacro --help' for more information")
+	} else if len(filenames) > 1 && len(outname) != 0 {
+		return fmt.Errorf("gomacro notebook: option --output requires a single Markdown file")
+	}
+	for _, filename := range filenames {
+		err := cmd.NotebookFile(filename, outname)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotebookFile executes the Go code blocks of Markdown file 'filename'
+// and writes the Markdown file, including the output of each block, to 'outname'.
+// If outname is empty, 'filename' is overwritten. If outname is "-", standard output is used.
+// If outname ends with ".html" or ".htm", the result is rendered as HTML
+func (cmd *Cmd) NotebookFile(filename string, outname string) error {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	g := &cmd.Interp.Comp.Globals
+	saveFilename := g.Filepath
+	g.Filepath = filename
+	defer func() {
+		g.Filepath = saveFilename
+	}()
+
+	var buf bytes.Buffer
+	asHTML := strings.HasSuffix(outname, ".html") || strings.HasSuffix(outname, ".htm")
+	err = cmd.EvalNotebook(&buf, bytes.NewReader(src), asHTML)
+	if err != nil {
+		return err
+	}
+	switch outname {
+	case "":
+		outname = filename
+	case "-":
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(outname, buf.Bytes(), 0666)
+}
+
+// EvalNotebook reads a Markdown document from 'in' and executes in order its code blocks
+// fenced by ```go or ```gomacro, then writes the document to 'out'
+// adding an ```output block after each code block that produced some output.
+// Output blocks added by a previous execution are replaced.
+// If asHTML is true, the document is rendered as HTML instead
+func (cmd *Cmd) EvalNotebook(out io.Writer, in io.Reader, asHTML bool) error {
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	blocks := parseNotebook(string(src))
+	for i := range blocks {
+		if blocks[i].exec {
+			blocks[i].output, err = cmd.evalNotebookBlock(blocks[i].text, blocks[i].line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w := bufio.NewWriter(out)
+	if asHTML {
+		writeNotebookHTML(w, blocks)
+	} else {
+		writeNotebookMarkdown(w, blocks)
+	}
+	return w.Flush()
+}
+
+// execute a code block, and return everything it wrote to standard output and standard error,
+// including the printed results and errors.
+// line is used to report positions relative to the whole document
+func (cmd *Cmd) evalNotebookBlock(code string, line int) (string, error) {
+	ir := cmd.Interp
+	g := &ir.Comp.Globals
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		r.Close()
+		close(done)
+	}()
+
+	saveStdout, saveStderr := os.Stdout, os.Stderr
+	saveOut, saveErr := g.Stdout, g.Stderr
+	saveReadline, saveOptions := g.Readline, g.Options
+	os.Stdout, os.Stderr = w, w
+	g.Stdout, g.Stderr = w, w
+	g.Readline = MakeBufReadline(bufio.NewReader(strings.NewReader(code)))
+	g.Options = (g.Options | OptShowEval | OptTrapPanic) &^ OptShowPrompt
+	g.Line = line
+	defer func() {
+		os.Stdout, os.Stderr = saveStdout, saveStderr
+		g.Stdout, g.Stderr = saveOut, saveErr
+		g.Readline, g.Options = saveReadline, saveOptions
+	}()
+
+	for ir.ReadParseEvalPrint() {
+	}
+	w.Close()
+	<-done
+	return buf.String(), nil
+}
+
+// split a Markdown document into text and fenced code blocks.
+// discards the output blocks added by a previous execution
+func parseNotebook(src string) []notebookBlock {
+	var blocks []notebookBlock
+	var text strings.Builder
+	lines := strings.SplitAfter(src, "\n")
+	for i := 0; i < len(lines); {
+		fence, info := openingFence(lines[i])
+		if len(fence) == 0 {
+			text.WriteString(lines[i])
+			i++
+			continue
+		}
+		if text.Len() != 0 {
+			blocks = append(blocks, notebookBlock{text: text.String()})
+			text.Reset()
+		}
+		code, next := fencedCode(lines, i+1, fence)
+		lang := info
+		if space := strings.IndexAny(lang, " \t{"); space >= 0 {
+			lang = lang[:space]
+		}
+		exec := lang == "go" || lang == "gomacro"
+		blocks = append(blocks, notebookBlock{fence: fence, info: info, text: code, line: i + 1, exec: exec})
+		i = next
+		if exec {
+			// skip the output block added by a previous execution, if any
+			j := i
+			for j < len(lines) && len(strings.TrimSpace(lines[j])) == 0 {
+				j++
+			}
+			if j < len(lines) {
+				if fence, info := openingFence(lines[j]); len(fence) != 0 && info == "output" {
+					_, i = fencedCode(lines, j+1, fence)
+				}
+			}
+		}
+	}
+	if text.Len() != 0 {
+		blocks = append(blocks, notebookBlock{text: text.String()})
+	}
+	return blocks
+}
+
+// if line opens a fenced code block, return the fence and the info string
+func openingFence(line string) (fence string, info string) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return "", ""
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 {
+		return "", ""
+	}
+	info = strings.TrimSpace(trimmed[n:])
+	if trimmed[0] == '`' && strings.IndexByte(info, '`') >= 0 {
+		return "", ""
+	}
+	return trimmed[:n], info
+}
+
+// return the contents of the fenced code block starting at lines[start]
+// and the index of the line after its closing fence
+func fencedCode(lines []string, start int, fence string) (string, int) {
+	var code strings.Builder
+	i := start
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && len(strings.Trim(trimmed, fence[:1])) == 0 {
+			return code.String(), i + 1
+		}
+		code.WriteString(lines[i])
+	}
+	// unclosed block extends until the end of the document
+	return code.String(), i
+}
+
+func writeNotebookMarkdown(w *bufio.Writer, blocks []notebookBlock) {
+	for _, block := range blocks {
+		if len(block.fence) == 0 {
+			w.WriteString(block.text)
+			continue
+		}
+		writeFencedCode(w, block.fence, block.info, block.text)
+		if len(block.output) != 0 {
+			fence := "```"
+			for strings.Contains(block.output, fence) {
+				fence += "`"
+			}
+			w.WriteString("\n")
+			writeFencedCode(w, fence, "output", block.output)
+		}
+	}
+}
+
+func writeFencedCode(w *bufio.Writer, fence string, info string, code string) {
+	w.WriteString(fence)
+	w.WriteString(info)
+	w.WriteString("\n")
+	w.WriteString(code)
+	if len(code) != 0 && !strings.HasSuffix(code, "\n") {
+		w.WriteString("\n")
+	}
+	w.WriteString(fence)
+	w.WriteString("\n")
+}
+
+// render the notebook as a standalone HTML page.
+// Markdown text is converted with minimal formatting:
+// only headings and paragraphs are recognized
+func writeNotebookHTML(w *bufio.Writer, blocks []notebookBlock) {
+	w.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>
+body { max-width: 50em; margin: auto; font-family: sans-serif; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+pre.output { background: #fff; border-left: 3px solid #ccc; }
+</style>
+</head>
+<body>
+`)
+	for _, block := range blocks {
+		if len(block.fence) == 0 {
+			writeMarkdownHTML(w, block.text)
+			continue
+		}
+		lang := block.info
+		if space := strings.IndexAny(lang, " \t{"); space >= 0 {
+			lang = lang[:space]
+		}
+		if len(lang) != 0 {
+			fmt.Fprintf(w, "<pre><code class=\"language-%s\">", html.EscapeString(lang))
+		} else {
+			w.WriteString("<pre><code>")
+		}
+		w.WriteString(html.EscapeString(block.text))
+		w.WriteString("</code></pre>\n")
+		if len(block.output) != 0 {
+			w.WriteString("<pre class=\"output\">")
+			w.WriteString(html.EscapeString(block.output))
+			w.WriteString("</pre>\n")
+		}
+	}
+	w.WriteString("</body>\n</html>\n")
+}
+
+func writeMarkdownHTML(w *bufio.Writer, text string) {
+	var para []string
+	flush := func() {
+		if len(para) != 0 {
+			w.WriteString("<p>")
+			w.WriteString(html.EscapeString(strings.Join(para, "\n")))
+			w.WriteString("</p>\n")
+			para = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		level := 0
+		for level < len(trimmed) && level < 6 && trimmed[level] == '#' {
+			level++
+		}
+		switch {
+		case len(trimmed) == 0:
+			flush()
+		case level != 0 && (level == len(trimmed) || trimmed[level] == ' '):
+			flush()
+			fmt.Fprintf(w, "<h%d>%s</h%d>\n", level, html.EscapeString(strings.TrimSpace(trimmed[level:])), level)
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	flush()
+}
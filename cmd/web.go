@@ -0,0 +1,478 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * web.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/fast"
+)
+
+// packages that "gomacro web" allows to import by default:
+// they cannot access files, network or processes
+var webImports = map[string]bool{
+	"bufio": true, "bytes": true, "container/heap": true, "container/list": true, "container/ring": true,
+	"context": true, "crypto/md5": true, "crypto/sha1": true, "crypto/sha256": true,
+	"encoding/base64": true, "encoding/csv": true, "encoding/hex": true, "encoding/json": true,
+	"errors": true, "fmt": true, "hash/crc32": true, "hash/fnv": true, "html": true, "io": true,
+	"math": true, "math/big": true, "math/bits": true, "math/cmplx": true, "math/rand": true,
+	"regexp": true, "sort": true, "strconv": true, "strings": true, "sync": true, "sync/atomic": true,
+	"text/tabwriter": true, "time": true, "unicode": true, "unicode/utf16": true, "unicode/utf8": true,
+}
+
+const (
+	webCookie         = "gomacro_session"
+	webInterruptGrace = time.Second            // how long to wait for an interrupted evaluation to stop
+	webHeapCheck      = 100 * time.Millisecond // how often to compare the heap size with WebServer.MaxHeap
+)
+
+// WebServer is a HTTP server for a minimal web REPL, see "gomacro web".
+// Each browser gets its own interpreter, identified by a session cookie.
+//
+// Interpreted code can only import the packages accepted by AllowImport,
+// cannot execute REPL commands as :write or :prelude, cannot start goroutines,
+// cannot allocate more than MaxAlloc bytes with a single make() or new(),
+// and each evaluation is interrupted after Timeout or when the heap of the whole process
+// exceeds MaxHeap. If an evaluation does not stop even then,
+// for example because it is blocked in a compiled function as time.Sleep(),
+// its session is discarded.
+//
+// MaxHeap limits the heap shared by all sessions: Go cannot tell which session allocated
+// the memory, thus when the limit is exceeded all the evaluations in progress are interrupted,
+// including the ones that allocated little.
+//
+// Sessions are evaluated concurrently, each one by its own interpreter:
+// the output of fmt.Print, fmt.Printf, fmt.Println, print and println is collected per session,
+// without redirecting os.Stdout or os.Stderr.
+type WebServer struct {
+	Timeout        time.Duration             // maximum duration of each evaluation
+	SessionTimeout time.Duration             // sessions idle for longer are discarded
+	MaxSessions    int                       // when exceeded, the least recently used session is discarded
+	MaxSourceSize  int64                     // maximum size in bytes of each evaluated source code
+	MaxOutputSize  int                       // output exceeding this size in bytes is truncated
+	MaxAlloc       int64                     // maximum size in bytes of each make() and new(). zero means unlimited
+	MaxHeap        uint64                    // evaluations are interrupted if the heap of the process exceeds this size in bytes. zero means unlimited
+	AllowImport    func(pkgpath string) bool // if nil, only a predefined set of safe packages can be imported
+
+	lock     sync.Mutex // protects sessions
+	sessions map[string]*webSession
+}
+
+type webSession struct {
+	ir       *fast.Interp
+	token    string
+	used     time.Time  // protected by WebServer.lock
+	evalLock sync.Mutex // serializes the evaluations of this session
+	dead     bool       // protected by evalLock: set when an evaluation could not be interrupted
+	out      webOutput
+}
+
+// webOutput is where the interpreter of a session writes:
+// the output of the evaluation in progress. Writes outside an evaluation are discarded
+type webOutput struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (out *webOutput) set(w io.Writer) {
+	out.lock.Lock()
+	out.w = w
+	out.lock.Unlock()
+}
+
+func (out *webOutput) Write(data []byte) (int, error) {
+	out.lock.Lock()
+	defer out.lock.Unlock()
+	if out.w == nil {
+		return len(data), nil
+	}
+	return out.w.Write(data)
+}
+
+// webResult is the JSON reply to POST /eval
+type webResult struct {
+	Output    string   `json:"output"` // everything printed, including results and errors
+	Errors    []string `json:"errors,omitempty"`
+	Status    string   `json:"status"` // one of "ok", "error", "timeout", "memory"
+	Duration  string   `json:"duration"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// NewWebServer returns a WebServer with default limits
+func NewWebServer() *WebServer {
+	return &WebServer{
+		Timeout:        5 * time.Second,
+		SessionTimeout: 30 * time.Minute,
+		MaxSessions:    100,
+		MaxSourceSize:  64 * 1024,
+		MaxOutputSize:  64 * 1024,
+		MaxAlloc:       64 * 1024 * 1024,
+		MaxHeap:        1024 * 1024 * 1024,
+		sessions:       make(map[string]*webSession),
+	}
+}
+
+// Web starts a HTTP server with a minimal web REPL, see "gomacro web"
+func (cmd *Cmd) Web(args []string) error {
+	listen := ":8080"
+	s := NewWebServer()
+	for len(args) > 0 {
+		switch args[0] {
+		case "-l", "--listen":
+			if len(args) > 1 {
+				listen = args[1]
+				args = args[1:]
+			}
+		case "-t", "--timeout":
+			if len(args) > 1 {
+				timeout, err := time.ParseDuration(args[1])
+				if err != nil || timeout <= 0 {
+					return fmt.Errorf("gomacro web: invalid timeout '%s'", args[1])
+				}
+				s.Timeout = timeout
+				args = args[1:]
+			}
+		default:
+			return fmt.Errorf("gomacro web: unrecognized option '%s'.\nTry 'gomacro --help' for more information", args[0])
+		}
+		args = args[1:]
+	}
+	g := &cmd.Interp.Comp.Globals
+	g.Fprintf(g.Stdout, "// gomacro web: listening on %s\n", listen)
+	return http.ListenAndServe(listen, s)
+}
+
+func (s *WebServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/":
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, webPage)
+	case "/eval":
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		src, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, s.MaxSourceSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		sess := s.session(w, req)
+		result := s.eval(sess, string(src))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	case "/reset":
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if cookie, err := req.Cookie(webCookie); err == nil {
+			s.lock.Lock()
+			delete(s.sessions, cookie.Value)
+			s.lock.Unlock()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// return the session identified by the request cookie,
+// or create a new one and set the cookie
+func (s *WebServer) session(w http.ResponseWriter, req *http.Request) *webSession {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for token, sess := range s.sessions {
+		if now.Sub(sess.used) > s.SessionTimeout {
+			delete(s.sessions, token)
+		}
+	}
+	if cookie, err := req.Cookie(webCookie); err == nil {
+		if sess := s.sessions[cookie.Value]; sess != nil {
+			sess.used = now
+			return sess
+		}
+	}
+	for len(s.sessions) > 0 && len(s.sessions) >= s.MaxSessions {
+		var oldest string
+		for token, sess := range s.sessions {
+			if len(oldest) == 0 || sess.used.Before(s.sessions[oldest].used) {
+				oldest = token
+			}
+		}
+		delete(s.sessions, oldest)
+	}
+	token := newWebToken()
+	sess := &webSession{token: token, used: now}
+	sess.ir = s.newInterp(&sess.out)
+	s.sessions[token] = sess
+	http.SetCookie(w, &http.Cookie{
+		Name:     webCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return sess
+}
+
+func newWebToken() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// create an interpreter with the restrictions described in WebServer documentation,
+// that writes its output to out
+func (s *WebServer) newInterp(out io.Writer) *fast.Interp {
+	ir := fast.New()
+	g := ir.Comp.CompGlobals
+	g.Options |= OptTrapPanic | OptInterruptibleChan | OptShowEval | OptShowEvalType
+	g.Options &^= OptShowPrompt | OptDebugger
+	g.ReplCmdChar = 0 // disable REPL commands
+	g.ForbidGo = true
+	g.MaxAlloc = s.MaxAlloc
+	g.Stdout, g.Stderr, g.PrintStderr = out, out, out
+	for name, fun := range map[string]interface{}{
+		"fmt.Print": func(args ...interface{}) (int, error) {
+			return fmt.Fprint(out, args...)
+		},
+		"fmt.Printf": func(format string, args ...interface{}) (int, error) {
+			return fmt.Fprintf(out, format, args...)
+		},
+		"fmt.Println": func(args ...interface{}) (int, error) {
+			return fmt.Fprintln(out, args...)
+		},
+		// would execute interpreted code in a new goroutine, as a "go" statement
+		"time.AfterFunc": func(time.Duration, func()) *time.Timer {
+			panic(errors.New("time.AfterFunc is not allowed"))
+		},
+	} {
+		if _, err := ir.Mock(name, fun); err != nil {
+			panic(err)
+		}
+	}
+	allow := s.AllowImport
+	if allow == nil {
+		allow = func(pkgpath string) bool {
+			return webImports[pkgpath]
+		}
+	}
+	g.Importer.SetImportFilter(allow)
+	return ir
+}
+
+// evaluate code in the session interpreter, collecting its output and errors
+func (s *WebServer) eval(sess *webSession, code string) *webResult {
+	sess.evalLock.Lock()
+	defer sess.evalLock.Unlock()
+
+	if sess.dead {
+		// the evaluation still running owns the interpreter
+		const msg = "session discarded because an evaluation could not be interrupted, retry to start a new one"
+		return &webResult{Output: msg + "\n", Errors: []string{msg}, Status: "error", Duration: "0s"}
+	}
+	result := &webResult{Status: "ok"}
+	out := &limitedBuffer{max: s.MaxOutputSize}
+	sess.out.set(out)
+
+	ir := sess.ir
+	g := &ir.Comp.Globals
+	var errlock sync.Mutex
+	var errs []string
+	ir.SetEventHandler(func(event fast.Event) {
+		switch event.Kind {
+		case fast.EventParseError, fast.EventCompileError, fast.EventRuntimeError:
+			if event.Err != nil {
+				errlock.Lock()
+				errs = append(errs, event.Err.Error())
+				errlock.Unlock()
+			}
+		}
+	})
+	g.Readline = MakeBufReadline(bufio.NewReader(strings.NewReader(code)))
+	g.Line = 0
+
+	start := time.Now()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ir.ReadParseEvalPrint() {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	if status := s.wait(done); status != "ok" {
+		result.Status = status
+		if status == "memory" {
+			errlock.Lock()
+			errs = append(errs, fmt.Sprintf("heap limit of %d bytes exceeded, by this or other sessions", s.MaxHeap))
+			errlock.Unlock()
+		}
+		close(stop)
+		ir.Interrupt(os.Interrupt)
+		select {
+		case <-done:
+		case <-time.After(webInterruptGrace):
+			// still running: the interpreter is unusable, discard the session.
+			// Evaluations of the same session already waiting for evalLock must not start
+			sess.dead = true
+			s.lock.Lock()
+			delete(s.sessions, sess.token)
+			s.lock.Unlock()
+			errlock.Lock()
+			errs = append(errs, "evaluation could not be interrupted, session discarded")
+			errlock.Unlock()
+		}
+	}
+	result.Duration = time.Since(start).String()
+	// discard the output of an evaluation that could not be interrupted
+	sess.out.set(nil)
+
+	result.Output = out.String()
+	result.Truncated = out.truncated
+	errlock.Lock()
+	result.Errors = append([]string(nil), errs...)
+	errlock.Unlock()
+	if result.Status == "ok" && len(result.Errors) != 0 {
+		result.Status = "error"
+	}
+	return result
+}
+
+// wait until the evaluation completes, exceeds Timeout or the heap exceeds MaxHeap.
+// return the evaluation status: "ok", "timeout" or "memory"
+func (s *WebServer) wait(done <-chan struct{}) string {
+	timeout := time.NewTimer(s.Timeout)
+	defer timeout.Stop()
+	var heapCheck <-chan time.Time
+	if s.MaxHeap > 0 {
+		ticker := time.NewTicker(webHeapCheck)
+		defer ticker.Stop()
+		heapCheck = ticker.C
+	}
+	for {
+		select {
+		case <-done:
+			return "ok"
+		case <-timeout.C:
+			return "timeout"
+		case <-heapCheck:
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > s.MaxHeap {
+				return "memory"
+			}
+		}
+	}
+}
+
+// a strings.Builder that silently discards data after max bytes
+type limitedBuffer struct {
+	strings.Builder
+	max       int
+	truncated bool
+}
+
+func (buf *limitedBuffer) Write(data []byte) (int, error) {
+	n := len(data)
+	if room := buf.max - buf.Len(); n > room {
+		buf.truncated = true
+		if room > 0 {
+			buf.Builder.Write(data[:room])
+		}
+		return n, nil
+	}
+	return buf.Builder.Write(data)
+}
+
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gomacro</title>
+<style>
+body { font-family: sans-serif; margin: 1em auto; max-width: 60em; }
+textarea, pre { box-sizing: border-box; width: 100%; font-family: monospace; font-size: 14px; }
+pre { background: #f4f4f4; padding: 0.5em; min-height: 4em; white-space: pre-wrap; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h3>gomacro</h3>
+<textarea id="code" rows="16" spellcheck="false">import "fmt"
+
+fmt.Println("hello, world")</textarea>
+<p><button id="run">Run</button> <button id="reset">Reset session</button> <span id="status"></span></p>
+<pre id="output"></pre>
+<script>
+const code = document.getElementById("code");
+const output = document.getElementById("output");
+const status = document.getElementById("status");
+async function run() {
+  status.textContent = "running...";
+  const reply = await fetch("eval", { method: "POST", body: code.value });
+  if (!reply.ok) {
+    status.textContent = await reply.text();
+    return;
+  }
+  const result = await reply.json();
+  output.textContent = result.output + (result.truncated ? "\n... output truncated" : "");
+  output.className = result.status === "ok" ? "" : "error";
+  status.textContent = result.status + " in " + result.duration;
+}
+document.getElementById("run").onclick = run;
+document.getElementById("reset").onclick = async function() {
+  await fetch("reset", { method: "POST" });
+  output.textContent = "";
+  status.textContent = "session reset";
+};
+code.onkeydown = function(event) {
+  if (event.key === "Enter" && (event.ctrlKey || event.metaKey)) {
+    event.preventDefault();
+    run();
+  }
+};
+</script>
+</body>
+</html>
+`
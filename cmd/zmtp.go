@@ -0,0 +1,282 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * zmtp.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// minimal server-side implementation of ZeroMQ Message Transport Protocol 3.0
+// https://rfc.zeromq.org/spec/23/ with NULL security mechanism:
+// just enough to talk with Jupyter clients, which use libzmq, without depending on it.
+//
+// Each zmtpSocket accepts any number of TCP connections. Messages are received
+// from all of them, and replies are sent on the connection that delivered the request:
+// this is what a ROUTER socket does, without exposing routing identities.
+// A PUB socket sends each message to all connections, ignoring subscriptions,
+// and a REP socket echoes back each message it receives, as needed by Jupyter heartbeat.
+
+const (
+	zmtpMore    = 0x01 // more frames follow in the same message
+	zmtpLong    = 0x02 // frame size is 8 bytes instead of 1
+	zmtpCommand = 0x04 // frame is a command instead of a message
+
+	zmtpMaxFrame = 1 << 30 // refuse larger frames
+)
+
+type zmtpSocket struct {
+	kind  string // "ROUTER", "PUB" or "REP"
+	ln    net.Listener
+	recv  chan zmtpMessage // messages received by ROUTER sockets
+	lock  sync.Mutex       // protects conns
+	conns map[*zmtpConn]struct{}
+}
+
+type zmtpConn struct {
+	conn  net.Conn
+	in    *bufio.Reader
+	wlock sync.Mutex // serializes writes
+}
+
+type zmtpMessage struct {
+	conn   *zmtpConn // connection that delivered the message
+	frames [][]byte
+}
+
+// create a socket of given kind listening on transport://ip:port
+// and start accepting connections
+func zmtpListen(kind string, transport string, ip string, port int) (*zmtpSocket, error) {
+	if transport != "tcp" {
+		return nil, fmt.Errorf("unsupported ZeroMQ transport %q, only \"tcp\" is supported", transport)
+	}
+	if ip == "*" {
+		ip = ""
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip, fmt.Sprint(port)))
+	if err != nil {
+		return nil, err
+	}
+	s := &zmtpSocket{
+		kind:  kind,
+		ln:    ln,
+		recv:  make(chan zmtpMessage, 16),
+		conns: make(map[*zmtpConn]struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+func (s *zmtpSocket) Close() error {
+	s.lock.Lock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.conns = nil
+	s.lock.Unlock()
+	return s.ln.Close()
+}
+
+func (s *zmtpSocket) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(&zmtpConn{conn: conn, in: bufio.NewReader(conn)})
+	}
+}
+
+// perform the handshake, then receive messages until the connection is closed
+func (s *zmtpSocket) serve(c *zmtpConn) {
+	defer c.conn.Close()
+	if c.handshake(s.kind) != nil {
+		return
+	}
+	s.lock.Lock()
+	if s.conns == nil {
+		s.lock.Unlock()
+		return // socket closed
+	}
+	s.conns[c] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, c)
+		s.lock.Unlock()
+	}()
+	for {
+		frames, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		switch s.kind {
+		case "REP":
+			err = c.Send(frames)
+		case "ROUTER":
+			s.recv <- zmtpMessage{conn: c, frames: frames}
+		}
+		// PUB sockets ignore subscriptions: they always send everything
+		if err != nil {
+			return
+		}
+	}
+}
+
+// send a message to all connections
+func (s *zmtpSocket) Publish(frames [][]byte) {
+	s.lock.Lock()
+	conns := make([]*zmtpConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.lock.Unlock()
+	for _, c := range conns {
+		if c.Send(frames) != nil {
+			c.conn.Close() // serve() will remove it from s.conns
+		}
+	}
+}
+
+// exchange greetings and READY commands
+func (c *zmtpConn) handshake(kind string) error {
+	var greeting [64]byte
+	greeting[0] = 0xFF
+	greeting[9] = 0x7F
+	greeting[10] = 3 // major version
+	greeting[11] = 0 // minor version
+	copy(greeting[12:32], "NULL")
+	if _, err := c.conn.Write(greeting[:]); err != nil {
+		return err
+	}
+	var peer [64]byte
+	if _, err := io.ReadFull(c.in, peer[:]); err != nil {
+		return err
+	}
+	if peer[0] != 0xFF || peer[9]&1 != 1 || peer[10] < 3 {
+		return errors.New("zmtp: unsupported peer protocol version")
+	}
+	if mechanism := strings.TrimRight(string(peer[12:32]), "\x00"); mechanism != "NULL" {
+		return fmt.Errorf("zmtp: unsupported security mechanism %q", mechanism)
+	}
+	if err := c.writeFrame(zmtpCommand, zmtpReady(kind)); err != nil {
+		return err
+	}
+	flags, body, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	if flags&zmtpCommand == 0 || len(body) < 6 || string(body[1:6]) != "READY" {
+		return errors.New("zmtp: expecting READY command from peer")
+	}
+	return nil
+}
+
+// return the body of a READY command
+func zmtpReady(kind string) []byte {
+	const name, prop = "READY", "Socket-Type"
+	body := make([]byte, 0, 1+len(name)+1+len(prop)+4+len(kind))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	body = append(body, byte(len(prop)))
+	body = append(body, prop...)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(kind)))
+	body = append(body, size[:]...)
+	return append(body, kind...)
+}
+
+// read a multi-frame message, skipping commands
+func (c *zmtpConn) readMessage() ([][]byte, error) {
+	var frames [][]byte
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmtpCommand != 0 {
+			continue
+		}
+		frames = append(frames, body)
+		if flags&zmtpMore == 0 {
+			return frames, nil
+		}
+	}
+}
+
+func (c *zmtpConn) readFrame() (flags byte, body []byte, err error) {
+	if flags, err = c.in.ReadByte(); err != nil {
+		return
+	}
+	var size uint64
+	if flags&zmtpLong != 0 {
+		var buf [8]byte
+		if _, err = io.ReadFull(c.in, buf[:]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(buf[:])
+	} else {
+		var b byte
+		if b, err = c.in.ReadByte(); err != nil {
+			return
+		}
+		size = uint64(b)
+	}
+	if size > zmtpMaxFrame {
+		return flags, nil, fmt.Errorf("zmtp: frame too large: %d bytes", size)
+	}
+	body = make([]byte, size)
+	_, err = io.ReadFull(c.in, body)
+	return flags, body, err
+}
+
+// send a multi-frame message
+func (c *zmtpConn) Send(frames [][]byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	for i, frame := range frames {
+		var flags byte
+		if i != len(frames)-1 {
+			flags = zmtpMore
+		}
+		if err := c.writeFrame(flags, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *zmtpConn) writeFrame(flags byte, body []byte) error {
+	var header [9]byte
+	n := 2
+	if len(body) > 255 {
+		header[0] = flags | zmtpLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+		n = 9
+	} else {
+		header[0] = flags
+		header[1] = byte(len(body))
+	}
+	_, err := c.conn.Write(append(header[:n:n], body...))
+	return err
+}
@@ -67,6 +67,7 @@ func (c *Comp) addressOf(expr ast.Expr, t xr.Type) *Expr {
 }
 func (c *Comp) AddressOfVar(name string) *Expr {
 	sym := c.Resolve(name)
+	c.captureAddressOf(name)
 	va := sym.AsVar(PlaceAddress)
 	return va.Address(c.Depth)
 }
@@ -33,7 +33,7 @@ type Assign struct {
 
 func (a *Assign) init(c *Comp, place *Place) {
 	if place.IsVar() {
-		a.setvar = c.varSetValue(&place.Var)
+		a.setvar = c.recordWriteValue(&place.Var, c.varSetValue(&place.Var))
 	} else {
 		a.placefun = place.Fun
 		a.placekey = place.MapKey
@@ -78,15 +78,18 @@ func (c *Comp) Assign(node *ast.AssignStmt) {
 	exprs := make([]*Expr, rn)
 	canreorder := true
 	for i, li := range lhs {
-		places[i] = c.Place(li)
+		places[i] = c.assignPlace(li, node.Tok)
 		canreorder = canreorder && places[i].IsVar() // ach, needed. see for example i := 0; i, x[i] = 1, 2  // set i = 1, x[0] = 2
 	}
+	if node.Tok != token.ASSIGN && c.bigNumAssign(places[0], lhs[0], tokenWithoutAssign(node.Tok), rhs[0]) {
+		return
+	}
 	if rn == 1 && ln > 1 {
 		exprs[0] = c.expr(rhs[0], nil)
 		canreorder = false
 	} else {
 		for i, ri := range rhs {
-			exprs[i] = c.expr1(ri, nil)
+			exprs[i] = c.expr1(ri, exprHint(ri, places[i].Type))
 			canreorder = canreorder && exprs[i].Const()
 		}
 	}
@@ -134,7 +137,7 @@ func (c *Comp) assignPrepareRhs(node *ast.AssignStmt, places []*Place, exprs []*
 				expr.To(c, tplace)
 			} else {
 				c.Pos = rhs[i].Pos()
-				c.Errorf("cannot use <%v> as <%v> in assignment: %v %v %v", expr.Type, tplace, lhs[i], node.Tok, rhs[i])
+				c.Errorf("cannot use <%v> as <%v> in assignment: %v %v %v%s", expr.Type, tplace, lhs[i], node.Tok, rhs[i], interfaceMissingMethod(expr.Type, tplace))
 			}
 			exprfuns[i] = expr.AsX1()
 		}
@@ -319,6 +322,9 @@ func (c *Comp) assign1(lhs ast.Expr, op token.Token, rhs ast.Expr, place *Place,
 // SetVar compiles an assignment to a variable:
 // 'variable op constant' and 'variable op expression'
 func (c *Comp) SetVar(va *Var, op token.Token, init *Expr) {
+	if op == token.ASSIGN {
+		c.noteConcreteTypeVar(va, init)
+	}
 	// c.setVar() has the side effect of converting
 	// RHS untyped constants to the correct type,
 	// also needed by c.Jit.SetVar() below
@@ -333,6 +339,7 @@ func (c *Comp) SetVar(va *Var, op token.Token, init *Expr) {
 		stmt = jstmt
 	}
 	c.append(stmt)
+	c.recordWrite(va)
 }
 
 // SetPlace compiles an assignment to a place:
@@ -342,9 +349,12 @@ func (c *Comp) SetPlace(place *Place, op token.Token, init *Expr) {
 		c.SetVar(&place.Var, op, init)
 		return
 	}
-	// c.setPlace() has the side effect of converting
-	// RHS untyped constants to the correct type
-	stmt := c.setPlace(place, op, init)
+	stmt := c.placeSetFieldShim(place, op, init)
+	if stmt == nil {
+		// c.setPlace() has the side effect of converting
+		// RHS untyped constants to the correct type
+		stmt = c.setPlace(place, op, init)
+	}
 	c.append(stmt)
 }
 
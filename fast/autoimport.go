@@ -0,0 +1,162 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * autoimport.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/base/genimport"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// autoImport is invoked when compiling name.sel
+// if OptAutoImport is set and 'name' is not defined, search for a package
+// with such name that exports 'sel' and import it - mimicking what goimports does.
+// if OptProjectImports is set, first search the packages of the Go module
+// in the current directory and of its direct dependencies.
+// Returns true if a package was imported
+func (c *Comp) autoImport(name string, sel string) bool {
+	if c.Options&(base.OptAutoImport|base.OptProjectImports) == 0 || name == "_" || c.TryResolve(name) != nil {
+		return false
+	}
+	for o := c; o != nil; o = o.Outer {
+		if _, ok := o.Types[name]; ok {
+			return false
+		}
+	}
+	var path string
+	if c.Options&base.OptProjectImports != 0 {
+		if proj := c.Project(); proj != nil {
+			path = proj.Packages[name]
+		}
+	}
+	if len(path) == 0 && c.Options&base.OptAutoImport != 0 {
+		candidates := autoImportCandidates(c.Importer.Registry(), name, sel)
+		switch len(candidates) {
+		case 0:
+		case 1:
+			path = candidates[0]
+		default:
+			path = c.chooseAutoImport(name, candidates)
+		}
+	}
+	if len(path) == 0 {
+		return false
+	}
+	c.FileComp().ImportPackage(name, path)
+	c.collectAutoImport(path)
+	if c.Options&base.OptShowPrompt != 0 {
+		c.Debugf("auto-imported %q", path)
+	}
+	return true
+}
+
+// Project returns the packages of the Go module containing the current directory,
+// or nil if the current directory is not part of a Go module.
+// If option OptProjectImports is set, such packages are imported on first reference as pkg.Name
+func (cg *CompGlobals) Project() *genimport.Project {
+	if !cg.projectLoaded {
+		cg.projectLoaded = true
+		if dir, err := os.Getwd(); err == nil {
+			cg.project, _ = genimport.FindProject(dir)
+		}
+	}
+	return cg.project
+}
+
+// return the sorted import paths of known packages named 'name' that export 'sel',
+// or of all known packages named 'name' if sel is empty.
+// as goimports does, standard library packages are preferred
+func autoImportCandidates(registry *imports.Registry, name string, sel string) []string {
+	var std, other []string
+	for _, path := range registry.Paths() {
+		pkg, _ := registry.Lookup(path)
+		if isInternalOrVendored(path) || pkg.DefaultName(path) != name {
+			continue
+		}
+		if len(sel) == 0 {
+			// any package named 'name' will do
+		} else if _, ok := pkg.Binds[sel]; !ok {
+			if _, ok := pkg.Types[sel]; !ok {
+				continue
+			}
+		}
+		if isStdlib(path) {
+			std = append(std, path)
+		} else {
+			other = append(other, path)
+		}
+	}
+	if len(std) == 0 {
+		std = other
+	}
+	sort.Strings(std)
+	return std
+}
+
+// standard library import paths do not contain a domain name
+func isStdlib(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+func isInternalOrVendored(path string) bool {
+	for _, dir := range strings.Split(path, "/") {
+		if dir == "internal" || dir == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseAutoImport asks the user which package to import when 'name' is ambiguous.
+// if the interpreter is not interactive, it reports an error instead
+func (c *Comp) chooseAutoImport(name string, candidates []string) string {
+	g := &c.Globals
+	if g.Options&base.OptShowPrompt == 0 || g.Readline == nil {
+		c.Errorf("cannot auto-import %q: ambiguous package name, candidates are: %s", name, strings.Join(candidates, " "))
+		return ""
+	}
+	g.Fprintf(g.Stdout, "// auto-import: multiple packages named %q\n", name)
+	for i, path := range candidates {
+		g.Fprintf(g.Stdout, "//   %d) %q\n", i+1, path)
+	}
+	line, err := g.Readline.Read("// which one? (empty to cancel) ")
+	if err != nil {
+		return ""
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(string(line)))
+	if err != nil || i <= 0 || i > len(candidates) {
+		return ""
+	}
+	return candidates[i-1]
+}
+
+// add the automatic import to the collected declarations
+func (c *Comp) collectAutoImport(path string) {
+	g := &c.Globals
+	if g.Options&base.OptCollectDeclarations == 0 {
+		return
+	}
+	spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}}
+	g.Imports = append(g.Imports, &ast.GenDecl{Tok: token.IMPORT, Specs: []ast.Spec{spec}})
+}
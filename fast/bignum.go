@@ -0,0 +1,340 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * bignum.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math/big"
+	r "reflect"
+	"strings"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/base/reflect"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// syntax extension "bignums", enabled by base.OptExtBigNums:
+// literals 123n and 1.5n are *big.Int and *big.Rat,
+// and arithmetic and comparison operators on them call their methods.
+// Results are always new values: operands are never modified
+
+var (
+	rtypeOfPtrBigInt = r.TypeOf((*big.Int)(nil))
+	rtypeOfPtrBigRat = r.TypeOf((*big.Rat)(nil))
+
+	bigIntZero = new(big.Int)
+	bigRatZero = new(big.Rat)
+
+	bigIntOps = map[token.Token]func(z, x, y *big.Int) *big.Int{
+		token.ADD:     (*big.Int).Add,
+		token.SUB:     (*big.Int).Sub,
+		token.MUL:     (*big.Int).Mul,
+		token.QUO:     (*big.Int).Quo,
+		token.REM:     (*big.Int).Rem,
+		token.AND:     (*big.Int).And,
+		token.OR:      (*big.Int).Or,
+		token.XOR:     (*big.Int).Xor,
+		token.AND_NOT: (*big.Int).AndNot,
+	}
+	bigRatOps = map[token.Token]func(z, x, y *big.Rat) *big.Rat{
+		token.ADD: (*big.Rat).Add,
+		token.SUB: (*big.Rat).Sub,
+		token.MUL: (*big.Rat).Mul,
+		token.QUO: (*big.Rat).Quo,
+	}
+)
+
+func (c *Comp) TypeOfPtrBigInt() xr.Type {
+	return c.Universe.FromReflectType(rtypeOfPtrBigInt)
+}
+
+func (c *Comp) TypeOfPtrBigRat() xr.Type {
+	return c.Universe.FromReflectType(rtypeOfPtrBigRat)
+}
+
+// return true if t is *big.Int or *big.Rat
+func isBigNumType(t xr.Type) bool {
+	if t == nil {
+		return false
+	}
+	rtype := t.ReflectType()
+	return rtype == rtypeOfPtrBigInt || rtype == rtypeOfPtrBigRat
+}
+
+// return true if node is a big number literal 123n or 1.5n.
+// The parser only accepts them if base.OptExtBigNums is set
+func isBigNumLit(node *ast.BasicLit) bool {
+	return (node.Kind == token.INT || node.Kind == token.FLOAT) && strings.HasSuffix(node.Value, "n")
+}
+
+// BigNumLit compiles a big number literal: 123n is a *big.Int and 1.5n is a *big.Rat
+func (c *Comp) BigNumLit(node *ast.BasicLit) *Expr {
+	str := strings.TrimSuffix(node.Value, "n")
+	val := constant.MakeFromLiteral(str, node.Kind, 0)
+	num := bigNumFromConst(val, node.Kind == token.FLOAT)
+	if num == nil {
+		c.Errorf("invalid big number literal: %v", node.Value)
+	}
+	return c.bigNumExpr(num)
+}
+
+// convert an exact constant to *big.Rat if rat is true, otherwise to *big.Int.
+// Returns nil if val is not a number, or if rat is false and val is not an integer
+func bigNumFromConst(val constant.Value, rat bool) interface{} {
+	if rat {
+		val = constant.ToFloat(val)
+		if val.Kind() != constant.Float && val.Kind() != constant.Int {
+			return nil
+		}
+		if q, ok := new(big.Rat).SetString(val.ExactString()); ok {
+			return q
+		}
+		return nil
+	}
+	val = constant.ToInt(val)
+	if val.Kind() != constant.Int {
+		return nil
+	}
+	if n, ok := new(big.Int).SetString(val.ExactString(), 10); ok {
+		return n
+	}
+	return nil
+}
+
+// return an expression evaluating to a copy of num, which must be *big.Int or *big.Rat.
+// A copy is needed because methods of big.Int and big.Rat modify their receiver
+func (c *Comp) bigNumExpr(num interface{}) *Expr {
+	switch num := num.(type) {
+	case *big.Int:
+		return exprX1(c.TypeOfPtrBigInt(), func(*Env) xr.Value {
+			return xr.ValueOf(new(big.Int).Set(num))
+		})
+	case *big.Rat:
+		return exprX1(c.TypeOfPtrBigRat(), func(*Env) xr.Value {
+			return xr.ValueOf(new(big.Rat).Set(num))
+		})
+	}
+	c.Errorf("internal error! bigNumExpr() invoked with %v <%T>, expecting *big.Int or *big.Rat", num, num)
+	return nil
+}
+
+// convert a runtime value to *big.Int. nil is treated as zero
+func bigIntOf(v xr.Value) *big.Int {
+	if v.IsValid() {
+		if n, _ := v.Interface().(*big.Int); n != nil {
+			return n
+		}
+	}
+	return bigIntZero
+}
+
+// convert a runtime value to *big.Rat. nil is treated as zero
+func bigRatOf(v xr.Value) *big.Rat {
+	if v.IsValid() {
+		if q, _ := v.Interface().(*big.Rat); q != nil {
+			return q
+		}
+	}
+	return bigRatZero
+}
+
+// bigNumBinaryExpr compiles 'x op y' where x or y is a *big.Int or *big.Rat:
+// x + y becomes new(big.Int).Add(x, y), x < y becomes x.Cmp(y) < 0 and so on.
+// Untyped constants are converted to the type of the other operand.
+// Returns nil if neither x nor y is a big number, or if op compares a big number with nil:
+// such expressions are compiled as usual
+func (c *Comp) bigNumBinaryExpr(node *ast.BinaryExpr, x *Expr, y *Expr) *Expr {
+	if !isBigNumType(x.Type) && !isBigNumType(y.Type) || x.Type == nil || y.Type == nil {
+		return nil
+	}
+	op := tokenWithoutAssign(node.Op)
+	if op == token.SHL || op == token.SHR {
+		return c.bigIntShift(node, op, x, y)
+	}
+	t := x.Type
+	if !isBigNumType(t) {
+		t = y.Type
+	}
+	for _, e := range [...]*Expr{x, y} {
+		if !e.Untyped() && !e.Type.IdenticalTo(t) {
+			c.Errorf("invalid operation: %v (mismatched types %v and %v)", node, x.Type, y.Type)
+		}
+	}
+	x, y = c.bigNumOperand(t, x), c.bigNumOperand(t, y)
+	xfun, yfun := x.AsX1(), y.AsX1()
+
+	if t.ReflectType() == rtypeOfPtrBigInt {
+		if fop := bigIntOps[op]; fop != nil {
+			return exprX1(t, func(env *Env) xr.Value {
+				return xr.ValueOf(fop(new(big.Int), bigIntOf(xfun(env)), bigIntOf(yfun(env))))
+			})
+		} else if isComparison(op) {
+			return c.exprBool(func(env *Env) bool {
+				return bigNumCmp(op, bigIntOf(xfun(env)).Cmp(bigIntOf(yfun(env))))
+			})
+		}
+	} else {
+		if fop := bigRatOps[op]; fop != nil {
+			return exprX1(t, func(env *Env) xr.Value {
+				return xr.ValueOf(fop(new(big.Rat), bigRatOf(xfun(env)), bigRatOf(yfun(env))))
+			})
+		} else if isComparison(op) {
+			return c.exprBool(func(env *Env) bool {
+				return bigNumCmp(op, bigRatOf(xfun(env)).Cmp(bigRatOf(yfun(env))))
+			})
+		}
+	}
+	return c.invalidBinaryExpr(node, x, y)
+}
+
+// convert the operand e of a big number operation to type t.
+// e must have type t or be an untyped constant
+func (c *Comp) bigNumOperand(t xr.Type, e *Expr) *Expr {
+	if !e.Untyped() {
+		return e
+	}
+	val := e.Value.(UntypedLit).Val
+	num := bigNumFromConst(val, t.ReflectType() == rtypeOfPtrBigRat)
+	if num == nil {
+		c.Errorf("cannot convert untyped constant %v to <%v>", val, t)
+	}
+	return c.bigNumExpr(num)
+}
+
+// compile 'x << y' or 'x >> y' where x is a *big.Int
+func (c *Comp) bigIntShift(node *ast.BinaryExpr, op token.Token, x *Expr, y *Expr) *Expr {
+	if x.Untyped() {
+		x = c.bigNumOperand(c.TypeOfPtrBigInt(), x)
+	} else if x.Type.ReflectType() != rtypeOfPtrBigInt {
+		return c.invalidBinaryExpr(node, x, y)
+	}
+	var count func(*Env) uint
+	if y.Untyped() {
+		val := constant.ToInt(y.Value.(UntypedLit).Val)
+		n, exact := constant.Uint64Val(val)
+		if val.Kind() != constant.Int || !exact || uint64(uint(n)) != n {
+			c.Errorf("invalid shift count: %v", node)
+		}
+		count = func(*Env) uint {
+			return uint(n)
+		}
+	} else {
+		yfun := y.AsX1()
+		switch reflect.Category(y.Type.Kind()) {
+		case r.Int:
+			count = func(env *Env) uint {
+				n := yfun(env).Int()
+				if n < 0 {
+					panic(negativeShiftAmount)
+				}
+				return uint(n)
+			}
+		case r.Uint:
+			count = func(env *Env) uint {
+				return uint(yfun(env).Uint())
+			}
+		default:
+			c.Errorf("invalid shift count type %v, expecting an integer: %v", y.Type, node)
+		}
+	}
+	xfun := x.AsX1()
+	var fop func(z, x *big.Int, n uint) *big.Int = (*big.Int).Lsh
+	if op == token.SHR {
+		fop = (*big.Int).Rsh
+	}
+	return exprX1(x.Type, func(env *Env) xr.Value {
+		return xr.ValueOf(fop(new(big.Int), bigIntOf(xfun(env)), count(env)))
+	})
+}
+
+// return true if op is a comparison operator
+func isComparison(op token.Token) bool {
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return true
+	}
+	return false
+}
+
+// convert the result of big.Int.Cmp or big.Rat.Cmp to the result of comparison op
+func bigNumCmp(op token.Token, cmp int) bool {
+	switch op {
+	case token.EQL:
+		return cmp == 0
+	case token.NEQ:
+		return cmp != 0
+	case token.LSS:
+		return cmp < 0
+	case token.LEQ:
+		return cmp <= 0
+	case token.GTR:
+		return cmp > 0
+	default: // token.GEQ
+		return cmp >= 0
+	}
+}
+
+// bigNumUnaryExpr compiles 'op x' where x is a *big.Int or *big.Rat:
+// -x becomes new(big.Int).Neg(x) and ^x becomes new(big.Int).Not(x).
+// Returns nil if x is not a big number
+func (c *Comp) bigNumUnaryExpr(node *ast.UnaryExpr, xe *Expr) *Expr {
+	if !isBigNumType(xe.Type) {
+		return nil
+	}
+	xfun := xe.AsX1()
+	isInt := xe.Type.ReflectType() == rtypeOfPtrBigInt
+	switch {
+	case node.Op == token.ADD:
+		return xe
+	case node.Op == token.SUB && isInt:
+		return exprX1(xe.Type, func(env *Env) xr.Value {
+			return xr.ValueOf(new(big.Int).Neg(bigIntOf(xfun(env))))
+		})
+	case node.Op == token.SUB:
+		return exprX1(xe.Type, func(env *Env) xr.Value {
+			return xr.ValueOf(new(big.Rat).Neg(bigRatOf(xfun(env))))
+		})
+	case node.Op == token.XOR && isInt:
+		return exprX1(xe.Type, func(env *Env) xr.Value {
+			return xr.ValueOf(new(big.Int).Not(bigIntOf(xfun(env))))
+		})
+	}
+	return nil
+}
+
+// bigNumAssign compiles 'lhs op= rhs', 'lhs++' and 'lhs--' where lhs is a *big.Int or *big.Rat,
+// as 'lhs = lhs op rhs'. Thus the operands of index expressions in lhs are evaluated twice.
+// Returns false if base.OptExtBigNums is not set or lhs is not a big number
+func (c *Comp) bigNumAssign(place *Place, lhs ast.Expr, op token.Token, rhs ast.Expr) bool {
+	if c.Options&base.OptExtBigNums == 0 || !isBigNumType(place.Type) {
+		return false
+	}
+	c.Assign(&ast.AssignStmt{
+		Lhs:    []ast.Expr{lhs},
+		TokPos: lhs.End(),
+		Tok:    token.ASSIGN,
+		Rhs: []ast.Expr{&ast.BinaryExpr{
+			X:     lhs,
+			OpPos: lhs.End(),
+			Op:    op,
+			Y:     rhs,
+		}},
+	})
+	return true
+}
@@ -20,7 +20,9 @@ import (
 	"go/ast"
 	"go/constant"
 	"go/token"
+	"math"
 
+	"github.com/cosmos72/gomacro/base"
 	"github.com/cosmos72/gomacro/base/reflect"
 	"github.com/cosmos72/gomacro/base/untyped"
 	etoken "github.com/cosmos72/gomacro/go/etoken"
@@ -28,19 +30,121 @@ import (
 )
 
 func (c *Comp) BinaryExpr(node *ast.BinaryExpr) *Expr {
-	x := c.expr1(node.X, nil)
-	y := c.expr1(node.Y, nil)
+	return c.binaryExpr(node, nil)
+}
+
+// binaryExpr compiles a binary expression. t is the type expected by the context, or nil if unknown:
+// it is only used to convert untyped constants shifted by a non-constant count, because
+// "If the left operand of a non-constant shift expression is an untyped constant,
+// it is first converted to the type it would assume if the shift expression
+// were replaced by its left operand alone." see https://golang.org/ref/spec#Operators
+func (c *Comp) binaryExpr(node *ast.BinaryExpr, t xr.Type) *Expr {
+	var x, y *Expr
+	switch node.Op {
+	case token.SHL, token.SHR:
+		x = c.expr1(node.X, shiftHint(node.X, t))
+		y = c.expr1(node.Y, nil)
+		if x.Untyped() && !y.Const() {
+			c.untypedShiftOperand(node, x, t)
+		}
+		return c.BinaryExpr1(node, x, y)
+	case token.LAND, token.LOR:
+		t = nil
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		// the result is untyped boolean: t is not the type of the operands
+		t = nil
+	}
+	// an operand shifted by a non-constant count assumes the type of the other operand
+	if isShift(node.X) && !isShift(node.Y) {
+		y = c.expr1(node.Y, shiftHint(node.Y, t))
+		x = c.expr1(node.X, operandHint(y, t))
+	} else if isShift(node.Y) && !isShift(node.X) {
+		x = c.expr1(node.X, shiftHint(node.X, t))
+		y = c.expr1(node.Y, operandHint(x, t))
+	} else {
+		x = c.expr1(node.X, shiftHint(node.X, t))
+		y = c.expr1(node.Y, shiftHint(node.Y, t))
+	}
 	return c.BinaryExpr1(node, x, y)
 }
 
+// return t if node is a binary expression, otherwise return nil.
+// Used to pass the expected type only to binary expressions,
+// which need it to convert untyped constants shifted by a non-constant count
+func shiftHint(node ast.Expr, t xr.Type) xr.Type {
+	if t == nil {
+		return nil
+	}
+	for {
+		paren, ok := node.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		node = paren.X
+	}
+	if _, ok := node.(*ast.BinaryExpr); ok {
+		return t
+	}
+	return nil
+}
+
+// return true if node is a shift expression
+func isShift(node ast.Expr) bool {
+	for {
+		paren, ok := node.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		node = paren.X
+	}
+	bin, ok := node.(*ast.BinaryExpr)
+	return ok && (bin.Op == token.SHL || bin.Op == token.SHR)
+}
+
+// return the type expected for a shift expression whose other operand is other,
+// and whose context expects type t (nil if unknown)
+func operandHint(other *Expr, t xr.Type) xr.Type {
+	if !other.Untyped() {
+		return other.Type
+	} else if t != nil {
+		return t
+	}
+	switch other.UntypedKind() {
+	case untyped.Rune, untyped.Float, untyped.Complex:
+		// untyped constant operands assume the "largest" of their kinds
+		return other.DefaultType()
+	}
+	return nil
+}
+
+// untypedShiftOperand converts xe, an untyped constant shifted by a non-constant count,
+// to the type t expected by the context. If t is nil or an interface, xe is converted to its default type
+func (c *Comp) untypedShiftOperand(node *ast.BinaryExpr, xe *Expr, t xr.Type) {
+	if t == nil || t.Kind() == xr.Interface {
+		t = xe.DefaultType()
+	}
+	if t == nil || !reflect.IsCategory(t.Kind(), xr.Int, xr.Uint) {
+		c.Errorf("invalid operation: shifted operand %v (type %v) must be integer: %v", node.X, t, node)
+	}
+	xe.ConstTo(t)
+}
+
 func (c *Comp) BinaryExpr1(node *ast.BinaryExpr, x *Expr, y *Expr) *Expr {
 	if x.Untyped() && y.Untyped() {
 		return c.BinaryExprUntyped(node, x.Value.(UntypedLit), y.Value.(UntypedLit))
 	}
+	if c.Options&base.OptExtBigNums != 0 {
+		if z := c.bigNumBinaryExpr(node, x, y); z != nil {
+			return z
+		}
+	}
 	bothConst := x.Const() && y.Const()
 	var z *Expr
 
 	op := tokenWithoutAssign(node.Op)
+	if bothConst && (op == token.QUO || op == token.REM) && isLiteralNumber(y.Value, 0) {
+		c.Errorf("division by zero")
+	}
 	switch op {
 	case token.ADD:
 		z = c.Add(node, x, y)
@@ -86,6 +190,7 @@ func (c *Comp) BinaryExpr1(node *ast.BinaryExpr, x *Expr, y *Expr) *Expr {
 	if bothConst {
 		// constant propagation
 		z.EvalConst(COptKeepUntyped)
+		c.checkConstOverflow(node, op, x, y, z)
 	} else {
 		// create jit expression for z
 		c.Jit.BinaryExpr(z, op, x, y)
@@ -121,6 +226,9 @@ func (c *Comp) BinaryExprUntyped(node *ast.BinaryExpr, x UntypedLit, y UntypedLi
 			// untyped integer division
 			op2 = token.QUO_ASSIGN
 		}
+		if (op2 == token.QUO || op2 == token.QUO_ASSIGN || op2 == token.REM) && y.EqualInt64(0) {
+			c.Errorf("division by zero")
+		}
 		zobj := constant.BinaryOp(x.Val, op2, y.Val)
 		zkind := untyped.MakeKind(zobj.Kind())
 		// c.Debugf("untyped binary expression %v %s %v returned {%v %v}", x, op2, y, zkind, zobj)
@@ -139,6 +247,110 @@ func (c *Comp) BinaryExprUntyped(node *ast.BinaryExpr, x UntypedLit, y UntypedLi
 	}
 }
 
+// checkConstOverflow panics if the typed constant z = x op y
+// was computed with wraparound or overflowed to infinity:
+// constant expressions must be exactly representable in their type
+func (c *Comp) checkConstOverflow(node *ast.BinaryExpr, op token.Token, x *Expr, y *Expr, z *Expr) {
+	if z.Untyped() || z.Type == nil {
+		return
+	}
+	switch reflect.Category(z.Type.Kind()) {
+	case xr.Int, xr.Uint:
+	case xr.Float64, xr.Complex128:
+		if isInfConst(z.Value) && !isInfConst(x.Value) && !isInfConst(y.Value) {
+			var exact interface{} = z.Value
+			if reflect.Category(z.Type.Kind()) == xr.Float64 {
+				xv := constant.MakeFloat64(xr.ValueOf(x.Value).Float())
+				yv := constant.MakeFloat64(xr.ValueOf(y.Value).Float())
+				exact = constant.BinaryOp(xv, op, yv)
+			}
+			c.constOverflow(node, exact, z.Type)
+		}
+		return
+	default:
+		return
+	}
+	xv, xok := constantIntVal(x.Value)
+	yv, yok := constantIntVal(y.Value)
+	zv, zok := constantIntVal(z.Value)
+	if !xok || !yok || !zok {
+		return
+	}
+	var exact constant.Value
+	switch op {
+	case token.ADD, token.SUB, token.MUL, token.REM:
+		exact = constant.BinaryOp(xv, op, yv)
+	case token.QUO:
+		exact = constant.BinaryOp(xv, token.QUO_ASSIGN, yv)
+	case token.SHL:
+		n, ok := constant.Uint64Val(yv)
+		if !ok || n > 1024 {
+			n = 1024 // large enough to overflow any integer type
+		}
+		exact = constant.Shift(xv, token.SHL, uint(n))
+	default:
+		return
+	}
+	if constant.Compare(exact, token.NEQ, zv) {
+		c.constOverflow(node, exact, z.Type)
+	}
+}
+
+// checkConstOverflowUnary panics if the typed constant z = op x
+// was computed with wraparound, as for example -int8(-128) or -uint(1)
+func (c *Comp) checkConstOverflowUnary(node *ast.UnaryExpr, x *Expr, z *Expr) {
+	if node.Op != token.SUB || z.Untyped() || z.Type == nil ||
+		!reflect.IsCategory(z.Type.Kind(), xr.Int, xr.Uint) {
+		return
+	}
+	xv, xok := constantIntVal(x.Value)
+	zv, zok := constantIntVal(z.Value)
+	if !xok || !zok {
+		return
+	}
+	if exact := constant.UnaryOp(token.SUB, xv, 0); constant.Compare(exact, token.NEQ, zv) {
+		c.constOverflow(node, exact, z.Type)
+	}
+}
+
+// constOverflow reports that the typed constant expression node
+// has value exact, which cannot be represented in type t. Same message as gc
+func (c *Comp) constOverflow(node ast.Expr, exact interface{}, t xr.Type) {
+	c.Errorf("%v (constant %v of type %v) overflows %v", node, exact, t, t)
+}
+
+// return true if value is a floating point or complex constant containing an infinity
+func isInfConst(value I) bool {
+	v := xr.ValueOf(value)
+	switch reflect.Category(v.Kind()) {
+	case xr.Float64:
+		return math.IsInf(v.Float(), 0)
+	case xr.Complex128:
+		z := v.Complex()
+		return math.IsInf(real(z), 0) || math.IsInf(imag(z), 0)
+	}
+	return false
+}
+
+// convert an integer constant to constant.Value
+func constantIntVal(value I) (constant.Value, bool) {
+	if lit, ok := value.(UntypedLit); ok {
+		val := constant.ToInt(lit.Val)
+		return val, val.Kind() == constant.Int
+	}
+	v := xr.ValueOf(value)
+	if !v.IsValid() {
+		return nil, false
+	}
+	switch reflect.Category(v.Kind()) {
+	case xr.Int:
+		return constant.MakeInt64(v.Int()), true
+	case xr.Uint:
+		return constant.MakeUint64(v.Uint()), true
+	}
+	return nil, false
+}
+
 var tokenRemoveAssign = map[token.Token]token.Token{
 	token.ADD_ASSIGN:     token.ADD,
 	token.SUB_ASSIGN:     token.SUB,
@@ -183,54 +395,27 @@ func tokenWithAssign(op token.Token) token.Token {
 	return ret
 }
 
-var warnUntypedShift, warnUntypedShift2 = true, true
+// "rhs must be within reasonable bounds in constant shifts", as go/types does:
+// large enough to express the smallest float64
+const constShiftBound = 1023 - 1 + 52
 
 func (c *Comp) ShiftUntyped(node *ast.BinaryExpr, op token.Token, x UntypedLit, y UntypedLit) *Expr {
-	var yn64 uint64
-	var exact bool
-
-	switch y.Val.Kind() {
-	case constant.Int:
-		yn64, exact = constant.Uint64Val(y.Val)
-	case constant.Float:
-		yf, fexact := constant.Float64Val(y.Val)
-		if fexact {
-			yn64 = uint64(yf)
-			exact = float64(yn64) == yf
-		}
-		// c.Debugf("ShiftUntyped: %v %v %v, rhs converted to %v <float64> => %v <uint64> (exact = %v)", x.Val, op, y.Val, yf, yn64, exact)
-	}
-	if !exact {
-		c.Errorf("invalid shift: %v %v %v", x.Val.ExactString(), op, y.Val.ExactString())
-	}
-	yn := uint(yn64)
-	if uint64(yn) != yn64 {
-		c.Errorf("invalid shift: %v %v %v", x.Val.ExactString(), op, y.Val.ExactString())
-	}
-	xn := x.Val
+	yn := c.constShiftCount(node, y.Val)
+	// "If the left operand of a constant shift expression is an untyped constant,
+	// the result is an integer constant" see https://golang.org/ref/spec#Operators
+	xn := constant.ToInt(x.Val)
 	xkind := x.Kind
 	switch xkind {
 	case untyped.Int, untyped.Rune:
 		// nothing to do
 	case untyped.Float, untyped.Complex:
-		if warnUntypedShift {
-			c.Warnf("known limitation (warned only once): untyped floating point constant shifted by untyped constant. returning untyped integer instead of deducing the type from the surrounding context: %v",
-				node)
-			warnUntypedShift = false
-		}
-		sign := constant.Sign(xn)
-		if xkind == untyped.Complex {
-			sign = constant.Sign(constant.Real(xn))
-		}
-		if sign >= 0 {
-			xn = constant.MakeUint64(x.Convert(c.TypeOfUint64()).(uint64))
-		} else {
-			xn = constant.MakeInt64(x.Convert(c.TypeOfInt64()).(int64))
-		}
 		xkind = untyped.Int
 	default:
 		c.Errorf("invalid shift: %v %v %v", x.Val, op, y.Val)
 	}
+	if xn.Kind() != constant.Int {
+		c.Errorf("invalid operation: shifted operand %v must be integer: %v", x.Val.ExactString(), node)
+	}
 	zobj := constant.Shift(xn, op, yn)
 	if zobj.Kind() == constant.Unknown {
 		c.Errorf("invalid shift: %v %v %v", x.Val, op, y.Val)
@@ -238,6 +423,60 @@ func (c *Comp) ShiftUntyped(node *ast.BinaryExpr, op token.Token, x UntypedLit,
 	return c.exprUntypedLit(xkind, zobj)
 }
 
+// constShiftCount returns the count of a constant shift expression,
+// or panics if it's negative, not an integer or too large
+func (c *Comp) constShiftCount(node *ast.BinaryExpr, y constant.Value) uint {
+	yint := constant.ToInt(y)
+	if yint.Kind() != constant.Int {
+		c.Errorf("invalid operation: shift count %v must be integer: %v", y.ExactString(), node)
+	} else if constant.Sign(yint) < 0 {
+		c.Errorf("invalid operation: negative shift count %v: %v", y.ExactString(), node)
+	}
+	yn, exact := constant.Uint64Val(yint)
+	if !exact || yn > constShiftBound {
+		c.Errorf("invalid operation: invalid shift count %v: %v", y.ExactString(), node)
+	}
+	return uint(yn)
+}
+
+// shiftCount panics if ye cannot be used as shift count: it must have integer type,
+// or be an untyped constant representable as uint, and constants must not be negative.
+// If constShift is true, the shifted operand is a constant too and the count must not be too large.
+// Constant shift counts are converted to uint64. node is only used in error messages, and can be nil
+func (c *Comp) shiftCount(node ast.Node, ye *Expr, constShift bool) {
+	var where string
+	if node != nil {
+		where = c.Sprintf(": %v", node)
+	}
+	if !ye.Const() {
+		if t := ye.Type; t == nil || !reflect.IsCategory(t.Kind(), xr.Int, xr.Uint) {
+			c.Errorf("invalid operation: shift count <%v> must be integer%s", t, where)
+		}
+		return
+	}
+	var yval constant.Value
+	if lit, ok := ye.Value.(UntypedLit); ok {
+		// untyped constants do not distinguish between int and uint,
+		// and untyped floating point shift counts are valid if representable as integers
+		yval = constant.ToInt(lit.Val)
+		if yval.Kind() != constant.Int {
+			c.Errorf("invalid operation: shift count %v must be integer%s", lit.Val.ExactString(), where)
+		}
+	} else if t := ye.Type; t == nil || !reflect.IsCategory(t.Kind(), xr.Int, xr.Uint) {
+		c.Errorf("invalid operation: shift count <%v> must be integer%s", t, where)
+	} else {
+		yval, _ = constantIntVal(ye.Value)
+	}
+	if constant.Sign(yval) < 0 {
+		c.Errorf("invalid operation: negative shift count %v%s", yval, where)
+	}
+	yn, exact := constant.Uint64Val(yval)
+	if !exact || (constShift && yn > constShiftBound) {
+		c.Errorf("invalid operation: invalid shift count %v%s", yval, where)
+	}
+	*ye = *c.exprValue(c.TypeOfUint64(), yn)
+}
+
 // prepareShift panics if the types of xe and ye are not valid for shifts i.e. << or >>
 // returns non-nil expression if it computes the shift operation itself
 func (c *Comp) prepareShift(node *ast.BinaryExpr, xe *Expr, ye *Expr) *Expr {
@@ -245,43 +484,26 @@ func (c *Comp) prepareShift(node *ast.BinaryExpr, xe *Expr, ye *Expr) *Expr {
 		// untyped << untyped should not happen here, it's handled in Comp.BinaryExpr... but let's be safe
 		return c.ShiftUntyped(node, node.Op, xe.Value.(UntypedLit), ye.Value.(UntypedLit))
 	}
-	xet, yet := xe.DefaultType(), ye.DefaultType()
-	if xet == nil || !reflect.IsCategory(xet.Kind(), xr.Int, xr.Uint) {
+	xet := xe.DefaultType()
+	if xet == nil || !reflect.IsCategory(xet.Kind(), xr.Int, xr.Uint, xr.Float64, xr.Complex128) {
 		return c.invalidBinaryExpr(node, xe, ye)
 	}
 	if xe.Untyped() {
 		xuntyp := xe.Value.(UntypedLit)
 		if ye.Const() {
 			// untyped << constant
-			yuntyp := untyped.MakeLit(untyped.Int, constant.MakeUint64(xr.ValueOf(ye.Value).Uint()), &c.Universe.BasicTypes)
+			c.shiftCount(node, ye, true)
+			yuntyp := untyped.MakeLit(untyped.Int, constant.MakeUint64(ye.Value.(uint64)), &c.Universe.BasicTypes)
 			return c.ShiftUntyped(node, node.Op, xuntyp, yuntyp)
 		}
-		// untyped << expression
-		// BUG! we should deduce left operand type from its context, instead of assuming int
-		// see https://golang.org/ref/spec#Operators
-		//
-		// "If the left operand of a non-constant shift expression is an untyped constant,
-		// "it is first converted to the type it would assume if the shift expression
-		// "were replaced by its left operand alone."
-		if warnUntypedShift2 {
-			c.Warnf("known limitation (warned only once): untyped constant shifted by a non-constant expression. returning int instead of deducing the type from the surrounding context: %v",
-				node)
-			warnUntypedShift2 = false
-		}
-		xe.ConstTo(c.TypeOfInt())
-	}
-	if ye.Untyped() {
-		// untyped constants do not distinguish between int and uint
-		if yet == nil || !reflect.IsCategory(yet.Kind(), xr.Int) {
-			return c.invalidBinaryExpr(node, xe, ye)
-		}
-		ye.ConstTo(c.TypeOfUint64())
-	} else {
-		// accept shift by signed integer, introduced in Go 1.13
-		if yet == nil || !reflect.IsCategory(yet.Kind(), xr.Int, xr.Uint) {
-			return c.invalidBinaryExpr(node, xe, ye)
-		}
+		// untyped << expression: usually converted already by Comp.binaryExpr,
+		// which knows the type expected by the context
+		c.untypedShiftOperand(node, xe, nil)
+	} else if !reflect.IsCategory(xet.Kind(), xr.Int, xr.Uint) {
+		return c.invalidBinaryExpr(node, xe, ye)
 	}
+	// accept shift by signed integer, introduced in Go 1.13
+	c.shiftCount(node, ye, xe.Const())
 	xe.WithFun()
 	ye.WithFun()
 	return nil
@@ -1375,6 +1375,8 @@ func (c *Comp) Quo(node *ast.BinaryExpr, xe *Expr, ye *Expr) *Expr {
 			return nil
 		} else if ze := c.quoPow2(node, xe, ye); ze != nil {
 			return ze
+		} else if ze := c.quoMagic(node, xe, ye); ze != nil {
+			return ze
 		}
 
 		switch k {
@@ -1748,6 +1750,8 @@ func (c *Comp) Rem(node *ast.BinaryExpr, xe *Expr, ye *Expr) *Expr {
 			return nil
 		} else if ze := c.remPow2(node, xe, ye); ze != nil {
 			return ze
+		} else if ze := c.remMagic(node, xe, ye); ze != nil {
+			return ze
 		}
 
 		switch k {
@@ -2344,7 +2348,9 @@ func (c *Comp) quoPow2(node *ast.BinaryExpr, xe *Expr, ye *Expr) *Expr {
 		return nil
 	} else if isLiteralNumber(ye.Value, 1) {
 		return xe
-	} else if isLiteralNumber(ye.Value, -1) {
+	} else if isLiteralNumber(ye.Value, -1) && reflect.Category(xe.Type.Kind()) == xr.Int {
+		// for unsigned integers, isLiteralNumber(ye.Value, -1) means ye is the maximum value:
+		// x / max is not -x
 		node1 := &ast.UnaryExpr{OpPos: node.OpPos, Op: token.SUB, X: node.X}
 		return c.UnaryMinus(node1, xe)
 	}
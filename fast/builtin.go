@@ -23,6 +23,8 @@ import (
 	"go/token"
 	"os"
 	r "reflect"
+	"strconv"
+	"unsafe"
 
 	"github.com/cosmos72/gomacro/base/reflect"
 
@@ -96,6 +98,7 @@ func (ir *Interp) addBuiltins() {
 
 	ir.DeclBuiltin("append", Builtin{compileAppend, 1, base.MaxUint16})
 	ir.DeclBuiltin("cap", Builtin{compileCap, 1, 1})
+	ir.DeclBuiltin("clear", Builtin{compileClear, 1, 1})
 	ir.DeclBuiltin("close", Builtin{compileClose, 1, 1})
 	ir.DeclBuiltin("copy", Builtin{compileCopy, 2, 2})
 	ir.DeclBuiltin("complex", Builtin{compileComplex, 2, 2})
@@ -103,6 +106,8 @@ func (ir *Interp) addBuiltins() {
 	ir.DeclBuiltin("imag", Builtin{compileRealImag, 1, 1})
 	ir.DeclBuiltin("len", Builtin{compileLen, 1, 1})
 	ir.DeclBuiltin("make", Builtin{compileMake, 1, 3})
+	ir.DeclBuiltin("max", Builtin{compileMax, 1, base.MaxUint16})
+	ir.DeclBuiltin("min", Builtin{compileMin, 1, base.MaxUint16})
 	ir.DeclBuiltin("new", Builtin{compileNew, 1, 1})
 	ir.DeclBuiltin("panic", Builtin{compilePanic, 1, 1})
 	ir.DeclBuiltin("print", Builtin{compilePrint, 0, base.MaxUint16})
@@ -111,16 +116,21 @@ func (ir *Interp) addBuiltins() {
 	ir.DeclBuiltin("recover", Builtin{compileRecover, 0, 0})
 	// ir.DeclBuiltin("recover", Function{callRecover, ir.Comp.TypeOf((*func() I)(nil)).Elem()})
 
-	tfunI2_Nb := ir.Comp.TypeOf(funI2_Nb)
-
-	ir.DeclEnvFunc("Interp", Function{callIdentity, ir.Comp.TypeOf(funI_I)})
-	ir.DeclEnvFunc("Eval", Function{callEval, ir.Comp.TypeOf(funI2_I)})
-	ir.DeclEnvFunc("EvalKeepUntyped", Function{callEvalKeepUntyped, ir.Comp.TypeOf(funI2_I)})
-	ir.DeclEnvFunc("EvalType", Function{callEvalType, ir.Comp.TypeOf(funI2_T)})
-	ir.DeclEnvFunc("MacroExpand", Function{callMacroExpand, tfunI2_Nb})
-	ir.DeclEnvFunc("MacroExpand1", Function{callMacroExpand1, tfunI2_Nb})
-	ir.DeclEnvFunc("MacroExpandCodeWalk", Function{callMacroExpandCodeWalk, tfunI2_Nb})
-	ir.DeclEnvFunc("Parse", Function{callParse, ir.Comp.TypeOf(funSI_I)})
+	// the types of the following functions mention *Interp, ast.Node, xreflect.Type...
+	// computing them imports the metadata of such packages, which takes hundreds of milliseconds:
+	// declare them on first use, to keep startup fast
+	ir.lazyEnvFunc("Interp", callIdentity, funI_I)
+	ir.lazyEnvFunc("Eval", callEval, funI2_I)
+	ir.lazyEnvFunc("EvalKeepUntyped", callEvalKeepUntyped, funI2_I)
+	ir.lazyEnvFunc("EvalType", callEvalType, funI2_T)
+	ir.lazyEnvFunc("MacroExpand", callMacroExpand, funI2_Nb)
+	ir.lazyEnvFunc("MacroExpand1", callMacroExpand1, funI2_Nb)
+	ir.lazyEnvFunc("MacroExpandCodeWalk", callMacroExpandCodeWalk, funI2_Nb)
+	ir.lazyEnvFunc("MacroType", callMacroType, funI2_XT)
+	ir.lazyEnvFunc("PartialEval", callPartialEval, funI2_Nb)
+	ir.lazyEnvFunc("Parse", callParse, funSI_I)
+
+	ir.addDerive()
 	/*
 		binds["Read"] = xr.ValueOf(ReadString)
 		binds["ReadDir"] = xr.ValueOf(callReadDir)
@@ -135,6 +145,29 @@ func (ir *Interp) addBuiltins() {
 	*/
 }
 
+// lazyEnvFunc declares the function name, with the same type as typ,
+// in the topmost Comp the first time it's resolved
+func (ir *Interp) lazyEnvFunc(name string, fun interface{}, typ interface{}) {
+	c := ir.Comp
+	if c.lazyBinds == nil {
+		c.lazyBinds = make(map[string]func() *Bind)
+	}
+	c.lazyBinds[name] = func() *Bind {
+		return c.DeclEnvFunc0(name, Function{fun, c.TypeOf(typ)})
+	}
+}
+
+// declLazyBind declares the builtin name if it's still pending, and returns its Bind.
+// Returns nil if name is not a pending builtin
+func (c *Comp) declLazyBind(name string) *Bind {
+	decl := c.lazyBinds[name]
+	if decl == nil {
+		return nil
+	}
+	delete(c.lazyBinds, name)
+	return decl()
+}
+
 // ============================= builtin functions =============================
 
 // --- append() ---
@@ -169,7 +202,12 @@ func compileAppend(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
 	}
 	t := c.Universe.FuncOf([]xr.Type{t0, t1}, []xr.Type{t0}, true) // compile as reflect.Append(), which is variadic
 	sym.Type = t
-	fun := exprLit(Lit{Type: t, Value: xr.Append}, &sym)
+	var fun *Expr
+	if basic := appendBasic(args, t0, node.Ellipsis != token.NoPos); basic != nil {
+		fun = exprLit(Lit{Type: t, Value: builtinFun{basic}}, &sym)
+	} else {
+		fun = exprLit(Lit{Type: t, Value: xr.Append}, &sym)
+	}
 	return &Call{
 		Fun:      fun,
 		Args:     args,
@@ -234,6 +272,34 @@ func compileClose(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
 	return newCall1(fun, arg, false)
 }
 
+// --- clear() ---
+
+func callClear(val xr.Value) {
+	switch val.Kind() {
+	case r.Map:
+		for _, key := range val.MapKeys() {
+			val.SetMapIndex(key, xr.Value{})
+		}
+	case r.Slice:
+		zero := xr.ZeroR(val.Type().Elem())
+		for i, n := 0, val.Len(); i < n; i++ {
+			val.Index(i).Set(zero)
+		}
+	}
+}
+
+func compileClear(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
+	arg := c.Expr1(node.Args[0], nil)
+	tin := arg.Type
+	if tin.Kind() != r.Map && tin.Kind() != r.Slice {
+		return c.badBuiltinCallArgType(sym.Name, node.Args[0], tin, "map, slice")
+	}
+	t := c.Universe.FuncOf([]xr.Type{tin}, zeroTypes, false)
+	sym.Type = t
+	fun := exprLit(Lit{Type: t, Value: callClear}, &sym)
+	return newCall1(fun, arg, false)
+}
+
 // --- complex() ---
 
 func callComplex64(re float32, im float32) complex64 {
@@ -341,8 +407,8 @@ func copyStringToBytes(dst []byte, src string) int {
 	return copy(dst, src)
 }
 
-func callCopy(dst xr.Value, src xr.Value) {
-	r.Copy(dst.ReflectValue(), src.ReflectValue())
+func callCopy(dst xr.Value, src xr.Value) int {
+	return r.Copy(dst.ReflectValue(), src.ReflectValue())
 }
 
 func compileCopy(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
@@ -585,6 +651,65 @@ func callMacroExpandDispatch(argv xr.Value, interpv xr.Value, caller string) (xr
 	return xr.ValueOf(form.Interface()).Convert(rtypeOfNode), flagv
 }
 
+// --- PartialEval() ---
+
+func callPartialEval(argv xr.Value, interpv xr.Value) (xr.Value, xr.Value) {
+	if !argv.IsValid() {
+		return xr.ZeroR(rtypeOfNode), False
+	}
+	form := anyToAst(argv.Interface(), "PartialEval")
+	form = base.UnwrapTrivialAst(form)
+	node, ok := form.Interface().(ast.Expr)
+	if !ok {
+		// not an expression: nothing to simplify
+		return xr.ValueOf(form.Interface()).Convert(rtypeOfNode), False
+	}
+	interp := interpv.Interface().(*Interp)
+	node, flag := interp.Comp.PartialEval(node)
+	flagv := False
+	if flag {
+		flagv = True
+	}
+	return xr.ValueOf(node).Convert(rtypeOfNode), flagv
+}
+
+// --- MacroType() ---
+
+func funI2_XT(I, I) xr.Type {
+	return nil
+}
+
+// callMacroType returns the static type of an expression, without evaluating it.
+// When invoked by a macro during macroexpansion, the expression is compiled
+// in the scope where the macro is being expanded: this allows macros
+// to generate different code depending on the type of their arguments.
+// Current limitation: macroexpansion happens before compiling,
+// thus local variables declared by the code being macroexpanded are not visible.
+func callMacroType(argv xr.Value, interpv xr.Value) xr.Value {
+	if !argv.IsValid() {
+		return zeroOfXrType
+	}
+	form := anyToAst(argv.Interface(), "MacroType")
+	form = base.UnwrapTrivialAst(form)
+
+	ir := interpv.Interface().(*Interp)
+	c := ir.Comp
+	if c.macroComp != nil {
+		c = c.macroComp
+	}
+	node, ok := form.Interface().(ast.Expr)
+	if !ok {
+		c.Errorf("MacroType: expecting expression, found %v <%v>", form.Interface(), r.TypeOf(form.Interface()))
+		return zeroOfXrType
+	}
+	e := c.expr1(node, nil)
+	t := e.Type
+	if e.Untyped() {
+		t = e.DefaultType()
+	}
+	return xr.ValueOf(&t).Elem() // always return type xreflect.Type
+}
+
 // --- make() ---
 
 func makeChan1(t xr.Type) xr.Value {
@@ -624,7 +749,7 @@ func compileMake(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
 	args[0] = c.exprValue(argtypes[0], tin) // no need to build TypeOfXreflectType
 	te := c.TypeOfInt()
 	for i := 1; i < nargs; i++ {
-		argi := c.expr1(node.Args[i], nil)
+		argi := c.expr1(node.Args[i], shiftHint(node.Args[i], te))
 		if argi.Const() {
 			argi.ConstTo(te)
 		} else if ti := argi.Type; ti == nil || (!ti.IdenticalTo(te) && !ti.AssignableTo(te)) {
@@ -641,14 +766,47 @@ func compileMake(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
 		c.Errorf("internal error: no make() alternative to call for %v with %d arguments", tin, nargs)
 		return nil
 	}
+	if max := c.MaxAlloc; max > 0 {
+		funMake = limitMake(funMake, max)
+	}
 	fun := exprLit(Lit{Type: t, Value: funMake}, &sym)
 	return &Call{Fun: fun, Args: args, OutTypes: outtypes, Const: false}
 }
 
+// wrap a function that implements make() to fail when allocating more than max bytes,
+// see CompGlobals.MaxAlloc
+func limitMake(funMake I, max int64) I {
+	check := func(t xr.Type, n int) {
+		size := t.Elem().Size()
+		if t.Kind() == xr.Map {
+			size += t.Key().Size()
+		}
+		if n > 0 && size != 0 && uint64(n) > uint64(max)/uint64(size) {
+			output.Errorf("make(%v, %d): allocation exceeds the limit of %d bytes", t, n, max)
+		}
+	}
+	switch fun := funMake.(type) {
+	case func(xr.Type, int) xr.Value:
+		return func(t xr.Type, n int) xr.Value {
+			check(t, n)
+			return fun(t, n)
+		}
+	case func(xr.Type, int, int) xr.Value:
+		return func(t xr.Type, n int, capacity int) xr.Value {
+			check(t, capacity)
+			return fun(t, n, capacity)
+		}
+	}
+	return funMake // make() without size
+}
+
 // --- new() ---
 
 func compileNew(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
 	tin := c.Type(node.Args[0])
+	if max := c.MaxAlloc; max > 0 && uint64(tin.Size()) > uint64(max) {
+		c.Errorf("new(%v): allocation exceeds the limit of %d bytes", tin, max)
+	}
 	tout := c.Universe.PtrTo(tin)
 	t := c.Universe.FuncOf([]xr.Type{c.TypeOfInterface()}, []xr.Type{tout}, false) // no need to build TypeOfReflectType
 	sym.Type = t
@@ -697,41 +855,139 @@ func callParse(argv xr.Value, interpv xr.Value) xr.Value {
 
 // --- print(), println() ---
 
-func callPrint(args ...I) {
-	w := os.Stderr
-	for _, arg := range args {
-		fmt.Fprint(w, arg)
-	}
-}
+// printArg appends to buf an argument of print() or println(),
+// formatted as the gc runtime does
+type printArg func(buf []byte, arg I) []byte
 
-func callPrintln(args ...I) {
-	w := os.Stderr
-	n := len(args)
-	if n > 1 {
-		for _, arg := range args[:n-1] {
-			fmt.Fprint(w, arg, " ")
+func makePrint(g *CompGlobals, printers []printArg, newline bool) func(...I) {
+	return func(args ...I) {
+		var buf []byte
+		for i, arg := range args {
+			if newline && i != 0 {
+				buf = append(buf, ' ')
+			}
+			buf = printers[i](buf, arg)
+		}
+		if newline {
+			buf = append(buf, '\n')
+		}
+		if mux := g.mux; mux != nil {
+			mux.stderr.Write(buf)
+		} else if w := g.PrintStderr; w != nil {
+			w.Write(buf)
+		} else {
+			os.Stderr.Write(buf)
 		}
 	}
-	if n >= 1 {
-		fmt.Fprint(w, args[n-1])
-	}
-	fmt.Fprintln(w)
 }
 
 func compilePrint(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
+	if node.Ellipsis != token.NoPos {
+		c.Errorf("invalid use of ... with builtin %s: %v", sym.Name, node)
+	}
 	args := c.Exprs(node.Args)
-	for _, arg := range args {
+	printers := make([]printArg, len(args))
+	for i, arg := range args {
+		if arg.Untyped() {
+			if arg.IsNil() {
+				c.Errorf("use of untyped nil in argument to builtin %s: %v", sym.Name, node)
+			}
+			arg.ConstTo(arg.DefaultType())
+		}
+		printers[i] = c.printArgFor(sym.Name, arg.Type)
 		arg.To(c, c.TypeOfInterface())
 	}
 
 	t := c.TypeOf(callPrint)
 	sym.Type = t
-	call := callPrint
-	if sym.Name == "println" {
-		call = callPrintln
-	}
+	call := makePrint(c.CompGlobals, printers, sym.Name == "println")
 	fun := exprLit(Lit{Type: t, Value: call}, &sym)
-	return &Call{Fun: fun, Args: args, OutTypes: zeroTypes, Const: false, Ellipsis: node.Ellipsis != token.NoPos}
+	return &Call{Fun: fun, Args: args, OutTypes: zeroTypes, Const: false, Ellipsis: false}
+}
+
+// used only to compute the type of print() and println()
+func callPrint(args ...I) {
+}
+
+// return the function that formats an argument of type t
+// in print() and println()
+func (c *Comp) printArgFor(name string, t xr.Type) printArg {
+	switch t.Kind() {
+	case r.Bool:
+		return func(buf []byte, arg I) []byte {
+			return strconv.AppendBool(buf, r.ValueOf(arg).Bool())
+		}
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		return func(buf []byte, arg I) []byte {
+			return strconv.AppendInt(buf, r.ValueOf(arg).Int(), 10)
+		}
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		return func(buf []byte, arg I) []byte {
+			return strconv.AppendUint(buf, r.ValueOf(arg).Uint(), 10)
+		}
+	case r.Float32, r.Float64:
+		bits := t.Size() * 8
+		return func(buf []byte, arg I) []byte {
+			return appendPrintFloat(buf, r.ValueOf(arg).Float(), int(bits), false)
+		}
+	case r.Complex64, r.Complex128:
+		bits := t.Size() * 4
+		return func(buf []byte, arg I) []byte {
+			z := r.ValueOf(arg).Complex()
+			buf = append(buf, '(')
+			buf = appendPrintFloat(buf, real(z), int(bits), false)
+			buf = appendPrintFloat(buf, imag(z), int(bits), true)
+			return append(buf, "i)"...)
+		}
+	case r.String:
+		return func(buf []byte, arg I) []byte {
+			return append(buf, r.ValueOf(arg).String()...)
+		}
+	case r.Chan, r.Func, r.Map, r.Ptr, r.UnsafePointer:
+		return func(buf []byte, arg I) []byte {
+			return appendPrintHex(buf, uint64(r.ValueOf(arg).Pointer()))
+		}
+	case r.Slice:
+		return func(buf []byte, arg I) []byte {
+			v := r.ValueOf(arg)
+			buf = append(buf, '[')
+			buf = strconv.AppendInt(buf, int64(v.Len()), 10)
+			buf = append(buf, '/')
+			buf = strconv.AppendInt(buf, int64(v.Cap()), 10)
+			buf = append(buf, ']')
+			return appendPrintHex(buf, uint64(v.Pointer()))
+		}
+	case r.Interface:
+		// print the two words of the interface: type and data pointers
+		return func(buf []byte, arg I) []byte {
+			words := (*[2]uintptr)(unsafe.Pointer(&arg))
+			buf = append(buf, '(')
+			buf = appendPrintHex(buf, uint64(words[0]))
+			buf = append(buf, ',')
+			buf = appendPrintHex(buf, uint64(words[1]))
+			return append(buf, ')')
+		}
+	}
+	c.Errorf("illegal types for operand: %s\n\t%v", name, t)
+	return nil
+}
+
+func appendPrintHex(buf []byte, x uint64) []byte {
+	buf = append(buf, "0x"...)
+	return strconv.AppendUint(buf, x, 16)
+}
+
+// format a float as the gc runtime does, i.e. in the shortest representation
+// and always with a sign for the imaginary part of complex numbers
+func appendPrintFloat(buf []byte, v float64, bitSize int, sign bool) []byte {
+	n := len(buf)
+	buf = strconv.AppendFloat(buf, v, 'g', -1, bitSize)
+	if sign && buf[n] != '+' && buf[n] != '-' {
+		buf = append(buf, 0)
+		copy(buf[n+1:], buf[n:])
+		buf[n] = '+'
+	}
+	return buf
 }
 
 // --- real() and imag() ---
@@ -846,6 +1102,7 @@ func callRecover(v xr.Value) xr.Value {
 	// consume the current panic
 	run.Panic = nil
 	run.PanicFun = nil
+	run.panicStack = nil
 	return v
 }
 
@@ -889,8 +1146,10 @@ func (c *Comp) call_builtin(call *Call) I {
 	}
 	var ret I
 	switch fun := call.Fun.Value.(type) {
-	case UntypedLit: // complex(), real(), imag() of untyped constants
+	case UntypedLit: // complex(), real(), imag(), min(), max() of untyped constants
 		ret = fun
+	case builtinFun: // min(), max()
+		ret = fun.Fun
 	case func(float32, float32) complex64: // complex
 		arg0fun := argfuns[0].(func(*Env) float32)
 		arg1fun := argfuns[1].(func(*Env) float32)
@@ -1056,7 +1315,7 @@ func (c *Comp) call_builtin(call *Call) I {
 				fun(args...)
 			}
 		}
-	case func(xr.Value): // close()
+	case func(xr.Value): // clear(), close()
 		argfun := call.MakeArgfunsX1()[0]
 		if name == "close" {
 			ret = func(env *Env) {
@@ -0,0 +1,507 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * builtin_append.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	r "reflect"
+	"unsafe"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// appendBasic returns a function that computes append(args...) without reflect.Append,
+// if the slice has type []T for some predeclared type T as int, float64 or string:
+// each element is computed by a typed closure and appended by the compiler-provided append(),
+// which also grows the slice capacity geometrically.
+// Returns nil for other slice types, or if the second argument of append(slice, arg...)
+// has a different type, as a named slice type or a string.
+func appendBasic(args []*Expr, t0 xr.Type, ellipsis bool) I {
+	rtype := t0.ReflectType()
+	if ellipsis && args[1].Type.ReflectType() != rtype {
+		if rtype == rtypeOfSliceOfByte && args[1].Type.Kind() == r.String {
+			return appendBytesString(args)
+		}
+		return nil
+	}
+	switch rtype.Elem().Kind() {
+	case r.Bool:
+		if rtype == r.TypeOf([]bool(nil)) {
+			return appendBools(args, ellipsis)
+		}
+	case r.Int:
+		if rtype == r.TypeOf([]int(nil)) {
+			return appendInts(args, ellipsis)
+		}
+	case r.Int8:
+		if rtype == r.TypeOf([]int8(nil)) {
+			return appendInt8s(args, ellipsis)
+		}
+	case r.Int16:
+		if rtype == r.TypeOf([]int16(nil)) {
+			return appendInt16s(args, ellipsis)
+		}
+	case r.Int32:
+		if rtype == r.TypeOf([]int32(nil)) {
+			return appendInt32s(args, ellipsis)
+		}
+	case r.Int64:
+		if rtype == r.TypeOf([]int64(nil)) {
+			return appendInt64s(args, ellipsis)
+		}
+	case r.Uint:
+		if rtype == r.TypeOf([]uint(nil)) {
+			return appendUints(args, ellipsis)
+		}
+	case r.Uint8:
+		if rtype == r.TypeOf([]uint8(nil)) {
+			return appendUint8s(args, ellipsis)
+		}
+	case r.Uint16:
+		if rtype == r.TypeOf([]uint16(nil)) {
+			return appendUint16s(args, ellipsis)
+		}
+	case r.Uint32:
+		if rtype == r.TypeOf([]uint32(nil)) {
+			return appendUint32s(args, ellipsis)
+		}
+	case r.Uint64:
+		if rtype == r.TypeOf([]uint64(nil)) {
+			return appendUint64s(args, ellipsis)
+		}
+	case r.Uintptr:
+		if rtype == r.TypeOf([]uintptr(nil)) {
+			return appendUintptrs(args, ellipsis)
+		}
+	case r.Float32:
+		if rtype == r.TypeOf([]float32(nil)) {
+			return appendFloat32s(args, ellipsis)
+		}
+	case r.Float64:
+		if rtype == r.TypeOf([]float64(nil)) {
+			return appendFloat64s(args, ellipsis)
+		}
+	case r.Complex64:
+		if rtype == r.TypeOf([]complex64(nil)) {
+			return appendComplex64s(args, ellipsis)
+		}
+	case r.Complex128:
+		if rtype == r.TypeOf([]complex128(nil)) {
+			return appendComplex128s(args, ellipsis)
+		}
+	case r.String:
+		if rtype == r.TypeOf([]string(nil)) {
+			return appendStrings(args, ellipsis)
+		}
+	}
+	return nil
+}
+
+// sliceAddr returns the address of the slice header contained in v.
+// Avoids the allocation performed by v.Interface() if v is addressable, as variables are
+func sliceAddr(v xr.Value) unsafe.Pointer {
+	rv := v.ReflectValue()
+	if !rv.CanAddr() {
+		addr := r.New(rv.Type())
+		addr.Elem().Set(rv)
+		rv = addr.Elem()
+	}
+	return unsafe.Pointer(rv.UnsafeAddr())
+}
+
+// append([]byte, string...)
+func appendBytesString(args []*Expr) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	fun1 := args[1].WithFun().(func(*Env) string)
+	return func(env *Env) xr.Value {
+		s := *(*[]byte)(sliceAddr(fun0(env)))
+		return xr.ValueOf(append(s, fun1(env)...))
+	}
+}
+
+func appendBools(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]bool)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]bool)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) bool, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) bool)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]bool)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendInts(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]int)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]int)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) int, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) int)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]int)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendInt8s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]int8)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]int8)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) int8, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) int8)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]int8)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendInt16s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]int16)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]int16)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) int16, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) int16)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]int16)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendInt32s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]int32)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]int32)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) int32, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) int32)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]int32)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendInt64s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]int64)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]int64)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) int64, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) int64)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]int64)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendUints(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]uint)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]uint)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) uint, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) uint)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]uint)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendUint8s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]uint8)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]uint8)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) uint8, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) uint8)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]uint8)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendUint16s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]uint16)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]uint16)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) uint16, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) uint16)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]uint16)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendUint32s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]uint32)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]uint32)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) uint32, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) uint32)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]uint32)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendUint64s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]uint64)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]uint64)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) uint64, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) uint64)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]uint64)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendUintptrs(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]uintptr)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]uintptr)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) uintptr, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) uintptr)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]uintptr)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendFloat32s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]float32)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]float32)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) float32, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) float32)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]float32)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendFloat64s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]float64)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]float64)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) float64, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) float64)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]float64)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendComplex64s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]complex64)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]complex64)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) complex64, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) complex64)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]complex64)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendComplex128s(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]complex128)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]complex128)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) complex128, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) complex128)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]complex128)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
+
+func appendStrings(args []*Expr, ellipsis bool) func(*Env) xr.Value {
+	fun0 := args[0].AsX1()
+	if ellipsis {
+		fun1 := args[1].AsX1()
+		return func(env *Env) xr.Value {
+			s := *(*[]string)(sliceAddr(fun0(env)))
+			return xr.ValueOf(append(s, *(*[]string)(sliceAddr(fun1(env)))...))
+		}
+	}
+	funs := make([]func(*Env) string, len(args)-1)
+	for i, arg := range args[1:] {
+		funs[i] = arg.WithFun().(func(*Env) string)
+	}
+	return func(env *Env) xr.Value {
+		s := *(*[]string)(sliceAddr(fun0(env)))
+		for _, fun := range funs {
+			s = append(s, fun(env))
+		}
+		return xr.ValueOf(s)
+	}
+}
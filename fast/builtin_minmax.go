@@ -0,0 +1,344 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * builtin_minmax.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math"
+
+	"github.com/cosmos72/gomacro/base/untyped"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// builtinFun is a call to a builtin function that was already compiled
+// by Builtin.Compile, as min() and max(): call_builtin returns Fun unchanged
+type builtinFun struct {
+	Fun I
+}
+
+func compileMin(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
+	return c.compileMinMax(sym, node, token.LSS)
+}
+
+func compileMax(c *Comp, sym Symbol, node *ast.CallExpr) *Call {
+	return c.compileMinMax(sym, node, token.GTR)
+}
+
+// compileMinMax compiles min() if op == token.LSS, and max() if op == token.GTR
+func (c *Comp) compileMinMax(sym Symbol, node *ast.CallExpr, op token.Token) *Call {
+	n := len(node.Args)
+	args := make([]*Expr, n)
+	var t xr.Type // type of typed arguments. nil if all arguments are untyped constants
+	for i, argnode := range node.Args {
+		arg := c.expr1(argnode, nil)
+		args[i] = arg
+		if arg.Untyped() {
+			continue
+		} else if t == nil {
+			t = arg.Type
+		} else if !arg.Type.IdenticalTo(t) {
+			c.Errorf("invalid argument: mismatched types <%v> and <%v> in builtin %s(): %v", t, arg.Type, sym.Name, node)
+		}
+	}
+	if t == nil {
+		return c.compileMinMaxUntyped(sym, node, op, args)
+	}
+	switch t.Kind() {
+	case xr.Int, xr.Int8, xr.Int16, xr.Int32, xr.Int64,
+		xr.Uint, xr.Uint8, xr.Uint16, xr.Uint32, xr.Uint64, xr.Uintptr,
+		xr.Float32, xr.Float64, xr.String:
+	default:
+		return c.badBuiltinCallArgType(sym.Name, node, t, "integer, float or string")
+	}
+	isconst := true
+	argtypes := make([]xr.Type, n)
+	for i, arg := range args {
+		if arg.Untyped() {
+			arg.ConstTo(t)
+		}
+		isconst = isconst && arg.Const()
+		argtypes[i] = t
+	}
+	tfun := c.Universe.FuncOf(argtypes, []xr.Type{t}, false)
+	sym.Type = tfun
+	fun := exprLit(Lit{Type: tfun, Value: builtinFun{minmax(args, t, op == token.LSS)}}, &sym)
+	// min() and max() of constants are constant too: compute them at compile time
+	return &Call{Fun: fun, Args: args, OutTypes: []xr.Type{t}, Const: isconst}
+}
+
+// compileMinMaxUntyped compiles min() and max() of untyped constants
+func (c *Comp) compileMinMaxUntyped(sym Symbol, node *ast.CallExpr, op token.Token, args []*Expr) *Call {
+	var ret UntypedLit
+	for i, arg := range args {
+		lit := arg.Value.(UntypedLit)
+		switch lit.Kind {
+		case untyped.Int, untyped.Rune, untyped.Float, untyped.String:
+		default:
+			c.Errorf("invalid argument: %v (untyped %v constant) cannot be ordered in builtin %s()", node.Args[i], lit.Kind, sym.Name)
+		}
+		if i == 0 {
+			ret = lit
+			continue
+		} else if (lit.Kind == untyped.String) != (ret.Kind == untyped.String) {
+			c.Errorf("invalid argument: mismatched types untyped %v and untyped %v in builtin %s(): %v", ret.Kind, lit.Kind, sym.Name, node)
+		}
+		// result has the "largest" kind among int, rune and float
+		kind := ret.Kind
+		if lit.Kind > kind {
+			kind = lit.Kind
+		}
+		if constant.Compare(lit.Val, op, ret.Val) {
+			ret = lit
+		}
+		ret.Kind = kind
+	}
+	if ret.Kind == untyped.Float {
+		ret.Val = constant.ToFloat(ret.Val)
+	}
+	val := untyped.MakeLit(ret.Kind, ret.Val, &c.Universe.BasicTypes)
+	touts := []xr.Type{c.TypeOfUntypedLit()}
+	tfun := c.Universe.FuncOf(nil, touts, false)
+	sym.Type = tfun
+	fun := exprLit(Lit{Type: tfun, Value: val}, &sym)
+	// min() and max() of untyped constants are both untyped and constant: compute them at compile time
+	return &Call{Fun: fun, Args: nil, OutTypes: touts, Const: true}
+}
+
+// minmax returns a function that computes min(args...) if ismin, otherwise max(args...)
+func minmax(args []*Expr, t xr.Type, ismin bool) I {
+	n := len(args)
+	var ret I
+	switch t.Kind() {
+	case xr.Int:
+		funs := make([]func(*Env) int, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) int)
+		}
+		ret = func(env *Env) int {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Int8:
+		funs := make([]func(*Env) int8, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) int8)
+		}
+		ret = func(env *Env) int8 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Int16:
+		funs := make([]func(*Env) int16, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) int16)
+		}
+		ret = func(env *Env) int16 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Int32:
+		funs := make([]func(*Env) int32, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) int32)
+		}
+		ret = func(env *Env) int32 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Int64:
+		funs := make([]func(*Env) int64, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) int64)
+		}
+		ret = func(env *Env) int64 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Uint:
+		funs := make([]func(*Env) uint, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) uint)
+		}
+		ret = func(env *Env) uint {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Uint8:
+		funs := make([]func(*Env) uint8, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) uint8)
+		}
+		ret = func(env *Env) uint8 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Uint16:
+		funs := make([]func(*Env) uint16, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) uint16)
+		}
+		ret = func(env *Env) uint16 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Uint32:
+		funs := make([]func(*Env) uint32, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) uint32)
+		}
+		ret = func(env *Env) uint32 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Uint64:
+		funs := make([]func(*Env) uint64, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) uint64)
+		}
+		ret = func(env *Env) uint64 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Uintptr:
+		funs := make([]func(*Env) uintptr, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) uintptr)
+		}
+		ret = func(env *Env) uintptr {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	case xr.Float32:
+		funs := make([]func(*Env) float32, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) float32)
+		}
+		ret = func(env *Env) float32 {
+			ret := float64(funs[0](env))
+			for _, fun := range funs[1:] {
+				ret = minmaxFloat(ret, float64(fun(env)), ismin)
+			}
+			return float32(ret)
+		}
+	case xr.Float64:
+		funs := make([]func(*Env) float64, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) float64)
+		}
+		ret = func(env *Env) float64 {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				ret = minmaxFloat(ret, fun(env), ismin)
+			}
+			return ret
+		}
+	case xr.String:
+		funs := make([]func(*Env) string, n)
+		for i, arg := range args {
+			funs[i] = arg.WithFun().(func(*Env) string)
+		}
+		ret = func(env *Env) string {
+			ret := funs[0](env)
+			for _, fun := range funs[1:] {
+				if x := fun(env); ismin && x < ret || !ismin && x > ret {
+					ret = x
+				}
+			}
+			return ret
+		}
+	}
+	return ret
+}
+
+// minmaxFloat returns min(x, y) if ismin, otherwise max(x, y)
+// following Go spec: if any argument is a NaN, the result is a NaN,
+// and negative zero is smaller than positive zero
+func minmaxFloat(x float64, y float64, ismin bool) float64 {
+	switch {
+	case x != x:
+		return x
+	case y != y:
+		return y
+	case x == y:
+		// x and y may be zeroes with different signs
+		if ismin == math.Signbit(x) {
+			return x
+		}
+		return y
+	case ismin == (x < y):
+		return x
+	default:
+		return y
+	}
+}
@@ -71,6 +71,13 @@ func (c *Comp) CallExpr(node *ast.CallExpr) *Expr {
 		}
 	}
 	call := c.prepareCall(node, fun)
+	if e := c.pureCall(node, call); e != nil {
+		// constant propagation of functions without side effects
+		return e
+	} else if e := c.devirtualizeCall(node, call); e != nil {
+		// method call on an interface variable with known concrete type
+		return e
+	}
 	return c.call_any(call)
 }
 
@@ -79,6 +86,10 @@ func (c *Comp) prepareCall(node *ast.CallExpr, fun *Expr) *Call {
 	if fun == nil {
 		fun = c.expr1(node.Fun, nil)
 	}
+	if sym := fun.Sym; sym != nil && isHotswapFunc(sym, c.Depth) {
+		// calls read the function directly from its slot, no need for the trampoline
+		fun = sym.expr(c.Depth, c.CompGlobals)
+	}
 	t := fun.Type
 	var builtin bool
 	var lastarg *Expr
@@ -93,13 +104,16 @@ func (c *Comp) prepareCall(node *ast.CallExpr, fun *Expr) *Call {
 	var args []*Expr
 	if len(node.Args) == 1 {
 		// support foo(bar()) where bar() returns multiple values
-		arg := c.Expr(node.Args[0], nil)
+		arg := c.Expr(node.Args[0], c.lambdaArgType(node, t, 0))
 		if arg.NumOut() == 0 {
 			c.Errorf("function argument returns zero values: %v ", node.Args[0])
 		}
 		args = []*Expr{arg}
 	} else {
-		args = c.Exprs(node.Args)
+		args = make([]*Expr, len(node.Args))
+		for i, arg := range node.Args {
+			args[i] = c.Jit.Fun(c.expr1(arg, c.lambdaArgType(node, t, i)))
+		}
 	}
 	if lastarg != nil {
 		args = append(args, lastarg)
@@ -118,6 +132,7 @@ func (c *Comp) prepareCall(node *ast.CallExpr, fun *Expr) *Call {
 		return nil
 	}
 	ellipsis := node.Ellipsis != token.NoPos
+	c.checkPrintfArgs(node, args, ellipsis) // before checkCallArgs() converts args to interface{}
 	c.checkCallArgs(node, t, args, ellipsis)
 
 	outn := t.NumOut()
@@ -221,7 +236,7 @@ func (c *Comp) checkCallArgs(node *ast.CallExpr, t xr.Type, args []*Expr, ellips
 			// support foo(bar()) where bar() returns multiple values
 			targ := args[0].Out(i)
 			if targ == nil || !targ.AssignableTo(ti) {
-				c.Errorf("cannot use <%v> as <%v> in argument to %v", targ, ti, node.Fun)
+				c.Errorf("cannot use <%v> as <%v> in argument to %v%s", targ, ti, node.Fun, interfaceMissingMethod(targ, ti))
 			} else if conv := c.Converter(targ, ti); conv != nil {
 				convs[i] = conv
 				args[0].Types[i] = ti
@@ -234,7 +249,7 @@ func (c *Comp) checkCallArgs(node *ast.CallExpr, t xr.Type, args []*Expr, ellips
 		if arg.Const() {
 			arg.ConstTo(ti)
 		} else if arg.Type == nil || !arg.Type.AssignableTo(ti) {
-			c.Errorf("cannot use <%v> as <%v> in argument to %v", arg.Type, ti, node.Fun)
+			c.Errorf("cannot use <%v> as <%v> in argument to %v%s", arg.Type, ti, node.Fun, interfaceMissingMethod(arg.Type, ti))
 		} else {
 			arg.To(c, ti)
 		}
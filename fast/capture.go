@@ -0,0 +1,236 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * capture.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+
+	"github.com/cosmos72/gomacro/base"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// closureCapture describes the variables that a closure captures by value:
+// they are copied when the closure is created into a small Env,
+// accessed by the closure body with a single indirection instead of walking Env.Outer chains
+type closureCapture struct {
+	comp     *Comp                  // declares the captured variables. comp.Outer is the Comp declaring the closure
+	get      []func(*Env) xr.Value  // read the captured variables from the Env declaring the closure
+	set      []func(*Env, xr.Value) // store them into the Env of comp
+	nbind    int
+	nintbind int
+}
+
+// noteReassigned stores into cf.Func the names of the variables that may be modified
+// after their declaration, either by the function being compiled or by the function enclosing it.
+// Must be called after setting cf.Func and before compiling the function body
+func (cf *Comp) noteReassigned(recv *ast.FieldList, functype *ast.FuncType, body *ast.BlockStmt) {
+	for c := cf.Outer; c != nil; c = c.Outer {
+		if c.Func != nil {
+			// the analysis of the outermost function also covers the functions declared inside it
+			cf.Func.reassigned = c.Func.reassigned
+			return
+		}
+	}
+	if body != nil {
+		cf.Func.reassigned = reassignedVars(recv, functype, body)
+	}
+}
+
+// reassignedVars returns the names of the variables that may be modified after their declaration
+// by the function with given receiver, type and body, including the closures declared inside it:
+// variables assigned with = op= ++ --, range and loop variables, variables whose address is taken,
+// variables declared more than once (a redeclaration in := is an assignment) and named results.
+// The analysis is by name, ignoring scopes: it is conservative
+func reassignedVars(recv *ast.FieldList, functype *ast.FuncType, body *ast.BlockStmt) map[string]bool {
+	reassigned := make(map[string]bool)
+	declared := make(map[string]bool)
+	declare := func(name string) {
+		if declared[name] {
+			reassigned[name] = true
+		}
+		declared[name] = true
+	}
+	assign := func(node ast.Expr) {
+		if ident, ok := unparen(node).(*ast.Ident); ok {
+			reassigned[ident.Name] = true
+		}
+	}
+	fields := func(list *ast.FieldList, f func(string)) {
+		if list == nil {
+			return
+		}
+		for _, field := range list.List {
+			for _, ident := range field.Names {
+				f(ident.Name)
+			}
+		}
+	}
+	fields(recv, declare)
+	fields(functype.Params, declare)
+	fields(functype.Results, func(name string) {
+		// named results are assigned by return statements
+		reassigned[name] = true
+	})
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range node.Lhs {
+				if node.Tok != token.DEFINE {
+					assign(lhs)
+				} else if ident, ok := lhs.(*ast.Ident); ok {
+					declare(ident.Name)
+				}
+			}
+		case *ast.IncDecStmt:
+			assign(node.X)
+		case *ast.RangeStmt:
+			assign(node.Key)
+			assign(node.Value)
+		case *ast.ForStmt:
+			if init, ok := node.Init.(*ast.AssignStmt); ok {
+				for _, lhs := range init.Lhs {
+					assign(lhs)
+				}
+			}
+		case *ast.UnaryExpr:
+			if node.Op == token.AND {
+				assign(node.X)
+			}
+		case *ast.ValueSpec:
+			for _, ident := range node.Names {
+				declare(ident.Name)
+			}
+		case *ast.FuncType:
+			fields(node.Params, declare)
+			fields(node.Results, func(name string) {
+				reassigned[name] = true
+			})
+		}
+		return true
+	})
+	return reassigned
+}
+
+// captureByValue returns the variables that a closure with given body, declared in c,
+// can capture by value: local variables never modified after their declaration,
+// declared in an outer Env of c, and whose type has no methods with pointer receiver.
+// Capturing them by value has the same semantics as capturing them by reference.
+// Returns nil if there are no such variables
+func (c *Comp) captureByValue(body *ast.BlockStmt) *closureCapture {
+	if body == nil || c.Globals.Options&base.OptDebugger != 0 {
+		// the debugger can modify local variables
+		return nil
+	}
+	info := c.funcInfo()
+	if info == nil || info.reassigned == nil {
+		return nil
+	}
+	var capture *closureCapture
+	for _, name := range usedNames(body) {
+		if info.reassigned[name] {
+			continue
+		}
+		sym, outer := c.tryResolve(name)
+		if sym == nil || sym.Upn == 0 || sym.Desc.Index() == NoIndex || outer.funcInfo() == nil || !capturableType(sym.Type) {
+			// variables declared in the Env of c are already one indirection away
+			continue
+		}
+		switch sym.Desc.Class() {
+		case VarBind, IntBind:
+		default:
+			continue
+		}
+		// the closure body will resolve name to the captured copy
+		outer.noteUsed(name)
+		if capture == nil {
+			capture = &closureCapture{comp: NewComp(c, nil)}
+		}
+		bind := capture.comp.NewBind(name, VarBind, sym.Type)
+		capture.get = append(capture.get, c.Symbol(sym).AsX1())
+		capture.set = append(capture.set, capture.comp.DeclBindRuntimeValue(bind))
+	}
+	if capture != nil {
+		capture.nbind = capture.comp.BindNum
+		capture.nintbind = capture.comp.IntBindNum
+	}
+	return capture
+}
+
+// wrap the function creation f, so that it copies the captured variables
+func (capture *closureCapture) wrap(f func(*Env) xr.Value) func(*Env) xr.Value {
+	get, set := capture.get, capture.set
+	nbind, nintbind := capture.nbind, capture.nintbind
+	return func(env *Env) xr.Value {
+		cenv := NewEnv(env, nbind, nintbind)
+		env.Run.CurrEnv = env // NewEnv changed it
+		for i, getter := range get {
+			set[i](cenv, getter(env))
+		}
+		return f(cenv)
+	}
+}
+
+// return the FuncInfo of the innermost function containing c, or nil if c is not inside a function
+func (c *Comp) funcInfo() *FuncInfo {
+	for ; c != nil; c = c.Outer {
+		if c.Func != nil {
+			return c.Func
+		}
+	}
+	return nil
+}
+
+// return true if variables of type t cannot be modified implicitly, by calling a method with pointer receiver
+// or by assigning their fields or elements.
+// Only unnamed and predeclared types, pointers and interfaces qualify
+func capturableType(t xr.Type) bool {
+	switch t.Kind() {
+	case xr.Ptr, xr.Interface:
+		return true
+	case xr.Array, xr.Struct, xr.UnsafePointer:
+		return false
+	default:
+		return len(t.PkgPath()) == 0
+	}
+}
+
+// return the sorted names of the identifiers used in node, excluding field and method names after a dot
+func usedNames(node ast.Node) []string {
+	seen := make(map[string]bool)
+	var visit func(ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Ident:
+			seen[node.Name] = true
+		case *ast.SelectorExpr:
+			ast.Inspect(node.X, visit)
+			return false
+		}
+		return true
+	}
+	ast.Inspect(node, visit)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		if name != "_" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -25,6 +25,7 @@ import (
 	"go/ast"
 	r "reflect"
 
+	"github.com/cosmos72/gomacro/base"
 	"github.com/cosmos72/gomacro/base/reflect"
 	xr "github.com/cosmos72/gomacro/xreflect"
 )
@@ -38,6 +39,9 @@ func (c *Comp) Recv(node *ast.UnaryExpr, xe *Expr) *Expr {
 	if t.ChanDir()&r.RecvDir == 0 {
 		return c.badUnaryExpr("cannot receive from send-only channel", node, xe)
 	}
+	if c.Options&base.OptInterruptibleChan != 0 {
+		return c.recvInterruptible(xe)
+	}
 
 	var fun func(env *Env) (xr.Value, []xr.Value)
 	switch x := xe.Fun.(type) {
@@ -79,6 +83,9 @@ func (c *Comp) Recv1(node *ast.UnaryExpr, xe *Expr) *Expr {
 	if t.ChanDir()&r.RecvDir == 0 {
 		return c.badUnaryExpr("cannot receive from send-only channel", node, xe)
 	}
+	if c.Options&base.OptInterruptibleChan != 0 {
+		return c.recv1Interruptible(xe)
+	}
 
 	telem := t.Elem()
 	var fun I
@@ -517,11 +524,15 @@ func (c *Comp) Send(node *ast.SendStmt) {
 	if expr.Const() {
 		expr.ConstTo(telem)
 	} else if expr.Type == nil || !expr.Type.AssignableTo(telem) {
-		c.Errorf("cannot use %v <%v> as type %v in send", node.Value, expr.Type, telem)
+		c.Errorf("cannot use %v <%v> as type %v in send%s", node.Value, expr.Type, telem, interfaceMissingMethod(expr.Type, telem))
 		return
 	} else {
 		expr.To(c, telem)
 	}
+	if c.Options&base.OptInterruptibleChan != 0 {
+		c.sendInterruptible(channel, expr)
+		return
+	}
 
 	channelfun := channel.AsX1()
 	sendonly := t.ChanDir() == r.SendDir
@@ -0,0 +1,239 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * channel_interrupt.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	r "reflect"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// channel send, receive, select and range over channels compiled while base.OptInterruptibleChan is set:
+// they wait with reflect.Select() both on the channels and on Run.interruptCh,
+// so that Interp.Interrupt() can interrupt them even if the channel is never ready.
+// Useful to run untrusted code in a sandbox: blocking forever on a channel
+// would otherwise hang the goroutine executing it.
+
+// recvInterruptible compiles <-channel (returns two values: the received value and an 'ok' flag)
+func (c *Comp) recvInterruptible(xe *Expr) *Expr {
+	t := xe.Type
+	channelfun := xe.AsX1()
+	fun := func(env *Env) (xr.Value, []xr.Value) {
+		retv, ok := env.Run.chanRecv(channelfun(env))
+		okv := False
+		if ok {
+			okv = True
+		}
+		return retv, []xr.Value{retv, okv}
+	}
+	return exprXV([]xr.Type{t.Elem(), c.TypeOfBool()}, fun)
+}
+
+// recv1Interruptible compiles <-channel (returns a single value: the received value)
+func (c *Comp) recv1Interruptible(xe *Expr) *Expr {
+	telem := xe.Type.Elem()
+	channelfun := xe.AsX1()
+	var fun I
+	switch telem.Kind() {
+	case xr.Bool:
+		fun = func(env *Env) bool {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return v.Bool()
+		}
+	case xr.Int:
+		fun = func(env *Env) int {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return int(v.Int())
+		}
+	case xr.Int8:
+		fun = func(env *Env) int8 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return int8(v.Int())
+		}
+	case xr.Int16:
+		fun = func(env *Env) int16 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return int16(v.Int())
+		}
+	case xr.Int32:
+		fun = func(env *Env) int32 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return int32(v.Int())
+		}
+	case xr.Int64:
+		fun = func(env *Env) int64 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return v.Int()
+		}
+	case xr.Uint:
+		fun = func(env *Env) uint {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return uint(v.Uint())
+		}
+	case xr.Uint8:
+		fun = func(env *Env) uint8 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return uint8(v.Uint())
+		}
+	case xr.Uint16:
+		fun = func(env *Env) uint16 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return uint16(v.Uint())
+		}
+	case xr.Uint32:
+		fun = func(env *Env) uint32 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return uint32(v.Uint())
+		}
+	case xr.Uint64:
+		fun = func(env *Env) uint64 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return v.Uint()
+		}
+	case xr.Uintptr:
+		fun = func(env *Env) uintptr {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return uintptr(v.Uint())
+		}
+	case xr.Float32:
+		fun = func(env *Env) float32 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return float32(v.Float())
+		}
+	case xr.Float64:
+		fun = func(env *Env) float64 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return v.Float()
+		}
+	case xr.Complex64:
+		fun = func(env *Env) complex64 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return complex64(v.Complex())
+		}
+	case xr.Complex128:
+		fun = func(env *Env) complex128 {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return v.Complex()
+		}
+	case xr.String:
+		fun = func(env *Env) string {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return v.String()
+		}
+	default:
+		fun = func(env *Env) xr.Value {
+			v, _ := env.Run.chanRecv(channelfun(env))
+			return v
+		}
+	}
+	return exprFun(telem, fun)
+}
+
+// sendInterruptible compiles channel <- expr
+func (c *Comp) sendInterruptible(channel *Expr, expr *Expr) {
+	channelfun := channel.AsX1()
+	exprfun := expr.AsX1()
+	c.append(func(env *Env) (Stmt, *Env) {
+		env.Run.chanSend(channelfun(env), exprfun(env))
+		env.IP++
+		return env.Code[env.IP], env
+	})
+}
+
+// chanRecv receives a value from channel, unless interrupted
+func (run *Run) chanRecv(channel xr.Value) (xr.Value, bool) {
+	if run.interruptCh == nil {
+		return channel.Recv()
+	}
+	cases := []r.SelectCase{
+		{Dir: r.SelectRecv, Chan: channel.ReflectValue()},
+		{Dir: r.SelectRecv, Chan: r.ValueOf(run.interruptCh)},
+	}
+	for {
+		chosen, recv, ok := r.Select(cases)
+		if chosen == 0 {
+			return xr.MakeValue(recv), ok
+		}
+		// panics on SigInterrupt, returns on SigDebug or spurious wakeup
+		run.applyAsyncSignal(run.Signals.Async)
+	}
+}
+
+// chanSend sends a value to channel, unless interrupted
+func (run *Run) chanSend(channel xr.Value, value xr.Value) {
+	if run.interruptCh == nil {
+		channel.Send(value)
+		return
+	}
+	cases := []r.SelectCase{
+		{Dir: r.SelectSend, Chan: channel.ReflectValue(), Send: value.ReflectValue()},
+		{Dir: r.SelectRecv, Chan: r.ValueOf(run.interruptCh)},
+	}
+	for {
+		chosen, _, _ := r.Select(cases)
+		if chosen == 0 {
+			return
+		}
+		run.applyAsyncSignal(run.Signals.Async)
+	}
+}
+
+// chanSelect executes a select statement, unless interrupted
+func (run *Run) chanSelect(cases []xr.SelectCase) (int, xr.Value, bool) {
+	n := len(cases)
+	if run.interruptCh == nil || hasSelectDefault(cases) {
+		// a select with a default case never blocks
+		return xr.Select(cases)
+	}
+	cases = append(cases, r.SelectCase{Dir: r.SelectRecv, Chan: r.ValueOf(run.interruptCh)})
+	for {
+		chosen, recv, ok := xr.Select(cases)
+		if chosen < n {
+			return chosen, recv, ok
+		}
+		run.applyAsyncSignal(run.Signals.Async)
+	}
+}
+
+func hasSelectDefault(cases []xr.SelectCase) bool {
+	for i := range cases {
+		if cases[i].Dir == r.SelectDefault {
+			return true
+		}
+	}
+	return false
+}
+
+// notify interruptible channel operations that Run.interrupt() was invoked
+func (run *Run) notifyInterrupt() {
+	if run.interruptCh != nil {
+		select {
+		case run.interruptCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// discard pending notifications of Run.interrupt()
+func (run *Run) clearInterrupt() {
+	if run.interruptCh != nil {
+		select {
+		case <-run.interruptCh:
+		default:
+		}
+	}
+}
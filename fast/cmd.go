@@ -18,14 +18,24 @@ package fast
 
 import (
 	"errors"
+	"fmt"
+	"go/token"
 	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/cosmos72/gomacro/base/paths"
 
 	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/base/genimport"
 	bstrings "github.com/cosmos72/gomacro/base/strings"
+	"github.com/cosmos72/gomacro/base/untyped"
 )
 
 // ====================== Cmd ==============================
@@ -67,13 +77,20 @@ import (
 //   pretty-print interpreter-generated objects (g.Fprintf)
 //   and to honour configured redirections (g.Stdout)
 //
-// To register a new special command, use Commands.Add()
+// Cmd.Complete is optional, and implements code completion of the command arguments.
+//   It receives the current Interp object and the argument string typed by the user
+//   up to the cursor, and must return the candidates for the last, possibly empty,
+//   space-separated word of the argument string. Candidates not starting
+//   with such word are discarded, so Cmd.Complete can return all the valid words.
+//
+// To register a new special command, use RegisterCommand() or Commands.Add()
 // To unregister an existing special command, use Commands.Del()
 // To list existing special commands, use Commands.List()
 type Cmd struct {
-	Name string
-	Func func(interp *Interp, arg string, opt base.CmdOpt) (string, base.CmdOpt)
-	Help string
+	Name     string
+	Func     func(interp *Interp, arg string, opt base.CmdOpt) (string, base.CmdOpt)
+	Help     string
+	Complete func(interp *Interp, arg string) []string
 }
 
 // if cmd.Name starts with prefix return 0;
@@ -149,6 +166,14 @@ func prefixSearch(vec []Cmd, prefix string) (int, error) {
 	if lo+1 == hi {
 		return lo, nil
 	}
+	// a Cmd whose name is a prefix of all the other matches wins:
+	// :l and :load select :load even if :loadurl exists
+	first := vec[lo].Name
+	for i := lo + 1; i < hi && strings.HasPrefix(vec[i].Name, first); i++ {
+		if i+1 == hi {
+			return lo, nil
+		}
+	}
 	names := make([]string, hi-lo)
 	for i := lo; i < hi; i++ {
 		names[i-lo] = vec[i].Name
@@ -268,21 +293,116 @@ func (cmds Cmds) ShowHelp(g *base.Globals) {
 
 var Commands Cmds
 
+// RegisterCommand registers the special command NAME, invoked as :NAME ARGS in the REPL,
+// replacing any existing command with the same name.
+// Useful to build domain-specific consoles on top of gomacro: it can be called
+// by programs that embed the interpreter, and by interpreted code as prelude scripts.
+//
+// handler is called with the current Interp and the argument string typed by the user.
+// help is displayed by :help, and should follow the layout of existing commands,
+// i.e. the command name and arguments padded to 18 columns, followed by a description.
+// complete is optional, see Cmd.Complete for its meaning.
+//
+// Returns an error if name is not a valid command name: see Cmd.Name for the constraints
+func RegisterCommand(name string, help string, handler func(interp *Interp, arg string),
+	complete func(interp *Interp, arg string) []string) error {
+
+	if !token.IsIdentifier(name) || name[0] >= utf8.RuneSelf {
+		return fmt.Errorf("RegisterCommand: invalid command name %q, expecting an ASCII identifier", name)
+	} else if handler == nil {
+		return fmt.Errorf("RegisterCommand: command %q has nil handler", name)
+	}
+	if len(help) == 0 {
+		help = name
+	}
+	Commands.Add(Cmd{
+		Name: name,
+		Func: func(interp *Interp, arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+			handler(interp, arg)
+			return "", opt
+		},
+		Help:     help,
+		Complete: complete,
+	})
+	return nil
+}
+
 func init() {
 	Commands.m = map[byte][]Cmd{
-		'c': []Cmd{{"copyright", (*Interp).cmdCopyright, `copyright         show copyright and license`}},
-		'd': []Cmd{{"debug", (*Interp).cmdDebug, `debug EXPR        debug expression or statement interactively`}},
+		'c': []Cmd{{"copyright", (*Interp).cmdCopyright, `copyright         show copyright and license`, nil}},
+		'd': []Cmd{{"debug", (*Interp).cmdDebug, `debug EXPR        debug expression or statement interactively`, nil},
+			{"disasm", (*Interp).cmdDisasm, `disasm FUNC       show the statements generated by compiling function FUNC`, nil}},
 		'e': []Cmd{{"env", (*Interp).cmdEnv, `env [NAME]        show available functions, variables and constants
-                   in current package, or from imported package NAME`}},
-		'h': []Cmd{{"help", (*Interp).cmdHelp, `help              show this help`}},
-		'i': []Cmd{{"inspect", (*Interp).cmdInspect, `inspect EXPR|TYPE inspect expression or type interactively`}},
-		'o': []Cmd{{"options", (*Interp).cmdOptions, `options [OPTS]    show or toggle interpreter options`}},
-		'p': []Cmd{{"package", (*Interp).cmdPackage, `package "PKGPATH" switch to package PKGPATH, importing it if possible`}},
-		'q': []Cmd{{"quit", (*Interp).cmdQuit, `quit              quit the interpreter`}},
+                   in current package, or from imported package NAME`, nil}},
+		'g': []Cmd{{"gc", (*Interp).cmdGc, `gc [PERCENT|off]  release unused memory, or set the garbage collection target percentage`, nil}},
+		'h': []Cmd{{"help", (*Interp).cmdHelp, `help              show this help`, nil}},
+		'i': []Cmd{{"import", (*Interp).cmdImport, `import [--force] PKGPATH...
+                   import packages. --force first discards their plugins and generated files,
+                   and rebuilds them from scratch`, nil},
+			{"inspect", (*Interp).cmdInspect, `inspect EXPR|TYPE inspect expression or type interactively`, nil}},
+		'l': []Cmd{{"load", (*Interp).cmdLoad, `load FILE|DIR     evaluate FILE, stopping at the first error.
+                   with %cset allerrors on, report all compile errors before executing anything.
+                   DIR loads the files matching %cset goos, goarch and buildtags`, nil},
+			{"loadurl", (*Interp).cmdLoadURL, `loadurl URL       download the Go file at URL, then evaluate it as %cload does.
+                   the file is cached: if downloading fails later, the cached copy is used`, nil}},
+		'o': []Cmd{{"options", (*Interp).cmdOptions, `options [OPTS]    show or toggle interpreter options`, nil}},
+		'p': []Cmd{{"package", (*Interp).cmdPackage, `package "PKGPATH" switch to package PKGPATH, importing it if possible`, nil},
+			{"prelude", (*Interp).cmdPrelude, `prelude [NAME]    load prelude NAME in current package, or list available preludes`, (*Interp).cmdPreludeComplete}},
+		'q': []Cmd{{"quit", (*Interp).cmdQuit, `quit              quit the interpreter`, nil}},
+		'r': []Cmd{{"restore", (*Interp).cmdRestore, `restore FILE      restore the session saved in FILE by %csave`, nil}},
+		's': []Cmd{{"save", (*Interp).cmdSave, `save FILE         save imports, collected declarations and toplevel variables to FILE.
+                   variables containing functions, closures or channels are not saved`, nil},
+			{"set", (*Interp).cmdSet, `set [NAME on|off] show or change interpreter settings. available settings:
+                   autoimport         automatically import packages referenced as pkg.Name
+                   strictimportalias  importing two packages with the same name fails, instead of auto-aliasing
+                   provenance         record the statement that last wrote each toplevel variable, see %cwhence
+                   allerrors          %cload compiles the whole file reporting all errors, and executes it
+                                      only if there are none
+                   project            import packages referenced as pkg.Name from the Go module
+                                      in the current directory and from its direct dependencies
+                   importurl          import "https://HOST/FILE.go" downloads FILE.go and evaluates it
+                                      as a new interpreted package, see %cloadurl
+                   verbose-imports    show the time spent by each import in go get, go list, type loading,
+                                      generating the import file, building and opening the plugin
+                   split              a line containing several statements a := 1; b := 2; a+b
+                                      executes them one by one, printing the result of each one.
+                                      stops at the first statement that fails
+                   vec-loops          compile simple numeric loops on []float64 and []int, as
+                                      for _, x := range s { acc += x }  for i := range a { acc += a[i]*b[i] }
+                                      for i := range s { s[i] *= k }  as calls to the compiled package "vec".
+                                      affects code compiled afterwards
+                   hotspots on|N      after each evaluation, show the N most expensive source lines
+                                      (default 10) with their executed statements and estimated time.
+                                      affects code compiled afterwards
+                   goos GOOS          %cload DIR only loads the files for operating system GOOS
+                   goarch GOARCH      %cload DIR only loads the files for architecture GOARCH
+                   buildtags TAGS     %cload DIR only loads the files matching the comma-separated build TAGS
+                   deterministic-map-range
+                                      unlike Go, "for range" over maps iterates in sorted key order.
+                                      useful for reproducible sessions. affects code compiled afterwards
+                   determinism MODE   record or replay the calls to time.Now, math/rand and crypto/rand.Read,
+                                      for reproducible runs. MODE is one of record FILE, replay FILE, off
+                   mux MODE           print the output of concurrent goroutines line by line, above the prompt.
+                                      MODE is one of on, off, prefix. prefix also marks lines printed
+                                      by other goroutines with [goroutine N]
+                   timeout DURATION   interrupt each evaluation that runs longer than DURATION, or off
+                   untyped FORMAT     print untyped float constants as exact fractions, as decimal [DIGITS]
+                                      or as Go constant expressions. FORMAT is one of exact, decimal [DIGITS], literal
+                   unused MODE        report local variables declared and not used, and imports not used.
+                                      MODE is one of warn, error, off, auto. auto is the default: errors
+                                      while loading files, as the Go compiler does, warnings otherwise
+                   ext lambdas        syntax extension: lambdas x => expr and \x, y -> expr, whose parameter
+                                      types are inferred from the expected function type
+                   ext bignums        syntax extension: literals 123n and 1.5n are *big.Int and *big.Rat,
+                                      and operators on them call their methods`, (*Interp).cmdSetComplete}},
+		't': []Cmd{{"type", (*Interp).cmdType, `type EXPR         show the type of EXPR without evaluating it, and whether it is
+                   constant, addressable or assignable`, nil}},
 		'u': []Cmd{{"unload", (*Interp).cmdUnload, `unload "PKGPATH"  remove package PKGPATH from the list of known packages.
-                   later attempts to import it will trigger a recompile`}},
-		'w': []Cmd{{"write", (*Interp).cmdWrite, `write [FILE]      write collected declarations and/or statements to standard output or to FILE
-                   use %copt Declarations and/or %copt Statements to start collecting them`}},
+                   later attempts to import it will trigger a recompile`, nil}},
+		'w': []Cmd{{"whence", (*Interp).cmdWhence, `whence VAR        show the statement that last wrote toplevel variable VAR.
+                   requires %cset provenance on before the write`, nil},
+			{"write", (*Interp).cmdWrite, `write [FILE]      write collected declarations and/or statements to standard output or to FILE
+                   use %copt Declarations and/or %copt Statements to start collecting them`, nil}},
 	}
 }
 
@@ -328,6 +448,19 @@ func (ir *Interp) cmdDebug(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
 	return "", opt
 }
 
+func (ir *Interp) cmdDisasm(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	arg = strings.TrimSpace(arg)
+	if len(arg) == 0 {
+		g.Fprintf(g.Stdout, "// disasm: missing argument\n")
+	} else if listing, err := ir.Disasm(arg); err != nil {
+		g.Fprintf(g.Stdout, "// disasm: %v\n", err)
+	} else {
+		g.Fprintf(g.Stdout, "%s", listing)
+	}
+	return "", opt
+}
+
 func (ir *Interp) cmdEnv(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
 	ir.ShowPackage(arg)
 	return "", opt
@@ -342,11 +475,69 @@ func (ir *Interp) cmdCopyright(arg string, opt base.CmdOpt) (string, base.CmdOpt
 	return "", opt
 }
 
+func (ir *Interp) cmdGc(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	arg = strings.TrimSpace(arg)
+	if len(arg) != 0 {
+		percent := -1
+		if arg != "off" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				g.Fprintf(g.Stdout, "// gc: expecting a non-negative percentage or off, found %q\n", arg)
+				return "", opt
+			}
+			percent = n
+		}
+		old := debug.SetGCPercent(percent)
+		g.Fprintf(g.Stdout, "// gc: target percentage changed from %d to %d\n", old, percent)
+		return "", opt
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	before := stats.HeapInuse
+	ir.Trim()
+	runtime.ReadMemStats(&stats)
+	g.Fprintf(g.Stdout, "// gc: heap in use %d KiB -> %d KiB, released to OS %d KiB\n",
+		before/1024, stats.HeapInuse/1024, stats.HeapReleased/1024)
+	return "", opt
+}
+
 func (ir *Interp) cmdHelp(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
 	Commands.ShowHelp(&ir.Comp.Globals)
 	return "", opt
 }
 
+func (ir *Interp) cmdImport(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	var force bool
+	var pkgpaths []string
+	for _, word := range strings.Fields(arg) {
+		if word == "--force" || word == "-f" {
+			force = true
+		} else {
+			pkgpaths = append(pkgpaths, strings.Trim(word, "\"`"))
+		}
+	}
+	if len(pkgpaths) == 0 {
+		g.Fprintf(g.Stdout, "// import: missing package path\n")
+		return "", opt
+	}
+	var buf strings.Builder
+	buf.WriteString("import (")
+	for _, path := range pkgpaths {
+		if force {
+			ir.Comp.UnloadPackage(path)
+			if err := genimport.RemoveImportFiles(path); err != nil {
+				g.Fprintf(g.Stdout, "// import: %v\n", err)
+				return "", opt
+			}
+		}
+		fmt.Fprintf(&buf, "%q; ", path)
+	}
+	buf.WriteString(")")
+	return buf.String(), opt
+}
+
 func (ir *Interp) cmdInspect(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
 	g := &ir.Comp.Globals
 	if len(arg) == 0 {
@@ -357,6 +548,58 @@ func (ir *Interp) cmdInspect(arg string, opt base.CmdOpt) (string, base.CmdOpt)
 	return "", opt
 }
 
+func (ir *Interp) cmdType(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	arg = strings.TrimSpace(arg)
+	if len(arg) == 0 {
+		g.Fprintf(g.Stdout, "// type: missing argument\n")
+	} else if info, err := ir.KindOf(arg); err != nil {
+		g.Fprintf(g.Stderr, "%v\n", err)
+	} else {
+		g.Fprintf(g.Stdout, "%s\t// %v\n", arg, info)
+	}
+	return "", opt
+}
+
+func (ir *Interp) cmdLoad(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	filepath := strings.TrimSpace(arg)
+	if len(filepath) == 0 {
+		g.Fprintf(g.Stdout, "// load: missing file name\n")
+		return "", opt
+	}
+	if unquoted, err := strconv.Unquote(filepath); err == nil {
+		filepath = unquoted
+	}
+	allErrors := g.Options&base.OptLoadAllErrors != 0
+	var err error
+	if info, serr := ir.FileSystem().Stat(filepath); serr == nil && info.IsDir() {
+		err = ir.LoadDir(filepath, allErrors)
+	} else {
+		err = ir.LoadFile(filepath, allErrors)
+	}
+	if err != nil {
+		g.Fprintf(g.Stderr, "%v\n", err)
+	}
+	return "", opt
+}
+
+func (ir *Interp) cmdLoadURL(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	address := strings.TrimSpace(arg)
+	if len(address) == 0 {
+		g.Fprintf(g.Stdout, "// loadurl: missing URL\n")
+		return "", opt
+	}
+	if unquoted, err := strconv.Unquote(address); err == nil {
+		address = unquoted
+	}
+	if err := ir.LoadURL(address, g.Options&base.OptLoadAllErrors != 0); err != nil {
+		g.Fprintf(g.Stderr, "%v\n", err)
+	}
+	return "", opt
+}
+
 func (ir *Interp) cmdOptions(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
 	c := ir.Comp
 	g := &c.Globals
@@ -398,10 +641,328 @@ func (ir *Interp) cmdPackage(path string, cmdopt base.CmdOpt) (string, base.CmdO
 	return "", cmdopt
 }
 
+func (ir *Interp) cmdPrelude(name string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		g.Fprintf(g.Stdout, "// available preludes: %s\n", strings.Join(preludeNames(), " "))
+	} else if err := ir.LoadPrelude(name); err != nil {
+		g.Fprintf(g.Stdout, "// prelude: %v\n", err)
+	}
+	return "", opt
+}
+
+// complete the argument of :prelude
+func (ir *Interp) cmdPreludeComplete(arg string) []string {
+	if len(completionArgs(arg)) != 1 {
+		return nil
+	}
+	return preludeNames()
+}
+
 func (ir *Interp) cmdQuit(_ string, opt base.CmdOpt) (string, base.CmdOpt) {
 	return "", opt | base.CmdOptQuit
 }
 
+// settings that can be changed with :set NAME on|off
+var cmdSettings = map[string]base.Options{
+	"autoimport":              base.OptAutoImport,
+	"strictimportalias":       base.OptStrictImportAlias,
+	"provenance":              base.OptTrackProvenance,
+	"allerrors":               base.OptLoadAllErrors,
+	"project":                 base.OptProjectImports,
+	"importurl":               base.OptImportURL,
+	"verbose-imports":         base.OptVerboseImports,
+	"deterministic-map-range": base.OptDeterministicMapRange,
+	"split":                   base.OptSplitStatements,
+	"vec-loops":               base.OptVecLoops,
+}
+
+// optional syntax extensions that can be enabled with :set ext NAME on|off
+var cmdExtensions = map[string]base.Options{
+	"lambdas": base.OptExtLambdas,
+	"bignums": base.OptExtBigNums,
+}
+
+func (ir *Interp) cmdSet(arg string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	name, value := bstrings.Split2(strings.TrimSpace(arg), ' ')
+	if len(name) == 0 {
+		names := make([]string, 0, len(cmdSettings))
+		for name := range cmdSettings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			state := "off"
+			if g.Options&cmdSettings[name] != 0 {
+				state = "on"
+			}
+			g.Fprintf(g.Stdout, "// %s %s\n", name, state)
+		}
+		timeout := "off"
+		if ir.Comp.Timeout > 0 {
+			timeout = ir.Comp.Timeout.String()
+		}
+		g.Fprintf(g.Stdout, "// timeout %s\n", timeout)
+		mux := "off"
+		if m := ir.Mux(); m != nil {
+			mux = "on"
+			if m.GoroutinePrefix {
+				mux = "prefix"
+			}
+		}
+		g.Fprintf(g.Stdout, "// mux %s\n", mux)
+		determinism := "off"
+		if rec := ir.Comp.CompGlobals.recorder; rec != nil {
+			determinism = rec.desc
+		}
+		g.Fprintf(g.Stdout, "// determinism %s\n", determinism)
+		hotspots := "off"
+		if g.Options&base.OptHotspots != 0 {
+			hotspots = strconv.Itoa(ir.hotspotsTop())
+		}
+		g.Fprintf(g.Stdout, "// hotspots %s\n", hotspots)
+		g.Fprintf(g.Stdout, "// untyped %v\n", g.UntypedFormat)
+		g.Fprintf(g.Stdout, "// unused %v\n", ir.Comp.Unused)
+		g.Fprintf(g.Stdout, "// goos %s\n", g.BuildContext.GOOS)
+		g.Fprintf(g.Stdout, "// goarch %s\n", g.BuildContext.GOARCH)
+		g.Fprintf(g.Stdout, "// buildtags %s\n", strings.Join(g.BuildContext.BuildTags, ","))
+		names = names[:0]
+		for name := range cmdExtensions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			state := "off"
+			if g.Options&cmdExtensions[name] != 0 {
+				state = "on"
+			}
+			g.Fprintf(g.Stdout, "// ext %s %s\n", name, state)
+		}
+		return "", opt
+	} else if name == "timeout" {
+		ir.cmdSetTimeout(strings.TrimSpace(value))
+		return "", opt
+	} else if name == "hotspots" {
+		ir.cmdSetHotspots(strings.TrimSpace(value))
+		return "", opt
+	} else if name == "determinism" {
+		ir.cmdSetDeterminism(strings.TrimSpace(value))
+		return "", opt
+	} else if name == "mux" {
+		ir.cmdSetMux(strings.TrimSpace(value))
+		return "", opt
+	} else if name == "untyped" {
+		if format, err := untyped.ParseFormat(value); err != nil {
+			g.Fprintf(g.Stdout, "// set: %v\n", err)
+		} else {
+			g.UntypedFormat = format
+		}
+		return "", opt
+	} else if name == "unused" {
+		if mode, err := ParseUnusedMode(strings.TrimSpace(value)); err != nil {
+			g.Fprintf(g.Stdout, "// set: %v\n", err)
+		} else {
+			ir.Comp.Unused = mode
+		}
+		return "", opt
+	} else if name == "goos" || name == "goarch" || name == "buildtags" {
+		ir.cmdSetBuild(name, strings.TrimSpace(value))
+		return "", opt
+	} else if name == "ext" {
+		name, value = bstrings.Split2(strings.TrimSpace(value), ' ')
+		if setting, ok := cmdExtensions[name]; ok {
+			ir.cmdSetOption(setting, value)
+		} else {
+			g.Fprintf(g.Stdout, "// set: unknown syntax extension %q\n", name)
+		}
+		return "", opt
+	}
+	setting, ok := cmdSettings[name]
+	if !ok {
+		g.Fprintf(g.Stdout, "// set: unknown setting %q\n", name)
+		return "", opt
+	}
+	ir.cmdSetOption(setting, value)
+	return "", opt
+}
+
+// complete the arguments of :set
+func (ir *Interp) cmdSetComplete(arg string) []string {
+	words := completionArgs(arg)
+	var names []string
+	switch len(words) {
+	case 1:
+		names = []string{"timeout", "hotspots", "determinism", "mux", "untyped", "unused", "goos", "goarch", "buildtags", "ext"}
+		for name := range cmdSettings {
+			names = append(names, name)
+		}
+	case 2:
+		if _, ok := cmdSettings[words[0]]; ok {
+			names = []string{"on", "off"}
+			break
+		}
+		switch words[0] {
+		case "hotspots":
+			names = []string{"on", "off"}
+		case "determinism":
+			names = []string{"record", "replay", "off"}
+		case "mux":
+			names = []string{"on", "off", "prefix"}
+		case "untyped":
+			names = []string{"exact", "decimal", "literal"}
+		case "unused":
+			names = append([]string(nil), unusedModeNames[:]...)
+		case "ext":
+			for name := range cmdExtensions {
+				names = append(names, name)
+			}
+		}
+	case 3:
+		if _, ok := cmdExtensions[words[1]]; ok && words[0] == "ext" {
+			names = []string{"on", "off"}
+		}
+	}
+	return names
+}
+
+// set or clear the option setting
+func (ir *Interp) cmdSetOption(setting base.Options, value string) {
+	g := &ir.Comp.Globals
+	switch strings.TrimSpace(value) {
+	case "on", "true", "1":
+		g.Options |= setting
+	case "off", "false", "0":
+		g.Options &^= setting
+	default:
+		g.Fprintf(g.Stdout, "// set: expecting on or off, found %q\n", value)
+	}
+}
+
+// enable or disable reporting the most expensive source lines after each evaluation.
+// value can also be the number of lines to report
+func (ir *Interp) cmdSetHotspots(value string) {
+	g := &ir.Comp.Globals
+	switch value {
+	case "on", "true":
+		g.Options |= base.OptHotspots
+		return
+	case "off", "false", "0":
+		g.Options &^= base.OptHotspots
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		g.Fprintf(g.Stdout, "// set: expecting on, off or the number of lines to report, found %q\n", value)
+		return
+	}
+	ir.Comp.CompGlobals.hotspotsTop = n
+	g.Options |= base.OptHotspots
+}
+
+// set GOOS, GOARCH or build tags used by :load DIR
+func (ir *Interp) cmdSetBuild(name string, value string) {
+	g := &ir.Comp.Globals
+	if name == "buildtags" {
+		var tags []string
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); len(tag) != 0 {
+				tags = append(tags, tag)
+			}
+		}
+		g.BuildContext.BuildTags = tags
+		return
+	}
+	if len(value) == 0 || strings.ContainsAny(value, " \t,") {
+		g.Fprintf(g.Stdout, "// set: expecting a single word as %s, found %q\n", name, value)
+	} else if name == "goos" {
+		g.BuildContext.GOOS = value
+	} else {
+		g.BuildContext.GOARCH = value
+	}
+}
+
+// record or replay the sources of randomness and time
+func (ir *Interp) cmdSetDeterminism(value string) {
+	g := ir.Comp.CompGlobals
+	mode, path := bstrings.Split2(value, ' ')
+	path = strings.TrimSpace(path)
+	if unquoted, err := strconv.Unquote(path); err == nil {
+		path = unquoted
+	}
+	if mode != "off" && (mode != "record" && mode != "replay" || len(path) == 0) {
+		g.Fprintf(g.Stdout, "// set: expecting record FILE, replay FILE or off, found %q\n", value)
+		return
+	}
+	if rec := g.recorder; rec != nil {
+		g.recorder = nil
+		if err := rec.Stop(); err != nil {
+			g.Fprintf(g.Stdout, "// set: %v\n", err)
+		}
+	}
+	var file *os.File
+	var rec *Recorder
+	var err error
+	switch mode {
+	case "record":
+		if file, err = os.Create(path); err == nil {
+			rec, err = ir.RecordRandom(file)
+		}
+	case "replay":
+		if file, err = os.Open(path); err == nil {
+			rec, err = ir.ReplayRandom(file)
+		}
+	default:
+		return
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		g.Fprintf(g.Stdout, "// set: %v\n", err)
+		return
+	}
+	rec.closer = file
+	rec.desc = mode + " " + strconv.Quote(path)
+	g.recorder = rec
+}
+
+// enable or disable output multiplexing
+func (ir *Interp) cmdSetMux(value string) {
+	g := &ir.Comp.Globals
+	var err error
+	switch value {
+	case "on", "true", "1":
+		err = ir.MultiplexOutput(false)
+	case "prefix":
+		err = ir.MultiplexOutput(true)
+	case "off", "false", "0":
+		ir.StopMultiplexOutput()
+	default:
+		g.Fprintf(g.Stdout, "// set: expecting on, off or prefix, found %q\n", value)
+	}
+	if err != nil {
+		g.Fprintf(g.Stdout, "// set: %v\n", err)
+	}
+}
+
+// set or clear the maximum duration of each evaluation
+func (ir *Interp) cmdSetTimeout(value string) {
+	g := &ir.Comp.Globals
+	switch value {
+	case "off", "false", "0":
+		ir.Comp.Timeout = 0
+		return
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		g.Fprintf(g.Stdout, "// set: expecting a positive duration as 5s or off, found %q\n", value)
+		return
+	}
+	ir.Comp.Timeout = timeout
+}
+
 // remove package 'path' from the list of known packages
 func (ir *Interp) cmdUnload(path string, opt base.CmdOpt) (string, base.CmdOpt) {
 	if len(path) != 0 {
@@ -410,6 +971,25 @@ func (ir *Interp) cmdUnload(path string, opt base.CmdOpt) (string, base.CmdOpt)
 	return "", opt
 }
 
+func (ir *Interp) cmdWhence(name string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		g.Fprintf(g.Stdout, "// whence: missing variable name\n")
+	} else if pos, source, ok := ir.Whence(name); !ok {
+		if g.Options&base.OptTrackProvenance == 0 {
+			g.Fprintf(g.Stdout, "// whence: no recorded writes to %s. Record them with %cset provenance on\n", name, g.ReplCmdChar)
+		} else {
+			g.Fprintf(g.Stdout, "// whence: no recorded writes to %s\n", name)
+		}
+	} else if len(source) != 0 {
+		g.Fprintf(g.Stdout, "// %s last written at %v: %s\n", name, pos, strings.TrimSpace(source))
+	} else {
+		g.Fprintf(g.Stdout, "// %s last written at %v\n", name, pos)
+	}
+	return "", opt
+}
+
 func (ir *Interp) cmdWrite(filepath string, opt base.CmdOpt) (string, base.CmdOpt) {
 	g := &ir.Comp.Globals
 	if len(filepath) == 0 {
@@ -419,3 +999,41 @@ func (ir *Interp) cmdWrite(filepath string, opt base.CmdOpt) (string, base.CmdOp
 	}
 	return "", opt
 }
+
+func (ir *Interp) cmdSave(path string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	path = strings.TrimSpace(path)
+	if len(path) == 0 {
+		g.Fprintf(g.Stdout, "// save: missing file name\n")
+		return "", opt
+	}
+	f, err := os.Create(path)
+	if err == nil {
+		err = ir.SaveSession(f)
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		g.Fprintf(g.Stdout, "// %v\n", err)
+	}
+	return "", opt
+}
+
+func (ir *Interp) cmdRestore(path string, opt base.CmdOpt) (string, base.CmdOpt) {
+	g := &ir.Comp.Globals
+	path = strings.TrimSpace(path)
+	if len(path) == 0 {
+		g.Fprintf(g.Stdout, "// restore: missing file name\n")
+		return "", opt
+	}
+	f, err := os.Open(path)
+	if err == nil {
+		err = ir.RestoreSession(f)
+		f.Close()
+	}
+	if err != nil {
+		g.Fprintf(g.Stdout, "// %v\n", err)
+	}
+	return "", opt
+}
@@ -125,6 +125,7 @@ func (run *Run) interrupt() {
 		sig = base.SigInterrupt
 	}
 	run.Signals.Async = sig
+	run.notifyInterrupt()
 }
 
 // Exec returns a func(*Env) that will execute the compiled code
@@ -274,6 +275,7 @@ func reExecWithFlags(env *Env, all []Stmt, pos []token.Pos, stmt Stmt, ip int) {
 			panicking = true
 			panicking2 = false
 			run.Panic = recover()
+			run.savePanicStack()
 		}
 		defer popDefer(pushDefer(run, funenv, panicking))
 		panicking2 = true // detect panics inside defer
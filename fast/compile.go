@@ -106,12 +106,68 @@ func (tg *Run) glsDel() {
 
 func (run *Run) new(goid uintptr) *Run {
 	return &Run{
-		IrGlobals: run.IrGlobals,
-		goid:      goid,
+		IrGlobals:   run.IrGlobals,
+		goid:        goid,
+		interruptCh: make(chan struct{}, 1),
 		// Interrupt, Signal, PoolSize and Pool are zero-initialized, fine with that
 	}
 }
 
+// enterEval is invoked when starting an evaluation with run.
+// If the current goroutine is not the owner of run, the interpreted functions
+// called by the evaluation execute with the Run of the current goroutine:
+// remember it, so that interruptEval() reaches them too.
+// The returned function must be deferred: it restores the previous state
+func (run *Run) enterEval() func() {
+	goid := gls.GoID()
+	if goid == run.goid {
+		return func() {}
+	}
+	g := run.IrGlobals
+	g.lock.Lock()
+	grun := g.gls[goid]
+	created := grun == nil
+	if created {
+		grun = run.new(goid)
+		g.gls[goid] = grun
+	}
+	prev := run.evalRun
+	run.evalRun = grun
+	g.lock.Unlock()
+
+	// discard interrupts received after the previous evaluation completed
+	grun.Signals.Async = base.SigNone
+	grun.clearInterrupt()
+	return func() {
+		g.lock.Lock()
+		run.evalRun = prev
+		if created {
+			delete(g.gls, goid)
+		}
+		g.lock.Unlock()
+	}
+}
+
+// evalRuns returns run and, if set, the Run of the goroutine executing the current evaluation, see enterEval()
+func (run *Run) evalRuns() []*Run {
+	g := run.IrGlobals
+	g.lock.Lock()
+	grun := run.evalRun
+	g.lock.Unlock()
+	if grun == nil {
+		return []*Run{run}
+	}
+	return []*Run{run, grun}
+}
+
+// interruptEval interrupts the evaluation in progress with run,
+// including the interpreted functions it calls from another goroutine
+func (run *Run) interruptEval() {
+	for _, x := range run.evalRuns() {
+		x.interrupt()
+	}
+}
+
 // common part between NewEnv() and newEnv4Func()
 func newEnv(run *Run, outer *Env, nbind int, nintbind int) *Env {
 	pool := &run.Pool // pool is an array, do NOT copy it!
@@ -330,6 +386,7 @@ func (c *Comp) Compile(in Ast) *Expr {
 		// shortcut
 		return c.compileNode(node, dep.Unknown)
 	}
+	moveEmbedDocs(in)
 	// order declarations by topological sort on their dependencies
 	sorter := dep.NewSorter()
 	sorter.LoadAst(in)
@@ -379,7 +436,12 @@ func (c *Comp) compileDecl(decl *dep.Decl) *Expr {
 			c.DeclConsts(extra.Spec(), nil, nil)
 			return c.Code.AsExpr()
 		case dep.Var:
-			c.DeclVars(extra.Spec())
+			if spec, ok := decl.Node.(*ast.ValueSpec); ok && spec.Doc != nil {
+				// keep the //go:embed directive, if any
+				c.DeclVars(spec)
+			} else {
+				c.DeclVars(extra.Spec())
+			}
 			return c.Code.AsExpr()
 		}
 	}
@@ -417,6 +479,16 @@ func (c *Comp) compileNode(node ast.Node, kind dep.Kind) *Expr {
 	c.FuncMaker = nil
 	c.Pos = node.Pos()
 	switch node := node.(type) {
+	case *ast.FuncDecl:
+		switch kind {
+		case dep.FuncFwd:
+			// forward function declaration
+			c.declFuncFwd(node)
+		case dep.Init:
+			c.declInit(node)
+		default:
+			c.Decl(node)
+		}
 	case ast.Decl:
 		c.Decl(node)
 	case ast.Expr:
@@ -464,9 +536,21 @@ func (c *Comp) File(node *ast.File) {
 }
 
 func (c *Comp) Append(stmt Stmt, pos token.Pos) {
+	if c.Code.deadCode {
+		return
+	}
+	if stmt != nil {
+		c.stats.Stmts++
+		if c.Options&base.OptHotspots != 0 {
+			stmt = c.hotspot(stmt, pos)
+		}
+		if c.Options&base.OptYieldPoints != 0 {
+			stmt = yieldPoint(stmt)
+		}
+	}
 	c.Code.Append(stmt, pos)
 }
 
 func (c *Comp) append(stmt Stmt) {
-	c.Code.Append(stmt, c.Pos)
+	c.Append(stmt, c.Pos)
 }
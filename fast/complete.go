@@ -0,0 +1,446 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * complete.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"go/token"
+	r "reflect"
+	"sort"
+	"strings"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// CandidateKind is the kind of a code completion Candidate
+type CandidateKind uint8
+
+const (
+	CandidateVar CandidateKind = iota
+	CandidateConst
+	CandidateFunc
+	CandidateType
+	CandidatePackage
+	CandidateField
+	CandidateMethod
+	CandidateKeyword
+)
+
+func (kind CandidateKind) String() string {
+	switch kind {
+	case CandidateVar:
+		return "var"
+	case CandidateConst:
+		return "const"
+	case CandidateFunc:
+		return "func"
+	case CandidateType:
+		return "type"
+	case CandidatePackage:
+		return "package"
+	case CandidateField:
+		return "field"
+	case CandidateMethod:
+		return "method"
+	case CandidateKeyword:
+		return "keyword"
+	default:
+		return fmt.Sprintf("CandidateKind%d", uint8(kind))
+	}
+}
+
+// Candidate is a code completion candidate, as returned by Interp.Complete()
+type Candidate struct {
+	Name string
+	Kind CandidateKind
+	// Type is the type of variables, constants, functions, fields and methods,
+	// or the underlying type of types. Empty for packages and keywords
+	Type string
+	// Doc is a short description, when available:
+	// the value of constants, the import path of packages, the meaning of keywords
+	Doc string
+}
+
+// Complete returns the code completion candidates for the identifier
+// or the dot-separated sequence of identifiers that ends at byte offset in src.
+// Each candidate replaces the partial identifier immediately before offset.
+// Meant for embedders as Jupyter kernels and GUI frontends:
+// it supports the same symbols as CompleteWords, and also returns their kind, type and description
+func (ir *Interp) Complete(src string, offset int) []Candidate {
+	if offset > len(src) {
+		offset = len(src)
+	} else if offset < 0 {
+		offset = 0
+	}
+	return ir.Comp.completeCandidates(completionWords(src[:offset]))
+}
+
+// implement code completion API github.com/pererh/liner.WordCompleter
+// Currently only supports global symbols and imported packages,
+// optionally followed by a dot-separated sequence of field or method names,
+// including embedded fields and wrapper methods.
+func (ir *Interp) CompleteWords(line string, pos int) (head string, completions []string, tail string) {
+	if pos > len(line) {
+		pos = len(line)
+	}
+	head = line[:pos]
+	tail = line[pos:]
+	if fixed, completions, ok := ir.completeCommand(head); ok {
+		return head[:fixed], completions, tail
+	}
+	completions = ir.Comp.CompleteWords(completionWords(head))
+	if len(completions) != 0 {
+		fixed := len(head) - len(TailIdentifier(head))
+		pos := strings.LastIndexByte(head, '.')
+		if pos >= 0 && pos >= fixed {
+			head = head[:pos+1]
+		} else {
+			head = head[:fixed]
+		}
+	}
+	return head, completions, tail
+}
+
+// complete the name of a REPL command, or its arguments if the command has a Cmd.Complete function.
+// return the length of the prefix of head not replaced by the completions,
+// and ok = false if head does not start with such a REPL command
+func (ir *Interp) completeCommand(head string) (fixed int, completions []string, ok bool) {
+	g := &ir.Comp.Globals
+	trim := strings.TrimLeft(head, " \t")
+	if len(trim) == 0 || g.ReplCmdChar == 0 || trim[0] != g.ReplCmdChar {
+		return 0, nil, false
+	}
+	fixed = len(head) - len(trim) + 1 // skip g.ReplCmdChar
+	name, arg := trim[1:], ""
+	if space := strings.IndexAny(name, " \t"); space >= 0 {
+		name, arg = name[:space], name[space+1:]
+	} else {
+		for _, cmd := range Commands.List() {
+			if strings.HasPrefix(cmd.Name, name) {
+				completions = append(completions, cmd.Name)
+			}
+		}
+		return fixed, completions, len(completions) != 0
+	}
+	cmd, err := Commands.Lookup(name)
+	if err != nil || cmd.Complete == nil {
+		// the arguments of most commands are Go code: complete them as usual
+		return 0, nil, false
+	}
+	words := completionArgs(arg)
+	last := words[len(words)-1]
+	func() {
+		defer func() {
+			// do not crash the REPL if cmd.Complete panics
+			recover()
+		}()
+		for _, word := range cmd.Complete(ir, arg) {
+			if strings.HasPrefix(word, last) {
+				completions = append(completions, word)
+			}
+		}
+	}()
+	sort.Strings(completions)
+	return len(head) - len(last), completions, true
+}
+
+// split the arguments of a REPL command into space-separated words.
+// if arg is empty or ends with a space, the last word is empty
+func completionArgs(arg string) []string {
+	words := strings.Fields(arg)
+	if n := len(arg); n == 0 || arg[n-1] == ' ' || arg[n-1] == '\t' {
+		words = append(words, "")
+	}
+	return words
+}
+
+// split the text before the cursor into the longest sequence of ident.ident.ident...
+func completionWords(head string) []string {
+	words := strings.Split(head, ".")
+	n := len(words)
+	for i := n - 1; i >= 0; i-- {
+		// ignore spaces before and after identifiers
+		words[i] = strings.TrimSpace(words[i])
+
+		if i == n-1 && len(words[i]) == 0 {
+			// last word can be empty: it means TAB immediately after '.'
+			continue
+		}
+		word := TailIdentifier(words[i])
+		if len(word) != len(words[i]) {
+			if len(word) != 0 {
+				words[i] = word
+			} else {
+				i++
+			}
+			words = words[i:]
+			break
+		}
+	}
+	return words
+}
+
+// implement code completion on ident.ident.ident.ident...
+func (c *Comp) CompleteWords(words []string) []string {
+	candidates := c.completeCandidates(words)
+	var completions []string
+	for _, candidate := range candidates {
+		completions = append(completions, candidate.Name)
+	}
+	return completions
+}
+
+func (c *Comp) completeCandidates(words []string) []Candidate {
+	var candidates []Candidate
+	switch len(words) {
+	case 0:
+	case 1:
+		candidates = c.completeWord(words[0])
+	default:
+		var node interface{}
+		if sym := c.TryResolve(words[0]); sym != nil {
+			node = &sym.Bind
+		} else if typ := c.TryResolveType(words[0]); typ != nil {
+			node = typ
+		} else {
+			break
+		}
+		candidates = c.completeWords(node, words[1:])
+	}
+	return candidates
+}
+
+func (c *Comp) completeWords(node interface{}, words []string) []Candidate {
+	i, n := 0, len(words)
+	for i+1 < n {
+		switch obj := node.(type) {
+		case *Bind:
+			if obj.Const() {
+				if imp, ok := obj.Value.(*Import); ok {
+					// complete on imported package contents
+					node = imp
+					continue
+				}
+			}
+			// complete on symbol type
+			node = obj.Type
+			continue
+		case *Import:
+			if i != 0 {
+				break
+			} else if bind := obj.Binds[words[i]]; bind != nil {
+				// complete on imported package binds
+				node = bind
+				i++
+				continue
+			} else if typ := obj.Types[words[i]]; typ != nil {
+				// complete on imported package types
+				node = typ
+				i++
+				continue
+			}
+		case xr.Type:
+			field, fieldok, _, _, err := c.TryLookupFieldOrMethod(obj, words[i])
+			if err != nil {
+				break
+			} else if fieldok {
+				node = field.Type
+				i++
+				continue
+			}
+			// {type,value}.method.anything will never compile
+		}
+		return nil
+	}
+	return c.completeLastWord(node, words[i])
+}
+
+var keywords []string
+
+func init() {
+	lo, hi := token.BREAK, token.VAR
+	keywords = make([]string, hi-lo+3)
+	for tok := lo; tok <= hi; tok++ {
+		keywords[tok-lo] = tok.String()
+	}
+	keywords[hi-lo+1] = "macro"
+	keywords[hi-lo+2] = "template"
+}
+
+// complete a single, partial word
+func (c *Comp) completeWord(word string) []Candidate {
+	var candidates []Candidate
+	if size := len(word); size != 0 {
+		// complete binds and types. Declare the matching builtins not declared yet
+		for name := range c.lazyBinds {
+			if len(name) >= size && name[:size] == word {
+				c.declLazyBind(name)
+			}
+		}
+		for co := c; co != nil; co = co.Outer {
+			for name, bind := range co.Binds {
+				if len(name) >= size && name[:size] == word {
+					candidates = append(candidates, bindCandidate(name, bind))
+				}
+			}
+			for name, typ := range co.Types {
+				if len(name) >= size && name[:size] == word {
+					candidates = append(candidates, typeCandidate(name, typ))
+				}
+			}
+		}
+		// complete keywords
+		for _, name := range keywords {
+			if len(name) >= size && name[:size] == word {
+				candidates = append(candidates, Candidate{Name: name, Kind: CandidateKeyword, Doc: keywordDoc(name)})
+			}
+		}
+	}
+	return sortUnique(candidates)
+}
+
+// complete the last partial word of a sequence ident.ident.ident...
+func (c *Comp) completeLastWord(node interface{}, word string) []Candidate {
+	var candidates []Candidate
+	size := len(word)
+	for {
+		switch obj := node.(type) {
+		case *Bind:
+			if obj.Const() {
+				if imp, ok := obj.Value.(*Import); ok {
+					// complete on imported package contents
+					node = imp
+					continue
+				}
+			}
+			// complete on symbol type
+			node = obj.Type
+			continue
+		case *Import:
+			for name, bind := range obj.Binds {
+				if len(name) >= size && name[:size] == word {
+					candidates = append(candidates, bindCandidate(name, bind))
+				}
+			}
+			for name, typ := range obj.Types {
+				if len(name) >= size && name[:size] == word {
+					candidates = append(candidates, typeCandidate(name, typ))
+				}
+			}
+		case xr.Type:
+			candidates = c.listFieldsAndMethods(obj, word)
+		}
+		break
+	}
+	return sortUnique(candidates)
+}
+
+func bindCandidate(name string, bind *Bind) Candidate {
+	candidate := Candidate{Name: name, Type: typeString(bind.Type)}
+	switch bind.Desc.Class() {
+	case ConstBind:
+		if imp, ok := bind.Value.(*Import); ok {
+			return Candidate{Name: name, Kind: CandidatePackage, Doc: fmt.Sprintf("import %q", imp.Path)}
+		}
+		switch value := bind.Value.(type) {
+		case Builtin:
+			return Candidate{Name: name, Kind: CandidateFunc, Doc: "builtin function"}
+		case Function:
+			return Candidate{Name: name, Kind: CandidateFunc, Type: typeString(value.Type)}
+		case Macro:
+			return Candidate{Name: name, Kind: CandidateFunc, Doc: "macro"}
+		case nil:
+			candidate.Kind = CandidateConst
+		default:
+			candidate.Kind = CandidateConst
+			candidate.Doc = fmt.Sprintf("= %v", value)
+		}
+	case FuncBind, GenericFuncBind:
+		candidate.Kind = CandidateFunc
+	case GenericTypeBind:
+		candidate.Kind = CandidateType
+	default:
+		candidate.Kind = CandidateVar
+	}
+	return candidate
+}
+
+func typeCandidate(name string, t xr.Type) Candidate {
+	candidate := Candidate{Name: name, Kind: CandidateType}
+	if t != nil {
+		if gtype := t.GoType(); gtype != nil {
+			candidate.Type = gtype.Underlying().String()
+		}
+	}
+	return candidate
+}
+
+func typeString(t xr.Type) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// return the type of a method, without the receiver
+func (c *Comp) methodTypeString(t xr.Type) string {
+	if t == nil || t.Kind() != r.Func || !t.IsMethod() {
+		return typeString(t)
+	}
+	in := make([]xr.Type, t.NumIn()-1)
+	for i := range in {
+		in[i] = t.In(i + 1)
+	}
+	out := make([]xr.Type, t.NumOut())
+	for i := range out {
+		out[i] = t.Out(i)
+	}
+	return c.Universe.FuncOf(in, out, t.IsVariadic()).String()
+}
+
+var keywordDocs = map[string]string{
+	"macro":    "declares a macro, i.e. a function that transforms source code",
+	"template": "declares a generic function or type, C++ style",
+}
+
+func keywordDoc(name string) string {
+	if doc := keywordDocs[name]; len(doc) != 0 {
+		return doc
+	}
+	return "Go keyword"
+}
+
+// sort candidates by name and remove duplicate names, keeping the first occurrence:
+// inner scopes are visited first, so they shadow outer ones
+func sortUnique(vec []Candidate) []Candidate {
+	if n := len(vec); n > 1 {
+		sort.SliceStable(vec, func(i, j int) bool {
+			return vec[i].Name < vec[j].Name
+		})
+		prev := vec[0].Name
+		j := 1
+		for i := 1; i < n; i++ {
+			if s := vec[i].Name; s != prev {
+				vec[j] = vec[i]
+				prev = s
+				j++
+			}
+		}
+		vec = vec[:j]
+	}
+	return vec
+}
@@ -68,7 +68,7 @@ func (c *Comp) compositeLitArray(t xr.Type, ellipsis bool, node *ast.CompositeLi
 			return xr.New(t).Elem()
 		})
 	}
-	size, keys, funvals := c.compositeLitElements(t, ellipsis, node)
+	size, keys, funvals, allconst := c.compositeLitElements(t, ellipsis, node)
 	if ellipsis {
 		// rebuild type with correct length
 		t = c.Universe.ArrayOf(size, t.Elem())
@@ -79,6 +79,19 @@ func (c *Comp) compositeLitArray(t xr.Type, ellipsis bool, node *ast.CompositeLi
 	rtelem := telem.ReflectType()
 	zeroelem := xr.Zero(telem)
 
+	if allconst {
+		// all elements are constant: build the array once at compile time,
+		// then copy it at each execution
+		template := xr.New(t).Elem()
+		for i, funval := range funvals {
+			template.Index(keys[i]).Set(evalConstElem(funval, rtelem, zeroelem))
+		}
+		return exprX1(t, func(env *Env) xr.Value {
+			obj := xr.New(t).Elem()
+			obj.Set(template)
+			return obj
+		})
+	}
 	return exprX1(t, func(env *Env) xr.Value {
 		obj := xr.New(t).Elem()
 		var val xr.Value
@@ -103,10 +116,24 @@ func (c *Comp) compositeLitSlice(t xr.Type, node *ast.CompositeLit) *Expr {
 			return xr.MakeSlice(t, 0, 0)
 		})
 	}
-	size, keys, funvals := c.compositeLitElements(t, false, node)
+	size, keys, funvals, allconst := c.compositeLitElements(t, false, node)
 
 	rtelem := rtype.Elem()
 	zeroelem := xr.ZeroR(rtelem)
+	if allconst {
+		// all elements are constant: compute them once at compile time
+		vals := make([]xr.Value, len(funvals))
+		for i, funval := range funvals {
+			vals[i] = evalConstElem(funval, rtelem, zeroelem)
+		}
+		return exprX1(t, func(env *Env) xr.Value {
+			obj := xr.MakeSlice(t, size, size)
+			for i, val := range vals {
+				obj.Index(keys[i]).Set(val)
+			}
+			return obj
+		})
+	}
 	return exprX1(t, func(env *Env) xr.Value {
 		obj := xr.MakeSlice(t, size, size)
 		var val xr.Value
@@ -123,7 +150,9 @@ func (c *Comp) compositeLitSlice(t xr.Type, node *ast.CompositeLit) *Expr {
 	})
 }
 
-func (c *Comp) compositeLitElements(t xr.Type, ellipsis bool, node *ast.CompositeLit) (size int, keys []int, funvals []func(*Env) xr.Value) {
+// compositeLitElements compiles the elements of an array or slice composite literal.
+// allconst is true if all elements are constant, i.e. funvals do not depend on *Env
+func (c *Comp) compositeLitElements(t xr.Type, ellipsis bool, node *ast.CompositeLit) (size int, keys []int, funvals []func(*Env) xr.Value, allconst bool) {
 	n := len(node.Elts)
 	tval := t.Elem()
 	seen := make(map[int]bool) // indexes already seen
@@ -131,6 +160,7 @@ func (c *Comp) compositeLitElements(t xr.Type, ellipsis bool, node *ast.Composit
 	funvals = make([]func(*Env) xr.Value, n)
 	size = 0
 	key, lastkey := 0, -1
+	allconst = true
 
 	for i, el := range node.Elts {
 		elv := el
@@ -169,13 +199,27 @@ func (c *Comp) compositeLitElements(t xr.Type, ellipsis bool, node *ast.Composit
 		if eval.Const() {
 			eval.ConstTo(tval)
 		} else if !eval.Type.AssignableTo(tval) {
-			c.Errorf("cannot use %v <%v> as type <%v> in %s value", elv, eval.Type, tval, t.Kind())
+			c.Errorf("cannot use %v <%v> as type <%v> in %s value%s", elv, eval.Type, tval, t.Kind(), interfaceMissingMethod(eval.Type, tval))
 		} else {
+			allconst = false
 			eval.To(c, tval)
 		}
 		funvals[i] = eval.AsX1()
 	}
-	return size, keys, funvals
+	return size, keys, funvals, allconst
+}
+
+// evalConstElem evaluates at compile time the closure of a constant element
+// of a composite literal, and converts the result to rtype.
+// Constant closures ignore their *Env argument, so passing nil is fine
+func evalConstElem(fun func(*Env) xr.Value, rtype r.Type, zero xr.Value) xr.Value {
+	val := fun(nil)
+	if !val.IsValid() || val == None {
+		val = zero
+	} else if val.Type() != rtype {
+		val = convert(val, rtype)
+	}
+	return val
 }
 
 func (c *Comp) compositeLitMap(t xr.Type, node *ast.CompositeLit) *Expr {
@@ -191,6 +235,7 @@ func (c *Comp) compositeLitMap(t xr.Type, node *ast.CompositeLit) *Expr {
 	seen := make(map[interface{}]bool) // constant keys already seen
 	funkeys := make([]func(*Env) xr.Value, n)
 	funvals := make([]func(*Env) xr.Value, n)
+	allconst := true
 
 	for i, el := range node.Elts {
 		switch elkv := el.(type) {
@@ -205,14 +250,16 @@ func (c *Comp) compositeLitMap(t xr.Type, node *ast.CompositeLit) *Expr {
 			} else if !ekey.Type.AssignableTo(tkey) {
 				c.Errorf("cannot use %v <%v> as type <%v> in map key", elkv.Key, ekey.Type, tkey)
 			} else {
+				allconst = false
 				ekey.To(c, tkey)
 			}
 			eval := c.Expr1(elkv.Value, tval)
 			if eval.Const() {
 				eval.ConstTo(tval)
 			} else if !eval.Type.AssignableTo(tval) {
-				c.Errorf("cannot use %v <%v> as type <%v> in map value", elkv.Value, eval.Type, tval)
+				c.Errorf("cannot use %v <%v> as type <%v> in map value%s", elkv.Value, eval.Type, tval, interfaceMissingMethod(eval.Type, tval))
 			} else {
+				allconst = false
 				eval.To(c, tval)
 			}
 			funkeys[i] = ekey.AsX1()
@@ -222,6 +269,24 @@ func (c *Comp) compositeLitMap(t xr.Type, node *ast.CompositeLit) *Expr {
 			c.Errorf("missing key in map literal: %v", el)
 		}
 	}
+	if allconst {
+		// all keys and values are constant: compute them once at compile time
+		rtkey, rtval := tkey.ReflectType(), tval.ReflectType()
+		zerokey, zeroval := xr.ZeroR(rtkey), xr.ZeroR(rtval)
+		keys := make([]xr.Value, n)
+		vals := make([]xr.Value, n)
+		for i, funkey := range funkeys {
+			keys[i] = evalConstElem(funkey, rtkey, zerokey)
+			vals[i] = evalConstElem(funvals[i], rtval, zeroval)
+		}
+		return exprX1(t, func(env *Env) xr.Value {
+			obj := xr.MakeMap(t)
+			for i, key := range keys {
+				obj.SetMapIndex(key, vals[i])
+			}
+			return obj
+		})
+	}
 	return exprX1(t, func(env *Env) xr.Value {
 		obj := xr.MakeMap(t)
 		var key, val xr.Value
@@ -247,6 +312,7 @@ func (c *Comp) compositeLitStruct(t xr.Type, node *ast.CompositeLit) *Expr {
 	inits := make([]func(*Env) xr.Value, n)
 	indexes := make([]int, n)
 	var flagkv, flagv bool
+	allconst := true
 
 	for i, el := range node.Elts {
 		switch elkv := el.(type) {
@@ -272,8 +338,9 @@ func (c *Comp) compositeLitStruct(t xr.Type, node *ast.CompositeLit) *Expr {
 				if expr.Const() {
 					expr.ConstTo(field.Type)
 				} else if !expr.Type.AssignableTo(field.Type) {
-					c.Errorf("cannot use %v <%v> as type <%v> in field value", elkv.Value, expr.Type, field.Type)
+					c.Errorf("cannot use %v <%v> as type <%v> in field value%s", elkv.Value, expr.Type, field.Type, interfaceMissingMethod(expr.Type, field.Type))
 				} else {
+					allconst = false
 					expr.To(c, field.Type)
 				}
 				inits[i] = expr.AsX1()
@@ -291,8 +358,9 @@ func (c *Comp) compositeLitStruct(t xr.Type, node *ast.CompositeLit) *Expr {
 			if expr.Const() {
 				expr.ConstTo(field.Type)
 			} else if !expr.Type.AssignableTo(field.Type) {
-				c.Errorf("cannot use %v <%v> as type <%v> in field value", el, expr.Type, field.Type)
+				c.Errorf("cannot use %v <%v> as type <%v> in field value%s", el, expr.Type, field.Type, interfaceMissingMethod(expr.Type, field.Type))
 			} else {
+				allconst = false
 				expr.To(c, field.Type)
 			}
 			if !ast.IsExported(field.Name) && field.Pkg.Path() != c.FileComp().Path {
@@ -312,6 +380,20 @@ func (c *Comp) compositeLitStruct(t xr.Type, node *ast.CompositeLit) *Expr {
 		c.Errorf("too %s values in struct initializer: <%v> has %d fields, found %d initializer%s",
 			label, t, nfield, n, plural)
 	}
+	if allconst {
+		// all fields are constant: build the struct once at compile time,
+		// then copy it at each execution
+		template := xr.New(t).Elem()
+		for i, init := range inits {
+			field := template.Field(indexes[i])
+			field.Set(evalConstElem(init, field.Type(), xr.ZeroR(field.Type())))
+		}
+		return exprX1(t, func(env *Env) xr.Value {
+			obj := xr.New(t).Elem()
+			obj.Set(template)
+			return obj
+		})
+	}
 	return exprX1(t, func(env *Env) xr.Value {
 		obj := xr.New(t).Elem()
 		var val, field xr.Value
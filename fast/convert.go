@@ -21,13 +21,14 @@ import (
 	r "reflect"
 
 	"github.com/cosmos72/gomacro/base/reflect"
+	"github.com/cosmos72/gomacro/base/untyped"
 
 	xr "github.com/cosmos72/gomacro/xreflect"
 )
 
 // Convert compiles a type conversion expression
 func (c *Comp) Convert(node ast.Expr, t xr.Type) *Expr {
-	e := c.expr1(node, nil)
+	e := c.expr1(node, shiftHint(node, t))
 	return c.convert(e, t, node)
 }
 
@@ -39,22 +40,29 @@ func (c *Comp) convert(e *Expr, t xr.Type, nodeOpt ast.Expr) *Expr {
 
 	if e.Type != nil && e.Type.IdenticalTo(t) {
 		return e
-	} else if e.Type != nil && e.Type.ReflectType() == t.ReflectType() {
-		if e.Const() {
-			return c.exprValue(t, e.Value)
-		} else {
-			return c.Jit.Identity(exprFun(t, e.Fun), e)
-		}
 	} else if e.Type == nil && reflect.IsNillableKind(t.Kind()) {
 		e.Type = t
 		e.Value = xr.Zero(t).Interface()
-	} else if e.Type != nil && e.Type.ConvertibleTo(t) {
-	} else {
+	} else if e.Type == nil || !e.Type.ConvertibleTo(t) {
+		// check convertibility before comparing reflect.Type:
+		// distinct interpreted types may share the same reflect.Type,
+		// as for example func(A) and func(B) given type A int; type B int
 		c.Errorf("cannot convert %v to %v: %v", e.Type, t, nodeOpt)
 		return nil
+	} else if e.Type.ReflectType() == t.ReflectType() {
+		if e.Const() {
+			return c.exprValue(t, e.Value)
+		} else {
+			return c.Jit.Identity(exprFun(t, e.Fun), e)
+		}
 	}
 	rtype := t.ReflectType()
 	if e.Const() {
+		if reflect.IsCategory(e.Type.Kind(), xr.Int, xr.Uint, xr.Float64, xr.Complex128) &&
+			reflect.IsCategory(t.Kind(), xr.Int, xr.Uint, xr.Float64, xr.Complex128) {
+			// numeric constants must be exactly representable in the new type
+			return c.exprValue(t, untyped.ConvertLiteralCheckOverflow(e.Value, t))
+		}
 		val := convert(xr.ValueOf(e.Value), rtype).Interface()
 		return c.exprValue(t, val)
 	}
@@ -177,6 +185,10 @@ func (c *Comp) Converter(tin, tout xr.Type) func(xr.Value) xr.Value {
 	switch {
 	case rtin == rtout:
 		return nil
+	case xr.IsEmulatedInterface(tin) && rtout.Kind() == r.Interface:
+		// conversion from emulated interface to compiled interface:
+		// the latter must contain the concrete value, not the emulated interface
+		return c.converterFromInterface(tin, tout)
 	case rtin.ConvertibleTo(rtout):
 		// most conversions, including from compiled type to compiled interface
 		if rtin.Kind() != r.Interface {
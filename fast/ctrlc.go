@@ -0,0 +1,136 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * ctrlc.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cosmos72/gomacro/base"
+)
+
+// CtrlCExitDelay is the maximum delay between two Ctrl+C that exit the REPL, see Interp.CtrlC
+var CtrlCExitDelay = 2 * time.Second
+
+// returned by ctrlCReadline.Read if Ctrl+C was pressed while waiting for input
+var errReadInterrupted = errors.New("read interrupted by Ctrl+C")
+
+// ctrlC contains the state of Ctrl+C handling in Repl and ReplStdin
+type ctrlC struct {
+	mu          sync.Mutex
+	evaluating  bool      // true while ReadParseEvalPrint evaluates a statement
+	interrupted time.Time // when the evaluation in progress was interrupted. zero if not interrupted
+	idle        bool      // Ctrl+C pressed while waiting for input
+}
+
+// CtrlC handles Ctrl+C, i.e. the signal SIGINT, as Repl and ReplStdin do.
+// While evaluating, the first Ctrl+C interrupts the evaluation and the REPL continues;
+// a second Ctrl+C within CtrlCExitDelay invokes CompGlobals.CtrlCExit, which defaults to os.Exit(130):
+// useful if the evaluation is stuck in compiled code that cannot be interrupted.
+// While waiting for input, Ctrl+C discards the statement being typed.
+// If options OptDebugger and OptCtrlCEnterDebugger are set, Ctrl+C while evaluating enters the debugger instead
+func (ir *Interp) CtrlC(sig os.Signal) {
+	cg := ir.Comp.CompGlobals
+	c := &cg.ctrlC
+	c.mu.Lock()
+	if !c.evaluating {
+		c.idle = true
+		c.mu.Unlock()
+		return
+	}
+	const CtrlCDebug = base.OptDebugger | base.OptCtrlCEnterDebugger
+	now := time.Now()
+	exit := !c.interrupted.IsZero() && now.Sub(c.interrupted) < CtrlCExitDelay &&
+		cg.Options&CtrlCDebug != CtrlCDebug
+	c.interrupted = now
+	c.mu.Unlock()
+
+	if !exit {
+		ir.Interrupt(sig)
+		return
+	}
+	g := &cg.Globals
+	g.Fprintf(g.Stderr, "\n// interrupted twice, exiting\n")
+	if cg.CtrlCExit != nil {
+		cg.CtrlCExit()
+	} else {
+		os.Exit(130) // 128 + SIGINT, as shells do
+	}
+}
+
+// called by ReadParseEvalPrint before evaluating a statement
+func (c *ctrlC) beginEval() {
+	c.mu.Lock()
+	c.evaluating = true
+	c.interrupted = time.Time{}
+	c.idle = false
+	c.mu.Unlock()
+}
+
+// called by ReadParseEvalPrint after evaluating a statement.
+// Discards the interrupt requested by a Ctrl+C pressed after the evaluation completed
+func (c *ctrlC) endEval(run *Run) {
+	c.mu.Lock()
+	if !c.interrupted.IsZero() && run.Signals.Async == base.SigInterrupt {
+		run.Signals.Async = base.SigNone
+		run.clearInterrupt()
+	}
+	c.evaluating = false
+	c.interrupted = time.Time{}
+	c.mu.Unlock()
+}
+
+// return true if Ctrl+C was pressed while waiting for input, and forget it
+func (c *ctrlC) takeIdle() bool {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = false
+	c.mu.Unlock()
+	return idle
+}
+
+// ctrlCReadline wraps the Readline used by Repl and ReplStdin:
+// if Ctrl+C was pressed while reading a line, returns errReadInterrupted
+// and keeps the line for the next call to Read.
+//
+// Terminals in canonical mode already discard the characters typed before Ctrl+C,
+// thus the line contains only the characters typed after it: it starts a new statement.
+// Line editors that put the terminal in raw mode receive Ctrl+C as a character, not as SIGINT,
+// and clear the current line themselves
+type ctrlCReadline struct {
+	in      base.Readline
+	c       *ctrlC
+	pending bool // true if line and err must be returned by the next Read
+	line    []byte
+	err     error
+}
+
+func (r *ctrlCReadline) Read(prompt string) ([]byte, error) {
+	if r.pending {
+		line, err := r.line, r.err
+		r.pending, r.line, r.err = false, nil, nil
+		return line, err
+	}
+	line, err := r.in.Read(prompt)
+	if r.c.takeIdle() {
+		r.pending, r.line, r.err = true, line, err
+		return nil, errReadInterrupted
+	}
+	return line, err
+}
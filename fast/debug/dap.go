@@ -0,0 +1,757 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2018-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * dap.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/fast"
+	"github.com/cosmos72/gomacro/xreflect"
+)
+
+// DapServer implements the Debug Adapter Protocol
+// https://microsoft.github.io/debug-adapter-protocol/
+// on top of the interpreter single-stepping API, allowing VS Code and other DAP clients
+// to set breakpoints, step through interpreted code, inspect stack frames and variables.
+//
+// It also implements fast.Debugger: use it only with an *fast.Interp that has base.OptDebugger set.
+// Interpreted code always runs in the goroutine that called DapServer.Serve(),
+// while requests are read and answered by a separate goroutine.
+type DapServer struct {
+	interp  *fast.Interp
+	globals *base.Globals
+	in      *bufio.Reader
+	out     io.Writer
+	wlock   sync.Mutex // serializes writes to out
+	seq     int
+
+	launch chan dapLaunch // receives program to run after configurationDone
+	resume chan DebugOp   // receives how to resume after a stop
+	quit   chan struct{}  // closed on disconnect or when client closes the connection
+
+	lock        sync.Mutex // protects all the fields below
+	program     dapLaunch
+	breakpoints map[string]map[int]bool // file -> lines
+	stop        *dapStop                // non-nil while interpreted code is stopped
+	last        dapLine                 // where execution last stopped
+	stepOp      DebugOp                 // last op used to resume execution with next, stepIn or stepOut
+	stepping    bool
+	entry       bool // stop at first statement
+	pause       bool // stop at next statement
+	killed      bool
+}
+
+type dapLaunch struct {
+	Program     string `json:"program"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type dapLine struct {
+	env  *fast.Env
+	line int
+}
+
+// dapStop contains the state of stopped interpreted code
+type dapStop struct {
+	interp *fast.Interp // inner Interp, used to evaluate expressions without disturbing the code being debugged
+	env    *fast.Env
+	frames []dapFrame
+}
+
+// dapFrame is a stack frame: innermost *Env currently executing and *Env of function body.
+// fun is nil for toplevel code
+type dapFrame struct {
+	at, fun *fast.Env
+}
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Command    string      `json:"command"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapObject = map[string]interface{}
+
+// the only thread shown to clients: interpreted goroutines are not tracked yet
+const dapThreadID = 1
+
+var dapKilled interface{} = errors.New("debug adapter disconnected, killing interpreted code")
+
+// NewDapServer creates a DapServer that reads requests from in and writes responses and events to out.
+// It redirects the interpreter output to DAP "output" events
+func NewDapServer(ir *fast.Interp, in io.Reader, out io.Writer) *DapServer {
+	s := &DapServer{
+		interp:      ir,
+		globals:     &ir.Comp.Globals,
+		in:          bufio.NewReader(in),
+		out:         out,
+		launch:      make(chan dapLaunch, 1),
+		resume:      make(chan DebugOp),
+		quit:        make(chan struct{}),
+		breakpoints: make(map[string]map[int]bool),
+	}
+	g := s.globals
+	g.Stdout = s.Output("stdout")
+	g.Stderr = s.Output("stderr")
+	g.Options |= base.OptDebugger | base.OptCtrlCEnterDebugger
+	g.Options &^= base.OptShowPrompt | base.OptShowEval | base.OptShowEvalType
+	ir.SetDebugger(s)
+	return s
+}
+
+// Output returns an io.Writer that sends everything written to it
+// as DAP "output" events with specified category: "console", "stdout" or "stderr"
+func (s *DapServer) Output(category string) io.Writer {
+	return dapOutput{s, category}
+}
+
+type dapOutput struct {
+	s        *DapServer
+	category string
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.s.event("output", dapObject{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
+
+// Serve answers DAP requests until the client disconnects.
+// The program specified by the "launch" request is executed in the current goroutine
+func (s *DapServer) Serve() error {
+	go s.readLoop()
+
+	var program dapLaunch
+	select {
+	case program = <-s.launch:
+	case <-s.quit:
+		return nil
+	}
+	err := s.run(program.Program)
+	if err != nil {
+		s.globals.Fprintf(s.globals.Stderr, "%v\n", err)
+	}
+	if !s.isKilled() {
+		exitCode := 0
+		if err != nil {
+			exitCode = 1
+		}
+		s.event("exited", dapObject{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}
+	<-s.quit
+	return nil
+}
+
+// ============================== interpreted code =============================
+
+// run executes the program in the current goroutine, with single-stepping enabled
+func (s *DapServer) run(program string) error {
+	f, err := os.Open(program)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ir := s.interp
+	g := s.globals
+	g.Filepath = program
+	g.Line = 0
+	g.Readline = base.MakeBufReadline(bufio.NewReader(f))
+
+	for !s.isKilled() {
+		src, firstToken := ir.Read()
+		if firstToken < 0 {
+			if len(src) == 0 {
+				break // EOF
+			}
+			continue // comment-only lines
+		}
+		if err := s.eval(src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DapServer) eval(src string) (err error) {
+	g := s.globals
+	panicking := true
+	defer func() {
+		g.IncLine(src)
+		if panicking {
+			rec := recover()
+			if rec == dapKilled {
+				return
+			}
+			err = fmt.Errorf("%v", rec)
+		}
+	}()
+	s.interp.Debug(src)
+	panicking = false
+	return nil
+}
+
+// Breakpoint implements fast.Debugger. Invoked by "break" statements in interpreted code
+func (s *DapServer) Breakpoint(ir *fast.Interp, env *fast.Env) DebugOp {
+	if s.isKilled() {
+		return DebugOp{Panic: &dapKilled}
+	}
+	_, line := s.position(env)
+	return s.stopAt(ir, env, line, "breakpoint")
+}
+
+// At implements fast.Debugger. Invoked before executing each statement while single-stepping
+func (s *DapServer) At(ir *fast.Interp, env *fast.Env) DebugOp {
+	if env.IP >= len(env.DebugPos) {
+		// end of code: the final statement only returns if single-stepping is disabled
+		return DebugOpContinue
+	}
+	file, line := s.position(env)
+	if line == 0 {
+		// skip synthetic statements
+		return DebugOp{Depth: env.Run.DebugDepth}
+	}
+	s.lock.Lock()
+	same := env == s.last.env && line == s.last.line
+	if !same {
+		s.last = dapLine{}
+	}
+	var reason string
+	switch {
+	case s.killed:
+		s.lock.Unlock()
+		return DebugOp{Panic: &dapKilled}
+	case s.pause:
+		reason = "pause"
+	case s.entry:
+		reason = "entry"
+	case same:
+		// still executing the line where we stopped
+	case s.stepping:
+		reason = "step"
+	case s.breakpoints[file][line]:
+		reason = "breakpoint"
+	}
+	if len(reason) == 0 {
+		op := s.runOp()
+		s.lock.Unlock()
+		return op
+	}
+	s.lock.Unlock()
+	return s.stopAt(ir, env, line, reason)
+}
+
+// return the DebugOp to resume execution without stopping at current statement.
+// must be called with s.lock held
+func (s *DapServer) runOp() DebugOp {
+	if s.stepping {
+		return s.stepOp
+	} else if len(s.breakpoints) != 0 {
+		// keep calling At() to check for breakpoints
+		return DebugOpStep
+	}
+	return DebugOpContinue
+}
+
+// stopAt notifies the client that execution stopped, then waits until it is resumed
+func (s *DapServer) stopAt(ir *fast.Interp, env *fast.Env, line int, reason string) DebugOp {
+	stop := &dapStop{
+		// create an inner Interp to preserve existing Binds, compiled Code and IP
+		interp: fast.NewInnerInterp(ir, "debug", "debug"),
+		env:    env,
+		frames: dapFrames(env),
+	}
+	s.lock.Lock()
+	s.stop = stop
+	s.last = dapLine{env, line}
+	s.entry = false
+	s.pause = false
+	s.lock.Unlock()
+
+	s.event("stopped", dapObject{"reason": reason, "threadId": dapThreadID, "allThreadsStopped": true})
+	select {
+	case op := <-s.resume:
+		return op
+	case <-s.quit:
+		return DebugOp{Panic: &dapKilled}
+	}
+}
+
+// return the source file and line of the statement about to be executed in env
+func (s *DapServer) position(env *fast.Env) (string, int) {
+	ip := env.IP
+	g := s.globals
+	if ip < 0 || ip >= len(env.DebugPos) || g.Fileset == nil {
+		return "", 0
+	}
+	p := env.DebugPos[ip]
+	if p == token.NoPos {
+		return "", 0
+	}
+	pos := g.Fileset.Position(p)
+	return filepath.Clean(pos.Filename), pos.Line
+}
+
+// collect the stack frames of env, innermost first
+func dapFrames(env *fast.Env) []dapFrame {
+	var frames []dapFrame
+	at := env
+	for env != nil {
+		if env.Caller != nil {
+			// function body
+			frames = append(frames, dapFrame{at: at, fun: env})
+			env = env.Caller
+			at = env
+		} else {
+			// nested env
+			env = env.Outer
+		}
+	}
+	return append(frames, dapFrame{at: at})
+}
+
+func (s *DapServer) isKilled() bool {
+	s.lock.Lock()
+	killed := s.killed
+	s.lock.Unlock()
+	return killed
+}
+
+// ================================= protocol ==================================
+
+func (s *DapServer) readLoop() {
+	defer s.kill()
+	for {
+		req, err := s.read()
+		if err != nil {
+			if err != io.EOF {
+				s.globals.Fprintf(os.Stderr, "// gomacro dap: %v\n", err)
+			}
+			return
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if !s.dispatch(req) {
+			return
+		}
+	}
+}
+
+// read a single message, prefixed by "Content-Length: NNN\r\n\r\n"
+func (s *DapServer) read() (*dapRequest, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			if length >= 0 {
+				break
+			}
+			continue
+		}
+		const header = "Content-Length:"
+		if strings.HasPrefix(line, header) {
+			length, err = strconv.Atoi(strings.TrimSpace(line[len(header):]))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid header: %q", line)
+			}
+		}
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(s.in, buf); err != nil {
+		return nil, err
+	}
+	var req dapRequest
+	if err := json.Unmarshal(buf, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *DapServer) send(msg interface{}) {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+	switch msg := msg.(type) {
+	case *dapResponse:
+		s.seq++
+		msg.Seq = s.seq
+	case *dapEvent:
+		s.seq++
+		msg.Seq = s.seq
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(buf))
+	s.out.Write(buf)
+}
+
+func (s *DapServer) respond(req *dapRequest, body interface{}) {
+	s.send(&dapResponse{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: true, Body: body})
+}
+
+func (s *DapServer) respondError(req *dapRequest, format string, args ...interface{}) {
+	s.send(&dapResponse{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: fmt.Sprintf(format, args...)})
+}
+
+func (s *DapServer) event(event string, body interface{}) {
+	s.send(&dapEvent{Type: "event", Event: event, Body: body})
+}
+
+// dispatch executes a request. returns false on disconnect
+func (s *DapServer) dispatch(req *dapRequest) bool {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, dapObject{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		})
+		s.event("initialized", nil)
+	case "launch":
+		var args dapLaunch
+		if err := json.Unmarshal(req.Arguments, &args); err != nil || len(args.Program) == 0 {
+			s.respondError(req, "launch: missing program")
+			break
+		}
+		if abs, err := filepath.Abs(args.Program); err == nil {
+			args.Program = abs
+		}
+		s.lock.Lock()
+		s.program = args
+		s.entry = args.StopOnEntry
+		s.lock.Unlock()
+		s.respond(req, nil)
+	case "setBreakpoints":
+		s.setBreakpoints(req)
+	case "setExceptionBreakpoints":
+		s.respond(req, dapObject{"breakpoints": []dapObject{}})
+	case "configurationDone":
+		s.lock.Lock()
+		program := s.program
+		s.lock.Unlock()
+		s.respond(req, nil)
+		if len(program.Program) != 0 {
+			s.launch <- program
+		}
+	case "threads":
+		s.respond(req, dapObject{"threads": []dapObject{{"id": dapThreadID, "name": "main"}}})
+	case "stackTrace":
+		s.stackTrace(req)
+	case "scopes":
+		s.scopes(req)
+	case "variables":
+		s.variables(req)
+	case "evaluate":
+		s.evaluate(req)
+	case "continue", "next", "stepIn", "stepOut":
+		s.resumeWith(req)
+	case "pause":
+		s.lock.Lock()
+		s.pause = true
+		s.lock.Unlock()
+		s.interp.Interrupt(os.Interrupt)
+		s.respond(req, nil)
+	case "disconnect", "terminate":
+		s.respond(req, nil)
+		return false
+	default:
+		s.respondError(req, "unsupported request %q", req.Command)
+	}
+	return true
+}
+
+// kill terminates interpreted code and signals Serve() to return
+func (s *DapServer) kill() {
+	s.lock.Lock()
+	s.killed = true
+	running := s.stop == nil
+	s.lock.Unlock()
+	if running {
+		// reach the next statement as soon as possible
+		s.interp.Interrupt(os.Interrupt)
+	}
+	close(s.quit)
+}
+
+func (s *DapServer) setBreakpoints(req *dapRequest) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.respondError(req, "setBreakpoints: %v", err)
+		return
+	}
+	file := filepath.Clean(args.Source.Path)
+	lines := make(map[int]bool)
+	result := make([]dapObject, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		lines[bp.Line] = true
+		result[i] = dapObject{"verified": true, "line": bp.Line}
+	}
+	s.lock.Lock()
+	if len(lines) == 0 {
+		delete(s.breakpoints, file)
+	} else {
+		s.breakpoints[file] = lines
+	}
+	s.lock.Unlock()
+	s.respond(req, dapObject{"breakpoints": result})
+}
+
+func (s *DapServer) resumeWith(req *dapRequest) {
+	s.lock.Lock()
+	stop := s.stop
+	if stop == nil {
+		s.lock.Unlock()
+		s.respondError(req, "%s: program is not stopped", req.Command)
+		return
+	}
+	var op DebugOp
+	depth := stop.env.CallDepth
+	switch req.Command {
+	case "continue":
+		op = DebugOpContinue
+		s.stepping = false
+	case "next":
+		op = DebugOp{Depth: depth + 1}
+		s.stepping = true
+	case "stepIn":
+		op = DebugOpStep
+		s.stepping = true
+	case "stepOut":
+		op = DebugOp{Depth: depth}
+		s.stepping = true
+	}
+	s.stepOp = op
+	if !s.stepping {
+		op = s.runOp()
+	}
+	s.stop = nil
+	s.lock.Unlock()
+
+	if req.Command == "continue" {
+		s.respond(req, dapObject{"allThreadsContinued": true})
+	} else {
+		s.respond(req, nil)
+	}
+	s.resume <- op
+}
+
+// return current stop, or nil after sending an error response
+func (s *DapServer) stopped(req *dapRequest) *dapStop {
+	s.lock.Lock()
+	stop := s.stop
+	s.lock.Unlock()
+	if stop == nil {
+		s.respondError(req, "%s: program is not stopped", req.Command)
+	}
+	return stop
+}
+
+func (s *DapServer) stackTrace(req *dapRequest) {
+	stop := s.stopped(req)
+	if stop == nil {
+		return
+	}
+	frames := make([]dapObject, len(stop.frames))
+	for i, frame := range stop.frames {
+		name := "main"
+		if frame.fun != nil {
+			if c := frame.fun.DebugComp; c != nil && c.FuncMaker != nil {
+				name = c.FuncMaker.Name
+			} else {
+				name = "???"
+			}
+		}
+		obj := dapObject{"id": i, "name": name, "line": 0, "column": 0}
+		if pos, ok := s.framePosition(frame.at); ok {
+			obj["line"] = pos.Line
+			obj["column"] = pos.Column
+			obj["source"] = dapObject{"name": filepath.Base(pos.Filename), "path": pos.Filename}
+		}
+		frames[i] = obj
+	}
+	s.respond(req, dapObject{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+func (s *DapServer) framePosition(env *fast.Env) (token.Position, bool) {
+	ip := env.IP
+	g := s.globals
+	if ip < 0 || ip >= len(env.DebugPos) || g.Fileset == nil || env.DebugPos[ip] == token.NoPos {
+		return token.Position{}, false
+	}
+	return g.Fileset.Position(env.DebugPos[ip]), true
+}
+
+// variablesReference 2*frame+1 are local variables, 2*frame+2 are global variables
+func (s *DapServer) scopes(req *dapRequest) {
+	var args struct {
+		FrameId int `json:"frameId"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+	s.respond(req, dapObject{"scopes": []dapObject{
+		{"name": "Locals", "variablesReference": 2*args.FrameId + 1, "expensive": false},
+		{"name": "Globals", "variablesReference": 2*args.FrameId + 2, "expensive": true},
+	}})
+}
+
+func (s *DapServer) variables(req *dapRequest) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+	stop := s.stopped(req)
+	if stop == nil {
+		return
+	}
+	i := (args.VariablesReference - 1) / 2
+	if i < 0 || i >= len(stop.frames) {
+		s.respondError(req, "variables: invalid reference %d", args.VariablesReference)
+		return
+	}
+	frame := stop.frames[i]
+	var envs []*fast.Env
+	if args.VariablesReference%2 == 0 {
+		envs = append(envs, frame.at.FileEnv)
+	} else {
+		for env := frame.at; env != nil && env != env.FileEnv; env = env.Outer {
+			envs = append(envs, env)
+			if env == frame.fun {
+				break
+			}
+		}
+	}
+	vars := []dapObject{}
+	for _, env := range envs {
+		vars = append(vars, s.envVariables(env)...)
+	}
+	s.respond(req, dapObject{"variables": vars})
+}
+
+func (s *DapServer) envVariables(env *fast.Env) []dapObject {
+	if env == nil || env.DebugComp == nil {
+		return nil
+	}
+	c := env.DebugComp
+	binds := make([]*fast.Bind, 0, len(c.Binds))
+	for _, bind := range c.Binds {
+		if name := bind.Name; name != "_" && !strings.HasPrefix(name, base.StrGensym) {
+			binds = append(binds, bind)
+		}
+	}
+	sort.Slice(binds, func(i, j int) bool {
+		return binds[i].Name < binds[j].Name
+	})
+	g := c.CompGlobals
+	vars := make([]dapObject, len(binds))
+	for i, bind := range binds {
+		vars[i] = dapObject{
+			"name":               bind.Name,
+			"value":              s.format(bind.RuntimeValue(g, env)),
+			"type":               s.globals.Sprintf("%v", bind.Type),
+			"variablesReference": 0,
+		}
+	}
+	return vars
+}
+
+func (s *DapServer) evaluate(req *dapRequest) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+	stop := s.stopped(req)
+	if stop == nil {
+		return
+	}
+	result, err := s.eval1(stop, args.Expression)
+	if err != nil {
+		s.respondError(req, "%v", err)
+		return
+	}
+	s.respond(req, dapObject{"result": result, "variablesReference": 0})
+}
+
+// evaluate an expression in the scope where execution stopped
+func (s *DapServer) eval1(stop *dapStop, src string) (result string, err error) {
+	// do NOT debug expression evaluated by the client!
+	sig := &stop.env.Run.Signals
+	sigdebug := sig.Debug
+	sig.Debug = base.SigNone
+
+	defer func() {
+		sig.Debug = sigdebug
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%v", rec)
+		}
+	}()
+	vals, _ := stop.interp.Eval(src)
+	strs := make([]string, len(vals))
+	for i, val := range vals {
+		strs[i] = s.format(val)
+	}
+	return strings.Join(strs, ", "), nil
+}
+
+func (s *DapServer) format(value xreflect.Value) string {
+	if !value.IsValid() {
+		return "nil"
+	} else if value.CanInterface() {
+		return s.globals.Sprintf("%v", value.Interface())
+	}
+	return s.globals.Sprintf("%v", value)
+}
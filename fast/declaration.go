@@ -48,9 +48,7 @@ func (c *Comp) Decl(node ast.Decl) {
 func (c *Comp) GenDecl(node *ast.GenDecl) {
 	switch node.Tok {
 	case token.IMPORT:
-		for _, decl := range node.Specs {
-			c.Import(decl)
-		}
+		c.ImportGroup(node.Specs)
 	case token.CONST:
 		var defaultType ast.Expr
 		var defaultExprs []ast.Expr
@@ -76,6 +74,7 @@ func (c *Comp) GenDecl(node *ast.GenDecl) {
 			c.DeclType(decl)
 		}
 	case token.VAR:
+		moveEmbedDoc(node)
 		for _, decl := range node.Specs {
 			c.DeclVars(decl)
 		}
@@ -174,8 +173,14 @@ func (c *Comp) DeclVars(node ast.Spec) {
 	c.Pos = node.Pos()
 	switch node := node.(type) {
 	case *ast.ValueSpec:
+		if patterns := embedPatterns(node.Doc); patterns != nil {
+			c.declEmbed(node, patterns)
+			return
+		}
 		names, t, inits := c.prepareDeclConstsOrVars(toStrings(node.Names), node.Type, node.Values)
-		c.DeclVars0(names, t, inits, toPos(node.Names))
+		pos := toPos(node.Names)
+		c.DeclVars0(names, t, inits, pos)
+		c.noteDeclaredVars(names, pos, nil)
 	default:
 		c.Errorf("unsupported variable declaration: expecting <*ast.ValueSpec>, found: %v <%v>", node, r.TypeOf(node))
 	}
@@ -198,7 +203,9 @@ func (c *Comp) DeclVarsShort(lhs []ast.Expr, rhs []ast.Expr) {
 		}
 	}
 	_, t, inits := c.prepareDeclConstsOrVars(names, nil, rhs)
+	redeclared := c.redeclaredVars(names)
 	c.DeclVars0(names, t, inits, pos)
+	c.noteDeclaredVars(names, pos, redeclared)
 }
 
 func toStrings(idents []*ast.Ident) []string {
@@ -224,7 +231,13 @@ func (c *Comp) prepareDeclConstsOrVars(names []string, typ ast.Expr, exprs []ast
 	if typ != nil {
 		t = c.Type(typ)
 	}
-	if exprs != nil {
+	if exprs != nil && t != nil && len(exprs) == n {
+		// pass the declared type to lambdas and shifts, they need it to infer types
+		inits = make([]*Expr, n)
+		for i, expr := range exprs {
+			inits[i] = c.expr1(expr, exprHint(expr, t))
+		}
+	} else if exprs != nil {
 		inits = c.ExprsMultipleValues(exprs, n)
 	}
 	return names, t, inits
@@ -337,7 +350,10 @@ func (c *CompBinds) NewBind(o *base.Output, name string, class BindClass, t xr.T
 	} else if bind := c.Binds[name]; bind != nil {
 		o.Warnf("redefined identifier: %v", name)
 		oldclass := bind.Desc.Class()
-		if (oldclass == IntBind) == (class == IntBind) {
+		if class == FuncBind && (oldclass != FuncBind || !bind.Type.IdenticalTo(t)) {
+			// functions compiled before the redefinition may call the old function:
+			// do not reuse its slot, they expect a function with the old type
+		} else if (oldclass == IntBind) == (class == IntBind) {
 			// both are IntBind, or neither is.
 			if bind.Type.Kind() == r.Complex128 || t.Kind() != r.Complex128 {
 				// the new bind occupies fewer slots than the old one,
@@ -352,11 +368,17 @@ func (c *CompBinds) NewBind(o *base.Output, name string, class BindClass, t xr.T
 	case ConstBind, GenericFuncBind:
 		index = NoIndex
 	default: // case FuncBind, VarBind:
+		if index == NoIndex {
+			index = c.reuseFreeBind(class, t)
+		}
 		if index == NoIndex {
 			index = c.BindNum
 			c.BindNum++
 		}
 	case IntBind:
+		if index == NoIndex {
+			index = c.reuseFreeBind(class, t)
+		}
 		if index == NoIndex {
 			index = c.IntBindNum
 			c.IntBindNum++
@@ -375,6 +397,27 @@ func (c *CompBinds) NewBind(o *base.Output, name string, class BindClass, t xr.T
 	return bind
 }
 
+// return the index of a slot released by Interp.Bind that can store a bind with specified class and type,
+// and remove it from c.freeBinds. Return NoIndex if there is none
+func (c *CompBinds) reuseFreeBind(class BindClass, t xr.Type) int {
+	for i, bind := range c.freeBinds {
+		// same type also means same number of IntBind slots
+		if bind.Desc.Class() == class && bind.Type.IdenticalTo(t) {
+			c.freeBinds = append(c.freeBinds[:i], c.freeBinds[i+1:]...)
+			return bind.Desc.Index()
+		}
+	}
+	return NoIndex
+}
+
+// if bind was declared by Interp.Bind, record that it is referenced
+// by code that may outlive the binding: its slot must not be zeroed nor reused
+func (c *CompBinds) captureScopedBind(bind *Bind) {
+	if captured, ok := c.scopedBinds[bind.Desc]; ok && !captured {
+		c.scopedBinds[bind.Desc] = true
+	}
+}
+
 func (c *Comp) declUnnamedBind(init *Expr, o *Comp, upn int) *Symbol {
 	t := init.Type
 	bind := o.NewBind("", VarBind, t)
@@ -471,6 +514,7 @@ func (c *Comp) DeclVar0(name string, t xr.Type, init *Expr) *Bind {
 		va := bind.AsVar(0, PlaceSettable)
 		c.SetVar(va, token.ASSIGN, init)
 	case VarBind:
+		c.noteConcreteType(bind, init)
 		index := desc.Index()
 		if index == NoIndex && init != nil {
 			// assigning a constant or expression to _
@@ -487,6 +531,7 @@ func (c *Comp) DeclVar0(name string, t xr.Type, init *Expr) *Bind {
 				env.IP++
 				return env.Code[env.IP], env
 			})
+			c.recordWrite(bind.AsVar(0, PlaceSettable))
 			return bind
 		}
 		if init.Const() {
@@ -543,6 +588,7 @@ func (c *Comp) DeclVar0(name string, t xr.Type, init *Expr) *Bind {
 			}
 		}
 		c.append(ret)
+		c.recordWrite(bind.AsVar(0, PlaceSettable))
 	}
 	return bind
 }
@@ -615,7 +661,7 @@ func (c *Comp) DeclMultiVar0(names []string, t xr.Type, init *Expr, pos []token.
 			}
 		}
 		bind := c.NewBind(name, VarBind, ti)
-		decls[i] = c.DeclBindRuntimeValue(bind)
+		decls[i] = c.recordWriteValue(bind.AsVar(0, PlaceSettable), c.DeclBindRuntimeValue(bind))
 	}
 	fun := init.AsXV(COptDefaults)
 	if npos != 0 {
@@ -0,0 +1,284 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * derive.go
+ *
+ *  Created on: Oct 15, 2026
+ *      Author: Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+
+	. "github.com/cosmos72/gomacro/ast2"
+	"github.com/cosmos72/gomacro/base"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// ================================ derive =====================================
+
+// the interfaces that macro 'derive' knows how to implement
+var deriveMakers = map[string]func(d *deriver, buf *bytes.Buffer){
+	"Equal":    (*deriver).equal,
+	"JSON":     (*deriver).json,
+	"Stringer": (*deriver).stringer,
+}
+
+// deriver generates the methods for a single type declaration
+type deriver struct {
+	c       *Comp
+	name    string        // name of declared type
+	typ     ast.Expr      // underlying type
+	under   string        // source code of underlying type
+	fields  []deriveField // nil if underlying type is not a struct
+	isstrct bool
+	pkg     map[string]string // package path -> gensym'd import name
+}
+
+type deriveField struct {
+	name       string
+	comparable bool
+}
+
+// addDerive declares the macro 'derive', which generates method implementations
+// for common interfaces starting from a type declaration. Usage:
+//
+//	derive; Stringer; type Point struct { X, Y int }
+//	derive; {Stringer; Equal; JSON}; type Point struct { X, Y int }
+//
+// Stringer generates String(), Equal generates Equal(T) and JSON generates
+// MarshalJSON() and UnmarshalJSON(). Field types are inspected at macroexpansion time,
+// and fields that are not comparable are compared with reflect.DeepEqual()
+func (ir *Interp) addDerive() {
+	c := ir.Comp
+	bind := c.NewBind("derive", ConstBind, c.TypeOfMacro())
+	bind.Value = Macro{c.CompGlobals.macroDerive, 2}
+}
+
+func (g *CompGlobals) macroDerive(args []xr.Value) []xr.Value {
+	c := g.macroComp
+	if c == nil {
+		g.Errorf("derive: macro invoked outside macroexpansion")
+	}
+	names := deriveNames(c, args[0].Interface())
+	var decl *ast.GenDecl
+	switch node := args[1].Interface().(type) {
+	case *ast.GenDecl:
+		if node.Tok == token.TYPE {
+			decl = node
+		}
+	case *ast.TypeSpec:
+		// macroexpansion unwraps declarations containing a single spec
+		decl = &ast.GenDecl{Tok: token.TYPE, TokPos: node.Pos(), Specs: []ast.Spec{node}}
+	}
+	if decl == nil {
+		c.Errorf("derive: expecting type declaration, found %v", args[1].Interface())
+		return nil
+	}
+	var buf bytes.Buffer
+	pkg := make(map[string]string)
+	for _, spec := range decl.Specs {
+		d := newDeriver(c, spec.(*ast.TypeSpec), pkg)
+		for _, name := range names {
+			deriveMakers[name](d, &buf)
+		}
+	}
+	var head bytes.Buffer
+	paths := make([]string, 0, len(pkg))
+	for path := range pkg {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if alias := pkg[path]; c.TryResolve(alias) == nil {
+			c.Fprintf(&head, "import %s %q\n", alias, path)
+		}
+	}
+	head.Write(buf.Bytes())
+
+	// output the original type declaration, followed by the generated imports and methods.
+	// wrap *ast.GenDecl into *ast.DeclStmt, otherwise macroexpansion would split it into its specs
+	nodes := append([]ast.Node{decl}, c.ParseBytes(head.Bytes())...)
+	results := make([]xr.Value, len(nodes))
+	for i, node := range nodes {
+		if decl, ok := node.(*ast.GenDecl); ok {
+			node = &ast.DeclStmt{Decl: decl}
+		}
+		results[i] = xr.ValueOf(node)
+	}
+	return results
+}
+
+// deriveNames extracts the names of interfaces to derive from
+// an identifier or a block of identifiers
+func deriveNames(c *Comp, arg interface{}) []string {
+	form := base.UnwrapTrivialAst(AnyToAst(arg, "derive"))
+	var nodes []Ast
+	if block, ok := form.(BlockStmt); ok {
+		for i, n := 0, block.Size(); i < n; i++ {
+			nodes = append(nodes, base.UnwrapTrivialAst(block.Get(i)))
+		}
+	} else {
+		nodes = []Ast{form}
+	}
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		ident, ok := node.(Ident)
+		if !ok {
+			c.Errorf("derive: expecting interface name, found %v", node.Interface())
+		}
+		name := ident.X.Name
+		if deriveMakers[name] == nil {
+			c.Errorf("derive: unsupported interface %q, expecting one of: Equal JSON Stringer", name)
+		}
+		names[i] = name
+	}
+	return names
+}
+
+func newDeriver(c *Comp, spec *ast.TypeSpec, pkg map[string]string) *deriver {
+	if spec.Assign != token.NoPos {
+		c.Errorf("derive: cannot add methods to type alias %v", spec.Name)
+	}
+	d := &deriver{
+		c:     c,
+		name:  spec.Name.Name,
+		typ:   spec.Type,
+		under: c.Sprintf("%v", spec.Type),
+		pkg:   pkg,
+	}
+	if st, ok := spec.Type.(*ast.StructType); ok {
+		d.isstrct = true
+		for _, field := range st.Fields.List {
+			comparable := d.comparable(field.Type)
+			if len(field.Names) == 0 {
+				d.fields = append(d.fields, deriveField{embeddedFieldName(field.Type), comparable})
+				continue
+			}
+			for _, ident := range field.Names {
+				if ident.Name != "_" {
+					d.fields = append(d.fields, deriveField{ident.Name, comparable})
+				}
+			}
+		}
+	}
+	return d
+}
+
+// comparable uses the static type information available at macroexpansion time
+// to decide whether values of type 'node' can be compared with ==
+// If the type cannot be compiled yet, for example because it refers
+// to the type being declared, conservatively returns false
+func (d *deriver) comparable(node ast.Expr) (ok bool) {
+	panicking := true
+	defer func() {
+		if panicking {
+			recover()
+			ok = false
+		}
+	}()
+	t := d.c.Type(node)
+	panicking = false
+	return t != nil && t.Comparable()
+}
+
+// return the name of an embedded field
+func embeddedFieldName(node ast.Expr) string {
+	for {
+		switch expr := node.(type) {
+		case *ast.StarExpr:
+			node = expr.X
+			continue
+		case *ast.SelectorExpr:
+			return expr.Sel.Name
+		case *ast.Ident:
+			return expr.Name
+		}
+		return "_"
+	}
+}
+
+// return the gensym'd name of an import
+func (d *deriver) importName(path string) string {
+	name, ok := d.pkg[path]
+	if !ok {
+		name = base.StrGensym + "derive_" + strings.Replace(path, "/", "_", -1)
+		d.pkg[path] = name
+	}
+	return name
+}
+
+func (d *deriver) stringer(buf *bytes.Buffer) {
+	fmt := d.importName("fmt")
+	d.c.Fprintf(buf, "func (x %s) String() string {\n", d.name)
+	if !d.isstrct {
+		d.c.Fprintf(buf, "\treturn %s.Sprint((%s)(x))\n}\n", fmt, d.under)
+		return
+	}
+	format := make([]string, 0, len(d.fields))
+	args := make([]string, 0, len(d.fields))
+	for _, field := range d.fields {
+		if field.name == "_" {
+			continue
+		}
+		format = append(format, field.name+":%v")
+		args = append(args, ", x."+field.name)
+	}
+	d.c.Fprintf(buf, "\treturn %s.Sprintf(%q%s)\n}\n", fmt, d.name+"{"+strings.Join(format, " ")+"}", strings.Join(args, ""))
+}
+
+func (d *deriver) equal(buf *bytes.Buffer) {
+	d.c.Fprintf(buf, "func (x %s) Equal(y %s) bool {\n", d.name, d.name)
+	if !d.isstrct {
+		if d.comparable(d.typ) {
+			d.c.Fprintf(buf, "\treturn x == y\n}\n")
+		} else {
+			d.c.Fprintf(buf, "\treturn %s.DeepEqual(x, y)\n}\n", d.importName("reflect"))
+		}
+		return
+	}
+	terms := make([]string, 0, len(d.fields))
+	for _, field := range d.fields {
+		if field.name == "_" {
+			continue
+		} else if field.comparable {
+			terms = append(terms, "x."+field.name+" == y."+field.name)
+		} else {
+			terms = append(terms, d.importName("reflect")+".DeepEqual(x."+field.name+", y."+field.name+")")
+		}
+	}
+	if len(terms) == 0 {
+		terms = append(terms, "true")
+	}
+	d.c.Fprintf(buf, "\treturn %s\n}\n", strings.Join(terms, " &&\n\t\t"))
+}
+
+func (d *deriver) json(buf *bytes.Buffer) {
+	json := d.importName("encoding/json")
+	// convert to the underlying type, to avoid infinite recursion
+	d.c.Fprintf(buf, `func (x %s) MarshalJSON() ([]byte, error) {
+	return %s.Marshal((%s)(x))
+}
+func (x *%s) UnmarshalJSON(data []byte) error {
+	var y %s
+	err := %s.Unmarshal(data, &y)
+	if err == nil {
+		*x = %s(y)
+	}
+	return err
+}
+`, d.name, json, d.under, d.name, d.under, json, d.name)
+}
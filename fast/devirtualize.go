@@ -0,0 +1,245 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * devirtualize.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/base/reflect"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// noteConcreteType records the static type of init, assigned to the variable bind
+// declared in c. Used by devirtualizeCall() to guess the concrete type of interface variables:
+// a variable only assigned values of a single concrete type is monomorphic.
+// Must be called before converting init to the variable type
+func (c *Comp) noteConcreteType(bind *Bind, init *Expr) {
+	if bind == nil || bind.Type == nil || bind.Type.Kind() != r.Interface || bind.Desc.Index() == NoIndex {
+		return
+	}
+	var t xr.Type
+	if init != nil && !init.Const() && init.NumOut() == 1 && init.Type != nil && init.Type.Kind() != r.Interface {
+		t = init.Type
+	}
+	if c.concrete == nil {
+		c.concrete = make(map[*Bind]xr.Type)
+	}
+	if old, ok := c.concrete[bind]; !ok {
+		c.concrete[bind] = t
+	} else if old != nil && (t == nil || !old.IdenticalTo(t)) {
+		// polymorphic: forget the type forever
+		c.concrete[bind] = nil
+	}
+}
+
+// noteConcreteTypeVar is the equivalent of noteConcreteType() for assignments to va
+func (c *Comp) noteConcreteTypeVar(va *Var, init *Expr) {
+	if va.Type == nil || va.Type.Kind() != r.Interface {
+		return
+	}
+	if sym, outer := c.tryResolve(va.Name); sym != nil && sym.Desc == va.Desc {
+		outer.noteConcreteType(outer.Binds[va.Name], init)
+	}
+}
+
+// devirtualizeCall compiles x.Method(args...), where x is a variable of compiled interface type
+// only assigned values of a single concrete type, as a direct call to the method
+// declared by interpreted code for such type, skipping the proxy used for interface dispatch.
+//
+// The concrete type is checked at runtime: if it differs, for example because x
+// is assigned a different type after the call is compiled, the call falls back to interface dispatch.
+// Returns nil if the call cannot be devirtualized
+func (c *Comp) devirtualizeCall(node *ast.CallExpr, call *Call) *Expr {
+	if call.Builtin {
+		return nil
+	}
+	sel, ok := node.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	sym, outer := c.tryResolve(ident.Name)
+	if sym == nil || sym.Desc.Class() != VarBind || sym.Type == nil || sym.Type.Kind() != r.Interface {
+		return nil
+	}
+	tconc := outer.concrete[outer.Binds[ident.Name]]
+	if tconc == nil {
+		return nil
+	}
+	tin := sym.Type
+	if xr.IsEmulatedInterface(tin) {
+		// interfaces declared by interpreted code already store the methods
+		// of their concrete value as ready-to-call closures: dispatch is cheap
+		return nil
+	}
+	imtd, in := c.LookupMethod(tin, sel.Sel.Name)
+	mtd, n := c.LookupMethod(tconc, sel.Sel.Name)
+	if in != 1 || n != 1 || len(mtd.FieldIndex) != 0 || mtd.Funs == nil || !isInterpretedMethod(tconc, mtd) {
+		return nil
+	}
+	if call.Fun.Type.IsVariadic() && !call.Ellipsis {
+		// variadic arguments are packed by call_any()
+		return nil
+	}
+	for _, arg := range call.Args {
+		if arg.NumOut() != 1 {
+			return nil
+		}
+	}
+	_, _, addressof, deref := c.computeMethodFieldIndex(tconc, mtd)
+	if addressof {
+		return nil
+	}
+	objfun := c.Symbol(sym).AsX1()
+	extractor := c.extractor(tin)
+	getmethod := c.compileObjGetMethod(tin, imtd)
+	argfuns := call.MakeArgfunsX1()
+	funs, index := mtd.Funs, mtd.Index
+	rtconc := tconc.ReflectType()
+	callf := callxr
+	if call.Ellipsis {
+		callf = callslicexr
+	}
+	fun := func(env *Env) []xr.Value {
+		obj := objfun(env)
+		var fun xr.Value
+		args := make([]xr.Value, len(argfuns)+1)
+		if v, t := extractor(obj); t != nil && reflect.ValueType(v) == rtconc && t.IdenticalTo(tconc) {
+			fun = xr.MakeValue((*funs)[index])
+			if deref {
+				args[0] = v.Elem()
+			} else {
+				args[0] = copyReceiver(v)
+			}
+		} else {
+			// not the expected concrete type, use interface dispatch.
+			// extract the method before evaluating the arguments, as compiled Go does
+			fun = getmethod(obj)
+			args = args[1:]
+		}
+		for i, argfun := range argfuns {
+			args[len(args)-len(argfuns)+i] = argfun(env)
+		}
+		return callf(fun, args)
+	}
+	tout := call.OutTypes
+	switch len(tout) {
+	case 0:
+		return expr0(func(env *Env) {
+			fun(env)
+		})
+	case 1:
+		return exprFun(tout[0], unwrapX1(tout[0], func(env *Env) xr.Value {
+			return fun(env)[0]
+		}))
+	default:
+		return exprXV(tout, func(env *Env) (xr.Value, []xr.Value) {
+			rets := fun(env)
+			return rets[0], rets
+		})
+	}
+}
+
+// return true if mtd is declared by interpreted code, i.e. not available via reflect
+func isInterpretedMethod(t xr.Type, mtd xr.Method) bool {
+	rtype := t.ReflectType()
+	rmtd, ok := rtype.MethodByName(mtd.Name)
+	return !ok || xr.QName1(t) != xr.QName1(rtype) || rmtd.Type != mtd.Type.ReflectType()
+}
+
+// mandatory optimization: fast_interpreter ASSUMES that expressions
+// returning bool, int, uint, float, complex, string do NOT wrap them in reflect.Value
+func unwrapX1(t xr.Type, fun func(*Env) xr.Value) I {
+	var ret I
+	switch t.Kind() {
+	case xr.Bool:
+		ret = func(env *Env) bool {
+			return fun(env).Bool()
+		}
+	case xr.Int:
+		ret = func(env *Env) int {
+			return int(fun(env).Int())
+		}
+	case xr.Int8:
+		ret = func(env *Env) int8 {
+			return int8(fun(env).Int())
+		}
+	case xr.Int16:
+		ret = func(env *Env) int16 {
+			return int16(fun(env).Int())
+		}
+	case xr.Int32:
+		ret = func(env *Env) int32 {
+			return int32(fun(env).Int())
+		}
+	case xr.Int64:
+		ret = func(env *Env) int64 {
+			return fun(env).Int()
+		}
+	case xr.Uint:
+		ret = func(env *Env) uint {
+			return uint(fun(env).Uint())
+		}
+	case xr.Uint8:
+		ret = func(env *Env) uint8 {
+			return uint8(fun(env).Uint())
+		}
+	case xr.Uint16:
+		ret = func(env *Env) uint16 {
+			return uint16(fun(env).Uint())
+		}
+	case xr.Uint32:
+		ret = func(env *Env) uint32 {
+			return uint32(fun(env).Uint())
+		}
+	case xr.Uint64:
+		ret = func(env *Env) uint64 {
+			return fun(env).Uint()
+		}
+	case xr.Uintptr:
+		ret = func(env *Env) uintptr {
+			return uintptr(fun(env).Uint())
+		}
+	case xr.Float32:
+		ret = func(env *Env) float32 {
+			return float32(fun(env).Float())
+		}
+	case xr.Float64:
+		ret = func(env *Env) float64 {
+			return fun(env).Float()
+		}
+	case xr.Complex64:
+		ret = func(env *Env) complex64 {
+			return complex64(fun(env).Complex())
+		}
+	case xr.Complex128:
+		ret = func(env *Env) complex128 {
+			return fun(env).Complex()
+		}
+	case xr.String:
+		ret = func(env *Env) string {
+			return fun(env).String()
+		}
+	default:
+		ret = fun
+	}
+	return ret
+}
@@ -0,0 +1,203 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * embed.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/ast2"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+const embedDirective = "//go:embed"
+
+// return the patterns listed by the //go:embed directives in doc, or nil if there are none
+func embedPatterns(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var patterns []string
+	for _, comment := range doc.List {
+		text := comment.Text
+		if !strings.HasPrefix(text, embedDirective+" ") && !strings.HasPrefix(text, embedDirective+"\t") {
+			continue
+		}
+		for text = strings.TrimSpace(text[len(embedDirective):]); len(text) != 0; text = strings.TrimSpace(text) {
+			var pattern string
+			if text[0] == '"' || text[0] == '`' {
+				quoted := quotedPrefix(text)
+				if len(quoted) == 0 {
+					break
+				}
+				pattern, _ = strconv.Unquote(quoted)
+				text = text[len(quoted):]
+			} else if n := strings.IndexAny(text, " \t"); n >= 0 {
+				pattern, text = text[:n], text[n:]
+			} else {
+				pattern, text = text, ""
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// return the Go string literal at the beginning of text, or "" if text does not start with one
+func quotedPrefix(text string) string {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case quote:
+			return text[:i+1]
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		}
+	}
+	return ""
+}
+
+// call moveEmbedDoc on all the declarations in form
+func moveEmbedDocs(form ast2.Ast) {
+	switch node := form.Interface().(type) {
+	case *ast.File:
+		for _, decl := range node.Decls {
+			moveEmbedDoc(decl)
+		}
+	case ast.Decl:
+		moveEmbedDoc(node)
+	default:
+		if form, ok := form.(ast2.AstWithSlice); ok {
+			for i, n := 0, form.Size(); i < n; i++ {
+				moveEmbedDocs(form.Get(i))
+			}
+		}
+	}
+}
+
+// a //go:embed directive immediately before "var x T" is stored by the parser in *ast.GenDecl.Doc,
+// which is lost when the declaration is reordered by dep.Sorter: move it to the *ast.ValueSpec
+func moveEmbedDoc(decl ast.Decl) {
+	gen, ok := decl.(*ast.GenDecl)
+	if !ok || gen.Tok != token.VAR || gen.Lparen.IsValid() || len(gen.Specs) != 1 || embedPatterns(gen.Doc) == nil {
+		return
+	}
+	if spec, ok := gen.Specs[0].(*ast.ValueSpec); ok && spec.Doc == nil {
+		spec.Doc = gen.Doc
+	}
+}
+
+// declEmbed compiles a variable declaration preceded by //go:embed patterns,
+// initializing the variable with the content of the matching file.
+// Only variables of type string and []byte are supported, not embed.FS.
+// Patterns are relative to the directory of the file being loaded,
+// and files are read from the FileSystem set with Interp.SetFileSystem or Interp.SetFS
+func (c *Comp) declEmbed(node *ast.ValueSpec, patterns []string) {
+	if len(node.Names) != 1 {
+		c.Errorf("go:embed cannot apply to multiple vars")
+	} else if len(node.Values) != 0 {
+		c.Errorf("go:embed cannot apply to var with initializer")
+	} else if node.Type == nil {
+		c.Errorf("go:embed cannot apply to var without type")
+	}
+	t := c.Type(node.Type)
+	switch t.Kind() {
+	case xr.String:
+	case xr.Slice:
+		if t.Elem().Kind() == xr.Uint8 {
+			break
+		}
+		fallthrough
+	default:
+		c.Errorf("go:embed cannot apply to var of type %v: only string and []byte are supported", t)
+	}
+	var files []string
+	for _, pattern := range patterns {
+		files = append(files, c.embedMatch(pattern)...)
+	}
+	if len(files) != 1 {
+		c.Errorf("go:embed: multiple files for type %v", t)
+	}
+	data := c.embedRead(files[0])
+	v := xr.ValueOf(data).Convert(t.ReflectType())
+	c.DeclVars0(toStrings(node.Names), t, []*Expr{exprFun(t, unwrapX1(t, func(*Env) xr.Value {
+		return v
+	}))}, toPos(node.Names))
+}
+
+// return the directory containing the file being loaded, or "." if not loading a file
+func (c *Comp) embedDir() string {
+	g := c.CompGlobals
+	if len(g.Filepath) != 0 {
+		if info, err := g.fileSystem().Stat(g.Filepath); err == nil && !info.IsDir() {
+			return filepath.Dir(g.Filepath)
+		}
+	}
+	return "."
+}
+
+// return the files matching a //go:embed pattern
+func (c *Comp) embedMatch(pattern string) []string {
+	if _, err := path.Match(pattern, ""); err != nil || path.IsAbs(pattern) || strings.HasPrefix(path.Clean(pattern), "..") {
+		c.Errorf("go:embed: invalid pattern syntax: %q", pattern)
+	}
+	fsys := c.fileSystem()
+	dir := c.embedDir()
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		if info, err := fsys.Stat(filepath.Join(dir, filepath.FromSlash(pattern))); err != nil {
+			c.Errorf("go:embed: pattern %s: no matching files found", pattern)
+		} else if info.IsDir() {
+			c.Errorf("go:embed: pattern %s: cannot embed directory into var of type string or []byte", pattern)
+		}
+		return []string{pattern}
+	}
+	pdir, pfile := path.Split(pattern)
+	infos, err := fsys.ReadDir(filepath.Join(dir, filepath.FromSlash(pdir)))
+	if err != nil {
+		c.Errorf("go:embed: pattern %s: %v", pattern, err)
+	}
+	var files []string
+	for _, info := range infos {
+		if match, _ := path.Match(pfile, info.Name()); match && !info.IsDir() {
+			files = append(files, pdir+info.Name())
+		}
+	}
+	if len(files) == 0 {
+		c.Errorf("go:embed: pattern %s: no matching files found", pattern)
+	}
+	return files
+}
+
+func (c *Comp) embedRead(name string) []byte {
+	f, err := c.fileSystem().Open(filepath.Join(c.embedDir(), filepath.FromSlash(name)))
+	if err != nil {
+		c.Errorf("go:embed: %v", err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		c.Errorf("go:embed: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,126 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * event.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// EventKind identifies the phase of an evaluation reported by an Event
+type EventKind uint8
+
+const (
+	EventInput        EventKind = iota // source code received
+	EventParseError                    // parse or macroexpansion failed
+	EventCompileError                  // compilation failed
+	EventExecStart                     // execution started
+	EventRuntimeError                  // execution failed
+	EventOutput                        // a chunk of output was written
+	EventResult                        // execution produced its values
+	EventDone                          // evaluation finished, successfully or not
+)
+
+var eventKindNames = [...]string{
+	EventInput:        "Input",
+	EventParseError:   "ParseError",
+	EventCompileError: "CompileError",
+	EventExecStart:    "ExecStart",
+	EventRuntimeError: "RuntimeError",
+	EventOutput:       "Output",
+	EventResult:       "Result",
+	EventDone:         "Done",
+}
+
+func (k EventKind) String() string {
+	if int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event describes the REPL activity, for the benefit of GUI frontends and notebook kernels.
+// Only the fields relevant for Kind are set
+type Event struct {
+	Kind     EventKind
+	Src      string        // EventInput: the source code to evaluate
+	Err      error         // EventParseError, EventCompileError, EventRuntimeError
+	Stderr   bool          // EventOutput: true if Data was written to standard error
+	Data     []byte        // EventOutput: the output chunk
+	Values   []xr.Value    // EventResult
+	Types    []xr.Type     // EventResult
+	Duration time.Duration // EventDone: time elapsed since EventInput
+}
+
+// SetEventHandler registers a function that will be invoked synchronously
+// for each Event generated by ParseEvalPrint(), and thus also by
+// ReadParseEvalPrint(), Repl(), ReplStdin() and EvalReader().
+// To receive the events on a channel, pass a handler that sends them to it.
+// Use nil to unregister the handler.
+//
+// EventOutput reports only what is written to the interpreter's Stdout and Stderr,
+// i.e. printed results, warnings and errors - not what interpreted code writes to os.Stdout.
+// Errors are reported only if base.OptTrapPanic is set, as it is in the REPL
+func (ir *Interp) SetEventHandler(handler func(Event)) {
+	ir.Comp.eventHandler = handler
+}
+
+func (g *CompGlobals) emit(event Event) {
+	if handler := g.eventHandler; handler != nil {
+		handler(event)
+	}
+}
+
+// redirect Stdout and Stderr to emit EventOutput.
+// returns a function that restores them
+func (g *CompGlobals) redirectOutputToEvents() (restore func()) {
+	stdout, stderr := g.Stdout, g.Stderr
+	g.Stdout = eventWriter{g, stdout, false}
+	g.Stderr = eventWriter{g, stderr, true}
+	return func() {
+		g.Stdout, g.Stderr = stdout, stderr
+	}
+}
+
+type eventWriter struct {
+	g      *CompGlobals
+	out    io.Writer
+	stderr bool
+}
+
+func (w eventWriter) Write(data []byte) (int, error) {
+	w.g.emit(Event{
+		Kind:   EventOutput,
+		Stderr: w.stderr,
+		Data:   append([]byte(nil), data...),
+	})
+	return w.out.Write(data)
+}
+
+// convert a recovered panic to an error
+func panicToError(rec interface{}) error {
+	switch rec := rec.(type) {
+	case error:
+		return rec
+	default:
+		return errors.New(fmt.Sprint(rec))
+	}
+}
@@ -125,6 +125,12 @@ func (c *Comp) Expr(in ast.Expr, t xr.Type) *Expr {
 
 // same as Expr, but does not replace e.Fun with jit-compiled code
 func (c *Comp) expr(in ast.Expr, t xr.Type) *Expr {
+	e := c.exprCompile(in, t)
+	c.stats.countExpr(e)
+	return e
+}
+
+func (c *Comp) exprCompile(in ast.Expr, t xr.Type) *Expr {
 	for {
 		if in != nil {
 			c.Pos = in.Pos()
@@ -134,13 +140,18 @@ func (c *Comp) expr(in ast.Expr, t xr.Type) *Expr {
 		case *ast.BasicLit:
 			return c.BasicLit(node)
 		case *ast.BinaryExpr:
-			return c.BinaryExpr(node)
+			// propagate inferred type
+			return c.binaryExpr(node, t)
 		case *ast.CallExpr:
 			return c.CallExpr(node)
 		case *ast.CompositeLit:
 			// propagate inferred type
 			return c.CompositeLit(node, t)
 		case *ast.FuncLit:
+			if isLambda(node) {
+				// propagate inferred type
+				return c.Lambda(node, t)
+			}
 			return c.FuncLit(node)
 		case *ast.Ident:
 			return c.Ident(node.Name)
@@ -216,24 +227,30 @@ func (c *Comp) Expr1OrType(expr ast.Expr) (e *Expr, t xr.Type) {
 	return
 }
 
-// IndexExpr compiles a read operation on obj[idx]
-// or a generic function name#[T1, T2...]
+// IndexExpr compiles a read operation on obj[idx],
+// a generic function name#[T1, T2...] or an imported generic function pkg.Func[T1, T2...]
 func (c *Comp) IndexExpr(node *ast.IndexExpr) *Expr {
 	if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
 		if e := c.GenericFunc(node); e != nil {
 			return e
 		}
 	}
+	if e := c.importedGenericFunc(node); e != nil {
+		return e
+	}
 	return c.indexExpr(node, true)
 }
 
-// IndexExpr1 compiles a single-valued read operation on obj[idx]
-// or a generic function name#[T1, T2...]
+// IndexExpr1 compiles a single-valued read operation on obj[idx],
+// a generic function name#[T1, T2...] or an imported generic function pkg.Func[T1, T2...]
 func (c *Comp) IndexExpr1(node *ast.IndexExpr) *Expr {
 	if GENERICS_V1_CXX() || GENERICS_V2_CTI() {
 		if e := c.GenericFunc(node); e != nil {
 			return e
 		}
 	}
+	if e := c.importedGenericFunc(node); e != nil {
+		return e
+	}
 	return c.indexExpr(node, false)
 }
@@ -0,0 +1,557 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * field_shim.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"go/token"
+	r "reflect"
+	"unsafe"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// fieldShim reads and writes a struct field of basic kind through its offset,
+// bypassing reflect.Value.Field() and reflect.Value.FieldByIndex().
+// Shims are created once per (struct type, field index) and cached in CompGlobals.
+//
+// A shim is used only if the object at runtime is an addressable struct,
+// or a non-nil pointer to struct, with exactly the type seen at compile time:
+// otherwise, for example for struct values returned by functions or stored in maps,
+// the slower reflect.Value.FieldByIndex() is used.
+type fieldShim struct {
+	rtype  r.Type  // struct type
+	rptr   r.Type  // pointer to struct type
+	offset uintptr // field offset from the beginning of the struct
+}
+
+type fieldShimKey struct {
+	rtype r.Type
+	index string
+}
+
+// placeField is stored in Place for struct fields that have a fieldShim
+type placeField struct {
+	shim   *fieldShim
+	objfun func(*Env) xr.Value // returns the struct or pointer to struct
+	index  []int
+}
+
+// return the fieldShim for the field 'index' of struct type t (or pointer to struct)
+// or nil if the field cannot be accessed through its offset:
+// the field must have basic kind and the index path must not cross embedded pointers
+// nor xr.Forward, i.e. the field must be stored inside the struct itself
+func (c *Comp) fieldShim(t xr.Type, index []int, tfield xr.Type) *fieldShim {
+	if k := tfield.Kind(); k < xr.Bool || k > xr.Complex128 && k != xr.String {
+		return nil
+	}
+	rt := t.ReflectType()
+	if rt.Kind() == r.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != r.Struct {
+		return nil
+	}
+	key := fieldShimKey{rt, fmt.Sprint(index)}
+	g := c.CompGlobals
+	shim, ok := g.fieldShims[key]
+	if !ok {
+		shim = newFieldShim(rt, index, tfield.ReflectType())
+		if g.fieldShims == nil {
+			g.fieldShims = make(map[fieldShimKey]*fieldShim)
+		}
+		g.fieldShims[key] = shim
+	}
+	return shim
+}
+
+func newFieldShim(rt r.Type, index []int, rtfield r.Type) *fieldShim {
+	var offset uintptr
+	t := rt
+	for _, x := range index {
+		if t.Kind() != r.Struct || x < 0 || x >= t.NumField() {
+			return nil
+		}
+		field := t.Field(x)
+		offset += field.Offset
+		t = field.Type
+	}
+	if t != rtfield {
+		return nil
+	}
+	return &fieldShim{rtype: rt, rptr: r.PtrTo(rt), offset: offset}
+}
+
+// return the address of the field inside obj,
+// or nil if obj is not an addressable struct nor a non-nil pointer to struct of the expected type
+func (shim *fieldShim) addr(obj xr.Value) unsafe.Pointer {
+	rv := obj.ReflectValue()
+	var base unsafe.Pointer
+	switch rv.Kind() {
+	case r.Ptr:
+		if rv.Type() != shim.rptr || rv.IsNil() {
+			return nil
+		}
+		base = unsafe.Pointer(rv.Pointer())
+	case r.Struct:
+		if rv.Type() != shim.rtype || !rv.CanAddr() {
+			return nil
+		}
+		base = unsafe.Pointer(rv.UnsafeAddr())
+	default:
+		return nil
+	}
+	return unsafe.Pointer(uintptr(base) + shim.offset)
+}
+
+// compile a read of struct field 'index' through its fieldShim
+func (c *Comp) compileFieldShim(objfun func(*Env) xr.Value, index []int, t xr.Type, shim *fieldShim) *Expr {
+	var fun I
+	switch t.Kind() {
+	case xr.Bool:
+		fun = func(env *Env) bool {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*bool)(p)
+			}
+			return fieldByIndex(obj, index).Bool()
+		}
+	case xr.Int:
+		fun = func(env *Env) int {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*int)(p)
+			}
+			return int(fieldByIndex(obj, index).Int())
+		}
+	case xr.Int8:
+		fun = func(env *Env) int8 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*int8)(p)
+			}
+			return int8(fieldByIndex(obj, index).Int())
+		}
+	case xr.Int16:
+		fun = func(env *Env) int16 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*int16)(p)
+			}
+			return int16(fieldByIndex(obj, index).Int())
+		}
+	case xr.Int32:
+		fun = func(env *Env) int32 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*int32)(p)
+			}
+			return int32(fieldByIndex(obj, index).Int())
+		}
+	case xr.Int64:
+		fun = func(env *Env) int64 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*int64)(p)
+			}
+			return fieldByIndex(obj, index).Int()
+		}
+	case xr.Uint:
+		fun = func(env *Env) uint {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*uint)(p)
+			}
+			return uint(fieldByIndex(obj, index).Uint())
+		}
+	case xr.Uint8:
+		fun = func(env *Env) uint8 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*uint8)(p)
+			}
+			return uint8(fieldByIndex(obj, index).Uint())
+		}
+	case xr.Uint16:
+		fun = func(env *Env) uint16 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*uint16)(p)
+			}
+			return uint16(fieldByIndex(obj, index).Uint())
+		}
+	case xr.Uint32:
+		fun = func(env *Env) uint32 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*uint32)(p)
+			}
+			return uint32(fieldByIndex(obj, index).Uint())
+		}
+	case xr.Uint64:
+		fun = func(env *Env) uint64 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*uint64)(p)
+			}
+			return fieldByIndex(obj, index).Uint()
+		}
+	case xr.Uintptr:
+		fun = func(env *Env) uintptr {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*uintptr)(p)
+			}
+			return uintptr(fieldByIndex(obj, index).Uint())
+		}
+	case xr.Float32:
+		fun = func(env *Env) float32 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*float32)(p)
+			}
+			return float32(fieldByIndex(obj, index).Float())
+		}
+	case xr.Float64:
+		fun = func(env *Env) float64 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*float64)(p)
+			}
+			return fieldByIndex(obj, index).Float()
+		}
+	case xr.Complex64:
+		fun = func(env *Env) complex64 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*complex64)(p)
+			}
+			return complex64(fieldByIndex(obj, index).Complex())
+		}
+	case xr.Complex128:
+		fun = func(env *Env) complex128 {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*complex128)(p)
+			}
+			return fieldByIndex(obj, index).Complex()
+		}
+	case xr.String:
+		fun = func(env *Env) string {
+			obj := objfun(env)
+			if p := shim.addr(obj); p != nil {
+				return *(*string)(p)
+			}
+			return fieldByIndex(obj, index).String()
+		}
+	default:
+		c.Errorf("internal error: compileFieldShim() invoked on field of unsupported type %v", t)
+	}
+	return exprFun(t, fun)
+}
+
+// compile 'place = init' through the fieldShim of place, if available. Returns nil otherwise
+func (c *Comp) placeSetFieldShim(place *Place, op token.Token, init *Expr) Stmt {
+	field := place.field
+	if field == nil || op != token.ASSIGN {
+		return nil
+	}
+	t := place.Type
+	if init.Const() {
+		init.ConstTo(t)
+		init.WithFun()
+	} else if init.Type == nil || !init.Type.AssignableTo(t) {
+		return nil // let Comp.setPlace() report the error
+	}
+	shim, objfun, index := field.shim, field.objfun, field.index
+	var stmt Stmt
+	switch t.Kind() {
+	case xr.Bool:
+		rhs, ok := init.Fun.(func(*Env) bool)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*bool)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetBool(val)
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Int:
+		rhs, ok := init.Fun.(func(*Env) int)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*int)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetInt(int64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Int8:
+		rhs, ok := init.Fun.(func(*Env) int8)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*int8)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetInt(int64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Int16:
+		rhs, ok := init.Fun.(func(*Env) int16)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*int16)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetInt(int64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Int32:
+		rhs, ok := init.Fun.(func(*Env) int32)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*int32)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetInt(int64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Int64:
+		rhs, ok := init.Fun.(func(*Env) int64)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*int64)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetInt(val)
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Uint:
+		rhs, ok := init.Fun.(func(*Env) uint)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*uint)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetUint(uint64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Uint8:
+		rhs, ok := init.Fun.(func(*Env) uint8)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*uint8)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetUint(uint64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Uint16:
+		rhs, ok := init.Fun.(func(*Env) uint16)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*uint16)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetUint(uint64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Uint32:
+		rhs, ok := init.Fun.(func(*Env) uint32)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*uint32)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetUint(uint64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Uint64:
+		rhs, ok := init.Fun.(func(*Env) uint64)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*uint64)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetUint(val)
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Uintptr:
+		rhs, ok := init.Fun.(func(*Env) uintptr)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*uintptr)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetUint(uint64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Float32:
+		rhs, ok := init.Fun.(func(*Env) float32)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*float32)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetFloat(float64(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Float64:
+		rhs, ok := init.Fun.(func(*Env) float64)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*float64)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetFloat(val)
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Complex64:
+		rhs, ok := init.Fun.(func(*Env) complex64)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*complex64)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetComplex(complex128(val))
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.Complex128:
+		rhs, ok := init.Fun.(func(*Env) complex128)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*complex128)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetComplex(val)
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case xr.String:
+		rhs, ok := init.Fun.(func(*Env) string)
+		if !ok {
+			return nil
+		}
+		stmt = func(env *Env) (Stmt, *Env) {
+			obj := objfun(env)
+			val := rhs(env)
+			if p := shim.addr(obj); p != nil {
+				*(*string)(p) = val
+			} else {
+				fieldByIndex(obj, index).SetString(val)
+			}
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	}
+	return stmt
+}
@@ -0,0 +1,65 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * fs.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// FileSystem is the interface used to read the files loaded by Interp.LoadFile,
+// Interp.LoadDir, Interp.EvalFile and :load, and the files embedded with //go:embed.
+// Imported packages are always read from the operating system.
+// See Interp.SetFileSystem, and Interp.SetFS for an adapter of io/fs.FS
+type FileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+// SetFileSystem sets the FileSystem used to load files and resolve //go:embed.
+// nil restores the operating system
+func (ir *Interp) SetFileSystem(fsys FileSystem) {
+	ir.Comp.CompGlobals.fs = fsys
+}
+
+// FileSystem returns the FileSystem used to load files and resolve //go:embed
+func (ir *Interp) FileSystem() FileSystem {
+	return ir.Comp.CompGlobals.fileSystem()
+}
+
+func (cg *CompGlobals) fileSystem() FileSystem {
+	if cg.fs == nil {
+		return osFileSystem{}
+	}
+	return cg.fs
+}
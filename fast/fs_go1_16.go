@@ -0,0 +1,77 @@
+// +build go1.16
+
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * fs_go1_16.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SetFS makes the interpreter load files and resolve //go:embed from fsys,
+// for example a testing/fstest.MapFS or an embed.FS, instead of the operating system.
+// Since io/fs paths are always relative, absolute file names are made relative
+// to the root of fsys. SetFS(nil) restores the operating system
+func (ir *Interp) SetFS(fsys fs.FS) {
+	if fsys == nil {
+		ir.SetFileSystem(nil)
+	} else {
+		ir.SetFileSystem(ioFileSystem{fsys})
+	}
+}
+
+// ioFileSystem adapts an io/fs.FS to the FileSystem interface
+type ioFileSystem struct {
+	fsys fs.FS
+}
+
+func (iofs ioFileSystem) Open(name string) (io.ReadCloser, error) {
+	return iofs.fsys.Open(fsPath(name))
+}
+
+func (iofs ioFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(iofs.fsys, fsPath(name))
+}
+
+func (iofs ioFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(iofs.fsys, fsPath(name))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, len(entries))
+	for i, entry := range entries {
+		if infos[i], err = entry.Info(); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+// convert a file name to the unrooted, slash-separated form required by io/fs
+func fsPath(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	name = strings.TrimLeft(name, "/")
+	if len(name) == 0 {
+		name = "."
+	}
+	return name
+}
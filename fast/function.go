@@ -35,6 +35,32 @@ type funcMaker struct {
 	funcbody  func(*Env)
 }
 
+// declFuncFwd forward-declares a toplevel function, without compiling its body:
+// allows mutually recursive functions to reference each other
+func (c *Comp) declFuncFwd(funcdecl *ast.FuncDecl) {
+	t, _, _ := c.TypeFunction(funcdecl.Type)
+	bind := c.NewBind(funcdecl.Name.Name, FuncBind, t)
+	bind.Value = hotswapMark{fwd: true}
+}
+
+// declInit compiles a toplevel func init() { ... } as a call to a function literal:
+// init functions cannot be referenced, and run as soon as they are declared.
+// dep.Sorter places them after all other declarations in the same batch
+func (c *Comp) declInit(funcdecl *ast.FuncDecl) {
+	functype := funcdecl.Type
+	if functype.Params.NumFields() != 0 || functype.Results.NumFields() != 0 {
+		c.Errorf("func init must have no arguments and no return values")
+	} else if funcdecl.Body == nil {
+		c.Errorf("missing function body: %v", funcdecl)
+	}
+	call := &ast.CallExpr{
+		Fun:    &ast.FuncLit{Type: functype, Body: funcdecl.Body},
+		Lparen: funcdecl.Body.Lbrace,
+		Rparen: funcdecl.Body.Rbrace,
+	}
+	c.Stmt(&ast.ExprStmt{X: call})
+}
+
 // DeclFunc compiles a function, macro or method declaration
 // For closure declarations, use FuncLit()
 //
@@ -79,11 +105,24 @@ func (c *Comp) DeclFunc(funcdecl *ast.FuncDecl) {
 		// use a ConstBind, as builtins do
 		funcbind = c.NewBind(funcname, ConstBind, c.TypeOfMacro())
 	} else {
-		funcbind = c.NewBind(funcname, FuncBind, t)
+		if oldbind != nil && oldbind.Value == (hotswapMark{fwd: true}) && oldbind.Type.IdenticalTo(t) {
+			// complete the forward declaration created by declFuncFwd()
+			funcbind = oldbind
+		} else {
+			funcbind = c.NewBind(funcname, FuncBind, t)
+		}
+		funcbind.Value = hotswapMark{}
+		if body := funcdecl.Body; body != nil && funcbind.Desc.Index() != NoIndex &&
+			c == c.FileComp() && c.hasLazyImports(body) {
+			c.Append(c.declFuncLazy(funcdecl, t, paramnames, resultnames, funcbind), funcdecl.Pos())
+			panicking = false
+			return
+		}
 	}
 	cf := NewComp(c, nil)
 	info, resultfuns := cf.funcBinds(funcname, functype, t, paramnames, resultnames)
 	cf.Func = info
+	cf.noteReassigned(nil, functype, funcdecl.Body)
 
 	if body := funcdecl.Body; body != nil {
 		// in Go, function arguments/results and function body are in the same scope
@@ -91,6 +130,7 @@ func (c *Comp) DeclFunc(funcdecl *ast.FuncDecl) {
 			cf.Stmt(node)
 		}
 	}
+	cf.reportUnused()
 
 	funcindex := funcbind.Desc.Index()
 	if funcname == "_" || (!ismacro && funcindex == NoIndex) {
@@ -98,6 +138,7 @@ func (c *Comp) DeclFunc(funcdecl *ast.FuncDecl) {
 		panicking = false
 		return
 	}
+	c.saveFuncListing(funcbind, &cf.Code)
 	// do NOT keep a reference to compile environment!
 	funcbody := cf.Code.Exec()
 
@@ -180,12 +221,14 @@ func (c *Comp) methodDecl(funcdecl *ast.FuncDecl) {
 	cf := NewComp(c, nil)
 	info, resultfuns := cf.funcBinds(funcdecl.Name.Name, functype, t, paramnames, resultnames)
 	cf.Func = info
+	cf.noteReassigned(funcdecl.Recv, functype, funcdecl.Body)
 
 	body := funcdecl.Body
 	if body != nil && len(body.List) != 0 {
 		// in Go, function arguments/results and function body are in the same scope
 		cf.List(body.List)
 	}
+	cf.reportUnused()
 	// do NOT keep a reference to compile environment!
 	funcbody := cf.Code.Exec()
 	f := cf.funcCreate(t, info, resultfuns, funcbody)
@@ -221,20 +264,34 @@ func (c *Comp) methodDecl(funcdecl *ast.FuncDecl) {
 func (c *Comp) FuncLit(funclit *ast.FuncLit) *Expr {
 	functype := funclit.Type
 	t, paramnames, resultnames := c.TypeFunction(functype)
+	return c.funcLit(functype, t, paramnames, resultnames, funclit.Body)
+}
 
-	cf := NewComp(c, nil)
+// compile a function literal with the specified type, parameter and result names
+func (c *Comp) funcLit(functype *ast.FuncType, t xr.Type, paramnames, resultnames []string, body *ast.BlockStmt) *Expr {
+	// variables captured by value are declared in an intermediate Comp
+	outer := c
+	capture := c.captureByValue(body)
+	if capture != nil {
+		outer = capture.comp
+	}
+	cf := NewComp(outer, nil)
 	info, resultfuns := cf.funcBinds("", functype, t, paramnames, resultnames)
 	cf.Func = info
+	cf.noteReassigned(nil, functype, body)
 
-	body := funclit.Body
 	if body != nil && len(body.List) != 0 {
 		// in Go, function arguments/results and function body are in the same scope
 		cf.List(body.List)
 	}
+	cf.reportUnused()
 	// do NOT keep a reference to compile environment!
 	funcbody := cf.Code.Exec()
 
 	f := cf.funcCreate(t, info, resultfuns, funcbody)
+	if capture != nil {
+		f = capture.wrap(f)
+	}
 
 	// a function literal is an expression:
 	// executing it returns the function
@@ -21,11 +21,14 @@ import (
 	"go/ast"
 	"go/constant"
 	"go/token"
+	"io"
 	r "reflect"
 	"sort"
+	"time"
 
 	"github.com/cosmos72/gomacro/atomic"
 	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/base/genimport"
 	"github.com/cosmos72/gomacro/base/output"
 	"github.com/cosmos72/gomacro/base/untyped"
 	xr "github.com/cosmos72/gomacro/xreflect"
@@ -420,6 +423,8 @@ type Place struct {
 	// used only for map[key], returns key. call it only once, it may have side effects!
 	MapKey  func(*Env) xr.Value
 	MapType xr.Type
+	// used only for struct fields that can be written through a fieldShim
+	field *placeField
 }
 
 func (place *Place) IsVar() bool {
@@ -454,6 +459,7 @@ type Code struct {
 	List       []Stmt
 	DebugPos   []token.Pos // for debugging interpreted code: position of each statement
 	WithDefers bool        // true if code contains some defers
+	deadCode   bool        // true while compiling code that is never executed. see Comp.checkDeadCode()
 }
 
 type LoopInfo struct {
@@ -472,6 +478,11 @@ type FuncInfo struct {
 	Param        []*Bind
 	Result       []*Bind
 	NamedResults bool
+	// names of the variables that may be modified after their declaration,
+	// see noteReassigned(). nil if unknown
+	reassigned map[string]bool
+	// local variables not used yet, and their position. see noteDeclaredVars()
+	unused map[*Bind]token.Pos
 }
 
 const (
@@ -544,8 +555,9 @@ type Debugger interface {
 
 // IrGlobals contains interpreter configuration
 type IrGlobals struct {
-	gls  map[uintptr]*Run
-	lock atomic.SpinLock
+	gls    map[uintptr]*Run
+	lock   atomic.SpinLock
+	values valueCache // canonical values of common constants, see funAsX1
 	base.Globals
 }
 
@@ -556,14 +568,18 @@ type Run struct {
 	Interrupt    Stmt
 	Signals      base.Signals // set by defer, return, breakpoint, debugger and Run.interrupt(os.Signal)
 	ExecFlags    ExecFlags
-	CurrEnv      *Env        // caller of current function. used ONLY at function entry to build call stack
-	InstallDefer func()      // defer function to be installed
-	DeferOfFun   *Env        // function whose defer are running
-	PanicFun     *Env        // the currently panicking function
-	Panic        interface{} // current panic. needed for recover()
+	CurrEnv      *Env         // caller of current function. used ONLY at function entry to build call stack
+	InstallDefer func()       // defer function to be installed
+	DeferOfFun   *Env         // function whose defer are running
+	PanicFun     *Env         // the currently panicking function
+	Panic        interface{}  // current panic. needed for recover()
+	panicStack   []StackFrame // interpreted call stack of current panic, see InterpRuntimeError
 	CmdOpt       base.CmdOpt
 	Debugger     Debugger
-	DebugDepth   int // depth of function to debug with single-step
+	DebugDepth   int           // depth of function to debug with single-step
+	interruptCh  chan struct{} // notified by interrupt(). used by interruptible channel operations
+	evalRun      *Run          // Run of the goroutine executing the current evaluation, if not this one. protected by IrGlobals.lock
+	yield        *yielder      // set while Interp.RunSteps executes a Task with this Run
 	PoolSize     int
 	Pool         [poolCapacity]*Env
 }
@@ -577,6 +593,40 @@ type CompGlobals struct {
 	proxy2interf map[r.Type]xr.Type // proxy -> interface
 	Prompt       string
 	Jit          *Jit
+	macroComp    *Comp // *Comp currently performing macroexpansion, used by MacroType()
+	eventHandler func(Event)
+	stats        Stats
+	funcListings map[*Bind]*funcListing // compiled functions, used by Interp.Disasm()
+	funcOrder    []*Bind                // keys of funcListings, oldest first
+	fieldShims   map[fieldShimKey]*fieldShim
+	writes       map[*Bind]*writeRecord // toplevel variable -> last write. see OptTrackProvenance
+	// if > 0, ParseEvalPrint interrupts evaluations that take longer than Timeout
+	Timeout time.Duration
+	// if > 0, make() and new() fail when allocating more than MaxAlloc bytes
+	MaxAlloc int64
+	// if true, compiling a "go" statement fails
+	ForbidGo bool
+	// where builtins print() and println() write. nil means os.Stderr
+	PrintStderr io.Writer
+	// invoked by a second Ctrl+C while evaluating, see Interp.CtrlC. nil means os.Exit(130)
+	CtrlCExit func()
+	ctrlC     ctrlC
+	// Go module in the current directory, see OptProjectImports. Loaded on demand
+	project       *genimport.Project
+	projectLoaded bool
+	mux           *outputMux // see Interp.MultiplexOutput
+	recorder      *Recorder  // installed by :set determinism
+	fs            FileSystem // see Interp.SetFileSystem. nil means the operating system
+	// builtins declared on first use, see Comp.declLazyBind()
+	lazyBinds map[string]func() *Bind
+	// how to report unused local variables and imports, see :set unused
+	Unused        UnusedMode
+	loadingFile   int                      // > 0 while loading a file with EvalFile or LoadFile
+	unusedImports map[string]*unusedImport // imports of the file being loaded not used yet
+	sessionEnv    *sessionEnv              // session variables, see Interp.Setenv
+	hotStmts      []*hotStmt               // counters of compiled statements, see OptHotspots
+	hotspotsTop   int                      // number of source lines reported by :set hotspots
+	hotspotsDepth int                      // > 0 while an evaluation collects hotspots
 }
 
 func (cg *CompGlobals) CompileOptions() CompileOptions {
@@ -600,6 +650,10 @@ type CompBinds struct {
 	Types      map[string]xr.Type
 	Name       string // set by "package" directive
 	Path       string
+	freeBinds  []*Bind // slots released by the function returned by Interp.Bind, reused by NewBind
+	// variables declared by Interp.Bind and not yet released => true if referenced
+	// by code that may outlive the binding: a function body, or a pointer to them
+	scopedBinds map[BindDescriptor]bool
 }
 
 // Comp is a tree-of-closures builder: it transforms ast.Nodes into closures
@@ -616,7 +670,8 @@ type Comp struct {
 	Func      *FuncInfo // != nil when compiling a function
 	Labels    map[string]*int
 	Outer     *Comp
-	FuncMaker *funcMaker // used by debugger command 'backtrace' to obtain function name, type and binds for arguments and results
+	FuncMaker *funcMaker        // used by debugger command 'backtrace' to obtain function name, type and binds for arguments and results
+	concrete  map[*Bind]xr.Type // concrete type of values assigned to interface variables, nil if more than one. See devirtualizeCall()
 }
 
 // ================================= Env =================================
@@ -653,5 +708,6 @@ type Import struct {
 	// interpreted and compiled constants, functions, variables and types.
 	CompBinds
 	*EnvBinds
-	env *Env
+	env         *Env
+	interpreted bool // true if created from an interpreted package, see Interp.asImport()
 }
@@ -0,0 +1,170 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * hotspots.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cosmos72/gomacro/base"
+)
+
+// one execution every hotSampleRate of each statement is timed,
+// the time of the others is estimated from it
+const hotSampleRate = 64
+
+// default number of source lines reported by :set hotspots on
+const defaultHotspotsTop = 10
+
+// hotStmt contains the execution counters of a compiled statement.
+// Only created if option OptHotspots is set
+type hotStmt struct {
+	pos     token.Pos
+	count   uint64 // executions
+	samples uint64 // timed executions
+	nanos   uint64 // total duration of timed executions
+}
+
+// Hotspot describes the cost of an interpreted source line, see Interp.Hotspots
+type Hotspot struct {
+	Pos    token.Position // file and line. Column is the one of the first statement on the line
+	Source string         // source line, if available
+	Count  uint64         // number of statements executed on the line
+	// execution time estimated from the sampled statements.
+	// It includes the time spent in functions called by the line
+	Time time.Duration
+}
+
+// hotspot wraps stmt to count its executions and to measure the duration
+// of one execution every hotSampleRate. Statements without a position are not wrapped
+func (c *Comp) hotspot(stmt Stmt, pos token.Pos) Stmt {
+	if pos == token.NoPos {
+		return stmt
+	}
+	h := &hotStmt{pos: pos}
+	c.hotStmts = append(c.hotStmts, h)
+	return func(env *Env) (Stmt, *Env) {
+		if atomic.AddUint64(&h.count, 1)%hotSampleRate != 1 {
+			return stmt(env)
+		}
+		start := time.Now()
+		next, env := stmt(env)
+		atomic.AddUint64(&h.nanos, uint64(time.Since(start)))
+		atomic.AddUint64(&h.samples, 1)
+		return next, env
+	}
+}
+
+// Hotspots returns the n most expensive source lines executed since the last call to ResetHotspots,
+// sorted by decreasing estimated time. Only statements compiled while option OptHotspots
+// was set are counted. If n <= 0, returns all the executed lines
+func (ir *Interp) Hotspots(n int) []Hotspot {
+	cg := ir.Comp.CompGlobals
+	type line struct {
+		filename string
+		line     int
+	}
+	lines := make(map[line]*Hotspot)
+	var list []*Hotspot
+	for _, h := range cg.hotStmts {
+		count := atomic.LoadUint64(&h.count)
+		if count == 0 {
+			continue
+		}
+		var nanos uint64
+		if samples := atomic.LoadUint64(&h.samples); samples != 0 {
+			nanos = uint64(float64(atomic.LoadUint64(&h.nanos)) * float64(count) / float64(samples))
+		}
+		source, pos := cg.Fileset.Source(h.pos)
+		key := line{pos.Filename, pos.Line}
+		spot := lines[key]
+		if spot == nil {
+			spot = &Hotspot{Pos: pos, Source: strings.TrimSpace(source)}
+			lines[key] = spot
+			list = append(list, spot)
+		} else if pos.Column < spot.Pos.Column {
+			spot.Pos = pos
+		}
+		spot.Count += count
+		spot.Time += time.Duration(nanos)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Time != list[j].Time {
+			return list[i].Time > list[j].Time
+		}
+		return list[i].Count > list[j].Count
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	ret := make([]Hotspot, len(list))
+	for i, spot := range list {
+		ret[i] = *spot
+	}
+	return ret
+}
+
+// ResetHotspots sets to zero the counters of all compiled statements, see Interp.Hotspots
+func (ir *Interp) ResetHotspots() {
+	for _, h := range ir.Comp.hotStmts {
+		atomic.StoreUint64(&h.count, 0)
+		atomic.StoreUint64(&h.samples, 0)
+		atomic.StoreUint64(&h.nanos, 0)
+	}
+}
+
+// if option OptHotspots is set, reset the counters of compiled statements
+// and return a function that reports the most expensive source lines executed in the meantime.
+// Nested evaluations, as :load FILE, are reported together with the outermost one
+func (ir *Interp) collectHotspots() func() {
+	cg := ir.Comp.CompGlobals
+	if cg.Options&base.OptHotspots == 0 || cg.hotspotsDepth != 0 {
+		return func() {}
+	}
+	ir.ResetHotspots()
+	cg.hotspotsDepth++
+	return func() {
+		cg.hotspotsDepth--
+		ir.showHotspots()
+	}
+}
+
+// print the most expensive source lines executed since the last call to ResetHotspots
+func (ir *Interp) showHotspots() {
+	list := ir.Hotspots(ir.hotspotsTop())
+	if len(list) == 0 {
+		return
+	}
+	g := &ir.Comp.Globals
+	g.Fprintf(g.Stdout, "// hotspots: position, statements executed, estimated time\n")
+	for _, spot := range list {
+		g.Fprintf(g.Stdout, "//   %-16s %10d %10v   %s\n",
+			fmt.Sprintf("%s:%d", spot.Pos.Filename, spot.Pos.Line), spot.Count, spot.Time.Round(time.Microsecond), spot.Source)
+	}
+}
+
+// return the number of source lines reported by :set hotspots
+func (ir *Interp) hotspotsTop() int {
+	if n := ir.Comp.hotspotsTop; n > 0 {
+		return n
+	}
+	return defaultHotspotsTop
+}
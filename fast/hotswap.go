@@ -0,0 +1,77 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * hotswap.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"sync"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// toplevel functions can be redefined: calls compiled before the redefinition
+// read the function from its slot in Env.FileEnv.Vals at each call, thus they
+// invoke the new body. To also update functions stored in variables, maps, slices...
+// reading a toplevel function as a value returns a trampoline that forwards each call
+// to the current content of the slot.
+//
+// Redefining a function with a different type allocates a new slot
+// (see CompBinds.NewBind), so code compiled before the redefinition keeps invoking
+// the old body instead of panicking because of the type mismatch.
+
+// hotswapMark is stored in Bind.Value of toplevel functions declared by interpreted code,
+// to distinguish them from compiled functions imported with import . "path"
+type hotswapMark struct {
+	fwd bool // true if function is forward-declared, see Comp.declFuncFwd()
+}
+
+// return true if sym is a toplevel function declared by interpreted code,
+// when read from a Comp with given depth
+func isHotswapFunc(sym *Symbol, depth int) bool {
+	if sym.Desc.Class() != FuncBind || sym.Desc.Index() == NoIndex || sym.Upn != depth-1 {
+		return false
+	}
+	_, ok := sym.Value.(hotswapMark)
+	return ok
+}
+
+// return an expression that reads the toplevel function sym as a value,
+// i.e. a trampoline that always invokes the current body of sym
+func (sym *Symbol) hotswapExpr(g *CompGlobals) *Expr {
+	idx := sym.Desc.Index()
+	t := sym.Type
+	variadic := t.IsVariadic()
+	var lock sync.Mutex
+	var cachedenv *Env
+	var cached xr.Value
+
+	fun := func(env *Env) xr.Value {
+		fileenv := env.FileEnv
+		lock.Lock()
+		defer lock.Unlock()
+		if cachedenv != fileenv {
+			cached = xr.MakeFunc(t, func(args []xr.Value) []xr.Value {
+				if variadic {
+					return fileenv.Vals[idx].CallSlice(args)
+				}
+				return fileenv.Vals[idx].Call(args)
+			})
+			cachedenv = fileenv
+		}
+		return cached
+	}
+	return &Expr{Lit: Lit{Type: t}, Fun: fun, Sym: sym}
+}
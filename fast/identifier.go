@@ -23,9 +23,11 @@ import (
 )
 
 func (c *Comp) Resolve(name string) *Symbol {
-	sym, _ := c.tryResolve(name)
+	sym, outer := c.tryResolve(name)
 	if sym == nil {
-		c.Errorf("undefined identifier: %v", name)
+		c.undefinedIdentifier(name)
+	} else {
+		outer.noteUsed(name)
 	}
 	return sym
 }
@@ -37,9 +39,18 @@ func (c *Comp) TryResolve(name string) *Symbol {
 
 func (c *Comp) tryResolve(name string) (*Symbol, *Comp) {
 	upn := 0
-	for ; c != nil; c = c.Outer {
-		if bind, ok := c.Binds[name]; ok {
+	for inner := c; c != nil; c = c.Outer {
+		bind, ok := c.Binds[name]
+		if !ok && c.Outer == nil {
+			// builtins declared on first use
+			bind = c.declLazyBind(name)
+			ok = bind != nil
+		}
+		if ok {
 			// c.Debugf("TryResolve: %s is upn=%d %v", name, upn, bind)
+			if len(c.scopedBinds) != 0 && inner.funcInfo() != nil {
+				c.captureScopedBind(bind)
+			}
 			return bind.AsSymbol(upn), c
 		}
 		upn += c.UpCost // c.UpCost is zero if *Comp has no local variables/functions so it will NOT have a corresponding *Env at runtime
@@ -65,9 +76,23 @@ func (c *Comp) IdentPlace(name string, opt PlaceOption) *Place {
 		return &Place{Var: *bind.AsVar(0, PlaceSettable)}
 	}
 	sym := c.Resolve(name)
+	if opt == PlaceAddress {
+		c.captureAddressOf(name)
+	}
 	return &Place{Var: *sym.AsVar(opt)}
 }
 
+// record that the address of the variable 'name' is taken:
+// if declared by Interp.Bind, its slot must not be zeroed nor reused
+func (c *Comp) captureAddressOf(name string) {
+	for ; c != nil; c = c.Outer {
+		if bind := c.Binds[name]; bind != nil {
+			c.captureScopedBind(bind)
+			return
+		}
+	}
+}
+
 // Bind compiles a read operation on a constant, variable or function declared in 'c'
 func (c *Comp) Bind(bind *Bind) *Expr {
 	return bind.Expr(c.CompGlobals)
@@ -99,6 +124,9 @@ func (sym *Symbol) Expr(depth int, g *CompGlobals) *Expr {
 	case ConstBind:
 		return exprLit(sym.Lit, sym)
 	case VarBind, FuncBind:
+		if isHotswapFunc(sym, depth) {
+			return sym.hotswapExpr(g)
+		}
 		return sym.expr(depth, g)
 	case IntBind:
 		return sym.intExpr(depth, g)
@@ -17,8 +17,13 @@
 package fast
 
 import (
+	"fmt"
 	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
 	r "reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -93,9 +98,10 @@ func (ir *Interp) asImport() *Import {
 	env := ir.env
 	env.MarkUsedByClosure() // do not try to recycle this Env
 	return &Import{
-		CompBinds: ir.Comp.CompBinds,
-		EnvBinds:  &ir.env.EnvBinds,
-		env:       env,
+		CompBinds:   ir.Comp.CompBinds,
+		EnvBinds:    &ir.env.EnvBinds,
+		env:         env,
+		interpreted: true,
 	}
 }
 
@@ -149,6 +155,7 @@ func (c *Comp) ImportPackageOrError(alias, path string) (*Import, error) {
 	if imp == nil {
 		pkgref, err := g.Importer.ImportPackageOrError(
 			alias, path, g.Options&base.OptModuleImport != 0)
+		g.showImportTiming(path)
 		if err != nil {
 			return nil, err
 		}
@@ -162,6 +169,12 @@ func (c *Comp) ImportPackageOrError(alias, path string) (*Import, error) {
 		// specified in the package clause of the imported package
 		if len(alias) == 0 {
 			alias = imp.Name
+			if other := c.importCollision(alias, path); other != nil {
+				var err error
+				if alias, err = c.importAutoAlias(alias, path, other); err != nil {
+					return nil, err
+				}
+			}
 		}
 		c.declImport0(alias, imp)
 	}
@@ -169,30 +182,189 @@ func (c *Comp) ImportPackageOrError(alias, path string) (*Import, error) {
 	return imp, nil
 }
 
+// if option OptVerboseImports is set, show the time spent in each stage of importing path
+func (g *CompGlobals) showImportTiming(path string) {
+	if g.Options&base.OptVerboseImports == 0 {
+		return
+	}
+	if timing := g.Importer.ImportTiming(path); timing != nil {
+		g.Fprintf(g.Stdout, "// import %q: %v\n", path, timing)
+	} else {
+		g.Fprintf(g.Stdout, "// import %q: already loaded\n", path)
+	}
+}
+
+// ImportAliasError is returned when importing without an alias a package
+// whose name is already used in the same scope by a different imported package,
+// and option OptStrictImportAlias is set
+type ImportAliasError struct {
+	Path      string   // path of the package being imported
+	Name      string   // name of the package being imported
+	OtherPath string   // path of the package already imported with the same name
+	Suggested []string // suggested aliases, all currently unused
+}
+
+func (err *ImportAliasError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "import %q: package name %s already refers to %q, use an alias as", err.Path, err.Name, err.OtherPath)
+	for i, alias := range err.Suggested {
+		if i != 0 {
+			buf.WriteString(" or")
+		}
+		fmt.Fprintf(&buf, " import %s %q", alias, err.Path)
+	}
+	return buf.String()
+}
+
+// return the package imported with the given name in the current scope,
+// if it's different from path
+func (c *Comp) importCollision(name string, path string) *Import {
+	bind := c.Binds[name]
+	if bind == nil || bind.Desc.Class() != ConstBind {
+		return nil
+	}
+	if other, ok := bind.Value.(*Import); ok && other.Path != path {
+		return other
+	}
+	return nil
+}
+
+// choose the alias for importing path, whose package name is already used in the current scope
+// by the different package other.
+// Returns an *ImportAliasError if option OptStrictImportAlias is set
+func (c *Comp) importAutoAlias(name string, path string, other *Import) (string, error) {
+	if alias := c.importAlias(path); len(alias) != 0 {
+		// path was already auto-aliased in this scope: reuse the same alias
+		return alias, nil
+	}
+	err := c.newImportAliasError(name, path, other.Path)
+	if c.Options&base.OptStrictImportAlias != 0 {
+		return "", err
+	}
+	alias := err.Suggested[len(err.Suggested)-1]
+	c.Warnf("import %q: package name %s already refers to %q, imported as %s", path, name, other.Path, alias)
+	return alias, nil
+}
+
+// return the name of path in the current scope, if it's already imported
+func (c *Comp) importAlias(path string) string {
+	for name, bind := range c.Binds {
+		if imp, ok := bind.Value.(*Import); ok && imp.Path == path && bind.Desc.Class() == ConstBind {
+			return name
+		}
+	}
+	return ""
+}
+
+// return an ImportAliasError suggesting unused aliases for path.
+// The last suggestion is always name followed by the smallest unused numeric suffix,
+// which is the alias chosen automatically when OptStrictImportAlias is not set
+func (c *Comp) newImportAliasError(name string, path string, otherpath string) *ImportAliasError {
+	var suggested []string
+	// prefix name with the parent directory, as cryptorand for "crypto/rand"
+	if dir := paths.RemoveLastByte(paths.DirName(path)); len(dir) != 0 {
+		alias := paths.FileName(dir) + name
+		if token.IsIdentifier(alias) && c.Binds[alias] == nil {
+			suggested = append(suggested, alias)
+		}
+	}
+	for i := 2; ; i++ {
+		if alias := name + strconv.Itoa(i); c.Binds[alias] == nil {
+			suggested = append(suggested, alias)
+			break
+		}
+	}
+	return &ImportAliasError{Path: path, Name: name, OtherPath: otherpath, Suggested: suggested}
+}
+
 // Import compiles an import statement
 func (c *Comp) Import(node ast.Spec) {
+	name, path := c.importSpec(node)
+	// yes, we support local imports
+	// i.e. a function or block can import packages
+	imp := c.ImportPackage(name, path)
+	c.noteImport(node, name, imp)
+}
+
+// ImportGroup compiles an import ( ... ) statement group.
+// Packages not imported yet are independent from each other,
+// so they are loaded and compiled concurrently, then declared in order
+func (c *Comp) ImportGroup(nodes []ast.Spec) {
+	g := c.CompGlobals
+	var names, paths, todo []string
+	for _, node := range nodes {
+		name, path := c.importSpec(node)
+		names = append(names, name)
+		paths = append(paths, path)
+		if g.KnownImports[path] == nil && !containsString(todo, path) {
+			todo = append(todo, path)
+		}
+	}
+	errs := make(map[string]error)
+	if len(todo) > 1 {
+		aliases := make([]string, len(todo))
+		for i, path := range todo {
+			for j := range paths {
+				if paths[j] == path {
+					aliases[i] = names[j]
+					break
+				}
+			}
+		}
+		refs, errlist := g.Importer.ImportPackagesOrError(
+			aliases, todo, g.Options&base.OptModuleImport != 0)
+		for i, path := range todo {
+			g.showImportTiming(path)
+			if errlist[i] != nil {
+				errs[path] = errlist[i]
+			} else {
+				g.KnownImports[path] = g.NewImport(refs[i])
+			}
+		}
+	}
+	for i, path := range paths {
+		if err := errs[path]; err != nil {
+			panic(err)
+		}
+		imp := c.ImportPackage(names[i], path)
+		c.noteImport(nodes[i], names[i], imp)
+	}
+}
+
+// return the name and sanitized path of an import spec
+func (c *Comp) importSpec(node ast.Spec) (name string, path string) {
 	switch node := node.(type) {
 	case *ast.ImportSpec:
 		str := node.Path.Value
-		path, err := strconv.Unquote(str)
+		var err error
+		path, err = strconv.Unquote(str)
 		if err != nil {
 			c.Errorf("error unescaping import path %q: %v", str, err)
 		}
 		path = c.sanitizeImportPath(path)
-		var name string
 		if node.Name != nil {
 			name = node.Name.Name
 		}
-		// yes, we support local imports
-		// i.e. a function or block can import packages
-		c.ImportPackage(name, path)
 	default:
 		c.Errorf("unimplemented import: %v", node)
 	}
+	return name, path
+}
+
+func containsString(list []string, str string) bool {
+	for _, elem := range list {
+		if elem == str {
+			return true
+		}
+	}
+	return false
 }
 
 func (g *CompGlobals) sanitizeImportPath(path string) string {
 	path = strings.Replace(path, "\\", "/", -1)
+	if genimport.IsLocalImport(path) {
+		return g.localImportPath(path)
+	}
 	l := len(path)
 	if path == ".." || l >= 3 && (path[:3] == "../" || path[l-3:] == "/..") || strings.Contains(path, "/../") {
 		g.Errorf("invalid import %q: contains \"..\"", path)
@@ -203,6 +375,27 @@ func (g *CompGlobals) sanitizeImportPath(path string) string {
 	return path
 }
 
+// localImportPath converts a relative import path as "./foo" or "../foo"
+// to the path of a package inside a module.
+// It is resolved against the directory of the file being evaluated,
+// or against the current directory in the REPL
+func (g *CompGlobals) localImportPath(path string) string {
+	if g.Options&base.OptModuleImport == 0 {
+		g.Errorf("invalid import %q: relative imports require option %v", path, base.OptModuleImport)
+	}
+	dir := "."
+	if len(g.Filepath) != 0 {
+		if info, err := os.Stat(g.Filepath); err == nil && !info.IsDir() {
+			dir = filepath.Dir(g.Filepath)
+		}
+	}
+	pkgpath, err := g.Importer.LocalImport(path, dir)
+	if err != nil {
+		g.Errorf("invalid import %q: %v", path, err)
+	}
+	return pkgpath
+}
+
 // declDotImport0 compiles an import declaration.
 // Note: does not loads proxies, use ImportPackage for that
 func (c *Comp) declImport0(name string, imp *Import) {
@@ -396,7 +589,7 @@ func (g *CompGlobals) loadProxy(name string, proxy r.Type, xtype xr.Type) {
 func (imp *Import) selectorPlace(c *Comp, name string, opt PlaceOption) *Place {
 	bind, ok := imp.Binds[name]
 	if !ok {
-		c.Errorf("package %v %q has no symbol %s", imp.Name, imp.Path, name)
+		imp.undefinedSymbol(name, c.Position().String())
 	}
 	class := bind.Desc.Class()
 	if bind.Desc.Index() != NoIndex {
@@ -431,7 +624,7 @@ func (imp *Import) selectorPlace(c *Comp, name string, opt PlaceOption) *Place {
 func (imp *Import) selector(name string, st *output.Stringer) *Expr {
 	bind, ok := imp.Binds[name]
 	if !ok {
-		st.Errorf("package %v %q has no symbol %s", imp.Name, imp.Path, name)
+		imp.undefinedSymbol(name, st.Position().String())
 	}
 	switch bind.Desc.Class() {
 	case ConstBind:
@@ -446,6 +639,63 @@ func (imp *Import) selector(name string, st *output.Stringer) *Expr {
 	}
 }
 
+// importedGenericFunc compiles pkg.Func[T1, T2...] where pkg is an imported package
+// and Func is a compiled generic function: the interpreter cannot instantiate it,
+// so the import bindings contain its explicit instantiations for the most common type arguments.
+// return nil if node is not such an expression
+func (c *Comp) importedGenericFunc(node *ast.IndexExpr) *Expr {
+	sel, ok := node.X.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	sym := c.TryResolve(ident.Name)
+	if sym == nil || sym.Desc.Class() != ConstBind {
+		return nil
+	}
+	imp, ok := sym.Value.(*Import)
+	if !ok {
+		return nil
+	}
+	name := sel.Sel.Name
+	prefix := name + "["
+	var instances []string
+	for key := range imp.Binds {
+		if strings.HasPrefix(key, prefix) {
+			instances = append(instances, key)
+		}
+	}
+	if len(instances) == 0 {
+		// not a generic function
+		return nil
+	}
+	var targs []ast.Expr
+	if list, ok := node.Index.(*ast.CompositeLit); ok && list.Type == nil {
+		targs = list.Elts
+	} else {
+		targs = []ast.Expr{node.Index}
+	}
+	var buf strings.Builder
+	buf.WriteString(prefix)
+	for i, targ := range targs {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(c.Type(targ).ReflectType().String())
+	}
+	buf.WriteByte(']')
+	key := buf.String()
+	if _, ok := imp.Binds[key]; !ok {
+		sort.Strings(instances)
+		c.Errorf("generic function %s.%s has no compiled instantiation %s, available instantiations are: %s",
+			imp.Name, name, key[len(name):], strings.Join(instances, " "))
+	}
+	return imp.selector(key, &c.Stringer)
+}
+
 // create an expression that will return the value of imported variable described by bind.
 //
 // mandatory optimization: for basic kinds, unwrap reflect.Value
@@ -532,6 +782,14 @@ func (imp *Import) symbol(bind *Bind, st *output.Stringer) *Expr {
 			return v.String()
 		}
 	default:
+		if bind.Desc.Class() == FuncBind {
+			// read imp.Vals[] at runtime: Interp.Mock() may replace imported functions
+			binds := imp.EnvBinds
+			fun = func(*Env) xr.Value {
+				return binds.Vals[idx]
+			}
+			break
+		}
 		fun = func(*Env) xr.Value {
 			return v
 		}
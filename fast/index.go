@@ -31,10 +31,10 @@ import (
 
 func (c *Comp) indexExpr(node *ast.IndexExpr, multivalued bool) *Expr {
 	obj := c.Expr1(node.X, nil)
-	idx := c.Expr1(node.Index, nil)
 	if obj.Untyped() {
 		obj.ConstTo(obj.DefaultType())
 	}
+	idx := c.Expr1(node.Index, shiftHint(node.Index, c.indexType(obj.Type)))
 
 	t := obj.Type
 	var ret *Expr
@@ -65,6 +65,15 @@ func (c *Comp) indexExpr(node *ast.IndexExpr, multivalued bool) *Expr {
 	}
 	return ret
 }
+
+// return the type expected for indexes of t: the key type of maps, otherwise int
+func (c *Comp) indexType(t xr.Type) xr.Type {
+	if t != nil && t.Kind() == r.Map {
+		return t.Key()
+	}
+	return c.TypeOfInt()
+}
+
 func (c *Comp) vectorIndex(node *ast.IndexExpr, obj *Expr, idx *Expr) *Expr {
 	k := idx.Type.Kind()
 	cat := reflect.Category(k)
@@ -882,10 +891,10 @@ func (c *Comp) mapIndex1(node *ast.IndexExpr, obj *Expr, idx *Expr) *Expr {
 }
 func (c *Comp) IndexPlace(node *ast.IndexExpr, opt PlaceOption) *Place {
 	obj := c.Expr1(node.X, nil)
-	idx := c.Expr1(node.Index, nil)
 	if obj.Untyped() {
 		obj.ConstTo(obj.DefaultType())
 	}
+	idx := c.Expr1(node.Index, shiftHint(node.Index, c.indexType(obj.Type)))
 
 	t := obj.Type
 	switch t.Kind() {
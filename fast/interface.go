@@ -20,9 +20,12 @@ import (
 	"fmt"
 	"go/ast"
 	r "reflect"
+	"strings"
+	"sync"
 
 	"github.com/cosmos72/gomacro/base"
 	"github.com/cosmos72/gomacro/base/reflect"
+	"github.com/cosmos72/gomacro/go/typeutil"
 	xr "github.com/cosmos72/gomacro/xreflect"
 )
 
@@ -71,11 +74,23 @@ func (c *Comp) converterToProxy(tin xr.Type, tout xr.Type) func(val xr.Value) xr
 	rtout := tout.ReflectType()       // a compiled interface
 	rtproxy := c.InterfaceProxy(tout) // one of our proxies that pre-implement the compiled interface
 
+	if tin.Kind() == r.Interface {
+		return c.converterFromInterface(tin, tout)
+	}
+	// methods with pointer receiver are in the method set of *T but not of T
+	if !tin.Implements(tout) {
+		c.Errorf("cannot convert type <%v> to interface <%v>%s", tin, tout, interfaceMissingMethod(tin, tout))
+	}
+	tsrc := tin
+	if tin.Kind() == r.Ptr && tin.Name() == "" {
+		// xr.Type.MethodByName wants T, not *T, even for methods with pointer receiver
+		tsrc = tin.Elem()
+	}
 	vtable := xr.NewR(rtproxy).Elem()
 	n := rtout.NumMethod()
 	for i := 0; i < n; i++ {
 		mtdout := rtout.Method(i)
-		mtdin, count := tin.MethodByName(mtdout.Name, mtdout.PkgPath)
+		mtdin, count := tsrc.MethodByName(mtdout.Name, mtdout.PkgPath)
 		if count == 0 {
 			c.Errorf("cannot convert type <%v> to interface <%v>: missing method %s %s", tin, rtout, mtdout.PkgPath, mtdout.Name)
 		} else if count > 1 {
@@ -86,24 +101,11 @@ func (c *Comp) converterToProxy(tin xr.Type, tout xr.Type) func(val xr.Value) xr
 		// c.Debugf("type %v proxy %v method %s = %v // %v", tin.Name(), tout.Name(), mtdin.Name, e.Value, e.Type)
 		setProxyField(vtable.Field(i+1), xr.ValueOf(e.Value))
 	}
-	extractor := c.extractor(tin)
-	if extractor == nil {
-		return func(val xr.Value) xr.Value {
-			vaddr := xr.NewR(rtproxy)
-			vproxy := vaddr.Elem()
-			vproxy.Set(vtable)
-			vproxy.Field(0).Set(xr.ValueOf(xr.MakeInterfaceHeader(val, tin)))
-			return convert(vaddr, rtout)
-		}
-	}
-	// extract object from tin proxy or emulated interface (if any),
-	// and wrap it in tout proxy
 	return func(val xr.Value) xr.Value {
-		v, t := extractor(val)
 		vaddr := xr.NewR(rtproxy)
 		vproxy := vaddr.Elem()
 		vproxy.Set(vtable)
-		vproxy.Field(0).Set(xr.ValueOf(xr.MakeInterfaceHeader(v, t)))
+		vproxy.Field(0).Set(xr.ValueOf(xr.MakeInterfaceHeader(val, tin)))
 		return convert(vaddr, rtout)
 	}
 }
@@ -121,8 +123,18 @@ func setProxyField(place xr.Value, mtd xr.Value) {
 			rcall = r.Value.CallSlice
 		}
 		rmtd := mtd.ReflectValue()
+		// method with value receiver, stored in the proxy as a pointer
+		var deref bool
+		if rtin.NumIn() != 0 {
+			k := rtin.In(0).Kind()
+			deref = k != r.Ptr && k != r.Interface
+		}
 		rfunc := r.MakeFunc(rtout, func(args []r.Value) []r.Value {
-			args[0] = args[0].Interface().(xr.InterfaceHeader).Value().ReflectValue()
+			recv := args[0].Interface().(xr.InterfaceHeader).Value().ReflectValue()
+			if deref && recv.Kind() == r.Ptr {
+				recv = recv.Elem()
+			}
+			args[0] = recv
 			return rcall(rmtd, args)
 		})
 		place.Set(xr.MakeValue(rfunc))
@@ -161,11 +173,55 @@ func (g *CompGlobals) extractFromProxy(v xr.Value) (xr.Value, xr.Type) {
 	return v, xt
 }
 
+// converterToInterface returns a function that converts a value with concrete type 'tin'
+// into the interface type 'tout', which can be compiled or emulated.
+// Used at runtime by type assertions, when 'tin' is only known after extracting
+// the value from a proxy or emulated interface
+func (c *Comp) converterToInterface(tin, tout xr.Type) func(val xr.Value) xr.Value {
+	rtin, rtout := tin.ReflectType(), tout.ReflectType()
+	switch {
+	case xr.IsEmulatedInterface(tout):
+		return c.converterToEmulatedInterface(tin, tout)
+	case rtin == rtout || rtin.Implements(rtout):
+		return func(val xr.Value) xr.Value {
+			return convert(val, rtout)
+		}
+	default:
+		return c.converterToProxy(tin, tout)
+	}
+}
+
+// typeAssertToInterface checks at runtime whether the value v, with concrete type t, implements
+// the interface type tout. If t is nil, the concrete type is the reflect.Type of v.
+// Uses the method set of t, which contains methods with pointer receiver only if t is a pointer.
+// Returns v converted to tout and true, or the zero value and false
+func (c *Comp) typeAssertToInterface(v xr.Value, t xr.Type, tout xr.Type) (xr.Value, bool) {
+	if !v.IsValid() {
+		return xr.Value{}, false
+	}
+	if t == nil {
+		rt := v.Type()
+		if !xr.IsEmulatedInterface(tout) {
+			if rtout := tout.ReflectType(); rt == rtout || rt.Implements(rtout) {
+				return convert(v, rtout), true
+			}
+			return xr.Value{}, false
+		}
+		t = c.Universe.FromReflectType(rt)
+	}
+	if !t.Implements(tout) {
+		return xr.Value{}, false
+	}
+	return c.converterToInterface(t, tout)(v), true
+}
+
 // converterToProxy compiles a conversion from 'tin' into the emulated interface type 'tout'
 // and returns a function that performs such conversion
 func (c *Comp) converterToEmulatedInterface(tin, tout xr.Type) func(val xr.Value) xr.Value {
 	if !tin.Implements(tout) {
 		c.Errorf("cannot convert from <%v> to <%v>", tin, tout)
+	} else if tin.Kind() == r.Interface {
+		return c.converterFromInterface(tin, tout)
 	}
 	n := tout.NumMethod()
 	obj2methodFuncs := make([]func(xr.Value) xr.Value, n)
@@ -196,18 +252,40 @@ func (c *Comp) converterToEmulatedInterface(tin, tout xr.Type) func(val xr.Value
 		}
 	}
 	rtout := tout.ReflectType()
+	return func(obj xr.Value) xr.Value {
+		return xr.ToEmulatedInterface(rtout, obj, tin, obj2methodFuncs)
+	}
+}
 
+// converterFromInterface compiles a conversion from the interface type 'tin'
+// into the interface type 'tout', which can be compiled or emulated.
+//
+// The methods of tin cannot be stored in tout proxy or emulated interface:
+// they would hide the concrete type of the value from type assertions and type switches.
+// Thus extract the value from tin proxy or emulated interface (if any),
+// and wrap it in tout using the methods of its concrete type, only known at runtime.
+// The conversion for each concrete type is compiled once and cached
+func (c *Comp) converterFromInterface(tin, tout xr.Type) func(val xr.Value) xr.Value {
 	extractor := c.extractor(tin)
-	if extractor == nil {
-		return func(obj xr.Value) xr.Value {
-			return xr.ToEmulatedInterface(rtout, obj, tin, obj2methodFuncs)
-		}
-	}
-	// extract object from tin proxy or emulated interface (if any),
-	// and wrap it in tout emulated interface
+	zero := xr.ZeroR(tout.ReflectType())
+	var lock sync.Mutex
+	var cache typeutil.Map // map types.Type -> func(xr.Value) xr.Value
 	return func(obj xr.Value) xr.Value {
 		v, t := extractor(obj)
-		return xr.ToEmulatedInterface(rtout, v, t, obj2methodFuncs)
+		if !v.IsValid() {
+			// nil interface
+			return zero
+		} else if t == nil {
+			t = c.Universe.FromReflectType(v.Type())
+		}
+		lock.Lock()
+		conv, _ := cache.At(t.GoType()).(func(xr.Value) xr.Value)
+		if conv == nil {
+			conv = c.converterToInterface(t, tout)
+			cache.Set(t.GoType(), conv)
+		}
+		lock.Unlock()
+		return conv(v)
 	}
 }
 
@@ -224,14 +302,36 @@ func (g *CompGlobals) extractor(tin xr.Type) func(xr.Value) (xr.Value, xr.Type)
 }
 
 // return the error "\n\treason: t does not implement tinterf: missing method <method>"
+// return the empty string if tinterf is not an interface or t has all its methods
 func interfaceMissingMethod(t, tinterf xr.Type) string {
-	var s string
-	if tinterf.Kind() == r.Interface {
-		s = fmt.Sprintf("\n\treason: %v does not implement %v", t, tinterf)
-		missingmtd := xr.MissingMethod(t, tinterf)
-		if missingmtd != nil {
-			s = fmt.Sprintf("%s: missing method %s", s, missingmtd.String())
-		}
+	if tinterf == nil || tinterf.Kind() != r.Interface {
+		return ""
+	}
+	if s := methodMismatches(t, tinterf); len(s) != 0 {
+		return fmt.Sprintf("\n\treason: %v does not implement %v%s", t, tinterf, s)
+	}
+	return ""
+}
+
+// return ": missing method <method>" or, if several methods are missing or have
+// the wrong signature, the list of such methods one per line.
+// return the empty string if t has all the methods of interface tinterf
+func methodMismatches(t, tinterf xr.Type) string {
+	return formatMethodMismatches(xr.MethodMismatches(t, tinterf))
+}
+
+func formatMethodMismatches(mismatches []xr.MethodMismatch) string {
+	switch len(mismatches) {
+	case 0:
+		return ""
+	case 1:
+		return ": " + mismatches[0].String()
+	}
+	var buf strings.Builder
+	buf.WriteByte(':')
+	for _, mismatch := range mismatches {
+		buf.WriteString("\n\t\t")
+		buf.WriteString(mismatch.String())
 	}
-	return s
+	return buf.String()
 }
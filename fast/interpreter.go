@@ -61,10 +61,14 @@ func newTopInterp(path string) *Interp {
 		proxy2interf: make(map[r.Type]xr.Type),
 		Prompt:       "gomacro> ",
 		Jit:          NewJit(),
+		sessionEnv:   newSessionEnv(),
 	}
+	// packages imported by this interpreter are visible only to interpreters sharing its Universe
+	cg.Importer.SetRegistry(universe.Imports)
+	universe.Imports.Store(SessionEnvPath, cg.sessionEnv.pkg())
 
 	goid := gls.GoID()
-	run := &Run{IrGlobals: g, goid: goid}
+	run := &Run{IrGlobals: g, goid: goid, interruptCh: make(chan struct{}, 1)}
 	// early register run in goroutine-local data
 	g.gls[goid] = run
 
@@ -146,7 +150,7 @@ func (ir *Interp) SetDebugger(debugger Debugger) {
 }
 
 func (ir *Interp) Interrupt(os.Signal) {
-	ir.env.Run.interrupt()
+	ir.env.Run.interruptEval()
 }
 
 // ============================================================================
@@ -192,6 +196,88 @@ func (ir *Interp) DeclVar(name string, t xr.Type, value I) {
 	ir.apply()
 }
 
+// Bind declares a variable for each name => value in vars,
+// hiding any previous declaration with the same name.
+// Returns a function that removes such variables and restores
+// the hidden declarations: useful to expose per-request host objects
+// to interpreted code without permanently polluting the global scope:
+//
+//	undo := ir.Bind(map[string]interface{}{"req": req, "db": db})
+//	defer undo()
+//
+// nil values are declared with type interface{}.
+//
+// undo also zeroes the variables and lets later calls to Bind reuse their slots,
+// unless functions or closures compiled while the variables were bound reference them,
+// or their address was taken: such variables keep their value, as captured variables in Go
+func (ir *Interp) Bind(vars map[string]interface{}) (undo func()) {
+	c := ir.Comp
+	oldbinds := make(map[string]*Bind, len(vars))
+	newbinds := make(map[string]*Bind, len(vars))
+	for name, value := range vars {
+		oldbinds[name] = c.Binds[name]
+		// allocate a new slot instead of reusing the hidden declaration's one
+		delete(c.Binds, name)
+		var t xr.Type
+		if value == nil {
+			t = c.TypeOfInterface()
+		}
+		ir.DeclVar(name, t, value)
+		bind := c.Binds[name]
+		newbinds[name] = bind
+		if c.scopedBinds == nil {
+			c.scopedBinds = make(map[BindDescriptor]bool)
+		}
+		c.scopedBinds[bind.Desc] = false
+	}
+	return func() {
+		if c.Binds == nil {
+			return
+		}
+		for name, oldbind := range oldbinds {
+			bind := newbinds[name]
+			captured := c.scopedBinds[bind.Desc]
+			delete(c.scopedBinds, bind.Desc)
+			if !captured && c.Binds[name] == bind {
+				// neither referenced by functions nor redeclared in the meantime: its slot can be reused
+				ir.freeBind(bind)
+			}
+			if oldbind != nil {
+				c.Binds[name] = oldbind
+			} else {
+				delete(c.Binds, name)
+			}
+		}
+	}
+}
+
+// zero the variable declared by Interp.Bind and add its slot to c.freeBinds
+func (ir *Interp) freeBind(bind *Bind) {
+	c, env := ir.Comp, ir.PrepareEnv()
+	index := bind.Desc.Index()
+	switch bind.Desc.Class() {
+	case VarBind:
+		env.Vals[index] = xr.Value{}
+	case IntBind:
+		env.Ints[index] = 0
+		if bind.Type.Kind() == r.Complex128 {
+			env.Ints[index+1] = 0
+		}
+	default:
+		return
+	}
+	c.freeBinds = append(c.freeBinds, bind)
+}
+
+// Unbind removes the declarations of the specified names from the current package.
+// Code already compiled that references them is not affected.
+func (ir *Interp) Unbind(names ...string) {
+	c := ir.Comp
+	for _, name := range names {
+		delete(c.Binds, name)
+	}
+}
+
 // apply executes the compiled declarations, statements and expressions,
 // then clears the compiled buffer
 func (ir *Interp) apply() {
@@ -265,7 +351,7 @@ func (ir *Interp) Eval(src string) ([]xr.Value, []xr.Type) {
 func (ir *Interp) EvalFile(filepath string) (comments string, err error) {
 	g := ir.Comp.CompGlobals
 	saveFilename := g.Filepath
-	f, err := os.Open(filepath)
+	f, err := g.fileSystem().Open(filepath)
 	if err != nil {
 		return "", err
 	}
@@ -274,9 +360,23 @@ func (ir *Interp) EvalFile(filepath string) (comments string, err error) {
 		g.Filepath = saveFilename
 	}()
 	g.Filepath = filepath
-	return ir.EvalReader(f)
+	defer ir.collectHotspots()()
+	defer g.endFile(g.beginFile())
+	comments, err = ir.EvalReader(f)
+	if err == nil {
+		err = g.reportUnusedImports()
+	}
+	return comments, err
 }
 
+// EvalReader reads, compiles and executes toplevel statements from src,
+// which can also be a stream as a pipe or a network connection:
+// each statement is executed as soon as it has been read completely.
+// Positions in error messages are relative to the beginning of src.
+// Returns io.ErrUnexpectedEOF, with position, if src ends in the middle of a statement.
+//
+// The comments before the first statement can contain lines "//gomacro:require MODULE VERSION":
+// they pin the version of MODULE used when src imports its packages, see genimport.Importer.Require
 func (ir *Interp) EvalReader(src io.Reader) (comments string, err error) {
 	g := ir.Comp.CompGlobals
 	savein := g.Readline
@@ -300,18 +400,31 @@ func (ir *Interp) EvalReader(src io.Reader) (comments string, err error) {
 	}()
 
 	// perform the first iteration manually, to collect comments
-	str, firstToken := g.ReadMultiline(base.ReadOptCollectAllComments, g.Prompt)
-	if firstToken >= 0 {
+	str, firstToken, rerr := ir.readStatement(base.ReadOptCollectAllComments)
+	if firstToken >= 0 && rerr != io.ErrUnexpectedEOF {
 		comments = str[0:firstToken]
-		if firstToken > 0 {
-			str = str[firstToken:]
-			g.IncLine(comments)
+		str = str[firstToken:]
+		// pin the versions of imported modules, as //gomacro:require github.com/fatih/color v1.16.0
+		if err := g.Importer.RequireDirectives(comments); err != nil {
+			rterr := ir.Comp.MakeRuntimeError("%v", err)
+			if g.Options&base.OptTrapPanic == 0 {
+				return comments, rterr
+			}
+			// report it as the REPL reports compile errors, then continue
+			g.Fprintf(g.Stderr, "%v\n", rterr)
 		}
 	}
-
-	if ir.ParseEvalPrint(str) {
-		for ir.ReadParseEvalPrint() {
+	for {
+		if rerr == io.ErrUnexpectedEOF {
+			return comments, ir.incompleteStatement(str, firstToken)
+		}
+		if firstToken >= 0 && !ir.ParseEvalPrint(str) {
+			break
+		}
+		if rerr == io.EOF {
+			break
 		}
+		str, firstToken, rerr = ir.readStatement(0)
 	}
 	return comments, nil
 }
@@ -0,0 +1,117 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * lambda.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// return true if node is a lambda x => expr or \x -> expr
+// i.e. a function literal without parameter types.
+// Lambdas are only produced by the parser if option OptExtLambdas is set
+func isLambda(node ast.Expr) bool {
+	for {
+		paren, ok := node.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		node = paren.X
+	}
+	lit, ok := node.(*ast.FuncLit)
+	if !ok || lit.Type == nil || lit.Type.Results != nil {
+		return false
+	}
+	params := lit.Type.Params
+	return params != nil && len(params.List) == 1 && params.List[0].Type == nil
+}
+
+// return t if node is a lambda, otherwise return nil.
+// Used to pass the expected type only to lambdas, which need it to infer their parameter types
+func lambdaHint(node ast.Expr, t xr.Type) xr.Type {
+	if t != nil && isLambda(node) {
+		return t
+	}
+	return nil
+}
+
+// return t if node needs the expected type t to be compiled, otherwise return nil:
+// lambdas need it to infer their parameter types, and binary expressions
+// to convert untyped constants shifted by a non-constant count
+func exprHint(node ast.Expr, t xr.Type) xr.Type {
+	if hint := lambdaHint(node, t); hint != nil {
+		return hint
+	}
+	return shiftHint(node, t)
+}
+
+// Lambda compiles a lambda x => expr or \x -> expr
+// inferring its parameter and result types from the expected function type t
+func (c *Comp) Lambda(lit *ast.FuncLit, t xr.Type) *Expr {
+	params := lit.Type.Params.List[0].Names
+	if t == nil {
+		c.Errorf("cannot infer parameter types of lambda, it can only be used where a function type is expected: %v", lit)
+	} else if t.Kind() != xr.Func {
+		c.Errorf("cannot use lambda as <%v>: not a function type: %v", t, lit)
+	} else if t.NumIn() != len(params) {
+		c.Errorf("cannot use lambda with %d parameters as <%v>: %v", len(params), t, lit)
+	}
+	nin, nout := t.NumIn(), t.NumOut()
+	tin := make([]xr.Type, nin)
+	for i := range tin {
+		tin[i] = t.In(i)
+	}
+	tout := make([]xr.Type, nout)
+	for i := range tout {
+		tout[i] = t.Out(i)
+	}
+	// use the unnamed function type: it is assignable to t even if t is a named type
+	tfunc := c.Universe.FuncOf(tin, tout, t.IsVariadic())
+
+	paramnames := make([]string, nin)
+	for i, param := range params {
+		paramnames[i] = param.Name
+	}
+	body := lit.Body
+	if body.Lbrace == token.NoPos && nout == 0 && len(body.List) == 1 {
+		// expression body: the parser wrapped it in a return statement,
+		// but t has no results. evaluate the expression and discard its values
+		if ret, ok := body.List[0].(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+			body = &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: ret.Results[0]}}}
+		}
+	}
+	return c.funcLit(lit.Type, tfunc, paramnames, make([]string, nout), body)
+}
+
+// return the expected type of node.Args[i] if it is a lambda and t is a function type, otherwise return nil
+func (c *Comp) lambdaArgType(node *ast.CallExpr, t xr.Type, i int) xr.Type {
+	if t.Kind() != xr.Func || !isLambda(node.Args[i]) {
+		return nil
+	}
+	n := t.NumIn()
+	if t.IsVariadic() && i >= n-1 {
+		if node.Ellipsis != token.NoPos {
+			return t.In(n - 1)
+		}
+		return t.In(n - 1).Elem()
+	} else if i >= n {
+		return nil
+	}
+	return t.In(i)
+}
@@ -0,0 +1,107 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * lazyimport.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"sync"
+
+	"github.com/cosmos72/gomacro/base/genimport"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// hasLazyImports returns true if body contains import declarations
+// of packages that are not loaded yet: importing them requires
+// generating and compiling a plugin, which is slow.
+// Relative imports are not considered, because they depend on the current file
+func (c *Comp) hasLazyImports(body *ast.BlockStmt) bool {
+	g := c.CompGlobals
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		if found {
+			return false
+		}
+		decl, ok := node.(*ast.GenDecl)
+		if !ok {
+			return true
+		} else if decl.Tok != token.IMPORT {
+			return false
+		}
+		for _, spec := range decl.Specs {
+			spec, ok := spec.(*ast.ImportSpec)
+			if !ok {
+				continue
+			}
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err == nil && !genimport.IsLocalImport(path) &&
+				g.KnownImports[path] == nil && !g.Importer.IsLoaded(path) {
+				found = true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// declFuncLazy compiles a top-level function declaration whose body imports packages not loaded yet.
+// Such packages are loaded, and the function body is compiled, only when the function is called
+// for the first time: programs that never call the function do not pay for the imports.
+// Compile errors in the function body are reported at that time too.
+func (c *Comp) declFuncLazy(funcdecl *ast.FuncDecl, t xr.Type, paramnames, resultnames []string, funcbind *Bind) Stmt {
+	funcname := funcdecl.Name.Name
+	funcindex := funcbind.Desc.Index()
+	variadic := t.IsVariadic()
+
+	// compile the function body and create the function, closed on env
+	create := func(env *Env) xr.Value {
+		cf := NewComp(c, nil)
+		info, resultfuns := cf.funcBinds(funcname, funcdecl.Type, t, paramnames, resultnames)
+		cf.Func = info
+		cf.noteReassigned(nil, funcdecl.Type, funcdecl.Body)
+		for _, node := range funcdecl.Body.List {
+			cf.Stmt(node)
+		}
+		cf.reportUnused()
+		c.saveFuncListing(funcbind, &cf.Code)
+		return cf.funcCreate(t, info, resultfuns, cf.Code.Exec())(env)
+	}
+	return func(env *Env) (Stmt, *Env) {
+		var lock sync.Mutex
+		var fun xr.Value
+		get := func() xr.Value {
+			lock.Lock()
+			defer lock.Unlock()
+			if !fun.IsValid() {
+				// on compile error, fun remains invalid: retry at next call
+				fun = create(env)
+				// later calls can skip the wrapper below
+				env.Vals[funcindex] = fun
+			}
+			return fun
+		}
+		env.Vals[funcindex] = xr.MakeFunc(t, func(args []xr.Value) []xr.Value {
+			if variadic {
+				return get().CallSlice(args)
+			}
+			return get().Call(args)
+		})
+		env.IP++
+		return env.Code[env.IP], env
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * library.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+
+	"github.com/cosmos72/gomacro/ast2"
+	"github.com/cosmos72/gomacro/base/output"
+	"github.com/cosmos72/gomacro/go/scanner"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// Error is the error returned by Library methods
+// when parsing, compiling or executing interpreted code fails
+type Error struct {
+	Phase EventKind      // EventParseError, EventCompileError or EventRuntimeError
+	Pos   token.Position // position of the error in interpreted code. Invalid if unknown
+	Err   error          // the underlying error
+	// for EventRuntimeError, the value passed to panic() by interpreted code
+	// or by the Go runtime. nil for the other phases
+	Panic interface{}
+}
+
+func (err *Error) Error() string {
+	return err.Err.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Library is a view of an Interp for programs that use the interpreter as a library:
+// its methods mirror the ones of Interp, but they never panic.
+// Internal panics, caused by invalid source code, failed imports
+// or panics in interpreted code, are converted to *Error at the API boundary.
+//
+// Interp methods that already return an error, as Interp.LoadFile or Interp.Mock,
+// are not repeated here
+type Library struct {
+	ir *Interp
+}
+
+// Library returns a view of ir whose methods return errors instead of panicking
+func (ir *Interp) Library() Library {
+	return Library{ir}
+}
+
+// Interp returns the interpreter wrapped by lib
+func (lib Library) Interp() *Interp {
+	return lib.ir
+}
+
+// Parse parses and macroexpands src
+func (lib Library) Parse(src string) (form ast2.Ast, err error) {
+	defer lib.recover(EventParseError, &err)
+	return lib.ir.Parse(src), nil
+}
+
+// Compile parses, macroexpands and compiles src without executing it
+func (lib Library) Compile(src string) (*Expr, error) {
+	form, err := lib.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return lib.CompileAst(form)
+}
+
+// CompileAst compiles an already parsed and macroexpanded form without executing it
+func (lib Library) CompileAst(form ast2.Ast) (expr *Expr, err error) {
+	defer lib.recover(EventCompileError, &err)
+	return lib.ir.CompileAst(form), nil
+}
+
+// RunExpr executes a compiled expression
+func (lib Library) RunExpr(e *Expr) ([]xr.Value, []xr.Type, error) {
+	return lib.runIn(func() ([]xr.Value, []xr.Type) {
+		return lib.ir.RunExpr(e)
+	})
+}
+
+func (lib Library) runIn(run func() ([]xr.Value, []xr.Type)) (values []xr.Value, types []xr.Type, err error) {
+	defer lib.recover(EventRuntimeError, &err)
+	values, types = run()
+	return values, types, nil
+}
+
+// Eval parses, macroexpands, compiles and executes src
+func (lib Library) Eval(src string) ([]xr.Value, []xr.Type, error) {
+	expr, err := lib.Compile(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lib.RunExpr(expr)
+}
+
+// Eval1 is equivalent to Eval, but returns only the first value.
+// Returns an error if src produces no values
+func (lib Library) Eval1(src string) (xr.Value, xr.Type, error) {
+	expr, err := lib.Compile(src)
+	if err == nil && (expr == nil || expr.NumOut() == 0) {
+		err = &Error{Phase: EventCompileError, Err: fmt.Errorf("expression returns no values: %s", src)}
+	}
+	if err != nil {
+		return xr.Value{}, nil, err
+	}
+	values, types, err := lib.RunExpr(expr)
+	if err != nil {
+		return xr.Value{}, nil, err
+	}
+	return values[0], types[0], nil
+}
+
+// EvalWithReceiver is the equivalent of Interp.EvalWithReceiver that returns an error instead of panicking
+func (lib Library) EvalWithReceiver(src string, recv interface{}) ([]xr.Value, []xr.Type, error) {
+	form, err := lib.Parse(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, vals, expr, err := lib.compileWithReceiver(form, recv)
+	if err != nil || expr == nil {
+		return nil, nil, err
+	}
+	return lib.runIn(func() ([]xr.Value, []xr.Type) {
+		return lib.ir.runReceiverExpr(c, vals, expr)
+	})
+}
+
+func (lib Library) compileWithReceiver(form ast2.Ast, recv interface{}) (c *Comp, vals []xr.Value, expr *Expr, err error) {
+	defer lib.recover(EventCompileError, &err)
+	c, vals = lib.ir.receiverScope(recv)
+	return c, vals, lib.ir.compileAstIn(c, form), nil
+}
+
+// ImportPackage imports a package.
+// If alias is the empty string, it defaults to the identifier
+// specified in the package clause of the imported package
+func (lib Library) ImportPackage(alias, path string) (imp *Import, err error) {
+	defer lib.recover(EventCompileError, &err)
+	imp, err = lib.ir.ImportPackageOrError(alias, path)
+	if err != nil {
+		err = &Error{Phase: EventCompileError, Err: err}
+	}
+	return imp, err
+}
+
+// ChangePackage switches to package path, creating it if needed
+func (lib Library) ChangePackage(name, path string) (err error) {
+	defer lib.recover(EventCompileError, &err)
+	lib.ir.ChangePackage(name, path)
+	return nil
+}
+
+// DeclConst declares a constant
+func (lib Library) DeclConst(name string, t xr.Type, value I) (err error) {
+	defer lib.recover(EventCompileError, &err)
+	lib.ir.DeclConst(name, t, value)
+	return nil
+}
+
+// DeclFunc declares a function
+func (lib Library) DeclFunc(name string, fun I) (err error) {
+	defer lib.recover(EventCompileError, &err)
+	lib.ir.DeclFunc(name, fun)
+	return nil
+}
+
+// DeclType declares a type
+func (lib Library) DeclType(t xr.Type) (err error) {
+	defer lib.recover(EventCompileError, &err)
+	lib.ir.DeclType(t)
+	return nil
+}
+
+// DeclVar declares a variable
+func (lib Library) DeclVar(name string, t xr.Type, value I) (err error) {
+	defer lib.recover(EventCompileError, &err)
+	lib.ir.DeclVar(name, t, value)
+	return nil
+}
+
+// ValueOf retrieves the value of a constant, function or variable
+// in the current package. Returns an error if name is not declared
+func (lib Library) ValueOf(name string) (value xr.Value, err error) {
+	defer lib.recover(EventRuntimeError, &err)
+	if lib.ir.Comp.TryResolve(name) == nil {
+		return value, &Error{Phase: EventCompileError, Err: &UndefinedIdentifierError{Name: name}}
+	}
+	return lib.ir.ValueOf(name), nil
+}
+
+// convert a panic to *Error. Must be deferred
+func (lib Library) recover(phase EventKind, perr *error) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	err := panicToError(rec)
+	e := &Error{Phase: phase, Err: err}
+	var list scanner.ErrorList
+	if errors.As(err, &list) && len(list) != 0 {
+		e.Pos = list[0].Pos
+	} else if phase != EventRuntimeError {
+		e.Pos = lib.ir.Comp.Position()
+	}
+	if _, ok := err.(output.RuntimeError); ok {
+		// its message depends on the current position, which will change: freeze it
+		e.Err = errors.New(err.Error())
+	}
+	if phase == EventRuntimeError {
+		e.Panic = rec
+		if rerr, ok := err.(*InterpRuntimeError); ok {
+			e.Pos = rerr.Pos()
+			e.Panic = rerr.Err
+		}
+	}
+	*perr = e
+}
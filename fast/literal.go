@@ -31,6 +31,9 @@ import (
 )
 
 func (c *Comp) BasicLit(node *ast.BasicLit) *Expr {
+	if isBigNumLit(node) {
+		return c.BigNumLit(node)
+	}
 	str := node.Value
 	var kind untyped.Kind
 	var label string
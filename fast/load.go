@@ -0,0 +1,199 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * load.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cosmos72/gomacro/base"
+)
+
+// CompileErrors is the list of errors found while compiling a file, in order.
+// Returned by Interp.LoadFile() when requested to collect all the errors
+type CompileErrors []error
+
+func (errs CompileErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// LoadFile evaluates the toplevel declarations and statements in filepath.
+//
+// If allErrors is false, it executes each of them as soon as it has been compiled,
+// and stops at the first error.
+//
+// If allErrors is true, it first parses and compiles the whole file, continuing after each error
+// as the Go compiler does, and returns all of them as CompileErrors. The file is executed only if
+// there are no compile errors. In such case, execution stops at the first runtime error.
+// Note: the declarations that compiled successfully remain declared even if the file is not executed
+func (ir *Interp) LoadFile(filepath string, allErrors bool) (err error) {
+	g := ir.Comp.CompGlobals
+	if !allErrors {
+		saveopts := g.Options
+		g.Options &^= base.OptTrapPanic
+		defer func() {
+			g.Options = saveopts
+		}()
+		_, err = ir.EvalFile(filepath)
+		return err
+	}
+	f, err := g.fileSystem().Open(filepath)
+	if err != nil {
+		return err
+	}
+	saveFilename, savein, saveopts := g.Filepath, g.Readline, g.Options
+	defer func() {
+		f.Close()
+		g.Filepath, g.Readline, g.Options = saveFilename, savein, saveopts
+	}()
+	g.Filepath = filepath
+	g.Line = 0
+	g.Readline = base.MakeBufReadline(bufio.NewReader(f))
+	defer g.endFile(g.beginFile())
+	// loading a file: suppress prompt and printing expression results
+	g.Options &^= base.OptShowPrompt | base.OptShowEval | base.OptShowEvalType
+
+	var exprs []*Expr
+	var errs CompileErrors
+	for {
+		str, firstToken, rerr := ir.readStatement(0)
+		if rerr == io.ErrUnexpectedEOF {
+			errs = append(errs, ir.incompleteStatement(str, firstToken))
+			break
+		}
+		if firstToken >= 0 {
+			expr, cerr := ir.compileStatement(str[firstToken:])
+			if cerr != nil {
+				errs = append(errs, cerr)
+			} else if expr != nil {
+				exprs = append(exprs, expr)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		// after a syntax error, some uses of imported packages may be missing
+		if err := g.reportUnusedImports(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = panicToError(rec)
+		}
+	}()
+	for _, expr := range exprs {
+		ir.RunExpr(expr)
+	}
+	return nil
+}
+
+// parse, macroexpand and compile a single toplevel declaration or statement,
+// returning the error instead of panicking
+func (ir *Interp) compileStatement(src string) (expr *Expr, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			// format the error now: its position depends on the current line
+			g := &ir.Comp.Globals
+			msg := panicToError(rec).Error()
+			if prefix := g.Filepath + ":"; !strings.HasPrefix(msg, prefix) {
+				// some errors have no position: use the beginning of the statement
+				msg = fmt.Sprintf("%s%d: %s", prefix, g.Line+1, msg)
+			}
+			err = errors.New(msg)
+		}
+		ir.Comp.IncLine(src)
+	}()
+	return ir.CompileAst(ir.Parse(src)), nil
+}
+
+// LoadDir evaluates the files in directory dirpath, in alphabetical order, as LoadFile does.
+// As the Go toolchain does, it only loads the files whose name and build constraints
+// match ir.Comp.BuildContext: GOOS, GOARCH and build tags can be changed by modifying it.
+// Only files with extension .go or .gomacro are considered, and _test.go files are skipped.
+// Loading stops at the first file that contains errors
+func (ir *Interp) LoadDir(dirpath string, allErrors bool) error {
+	filenames, err := ir.buildFiles(dirpath)
+	if err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		if err = ir.LoadFile(filepath.Join(dirpath, filename), allErrors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// return the sorted names of the files in dirpath that match ir.Comp.BuildContext
+func (ir *Interp) buildFiles(dirpath string) ([]string, error) {
+	fsys := ir.Comp.fileSystem()
+	infos, err := fsys.ReadDir(dirpath)
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if !strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, ".gomacro") {
+			continue
+		}
+		match, err := matchBuildFile(&ir.Comp.BuildContext, fsys, dirpath, name)
+		if err != nil {
+			return nil, err
+		} else if match {
+			filenames = append(filenames, name)
+		}
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+// report whether file dirpath/name matches the GOOS, GOARCH and build tags of ctx,
+// checking both its name and its //go:build or // +build constraints.
+// The file is read from fsys
+func matchBuildFile(ctx *build.Context, fsys FileSystem, dirpath string, name string) (bool, error) {
+	filename := name
+	if strings.HasSuffix(name, ".gomacro") {
+		// build.Context.MatchFile() rejects unknown extensions:
+		// present the .gomacro file to it as if it was a .go file
+		name = strings.TrimSuffix(name, ".gomacro") + ".go"
+	}
+	fakectx := *ctx
+	fakectx.OpenFile = func(path string) (io.ReadCloser, error) {
+		return fsys.Open(filepath.Join(dirpath, filename))
+	}
+	return fakectx.MatchFile(dirpath, name)
+}
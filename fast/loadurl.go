@@ -0,0 +1,259 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * loadurl.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cosmos72/gomacro/ast2"
+	"github.com/cosmos72/gomacro/base"
+)
+
+// MaxURLSize is the maximum size of a file downloaded by Interp.LoadURL
+// and by import "https://..."
+var MaxURLSize int64 = 1 << 20
+
+// URLCacheDir is the directory where Interp.LoadURL and import "https://..." save the downloaded files.
+// If empty, it defaults to the subdirectory gomacro/url of the user cache directory
+var URLCacheDir string
+
+var urlClient = &http.Client{Timeout: 30 * time.Second}
+
+// return true if path is an URL, i.e. starts with https:// or http://
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// LoadURL downloads the Go source file at address, which must start with https://,
+// and evaluates it as Interp.LoadFile does. Positions in error messages are relative to address.
+// The file must be at most MaxURLSize bytes of UTF-8 text: web pages are rejected,
+// for example gists must be loaded from their "raw" URL.
+// The file is saved in the user cache directory: if downloading it fails later,
+// for example because the network is unreachable, the cached copy is used
+func (ir *Interp) LoadURL(address string, allErrors bool) error {
+	g := ir.Comp.CompGlobals
+	src, err := g.fetchURL(address)
+	if err != nil {
+		return err
+	}
+	savefs := g.fs
+	g.fs = urlFileSystem{FileSystem: g.fileSystem(), name: address, src: src}
+	defer func() {
+		g.fs = savefs
+	}()
+	return ir.LoadFile(address, allErrors)
+}
+
+// importURLs evaluates, as new interpreted packages, the URLs imported by form and not imported yet.
+// Requires option OptImportURL
+func (ir *Interp) importURLs(form ast2.Ast) {
+	g := ir.Comp.CompGlobals
+	for _, node := range ast2.ToNodes(form) {
+		decl, ok := node.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			spec, ok := spec.(*ast.ImportSpec)
+			if !ok {
+				continue
+			}
+			address, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || !isURL(address) || g.KnownImports[address] != nil {
+				continue
+			} else if g.Options&base.OptImportURL == 0 {
+				g.Errorf("cannot import %q: importing URLs requires option %v, see %cset importurl on",
+					address, base.OptImportURL, g.ReplCmdChar)
+			}
+			if err := ir.importURL(address); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// importURL downloads the Go source file at address and evaluates it as a new interpreted package,
+// whose import path is address. The package name is taken from the package clause,
+// or from the file name if there is none or it is "main"
+func (ir *Interp) importURL(address string) error {
+	g := ir.Comp.CompGlobals
+	src, err := g.fetchURL(address)
+	if err != nil {
+		return err
+	}
+	top := &Interp{ir.Comp.TopComp(), ir.env.Top()}
+	pkg := &Interp{NewComp(top.Comp, nil), NewEnv(top.env, 0, 0)}
+	if g.Options&base.OptDebugger != 0 {
+		pkg.env.DebugComp = pkg.Comp
+	}
+	pkg.Comp.Name = urlPackageName(address, src)
+	pkg.Comp.Path = address
+	pkg.env.FileEnv = pkg.env
+
+	run := pkg.env.Run
+	savepath, savefs := run.Globals.PackagePath, g.fs
+	run.Globals.PackagePath = address
+	g.fs = urlFileSystem{FileSystem: g.fileSystem(), name: address, src: src}
+	defer func() {
+		run.Globals.PackagePath, g.fs = savepath, savefs
+	}()
+	if err := pkg.LoadFile(address, false); err != nil {
+		return err
+	}
+	g.KnownImports[address] = pkg.asImport()
+	return nil
+}
+
+// return the package name declared by src, or the file name of address
+// if src has no package clause or declares package main
+func urlPackageName(address string, src []byte) string {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	if err == nil && file.Name != nil && file.Name.Name != "main" && file.Name.Name != "_" {
+		return file.Name.Name
+	}
+	name := path.Base(address)
+	if dot := strings.IndexByte(name, '.'); dot > 0 {
+		name = name[:dot]
+	}
+	name = strings.Map(func(ch rune) rune {
+		if ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' {
+			return ch
+		}
+		return '_'
+	}, name)
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// fetchURL downloads the Go source file at address, verifies it and saves it in the cache.
+// If the download fails because of network errors, returns the cached copy if present
+func (g *CompGlobals) fetchURL(address string) ([]byte, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		return nil, fmt.Errorf("cannot load %q: only https:// URLs are supported", address)
+	}
+	cachefile := urlCacheFile(address)
+	src, err := downloadURL(address)
+	if err == nil {
+		if len(cachefile) != 0 {
+			if err := os.MkdirAll(filepath.Dir(cachefile), 0700); err == nil {
+				err = ioutil.WriteFile(cachefile, src, 0600)
+			}
+			if err != nil {
+				g.Debugf("error caching %s: %v", address, err)
+			}
+		}
+		return src, nil
+	}
+	if _, network := err.(*url.Error); network && len(cachefile) != 0 {
+		if cached, cerr := ioutil.ReadFile(cachefile); cerr == nil {
+			g.Warnf("%v\nusing cached copy %s", err, cachefile)
+			return cached, nil
+		}
+	}
+	return nil, err
+}
+
+// download the file at address and verify that it looks like Go source code
+func downloadURL(address string) ([]byte, error) {
+	resp, err := urlClient.Get(address)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot load %q: %s", address, resp.Status)
+	}
+	if ctype := resp.Header.Get("Content-Type"); len(ctype) != 0 {
+		mtype, _, _ := mime.ParseMediaType(ctype)
+		if mtype == "text/html" || !strings.HasPrefix(mtype, "text/") && mtype != "application/octet-stream" {
+			return nil, fmt.Errorf("cannot load %q: expecting Go source code, found content type %q. For web pages as gists, use the URL of the raw file", address, mtype)
+		}
+	}
+	src, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxURLSize+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(src)) > MaxURLSize {
+		return nil, fmt.Errorf("cannot load %q: larger than %d bytes", address, MaxURLSize)
+	} else if !utf8.Valid(src) || bytes.IndexByte(src, 0) >= 0 {
+		return nil, fmt.Errorf("cannot load %q: not a text file", address)
+	}
+	return src, nil
+}
+
+// return the file caching the download of address,
+// or the empty string if the user cache directory is unknown
+func urlCacheFile(address string) string {
+	dir := URLCacheDir
+	if len(dir) == 0 {
+		userdir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(userdir, "gomacro", "url")
+	}
+	hash := sha256.Sum256([]byte(address))
+	return filepath.Join(dir, hex.EncodeToString(hash[:12])+".go")
+}
+
+// return true if host is localhost or a loopback address.
+// Plain http:// URLs are only accepted for them
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// urlFileSystem serves the file downloaded from an URL,
+// and delegates the other files to the wrapped FileSystem
+type urlFileSystem struct {
+	FileSystem
+	name string
+	src  []byte
+}
+
+func (fsys urlFileSystem) Open(name string) (io.ReadCloser, error) {
+	if name == fsys.name {
+		return ioutil.NopCloser(bytes.NewReader(fsys.src)), nil
+	}
+	return fsys.FileSystem.Open(name)
+}
@@ -248,7 +248,7 @@ func (c *Comp) MacroExpand1(in Ast) (out Ast, expanded bool) {
 			args[j] = xr.ValueOf(ToNode(ins.Get(i + j + 1)))
 		}
 		// invoke the macro
-		results := macro.closure(args)
+		results := c.callMacro(macro, args)
 		if debug {
 			c.Debugf("MacroExpand1: macro expanded to: %v", results)
 		}
@@ -291,3 +291,15 @@ func (c *Comp) MacroExpand1(in Ast) (out Ast, expanded bool) {
 	}
 	return base.UnwrapTrivialAst(outs), true
 }
+
+// callMacro invokes a macro, remembering c as the *Comp performing macroexpansion:
+// the macro can then ask for the static type of its arguments with MacroType()
+func (c *Comp) callMacro(macro Macro, args []xr.Value) []xr.Value {
+	g := c.CompGlobals
+	saved := g.macroComp
+	g.macroComp = c
+	defer func() {
+		g.macroComp = saved
+	}()
+	return macro.closure(args)
+}
@@ -0,0 +1,91 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * mock.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	r "reflect"
+	"strings"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// Mock replaces the function or variable exported by an imported package,
+// for example Mock("net/http.Get", replacement), with replacement.
+// Useful to install test doubles for interpreted code without changing its source.
+//
+// replacement must be assignable to the type of the replaced symbol.
+// It can also be an xreflect.Value or a reflect.Value, as returned by Interp.ValueOf().
+// The package is imported if needed, without declaring its name.
+//
+// Mocked functions are seen by all interpreted code, including code compiled before
+// the call to Mock, except by packages imported with import . "path"
+// which copy the exported functions when the import is executed.
+// Mocked variables are set directly: compiled code also sees the replacement.
+//
+// Returns a function that restores the original symbol.
+// Mock and the returned function must not be called while interpreted code is running
+func (ir *Interp) Mock(name string, replacement interface{}) (restore func(), err error) {
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= strings.LastIndexByte(name, '/') || dot == len(name)-1 {
+		return nil, fmt.Errorf("mock %q: expecting PKGPATH.NAME, as net/http.Get", name)
+	}
+	path, symbol := name[:dot], name[dot+1:]
+	imp, err := ir.Comp.ImportPackageOrError("_", path)
+	if err != nil {
+		return nil, err
+	}
+	bind := imp.Binds[symbol]
+	if bind == nil {
+		return nil, fmt.Errorf("mock %q: package %q has no symbol %s", name, path, symbol)
+	}
+	class, idx := bind.Desc.Class(), bind.Desc.Index()
+	if (class != FuncBind && class != VarBind) || idx == NoIndex {
+		return nil, fmt.Errorf("mock %q: cannot replace %s %s, only functions and variables", name, class, symbol)
+	}
+	var rv r.Value
+	switch v := replacement.(type) {
+	case xr.Value:
+		rv = v.ReflectValue()
+	case r.Value:
+		rv = v
+	default:
+		rv = r.ValueOf(replacement)
+	}
+	rtype := bind.Type.ReflectType()
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("mock %q: cannot use nil as <%v>", name, bind.Type)
+	} else if !rv.Type().AssignableTo(rtype) {
+		return nil, fmt.Errorf("mock %q: cannot use <%v> as <%v>", name, rv.Type(), bind.Type)
+	}
+	vals := imp.EnvBinds
+	if class == FuncBind {
+		old := vals.Vals[idx]
+		vals.Vals[idx] = xr.MakeValue(rv.Convert(rtype))
+		return func() {
+			vals.Vals[idx] = old
+		}, nil
+	}
+	// imported variables are addressable: set them in place
+	place := vals.Vals[idx].ReflectValue()
+	old := r.New(rtype).Elem()
+	old.Set(place)
+	place.Set(rv)
+	return func() {
+		place.Set(old)
+	}, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * mux.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/base/output"
+)
+
+type outputMux struct {
+	*output.Mux
+	stderr  io.Writer // where builtins print() and println() write
+	restore []func()
+}
+
+// MultiplexOutput routes through an output.Mux the output of interpreted code
+// that calls fmt.Print, fmt.Printf, fmt.Println, print and println,
+// and the output of the interpreter itself: lines printed by concurrent goroutines
+// no longer interleave with each other, and lines printed while the REPL waits for input
+// appear above the prompt, which is redrawn.
+//
+// If goroutinePrefix is true, lines printed by goroutines other than the REPL one
+// are prefixed with "[goroutine N] ". Interpreted code can also choose its own prefix
+// with Interp.Mux().SetPrefix().
+//
+// Output written directly to os.Stdout or os.Stderr, for example with fmt.Fprintln(os.Stdout, ...),
+// is not multiplexed. Must not be called while interpreted code is running
+func (ir *Interp) MultiplexOutput(goroutinePrefix bool) error {
+	ir.StopMultiplexOutput()
+	g := ir.Comp.CompGlobals
+	mux := &outputMux{Mux: output.NewMux(g.Stdout)}
+	mux.GoroutinePrefix = goroutinePrefix
+	mux.Dumb = g.Terminal == base.TerminalDumb
+	stdout := mux.Writer(os.Stdout)
+	mux.stderr = mux.Writer(os.Stderr)
+	for name, fun := range map[string]interface{}{
+		"fmt.Print": func(args ...interface{}) (int, error) {
+			return fmt.Fprint(stdout, args...)
+		},
+		"fmt.Printf": func(format string, args ...interface{}) (int, error) {
+			return fmt.Fprintf(stdout, format, args...)
+		},
+		"fmt.Println": func(args ...interface{}) (int, error) {
+			return fmt.Fprintln(stdout, args...)
+		},
+	} {
+		restore, err := ir.Mock(name, fun)
+		if err != nil {
+			mux.stop()
+			return err
+		}
+		mux.restore = append(mux.restore, restore)
+	}
+	savestdout, savestderr := g.Stdout, g.Stderr
+	g.Stdout, g.Stderr = mux.Writer(g.Stdout), mux.Writer(g.Stderr)
+	mux.restore = append(mux.restore, func() {
+		g.Stdout, g.Stderr = savestdout, savestderr
+	})
+	g.mux = mux
+	return nil
+}
+
+// StopMultiplexOutput undoes Interp.MultiplexOutput
+func (ir *Interp) StopMultiplexOutput() {
+	g := ir.Comp.CompGlobals
+	if g.mux != nil {
+		g.mux.stop()
+		g.mux = nil
+	}
+}
+
+// Mux returns the output.Mux installed by Interp.MultiplexOutput, or nil
+func (ir *Interp) Mux() *output.Mux {
+	if mux := ir.Comp.CompGlobals.mux; mux != nil {
+		return mux.Mux
+	}
+	return nil
+}
+
+func (mux *outputMux) stop() {
+	mux.Flush()
+	for i := len(mux.restore) - 1; i >= 0; i-- {
+		mux.restore[i]()
+	}
+	mux.restore = nil
+}
+
+// muxReadline notifies an output.Mux when the prompt is displayed
+type muxReadline struct {
+	base.Readline
+	mux *output.Mux
+}
+
+func (in muxReadline) Read(prompt string) ([]byte, error) {
+	in.mux.ShowPrompt(prompt)
+	defer in.mux.HidePrompt()
+	return in.Readline.Read(prompt)
+}
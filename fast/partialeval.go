@@ -0,0 +1,469 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * partialeval.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cosmos72/gomacro/base/untyped"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// PurePackages contains the import paths of the packages whose functions
+// have no side effects and always return the same result when invoked with the same arguments.
+// Calls to such functions with constant arguments, returning a single value of basic type,
+// are evaluated at compile time.
+// Embedders can add further packages, before creating interpreters.
+var PurePackages = map[string]bool{
+	"math":          true,
+	"math/bits":     true,
+	"path":          true,
+	"strconv":       true,
+	"strings":       true,
+	"unicode":       true,
+	"unicode/utf16": true,
+	"unicode/utf8":  true,
+}
+
+// PartialEval simplifies expr, replacing its constant subexpressions with literals:
+// operators applied to constants, named constants, builtin functions of constants
+// and calls of PurePackages functions with constant arguments.
+//
+// Subexpressions that cannot be simplified are kept, so that for example
+// x + (2 * 3) becomes x + 6, and strings.ToUpper("ab") + s becomes "AB" + s.
+// expr is not modified: the simplified subexpressions are replaced in a copy.
+// Returns the simplified expression and true if something was simplified,
+// otherwise returns expr itself and false.
+//
+// Identifiers are resolved in the scope of c: expr should not contain
+// nested function literals whose local variables shadow the names of constants
+func (c *Comp) PartialEval(expr ast.Expr) (ast.Expr, bool) {
+	if expr == nil {
+		return nil, false
+	}
+	return c.partialEval(expr)
+}
+
+func (c *Comp) partialEval(node ast.Expr) (ast.Expr, bool) {
+	var changed bool
+	switch node := node.(type) {
+	case *ast.BasicLit, *ast.FuncLit:
+		return node, false
+	case *ast.Ident:
+		if node.Name == "_" || node.Name == "iota" || c.isLiteral(node) {
+			return node, false
+		}
+	case *ast.ParenExpr:
+		x, _ := c.partialEval(node.X)
+		if c.isLiteral(x) {
+			return x, true
+		}
+		if x != node.X {
+			return &ast.ParenExpr{Lparen: node.Lparen, X: x, Rparen: node.Rparen}, true
+		}
+		return node, false
+	case *ast.UnaryExpr:
+		var x ast.Expr
+		if x, changed = c.partialEval(node.X); changed {
+			copy := *node
+			copy.X = x
+			node = &copy
+		}
+		if c.isLiteral(node) {
+			return node, changed
+		}
+		return c.foldConst(node, changed)
+	case *ast.BinaryExpr:
+		x, xchanged := c.partialEval(node.X)
+		y, ychanged := c.partialEval(node.Y)
+		if changed = xchanged || ychanged; changed {
+			copy := *node
+			copy.X, copy.Y = x, y
+			node = &copy
+		}
+		if c.isLiteral(node) {
+			return node, changed
+		}
+		return c.foldConst(node, changed)
+	case *ast.CallExpr:
+		var args []ast.Expr
+		if args, changed = c.partialEvalList(node.Args); changed {
+			copy := *node
+			copy.Args = args
+			node = &copy
+		}
+		if c.isLiteral(node) {
+			return node, changed
+		}
+		return c.foldConst(node, changed)
+	case *ast.SelectorExpr:
+		// pkg.Const can be folded. Do not simplify node.X, it may be a package name
+	case *ast.IndexExpr:
+		x, xchanged := c.partialEval(node.X)
+		index, ichanged := c.partialEval(node.Index)
+		if changed = xchanged || ichanged; changed {
+			copy := *node
+			copy.X, copy.Index = x, index
+			node = &copy
+		}
+		return c.foldConst(node, changed)
+	case *ast.SliceExpr:
+		copy := *node
+		for _, ptr := range []*ast.Expr{&copy.X, &copy.Low, &copy.High, &copy.Max} {
+			if *ptr != nil {
+				var flag bool
+				if *ptr, flag = c.partialEval(*ptr); flag {
+					changed = true
+				}
+			}
+		}
+		if changed {
+			node = &copy
+		}
+		return c.foldConst(node, changed)
+	case *ast.StarExpr:
+		if x, xchanged := c.partialEval(node.X); xchanged {
+			return &ast.StarExpr{Star: node.Star, X: x}, true
+		}
+		return node, false
+	case *ast.TypeAssertExpr:
+		if x, xchanged := c.partialEval(node.X); xchanged {
+			copy := *node
+			copy.X = x
+			return &copy, true
+		}
+		return node, false
+	case *ast.CompositeLit:
+		// do not simplify the keys: they may be struct field names
+		elts := make([]ast.Expr, len(node.Elts))
+		for i, elt := range node.Elts {
+			var flag bool
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				var value ast.Expr
+				if value, flag = c.partialEval(kv.Value); flag {
+					elt = &ast.KeyValueExpr{Key: kv.Key, Colon: kv.Colon, Value: value}
+				}
+			} else {
+				elt, flag = c.partialEval(elt)
+			}
+			elts[i] = elt
+			changed = changed || flag
+		}
+		if changed {
+			copy := *node
+			copy.Elts = elts
+			return &copy, true
+		}
+		return node, false
+	default:
+		return node, false
+	}
+	return c.foldConst(node, false)
+}
+
+func (c *Comp) partialEvalList(list []ast.Expr) ([]ast.Expr, bool) {
+	var changed bool
+	out := make([]ast.Expr, len(list))
+	for i, node := range list {
+		var flag bool
+		out[i], flag = c.partialEval(node)
+		changed = changed || flag
+	}
+	if !changed {
+		return list, false
+	}
+	return out, true
+}
+
+// if node is a constant expression, replace it with the corresponding literal.
+// otherwise return node and changed
+func (c *Comp) foldConst(node ast.Expr, changed bool) (ast.Expr, bool) {
+	e := c.tryConstExpr(node)
+	if e == nil {
+		return node, changed
+	}
+	lit := c.constToLiteral(e, node.Pos())
+	if lit == nil {
+		return node, changed
+	}
+	return lit, true
+}
+
+// compile node and return it if it's a constant, otherwise return nil
+func (c *Comp) tryConstExpr(node ast.Expr) (e *Expr) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			e = nil
+		}
+	}()
+	// compile in a temporary scope: expressions should not declare anything in c,
+	// but be safe. Also, do not count the compiled expression in c.stats
+	e = NewComp(c, nil).exprCompile(node, nil)
+	if e == nil || e.NumOut() != 1 || !e.Const() || e.IsNil() {
+		return nil
+	}
+	return e
+}
+
+// convert the constant e to a literal, possibly wrapped in a conversion to its type.
+// return nil if not possible
+func (c *Comp) constToLiteral(e *Expr, pos token.Pos) ast.Expr {
+	if e.Untyped() {
+		lit := e.Value.(UntypedLit)
+		return untypedToLiteral(lit.Kind, lit.Val, pos)
+	}
+	t := e.Type
+	v := xr.ValueOf(e.Value)
+	var kind untyped.Kind
+	var val constant.Value
+	switch t.Kind() {
+	case xr.Bool:
+		kind, val = untyped.Bool, constant.MakeBool(v.Bool())
+	case xr.Int, xr.Int8, xr.Int16, xr.Int32, xr.Int64:
+		kind, val = untyped.Int, constant.MakeInt64(v.Int())
+	case xr.Uint, xr.Uint8, xr.Uint16, xr.Uint32, xr.Uint64, xr.Uintptr:
+		kind, val = untyped.Int, constant.MakeUint64(v.Uint())
+	case xr.Float32, xr.Float64:
+		kind, val = untyped.Float, constant.MakeFloat64(v.Float())
+	case xr.Complex64, xr.Complex128:
+		z := v.Complex()
+		kind = untyped.Complex
+		val = constant.BinaryOp(constant.MakeFloat64(real(z)), token.ADD,
+			constant.MakeImag(constant.MakeFloat64(imag(z))))
+	case xr.String:
+		kind, val = untyped.String, constant.MakeString(v.String())
+	default:
+		return nil
+	}
+	if val.Kind() == constant.Unknown {
+		// NaN or infinity
+		return nil
+	}
+	lit := untypedToLiteral(kind, val, pos)
+	if lit == nil {
+		return nil
+	}
+	name := t.Name()
+	if name == xr.Kind(kind).String() {
+		// the literal has the correct default type
+		return lit
+	}
+	// wrap the literal in a conversion to its type,
+	// unless the type is not a predeclared one or its name is shadowed
+	if len(t.PkgPath()) != 0 || name != t.Kind().String() {
+		return nil
+	}
+	if tscope := c.TryResolveType(name); tscope == nil || !tscope.IdenticalTo(t) {
+		return nil
+	}
+	return &ast.CallExpr{Fun: &ast.Ident{NamePos: pos, Name: name}, Lparen: pos, Args: []ast.Expr{lit}}
+}
+
+// convert an untyped constant to a literal. return nil if not possible
+func untypedToLiteral(kind untyped.Kind, val constant.Value, pos token.Pos) ast.Expr {
+	switch kind {
+	case untyped.Bool:
+		return &ast.Ident{NamePos: pos, Name: strconv.FormatBool(constant.BoolVal(val))}
+	case untyped.Int:
+		neg := constant.Sign(val) < 0
+		if neg {
+			val = constant.UnaryOp(token.SUB, val, 0)
+		}
+		return negateLiteral(neg, &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: val.ExactString()})
+	case untyped.Rune:
+		if n, exact := constant.Int64Val(val); exact && n >= 0 && n <= utf8.MaxRune && utf8.ValidRune(rune(n)) {
+			return &ast.BasicLit{ValuePos: pos, Kind: token.CHAR, Value: strconv.QuoteRune(rune(n))}
+		}
+	case untyped.Float:
+		return floatToLiteral(val, pos)
+	case untyped.Complex:
+		re, exactre := constant.Float64Val(constant.Real(val))
+		im, exactim := constant.Float64Val(constant.Imag(val))
+		if !exactre || !exactim {
+			return nil
+		}
+		op, abs := token.ADD, im
+		if im < 0 {
+			op, abs = token.SUB, -im
+		}
+		imag := &ast.BasicLit{ValuePos: pos, Kind: token.IMAG, Value: formatFloat(abs) + "i"}
+		if re == 0 && op == token.ADD {
+			return imag
+		}
+		real := floatToLiteral(constant.MakeFloat64(re), pos)
+		return &ast.ParenExpr{Lparen: pos, X: &ast.BinaryExpr{X: real, OpPos: pos, Op: op, Y: imag}}
+	case untyped.String:
+		return &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: strconv.Quote(constant.StringVal(val))}
+	}
+	return nil
+}
+
+// convert an untyped float constant to a literal,
+// or to a division of literals if it cannot be represented exactly as a float64.
+// return nil if it has too many digits
+func floatToLiteral(val constant.Value, pos token.Pos) ast.Expr {
+	neg := constant.Sign(val) < 0
+	if neg {
+		val = constant.UnaryOp(token.SUB, val, 0)
+	}
+	if f, exact := constant.Float64Val(val); exact {
+		return negateLiteral(neg, &ast.BasicLit{ValuePos: pos, Kind: token.FLOAT, Value: formatFloat(f)})
+	}
+	num, den := constant.Num(val), constant.Denom(val)
+	if num.Kind() != constant.Int || den.Kind() != constant.Int {
+		return nil
+	}
+	nums, dens := num.ExactString(), den.ExactString()
+	if len(nums)+len(dens) > maxFractionDigits {
+		return nil
+	}
+	return negateLiteral(neg, &ast.ParenExpr{Lparen: pos, X: &ast.BinaryExpr{
+		X:     &ast.BasicLit{ValuePos: pos, Kind: token.FLOAT, Value: nums + ".0"},
+		OpPos: pos,
+		Op:    token.QUO,
+		Y:     &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: dens},
+	}})
+}
+
+// literals with more digits are not worth producing: keep the original expression
+const maxFractionDigits = 40
+
+// format a finite float64 as a Go floating-point literal
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// return -lit if neg is true, otherwise lit
+func negateLiteral(neg bool, lit ast.Expr) ast.Expr {
+	if neg {
+		return &ast.UnaryExpr{OpPos: lit.Pos(), Op: token.SUB, X: lit}
+	}
+	return lit
+}
+
+// return true if node is a literal, possibly negated or wrapped in a conversion:
+// it cannot be simplified further
+func (c *Comp) isLiteral(node ast.Expr) bool {
+	switch node := node.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		if node.Name == "true" || node.Name == "false" {
+			sym := c.TryResolve(node.Name)
+			return sym != nil && sym.Desc.Class() == ConstBind
+		}
+	case *ast.UnaryExpr:
+		if node.Op == token.SUB || node.Op == token.ADD {
+			_, ok := node.X.(*ast.BasicLit)
+			return ok
+		}
+	case *ast.BinaryExpr:
+		// complex literals 1.5+2i and rational literals 1.0/3
+		x, _ := node.X.(*ast.BasicLit)
+		y, _ := node.Y.(*ast.BasicLit)
+		return x != nil && y != nil && (y.Kind == token.IMAG && (node.Op == token.ADD || node.Op == token.SUB) ||
+			x.Kind == token.FLOAT && y.Kind == token.INT && node.Op == token.QUO)
+	case *ast.ParenExpr:
+		_, ok := node.X.(*ast.BinaryExpr)
+		return ok && c.isLiteral(node.X)
+	case *ast.CallExpr:
+		if ident, ok := node.Fun.(*ast.Ident); ok && len(node.Args) == 1 && node.Ellipsis == token.NoPos {
+			return c.TryResolveType(ident.Name) != nil && c.isLiteral(node.Args[0])
+		}
+	}
+	return false
+}
+
+// ======================== pure function calls ===============================
+
+// if node calls a function of PurePackages with constant arguments,
+// invoke it at compile time and return its result as a constant.
+// Otherwise return nil
+func (c *Comp) pureCall(node *ast.CallExpr, call *Call) (e *Expr) {
+	if call.Builtin || call.Ellipsis || len(call.OutTypes) != 1 || !isBasicKind(call.OutTypes[0].Kind()) {
+		return nil
+	}
+	fun := c.pureFunc(node.Fun)
+	if !fun.IsValid() {
+		return nil
+	}
+	args := make([]xr.Value, len(call.Args))
+	for i, arg := range call.Args {
+		if !arg.Const() || arg.Untyped() || arg.NumOut() != 1 {
+			return nil
+		}
+		args[i] = xr.ValueOf(arg.Value)
+		if !args[i].IsValid() {
+			return nil
+		}
+	}
+	defer func() {
+		// the function panicked: do not evaluate it at compile time,
+		// the panic will happen at runtime
+		if rec := recover(); rec != nil {
+			e = nil
+		}
+	}()
+	ret := fun.Call(args)
+	return c.exprValue(call.OutTypes[0], ret[0].Interface())
+}
+
+// if fun is pkg.Func, where pkg is an imported package listed in PurePackages,
+// return the function. Otherwise return the zero xr.Value
+func (c *Comp) pureFunc(fun ast.Expr) xr.Value {
+	var none xr.Value
+	sel, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		return none
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return none
+	}
+	sym := c.TryResolve(ident.Name)
+	if sym == nil || sym.Desc.Class() != ConstBind {
+		return none
+	}
+	imp, ok := sym.Value.(*Import)
+	if !ok || !PurePackages[imp.Path] {
+		return none
+	}
+	bind := imp.Binds[sel.Sel.Name]
+	if bind == nil || bind.Desc.Class() != FuncBind || bind.Desc.Index() == NoIndex {
+		return none
+	}
+	return imp.Vals[bind.Desc.Index()]
+}
+
+func isBasicKind(k xr.Kind) bool {
+	switch k {
+	case xr.Bool, xr.Int, xr.Int8, xr.Int16, xr.Int32, xr.Int64,
+		xr.Uint, xr.Uint8, xr.Uint16, xr.Uint32, xr.Uint64, xr.Uintptr,
+		xr.Float32, xr.Float64, xr.Complex64, xr.Complex128, xr.String:
+		return true
+	}
+	return false
+}
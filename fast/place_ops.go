@@ -5685,7 +5685,10 @@ func (c *Comp) setPlace(place *Place, op token.Token, init *Expr) Stmt {
 	}
 
 	t := place.Type
-	if init.Const() {
+	shift := op == token.SHL || op == token.SHL_ASSIGN || op == token.SHR || op == token.SHR_ASSIGN
+	if shift {
+		c.shiftCount(nil, init, false)
+	} else if init.Const() {
 		init.ConstTo(t)
 	} else if init.Type == nil || !init.Type.AssignableTo(t) {
 		c.Errorf("incompatible types in assignment: <%v> %s <%v>", t, op, init.Type)
@@ -5698,7 +5701,7 @@ func (c *Comp) setPlace(place *Place, op token.Token, init *Expr) Stmt {
 		if !v.IsValid() || v == None {
 			v = xr.Zero(t)
 			val = v.Interface()
-		} else if v.Type() != rt {
+		} else if v.Type() != rt && !shift {
 			v = convert(v, rt)
 			val = v.Interface()
 		}
@@ -5721,6 +5724,10 @@ func (c *Comp) setPlace(place *Place, op token.Token, init *Expr) Stmt {
 			return c.placeOrConst(place, val)
 		case token.XOR, token.XOR_ASSIGN:
 			return c.placeAndConst(place, val)
+		case token.SHL, token.SHL_ASSIGN:
+			return c.placeShlConst(place, val)
+		case token.SHR, token.SHR_ASSIGN:
+			return c.placeShrConst(place, val)
 		case token.AND_NOT, token.AND_NOT_ASSIGN:
 			return c.placeAndnotConst(place, val)
 		}
@@ -5745,6 +5752,10 @@ func (c *Comp) setPlace(place *Place, op token.Token, init *Expr) Stmt {
 			return c.placeOrExpr(place, fun)
 		case token.XOR, token.XOR_ASSIGN:
 			return c.placeAndExpr(place, fun)
+		case token.SHL, token.SHL_ASSIGN:
+			return c.placeShlExpr(place, init.AsUint64())
+		case token.SHR, token.SHR_ASSIGN:
+			return c.placeShrExpr(place, init.AsUint64())
 		case token.AND_NOT, token.AND_NOT_ASSIGN:
 			return c.placeAndnotExpr(place, fun)
 		}
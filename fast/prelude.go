@@ -0,0 +1,165 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * prelude.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Preludes contains the source code of the optional preludes,
+// which can be loaded with Interp.LoadPrelude() or with the REPL command :prelude NAME
+var Preludes = map[string]string{
+	"std": preludeStd,
+}
+
+// LoadPrelude evaluates in the current package the prelude with the given name
+func (ir *Interp) LoadPrelude(name string) error {
+	src, ok := Preludes[name]
+	if !ok {
+		return fmt.Errorf("unknown prelude %q, available preludes are: %s",
+			name, strings.Join(preludeNames(), " "))
+	}
+	_, err := ir.EvalReader(strings.NewReader(src))
+	return err
+}
+
+func preludeNames() []string {
+	names := make([]string, 0, len(Preludes))
+	for name := range Preludes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// prelude "std": helpers to use gomacro as a replacement for shell scripts
+const preludeStd = `
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sh executes cmd with "sh -c" and returns its standard output,
+// without the final newline. Panics if cmd fails
+func sh(cmd string) string {
+	c := exec.Command("sh", "-c", cmd)
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		panic(fmt.Errorf("sh %q: %v", cmd, err))
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// readFile returns the content of file at path. Panics on error
+func readFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// writeFile creates or truncates the file at path, then writes data into it. Panics on error
+func writeFile(path string, data string) {
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// toJSON returns the indented JSON encoding of v. Panics on error
+func toJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// fromJSON decodes a JSON string into nil, bool, float64, string,
+// []interface{} or map[string]interface{}. Panics on error
+func fromJSON(data string) interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(data), &v)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// duration shortcuts: 3*sec, 250*ms ...
+const (
+	ns     = time.Nanosecond
+	us     = time.Microsecond
+	ms     = time.Millisecond
+	sec    = time.Second
+	minute = time.Minute
+	hour   = time.Hour
+	day    = 24 * time.Hour
+)
+
+// dur parses a duration such as "1h30m" or "250ms". Panics on error
+func dur(s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// date parses a time in RFC 3339 format "2006-01-02T15:04:05Z07:00"
+// or a date "2006-01-02" in local time zone. Panics on error
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02", s, time.Local)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// ago returns the time d before now
+func ago(d time.Duration) time.Time {
+	return time.Now().Add(-d)
+}
+
+// timeFunc executes f and returns how long it took,
+// also printing it to standard error
+func timeFunc(f func()) time.Duration {
+	start := time.Now()
+	f()
+	elapsed := time.Since(start)
+	fmt.Fprintf(os.Stderr, "// elapsed: %v\n", elapsed)
+	return elapsed
+}
+
+// timeit; STATEMENT executes STATEMENT and prints how long it took
+~macro timeit(body interface{}) interface{} {
+	return ~"{timeFunc(func() { ~,body })}
+}
+`
@@ -0,0 +1,58 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * prewarm.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/base/genimport"
+)
+
+// Prewarm loads, generates and compiles the import plugins for pkgpaths concurrently,
+// without declaring the packages: later imports of the same packages will be fast.
+// Useful to hide the latency of the first import, by calling it when an embedder starts
+// and before user code is evaluated.
+//
+// If progress is not nil, it is invoked each time a package has been imported or failed to import.
+// Invocations are serialized, but they happen in other goroutines.
+//
+// Returns the errors in the same order as pkgpaths. Packages already imported are skipped.
+// Relative import paths are not supported.
+// Prewarm must not be called while interpreted code is running or being compiled
+func (ir *Interp) Prewarm(pkgpaths []string, progress genimport.ImportProgress) []error {
+	g := ir.Comp.CompGlobals
+	var todo []string
+	for _, path := range pkgpaths {
+		if g.KnownImports[path] == nil && !containsString(todo, path) {
+			todo = append(todo, path)
+		}
+	}
+	refs, errlist := g.Importer.Prewarm(todo, g.Options&base.OptModuleImport != 0, progress)
+	errmap := make(map[string]error)
+	for i, path := range todo {
+		if errlist[i] != nil {
+			errmap[path] = errlist[i]
+		} else {
+			// also create the *Import, to skip converting the package types on first use
+			g.KnownImports[path] = g.NewImport(refs[i])
+		}
+	}
+	errs := make([]error, len(pkgpaths))
+	for i, path := range pkgpaths {
+		errs[i] = errmap[path]
+	}
+	return errs
+}
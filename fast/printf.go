@@ -0,0 +1,295 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * printf.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"log"
+	r "reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cosmos72/gomacro/base/untyped"
+	"github.com/cosmos72/gomacro/go/types"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// map[function pointer]index of format argument
+// for well-known printf-like host functions
+var printfFuncs = map[uintptr]int{}
+
+func init() {
+	for _, f := range []struct {
+		fun   interface{}
+		index int
+	}{
+		{fmt.Errorf, 0},
+		{fmt.Fprintf, 1},
+		{fmt.Printf, 0},
+		{fmt.Sprintf, 0},
+		{log.Fatalf, 0},
+		{log.Panicf, 0},
+		{log.Printf, 0},
+	} {
+		printfFuncs[r.ValueOf(f.fun).Pointer()] = f.index
+	}
+}
+
+// argument kinds accepted by printf verbs. same approach as go vet
+type printfArg uint
+
+const (
+	argBool printfArg = 1 << iota
+	argInt
+	argRune
+	argString
+	argFloat
+	argComplex
+	argPointer
+	argError
+	argAny printfArg = ^printfArg(0)
+)
+
+var printfVerbs = map[rune]printfArg{
+	'b': argInt | argFloat | argComplex | argPointer,
+	'c': argRune | argInt,
+	'd': argInt | argPointer,
+	'e': argFloat | argComplex,
+	'E': argFloat | argComplex,
+	'f': argFloat | argComplex,
+	'F': argFloat | argComplex,
+	'g': argFloat | argComplex,
+	'G': argFloat | argComplex,
+	'o': argInt | argPointer,
+	'O': argInt | argPointer,
+	'p': argPointer,
+	'q': argRune | argInt | argString,
+	's': argString,
+	't': argBool,
+	'T': argAny,
+	'U': argRune | argInt,
+	'v': argAny,
+	'w': argError,
+	'x': argRune | argInt | argString | argPointer | argFloat | argComplex,
+	'X': argRune | argInt | argString | argPointer | argFloat | argComplex,
+}
+
+// checkPrintfArgs warns if a call to a well-known printf-like function
+// has a constant format string whose verbs do not match the arguments
+func (c *Comp) checkPrintfArgs(node *ast.CallExpr, args []*Expr, ellipsis bool) {
+	if ellipsis {
+		return
+	}
+	name, pfun := c.importedFuncPointer(node.Fun)
+	if pfun == 0 {
+		return
+	}
+	index, ok := printfFuncs[pfun]
+	if !ok || index >= len(args) || len(args) != len(node.Args) {
+		return
+	}
+	format := args[index]
+	if !format.Const() {
+		return
+	}
+	var str string
+	switch val := format.Value.(type) {
+	case string:
+		str = val
+	case UntypedLit:
+		if val.Val.Kind() != constant.String {
+			return
+		}
+		str = constant.StringVal(val.Val)
+	default:
+		return
+	}
+	args = args[index+1:]
+	argnodes := node.Args[index+1:]
+	argn := 0
+	for i := 0; i < len(str); {
+		if str[i] != '%' {
+			i++
+			continue
+		}
+		start := i
+		i++
+		// flags
+		for i < len(str) && strings.IndexByte("+-# 0", str[i]) >= 0 {
+			i++
+		}
+		if i < len(str) && str[i] == '[' {
+			// explicit argument indexes: give up
+			return
+		}
+		// width and precision, each possibly '*'
+		for i < len(str) && (str[i] == '.' || str[i] == '*' || (str[i] >= '0' && str[i] <= '9')) {
+			if str[i] == '*' {
+				if argn >= len(args) {
+					c.Warnf("%s format %s reads arg #%d, but call has %d args", name, str[start:i+1], argn+1, len(args))
+					return
+				}
+				argn++
+			}
+			i++
+		}
+		if i >= len(str) {
+			c.Warnf("%s format %s is missing verb at end of string", name, str[start:])
+			return
+		}
+		verb, size := utf8.DecodeRuneInString(str[i:])
+		i += size
+		if verb == '%' {
+			continue
+		}
+		directive := str[start:i]
+		accepted, ok := printfVerbs[verb]
+		if !ok {
+			c.Warnf("%s format %s has unknown verb %c", name, directive, verb)
+			argn++
+			continue
+		}
+		if argn >= len(args) {
+			c.Warnf("%s format %s reads arg #%d, but call has %d args", name, directive, argn+1, len(args))
+			return
+		}
+		if t := printfArgType(args[argn]); t != nil && !printfArgMatches(t, accepted, verb, true, make(map[types.Type]bool)) {
+			c.Warnf("%s format %s has arg %v of wrong type %v", name, directive, argnodes[argn], t)
+		}
+		argn++
+	}
+	if argn < len(args) {
+		c.Warnf("%s call needs %d args but has %d args", name, argn, len(args))
+	}
+}
+
+// if node is pkg.Func where pkg is an imported package,
+// return its name and the address of the compiled function. otherwise return 0
+func (c *Comp) importedFuncPointer(node ast.Expr) (string, uintptr) {
+	sel, ok := node.(*ast.SelectorExpr)
+	if !ok {
+		return "", 0
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return "", 0
+	}
+	sym := c.TryResolve(ident.Name)
+	if sym == nil || sym.Desc.Class() != ConstBind || sym.Type.ReflectType() != rtypeOfPtrImport {
+		return "", 0
+	}
+	imp, _ := sym.Value.(*Import)
+	if imp == nil {
+		return "", 0
+	}
+	bind := imp.Binds[sel.Sel.Name]
+	if bind == nil || bind.Desc.Class() != FuncBind && bind.Desc.Class() != VarBind {
+		return "", 0
+	}
+	if idx := bind.Desc.Index(); idx != NoIndex && idx < len(imp.Vals) {
+		if v := imp.Vals[idx]; v.IsValid() && v.Kind() == r.Func && !v.IsNil() {
+			return ident.Name + "." + sel.Sel.Name, v.Pointer()
+		}
+	}
+	return "", 0
+}
+
+// return the static type of a printf argument, or nil if unknown
+func printfArgType(arg *Expr) xr.Type {
+	if arg.Untyped() {
+		if lit, ok := arg.Value.(UntypedLit); ok && lit.Kind == untyped.None {
+			return nil // untyped nil
+		}
+		return arg.DefaultType()
+	}
+	return arg.Type
+}
+
+// return true if printf verb accepts an argument of type t.
+// inProgress contains the types already checked, to stop the recursion on recursive types
+// as for example type T struct { Kids []T }. Same approach as go vet
+func printfArgMatches(t xr.Type, accepted printfArg, verb rune, toplevel bool, inProgress map[types.Type]bool) bool {
+	if accepted == argAny {
+		return true
+	}
+	if inProgress[t.GoType()] {
+		return true
+	}
+	inProgress[t.GoType()] = true
+	if _, n := t.MethodByName("Format", ""); n != 0 {
+		return true
+	}
+	if _, n := t.MethodByName("Error", ""); n != 0 && strings.ContainsRune("sqvxXw", verb) {
+		return true
+	}
+	if _, n := t.MethodByName("String", ""); n != 0 && strings.ContainsRune("sqvxX", verb) {
+		return true
+	}
+	switch t.Kind() {
+	case r.Interface:
+		// dynamic type is unknown at compile time
+		return true
+	case r.Bool:
+		return accepted&argBool != 0
+	case r.Int8, r.Int16, r.Int32, r.Int64, r.Int, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uint, r.Uintptr:
+		return accepted&argInt != 0
+	case r.Float32, r.Float64:
+		return accepted&argFloat != 0
+	case r.Complex64, r.Complex128:
+		return accepted&argComplex != 0
+	case r.String:
+		return accepted&argString != 0
+	case r.Chan, r.Func, r.UnsafePointer:
+		return accepted&argPointer != 0
+	case r.Map:
+		if accepted&argPointer != 0 {
+			return true
+		}
+		return printfArgMatches(t.Key(), accepted, verb, false, inProgress) && printfArgMatches(t.Elem(), accepted, verb, false, inProgress)
+	case r.Slice:
+		if accepted&argPointer != 0 {
+			return true
+		}
+		fallthrough
+	case r.Array:
+		if elem := t.Elem(); elem.Kind() == r.Uint8 && accepted&argString != 0 {
+			// []byte is printed as a string by %s %q %x %X
+			return true
+		}
+		return printfArgMatches(t.Elem(), accepted, verb, false, inProgress)
+	case r.Ptr:
+		if accepted&argPointer != 0 {
+			return true
+		}
+		// printf prints &{...} &[...] and &map[...] only at top level
+		switch t.Elem().Kind() {
+		case r.Array, r.Slice, r.Struct, r.Map:
+			return toplevel && printfArgMatches(t.Elem(), accepted, verb, false, inProgress)
+		}
+		return false
+	case r.Struct:
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if !printfArgMatches(t.Field(i).Type, accepted, verb, false, inProgress) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
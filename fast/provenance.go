@@ -0,0 +1,102 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * provenance.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/token"
+
+	"github.com/cosmos72/gomacro/base"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// writeRecord contains the position of the statement that last wrote a toplevel variable.
+// Only created if option OptTrackProvenance is set
+type writeRecord struct {
+	pos token.Pos
+}
+
+// return the writeRecord of va, creating it if needed.
+// return nil if option OptTrackProvenance is not set, or if va is not a toplevel variable
+func (c *Comp) writeRecord(va *Var) *writeRecord {
+	if c.Options&base.OptTrackProvenance == 0 || len(va.Name) == 0 || va.Name == "_" {
+		return nil
+	}
+	sym, o := c.tryResolve(va.Name)
+	if sym == nil || o != c.FileComp() || sym.Upn != va.Upn || sym.Desc != va.Desc {
+		// not a toplevel variable, or shadowed by a local one
+		return nil
+	}
+	bind := o.Binds[va.Name]
+	rec := c.writes[bind]
+	if rec == nil {
+		if c.writes == nil {
+			c.writes = make(map[*Bind]*writeRecord)
+		}
+		rec = &writeRecord{}
+		c.writes[bind] = rec
+	}
+	return rec
+}
+
+// recordWrite compiles a statement that records c.Pos as the position
+// of the last write to va. Does nothing if writeRecord(va) returns nil
+func (c *Comp) recordWrite(va *Var) {
+	rec := c.writeRecord(va)
+	if rec == nil {
+		return
+	}
+	pos := c.Pos
+	c.append(func(env *Env) (Stmt, *Env) {
+		rec.pos = pos
+		env.IP++
+		return env.Code[env.IP], env
+	})
+}
+
+// recordWriteValue wraps set, which assigns va, to also record c.Pos
+// as the position of the last write to va. Returns set if writeRecord(va) returns nil
+func (c *Comp) recordWriteValue(va *Var, set func(*Env, xr.Value)) func(*Env, xr.Value) {
+	rec := c.writeRecord(va)
+	if rec == nil || set == nil {
+		return set
+	}
+	pos := c.Pos
+	return func(env *Env, v xr.Value) {
+		set(env, v)
+		rec.pos = pos
+	}
+}
+
+// Whence returns the position and the source line of the statement
+// that last wrote the toplevel variable name.
+// Writes are recorded only while option OptTrackProvenance is set,
+// and source lines are available only for code parsed while it was set.
+// Writes through pointers are not recorded.
+// Returns ok = false if no write to name was recorded
+func (ir *Interp) Whence(name string) (pos token.Position, source string, ok bool) {
+	c := ir.Comp
+	sym, o := c.tryResolve(name)
+	if sym == nil || o != c.FileComp() {
+		return pos, "", false
+	}
+	rec := c.writes[o.Binds[name]]
+	if rec == nil || rec.pos == token.NoPos {
+		return pos, "", false
+	}
+	source, pos = c.Fileset.Source(rec.pos)
+	return pos, source, true
+}
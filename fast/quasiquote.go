@@ -210,7 +210,11 @@ func (c *Comp) quasiquote(in Ast, depth int, canSplice bool) (*Expr, bool) {
 				if debug {
 					c.Debugf("Quasiquote[%d]%s compiling %s: %v // %T", depth, label, etoken.String(op), node, node)
 				}
-				return c.compileExpr(form), op == etoken.UNQUOTE_SPLICE
+				expr := c.compileExpr(form)
+				if typ := typedHole(unary); typ != nil {
+					expr = c.checkTypedHole(expr, typ, node)
+				}
+				return expr, op == etoken.UNQUOTE_SPLICE
 			}
 			fun := c.quasiquote1(form, depth, true).AsX1()
 			if fun == nil {
@@ -235,6 +239,9 @@ func (c *Comp) quasiquote(in Ast, depth int, canSplice bool) (*Expr, bool) {
 					node = AnyToAstWithNode(x, position).Node()
 				}
 				ret, _ := mp.MakeQuote(nil, op, token.NoPos, node)
+				if typ := typedHole(unary); typ != nil {
+					ret.X.(*ast.FuncLit).Type.Results = unary.X.(*ast.FuncLit).Type.Results
+				}
 				return xr.ValueOf(ret)
 			}), false
 		}
@@ -328,3 +335,70 @@ func (c *Comp) quoteUnquoteSplice(op token.Token, pos token.Pos, position token.
 		return xr.ValueOf(ret)
 	})
 }
+
+// return the type of a typed hole ~,expr:Type, or nil if unary is not a typed hole
+func typedHole(unary *ast.UnaryExpr) ast.Expr {
+	if unary.Op != etoken.UNQUOTE {
+		return nil
+	}
+	if flit, ok := unary.X.(*ast.FuncLit); ok && flit.Type != nil {
+		if results := flit.Type.Results; results != nil && len(results.List) == 1 {
+			return results.List[0].Type
+		}
+	}
+	return nil
+}
+
+// checkTypedHole wraps the compiled expr of a typed hole ~,expr:Type:
+// when the quasiquote is evaluated, the static type of the expression returned by expr
+// is checked against Type. Both are compiled in the scope where the macro is being expanded,
+// or in the file scope if no macroexpansion is in progress.
+// This reports type errors at the macro call site, instead of after the expansion
+func (c *Comp) checkTypedHole(expr *Expr, typ ast.Expr, hole ast.Node) *Expr {
+	fun := expr.AsX1()
+	g := c.CompGlobals
+	position := c.Fileset.Position(hole.Pos())
+	return exprX1(expr.Type, func(env *Env) xr.Value {
+		v := fun(env)
+		node, ok := AnyToAstWithNode(reflect.ValueInterface(v), position).Node().(ast.Expr)
+		if !ok {
+			output.Errorf("%s: typed hole %v:%v expects an expression, found %v",
+				position, hole, typ, reflect.ValueInterface(v))
+		}
+		mc := g.macroComp
+		if mc == nil {
+			mc = c.FileComp()
+		}
+		t := mc.Type(typ)
+		e := mc.expr1(node, nil)
+		if !typedHoleMatches(e, t) {
+			found := e.Type
+			if e.Untyped() {
+				found = e.DefaultType()
+			}
+			pos := node.Pos()
+			if !pos.IsValid() {
+				pos = hole.Pos()
+			}
+			mc.ErrorAt(pos, "typed hole expects <%v>, found %v <%v>", t, node, found)
+		}
+		return v
+	})
+}
+
+// return true if e can be assigned to type t
+func typedHoleMatches(e *Expr, t xr.Type) (ok bool) {
+	if e.Type == nil {
+		// literal nil
+		return reflect.IsNillableKind(t.Kind())
+	} else if !e.Untyped() {
+		return e.Type.AssignableTo(t)
+	}
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	e.ConstTo(t)
+	return true
+}
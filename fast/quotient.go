@@ -0,0 +1,316 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * quotient.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"math/bits"
+
+	"github.com/cosmos72/gomacro/base/reflect"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// magic32 computes quotient and remainder of unsigned integers up to 32 bits
+// with multiplications instead of a division.
+// See D. Lemire, O. Kaser, N. Kurz "Faster Remainder by Direct Computation", 2019
+type magic32 struct {
+	m uint64
+	d uint64
+}
+
+func makeMagic32(d uint64) magic32 {
+	return magic32{^uint64(0)/d + 1, d}
+}
+
+func (mg magic32) quo(n uint64) uint64 {
+	hi, _ := bits.Mul64(mg.m, n)
+	return hi
+}
+
+func (mg magic32) rem(n uint64) uint64 {
+	hi, _ := bits.Mul64(mg.m*n, mg.d)
+	return hi
+}
+
+// magic64 computes quotient and remainder of unsigned integers up to 64 bits
+// with multiplications and shifts instead of a division.
+// See T. Granlund, P. Montgomery "Division by Invariant Integers using Multiplication", 1994
+type magic64 struct {
+	m     uint64
+	d     uint64
+	shift uint8
+}
+
+// d must be >= 3 and not a power of two
+func makeMagic64(d uint64) magic64 {
+	l := uint8(bits.Len64(d - 1)) // ceil(log2(d))
+	// if l == 64, (1 << l) - d wraps around to 2**64 - d, which is the correct value
+	m, _ := bits.Div64((uint64(1)<<l)-d, 0, d)
+	return magic64{m + 1, d, l - 1}
+}
+
+func (mg magic64) quo(n uint64) uint64 {
+	t, _ := bits.Mul64(mg.m, n)
+	return (t + (n-t)>>1) >> mg.shift
+}
+
+func (mg magic64) rem(n uint64) uint64 {
+	return n - mg.quo(n)*mg.d
+}
+
+// return the absolute value of a constant integer divisor,
+// and whether it is negative. ok is false if y is not an integer,
+// or is 0, 1 or a power of two: they are handled by quoPow2() and remPow2()
+func magicDivisor(y I) (d uint64, negative bool, ok bool) {
+	yv := xr.ValueOf(y)
+	switch reflect.Category(yv.Kind()) {
+	case xr.Int:
+		sy := yv.Int()
+		if sy < 0 {
+			negative = true
+			d = uint64(-sy)
+		} else {
+			d = uint64(sy)
+		}
+	case xr.Uint:
+		d = yv.Uint()
+	default:
+		return 0, false, false
+	}
+	return d, negative, d != 0 && !isPowerOfTwo(d)
+}
+
+// quoMagic tries to optimize integer divisions by a constant,
+// replacing them with multiplications and shifts.
+// returns nil if no optimized version could be compiled.
+func (c *Comp) quoMagic(node *ast.BinaryExpr, xe *Expr, ye *Expr) *Expr {
+	if xe.Const() || !ye.Const() {
+		return nil
+	}
+	d, negative, ok := magicDivisor(ye.Value)
+	if !ok {
+		return nil
+	}
+	x := xe.Fun
+	var fun I
+	switch xe.Type.Kind() {
+	case xr.Int8:
+		x := x.(func(*Env) int8)
+		mg := makeMagic32(d)
+		fun = func(env *Env) int8 {
+			n := x(env)
+			if (n < 0) == negative {
+				return int8(mg.quo(abs64(int64(n))))
+			}
+			return -int8(mg.quo(abs64(int64(n))))
+		}
+	case xr.Int16:
+		x := x.(func(*Env) int16)
+		mg := makeMagic32(d)
+		fun = func(env *Env) int16 {
+			n := x(env)
+			if (n < 0) == negative {
+				return int16(mg.quo(abs64(int64(n))))
+			}
+			return -int16(mg.quo(abs64(int64(n))))
+		}
+	case xr.Int32:
+		x := x.(func(*Env) int32)
+		mg := makeMagic32(d)
+		fun = func(env *Env) int32 {
+			n := x(env)
+			if (n < 0) == negative {
+				return int32(mg.quo(abs64(int64(n))))
+			}
+			return -int32(mg.quo(abs64(int64(n))))
+		}
+	case xr.Int:
+		x := x.(func(*Env) int)
+		mg := makeMagic64(d)
+		fun = func(env *Env) int {
+			n := x(env)
+			if (n < 0) == negative {
+				return int(mg.quo(abs64(int64(n))))
+			}
+			return -int(mg.quo(abs64(int64(n))))
+		}
+	case xr.Int64:
+		x := x.(func(*Env) int64)
+		mg := makeMagic64(d)
+		fun = func(env *Env) int64 {
+			n := x(env)
+			if (n < 0) == negative {
+				return int64(mg.quo(abs64(n)))
+			}
+			return -int64(mg.quo(abs64(n)))
+		}
+	case xr.Uint8:
+		x := x.(func(*Env) uint8)
+		mg := makeMagic32(d)
+		fun = func(env *Env) uint8 {
+			return uint8(mg.quo(uint64(x(env))))
+		}
+	case xr.Uint16:
+		x := x.(func(*Env) uint16)
+		mg := makeMagic32(d)
+		fun = func(env *Env) uint16 {
+			return uint16(mg.quo(uint64(x(env))))
+		}
+	case xr.Uint32:
+		x := x.(func(*Env) uint32)
+		mg := makeMagic32(d)
+		fun = func(env *Env) uint32 {
+			return uint32(mg.quo(uint64(x(env))))
+		}
+	case xr.Uint:
+		x := x.(func(*Env) uint)
+		mg := makeMagic64(d)
+		fun = func(env *Env) uint {
+			return uint(mg.quo(uint64(x(env))))
+		}
+	case xr.Uint64:
+		x := x.(func(*Env) uint64)
+		mg := makeMagic64(d)
+		fun = func(env *Env) uint64 {
+			return mg.quo(x(env))
+		}
+	case xr.Uintptr:
+		x := x.(func(*Env) uintptr)
+		mg := makeMagic64(d)
+		fun = func(env *Env) uintptr {
+			return uintptr(mg.quo(uint64(x(env))))
+		}
+	default:
+		return nil
+	}
+	return exprFun(xe.Type, fun)
+}
+
+// remMagic tries to optimize integer remainders by a constant,
+// replacing them with multiplications and shifts.
+// returns nil if no optimized version could be compiled.
+func (c *Comp) remMagic(node *ast.BinaryExpr, xe *Expr, ye *Expr) *Expr {
+	if xe.Const() || !ye.Const() {
+		return nil
+	}
+	// the sign of the remainder is the sign of x: the sign of y does not matter
+	d, _, ok := magicDivisor(ye.Value)
+	if !ok {
+		return nil
+	}
+	x := xe.Fun
+	var fun I
+	switch xe.Type.Kind() {
+	case xr.Int8:
+		x := x.(func(*Env) int8)
+		mg := makeMagic32(d)
+		fun = func(env *Env) int8 {
+			n := x(env)
+			if n >= 0 {
+				return int8(mg.rem(uint64(n)))
+			}
+			return -int8(mg.rem(abs64(int64(n))))
+		}
+	case xr.Int16:
+		x := x.(func(*Env) int16)
+		mg := makeMagic32(d)
+		fun = func(env *Env) int16 {
+			n := x(env)
+			if n >= 0 {
+				return int16(mg.rem(uint64(n)))
+			}
+			return -int16(mg.rem(abs64(int64(n))))
+		}
+	case xr.Int32:
+		x := x.(func(*Env) int32)
+		mg := makeMagic32(d)
+		fun = func(env *Env) int32 {
+			n := x(env)
+			if n >= 0 {
+				return int32(mg.rem(uint64(n)))
+			}
+			return -int32(mg.rem(abs64(int64(n))))
+		}
+	case xr.Int:
+		x := x.(func(*Env) int)
+		mg := makeMagic64(d)
+		fun = func(env *Env) int {
+			n := x(env)
+			if n >= 0 {
+				return int(mg.rem(uint64(n)))
+			}
+			return -int(mg.rem(abs64(int64(n))))
+		}
+	case xr.Int64:
+		x := x.(func(*Env) int64)
+		mg := makeMagic64(d)
+		fun = func(env *Env) int64 {
+			n := x(env)
+			if n >= 0 {
+				return int64(mg.rem(uint64(n)))
+			}
+			return -int64(mg.rem(abs64(n)))
+		}
+	case xr.Uint8:
+		x := x.(func(*Env) uint8)
+		mg := makeMagic32(d)
+		fun = func(env *Env) uint8 {
+			return uint8(mg.rem(uint64(x(env))))
+		}
+	case xr.Uint16:
+		x := x.(func(*Env) uint16)
+		mg := makeMagic32(d)
+		fun = func(env *Env) uint16 {
+			return uint16(mg.rem(uint64(x(env))))
+		}
+	case xr.Uint32:
+		x := x.(func(*Env) uint32)
+		mg := makeMagic32(d)
+		fun = func(env *Env) uint32 {
+			return uint32(mg.rem(uint64(x(env))))
+		}
+	case xr.Uint:
+		x := x.(func(*Env) uint)
+		mg := makeMagic64(d)
+		fun = func(env *Env) uint {
+			return uint(mg.rem(uint64(x(env))))
+		}
+	case xr.Uint64:
+		x := x.(func(*Env) uint64)
+		mg := makeMagic64(d)
+		fun = func(env *Env) uint64 {
+			return mg.rem(x(env))
+		}
+	case xr.Uintptr:
+		x := x.(func(*Env) uintptr)
+		mg := makeMagic64(d)
+		fun = func(env *Env) uintptr {
+			return uintptr(mg.rem(uint64(x(env))))
+		}
+	default:
+		return nil
+	}
+	return exprFun(xe.Type, fun)
+}
+
+// return the absolute value of n. works also for math.MinInt64
+func abs64(n int64) uint64 {
+	if n < 0 {
+		return -uint64(n)
+	}
+	return uint64(n)
+}
@@ -24,6 +24,7 @@ import (
 	"unicode/utf8"
 	"unsafe"
 
+	"github.com/cosmos72/gomacro/base"
 	xr "github.com/cosmos72/gomacro/xreflect"
 )
 
@@ -33,6 +34,9 @@ type rangeJump struct {
 
 // Range compiles a "for-range" statement
 func (c *Comp) Range(node *ast.RangeStmt, labels []string) {
+	if c.Options&base.OptVecLoops != 0 && c.vecLoop(node) {
+		return
+	}
 	var nbinds [2]int
 	flag := true // node.Tok == token.DEFINE || (node.Body != nil && containLocalBinds(node.Body.List...))
 
@@ -73,6 +77,9 @@ func (c *Comp) Range(node *ast.RangeStmt, labels []string) {
 		c.rangeMap(node, erange, &jump)
 	case xr.String:
 		c.rangeString(node, erange, &jump)
+	case xr.Int, xr.Int8, xr.Int16, xr.Int32, xr.Int64,
+		xr.Uint, xr.Uint8, xr.Uint16, xr.Uint32, xr.Uint64, xr.Uintptr:
+		c.rangeInt(node, erange, &jump)
 	default:
 		c.Errorf("cannot range over %v <%v>", node.X, t)
 	}
@@ -93,10 +100,16 @@ func (c *Comp) rangeChan(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	placekey, _ := c.rangeVars(node, telem, nil)
 
 	jump.Start = c.Code.Len()
+	interruptible := c.Options&base.OptInterruptibleChan != 0
 
 	if placekey == nil {
 		c.append(func(env *Env) (Stmt, *Env) {
-			_, ok := env.Vals[idxchan].Recv()
+			var ok bool
+			if interruptible {
+				_, ok = env.Run.chanRecv(env.Vals[idxchan])
+			} else {
+				_, ok = env.Vals[idxchan].Recv()
+			}
 			var ip int
 			if ok {
 				ip = env.IP + 1
@@ -112,7 +125,13 @@ func (c *Comp) rangeChan(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 		idxrecv := bindrecv.Desc.Index()
 
 		c.append(func(env *Env) (Stmt, *Env) {
-			v, ok := env.Vals[idxchan].Recv()
+			var v xr.Value
+			var ok bool
+			if interruptible {
+				v, ok = env.Run.chanRecv(env.Vals[idxchan])
+			} else {
+				v, ok = env.Vals[idxchan].Recv()
+			}
 			var ip int
 			if ok {
 				env.Vals[idxrecv] = v
@@ -231,6 +250,86 @@ func (c *Comp) rangeSlice(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	})
 }
 
+// rangeInt compiles "for i := range n" where n is an integer
+func (c *Comp) rangeInt(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
+	t := erange.Type
+
+	// save range limit in an unnamed bind
+	bindlen := c.DeclVar0("", nil, erange)
+
+	// iterate on an unnamed counter, and copy it into the range variable at each iteration:
+	// Go spec says that modifying the range variable does not affect the iterations
+	bindi := c.DeclVar0("", t, nil)
+	placei := bindi.AsVar(0, PlaceSettable).AsPlace()
+
+	placekey, _ := c.rangeVars(node, t, nil)
+
+	jump.Start = c.Code.Len()
+
+	// fast path: counter and limit are ints stored in env.Ints
+	fast := t.Kind() == xr.Int && bindi.Desc.Class() == IntBind && bindlen.Desc.Class() == IntBind
+	idxi, idxlen := bindi.Desc.Index(), bindlen.Desc.Index()
+
+	// compile comparison against range limit
+	if fast {
+		c.append(func(env *Env) (Stmt, *Env) {
+			var ip int
+			if *(*int)(unsafe.Pointer(&env.Ints[idxi])) < *(*int)(unsafe.Pointer(&env.Ints[idxlen])) {
+				ip = env.IP + 1
+			} else {
+				ip = jump.Break
+			}
+			env.IP = ip
+			return env.Code[ip], env
+		})
+	} else {
+		// for error messages
+		lssnode := &ast.BinaryExpr{X: node.X, OpPos: node.X.Pos(), Op: token.LSS, Y: node.X}
+		pred := c.Lss(lssnode, c.Bind(bindi), c.Bind(bindlen)).Fun.(func(*Env) bool)
+		c.append(func(env *Env) (Stmt, *Env) {
+			var ip int
+			if pred(env) {
+				ip = env.IP + 1
+			} else {
+				ip = jump.Break
+			}
+			env.IP = ip
+			return env.Code[ip], env
+		})
+	}
+	if placekey != nil {
+		c.SetPlace(placekey, token.ASSIGN, c.Bind(bindi))
+	}
+
+	// compile the body
+	c.Block(node.Body)
+
+	// "continue" is a jump to the increment below
+	jump.Continue = c.Code.Len()
+
+	c.Pos = node.End() - 1
+	if fast {
+		// increment counter and jump back to comparison
+		c.append(func(env *Env) (Stmt, *Env) {
+			*(*int)(unsafe.Pointer(&env.Ints[idxi]))++
+			ip := jump.Start
+			env.IP = ip
+			return env.Code[ip], env
+		})
+		return
+	}
+	// increment counter
+	one := c.exprValue(t, xr.ValueOf(1).Convert(t.ReflectType()).Interface())
+	c.SetPlace(placei, token.ADD_ASSIGN, one)
+
+	// jump back to comparison
+	c.append(func(env *Env) (Stmt, *Env) {
+		ip := jump.Start
+		env.IP = ip
+		return env.Code[ip], env
+	})
+}
+
 func (c *Comp) rangeString(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	// save string in an unnamed bind
 	bindrange := c.DeclVar0("", nil, erange)
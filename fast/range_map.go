@@ -17,13 +17,23 @@
 package fast
 
 import (
+	"fmt"
 	"go/ast"
 	"go/token"
 	r "reflect"
+	"sort"
 
+	"github.com/cosmos72/gomacro/base"
 	xr "github.com/cosmos72/gomacro/xreflect"
 )
 
+// mapIter is implemented by *reflect.MapIter and *sortedMapIter
+type mapIter interface {
+	Next() bool
+	Key() r.Value
+	Value() r.Value
+}
+
 func (c *Comp) rangeMap(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	t := erange.Type
 	tkey, tval := t.Key(), t.Elem()
@@ -35,12 +45,21 @@ func (c *Comp) rangeMap(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	// unnamed bind, contains map iterator
 	binditer := c.NewBind("", VarBind, c.TypeOfInterface())
 	idxiter := binditer.Desc.Index()
-	c.append(func(env *Env) (Stmt, *Env) {
-		iter := mapfun(env).ReflectValue().MapRange()
-		env.Vals[idxiter] = xr.ValueOf(iter)
-		env.IP++
-		return env.Code[env.IP], env
-	})
+	if c.Options&base.OptDeterministicMapRange != 0 {
+		c.append(func(env *Env) (Stmt, *Env) {
+			iter := newSortedMapIter(mapfun(env).ReflectValue())
+			env.Vals[idxiter] = xr.ValueOf(iter)
+			env.IP++
+			return env.Code[env.IP], env
+		})
+	} else {
+		c.append(func(env *Env) (Stmt, *Env) {
+			iter := mapfun(env).ReflectValue().MapRange()
+			env.Vals[idxiter] = xr.ValueOf(iter)
+			env.IP++
+			return env.Code[env.IP], env
+		})
+	}
 
 	placekey, placeval := c.rangeVars(node, tkey, tval)
 
@@ -66,7 +85,7 @@ func (c *Comp) rangeMap(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 	// and copy current key/val into bindkey/bindval
 	c.append(func(env *Env) (Stmt, *Env) {
 		var ip int
-		iter := env.Vals[idxiter].Interface().(*r.MapIter)
+		iter := env.Vals[idxiter].Interface().(mapIter)
 		if iter.Next() {
 			if idxkey != NoIndex {
 				env.Vals[idxkey] = xr.MakeValue(iter.Key())
@@ -101,3 +120,94 @@ func (c *Comp) rangeMap(node *ast.RangeStmt, erange *Expr, jump *rangeJump) {
 		return env.Code[ip], env
 	})
 }
+
+// sortedMapIter iterates on a map in sorted key order,
+// used when option OptDeterministicMapRange is set.
+// Keys of ordered types are compared by value,
+// all other keys are compared by their printed representation.
+type sortedMapIter struct {
+	m    r.Value
+	keys []r.Value
+	vals []r.Value
+	i    int
+}
+
+func newSortedMapIter(m r.Value) *sortedMapIter {
+	n := m.Len()
+	keys := make([]r.Value, 0, n)
+	vals := make([]r.Value, 0, n)
+	for iter := m.MapRange(); iter.Next(); {
+		keys = append(keys, iter.Key())
+		vals = append(vals, iter.Value())
+	}
+	sort.Sort(&sortedMapKeys{keys, vals, nil})
+	return &sortedMapIter{m: m, keys: keys, vals: vals, i: -1}
+}
+
+func (iter *sortedMapIter) Next() bool {
+	for iter.i++; iter.i < len(iter.keys); iter.i++ {
+		key := iter.keys[iter.i]
+		if val := iter.m.MapIndex(key); val.IsValid() {
+			// entry may have been modified during the iteration
+			iter.vals[iter.i] = val
+			return true
+		} else if key.Interface() != key.Interface() {
+			// NaN keys cannot be looked up, keep the original value
+			return true
+		}
+		// entry was removed during the iteration, skip it as Go does
+	}
+	return false
+}
+
+func (iter *sortedMapIter) Key() r.Value {
+	return iter.keys[iter.i]
+}
+
+func (iter *sortedMapIter) Value() r.Value {
+	return iter.vals[iter.i]
+}
+
+// sortedMapKeys sorts map keys and the corresponding values
+type sortedMapKeys struct {
+	keys []r.Value
+	vals []r.Value
+	strs []string // printed keys, only for keys of unordered types
+}
+
+func (s *sortedMapKeys) Len() int {
+	return len(s.keys)
+}
+
+func (s *sortedMapKeys) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.vals[i], s.vals[j] = s.vals[j], s.vals[i]
+	if s.strs != nil {
+		s.strs[i], s.strs[j] = s.strs[j], s.strs[i]
+	}
+}
+
+func (s *sortedMapKeys) Less(i, j int) bool {
+	a, b := s.keys[i], s.keys[j]
+	switch a.Kind() {
+	case r.Bool:
+		return !a.Bool() && b.Bool()
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		return a.Int() < b.Int()
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		return a.Uint() < b.Uint()
+	case r.Float32, r.Float64:
+		x, y := a.Float(), b.Float()
+		// NaN sorts before all other values
+		return x < y || (x != x && y == y)
+	case r.String:
+		return a.String() < b.String()
+	}
+	if s.strs == nil {
+		s.strs = make([]string, len(s.keys))
+		for k, key := range s.keys {
+			s.strs[k] = fmt.Sprintf("%v", key)
+		}
+	}
+	return s.strs[i] < s.strs[j]
+}
@@ -0,0 +1,120 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * receiver.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	r "reflect"
+	"unsafe"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// EvalWithReceiver parses, compiles and executes src in a scope where the exported fields
+// and methods of recv, including the promoted ones, are visible as bare identifiers.
+// Useful for rules engines and templates: with a suitable struct,
+// "Price * Quantity > Limit" reads recv.Price, recv.Quantity and recv.Limit.
+//
+// recv must be a struct or a pointer to struct. If it's a pointer, assignments
+// to its fields modify *recv, and methods with pointer receiver are in scope too.
+// If it's a struct, fields are assigned in a private copy.
+//
+// The fields and methods of recv hide the declarations of the current package with the same name,
+// and are hidden by the declarations inside src. They are no longer in scope after EvalWithReceiver returns,
+// but closures created by src keep accessing them
+func (ir *Interp) EvalWithReceiver(src string, recv interface{}) ([]xr.Value, []xr.Type) {
+	c, vals := ir.receiverScope(recv)
+	expr := ir.compileAstIn(c, ir.Parse(src))
+	if expr == nil {
+		return nil, nil
+	}
+	return ir.runReceiverExpr(c, vals, expr)
+}
+
+// run expr, compiled in the Comp c returned by receiverScope()
+func (ir *Interp) runReceiverExpr(c *Comp, vals []xr.Value, expr *Expr) ([]xr.Value, []xr.Type) {
+	env := NewEnv(ir.PrepareEnv(), c.BindNum, c.IntBindNum)
+	env.UsedByClosure = true // src may create closures: do not recycle env
+	copy(env.Vals, vals)
+	return ir.runExprIn(expr, env)
+}
+
+// create a Comp nested inside ir.Comp that declares the exported fields and methods of recv.
+// Also return the initial values of such declarations, to be stored in Env.Vals
+func (ir *Interp) receiverScope(recv interface{}) (*Comp, []xr.Value) {
+	c := NewComp(ir.Comp, nil)
+	v := r.ValueOf(recv)
+	if v.Kind() == r.Ptr && !v.IsNil() && v.Elem().Kind() == r.Struct {
+		v = v.Elem()
+	} else if v.Kind() == r.Struct {
+		// make an addressable copy, so that fields can be assigned
+		p := r.New(v.Type())
+		p.Elem().Set(v)
+		v = p.Elem()
+	} else {
+		c.Errorf("EvalWithReceiver: expecting a struct or a non-nil pointer to struct, found %v <%T>", recv, recv)
+	}
+	var vals []xr.Value
+	declare := func(name string, class BindClass, val r.Value) {
+		// use c.CompBinds.NewBind() to prevent optimization VarBind -> IntBind:
+		// variables must be stored in Env.Vals at their original address
+		bind := c.CompBinds.NewBind(&c.Output, name, class, c.Universe.FromReflectType(val.Type()))
+		if idx := bind.Desc.Index(); idx != NoIndex {
+			for len(vals) <= idx {
+				vals = append(vals, xr.Value{})
+			}
+			vals[idx] = xr.MakeValue(val)
+		}
+	}
+	// breadth-first visit of v and its embedded structs, so that
+	// shallower fields hide deeper ones, as Go field promotion does
+	for level := []r.Value{v}; len(level) != 0; {
+		var next []r.Value
+		for _, v := range level {
+			t := v.Type()
+			for i, n := 0, t.NumField(); i < n; i++ {
+				field, fv := t.Field(i), v.Field(i)
+				if len(field.PkgPath) == 0 && c.Binds[field.Name] == nil {
+					declare(field.Name, VarBind, fv)
+				}
+				if !field.Anonymous {
+					continue
+				} else if fv.Kind() == r.Ptr && !fv.IsNil() {
+					fv = fv.Elem()
+				}
+				if fv.Kind() == r.Struct && fv.CanAddr() {
+					if !fv.CanSet() {
+						// exported fields promoted through an unexported embedded struct
+						// are assignable in Go, but reflect marks them read-only
+						fv = r.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+					}
+					next = append(next, fv)
+				}
+			}
+		}
+		level = next
+	}
+	// methods with pointer receiver are a superset of methods with value receiver
+	p := v.Addr()
+	tp := p.Type()
+	for i, n := 0, tp.NumMethod(); i < n; i++ {
+		mtd := tp.Method(i)
+		if c.Binds[mtd.Name] == nil {
+			declare(mtd.Name, FuncBind, p.Method(i))
+		}
+	}
+	return c, vals
+}
@@ -18,11 +18,11 @@ package fast
 
 import (
 	"bufio"
+	"fmt"
 	"go/ast"
-	"go/token"
+	"io"
 	"os"
 	"runtime/debug"
-	"sort"
 	"strings"
 	"time"
 
@@ -43,7 +43,15 @@ func (ir *Interp) Read() (string, int) {
 	if g.Options&base.OptShowPrompt != 0 {
 		opts |= base.ReadOptShowPrompt
 	}
-	src, firstToken := g.ReadMultiline(opts, ir.Comp.Prompt)
+	src, firstToken, err := base.ReadMultiline(g.Readline, opts, ir.Comp.Prompt)
+	for err == errReadInterrupted {
+		// Ctrl+C while typing: discard the statement, and read again the line typed after Ctrl+C
+		g.IncLine(src)
+		src, firstToken, err = base.ReadMultiline(g.Readline, opts, ir.Comp.Prompt)
+	}
+	if err != nil && err != io.EOF {
+		g.Fprintf(g.Stderr, "// read error: %s\n", err)
+	}
 	if firstToken < 0 {
 		g.IncLine(src)
 	} else if firstToken > 0 {
@@ -52,6 +60,47 @@ func (ir *Interp) Read() (string, int) {
 	return src, firstToken
 }
 
+// like Read, but return io.ErrUnexpectedEOF if input ends in the middle of a statement,
+// instead of reporting the partial statement as a read error.
+// other read errors are reported and reading continues.
+func (ir *Interp) readStatement(opts base.ReadOptions) (string, int, error) {
+	g := &ir.Comp.Globals
+	in := g.Readline
+	if mux := ir.Comp.CompGlobals.mux; mux != nil && in != nil {
+		in = muxReadline{in, mux.Mux}
+	}
+	src, firstToken, err := base.ReadMultiline(in, opts, ir.Comp.Prompt)
+	switch err {
+	case nil, io.EOF, io.ErrUnexpectedEOF:
+		break
+	default:
+		fmt.Fprintf(g.Stderr, "// read error: %s\n", err)
+		err = nil
+	}
+	if err == io.ErrUnexpectedEOF {
+		return src, firstToken, err
+	}
+	if firstToken < 0 {
+		g.IncLine(src)
+	} else if firstToken > 0 {
+		g.IncLine(src[0:firstToken])
+	}
+	return src, firstToken, err
+}
+
+// return the error for a statement truncated by the end of input
+func (ir *Interp) incompleteStatement(src string, firstToken int) error {
+	g := &ir.Comp.Globals
+	if firstToken > 0 {
+		g.IncLine(src[0:firstToken])
+		src = src[firstToken:]
+	}
+	if n := strings.IndexByte(src, '\n'); n >= 0 {
+		src = src[:n]
+	}
+	return fmt.Errorf("%s:%d: unexpected EOF, incomplete statement: %s", g.Filepath, g.Line+1, src)
+}
+
 // parse + macroexpansion + collect declarations & statements
 func (ir *Interp) Parse(src string) ast2.Ast {
 	if len(src) == 0 {
@@ -79,10 +128,14 @@ func (ir *Interp) CompileNode(node ast.Node) *Expr {
 }
 
 func (ir *Interp) CompileAst(form ast2.Ast) *Expr {
+	return ir.compileAstIn(ir.Comp, form)
+}
+
+// compile form in c, which must be ir.Comp or a Comp nested inside it
+func (ir *Interp) compileAstIn(c *Comp, form ast2.Ast) *Expr {
 	if form == nil {
 		return nil
 	}
-	c := ir.Comp
 	g := c.CompGlobals
 
 	if g.Options&base.OptMacroExpandOnly != 0 {
@@ -91,6 +144,8 @@ func (ir *Interp) CompileAst(form ast2.Ast) *Expr {
 	}
 
 	// compile phase
+	ir.importURLs(form)
+	g.noteUsedImports(form)
 	expr := c.Compile(form)
 
 	if g.Options&base.OptKeepUntyped == 0 && expr != nil && expr.Untyped() {
@@ -118,15 +173,20 @@ func (ir *Interp) RunExpr(e *Expr) ([]xr.Value, []xr.Type) {
 	if e == nil {
 		return nil, nil
 	}
-	env := ir.PrepareEnv()
+	return ir.runExprIn(e, ir.PrepareEnv())
+}
 
+// run e in env, which must be the Env of ir.Comp or of a Comp nested inside it
+func (ir *Interp) runExprIn(e *Expr, env *Env) ([]xr.Value, []xr.Type) {
 	if ir.Comp.Globals.Options&base.OptKeepUntyped == 0 && e.Untyped() {
 		e.ConstTo(e.DefaultType())
 	}
 	run := env.Run
 	run.applyDebugOp(DebugOpContinue)
 
+	defer run.enterEval()()
 	defer run.setCurrEnv(run.setCurrEnv(env))
+	defer run.trapRuntimeError(ir.Comp.Position())
 
 	fun := e.AsXV(COptKeepUntyped)
 	v, vs := fun(env)
@@ -156,7 +216,9 @@ func (ir *Interp) DebugExpr(e *Expr) ([]xr.Value, []xr.Type) {
 	}
 	run := env.Run
 	run.applyDebugOp(DebugOpStep)
+	defer run.enterEval()()
 	defer run.setCurrEnv(run.setCurrEnv(env))
+	defer run.trapRuntimeError(ir.Comp.Position())
 
 	fun := e.AsXV(COptKeepUntyped)
 	v, vs := fun(env)
@@ -242,6 +304,7 @@ func (ir *Interp) prepareEnv(minValDelta int, minIntDelta int) *Env {
 	// in case we received a SigInterrupt in the meantime
 	g.Signals.Sync = base.SigNone
 	g.Signals.Async = base.SigNone
+	g.clearInterrupt()
 	if g.Options&base.OptDebugger != 0 {
 		// for debugger
 		env.DebugComp = c
@@ -263,18 +326,21 @@ func (ir *Interp) ReplStdin() {
 // This is free software with ABSOLUTELY NO WARRANTY.
 `, g.ReplCmdChar, g.ReplCmdChar)
 	}
-	tty, _ := base.MakeTtyReadline(historyfile)
+	tty := base.MakeTermReadlineMode(historyfile, g.Terminal)
 	defer tty.Close(historyfile) // restore normal tty mode
 
-	ch := base.StartSignalHandler(ir.Interrupt)
-	defer base.StopSignalHandler(ch)
-
-	savetty := g.Readline
-	g.Readline = tty
-	defer func() {
-		g.Readline = savetty
-	}()
-	tty.Term.SetWordCompleter(ir.CompleteWords)
+	defer ir.handleCtrlC(tty)()
+	if g.CtrlCExit == nil {
+		// save history before exiting
+		g.CtrlCExit = func() {
+			tty.Close(historyfile)
+			os.Exit(130)
+		}
+		defer func() {
+			g.CtrlCExit = nil
+		}()
+	}
+	tty.SetWordCompleter(ir.CompleteWords)
 
 	g.Line = 0
 	for ir.ReadParseEvalPrint() {
@@ -284,29 +350,38 @@ func (ir *Interp) ReplStdin() {
 }
 
 func (ir *Interp) Repl(in *bufio.Reader) {
-	g := ir.Comp.CompGlobals
-
-	r := base.MakeBufReadline(in)
-
-	ch := base.StartSignalHandler(ir.Interrupt)
-	defer base.StopSignalHandler(ch)
-
-	savetty := g.Readline
-	g.Readline = r
-	defer func() {
-		g.Readline = savetty
-	}()
+	defer ir.handleCtrlC(base.MakeBufReadline(in))()
 
 	for ir.ReadParseEvalPrint() {
 	}
 }
 
+// install the Ctrl+C handler Interp.CtrlC and read input from in.
+// Also compile channel operations as interruptible.
+// Return a function that restores the previous settings
+func (ir *Interp) handleCtrlC(in base.Readline) func() {
+	cg := ir.Comp.CompGlobals
+	ch := base.StartSignalHandler(ir.CtrlC)
+	saveopts := cg.Options & base.OptInterruptibleChan
+	cg.Options |= base.OptInterruptibleChan
+	saveread := cg.Readline
+	cg.Readline = &ctrlCReadline{in: in, c: &cg.ctrlC}
+	return func() {
+		base.StopSignalHandler(ch)
+		cg.Options = cg.Options&^base.OptInterruptibleChan | saveopts
+		cg.Readline = saveread
+	}
+}
+
 func (ir *Interp) ReadParseEvalPrint() (callAgain bool) {
 	src, firstToken := ir.Read()
 	if firstToken < 0 {
 		// skip comment-only lines and continue, but fail on EOF or other errors
 		return len(src) != 0
 	}
+	c := &ir.Comp.ctrlC
+	c.beginEval()
+	defer c.endEval(ir.env.Run)
 	return ir.ParseEvalPrint(src)
 }
 
@@ -315,8 +390,18 @@ func (ir *Interp) ParseEvalPrint(src string) (callAgain bool) {
 		return true // no input => no form
 	}
 
+	cg := ir.Comp.CompGlobals
+	if cg.eventHandler != nil {
+		cg.emit(Event{Kind: EventInput, Src: src})
+		// restore output after afterEval, which prints errors
+		defer cg.redirectOutputToEvents()()
+	}
+
+	// report hotspots after errors, which are printed by afterEval
+	defer ir.collectHotspots()()
 	t1, trap, duration := ir.beforeEval()
-	defer ir.afterEval(src, &callAgain, &trap, t1, duration)
+	phase := EventParseError // event to emit if a panic happens
+	defer ir.afterEval(src, &callAgain, &trap, &phase, t1, duration)
 
 	src, opt := ir.Cmd(src)
 
@@ -338,34 +423,138 @@ func (ir *Interp) ParseEvalPrint(src string) (callAgain bool) {
 	// parse + macroexpansion
 	form := ir.Parse(src)
 
+	if forms := ir.splitStatements(form); forms != nil {
+		if cg.Timeout > 0 {
+			defer ir.startTimeout(cg.Timeout)()
+		}
+		// a panic stops at the first failing statement,
+		// the previous ones are executed and their results printed
+		for _, form := range forms {
+			phase = EventCompileError
+			ir.runPrint(ir.CompileAst(form), &phase)
+		}
+		trap = false // no panic happened
+		return callAgain
+	}
+
 	// compile
+	phase = EventCompileError
 	expr := ir.CompileAst(form)
 
+	if cg.Timeout > 0 {
+		defer ir.startTimeout(cg.Timeout)()
+	}
+	ir.runPrint(expr, &phase)
+
+	trap = false // no panic happened
+	return callAgain
+}
+
+// run compiled expression and print its results
+func (ir *Interp) runPrint(expr *Expr, phase *EventKind) {
+	cg := ir.Comp.CompGlobals
+
 	// run expression
+	*phase = EventRuntimeError
+	cg.emit(Event{Kind: EventExecStart})
 	values, types := ir.RunExpr(expr)
+	cg.emit(Event{Kind: EventResult, Values: values, Types: types})
 
 	// print phase
-	g.Print(values, types)
+	cg.Print(values, types)
+}
 
-	trap = false // no panic happened
-	return callAgain
+// if base.OptSplitStatements is set, split a line containing several statements
+// a := 1; b := 2; a+b into the forms to compile and execute one by one.
+// Consecutive declarations are kept together, because they may reference each other out of order.
+// Returns nil if form must be compiled as a whole
+func (ir *Interp) splitStatements(form ast2.Ast) []ast2.Ast {
+	g := &ir.Comp.Globals
+	if g.Options&(base.OptSplitStatements|base.OptMacroExpandOnly) != base.OptSplitStatements {
+		return nil
+	}
+	slice, ok := form.(ast2.NodeSlice)
+	if !ok || len(slice.X) < 2 {
+		return nil
+	}
+	var forms []ast2.Ast
+	var decls []ast.Node
+	for _, node := range slice.X {
+		switch node.(type) {
+		case *ast.EmptyStmt:
+			continue
+		case ast.Decl:
+			decls = append(decls, node)
+			continue
+		}
+		if len(decls) != 0 {
+			forms = append(forms, ast2.NodeSlice{X: decls})
+			decls = nil
+		}
+		forms = append(forms, ast2.ToAst(node))
+	}
+	if len(decls) != 0 {
+		forms = append(forms, ast2.NodeSlice{X: decls})
+	}
+	if len(forms) < 2 {
+		return nil
+	}
+	return forms
+}
+
+// startTimeout interrupts the current evaluation if it runs longer than timeout.
+// The returned function must be deferred: it stops the timer
+// and converts the resulting interrupt into a clearer error
+func (ir *Interp) startTimeout(timeout time.Duration) func() {
+	run := ir.env.Run
+	fired := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() {
+		// always interrupt, even if Ctrl+C is configured to enter the debugger
+		for _, x := range run.evalRuns() {
+			x.Signals.Async = base.SigInterrupt
+			x.notifyInterrupt()
+		}
+		close(fired)
+	})
+	return func() {
+		if timer.Stop() {
+			return
+		}
+		<-fired
+		rec := recover()
+		if rec == nil {
+			// evaluation completed just before the interrupt: discard it
+			run.Signals.Async = base.SigNone
+			run.clearInterrupt()
+		} else if rec == base.SigInterrupt {
+			panic(fmt.Errorf("evaluation interrupted: exceeded timeout %v", timeout))
+		} else {
+			panic(rec)
+		}
+	}
 }
 
 func (ir *Interp) beforeEval() (t1 time.Time, trap bool, duration bool) {
 	g := &ir.Comp.Globals
 	trap = g.Options&base.OptTrapPanic != 0
 	duration = g.Options&base.OptShowTime != 0
-	if duration {
+	if duration || ir.Comp.eventHandler != nil {
 		t1 = time.Now()
 	}
 	return t1, trap, duration
 }
 
-func (ir *Interp) afterEval(src string, callAgain *bool, trap *bool, t1 time.Time, duration bool) {
-	g := &ir.Comp.Globals
+func (ir *Interp) afterEval(src string, callAgain *bool, trap *bool, phase *EventKind, t1 time.Time, duration bool) {
+	cg := ir.Comp.CompGlobals
+	g := &cg.Globals
 	g.IncLine(src)
 	if *trap {
 		rec := recover()
+		cg.emit(Event{Kind: *phase, Err: panicToError(rec)})
+		if err, ok := rec.(*InterpRuntimeError); ok {
+			// also show the interpreted call stack
+			rec = err.String()
+		}
 		if g.Options&base.OptPanicStackTrace != 0 {
 			g.Fprintf(g.Stderr, "%v\n%s", rec, debug.Stack())
 		} else {
@@ -377,6 +566,9 @@ func (ir *Interp) afterEval(src string, callAgain *bool, trap *bool, t1 time.Tim
 		delta := time.Since(t1)
 		g.Debugf("eval time %v", delta)
 	}
+	if cg.eventHandler != nil {
+		cg.emit(Event{Kind: EventDone, Duration: time.Since(t1)})
+	}
 }
 
 func cmdOptForceEval(g *base.Globals, opt base.CmdOpt) (toenable base.Options) {
@@ -392,211 +584,7 @@ func cmdOptForceEval(g *base.Globals, opt base.CmdOpt) (toenable base.Options) {
 	return 0
 }
 
-// implement code completion API github.com/pererh/liner.WordCompleter
-// Currently only supports global symbols and imported packages,
-// optionally followed by a dot-separated sequence of field or method names,
-// including embedded fields and wrapper methods.
-func (ir *Interp) CompleteWords(line string, pos int) (head string, completions []string, tail string) {
-	if pos > len(line) {
-		pos = len(line)
-	}
-	head = line[:pos]
-	tail = line[pos:]
-	words := strings.Split(head, ".")
-	n := len(words)
-	// find the longest sequence of ident.ident.ident...
-
-	for i := n - 1; i >= 0; i-- {
-		// ignore spaces before and after identifiers
-		words[i] = strings.TrimSpace(words[i])
-
-		if i == n-1 && len(words[i]) == 0 {
-			// last word can be empty: it means TAB immediately after '.'
-			continue
-		}
-		word := TailIdentifier(words[i])
-		if len(word) != len(words[i]) {
-			if len(word) != 0 {
-				words[i] = word
-			} else {
-				i++
-			}
-			words = words[i:]
-			break
-		}
-	}
-	completions = ir.Comp.CompleteWords(words)
-	if len(completions) != 0 {
-		fixed := len(head) - len(TailIdentifier(head))
-		pos := strings.LastIndexByte(head, '.')
-		if pos >= 0 && pos >= fixed {
-			head = head[:pos+1]
-		} else {
-			head = head[:fixed]
-		}
-	}
-	return head, completions, tail
-}
-
-// implement code completion on ident.ident.ident.ident...
-func (c *Comp) CompleteWords(words []string) []string {
-	var completions []string
-	switch len(words) {
-	case 0:
-	case 1:
-		completions = c.completeWord(words[0])
-	default:
-		var node interface{}
-		if sym := c.TryResolve(words[0]); sym != nil {
-			node = &sym.Bind
-		} else if typ := c.TryResolveType(words[0]); typ != nil {
-			node = typ
-		} else {
-			break
-		}
-		completions = c.completeWords(node, words[1:])
-	}
-	return completions
-}
-
-func (c *Comp) completeWords(node interface{}, words []string) []string {
-	i, n := 0, len(words)
-	for i+1 < n {
-		switch obj := node.(type) {
-		case *Bind:
-			if obj.Const() {
-				if imp, ok := obj.Value.(*Import); ok {
-					// complete on imported package contents
-					node = imp
-					continue
-				}
-			}
-			// complete on symbol type
-			node = obj.Type
-			continue
-		case *Import:
-			if i != 0 {
-				break
-			} else if bind := obj.Binds[words[i]]; bind != nil {
-				// complete on imported package binds
-				node = bind
-				i++
-				continue
-			} else if typ := obj.Types[words[i]]; typ != nil {
-				// complete on imported package types
-				node = typ
-				i++
-				continue
-			}
-		case xr.Type:
-			field, fieldok, _, _, err := c.TryLookupFieldOrMethod(obj, words[i])
-			if err != nil {
-				break
-			} else if fieldok {
-				node = field.Type
-				i++
-				continue
-			}
-			// {type,value}.method.anything will never compile
-		}
-		return nil
-	}
-	return c.completeLastWord(node, words[i])
-}
-
-var keywords []string
-
-func init() {
-	lo, hi := token.BREAK, token.VAR
-	keywords = make([]string, hi-lo+3)
-	for tok := lo; tok <= hi; tok++ {
-		keywords[tok-lo] = tok.String()
-	}
-	keywords[hi-lo+1] = "macro"
-	keywords[hi-lo+2] = "template"
-}
-
-// complete a single, partial word
-func (c *Comp) completeWord(word string) []string {
-	var completions []string
-	if size := len(word); size != 0 {
-		// complete binds and types
-		for co := c; co != nil; co = co.Outer {
-			for name := range co.Binds {
-				if len(name) >= size && name[:size] == word {
-					completions = append(completions, name)
-				}
-			}
-			for name := range co.Types {
-				if len(name) >= size && name[:size] == word {
-					completions = append(completions, name)
-				}
-			}
-		}
-		// complete keywords
-		for _, name := range keywords {
-			if len(name) >= size && name[:size] == word {
-				completions = append(completions, name)
-			}
-		}
-	}
-	return sortUnique(completions)
-}
-
-// complete the last partial word of a sequence ident.ident.ident...
-func (c *Comp) completeLastWord(node interface{}, word string) []string {
-	var completions []string
-	size := len(word)
-	for {
-		switch obj := node.(type) {
-		case *Bind:
-			if obj.Const() {
-				if imp, ok := obj.Value.(*Import); ok {
-					// complete on imported package contents
-					node = imp
-					continue
-				}
-			}
-			// complete on symbol type
-			node = obj.Type
-			continue
-		case *Import:
-			for name := range obj.Binds {
-				if len(name) >= size && name[:size] == word {
-					completions = append(completions, name)
-				}
-			}
-			for name := range obj.Types {
-				if len(name) >= size && name[:size] == word {
-					completions = append(completions, name)
-				}
-			}
-		case xr.Type:
-			completions = c.listFieldsAndMethods(obj, word)
-		}
-		break
-	}
-	return sortUnique(completions)
-}
-
 // return the trailing substring of s that is a valid identifier
 func TailIdentifier(s string) string {
 	return bstrings.TailIdentifier(s)
 }
-
-func sortUnique(vec []string) []string {
-	if n := len(vec); n > 1 {
-		sort.Strings(vec)
-		prev := vec[0]
-		j := 1
-		for i := 1; i < n; i++ {
-			if s := vec[i]; s != prev {
-				vec[j] = s
-				prev = s
-				j++
-			}
-		}
-		vec = vec[:j]
-	}
-	return vec
-}
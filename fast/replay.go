@@ -0,0 +1,240 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * replay.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	r "reflect"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// RandomEvent is a call to a source of randomness or time,
+// recorded by Interp.RecordRandom and replayed by Interp.ReplayRandom
+type RandomEvent struct {
+	Call   string            `json:"call"`             // called function, as "math/rand.Intn"
+	Result []json.RawMessage `json:"result,omitempty"` // returned values
+	Data   []byte            `json:"data,omitempty"`   // bytes stored by the call into its []byte argument
+}
+
+// Recorder records or replays the calls of interpreted code
+// to sources of randomness or time. See Interp.RecordRandom and Interp.ReplayRandom
+type Recorder struct {
+	lock    sync.Mutex
+	enc     *json.Encoder // non-nil while recording
+	events  []RandomEvent // remaining events while replaying
+	restore []func()
+	closer  io.Closer // closed by Stop, if non-nil
+	desc    string    // shown by :set
+	err     error     // first error writing the log
+}
+
+// functions replaced while recording or replaying.
+// Their results are recorded, and returned while replaying without calling them.
+// Also math/rand.Shuffle is replaced, and implemented with the recorded math/rand.Intn
+var randomFuncs = []string{
+	"time.Now", "time.Since", "time.Until",
+	"math/rand.ExpFloat64", "math/rand.Float32", "math/rand.Float64",
+	"math/rand.Int", "math/rand.Int31", "math/rand.Int31n",
+	"math/rand.Int63", "math/rand.Int63n", "math/rand.Intn",
+	"math/rand.NormFloat64", "math/rand.Perm", "math/rand.Read",
+	"math/rand.Uint32", "math/rand.Uint64",
+	"crypto/rand.Int", "crypto/rand.Prime", "crypto/rand.Read",
+}
+
+var rtypeOfError = r.TypeOf((*error)(nil)).Elem()
+
+// RecordRandom replaces the functions time.Now, time.Since, time.Until,
+// the top-level functions of math/rand and crypto/rand.Read, Int and Prime
+// seen by interpreted code with versions that write each call and its results to w,
+// as one JSON object per line. Replaying the log with Interp.ReplayRandom
+// makes the interpreted program deterministic, enabling reproducible bug reports.
+//
+// Sources created explicitly, as math/rand.New(), are not recorded: seed them instead.
+// Reads from crypto/rand.Reader are not recorded either: use crypto/rand.Read.
+// If multiple goroutines call the recorded functions, the order of calls is not deterministic
+// and the log may not be replayable.
+//
+// Call Recorder.Stop to restore the original functions.
+// Must not be called while interpreted code is running
+func (ir *Interp) RecordRandom(w io.Writer) (*Recorder, error) {
+	rec := &Recorder{enc: json.NewEncoder(w)}
+	return rec, rec.install(ir)
+}
+
+// ReplayRandom replaces the functions recorded by Interp.RecordRandom
+// with versions that return the results logged in log, instead of calling the original functions.
+// Interpreted code panics if it calls them in a different order than recorded,
+// or more times than recorded.
+//
+// Call Recorder.Stop to restore the original functions.
+// Must not be called while interpreted code is running
+func (ir *Interp) ReplayRandom(log io.Reader) (*Recorder, error) {
+	rec := &Recorder{}
+	dec := json.NewDecoder(log)
+	for {
+		var event RandomEvent
+		if err := dec.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("replay: %v", err)
+		}
+		rec.events = append(rec.events, event)
+	}
+	return rec, rec.install(ir)
+}
+
+// Stop restores the original functions, and returns the first error
+// that occurred writing the log, if any
+func (rec *Recorder) Stop() error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	for i := len(rec.restore) - 1; i >= 0; i-- {
+		rec.restore[i]()
+	}
+	rec.restore = nil
+	if rec.closer != nil {
+		if err := rec.closer.Close(); err != nil && rec.err == nil {
+			rec.err = err
+		}
+		rec.closer = nil
+	}
+	return rec.err
+}
+
+// Remaining returns the number of events not replayed yet
+func (rec *Recorder) Remaining() int {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	return len(rec.events)
+}
+
+func (rec *Recorder) install(ir *Interp) error {
+	for _, name := range randomFuncs {
+		dot := strings.LastIndexByte(name, '.')
+		fun := imports.Packages[name[:dot]].Binds[name[dot+1:]]
+		if !fun.IsValid() {
+			continue
+		}
+		if err := rec.mock(ir, name, rec.wrap(name, fun)); err != nil {
+			rec.Stop()
+			return err
+		}
+	}
+	intn := rec.wrap("math/rand.Intn", r.ValueOf(rand.Intn)).Interface().(func(int) int)
+	return rec.mock(ir, "math/rand.Shuffle", func(n int, swap func(i, j int)) {
+		if n < 0 {
+			panic("invalid argument to Shuffle")
+		}
+		// same algorithm as math/rand.Shuffle, but using the recorded or replayed Intn
+		for i := n - 1; i > 0; i-- {
+			swap(i, intn(i+1))
+		}
+	})
+}
+
+func (rec *Recorder) mock(ir *Interp, name string, replacement interface{}) error {
+	restore, err := ir.Mock(name, replacement)
+	if err == nil {
+		rec.restore = append(rec.restore, restore)
+	}
+	return err
+}
+
+// return a function with the same type as fun, that records or replays its calls
+func (rec *Recorder) wrap(name string, fun r.Value) r.Value {
+	t := fun.Type()
+	// Read([]byte) stores random bytes into its argument
+	fills := t.NumIn() == 1 && t.In(0) == r.TypeOf([]byte(nil))
+	return r.MakeFunc(t, func(args []r.Value) []r.Value {
+		if rec.enc == nil {
+			return rec.replay(name, t, args, fills)
+		}
+		out := fun.Call(args)
+		rec.record(name, args, out, fills)
+		return out
+	})
+}
+
+func (rec *Recorder) record(name string, args []r.Value, out []r.Value, fills bool) {
+	event := RandomEvent{Call: name, Result: make([]json.RawMessage, len(out))}
+	if fills {
+		event.Data = args[0].Bytes()
+	}
+	for i, v := range out {
+		var x interface{}
+		if v.Type() == rtypeOfError {
+			if !v.IsNil() {
+				x = v.Interface().(error).Error()
+			}
+		} else {
+			x = v.Interface()
+		}
+		event.Result[i], _ = json.Marshal(x)
+	}
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if err := rec.enc.Encode(&event); err != nil && rec.err == nil {
+		rec.err = err
+	}
+}
+
+func (rec *Recorder) replay(name string, t r.Type, args []r.Value, fills bool) []r.Value {
+	rec.lock.Lock()
+	if len(rec.events) == 0 {
+		rec.lock.Unlock()
+		panic(fmt.Errorf("replay: unexpected call to %s, log is exhausted", name))
+	}
+	event := rec.events[0]
+	rec.events = rec.events[1:]
+	rec.lock.Unlock()
+
+	if event.Call != name {
+		panic(fmt.Errorf("replay: unexpected call to %s, log contains a call to %s", name, event.Call))
+	} else if len(event.Result) != t.NumOut() {
+		panic(fmt.Errorf("replay: call to %s returns %d values, log contains %d", name, t.NumOut(), len(event.Result)))
+	}
+	if fills {
+		r.Copy(args[0], r.ValueOf(event.Data))
+	}
+	out := make([]r.Value, t.NumOut())
+	for i := range out {
+		out[i] = decodeResult(name, t.Out(i), event.Result[i])
+	}
+	return out
+}
+
+func decodeResult(name string, t r.Type, data json.RawMessage) r.Value {
+	v := r.New(t).Elem()
+	if t == rtypeOfError {
+		var msg *string
+		if err := json.Unmarshal(data, &msg); err != nil {
+			panic(fmt.Errorf("replay: call to %s: %v", name, err))
+		} else if msg != nil {
+			v.Set(r.ValueOf(errors.New(*msg)))
+		}
+	} else if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+		panic(fmt.Errorf("replay: call to %s: %v", name, err))
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * runtime_error.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"errors"
+	"go/token"
+	r "reflect"
+	"runtime"
+	"strings"
+)
+
+// StackFrame is an entry in the call stack of interpreted code
+type StackFrame struct {
+	Func string         // name of the interpreted function. Empty for toplevel code, or if unknown
+	Pos  token.Position // position of the statement being executed. Invalid if unknown
+}
+
+func (frame StackFrame) String() string {
+	name := frame.Func
+	if len(name) == 0 {
+		name = "<toplevel>"
+	}
+	if !frame.Pos.IsValid() {
+		return name
+	}
+	return name + " at " + frame.Pos.String()
+}
+
+// InterpRuntimeError is the panic raised when interpreted code causes a Go runtime error,
+// as an index out of range, a nil pointer dereference or a failed type assertion.
+// It wraps the original error and adds the interpreted call stack
+type InterpRuntimeError struct {
+	// the original error: a runtime.Error, or the error raised by package reflect
+	// while executing interpreted code, as "reflect: slice index out of range"
+	Err   error
+	Stack []StackFrame // interpreted call stack at the time of the panic, innermost first
+}
+
+// Pos returns the position of the interpreted statement that caused the error. Invalid if unknown
+func (err *InterpRuntimeError) Pos() token.Position {
+	if len(err.Stack) == 0 {
+		return token.Position{}
+	}
+	return err.Stack[0].Pos
+}
+
+func (err *InterpRuntimeError) Error() string {
+	if pos := err.Pos(); pos.IsValid() {
+		return pos.String() + ": " + err.Err.Error()
+	}
+	return err.Err.Error()
+}
+
+func (err *InterpRuntimeError) Unwrap() error {
+	return err.Err
+}
+
+// RuntimeError marks InterpRuntimeError as a runtime.Error, as the error it wraps
+func (err *InterpRuntimeError) RuntimeError() {
+}
+
+// StackTrace returns the interpreted call stack, one frame per line, innermost first
+func (err *InterpRuntimeError) StackTrace() string {
+	var buf strings.Builder
+	for _, frame := range err.Stack {
+		buf.WriteString("\tin ")
+		buf.WriteString(frame.String())
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// String returns the error message followed by the interpreted call stack,
+// if the error happened inside an interpreted function
+func (err *InterpRuntimeError) String() string {
+	if len(err.Stack) > 1 || len(err.Stack) == 1 && len(err.Stack[0].Func) != 0 {
+		return err.Error() + "\n" + strings.TrimSuffix(err.StackTrace(), "\n")
+	}
+	return err.Error()
+}
+
+// savePanicStack records the interpreted call stack of the current panic,
+// unless it was already recorded by an inner function
+func (run *Run) savePanicStack() {
+	if run.panicStack == nil {
+		run.panicStack = run.callStack(run.CurrEnv)
+	}
+}
+
+// return the interpreted call stack of env, innermost first
+func (run *Run) callStack(env *Env) []StackFrame {
+	stack := []StackFrame{}
+	for env != nil {
+		frame := StackFrame{Pos: run.envPosition(env)}
+		// follow the nested *Env up to the function body
+		for env.Caller == nil && env.Outer != nil && env != env.FileEnv {
+			env = env.Outer
+		}
+		if env.Caller == nil {
+			// toplevel code
+			stack = append(stack, frame)
+			break
+		}
+		if c := env.DebugComp; c != nil && c.FuncMaker != nil {
+			frame.Func = c.FuncMaker.Name
+		} else {
+			frame.Func = "func"
+		}
+		stack = append(stack, frame)
+		env = env.Caller
+	}
+	return stack
+}
+
+// return the position of the statement being executed by env
+func (run *Run) envPosition(env *Env) token.Position {
+	if ip := env.IP; ip >= 0 && ip < len(env.DebugPos) && run.Fileset != nil {
+		if pos := env.DebugPos[ip]; pos != token.NoPos {
+			return run.Fileset.Position(pos)
+		}
+	}
+	return token.Position{}
+}
+
+// convert the current panic to *InterpRuntimeError if it is a Go runtime error. Must be deferred
+// by toplevel executions, after setting run.CurrEnv and before the panic happens.
+// toplevel is the position of the executed code, used if toplevel statements have no position
+func (run *Run) trapRuntimeError(toplevel token.Position) {
+	rec := recover()
+	stack := run.panicStack
+	run.panicStack = nil
+	if rec == nil {
+		return
+	}
+	if err := runtimeErrorOf(rec); err != nil {
+		if stack == nil {
+			stack = run.callStack(run.CurrEnv)
+		}
+		if n := len(stack); n != 0 && len(stack[n-1].Func) == 0 && !stack[n-1].Pos.IsValid() {
+			stack[n-1].Pos = toplevel
+		}
+		rec = &InterpRuntimeError{Err: err, Stack: stack}
+	}
+	panic(rec)
+}
+
+// return rec as error if it is a Go runtime error, or a panic of package reflect. Otherwise return nil
+func runtimeErrorOf(rec interface{}) error {
+	switch rec := rec.(type) {
+	case *InterpRuntimeError:
+		// already converted
+		return nil
+	case runtime.Error:
+		return rec
+	case *r.ValueError:
+		return rec
+	case string:
+		if strings.HasPrefix(rec, "reflect: ") || strings.HasPrefix(rec, "reflect.") {
+			return errors.New(rec)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * safeexpr.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+// Package safeexpr evaluates untrusted Go expressions, as configuration and policy rules
+// written by the users of a host application.
+//
+// It accepts a restricted dialect of Go: a single expression without statements,
+// function literals, composite literals, type assertions, pointer dereferences or channel operations,
+// which can only reference the variables and call the functions listed in its Env,
+// plus the constants true, false and nil, the builtin len and conversions to basic types.
+// Without loops and recursion, the cost of evaluating an expression is bounded by its size,
+// which is limited by Env.MaxCost, plus the cost of the functions it calls.
+//
+// Expressions are compiled by the fast interpreter, thus they run at the same speed as interpreted code:
+//
+//	expr, err := safeexpr.Compile(`user.Age >= 18 && hasRole(user, "admin")`, safeexpr.Env{
+//		Vars:  map[string]interface{}{"user": User{}},
+//		Funcs: map[string]interface{}{"hasRole": hasRole},
+//	})
+//	allowed, err := expr.Eval(map[string]interface{}{"user": currentUser})
+package safeexpr
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	r "reflect"
+	"strconv"
+	"sync"
+
+	"github.com/cosmos72/gomacro/fast"
+)
+
+// DefaultMaxCost is the maximum cost of expressions compiled with Env.MaxCost == 0
+const DefaultMaxCost = 1000
+
+// Env lists what expressions can access
+type Env struct {
+	// variables that expressions can read, with their initial value.
+	// The value also sets the variable type: nil means interface{}
+	Vars map[string]interface{}
+	// the only functions that expressions can call. They must be bounded in time
+	// and must not give access to anything that expressions should not reach
+	Funcs map[string]interface{}
+	// maximum cost of an expression, currently the number of nodes in its syntax tree.
+	// Zero means DefaultMaxCost
+	MaxCost int
+}
+
+// Expr is a compiled expression. It is safe for concurrent use: evaluations are serialized
+type Expr struct {
+	src   string
+	cost  int
+	typ   r.Type
+	vars  map[string]r.Value // settable variables of the interpreter
+	ir    *fast.Interp
+	expr  *fast.Expr
+	mutex sync.Mutex
+}
+
+// Error is returned for expressions that use a forbidden syntax or identifier, or exceed Env.MaxCost
+type Error struct {
+	Pos token.Pos // position in the expression, counting from 1. Zero if unknown
+	Msg string
+}
+
+func (err *Error) Error() string {
+	if err.Pos > 0 {
+		return fmt.Sprintf("safeexpr: %d: %s", err.Pos, err.Msg)
+	}
+	return "safeexpr: " + err.Msg
+}
+
+// identifiers that are always allowed: constants, the builtin len and the basic types for conversions
+var predeclared = map[string]bool{
+	"true": true, "false": true, "nil": true, "len": true,
+	"bool": true, "string": true, "byte": true, "rune": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+}
+
+// Compile parses src, checks that it is a safe expression using only the variables and functions in env,
+// and compiles it
+func Compile(src string, env Env) (expr *Expr, err error) {
+	node, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("safeexpr: %v", err)
+	}
+	for name := range env.Funcs {
+		if _, ok := env.Vars[name]; ok {
+			return nil, &Error{Msg: fmt.Sprintf("%q is both a variable and a function", name)}
+		}
+	}
+	ch := checker{env: &env, maxCost: env.MaxCost}
+	if ch.maxCost <= 0 {
+		ch.maxCost = DefaultMaxCost
+	}
+	if err := ch.check(node); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			expr, err = nil, toError(rec)
+		}
+	}()
+	ir := fast.New()
+	g := &ir.Comp.Globals
+	g.Stdout, g.Stderr = discard{}, discard{}
+	ir.Bind(env.Vars)
+	for name, fun := range env.Funcs {
+		ir.DeclFunc(name, fun)
+	}
+	e := ir.CompileNode(node)
+	if e == nil || e.NumOut() != 1 {
+		return nil, &Error{Msg: "expression must produce exactly one value"}
+	}
+	if e.Untyped() {
+		e.ConstTo(e.DefaultType())
+	}
+	vars := make(map[string]r.Value, len(env.Vars))
+	for name := range env.Vars {
+		vars[name] = ir.ValueOf(name).ReflectValue()
+	}
+	return &Expr{src: src, cost: ch.cost, typ: e.Type.ReflectType(), vars: vars, ir: ir, expr: e}, nil
+}
+
+// String returns the source code of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Cost returns the cost of the expression, see Env.MaxCost
+func (e *Expr) Cost() int {
+	return e.cost
+}
+
+// Type returns the type of the value produced by the expression
+func (e *Expr) Type() r.Type {
+	return e.typ
+}
+
+// Eval sets the variables listed in vars, resets the other ones to their zero value,
+// and evaluates the expression.
+// Runtime errors, as an index out of range or a division by zero, are returned as errors
+func (e *Expr) Eval(vars map[string]interface{}) (result interface{}, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for name := range vars {
+		if _, ok := e.vars[name]; !ok {
+			return nil, &Error{Msg: fmt.Sprintf("unknown variable %q", name)}
+		}
+	}
+	for name, v := range e.vars {
+		value := r.ValueOf(vars[name])
+		if !value.IsValid() {
+			value = r.Zero(v.Type())
+		} else if !value.Type().AssignableTo(v.Type()) {
+			return nil, &Error{Msg: fmt.Sprintf("cannot use %v as variable %q of type %v", value.Type(), name, v.Type())}
+		}
+		v.Set(value)
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			result, err = nil, toError(rec)
+		}
+	}()
+	value, _ := e.ir.RunExpr1(e.expr)
+	if !value.IsValid() {
+		return nil, nil
+	}
+	return value.Interface(), nil
+}
+
+func toError(rec interface{}) error {
+	if err, ok := rec.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", rec)
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// checker verifies that an expression is safe
+type checker struct {
+	env     *Env
+	cost    int
+	maxCost int
+}
+
+func (ch *checker) errorf(node ast.Node, format string, args ...interface{}) error {
+	return &Error{Pos: node.Pos(), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (ch *checker) check(node ast.Expr) error {
+	if node == nil {
+		return nil
+	}
+	if ch.cost++; ch.cost > ch.maxCost {
+		return ch.errorf(node, "expression exceeds maximum cost %d", ch.maxCost)
+	}
+	switch node := node.(type) {
+	case *ast.BasicLit:
+		if node.Kind == token.INT || node.Kind == token.FLOAT {
+			// reject huge constants, as 1e1000000000: they are expensive to compile
+			if _, err := strconv.ParseFloat(node.Value, 64); err != nil {
+				return ch.errorf(node, "numeric constant out of range: %s", node.Value)
+			}
+		}
+		return nil
+	case *ast.Ident:
+		return ch.checkIdent(node)
+	case *ast.ParenExpr:
+		return ch.check(node.X)
+	case *ast.SelectorExpr:
+		// access to fields and methods: calling methods is rejected by *ast.CallExpr below
+		return ch.check(node.X)
+	case *ast.UnaryExpr:
+		if node.Op == token.ARROW || node.Op == token.AND {
+			return ch.errorf(node, "operator %s is not allowed", node.Op)
+		}
+		return ch.check(node.X)
+	case *ast.BinaryExpr:
+		if node.Op == token.SHL {
+			// constant shifts can create huge untyped constants
+			if lit, ok := node.Y.(*ast.BasicLit); ok {
+				if n, err := strconv.ParseUint(lit.Value, 0, 64); err != nil || n > 64 {
+					return ch.errorf(lit, "shift count too large: %s", lit.Value)
+				}
+			} else if isConstant(node.Y) {
+				return ch.errorf(node.Y, "constant shift count must be an integer literal")
+			}
+		}
+		if err := ch.check(node.X); err != nil {
+			return err
+		}
+		return ch.check(node.Y)
+	case *ast.IndexExpr:
+		if err := ch.check(node.X); err != nil {
+			return err
+		}
+		return ch.check(node.Index)
+	case *ast.SliceExpr:
+		for _, x := range []ast.Expr{node.X, node.Low, node.High, node.Max} {
+			if err := ch.check(x); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.CallExpr:
+		fun, ok := node.Fun.(*ast.Ident)
+		if !ok {
+			return ch.errorf(node.Fun, "only the functions listed in Env.Funcs can be called")
+		}
+		if _, ok := ch.env.Vars[fun.Name]; ok {
+			return ch.errorf(fun, "cannot call variable %s", fun.Name)
+		}
+		if err := ch.checkIdent(fun); err != nil {
+			return err
+		}
+		for _, arg := range node.Args {
+			if err := ch.check(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.FuncLit:
+		return ch.errorf(node, "function literals are not allowed")
+	case *ast.CompositeLit:
+		return ch.errorf(node, "composite literals are not allowed")
+	case *ast.TypeAssertExpr:
+		return ch.errorf(node, "type assertions are not allowed")
+	case *ast.StarExpr:
+		return ch.errorf(node, "pointer dereferences are not allowed")
+	default:
+		return ch.errorf(node, "%T is not allowed", node)
+	}
+}
+
+func (ch *checker) checkIdent(node *ast.Ident) error {
+	name := node.Name
+	if predeclared[name] {
+		return nil
+	} else if _, ok := ch.env.Vars[name]; ok {
+		return nil
+	} else if _, ok := ch.env.Funcs[name]; ok {
+		return nil
+	}
+	return ch.errorf(node, "undefined or forbidden identifier %s", name)
+}
+
+// return true if node contains no identifiers, i.e. it is computed at compile time
+func isConstant(node ast.Expr) bool {
+	constant := true
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.Ident); ok {
+			constant = false
+		}
+		return constant
+	})
+	return constant
+}
@@ -22,6 +22,7 @@ import (
 	r "reflect"
 	"sort"
 
+	"github.com/cosmos72/gomacro/base"
 	xr "github.com/cosmos72/gomacro/xreflect"
 )
 
@@ -59,8 +60,11 @@ func (c *Comp) Select(node *ast.SelectStmt, labels []string) {
 		ThisLabels: labels,
 	}
 
+	interruptible := c.Options&base.OptInterruptibleChan != 0
+
 	c.append(func(env *Env) (Stmt, *Env) {
-		cases := make([]xr.SelectCase, len(entries))
+		// one more slot for Run.interruptCh, see Run.chanSelect()
+		cases := make([]xr.SelectCase, len(entries), len(entries)+1)
 		for i := range entries {
 			c := &cases[i]
 			e := &entries[i]
@@ -72,7 +76,13 @@ func (c *Comp) Select(node *ast.SelectStmt, labels []string) {
 				}
 			}
 		}
-		chosen, recv, _ := xr.Select(cases)
+		var chosen int
+		var recv xr.Value
+		if interruptible {
+			chosen, recv, _ = env.Run.chanSelect(cases)
+		} else {
+			chosen, recv, _ = xr.Select(cases)
+		}
 		env.Vals[idxrecv] = recv
 		ip := ips[chosen]
 		env.IP = ip
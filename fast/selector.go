@@ -27,6 +27,9 @@ import (
 
 // SelectorExpr compiles foo.bar, i.e. read access to methods, struct fields and imported packages
 func (c *Comp) SelectorExpr(node *ast.SelectorExpr) *Expr {
+	if ident, ok := node.X.(*ast.Ident); ok {
+		c.autoImport(ident.Name, node.Sel.Name)
+	}
 	e, t := c.Expr1OrType(node.X)
 	if t != nil {
 		return c.selectorType(node, t)
@@ -133,8 +136,8 @@ func (c *Comp) TryLookupFieldOrMethod(t xr.Type, name string) (xr.StructField, b
 
 // list direct and embedded field names that start with prefix,
 // and  explicit and wrapper methods that start with prefix
-func (c *Comp) listFieldsAndMethods(t xr.Type, prefix string) []string {
-	var names []string
+func (c *Comp) listFieldsAndMethods(t xr.Type, prefix string) []Candidate {
+	var names []Candidate
 	size := len(prefix)
 
 	collectMethods := func(typ xr.Type) {
@@ -146,8 +149,8 @@ func (c *Comp) listFieldsAndMethods(t xr.Type, prefix string) []string {
 			}
 		}
 		for i, n := 0, typ.NumMethod(); i < n; i++ {
-			if name := typ.Method(i).Name; len(name) >= size && name[:size] == prefix {
-				names = append(names, name)
+			if mtd := typ.Method(i); len(mtd.Name) >= size && mtd.Name[:size] == prefix {
+				names = append(names, Candidate{Name: mtd.Name, Kind: CandidateMethod, Type: c.methodTypeString(mtd.Type)})
 			}
 		}
 	}
@@ -163,7 +166,7 @@ func (c *Comp) listFieldsAndMethods(t xr.Type, prefix string) []string {
 		size := len(prefix)
 		c.Universe.VisitFields(t, func(field xr.StructField) {
 			if name := field.Name; len(name) >= size && name[:size] == prefix {
-				names = append(names, name)
+				names = append(names, Candidate{Name: name, Kind: CandidateField, Type: typeString(field.Type)})
 			}
 			collectMethods(field.Type)
 		})
@@ -236,7 +239,9 @@ func (c *Comp) compileField(e *Expr, field xr.StructField) *Expr {
 	var fun I
 
 	// c.Debugf("compileField: field=%#v", field)
-	if len(index) == 1 {
+	if shim := c.fieldShim(e.Type, index, t); shim != nil {
+		return c.compileFieldShim(objfun, index, t, shim)
+	} else if len(index) == 1 {
 		index0 := index[0]
 		switch t.Kind() {
 		case xr.Bool:
@@ -589,7 +594,9 @@ func (c *Comp) compileObjGetMethod(t xr.Type, mtd xr.Method) (ret func(xr.Value)
 					if addressof {
 						obj = obj.Addr()
 					} else if deref {
-						obj = obj.Elem()
+						obj = copyReceiver(obj.Elem())
+					} else {
+						obj = copyReceiver(obj)
 					}
 					// retrieve the function as soon as possible (early bind)
 					fun := xr.MakeValue((*funs)[index])
@@ -610,7 +617,9 @@ func (c *Comp) compileObjGetMethod(t xr.Type, mtd xr.Method) (ret func(xr.Value)
 					if addressof {
 						obj = obj.Addr()
 					} else if deref {
-						obj = obj.Elem()
+						obj = copyReceiver(obj.Elem())
+					} else {
+						obj = copyReceiver(obj)
 					}
 					// retrieve the function as soon as possible (early bind)
 					fun := xr.MakeValue((*funs)[index])
@@ -629,7 +638,9 @@ func (c *Comp) compileObjGetMethod(t xr.Type, mtd xr.Method) (ret func(xr.Value)
 					if addressof {
 						obj = obj.Addr()
 					} else if deref {
-						obj = obj.Elem()
+						obj = copyReceiver(obj.Elem())
+					} else {
+						obj = copyReceiver(obj)
 					}
 					// retrieve the function as soon as possible (early bind)
 					fun := xr.MakeValue((*funs)[index])
@@ -648,6 +659,17 @@ func (c *Comp) compileObjGetMethod(t xr.Type, mtd xr.Method) (ret func(xr.Value)
 	return ret
 }
 
+// method values bind a copy of value receivers:
+// return a copy of obj if it is addressable, i.e. if it may alias a variable or field
+func copyReceiver(obj xr.Value) xr.Value {
+	if !obj.CanAddr() {
+		return obj
+	}
+	dup := xr.NewR(obj.Type()).Elem()
+	dup.Set(obj)
+	return dup
+}
+
 // return true if t is not an interface and mtd.Type().ReflectType() == rmtd.Type,
 // or if t is an interface and rmtd.Type is the same as mtd.Type().ReflectType() _minus_ the receiver
 func (c *Comp) compatibleMethodType(t xr.Type, mtd xr.Method, rmtd r.Method) bool {
@@ -810,17 +832,23 @@ func (c *Comp) compileMethodAsFunc(t xr.Type, mtd xr.Method) *Expr {
 
 	// convert a method (i.e. with first param used as receiver) to regular function
 	// and, if needed, create wrapper method for embedded field
-	if recvPointer {
-		// receiver is pointer-to-tsave
-		if tsave.Kind() != r.Ptr {
-			tsave = c.Universe.PtrTo(tsave)
-		}
-	} else {
-		// receiver is tsave
-		if tsave.Kind() == r.Ptr {
-			tsave = tsave.Elem()
+	if len(fieldindex) == 0 {
+		// the function receives the method receiver as is
+		addressof, deref = false, false
+		if recvPointer {
+			// receiver is pointer-to-tsave
+			if tsave.Kind() != r.Ptr {
+				tsave = c.Universe.PtrTo(tsave)
+			}
+		} else {
+			// receiver is tsave
+			if tsave.Kind() == r.Ptr {
+				tsave = tsave.Elem()
+			}
 		}
 	}
+	// otherwise the function receives tsave, and the wrapper for embedded field
+	// takes the field address or dereferences it as needed by the method receiver
 	tfunc = c.changeFirstParam(tsave, tfunc)
 
 	if len(fieldindex) == 0 {
@@ -1043,5 +1071,9 @@ func (c *Comp) compileFieldPlace(obje *Expr, field xr.StructField) *Place {
 			return fieldByIndex(obj, index).Addr()
 		}
 	}
-	return &Place{Var: Var{Type: t, Name: field.Name}, Fun: fun, Addr: addr}
+	place := &Place{Var: Var{Type: t, Name: field.Name}, Fun: fun, Addr: addr}
+	if shim := c.fieldShim(obje.Type, index, t); shim != nil {
+		place.field = &placeField{shim: shim, objfun: objfun, index: index}
+	}
+	return place
 }
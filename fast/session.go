@@ -0,0 +1,507 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * session.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"math"
+	r "reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/base/paths"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// SessionVersion is the version of the session format written by Interp.SaveSession.
+// Interp.RestoreSession also accepts sessions written with older versions
+const SessionVersion = 1
+
+const sessionFormat = "gomacro-session"
+
+// sessionMigrations[i] upgrades a session from version i+1 to version i+2.
+// Append a function here whenever SessionVersion is incremented
+var sessionMigrations = []func(*session) error{}
+
+// session is the serialized form of an interpreter session.
+// Only declarations and values that can be reconstructed from source code are saved:
+// functions and closures stored in variables, channels, non-nil pointers and interfaces
+// are listed in Unsupported instead
+type session struct {
+	Format      string          `json:"format"`
+	Version     int             `json:"version"`
+	Imports     []sessionImport `json:"imports,omitempty"`
+	Decls       []sessionDecl   `json:"decls,omitempty"` // types and constants
+	Vars        []sessionVar    `json:"vars,omitempty"`
+	Funcs       []sessionDecl   `json:"funcs,omitempty"` // functions and methods
+	Unsupported []SessionItem   `json:"unsupported,omitempty"`
+}
+
+type sessionImport struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type sessionDecl struct {
+	Kind   string   `json:"kind"`
+	Names  []string `json:"names"`
+	Source string   `json:"source"`
+}
+
+type sessionVar struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// SessionItem describes an import, declaration or variable
+// that could not be saved or reconstructed
+type SessionItem struct {
+	Kind   string `json:"kind"` // one of "import", "const", "type", "var", "func", "macro"
+	Name   string `json:"name"`
+	Type   string `json:"type,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (item SessionItem) String() string {
+	if len(item.Type) != 0 {
+		return fmt.Sprintf("%s %s <%s>: %s", item.Kind, item.Name, item.Type, item.Reason)
+	}
+	return fmt.Sprintf("%s %s: %s", item.Kind, item.Name, item.Reason)
+}
+
+// SessionError is returned by Interp.SaveSession and Interp.RestoreSession
+// when some items of a session could not be saved or reconstructed.
+// All the other items are saved or restored normally
+type SessionError struct {
+	Restore bool
+	Items   []SessionItem
+}
+
+func (e *SessionError) Error() string {
+	var buf strings.Builder
+	if e.Restore {
+		fmt.Fprintf(&buf, "RestoreSession: %d items could not be reconstructed:", len(e.Items))
+	} else {
+		fmt.Fprintf(&buf, "SaveSession: %d items could not be saved:", len(e.Items))
+	}
+	for _, item := range e.Items {
+		buf.WriteString("\n\t")
+		buf.WriteString(item.String())
+	}
+	return buf.String()
+}
+
+// SaveSession writes to w the imports, declarations and toplevel variables of the current package,
+// in a versioned format that Interp.RestoreSession can read back, also in later gomacro releases.
+//
+// Declarations are saved only if they were collected, i.e. if option OptCollectDeclarations
+// was set when they were evaluated. Variables are saved as Go literals, hence variables containing
+// functions or closures (they may reference host state), channels, non-nil pointers or non-nil interfaces
+// are not saved: they are listed in the session and returned as *SessionError
+func (ir *Interp) SaveSession(w io.Writer) error {
+	s := ir.session()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	if len(s.Unsupported) != 0 {
+		return &SessionError{Items: s.Unsupported}
+	}
+	return nil
+}
+
+// RestoreSession reads a session written by Interp.SaveSession, possibly by an older gomacro release,
+// and evaluates its imports, declarations and variables in the current package.
+//
+// If the session is not valid or was written by a newer gomacro release, nothing is evaluated.
+// Otherwise the items that could not be saved or reconstructed are returned as *SessionError,
+// and all the others are restored
+func (ir *Interp) RestoreSession(rd io.Reader) error {
+	var s session
+	if err := json.NewDecoder(rd).Decode(&s); err != nil {
+		return fmt.Errorf("RestoreSession: invalid session: %v", err)
+	}
+	if s.Format != sessionFormat {
+		return fmt.Errorf("RestoreSession: not a gomacro session, found format %q", s.Format)
+	} else if s.Version <= 0 {
+		return fmt.Errorf("RestoreSession: invalid session version %d", s.Version)
+	} else if s.Version > SessionVersion {
+		return fmt.Errorf("RestoreSession: session version %d was saved by a newer gomacro release, this one supports up to version %d",
+			s.Version, SessionVersion)
+	}
+	for ; s.Version < SessionVersion; s.Version++ {
+		if err := sessionMigrations[s.Version-1](&s); err != nil {
+			return fmt.Errorf("RestoreSession: cannot upgrade session from version %d to %d: %v", s.Version, s.Version+1, err)
+		}
+	}
+	items := append([]SessionItem(nil), s.Unsupported...)
+	for _, imp := range s.Imports {
+		if err := ir.evalSession(fmt.Sprintf("import %s %q", imp.Name, imp.Path)); err != nil {
+			items = append(items, SessionItem{Kind: "import", Name: imp.Name, Type: imp.Path, Reason: err.Error()})
+		}
+	}
+	for _, decl := range s.Decls {
+		if err := ir.evalSession(decl.Source); err != nil {
+			items = append(items, SessionItem{Kind: decl.Kind, Name: strings.Join(decl.Names, ", "), Reason: err.Error()})
+		}
+	}
+	for _, v := range s.Vars {
+		if err := ir.evalSession(fmt.Sprintf("var %s %s = %s", v.Name, v.Type, v.Value)); err != nil {
+			items = append(items, SessionItem{Kind: "var", Name: v.Name, Type: v.Type, Reason: err.Error()})
+		}
+	}
+	for _, decl := range s.Funcs {
+		if err := ir.evalSession(decl.Source); err != nil {
+			items = append(items, SessionItem{Kind: decl.Kind, Name: strings.Join(decl.Names, ", "), Reason: err.Error()})
+		}
+	}
+	if len(items) != 0 {
+		return &SessionError{Restore: true, Items: items}
+	}
+	return nil
+}
+
+// evaluate src, converting panics to errors
+func (ir *Interp) evalSession(src string) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = panicToError(rec)
+		}
+	}()
+	ir.Eval(src)
+	return nil
+}
+
+// collect the serializable state of the current package
+func (ir *Interp) session() *session {
+	c := ir.Comp
+	s := &session{Format: sessionFormat, Version: SessionVersion}
+	declared := make(map[string]bool)
+	for _, decl := range c.Globals.Declarations {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok == token.TYPE || decl.Tok == token.CONST {
+				names := genDeclNames(decl)
+				for _, name := range names {
+					declared[name] = true
+				}
+				s.Decls = append(s.Decls, sessionDecl{Kind: decl.Tok.String(), Names: names, Source: c.Sprintf("%v", decl)})
+			}
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if decl.Recv == nil {
+				declared[name] = true
+			} else if len(decl.Recv.List) == 1 {
+				name = c.Sprintf("%v", decl.Recv.List[0].Type) + "." + name
+			}
+			s.Funcs = append(s.Funcs, sessionDecl{Kind: "func", Names: []string{name}, Source: c.Sprintf("%v", decl)})
+		}
+	}
+	names := make([]string, 0, len(c.Binds))
+	for name := range c.Binds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// import name for each package path
+	imports := make(map[string]string)
+	for _, name := range names {
+		bind := c.Binds[name]
+		if bind.Const() && bind.Type != nil && bind.Type.ReflectType() == rtypeOfPtrImport {
+			if imp, ok := bind.Value.(*Import); ok {
+				imports[imp.Path] = name
+				s.Imports = append(s.Imports, sessionImport{Name: name, Path: imp.Path})
+			}
+		}
+	}
+	stringer := typestringer(c.Path)
+	env := ir.PrepareEnv()
+	unsupported := func(kind, name string, t xr.Type, reason string) {
+		item := SessionItem{Kind: kind, Name: name, Reason: reason}
+		if t != nil {
+			item.Type = stringer(t)
+		}
+		s.Unsupported = append(s.Unsupported, item)
+	}
+	const notCollected = "declaration was not collected, set option Declarations.Collect before declaring it"
+
+	for _, name := range names {
+		bind := c.Binds[name]
+		if len(name) == 0 || name == "_" || bind == nil {
+			continue
+		}
+		switch bind.Desc.Class() {
+		case ConstBind:
+			if bind.Type == nil || declared[name] {
+				continue
+			}
+			switch bind.Type.ReflectType() {
+			case rtypeOfPtrImport:
+			case rtypeOfMacro:
+				unsupported("macro", name, nil, "macros are not saved")
+			default:
+				unsupported("const", name, bind.Type, notCollected)
+			}
+		case FuncBind, GenericFuncBind:
+			if !declared[name] {
+				unsupported("func", name, bind.Type, notCollected)
+			}
+		case GenericTypeBind:
+			if !declared[name] {
+				unsupported("type", name, nil, notCollected)
+			}
+		case VarBind, IntBind:
+			v := bind.RuntimeValue(c.CompGlobals, env).ReflectValue()
+			sv := &sessionValuer{path: c.Path, imports: imports}
+			value, err := sv.valueSource(v, bind.Type)
+			var typ string
+			if err == nil {
+				typ, err = sv.typeSource(bind.Type)
+			}
+			if err != nil {
+				unsupported("var", name, bind.Type, err.Error())
+			} else {
+				s.Vars = append(s.Vars, sessionVar{Name: name, Type: typ, Value: value})
+			}
+		}
+	}
+	names = names[:0]
+	for name := range c.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !declared[name] {
+			unsupported("type", name, c.Types[name], notCollected)
+		}
+	}
+	return s
+}
+
+// return the names declared by a type or const declaration
+func genDeclNames(decl *ast.GenDecl) []string {
+	var names []string
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, spec.Name.Name)
+		case *ast.ValueSpec:
+			for _, ident := range spec.Names {
+				names = append(names, ident.Name)
+			}
+		}
+	}
+	return names
+}
+
+// sessionValuer converts types and values to Go source code
+type sessionValuer struct {
+	path    string            // path of current package
+	imports map[string]string // package path -> import name
+}
+
+// return the source code of type t
+func (sv *sessionValuer) typeSource(t xr.Type) (string, error) {
+	if name := t.Name(); len(name) != 0 {
+		pkgpath := t.PkgPath()
+		if len(pkgpath) == 0 || pkgpath == sv.path {
+			return name, nil
+		} else if pkgname, ok := sv.imports[pkgpath]; ok {
+			return pkgname + "." + name, nil
+		}
+		return "", fmt.Errorf("type %s.%s belongs to package %q, which is not imported", paths.FileName(pkgpath), name, pkgpath)
+	}
+	switch t.Kind() {
+	case r.Array:
+		elem, err := sv.typeSource(t.Elem())
+		return fmt.Sprintf("[%d]%s", t.Len(), elem), err
+	case r.Slice:
+		elem, err := sv.typeSource(t.Elem())
+		return "[]" + elem, err
+	case r.Ptr:
+		elem, err := sv.typeSource(t.Elem())
+		return "*" + elem, err
+	case r.Map:
+		key, err := sv.typeSource(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := sv.typeSource(t.Elem())
+		return fmt.Sprintf("map[%s]%s", key, elem), err
+	case r.Struct:
+		n := t.NumField()
+		fields := make([]string, n)
+		for i := 0; i < n; i++ {
+			field := t.Field(i)
+			ftype, err := sv.typeSource(field.Type)
+			if err != nil {
+				return "", err
+			}
+			if field.Anonymous {
+				fields[i] = ftype
+			} else {
+				fields[i] = field.Name + " " + ftype
+			}
+			if len(field.Tag) != 0 {
+				fields[i] += " " + strconv.Quote(string(field.Tag))
+			}
+		}
+		return "struct { " + strings.Join(fields, "; ") + " }", nil
+	case r.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}", nil
+		}
+	}
+	return "", fmt.Errorf("type %v cannot be saved", t)
+}
+
+// return the source code of a literal with type t and value v
+func (sv *sessionValuer) valueSource(v r.Value, t xr.Type) (string, error) {
+	switch t.Kind() {
+	case r.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case r.Float32, r.Float64:
+		return floatSource(v.Float(), t.Size()*8)
+	case r.Complex64, r.Complex128:
+		c := v.Complex()
+		re, err := floatSource(real(c), t.Size()*4)
+		if err != nil {
+			return "", err
+		}
+		im, err := floatSource(imag(c), t.Size()*4)
+		return fmt.Sprintf("complex(%s, %s)", re, im), err
+	case r.String:
+		return strconv.Quote(v.String()), nil
+	case r.Array:
+		return sv.elemsSource(v, t)
+	case r.Slice:
+		if v.IsNil() {
+			return "nil", nil
+		}
+		return sv.elemsSource(v, t)
+	case r.Map:
+		if v.IsNil() {
+			return "nil", nil
+		}
+		return sv.mapSource(v, t)
+	case r.Struct:
+		return sv.structSource(v, t)
+	case r.Ptr:
+		if v.IsNil() {
+			return "nil", nil
+		}
+		return "", fmt.Errorf("non-nil pointers cannot be saved, their aliasing would be lost")
+	case r.Interface:
+		if v.IsNil() {
+			return "nil", nil
+		}
+		return "", fmt.Errorf("non-nil interfaces cannot be saved, their dynamic type would be lost")
+	case r.Func:
+		return "", fmt.Errorf("functions and closures cannot be saved, they may reference host state")
+	case r.Chan:
+		return "", fmt.Errorf("channels cannot be saved")
+	}
+	return "", fmt.Errorf("values of kind %v cannot be saved", t.Kind())
+}
+
+// return the source code of a float literal with the given bit size
+func floatSource(f float64, bits uintptr) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("floating point value %v cannot be written as a literal", f)
+	}
+	return strconv.FormatFloat(f, 'g', -1, int(bits)), nil
+}
+
+// return the source code of an array or slice literal
+func (sv *sessionValuer) elemsSource(v r.Value, t xr.Type) (string, error) {
+	typ, err := sv.typeSource(t)
+	if err != nil {
+		return "", err
+	}
+	n := v.Len()
+	elems := make([]string, n)
+	for i := 0; i < n; i++ {
+		if elems[i], err = sv.valueSource(v.Index(i), t.Elem()); err != nil {
+			return "", err
+		}
+	}
+	return typ + "{" + strings.Join(elems, ", ") + "}", nil
+}
+
+// return the source code of a map literal, with keys sorted for reproducibility
+func (sv *sessionValuer) mapSource(v r.Value, t xr.Type) (string, error) {
+	typ, err := sv.typeSource(t)
+	if err != nil {
+		return "", err
+	}
+	entries := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		k, err := sv.valueSource(key, t.Key())
+		if err != nil {
+			return "", err
+		}
+		e, err := sv.valueSource(v.MapIndex(key), t.Elem())
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, k+": "+e)
+	}
+	sort.Strings(entries)
+	return typ + "{" + strings.Join(entries, ", ") + "}", nil
+}
+
+// return the source code of a struct literal
+func (sv *sessionValuer) structSource(v r.Value, t xr.Type) (string, error) {
+	typ, err := sv.typeSource(t)
+	if err != nil {
+		return "", err
+	}
+	n := t.NumField()
+	fields := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		if !ast.IsExported(field.Name) && len(t.PkgPath()) != 0 && t.PkgPath() != sv.path {
+			return "", fmt.Errorf("type %v has unexported fields", t)
+		}
+		fv, err := sv.valueSource(v.FieldByIndex(field.Index), field.Type)
+		if err != nil {
+			return "", err
+		}
+		name := field.Name
+		if field.Anonymous && len(name) == 0 {
+			// embedded T or *T: the field name is T
+			ft := field.Type
+			if ft.Kind() == r.Ptr {
+				ft = ft.Elem()
+			}
+			name = ft.Name()
+		}
+		fields = append(fields, name+": "+fv)
+	}
+	return typ + "{" + strings.Join(fields, ", ") + "}", nil
+}
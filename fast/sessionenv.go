@@ -0,0 +1,157 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * sessionenv.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	r "reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// SessionEnvPath is the import path of the pseudo-package
+// that gives interpreted code access to the session variables, see Interp.Setenv
+const SessionEnvPath = "env"
+
+// sessionEnv contains the session variables of an interpreter,
+// isolated from the environment variables of the process
+type sessionEnv struct {
+	lock     sync.RWMutex
+	vars     map[string]string
+	readonly map[string]bool // variables set by Interp.SetConfig
+}
+
+func newSessionEnv() *sessionEnv {
+	return &sessionEnv{
+		vars:     make(map[string]string),
+		readonly: make(map[string]bool),
+	}
+}
+
+func (s *sessionEnv) lookup(key string) (string, bool) {
+	s.lock.RLock()
+	value, ok := s.vars[key]
+	s.lock.RUnlock()
+	return value, ok
+}
+
+func (s *sessionEnv) get(key string) string {
+	value, _ := s.lookup(key)
+	return value
+}
+
+func (s *sessionEnv) set(key, value string, readonly bool) error {
+	if len(key) == 0 || strings.IndexByte(key, '=') >= 0 {
+		return fmt.Errorf("setenv: invalid session variable name %q", key)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !readonly && s.readonly[key] {
+		return fmt.Errorf("setenv: session variable %s is read-only", key)
+	}
+	s.vars[key] = value
+	if readonly {
+		s.readonly[key] = true
+	}
+	return nil
+}
+
+func (s *sessionEnv) unset(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.readonly[key] {
+		return fmt.Errorf("unsetenv: session variable %s is read-only", key)
+	}
+	delete(s.vars, key)
+	return nil
+}
+
+func (s *sessionEnv) isReadOnly(key string) bool {
+	s.lock.RLock()
+	ret := s.readonly[key]
+	s.lock.RUnlock()
+	return ret
+}
+
+// return the session variables as sorted "key=value" strings
+func (s *sessionEnv) environ() []string {
+	s.lock.RLock()
+	list := make([]string, 0, len(s.vars))
+	for key, value := range s.vars {
+		list = append(list, key+"="+value)
+	}
+	s.lock.RUnlock()
+	sort.Strings(list)
+	return list
+}
+
+// return the pseudo-package "env" that gives interpreted code access to s
+func (s *sessionEnv) pkg() imports.Package {
+	return imports.Package{
+		Name: "env",
+		Binds: map[string]r.Value{
+			"Environ":    r.ValueOf(s.environ),
+			"Get":        r.ValueOf(s.get),
+			"IsReadOnly": r.ValueOf(s.isReadOnly),
+			"Lookup":     r.ValueOf(s.lookup),
+			"Set": r.ValueOf(func(key, value string) error {
+				return s.set(key, value, false)
+			}),
+			"Unset": r.ValueOf(s.unset),
+		},
+	}
+}
+
+// Setenv sets the session variable key to value.
+// Session variables are isolated from the environment variables of the process,
+// and interpreted code can access them with import "env", using the functions
+// env.Get, env.Lookup, env.Set, env.Unset, env.Environ and env.IsReadOnly.
+// Returns an error if key is empty, contains '=' or was set by Interp.SetConfig
+func (ir *Interp) Setenv(key, value string) error {
+	return ir.Comp.sessionEnv.set(key, value, false)
+}
+
+// SetConfig sets the read-only session variable key to value:
+// interpreted code can read it, but not modify or remove it.
+// Useful to pass configuration values from the host application to scripts
+func (ir *Interp) SetConfig(key, value string) error {
+	return ir.Comp.sessionEnv.set(key, value, true)
+}
+
+// Getenv returns the value of session variable key, or the empty string if it is not set
+func (ir *Interp) Getenv(key string) string {
+	return ir.Comp.sessionEnv.get(key)
+}
+
+// LookupEnv returns the value of session variable key, and whether it is set
+func (ir *Interp) LookupEnv(key string) (string, bool) {
+	return ir.Comp.sessionEnv.lookup(key)
+}
+
+// Unsetenv removes the session variable key.
+// Returns an error if it was set by Interp.SetConfig
+func (ir *Interp) Unsetenv(key string) error {
+	return ir.Comp.sessionEnv.unset(key)
+}
+
+// Environ returns the session variables, as sorted "key=value" strings
+func (ir *Interp) Environ() []string {
+	return ir.Comp.sessionEnv.environ()
+}
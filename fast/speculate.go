@@ -0,0 +1,112 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * speculate.go
+ *
+ *  Created on Oct 15, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// Speculate executes f, then keeps the changes it made to the global scope
+// of the current package only if f returns nil.
+// If f returns an error or panics, the declarations it added or replaced are discarded
+// and the package-level variables it modified are restored to their previous values:
+// useful for "dry run" evaluation of user scripts and for transactional REPL blocks.
+//
+// Restoring is shallow: changes to data reachable through pointers, maps, slices
+// or channels stored in variables, methods added to existing types,
+// and side effects such as I/O are not undone.
+func (ir *Interp) Speculate(f func(*Interp) error) error {
+	snap := ir.snapshot()
+	committed := false
+	defer func() {
+		if !committed {
+			ir.rollback(snap)
+		}
+	}()
+	err := f(ir)
+	committed = err == nil
+	return err
+}
+
+// globalSnapshot contains a copy of the global scope of a package
+type globalSnapshot struct {
+	CompBinds
+	bindvals map[*Bind]Bind // saved contents of each *Bind in CompBinds.Binds
+	vals     []xr.Value     // the original Env.Vals
+	copies   []xr.Value     // copies of the variables' values in Env.Vals
+	ints     []uint64
+}
+
+func (ir *Interp) snapshot() *globalSnapshot {
+	c := ir.Comp
+	env := ir.PrepareEnv()
+	snap := &globalSnapshot{CompBinds: c.CompBinds}
+
+	snap.Binds = make(map[string]*Bind, len(c.Binds))
+	snap.bindvals = make(map[*Bind]Bind, len(c.Binds))
+	for name, bind := range c.Binds {
+		snap.Binds[name] = bind
+		snap.bindvals[bind] = *bind
+	}
+	if c.Types != nil {
+		snap.Types = make(map[string]xr.Type, len(c.Types))
+		for name, t := range c.Types {
+			snap.Types[name] = t
+		}
+	}
+	snap.vals = append([]xr.Value(nil), env.Vals...)
+	snap.copies = make([]xr.Value, len(env.Vals))
+	for i, v := range env.Vals {
+		if v.IsValid() && v.CanSet() {
+			dup := xr.NewR(v.Type()).Elem()
+			dup.Set(v)
+			snap.copies[i] = dup
+		}
+	}
+	snap.ints = append([]uint64(nil), env.Ints...)
+	return snap
+}
+
+func (ir *Interp) rollback(snap *globalSnapshot) {
+	c := ir.Comp
+	env := ir.env
+
+	for bind, bindval := range snap.bindvals {
+		*bind = bindval
+	}
+	c.CompBinds = snap.CompBinds
+
+	// restore variables in place: compiled code may have taken their address
+	vals := env.Vals
+	if len(vals) > len(snap.vals) {
+		vals = vals[:len(snap.vals)]
+	}
+	for i, v := range vals {
+		if dup := snap.copies[i]; dup.IsValid() && v.IsValid() && v.CanSet() && v.Type() == dup.Type() {
+			v.Set(dup)
+		} else {
+			vals[i] = snap.vals[i]
+		}
+	}
+	env.Vals = vals
+	n := len(snap.ints)
+	if len(env.Ints) < n {
+		n = len(env.Ints)
+	}
+	copy(env.Ints[:n], snap.ints)
+	env.Ints = env.Ints[:n]
+}
@@ -401,30 +401,33 @@ func (c *Comp) For(node *ast.ForStmt, labels []string) {
 		}
 		c.Append(stmt, node.Cond.Pos())
 	}
-	// compile the body
-	c.Block(node.Body)
-	// compile the post
-	if node.Post == nil {
-		jump.Post = jump.Cond // no post statement. "continue" jumps to the condition
-	} else {
-		jump.Post = c.Code.Len()
-		if containLocalBinds(node.Post) {
-			c.Errorf("invalid for: cannot declare new variables in post statement: %v", node.Post)
+	body := func() {
+		// compile the body
+		c.Block(node.Body)
+		// compile the post
+		if node.Post == nil {
+			jump.Post = jump.Cond // no post statement. "continue" jumps to the condition
+		} else {
+			jump.Post = c.Code.Len()
+			if containLocalBinds(node.Post) {
+				c.Errorf("invalid for: cannot declare new variables in post statement: %v", node.Post)
+			}
+			c.Stmt(node.Post)
 		}
-		c.Stmt(node.Post)
+		c.Append(func(env *Env) (Stmt, *Env) {
+			// jump back to the condition
+			// Debugf("for: body executed, jumping back to condition. IntBinds = %v", env.IntBinds)
+			// time.Sleep(time.Second / 10)
+			ip := jump.Cond
+			env.IP = ip
+			return env.Code[ip], env
+		}, node.End()-1)
 	}
-	c.Append(func(env *Env) (Stmt, *Env) {
-		// jump back to the condition
-		// Debugf("for: body executed, jumping back to condition. IntBinds = %v", env.IntBinds)
-		// time.Sleep(time.Second / 10)
-		ip := jump.Cond
-		env.IP = ip
-		return env.Code[ip], env
-	}, node.End()-1)
 	if fun == nil && !flag {
-		// "for false { }" means that body, post and jump back to condition are never executed...
-		// still compiled above (to check for errors) but drop the generated code
-		c.Code.Truncate(jump.Cond)
+		// "for false { }" means that body, post and jump back to condition are never executed
+		c.checkDeadCode(body)
+	} else {
+		body()
 	}
 	jump.Break = c.Code.Len()
 
@@ -433,6 +436,9 @@ func (c *Comp) For(node *ast.ForStmt, labels []string) {
 
 // Go compiles a "go" statement i.e. a goroutine
 func (c *Comp) Go(node *ast.GoStmt) {
+	if c.ForbidGo {
+		c.Errorf("go statements are not allowed: %v", node)
+	}
 	// we must create a new ThreadGlobals with a new Pool.
 	// Ideally, the new ThreadGlobals could be created inside the call,
 	// but that requires modifying the function being executed.
@@ -516,11 +522,13 @@ func (c *Comp) If(node *ast.IfStmt) {
 	}
 	// compile 'then' branch
 	jump.Then = c.Code.Len()
-	c.Block(node.Body)
 	if fun == nil && !flag {
-		// 'then' branch is never executed...
-		// still compiled above (to check for errors) but drop the generated code
-		c.Code.Truncate(jump.Then)
+		// 'then' branch is never executed
+		c.checkDeadCode(func() {
+			c.Block(node.Body)
+		})
+	} else {
+		c.Block(node.Body)
 	}
 	// compile a 'goto' between 'then' and 'else' branches
 	if fun != nil && node.Else != nil {
@@ -541,15 +549,16 @@ func (c *Comp) If(node *ast.IfStmt) {
 		xelse := node.Else
 		_, ok1 := xelse.(*ast.BlockStmt)
 		_, ok2 := xelse.(*ast.IfStmt)
-		if ok1 || ok2 {
-			c.Stmt(xelse)
-		} else {
-			c.Block(&ast.BlockStmt{List: []ast.Stmt{xelse}})
+		if !ok1 && !ok2 {
+			xelse = &ast.BlockStmt{List: []ast.Stmt{xelse}}
 		}
 		if fun == nil && flag {
-			// 'else' branch is never executed...
-			// still compiled above (to check for errors) but drop the generated code
-			c.Code.Truncate(jump.Else)
+			// 'else' branch is never executed
+			c.checkDeadCode(func() {
+				c.Stmt(xelse)
+			})
+		} else {
+			c.Stmt(xelse)
 		}
 	}
 	jump.End = c.Code.Len()
@@ -557,6 +566,18 @@ func (c *Comp) If(node *ast.IfStmt) {
 	c = c.popEnvIfLocalBinds(initLocals, &initBinds, node.Init)
 }
 
+// checkDeadCode calls compile to compile code that is never executed:
+// such code is still type-checked, as gc does, but its statements are discarded
+// instead of being appended to c.Code, wrapped in yield points or hotspot counters
+func (c *Comp) checkDeadCode(compile func()) {
+	dead := c.Code.deadCode
+	c.Code.deadCode = true
+	defer func() {
+		c.Code.deadCode = dead
+	}()
+	compile()
+}
+
 // IncDec compiles a "place++" or "place--" statement
 func (c *Comp) IncDec(node *ast.IncDecStmt) {
 	place := c.Place(node.X)
@@ -566,6 +587,9 @@ func (c *Comp) IncDec(node *ast.IncDecStmt) {
 	} else {
 		op = token.ADD
 	}
+	if c.bigNumAssign(place, node.X, op, &ast.BasicLit{ValuePos: node.TokPos, Kind: token.INT, Value: "1"}) {
+		return
+	}
 	one := c.exprUntypedLit(untypedOne.Kind, untypedOne.Val)
 	c.SetPlace(place, op, one)
 }
@@ -611,7 +635,10 @@ func (c *Comp) Return(node *ast.ReturnStmt) {
 		return
 	}
 
-	exprs := c.exprs(resultExprs)
+	exprs := make([]*Expr, len(resultExprs))
+	for i, result := range resultExprs {
+		exprs[i] = c.expr1(result, exprHint(result, resultBinds[i].Type))
+	}
 	for i := 0; i < n; i++ {
 		c.Pos = resultExprs[i].Pos()
 		c.SetVar(resultBinds[i].AsVar(upn, PlaceSettable), token.ASSIGN, exprs[i])
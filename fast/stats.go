@@ -0,0 +1,136 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * stats.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"go/token"
+	r "reflect"
+	"runtime"
+	"strings"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// Stats contains statistics about the code compiled by an interpreter
+type Stats struct {
+	Stmts        int // number of compiled statements
+	Exprs        int // number of compiled non-constant expressions
+	TypedExprs   int // expressions compiled to closures returning concrete types, i.e. the fast path
+	ReflectExprs int // expressions compiled to closures returning xr.Value, i.e. the slower reflect fallback
+}
+
+// TypedRatio returns the fraction of compiled expressions that use the fast path
+func (s Stats) TypedRatio() float64 {
+	if s.Exprs == 0 {
+		return 1
+	}
+	return float64(s.TypedExprs) / float64(s.Exprs)
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d statements, %d expressions: %d typed, %d reflect (%.1f%% fast path)",
+		s.Stmts, s.Exprs, s.TypedExprs, s.ReflectExprs, 100*s.TypedRatio())
+}
+
+// Stats returns statistics about the code compiled so far by the interpreter
+func (ir *Interp) Stats() Stats {
+	return ir.Comp.stats
+}
+
+func (s *Stats) countExpr(e *Expr) {
+	if e == nil || e.Const() {
+		return
+	}
+	s.Exprs++
+	switch e.Fun.(type) {
+	case func(*Env) xr.Value, func(*Env) (xr.Value, []xr.Value):
+		s.ReflectExprs++
+	default:
+		s.TypedExprs++
+	}
+}
+
+// compiled statements of a function, kept for Interp.Disasm()
+type funcListing struct {
+	Name     string
+	List     []Stmt
+	DebugPos []token.Pos
+}
+
+// maximum number of compiled functions kept for Interp.Disasm():
+// the listings of older functions are discarded, to bound memory usage in long sessions
+const maxFuncListings = 256
+
+// remember the compiled statements of function 'bind'
+func (c *Comp) saveFuncListing(bind *Bind, code *Code) {
+	if c.funcListings == nil {
+		c.funcListings = make(map[*Bind]*funcListing)
+	}
+	if c.funcListings[bind] == nil {
+		if n := len(c.funcOrder); n >= maxFuncListings {
+			delete(c.funcListings, c.funcOrder[0])
+			copy(c.funcOrder, c.funcOrder[1:])
+			c.funcOrder[n-1] = nil
+			c.funcOrder = c.funcOrder[:n-1]
+		}
+		c.funcOrder = append(c.funcOrder, bind)
+	}
+	c.funcListings[bind] = &funcListing{
+		Name:     bind.Name,
+		List:     append([]Stmt(nil), code.List...),
+		DebugPos: append([]token.Pos(nil), code.DebugPos...),
+	}
+}
+
+// Disasm returns a pseudo-listing of the statements
+// generated by compiling function 'name'
+func (ir *Interp) Disasm(name string) (string, error) {
+	c := ir.Comp
+	_, o := c.tryResolve(name)
+	if o == nil {
+		return "", fmt.Errorf("undefined identifier: %s", name)
+	}
+	listing := c.funcListings[o.Binds[name]]
+	if listing == nil {
+		return "", fmt.Errorf("not a compiled function, or not among the last %d compiled: %s", maxFuncListings, name)
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "// func %s: %d statements\n", listing.Name, len(listing.List))
+	for i, stmt := range listing.List {
+		var pos string
+		if i < len(listing.DebugPos) && listing.DebugPos[i] != token.NoPos && c.Fileset != nil {
+			pos = c.Fileset.Position(listing.DebugPos[i]).String()
+		}
+		fmt.Fprintf(&buf, "%4d  %-16s %s\n", i, pos, stmtName(stmt))
+	}
+	return buf.String(), nil
+}
+
+// return the name of the function that implements a statement,
+// without the package path
+func stmtName(stmt Stmt) string {
+	f := runtime.FuncForPC(r.ValueOf(stmt).Pointer())
+	if f == nil {
+		return "?"
+	}
+	name := f.Name()
+	if slash := strings.LastIndexByte(name, '/'); slash >= 0 {
+		name = name[slash+1:]
+	}
+	return strings.TrimPrefix(name, "fast.")
+}
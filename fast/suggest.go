@@ -0,0 +1,194 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * suggest.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maximum number of suggestions reported by UndefinedIdentifierError
+const maxSuggestions = 3
+
+// UndefinedIdentifierError is raised when compiling an unknown identifier,
+// or an unknown symbol of an imported package
+type UndefinedIdentifierError struct {
+	Position    string   // position of the identifier, may be empty
+	Pkg         string   // name of the imported package, empty for identifiers in scope
+	PkgPath     string   // path of the imported package, empty for identifiers in scope
+	Name        string   // the unknown identifier
+	Suggestions []string // close matches of Name, best first
+	Import      string   // if not empty, an unimported package named Name
+}
+
+func (err *UndefinedIdentifierError) Error() string {
+	var buf strings.Builder
+	if len(err.Position) != 0 && err.Position != "-" {
+		buf.WriteString(err.Position)
+		buf.WriteString(": ")
+	}
+	if len(err.PkgPath) != 0 {
+		fmt.Fprintf(&buf, "package %v %q has no symbol %s", err.Pkg, err.PkgPath, err.Name)
+	} else {
+		fmt.Fprintf(&buf, "undefined identifier: %v", err.Name)
+	}
+	if n := len(err.Suggestions); n != 0 {
+		buf.WriteString(", did you mean ")
+		for i, s := range err.Suggestions {
+			if i != 0 {
+				if i == n-1 {
+					buf.WriteString(" or ")
+				} else {
+					buf.WriteString(", ")
+				}
+			}
+			if len(err.Pkg) != 0 {
+				buf.WriteString(err.Pkg)
+				buf.WriteByte('.')
+			}
+			buf.WriteString(s)
+		}
+		buf.WriteByte('?')
+	}
+	if len(err.Import) != 0 {
+		fmt.Fprintf(&buf, " (did you forget import %q?)", err.Import)
+	}
+	return buf.String()
+}
+
+// undefinedIdentifier panics with an *UndefinedIdentifierError for name,
+// suggesting the close matches among the constants, variables, functions and types in scope
+// and the unimported packages named 'name'
+func (c *Comp) undefinedIdentifier(name string) {
+	var candidates []string
+	for o := c; o != nil; o = o.Outer {
+		for k := range o.Binds {
+			candidates = append(candidates, k)
+		}
+		for k := range o.Types {
+			candidates = append(candidates, k)
+		}
+	}
+	for k := range c.lazyBinds {
+		candidates = append(candidates, k)
+	}
+	var importpath string
+	if c.Importer != nil {
+		if paths := autoImportCandidates(c.Importer.Registry(), name, ""); len(paths) != 0 {
+			importpath = paths[0]
+		}
+	}
+	panic(&UndefinedIdentifierError{
+		Position:    c.Position().String(),
+		Name:        name,
+		Suggestions: suggestNames(name, candidates),
+		Import:      importpath,
+	})
+}
+
+// undefinedSymbol panics with an *UndefinedIdentifierError for imp.name,
+// suggesting the close matches among the symbols and types exported by imp
+func (imp *Import) undefinedSymbol(name string, position string) {
+	candidates := make([]string, 0, len(imp.Binds)+len(imp.Types))
+	for k := range imp.Binds {
+		candidates = append(candidates, k)
+	}
+	for k := range imp.Types {
+		candidates = append(candidates, k)
+	}
+	panic(&UndefinedIdentifierError{
+		Position:    position,
+		Pkg:         imp.Name,
+		PkgPath:     imp.Path,
+		Name:        name,
+		Suggestions: suggestNames(name, candidates),
+	})
+}
+
+// return the candidates close to name, best first:
+// names differing only in case come first, then names within a small edit distance
+func suggestNames(name string, candidates []string) []string {
+	type suggestion struct {
+		name string
+		dist int
+	}
+	// allow one edit every three characters: very short names only match if they differ in case
+	maxdist := len(name) / 3
+	lower := strings.ToLower(name)
+	var list []suggestion
+	seen := make(map[string]bool)
+	for _, cand := range candidates {
+		if cand == name || cand == "_" || seen[cand] {
+			continue
+		}
+		seen[cand] = true
+		var dist int
+		lcand := strings.ToLower(cand)
+		if lcand == lower {
+			dist = 0
+		} else if dist = editDistance(lower, lcand) + 1; dist > maxdist+1 {
+			continue
+		}
+		list = append(list, suggestion{cand, dist})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].dist != list[j].dist {
+			return list[i].dist < list[j].dist
+		}
+		return list[i].name < list[j].name
+	})
+	if len(list) > maxSuggestions {
+		list = list[:maxSuggestions]
+	}
+	var names []string
+	for _, s := range list {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// Levenshtein distance between a and b, counting bytes
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
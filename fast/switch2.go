@@ -458,7 +458,7 @@ func (c *Comp) switchGotoMap(tag *Expr, seen *caseHelper, ip int) {
 			return env.Code[env.IP], env
 		}
 	}
-	if stmt == nil {
+	if stmt == nil || c.Code.deadCode {
 		return
 	}
 
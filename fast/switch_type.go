@@ -247,7 +247,9 @@ func (c *Comp) typeswitchGotoMap(bind *Bind, seen *typecaseHelper, ip int) {
 		}
 		return env.Code[env.IP], env
 	}
-	c.Code.List[ip] = stmt
+	if !c.Code.deadCode {
+		c.Code.List[ip] = stmt
+	}
 }
 
 // typeswitchCase compiles a case in a type-switch.
@@ -255,21 +257,19 @@ func (c *Comp) typeswitchCase(node *ast.CaseClause, varname string, bind *Bind,
 
 	ibody := c.Code.Len() + 1 // body will start here
 	ts := make([]xr.Type, len(node.List))
-	rtypes := make([]r.Type, len(node.List))
+	matchers := make([]func(xr.Value, xr.Type) (xr.Value, bool), len(node.List))
 
 	// compile a comparison of tag against each type
 	for i, enode := range node.List {
 		t := c.compileTypeOrNilR(enode)
-		if t != nil {
-			rtypes[i] = t.ReflectType()
-			if t.Kind() != r.Interface && !t.Implements(bind.Type) {
-				c.Errorf("impossible typeswitch case: <%v> does not implement <%v>", t, bind.Type)
-			}
+		if t != nil && t.Kind() != r.Interface && !t.Implements(bind.Type) {
+			c.Errorf("impossible typeswitch case: <%v> does not implement <%v>%s", t, bind.Type, methodMismatches(t, bind.Type))
 		}
 		ts[i] = t
+		matchers[i] = c.typeswitchMatcher(t)
 		seen.add(c, t, typecaseEntry{Pos: enode.Pos(), IP: ibody})
 	}
-	// compile like "if r.TypeOf(bind) == t1 || r.TypeOf(bind) == t2 ... { }"
+	// compile like "if matchers[0](tag) || matchers[1](tag) ... { }"
 	// and keep track of where to jump if no expression matches
 	//
 	// always occupy a Code slot for type comparison, even if nothing to do.
@@ -277,129 +277,28 @@ func (c *Comp) typeswitchCase(node *ast.CaseClause, varname string, bind *Bind,
 	var iend int
 	var stmt Stmt
 	idx := bind.Desc.Index()
-	switch len(node.List) {
-	case 0:
-		// compile anyway. reachable?
+	if len(matchers) == 1 {
+		// with a single type, the case body sees the tag converted to such type:
+		// store the conversion performed by matcher
+		match := matchers[0]
 		stmt = func(env *Env) (Stmt, *Env) {
-			// Debugf("typeswitchCase: comparing %v against zero types", tagfun(env))
 			ip := iend
+			if v, ok := match(typeswitchTagValue(env, idx)); ok {
+				env.Vals[idx] = v
+				ip = env.IP + 1
+			}
 			env.IP = ip
 			return env.Code[ip], env
 		}
-	case 1:
-		t := ts[0]
-		rtype := rtypes[0]
-		if t == nil {
-			// case nil:
-			stmt = func(env *Env) (Stmt, *Env) {
-				v := env.Vals[idx]
-				// Debugf("typeswitchCase: comparing %v <%v> against nil type", v, Type(v))
-				var ip int
-				if v.IsValid() {
-					ip = iend
-				} else {
-					ip = env.IP + 1
-				}
-				env.IP = ip
-				return env.Code[ip], env
-			}
-		} else if t.Kind() == r.Interface && xr.IsEmulatedInterface(t) {
-			// case emulated_interface:
-			stmt = func(env *Env) (Stmt, *Env) {
-				v := env.Vals[idx]
-				// Debugf("typeswitchCase: comparing %v <%v> against interface type %v", v, Type(v), rtype)
-				ip := iend
-				if v.IsValid() {
-					// rtype may be an interpreted type:
-					// extract the concrete xr.Type and use it
-					xtv := env.Vals[idx+1]
-					if xtv.IsValid() && !xtv.IsNil() {
-						xt := xtv.Interface().(xr.Type)
-						if xt.Implements(t) {
-							ip = env.IP + 1
-							// need the compiler at run-time :(
-							conv := c.converterToEmulatedInterface(xt, t)
-							env.Vals[idx] = conv(v)
-						}
-					}
-				}
-				env.IP = ip
-				return env.Code[ip], env
-			}
-		} else if t.Kind() == r.Interface {
-			// case interface:
-			stmt = func(env *Env) (Stmt, *Env) {
-				v := env.Vals[idx]
-				// Debugf("typeswitchCase: comparing %v <%v> against interface type %v", v, Type(v), rtype)
-				ip := iend
-				if v.IsValid() {
-					if v.Type().Implements(rtype) {
-						ip = env.IP + 1
-					} else {
-						// rtype may be an interpreted type:
-						// extract the concrete xr.Type and use it
-						xtv := env.Vals[idx+1]
-						if xtv.IsValid() && !xtv.IsNil() {
-							xt := xtv.Interface().(xr.Type)
-							if xt.Implements(t) {
-								ip = env.IP + 1
-								// need the compiler at run-time :(
-								conv := c.converterToProxy(xt, t)
-								env.Vals[idx] = conv(v)
-							}
-						}
-					}
-				}
-				env.IP = ip
-				return env.Code[ip], env
-			}
-		} else {
-			// case concrete_type:
-			stmt = func(env *Env) (Stmt, *Env) {
-				v := env.Vals[idx]
-				ip := iend
-				if v.IsValid() && v.Type() == rtype {
-					// rtype may be an interpreted type:
-					// extract the concrete xr.Type and use it
-					xtv := env.Vals[idx+1]
-					if xtv.IsValid() && !xtv.IsNil() {
-						xt := xtv.Interface().(xr.Type)
-						if xt.IdenticalTo(t) {
-							ip = env.IP + 1
-						}
-					} else {
-						// cannot check exactly...
-						ip = env.IP + 1
-					}
-				}
-				env.IP = ip
-				return env.Code[ip], env
-			}
-		}
-	default:
+	} else {
 		stmt = func(env *Env) (Stmt, *Env) {
-			v := env.Vals[idx]
-			var vt r.Type
-			if v.IsValid() {
-				vt = v.Type()
-			}
-			// Debugf("typeswitchCase: comparing %v <%v> against types %v", v, vt, rtypes)
+			v, xt := typeswitchTagValue(env, idx)
 			ip := iend
-			for _, rtype := range rtypes {
-				switch {
-				case vt == rtype:
-				case rtype != nil:
-					if rtype.Kind() != r.Interface || !vt.Implements(rtype) {
-						continue
-					}
-				default: // rtype == nil
-					if v.IsValid() {
-						continue
-					}
+			for _, match := range matchers {
+				if _, ok := match(v, xt); ok {
+					ip = env.IP + 1
+					break
 				}
-				// Debugf("typeswitchCase: v <%v> matches type %v", v, vt, rtype)
-				ip = env.IP + 1
-				break
 			}
 			env.IP = ip
 			return env.Code[ip], env
@@ -416,6 +315,40 @@ func (c *Comp) typeswitchCase(node *ast.CaseClause, varname string, bind *Bind,
 	iend = c.Code.Len()
 }
 
+// typeswitchTagValue returns the value saved by typeswitchTag
+// and its concrete xr.Type, or nil if not known
+func typeswitchTagValue(env *Env, idx int) (xr.Value, xr.Type) {
+	var xt xr.Type
+	if xtv := env.Vals[idx+1]; xtv.IsValid() && !xtv.IsNil() {
+		xt = xtv.Interface().(xr.Type)
+	}
+	return env.Vals[idx], xt
+}
+
+// typeswitchMatcher returns a function that checks at runtime whether
+// the value v with concrete type xt (nil if not known) matches the type-switch case t,
+// which is nil for 'case nil'. It uses the same checks as type assertions,
+// and if t is an interface it also returns v converted to t
+func (c *Comp) typeswitchMatcher(t xr.Type) func(v xr.Value, xt xr.Type) (xr.Value, bool) {
+	if t == nil {
+		return func(v xr.Value, xt xr.Type) (xr.Value, bool) {
+			return v, !v.IsValid()
+		}
+	} else if t.Kind() == r.Interface {
+		// t may be a compiled or emulated interface,
+		// and v may have been extracted from a proxy or emulated interface
+		return func(v xr.Value, xt xr.Type) (xr.Value, bool) {
+			return c.typeAssertToInterface(v, xt, t)
+		}
+	}
+	rtype := t.ReflectType()
+	return func(v xr.Value, xt xr.Type) (xr.Value, bool) {
+		// different interpreted types may have the same reflect.Type:
+		// compare the concrete xr.Type too, if known
+		return v, v.IsValid() && v.Type() == rtype && (xt == nil || xt.IdenticalTo(t))
+	}
+}
+
 // typeswitchDefault compiles the default case in a type-switch.
 func (c *Comp) typeswitchDefault(node *ast.CaseClause, varname string, bind *Bind) {
 	var iend int
@@ -568,13 +501,21 @@ func (c *Comp) typeswitchVar(varname string, t xr.Type, sym *Symbol) {
 	default:
 		rtype := t.ReflectType()
 		zero := xr.ZeroR(rtype)
+		interf := t.Kind() == r.Interface
 		stmt = func(env *Env) (Stmt, *Env) {
 			v := env.Outer.Vals[sidx]
 			place := xr.New(t).Elem()
 			if !v.IsValid() {
 				v = zero
 			} else if v.Type() != rtype {
-				v = convert(v, rtype)
+				if interf {
+					// tag was extracted from a proxy or emulated interface:
+					// wrap it again
+					_, xt := typeswitchTagValue(env.Outer, sidx)
+					v, _ = c.typeAssertToInterface(v, xt, t)
+				} else {
+					v = convert(v, rtype)
+				}
 			}
 			place.Set(v)
 			env.Vals[idx] = place
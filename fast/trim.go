@@ -0,0 +1,100 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * trim.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"runtime/debug"
+
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// Trim releases memory accumulated by long interpreter sessions, then returns it to the operating system:
+//
+//   - drops the field and method lookup caches of types
+//   - drops the pool of reusable *Env of the current goroutine
+//   - shrinks the global variables of the current package to their actual size
+//   - forgets the compiled statements of redefined or removed functions, see Interp.Disasm()
+//   - forgets the metadata of compiled packages that are no longer referenced by any import,
+//     they will be rebuilt if imported again.
+//     Note: code loaded from plugins cannot be released, because Go cannot unload plugins.
+//
+// Values of redefined or removed variables are kept, because code compiled earlier may still reference them.
+func (ir *Interp) Trim() {
+	c := ir.Comp
+	c.Universe.InvalidateCache()
+
+	run := ir.env.Run
+	for i := range run.Pool {
+		run.Pool[i] = nil
+	}
+	run.PoolSize = 0
+
+	ir.env.compact()
+
+	live := make(map[*Bind]bool)
+	imports := make(map[*Import]bool)
+	addBinds := func(binds map[string]*Bind) {
+		for _, bind := range binds {
+			live[bind] = true
+			if imp, ok := bind.Value.(*Import); ok && imp != nil {
+				imports[imp] = true
+			}
+		}
+	}
+	for o := c; o != nil; o = o.Outer {
+		addBinds(o.Binds)
+	}
+	for _, imp := range c.KnownImports {
+		if imp.interpreted {
+			// interpreted package: its declarations are alive
+			addBinds(imp.Binds)
+		}
+	}
+	order := c.funcOrder[:0]
+	for _, bind := range c.funcOrder {
+		if live[bind] {
+			order = append(order, bind)
+		} else {
+			delete(c.funcListings, bind)
+		}
+	}
+	for i := len(order); i < len(c.funcOrder); i++ {
+		c.funcOrder[i] = nil
+	}
+	c.funcOrder = order
+	for path, imp := range c.KnownImports {
+		if !imp.interpreted && !imports[imp] {
+			delete(c.KnownImports, path)
+		}
+	}
+	debug.FreeOSMemory()
+}
+
+// shrink env.Vals and env.Ints to their length
+func (env *Env) compact() {
+	if cap(env.Vals) > len(env.Vals) {
+		vals := make([]xr.Value, len(env.Vals))
+		copy(vals, env.Vals)
+		env.Vals = vals
+	}
+	// once an Env.Ints[idx] address is taken, we can no longer reallocate it
+	if !env.IntAddressTaken && cap(env.Ints) > len(env.Ints) {
+		ints := make([]uint64, len(env.Ints))
+		copy(ints, env.Ints)
+		env.Ints = ints
+	}
+}
@@ -236,6 +236,7 @@ func (c *Comp) compileType2(node ast.Expr, allowEllipsis bool) (t xr.Type, ellip
 		// this could be Package.Type, or other non-type expressions: Type.Method, Value.Method, Struct.Field...
 		// check for Package.Type
 		name := ident.Name
+		c.autoImport(name, node.Sel.Name)
 		var bind *Bind
 		for o := c; o != nil; o = o.Outer {
 			if bind = o.Binds[name]; bind != nil {
@@ -399,7 +400,7 @@ func (c *Comp) TryResolveType(name string) xr.Type {
 func (c *Comp) ResolveType(name string) xr.Type {
 	t := c.TryResolveType(name)
 	if t == nil {
-		c.Errorf("undefined identifier: %v", name)
+		c.undefinedIdentifier(name)
 	}
 	return t
 }
@@ -458,7 +459,7 @@ func (c *Comp) TypeAssert2(node *ast.TypeAssertExpr) *Expr {
 	}
 	kout := tout.Kind()
 	if kout != r.Interface && !tout.Implements(tin) {
-		c.Errorf("impossible type assertion: <%v> does not implement <%v>", tout, tin)
+		c.Errorf("impossible type assertion: <%v> does not implement <%v>%s", tout, tin, methodMismatches(tout, tin))
 	}
 	// extractor to unwrap value from proxy or emulated interface
 	extractor := c.extractor(tin)
@@ -492,23 +493,9 @@ func (c *Comp) TypeAssert2(node *ast.TypeAssertExpr) *Expr {
 			}
 			break
 		}
-		if tin.Implements(tout) {
-			// type assertion to interface.
-			// expression type implements such interface, can only fail if value is nil
-			ret = func(env *Env) (xr.Value, []xr.Value) {
-				v, _ := extractor(fun(env))
-				// nil is not a valid tout, check for it.
-				// IsNil() can be invoked only on nillable types...
-				if reflect.IsNillableKind(v.Kind()) && (!v.IsValid() || v.IsNil()) {
-					return fail[0], fail
-				}
-				v = convert(v, rtout)
-				return v, []xr.Value{v, True}
-			}
-			break
-		}
-		// type assertion to interface
-		// must check at runtime whether concrete type implements asserted interface
+		// type assertion to interface.
+		// must check at runtime whether concrete type implements asserted interface:
+		// even if expression type implements it, the concrete value may need a proxy
 		ret = func(env *Env) (xr.Value, []xr.Value) {
 			v, t := extractor(fun(env))
 			// nil is not a valid tout, check for it.
@@ -516,12 +503,10 @@ func (c *Comp) TypeAssert2(node *ast.TypeAssertExpr) *Expr {
 			if reflect.IsNillableKind(v.Kind()) && (!v.IsValid() || v.IsNil()) {
 				return fail[0], fail
 			}
-			rt := rtypeof(v, t)
-			if (rt != rtout && !rt.Implements(rtout)) ||
-				(t != nil && !t.IdenticalTo(tout) && !t.Implements(tout)) {
+			v, ok := c.typeAssertToInterface(v, t, tout)
+			if !ok {
 				return fail[0], fail
 			}
-			v = convert(v, rtout)
 			return v, []xr.Value{v, True}
 		}
 
@@ -570,7 +555,7 @@ func (c *Comp) TypeAssert1(node *ast.TypeAssertExpr) *Expr {
 		return nil
 	}
 	if tout.Kind() != r.Interface && !tout.Implements(tin) {
-		c.Errorf("impossible type assertion: <%v> does not implement <%v>", tout, tin)
+		c.Errorf("impossible type assertion: <%v> does not implement <%v>%s", tout, tin, methodMismatches(tout, tin))
 	}
 	// extractor to unwrap value from proxy or emulated interface
 	extractor := c.extractor(tin)
@@ -693,21 +678,10 @@ func (c *Comp) TypeAssert1(node *ast.TypeAssertExpr) *Expr {
 				}
 				return convert(v, rtout)
 			}
-		} else if tin.Implements(tout) {
-			// type assertion to interface.
-			// expression type implements such interface, can only fail if value is nil
-			ret = func(env *Env) xr.Value {
-				v, _ := extractor(fun(env))
-				// nil is not a valid tout, check for it.
-				// IsNil() can be invoked only on nillable types...
-				if reflect.IsNillableKind(v.Kind()) && (!v.IsValid() || v.IsNil()) {
-					typeassertpanic(nil, nil, tin, tout)
-				}
-				return convert(v, rtout)
-			}
 		} else {
 			// type assertion to interface.
-			// must check at runtime whether concrete type implements asserted interface
+			// must check at runtime whether concrete type implements asserted interface:
+			// even if expression type implements it, the concrete value may need a proxy
 			ret = func(env *Env) xr.Value {
 				v, t := extractor(fun(env))
 				// nil is not a valid tout, check for it.
@@ -715,12 +689,11 @@ func (c *Comp) TypeAssert1(node *ast.TypeAssertExpr) *Expr {
 				if reflect.IsNillableKind(v.Kind()) && (!v.IsValid() || v.IsNil()) {
 					typeassertpanic(nil, nil, tin, tout)
 				}
-				rt := rtypeof(v, t)
-				if (rt != rtout && !rt.AssignableTo(rtout) && !rt.Implements(rtout)) ||
-					(t != nil && !t.AssignableTo(tout) && !t.Implements(tout)) {
-					typeassertpanic(rt, t, tin, tout)
+				vout, ok := c.typeAssertToInterface(v, t, tout)
+				if !ok {
+					typeassertpanic(rtypeof(v, t), t, tin, tout)
 				}
-				return convert(v, rtout)
+				return vout
 			}
 		}
 	default:
@@ -781,8 +754,12 @@ func typeassert(v xr.Value, t xr.Type, tin xr.Type, tout xr.Type) xr.Value {
 
 func typeassertpanic(rt r.Type, t xr.Type, tin xr.Type, tout xr.Type) {
 	var missingmethod *xr.Method
+	var mismatches []xr.MethodMismatch
 	if t != nil && tout.Kind() == r.Interface {
-		missingmethod = xr.MissingMethod(t, tout)
+		mismatches = xr.MethodMismatches(t, tout)
+		if len(mismatches) != 0 {
+			missingmethod = &mismatches[0].Want
+		}
 	}
 	panic(&TypeAssertionError{
 		Interface:       tin,
@@ -790,6 +767,7 @@ func typeassertpanic(rt r.Type, t xr.Type, tin xr.Type, tout xr.Type) {
 		ReflectConcrete: rt,
 		Asserted:        tout,
 		MissingMethod:   missingmethod,
+		Mismatches:      mismatches,
 	})
 }
 
@@ -887,8 +865,10 @@ var (
 	rtypeOfPtrGenericType = r.TypeOf((*GenericType)(nil))
 	rtypeOfReflectType    = r.TypeOf((*r.Type)(nil)).Elem()
 	rtypeOfUntypedLit     = r.TypeOf((*UntypedLit)(nil)).Elem()
+	rtypeOfXrType         = r.TypeOf((*xr.Type)(nil)).Elem()
 
 	zeroOfReflectType = xr.ZeroR(rtypeOfReflectType)
+	zeroOfXrType      = xr.ZeroR(rtypeOfXrType)
 
 	None  = reflect.None // indicates "no value"
 	True  = xr.ValueOf(true)
@@ -933,6 +913,8 @@ type TypeAssertionError struct {
 	ReflectConcrete r.Type // in case Concrete is not available
 	Asserted        xr.Type
 	MissingMethod   *xr.Method // one method needed by Interface, missing from Concrete
+	// all the methods needed by Interface that Concrete is missing, or has with a different signature
+	Mismatches []xr.MethodMismatch
 }
 
 func (*TypeAssertionError) RuntimeError() {}
@@ -951,5 +933,8 @@ func (e *TypeAssertionError) Error() string {
 	if e.MissingMethod == nil {
 		return fmt.Sprintf("interface conversion: <%v> is <%v>, not <%v>", in, concr, e.Asserted)
 	}
+	if len(e.Mismatches) != 0 {
+		return fmt.Sprintf("interface conversion: <%v> does not implement <%v>%s", concr, e.Asserted, formatMethodMismatches(e.Mismatches))
+	}
 	return fmt.Sprintf("interface conversion: <%v> does not implement <%v>: missing method %s", concr, e.Asserted, e.MissingMethod.String())
 }
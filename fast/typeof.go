@@ -0,0 +1,208 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * typeof.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"strings"
+
+	"github.com/cosmos72/gomacro/ast2"
+	"github.com/cosmos72/gomacro/base"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+// ExprInfo describes the static properties of an expression. See Interp.KindOf
+type ExprInfo struct {
+	Type xr.Type // type of the expression, or its default type if untyped. nil for untyped nil
+	// types of expressions producing multiple values, as function calls.
+	// nil if the expression produces a single value
+	Types       []xr.Type
+	Untyped     bool // untyped constant, as 1 << 10 or "abc"
+	Constant    bool
+	Addressable bool // the expression can be the operand of &
+	Assignable  bool // the expression can be on the left side of =
+}
+
+func (info ExprInfo) String() string {
+	var buf strings.Builder
+	switch {
+	case info.Types != nil:
+		buf.WriteByte('(')
+		for i, t := range info.Types {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprint(&buf, t)
+		}
+		buf.WriteByte(')')
+	case info.Type == nil:
+		buf.WriteString("untyped nil")
+	case info.Untyped:
+		fmt.Fprintf(&buf, "untyped %v", info.Type)
+	default:
+		fmt.Fprint(&buf, info.Type)
+	}
+	var flags []string
+	if info.Constant {
+		flags = append(flags, "constant")
+	}
+	if info.Addressable {
+		flags = append(flags, "addressable")
+	}
+	if info.Assignable {
+		flags = append(flags, "assignable")
+	}
+	if len(flags) != 0 {
+		fmt.Fprintf(&buf, " (%s)", strings.Join(flags, ", "))
+	}
+	return buf.String()
+}
+
+// TypeOfExpr parses and compiles src, which must be an expression,
+// and returns its static type without executing it.
+// Untyped constants return their default type.
+// It is named TypeOfExpr because Interp.TypeOf is the replacement of reflect.TypeOf()
+func (ir *Interp) TypeOfExpr(src string) (xr.Type, error) {
+	info, err := ir.KindOf(src)
+	if err != nil {
+		return nil, err
+	}
+	return info.Type, nil
+}
+
+// KindOf parses and compiles src, which must be an expression,
+// and returns its static properties without executing it:
+// expressions with side effects, as function calls or channel receives, are safe to query
+func (ir *Interp) KindOf(src string) (info ExprInfo, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = panicToError(rec)
+		}
+	}()
+	// use Comp.Parse instead of Interp.Parse: do not collect src with :write
+	form := ir.Comp.Parse(src)
+	if _, ok := form.(ast2.AstWithSlice); ok && form.Size() == 1 {
+		form = form.Get(0)
+	}
+	form = base.UnwrapTrivialAst(form)
+	if form == nil {
+		return info, errors.New("typeof: empty expression")
+	}
+	node, ok := form.Interface().(ast.Expr)
+	if !ok {
+		return info, fmt.Errorf("typeof: not an expression: %s", src)
+	}
+	return ir.Comp.KindOf(node), nil
+}
+
+// KindOf compiles node without executing it, and returns its static properties.
+// Panics if node cannot be compiled
+func (c *Comp) KindOf(node ast.Expr) ExprInfo {
+	// compile in a temporary scope: expressions should not declare anything in c,
+	// but be safe. Also, the compiled code is discarded
+	e := NewComp(c, nil).exprCompile(node, nil)
+	if e == nil {
+		c.Errorf("typeof: expression produces no value: %v", node)
+	}
+	var info ExprInfo
+	if e.NumOut() != 1 {
+		switch unparen(node).(type) {
+		case *ast.IndexExpr, *ast.TypeAssertExpr, *ast.UnaryExpr:
+			// m[k], x.(T) and <-ch are compiled as comma-ok expressions,
+			// but are single-valued unless used in a special assignment
+			info.Type = e.Types[0]
+		default:
+			info.Types = e.Types
+			if len(e.Types) != 0 {
+				info.Type = e.Types[0]
+			}
+			return info
+		}
+	} else if e.Const() && e.Type == nil {
+		// untyped nil
+		return info
+	} else {
+		info.Type = e.DefaultType()
+		info.Untyped = e.Untyped()
+		// functions are compiled as constants too, but they are not Go constants
+		info.Constant = e.Const() && isBasicKind(info.Type.Kind())
+	}
+	if !info.Constant && !c.inCompositeLit(node) {
+		info.Assignable = c.isPlace(node, PlaceSettable)
+		info.Addressable = c.isPlace(node, PlaceAddress)
+	}
+	return info
+}
+
+// return true if node is a composite literal, or a field or array element of one.
+// They are neither addressable nor assignable in Go,
+// although the fast compiler internally takes their address
+func (c *Comp) inCompositeLit(node ast.Expr) (ret bool) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			ret = false
+		}
+	}()
+	for {
+		switch x := node.(type) {
+		case *ast.ParenExpr:
+			node = x.X
+			continue
+		case *ast.CompositeLit:
+			return true
+		case *ast.SelectorExpr:
+			node = x.X
+		case *ast.IndexExpr:
+			node = x.X
+		default:
+			return false
+		}
+		// fields and elements reached through pointers and slices are addressable
+		switch NewComp(c, nil).exprCompile(node, nil).Type.Kind() {
+		case xr.Struct, xr.Array:
+		default:
+			return false
+		}
+	}
+}
+
+// return true if node can be compiled as a place with the given option
+func (c *Comp) isPlace(node ast.Expr, opt PlaceOption) (ok bool) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			ok = false
+		}
+	}()
+	place := NewComp(c, nil).placeOrAddress(node, opt, nil)
+	if opt == PlaceAddress && !place.IsVar() && place.Addr == nil {
+		// map elements are settable but not addressable
+		return false
+	}
+	return place != nil
+}
+
+func unparen(node ast.Expr) ast.Expr {
+	for {
+		paren, ok := node.(*ast.ParenExpr)
+		if !ok {
+			return node
+		}
+		node = paren.X
+	}
+}
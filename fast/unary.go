@@ -51,6 +51,11 @@ func (c *Comp) UnaryExpr(node *ast.UnaryExpr) *Expr {
 	if xe.Untyped() {
 		return c.UnaryExprUntyped(node, xe)
 	}
+	if c.Options&base.OptExtBigNums != 0 {
+		if z := c.bigNumUnaryExpr(node, xe); z != nil {
+			return z
+		}
+	}
 	isConst := xe.Const()
 	xe.WithFun()
 	var z *Expr
@@ -75,6 +80,7 @@ func (c *Comp) UnaryExpr(node *ast.UnaryExpr) *Expr {
 	if isConst {
 		// constant propagation
 		z.EvalConst(COptKeepUntyped)
+		c.checkConstOverflowUnary(node, xe, z)
 	} else {
 		// create jit expression for z
 		c.Jit.UnaryExpr(z, node.Op, xe)
@@ -0,0 +1,275 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * unused.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/cosmos72/gomacro/ast2"
+	"github.com/cosmos72/gomacro/base"
+)
+
+// UnusedMode specifies how to report local variables declared and not used,
+// and packages imported and not used, which Go compilers reject
+type UnusedMode uint8
+
+const (
+	// UnusedAuto reports errors while loading a file with Interp.EvalFile or Interp.LoadFile,
+	// as the Go compiler does, and warnings otherwise: the REPL intentionally relaxes the rule
+	UnusedAuto UnusedMode = iota
+	UnusedOff
+	UnusedWarn
+	UnusedError
+)
+
+var unusedModeNames = [...]string{"auto", "off", "warn", "error"}
+
+func (mode UnusedMode) String() string {
+	if int(mode) < len(unusedModeNames) {
+		return unusedModeNames[mode]
+	}
+	return fmt.Sprintf("UnusedMode(%d)", int(mode))
+}
+
+// ParseUnusedMode converts "auto", "off", "warn" or "error" to the corresponding UnusedMode
+func ParseUnusedMode(str string) (UnusedMode, error) {
+	for i, name := range unusedModeNames {
+		if str == name {
+			return UnusedMode(i), nil
+		}
+	}
+	return UnusedAuto, fmt.Errorf("expecting one of %s, found %q", strings.Join(unusedModeNames[:], ", "), str)
+}
+
+// an import not used yet by the file being loaded
+type unusedImport struct {
+	spec  *ast.ImportSpec
+	alias string // non-empty if the package is imported with a name different from its own
+}
+
+// return the effective UnusedMode: never UnusedAuto
+func (g *CompGlobals) unusedMode() UnusedMode {
+	mode := g.Unused
+	if mode == UnusedAuto {
+		mode = UnusedWarn
+		if g.loadingFile > 0 {
+			mode = UnusedError
+		}
+	}
+	return mode
+}
+
+// noteDeclaredVars records the local variables just declared in c, to report them if never used.
+// redeclared[i], if present and non-nil, is the variable names[i] already declared in c
+// and assigned by a short variable declaration
+func (c *Comp) noteDeclaredVars(names []string, pos []token.Pos, redeclared []*Bind) {
+	info := c.funcInfo()
+	if info == nil || c.unusedMode() == UnusedOff {
+		return
+	}
+	for i, name := range names {
+		bind := c.Binds[name]
+		if name == "_" || bind == nil || i >= len(pos) {
+			continue
+		}
+		if i < len(redeclared) && redeclared[i] != nil {
+			// not a new variable: keep its original position
+			if p, ok := info.unused[redeclared[i]]; ok {
+				delete(info.unused, redeclared[i])
+				info.unused[bind] = p
+			}
+			continue
+		}
+		if info.unused == nil {
+			info.unused = make(map[*Bind]token.Pos)
+		}
+		info.unused[bind] = pos[i]
+	}
+}
+
+// return the binds already declared in c with the given names, or nil if there are none
+func (c *Comp) redeclaredVars(names []string) []*Bind {
+	var binds []*Bind
+	for i, name := range names {
+		if bind := c.Binds[name]; bind != nil && name != "_" {
+			if binds == nil {
+				binds = make([]*Bind, len(names))
+			}
+			binds[i] = bind
+		}
+	}
+	return binds
+}
+
+// noteUsed records that the local variable name, declared in c, is used
+func (c *Comp) noteUsed(name string) {
+	if info := c.funcInfo(); info != nil && len(info.unused) != 0 {
+		delete(info.unused, c.Binds[name])
+	}
+}
+
+// assignPlace compiles the left-hand side of an assignment:
+// plainly assigning a variable does not count as using it,
+// while an operation as += or ++ does, as in the Go compiler
+func (c *Comp) assignPlace(node ast.Expr, op token.Token) *Place {
+	if ident, ok := unparen(node).(*ast.Ident); ok && op == token.ASSIGN && ident.Name != "_" {
+		if sym, _ := c.tryResolve(ident.Name); sym != nil {
+			return &Place{Var: *sym.AsVar(PlaceSettable)}
+		}
+	}
+	return c.Place(node)
+}
+
+// reportUnused reports the local variables declared and never used
+// by the function just compiled in cf
+func (cf *Comp) reportUnused() {
+	info := cf.Func
+	if len(info.unused) == 0 {
+		return
+	}
+	binds := make([]*Bind, 0, len(info.unused))
+	for bind := range info.unused {
+		binds = append(binds, bind)
+	}
+	sort.Slice(binds, func(i, j int) bool {
+		return info.unused[binds[i]] < info.unused[binds[j]]
+	})
+	msgs := make([]string, len(binds))
+	for i, bind := range binds {
+		msgs[i] = cf.positionPrefix(info.unused[bind]) + "declared and not used: " + bind.Name
+	}
+	info.unused = nil
+	if err := cf.CompGlobals.reportUnused(msgs); err != nil {
+		panic(err)
+	}
+}
+
+// report msgs as warnings or, if the effective UnusedMode is UnusedError, return them as an error
+func (g *CompGlobals) reportUnused(msgs []string) error {
+	if len(msgs) == 0 {
+		return nil
+	} else if g.unusedMode() == UnusedError {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	for _, msg := range msgs {
+		g.Warnf("%s", msg)
+	}
+	return nil
+}
+
+// return the position of pos, followed by ": ", or the empty string if pos is unknown
+func (g *CompGlobals) positionPrefix(pos token.Pos) string {
+	if g.Fileset == nil || !pos.IsValid() {
+		return ""
+	}
+	return g.Fileset.Position(pos).String() + ": "
+}
+
+// =========================== unused imports =================================
+
+// beginFile starts tracking the packages imported by a file being loaded and not used.
+// Returns the state to pass to endFile, which must be called even if loading fails
+func (g *CompGlobals) beginFile() map[string]*unusedImport {
+	save := g.unusedImports
+	g.loadingFile++
+	if g.unusedMode() != UnusedOff && g.Options&base.OptMacroExpandOnly == 0 {
+		// with OptMacroExpandOnly, code is macroexpanded but not compiled: uses are not tracked
+		g.unusedImports = make(map[string]*unusedImport)
+	} else {
+		g.unusedImports = nil
+	}
+	return save
+}
+
+// endFile stops tracking the packages imported by a file being loaded
+func (g *CompGlobals) endFile(save map[string]*unusedImport) {
+	g.unusedImports = save
+	g.loadingFile--
+}
+
+// reportUnusedImports reports the packages imported and not used by the file being loaded.
+// Returns them as an error if the effective UnusedMode is UnusedError
+func (g *CompGlobals) reportUnusedImports() error {
+	imports := make([]*unusedImport, 0, len(g.unusedImports))
+	for _, imp := range g.unusedImports {
+		imports = append(imports, imp)
+	}
+	sort.Slice(imports, func(i, j int) bool {
+		return imports[i].spec.Pos() < imports[j].spec.Pos()
+	})
+	msgs := make([]string, len(imports))
+	for i, imp := range imports {
+		msg := imp.spec.Path.Value + " imported and not used"
+		if len(imp.alias) != 0 {
+			msg = imp.spec.Path.Value + " imported as " + imp.alias + " and not used"
+		}
+		msgs[i] = g.positionPrefix(imp.spec.Pos()) + msg
+	}
+	g.unusedImports = nil
+	return g.reportUnused(msgs)
+}
+
+// noteImport records that the file being loaded imports the package imp
+// with the given alias, which can be empty
+func (c *Comp) noteImport(node ast.Spec, alias string, imp *Import) {
+	g := c.CompGlobals
+	spec, ok := node.(*ast.ImportSpec)
+	if !ok || g.unusedImports == nil || alias == "_" || alias == "." {
+		return
+	}
+	if len(alias) == 0 {
+		alias = c.importAlias(imp.Path)
+	}
+	if len(alias) == 0 {
+		return
+	}
+	unused := &unusedImport{spec: spec}
+	if alias != imp.Name {
+		unused.alias = alias
+	}
+	g.unusedImports[alias] = unused
+}
+
+// noteUsedImports records that the packages imported with the names appearing in form are used.
+// Examines the source code instead of the compiled code, because function bodies
+// can be compiled later, and generic functions and types only when instantiated
+func (g *CompGlobals) noteUsedImports(form ast2.Ast) {
+	if len(g.unusedImports) == 0 {
+		return
+	}
+	var visit func(ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Ident:
+			delete(g.unusedImports, node.Name)
+		case *ast.SelectorExpr:
+			ast.Inspect(node.X, visit)
+			return false
+		case *ast.ImportSpec:
+			return false
+		}
+		return true
+	}
+	for _, node := range ast2.ToNodes(form) {
+		ast.Inspect(node, visit)
+	}
+}
@@ -468,6 +468,9 @@ func funAsX1(fun I, t xr.Type) func(*Env) xr.Value {
 	if t != nil {
 		rt = t.ReflectType()
 	}
+	if ret := cachedFunAsX1(fun, rt); ret != nil {
+		return ret
+	}
 	switch fun := fun.(type) {
 	case nil:
 	case func(*Env):
@@ -0,0 +1,310 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * valuecache.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"math"
+	r "reflect"
+	"sync"
+
+	"github.com/cosmos72/gomacro/base/reflect"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+const (
+	minCachedInt = -128
+	maxCachedInt = 255
+)
+
+// valueCache contains the canonical xr.Value of common constants of each basic type:
+// false and true, the integers in [minCachedInt, maxCachedInt],
+// floating-point and complex +0, and the empty string.
+// The closures created by funAsX1() return them instead of wrapping
+// each result in a newly allocated xr.Value - as base.True and base.False do for bool.
+//
+// Each interpreter has its own valueCache, shared by all its goroutines.
+// The values of each type are created on first use
+type valueCache struct {
+	basic [r.String + 1]valueTable // unnamed basic types, indexed by kind
+	named sync.Map                 // r.Type -> *valueTable, for named basic types as time.Duration
+}
+
+type valueTable struct {
+	once   sync.Once
+	values []xr.Value
+}
+
+// identifies a valueTable inside a valueCache. Computed at compile time
+type valueKey struct {
+	kind r.Kind
+	rt   r.Type // nil for unnamed basic types
+}
+
+func makeValueKey(rt r.Type) valueKey {
+	k := rt.Kind()
+	if rt == reflect.KindToType(k) {
+		return valueKey{kind: k}
+	}
+	return valueKey{kind: k, rt: rt}
+}
+
+// return the canonical values of the type identified by key
+func (cache *valueCache) get(key valueKey) []xr.Value {
+	var table *valueTable
+	rt := key.rt
+	if rt == nil {
+		table = &cache.basic[key.kind]
+		rt = reflect.KindToType(key.kind)
+	} else if t, ok := cache.named.Load(rt); ok {
+		table = t.(*valueTable)
+	} else {
+		t, _ = cache.named.LoadOrStore(rt, &valueTable{})
+		table = t.(*valueTable)
+	}
+	table.once.Do(func() {
+		table.values = makeCanonicalValues(rt)
+	})
+	return table.values
+}
+
+func makeCanonicalValues(rt r.Type) []xr.Value {
+	var values []xr.Value
+	switch rt.Kind() {
+	case r.Bool:
+		values = []xr.Value{xr.ValueOf(false), xr.ValueOf(true)}
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		values = make([]xr.Value, maxCachedInt-minCachedInt+1)
+		for i := range values {
+			if x := int64(i + minCachedInt); !r.Zero(rt).OverflowInt(x) {
+				values[i] = xr.ValueOf(x)
+			}
+		}
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		values = make([]xr.Value, maxCachedInt-minCachedInt+1)
+		for i := -minCachedInt; i < len(values); i++ {
+			values[i] = xr.ValueOf(uint64(i + minCachedInt))
+		}
+	default:
+		// zero values of floats, complexes and strings
+		return []xr.Value{xr.ZeroR(rt)}
+	}
+	for i, v := range values {
+		if v.IsValid() {
+			values[i] = v.Convert(rt)
+		}
+	}
+	return values
+}
+
+// funAsX1 helper: return a closure that wraps the result of fun in the canonical xr.Value
+// of rt if available, otherwise in a new xr.Value.
+// The closure also accepts env == nil, used to evaluate constant expressions at compile time.
+// Return nil if fun does not return a basic type, or rt has a different kind
+func cachedFunAsX1(fun I, rt r.Type) func(*Env) xr.Value {
+	if rt == nil {
+		// use the unnamed type returned by fun
+		rt = reflect.KindToType(funKind(fun))
+		if rt == nil {
+			return nil
+		}
+	} else if rt.Kind() != funKind(fun) {
+		return nil
+	}
+	key := makeValueKey(rt)
+	switch fun := fun.(type) {
+	case func(*Env) bool:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if env == nil {
+				return convert(xr.ValueOf(x), rt)
+			} else if x {
+				return env.Run.values.get(key)[1]
+			}
+			return env.Run.values.get(key)[0]
+		}
+	case func(*Env) int:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := int64(x); y >= minCachedInt && y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) int8:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := int64(x); y >= minCachedInt && y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) int16:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := int64(x); y >= minCachedInt && y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) int32:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := int64(x); y >= minCachedInt && y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) int64:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := int64(x); y >= minCachedInt && y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) uint:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := uint64(x); y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) uint8:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := uint64(x); y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) uint16:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := uint64(x); y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) uint32:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := uint64(x); y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) uint64:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := uint64(x); y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) uintptr:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if y := uint64(x); y <= maxCachedInt && env != nil {
+				return env.Run.values.get(key)[int(y)-minCachedInt]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) float32:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if math.Float32bits(x) == 0 && env != nil {
+				return env.Run.values.get(key)[0]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) float64:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if math.Float64bits(x) == 0 && env != nil {
+				return env.Run.values.get(key)[0]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) complex64:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if math.Float32bits(real(x)) == 0 && math.Float32bits(imag(x)) == 0 && env != nil {
+				return env.Run.values.get(key)[0]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) complex128:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if math.Float64bits(real(x)) == 0 && math.Float64bits(imag(x)) == 0 && env != nil {
+				return env.Run.values.get(key)[0]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	case func(*Env) string:
+		return func(env *Env) xr.Value {
+			x := fun(env)
+			if len(x) == 0 && env != nil {
+				return env.Run.values.get(key)[0]
+			}
+			return convert(xr.ValueOf(x), rt)
+		}
+	}
+	return nil
+}
+
+// return the kind of basic type returned by fun, or r.Invalid
+func funKind(fun I) r.Kind {
+	switch fun.(type) {
+	case func(*Env) bool:
+		return r.Bool
+	case func(*Env) int:
+		return r.Int
+	case func(*Env) int8:
+		return r.Int8
+	case func(*Env) int16:
+		return r.Int16
+	case func(*Env) int32:
+		return r.Int32
+	case func(*Env) int64:
+		return r.Int64
+	case func(*Env) uint:
+		return r.Uint
+	case func(*Env) uint8:
+		return r.Uint8
+	case func(*Env) uint16:
+		return r.Uint16
+	case func(*Env) uint32:
+		return r.Uint32
+	case func(*Env) uint64:
+		return r.Uint64
+	case func(*Env) uintptr:
+		return r.Uintptr
+	case func(*Env) float32:
+		return r.Float32
+	case func(*Env) float64:
+		return r.Float64
+	case func(*Env) complex64:
+		return r.Complex64
+	case func(*Env) complex128:
+		return r.Complex128
+	case func(*Env) string:
+		return r.String
+	}
+	return r.Invalid
+}
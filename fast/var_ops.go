@@ -29813,13 +29813,14 @@ func (c *Comp) setVar(va *Var, op token.Token, init *Expr) Stmt {
 	case token.SHL, token.SHL_ASSIGN, token.SHR, token.SHR_ASSIGN:
 		shift = true
 		if init.Untyped() {
-			init.ConstTo(c.TypeOfUint64())
+			c.shiftCount(nil, init, false)
 			err = nil
 		} else if init.Type == nil {
 			err = fmt.Sprintf("\n\treason: type is %v, expecting integer", init.Type)
-		} else if c := reflect.Category(init.Type.Kind()); c != r.Int && c != r.Uint {
+		} else if cat := reflect.Category(init.Type.Kind()); cat != r.Int && cat != r.Uint {
 			err = fmt.Sprintf("\n\treason: type %v is %v, expecting integer", init.Type, init.Type.Kind())
 		} else {
+			c.shiftCount(nil, init, false)
 			err = nil
 		}
 
@@ -0,0 +1,280 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * vecloop.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"go/ast"
+	"go/token"
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/vec"
+)
+
+type vecLoopKind uint8
+
+const (
+	vecLoopSum   vecLoopKind = iota // for _, x := range a { acc += x } or for i := range a { acc += a[i] }
+	vecLoopDot                      // for i := range a { acc += a[i] * b[i] }
+	vecLoopScale                    // for i := range a { a[i] *= k }
+)
+
+// a "for range" loop that can be replaced by a call to package vec
+type vecLoop struct {
+	kind vecLoopKind
+	acc  *ast.Ident // vecLoopSum and vecLoopDot
+	a, b *ast.Ident // b is only used by vecLoopDot
+	k    ast.Expr   // vecLoopScale: *ast.Ident or *ast.BasicLit
+}
+
+var (
+	rtypeOfSliceOfFloat64 = r.TypeOf([]float64{})
+	rtypeOfSliceOfInt     = r.TypeOf([]int{})
+)
+
+// if node is a simple numeric loop recognized by matchVecLoop,
+// compile it as a call to package vec and return true.
+// Otherwise return false without compiling anything.
+// Used when option OptVecLoops is set.
+func (c *Comp) vecLoop(node *ast.RangeStmt) bool {
+	loop, ok := matchVecLoop(node)
+	if !ok {
+		return false
+	}
+	ea := c.Expr1(loop.a, nil)
+	rt := ea.Type.ReflectType()
+	if rt != rtypeOfSliceOfFloat64 && rt != rtypeOfSliceOfInt {
+		return false
+	}
+	if loop.kind == vecLoopScale {
+		ek := c.Expr1(loop.k, nil)
+		if ek.Untyped() {
+			ek.ConstTo(ea.Type.Elem())
+		} else if ek.Type.ReflectType() != rt.Elem() {
+			return false
+		}
+		c.Pos = node.Pos()
+		c.vecScale(ea, ek)
+		return true
+	}
+	var eb *Expr
+	if loop.kind == vecLoopDot {
+		eb = c.Expr1(loop.b, nil)
+		if eb.Type.ReflectType() != rt {
+			return false
+		}
+	}
+	place := c.Place(loop.acc)
+	if place.Type.ReflectType() != rt.Elem() {
+		return false
+	}
+	c.Pos = node.Pos()
+	if loop.kind == vecLoopSum {
+		c.SetPlace(place, token.ASSIGN, vecSum(c.GetPlace(place), ea))
+	} else {
+		c.SetPlace(place, token.ASSIGN, vecDot(c.GetPlace(place), ea, eb))
+		c.vecDotCheckLen(ea, eb)
+	}
+	return true
+}
+
+// recognize the loops
+//
+//	for _, x := range a { acc += x }
+//	for i := range a { acc += a[i] }
+//	for i := range a { acc += a[i] * b[i] }
+//	for i := range a { a[i] *= k }
+//
+// where a, b and acc are identifiers and k is an identifier or a literal.
+// Does not check types, they are checked by Comp.vecLoop
+func matchVecLoop(node *ast.RangeStmt) (vecLoop, bool) {
+	var loop vecLoop
+	a, _ := node.X.(*ast.Ident)
+	key, _ := node.Key.(*ast.Ident)
+	if node.Tok != token.DEFINE || a == nil || key == nil || node.Body == nil || len(node.Body.List) != 1 {
+		return loop, false
+	}
+	stmt, _ := node.Body.List[0].(*ast.AssignStmt)
+	if stmt == nil || len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+		return loop, false
+	}
+	loop.a = a
+	lhs, rhs := stmt.Lhs[0], stmt.Rhs[0]
+	if value, _ := node.Value.(*ast.Ident); value != nil && value.Name != "_" {
+		// for _, x := range a { acc += x }
+		loop.acc, _ = lhs.(*ast.Ident)
+		x, _ := rhs.(*ast.Ident)
+		ok := key.Name == "_" && stmt.Tok == token.ADD_ASSIGN && x != nil && x.Name == value.Name &&
+			isVecLoopIdent(loop.acc, value.Name)
+		return loop, ok
+	} else if node.Value != nil || key.Name == "_" {
+		return loop, false
+	}
+	i := key.Name
+	if a.Name == i {
+		return loop, false
+	}
+	switch stmt.Tok {
+	case token.ADD_ASSIGN:
+		loop.acc, _ = lhs.(*ast.Ident)
+		if !isVecLoopIdent(loop.acc, i) {
+			return loop, false
+		}
+		if x := matchVecIndex(rhs, i); x != nil {
+			// for i := range a { acc += a[i] }
+			return loop, x.Name == a.Name
+		}
+		mul, _ := rhs.(*ast.BinaryExpr)
+		if mul == nil || mul.Op != token.MUL {
+			return loop, false
+		}
+		x, y := matchVecIndex(mul.X, i), matchVecIndex(mul.Y, i)
+		if x == nil || y == nil {
+			return loop, false
+		}
+		// for i := range a { acc += a[i] * b[i] }
+		// floating point multiplication is commutative, the order of x and y does not matter
+		loop.kind = vecLoopDot
+		if x.Name == a.Name {
+			loop.b = y
+		} else if y.Name == a.Name {
+			loop.b = x
+		} else {
+			return loop, false
+		}
+		return loop, true
+	case token.MUL_ASSIGN:
+		// for i := range a { a[i] *= k }
+		x := matchVecIndex(lhs, i)
+		if x == nil || x.Name != a.Name {
+			return loop, false
+		}
+		loop.kind = vecLoopScale
+		switch k := rhs.(type) {
+		case *ast.BasicLit:
+			loop.k = k
+		case *ast.Ident:
+			// a[i] *= a[0] would change k while iterating
+			loop.k = k
+			return loop, k.Name != a.Name && k.Name != i
+		}
+		return loop, loop.k != nil
+	}
+	return loop, false
+}
+
+// return true if ident is a named identifier different from the loop variable
+func isVecLoopIdent(ident *ast.Ident, loopvar string) bool {
+	return ident != nil && ident.Name != "_" && ident.Name != loopvar
+}
+
+// if node is x[i], return x
+func matchVecIndex(node ast.Expr, i string) *ast.Ident {
+	if index, _ := node.(*ast.IndexExpr); index != nil {
+		x, _ := index.X.(*ast.Ident)
+		idx, _ := index.Index.(*ast.Ident)
+		if x != nil && idx != nil && idx.Name == i && x.Name != i {
+			return x
+		}
+	}
+	return nil
+}
+
+// return the expression vec.AddSum*(acc, a)
+func vecSum(eacc *Expr, ea *Expr) *Expr {
+	afun := ea.AsX1()
+	var fun I
+	switch accfun := eacc.WithFun().(type) {
+	case func(*Env) float64:
+		fun = func(env *Env) float64 {
+			return vec.AddSumFloat64(accfun(env), afun(env).Interface().([]float64))
+		}
+	case func(*Env) int:
+		fun = func(env *Env) int {
+			return vec.AddSumInt(accfun(env), afun(env).Interface().([]int))
+		}
+	}
+	return exprFun(eacc.Type, fun)
+}
+
+// return the expression vec.AddDot*(acc, a, b) limited to the common length of a and b.
+// If b is shorter than a, the loop being replaced panics after updating acc,
+// see Comp.vecDotCheckLen
+func vecDot(eacc *Expr, ea *Expr, eb *Expr) *Expr {
+	afun, bfun := ea.AsX1(), eb.AsX1()
+	var fun I
+	switch accfun := eacc.WithFun().(type) {
+	case func(*Env) float64:
+		fun = func(env *Env) float64 {
+			a, b := afun(env).Interface().([]float64), bfun(env).Interface().([]float64)
+			if len(b) < len(a) {
+				a = a[:len(b)]
+			}
+			return vec.AddDotFloat64(accfun(env), a, b)
+		}
+	case func(*Env) int:
+		fun = func(env *Env) int {
+			a, b := afun(env).Interface().([]int), bfun(env).Interface().([]int)
+			if len(b) < len(a) {
+				a = a[:len(b)]
+			}
+			return vec.AddDotInt(accfun(env), a, b)
+		}
+	}
+	return exprFun(eacc.Type, fun)
+}
+
+// compile a statement that panics with "index out of range" if b is shorter than a,
+// as the loop for i := range a { acc += a[i] * b[i] } would do
+func (c *Comp) vecDotCheckLen(ea *Expr, eb *Expr) {
+	afun, bfun := ea.AsX1(), eb.AsX1()
+	c.append(func(env *Env) (Stmt, *Env) {
+		alen := afun(env).Len()
+		switch b := bfun(env).Interface().(type) {
+		case []float64:
+			if n := len(b); n < alen {
+				_ = b[n]
+			}
+		case []int:
+			if n := len(b); n < alen {
+				_ = b[n]
+			}
+		}
+		env.IP++
+		return env.Code[env.IP], env
+	})
+}
+
+// compile the statement vec.Scale*(a, k)
+func (c *Comp) vecScale(ea *Expr, ek *Expr) {
+	afun := ea.AsX1()
+	var stmt Stmt
+	switch kfun := ek.WithFun().(type) {
+	case func(*Env) float64:
+		stmt = func(env *Env) (Stmt, *Env) {
+			vec.ScaleFloat64(afun(env).Interface().([]float64), kfun(env))
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	case func(*Env) int:
+		stmt = func(env *Env) (Stmt, *Env) {
+			vec.ScaleInt(afun(env).Interface().([]int), kfun(env))
+			env.IP++
+			return env.Code[env.IP], env
+		}
+	}
+	c.append(stmt)
+}
@@ -30,6 +30,7 @@ func init() {
 			"OptKeepUntyped":      r.ValueOf(COptKeepUntyped),
 			"PlaceAddress":        r.ValueOf(PlaceAddress),
 			"PlaceSettable":       r.ValueOf(PlaceSettable),
+			"RegisterCommand":     r.ValueOf(RegisterCommand),
 			"VarBind":             r.ValueOf(VarBind),
 		}, Types: map[string]r.Type{
 			"Assign":             r.TypeOf((*Assign)(nil)).Elem(),
@@ -0,0 +1,210 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * yield.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package fast
+
+import (
+	"errors"
+	"runtime"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/gls"
+	xr "github.com/cosmos72/gomacro/xreflect"
+)
+
+var errTaskCanceled = errors.New("evaluation canceled by Task.Cancel()")
+
+// Task is an evaluation started by Interp.EvalSteps, that executes a limited number
+// of statements each time it is resumed: useful to run scripts from a game
+// or simulation loop without ever blocking a frame.
+//
+// While a Task is not Done, the Interp that created it must not be used
+// except through the Task methods.
+//
+// A Task is not a continuation saved from the instruction pointer of the compiled statements:
+// interpreted function calls nest on the Go stack, thus a Task executes in its own goroutine,
+// which blocks at a yield point while the Task is suspended.
+// A Task that is neither completed nor canceled keeps its goroutine alive
+// until the Task becomes unreachable and a finalizer cancels it in another goroutine,
+// at a time chosen by the garbage collector. Call Cancel on Tasks you abandon.
+type Task struct {
+	ir       *Interp
+	y        *yielder
+	done     chan struct{} // closed when evaluation completes
+	finished bool
+	result   *taskResult
+}
+
+// taskResult is written by the goroutine executing a Task.
+// It must not reference the Task, otherwise the finalizer that cancels
+// abandoned Tasks would never run
+type taskResult struct {
+	values []xr.Value
+	types  []xr.Type
+	panic  interface{} // evaluation panicked with this value
+}
+
+// yielder suspends a Task at yield points, once it executed its budget of statements
+type yielder struct {
+	steps  int           // statements to execute each time the Task is resumed
+	left   int           // statements that can still be executed before suspending
+	paused chan struct{} // Task -> host: budget exhausted
+	resume chan bool     // host -> Task: true to continue, false to cancel
+}
+
+// EvalSteps compiles src, then executes at most 'steps' statements of it
+// and returns a Task to resume execution with another 'steps' statements.
+//
+// Statements are counted by yield points compiled before each statement:
+// src and the functions it declares contain them, while functions compiled earlier contain them
+// only if base.OptYieldPoints was set when compiling them.
+// Code executed by interpreted goroutines and by compiled Go functions is not counted.
+//
+// As Eval, EvalSteps panics on compile errors, and EvalSteps or Task.Resume
+// panic if executing src panics
+func (ir *Interp) EvalSteps(src string, steps int) *Task {
+	if steps <= 0 {
+		ir.Comp.Errorf("EvalSteps: invalid number of steps %d, expecting a positive number", steps)
+	}
+	g := &ir.Comp.Globals
+	if g.Options&base.OptYieldPoints == 0 {
+		g.Options |= base.OptYieldPoints
+		defer func() {
+			g.Options &^= base.OptYieldPoints
+		}()
+	}
+	return ir.RunSteps(ir.Compile(src), steps)
+}
+
+// RunSteps executes at most 'steps' statements of compiled expression e,
+// and returns a Task to resume execution with another 'steps' statements.
+// See EvalSteps for details
+func (ir *Interp) RunSteps(e *Expr, steps int) *Task {
+	y := &yielder{
+		steps:  steps,
+		left:   steps,
+		paused: make(chan struct{}),
+		resume: make(chan bool),
+	}
+	task := &Task{ir: ir, y: y, done: make(chan struct{}), result: &taskResult{}}
+	// toplevel statements are executed with ir.env.Run
+	ir.env.Run.yield = y
+	go runTask(ir, e, y, task.done, task.result)
+	task.wait()
+	if !task.finished {
+		// Cancel executes deferred interpreted functions, which may block:
+		// do not run it in the goroutine shared by all finalizers
+		runtime.SetFinalizer(task, func(task *Task) {
+			go task.Cancel()
+		})
+	}
+	return task
+}
+
+func runTask(ir *Interp, e *Expr, y *yielder, done chan<- struct{}, result *taskResult) {
+	defer close(done)
+	// interpreted functions called by this goroutine are executed with the Run of its goroutine id.
+	// Interpreted goroutines and callbacks from compiled code use other Runs: they are not counted
+	run := ir.env.Run.getRun4Goid(gls.GoID())
+	run.yield = y
+	defer run.glsDel()
+	defer func() {
+		result.panic = recover()
+	}()
+	result.values, result.types = ir.RunExpr(e)
+}
+
+// wait until the Task exhausts its budget or completes
+func (task *Task) wait() {
+	select {
+	case <-task.y.paused:
+	case <-task.done:
+		task.finish()
+		if rec := task.result.panic; rec != nil {
+			task.result.panic = nil
+			panic(rec)
+		}
+	}
+}
+
+func (task *Task) finish() {
+	task.finished = true
+	task.ir.env.Run.yield = nil
+}
+
+// Done returns true if the Task completed or was canceled
+func (task *Task) Done() bool {
+	return task.finished
+}
+
+// Resume continues the execution of the Task for at most another 'steps' statements.
+// Returns true if the Task completed
+func (task *Task) Resume() bool {
+	if !task.finished {
+		task.y.resume <- true
+		task.wait()
+	}
+	return task.finished
+}
+
+// Result returns the values computed by a completed Task, as Eval does.
+// Returns nil if the Task did not complete or was canceled
+func (task *Task) Result() ([]xr.Value, []xr.Type) {
+	return task.result.values, task.result.types
+}
+
+// Cancel stops the Task and discards its evaluation, by panicking at its current yield point.
+// Deferred interpreted functions are executed as usual
+func (task *Task) Cancel() {
+	if task.finished {
+		return
+	}
+	task.y.resume <- false
+	<-task.done
+	task.finish()
+	task.result = &taskResult{}
+}
+
+// yieldPoint returns a statement that executes stmt,
+// after suspending the current Task, if any, when it exhausted its budget
+func yieldPoint(stmt Stmt) Stmt {
+	return func(env *Env) (Stmt, *Env) {
+		if y := env.Run.yield; y != nil {
+			y.step(env.Run)
+		}
+		return stmt(env)
+	}
+}
+
+func (y *yielder) step(run *Run) {
+	if y.left <= 0 {
+		if y.resume == nil {
+			// canceled. panic again if interpreted code recovered,
+			// but let deferred functions complete
+			if !run.ExecFlags.IsDefer() {
+				panic(errTaskCanceled)
+			}
+			return
+		}
+		y.paused <- struct{}{}
+		if !<-y.resume {
+			y.resume = nil
+			panic(errTaskCanceled)
+		}
+		y.left = y.steps
+	}
+	y.left--
+}
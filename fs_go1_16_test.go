@@ -0,0 +1,63 @@
+// +build go1.16
+
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * fs_go1_16_test.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package main
+
+import (
+	r "reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cosmos72/gomacro/fast"
+)
+
+func TestFastFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"prog/a.gomacro": {Data: []byte("package main\nimport _ \"embed\"\n\n//go:embed data.txt\nvar text string\n\n//go:embed *.bin\nvar blob []byte\n\nfunc Greet() string { return text }\n")},
+		"prog/b.go":      {Data: []byte("package main\n\nvar B = len(blob)\n")},
+		"prog/b_test.go": {Data: []byte("package main\n\nthis file is not loaded\n")},
+		"prog/data.txt":  {Data: []byte("hello from fstest")},
+		"prog/x.bin":     {Data: []byte{1, 2, 3}},
+		"dup.go":         {Data: []byte("//go:embed prog/*.txt prog/*.bin\nvar dup string\n")},
+	}
+	ir := fast.New()
+	ir.SetFS(fsys)
+	if err := ir.LoadDir("/prog", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		src      string
+		expected interface{}
+	}{
+		{"Greet()", "hello from fstest"},
+		{"blob", []byte{1, 2, 3}},
+		{"B", 3},
+	} {
+		if v, _ := ir.Eval1(test.src); !v.IsValid() || !r.DeepEqual(v.Interface(), test.expected) {
+			t.Errorf("%s: expecting %v, found %v", test.src, test.expected, v)
+		}
+	}
+	if err := ir.LoadFile("dup.go", true); err == nil || !strings.Contains(err.Error(), "multiple files") {
+		t.Errorf("embedding multiple files into a string: expecting error, found %v", err)
+	}
+	ir.SetFS(nil)
+	if err := ir.LoadFile("prog/b.go", true); err == nil {
+		t.Errorf("SetFS(nil) should restore the operating system, loading prog/b.go succeeded")
+	}
+}
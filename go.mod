@@ -5,6 +5,7 @@ go 1.13
 require (
 	github.com/mattn/go-runewidth v0.0.12
 	github.com/peterh/liner v1.2.1
+	github.com/rivo/uniseg v0.1.0
 	golang.org/x/mod v0.4.2
 	golang.org/x/tools v0.1.0
 )
@@ -25,6 +25,10 @@ const (
 	TEMPLATE // template
 	HASH     // #
 
+	// the following are returned by go/scanner only if mode contains ScanLambdas
+	LAMBDA_ARROW // => or ->
+	BACKSLASH    // \
+
 	// the following are never used by go/scanner
 	// they are returned by ast2/Ast.Op() for corresponding AST nodes
 	E_ALIASTYPE
@@ -62,6 +66,8 @@ func init() {
 	}
 	tokens[TEMPLATE] = "template"
 	tokens[HASH] = "#"
+	tokens[LAMBDA_ARROW] = "=>"
+	tokens[BACKSLASH] = "\\"
 }
 
 // Lookup maps a identifier to its keyword token.
@@ -28,6 +28,8 @@ const (
 	DeclarationErrors                              // report declaration errors
 	SpuriousErrors                                 // same as AllErrors, for backward-compatibility
 	CopySources                                    // copy source code to FileSet
+	Lambdas                                        // patch: parse lambda expressions x => expr and \x -> expr
+	BigNums                                        // patch: parse big number literals 123n and 1.5n
 	AllErrors         = SpuriousErrors             // report all errors (not just the first 10 on different lines)
 
 )
@@ -45,6 +47,11 @@ func (p *parser) Init(fileset *etoken.FileSet, filename string, lineOffset int,
 	p.init(fileset, filename, lineOffset, src, p.mode)
 }
 
+// patch: return the comments found by Parse(). They are collected only if mode contains ParseComments
+func (p *parser) Comments() []*ast.CommentGroup {
+	return p.comments
+}
+
 func (p *parser) Parse() (list []ast.Node, err error) {
 	if p.file == nil || p.pkgScope == nil {
 		panic("Parser.Parse(): parser is not initialized, call Parser.Init() first")
@@ -68,7 +75,9 @@ func (p *parser) Parse() (list []ast.Node, err error) {
 	var lastpos1, lastpos2 token.Pos
 	list = make([]ast.Node, 0)
 	for p.tok != token.EOF && p.errors.Len() < 10 {
-		list = append(list, p.parseAny())
+		if node := p.parseAnyOrSkip(); node != nil {
+			list = append(list, node)
+		}
 		// fmt.Printf("// parser position is now %d (%s). parsed %#v\n", p.pos, p.file.Position(p.pos), list[len(list)-1])
 		if p.pos == lastpos1 {
 			p.error(p.pos, fmt.Sprintf("skipping '%s' to continue", etoken.String(p.tok)))
@@ -88,6 +97,54 @@ func (p *parser) Parse() (list []ast.Node, err error) {
 	return list, nil
 }
 
+// A resync panic is raised by parser.error() to skip the rest of a top-level statement
+type resync struct{}
+
+// parseAnyOrSkip parses a top-level declaration, statement or expression.
+// After a syntax error, it skips to the end of the statement containing it and returns nil:
+// the following statements are still parsed, and their syntax errors reported too
+func (p *parser) parseAnyOrSkip() (node ast.Node) {
+	topScope, labelScope, targetStack := p.topScope, p.labelScope, p.targetStack
+	exprLev, inRhs, indent := p.exprLev, p.inRhs, p.indent
+	defer func() {
+		p.resync = false
+		if e := recover(); e != nil {
+			if _, ok := e.(resync); !ok {
+				panic(e)
+			}
+			p.topScope, p.labelScope, p.targetStack = topScope, labelScope, targetStack
+			p.exprLev, p.inRhs, p.indent = exprLev, inRhs, indent
+			p.skipStmt()
+			node = nil
+		}
+	}()
+	p.resync = true
+	return p.parseAny()
+}
+
+// skipStmt advances past the next ';' or newline that is not inside ( [ or {
+func (p *parser) skipStmt() {
+	for p.tok != token.EOF {
+		if p.tok == token.SEMICOLON && p.nesting == 0 {
+			p.next()
+			return
+		}
+		p.next()
+	}
+}
+
+// update the depth of ( [ { at current token
+func (p *parser) updateNesting() {
+	switch p.tok {
+	case token.LPAREN, token.LBRACK, token.LBRACE:
+		p.nesting++
+	case token.RPAREN, token.RBRACK, token.RBRACE:
+		if p.nesting > 0 {
+			p.nesting--
+		}
+	}
+}
+
 func (p *parser) parseAny() ast.Node {
 	if p.tok == token.COMMENT {
 		// advance to the next non-comment token
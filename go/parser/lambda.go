@@ -0,0 +1,80 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parser
+
+import (
+	"go/ast"
+	"go/token"
+
+	etoken "github.com/cosmos72/gomacro/go/etoken"
+)
+
+// patch: lambda expressions, parsed only if mode contains Lambdas:
+//
+//	x => expr
+//	(x, y) => expr
+//	\x, y -> expr
+//
+// and the same forms followed by a block { ... } instead of expr.
+//
+// They are returned as *ast.FuncLit with a single parameter field
+// containing all the parameter names and no type, and with no results:
+// the interpreter infers the missing types from the context.
+// If the lambda body is an expression, it is wrapped in a return statement
+// inside an *ast.BlockStmt with no braces, i.e. with Lbrace == token.NoPos
+func (p *parser) parseLambda(pos token.Pos, params []*ast.Ident) *ast.FuncLit {
+	if p.trace {
+		defer un(trace(p, "Lambda"))
+	}
+
+	p.expect(etoken.LAMBDA_ARROW)
+
+	// params may have been resolved already: declare fresh identifiers
+	names := make([]*ast.Ident, len(params))
+	for i, param := range params {
+		names[i] = &ast.Ident{NamePos: param.NamePos, Name: param.Name}
+	}
+	field := &ast.Field{Names: names}
+	scope := ast.NewScope(p.topScope) // function scope
+	p.declare(field, nil, scope, ast.Var, names...)
+	typ := &ast.FuncType{Func: pos, Params: &ast.FieldList{List: []*ast.Field{field}}}
+
+	var body *ast.BlockStmt
+	p.exprLev++
+	if p.tok == token.LBRACE {
+		body = p.parseBody(scope)
+	} else {
+		p.topScope = scope // open function scope
+		x := p.parseRhs()
+		p.closeScope()
+		body = &ast.BlockStmt{List: []ast.Stmt{&ast.ReturnStmt{Return: x.Pos(), Results: []ast.Expr{x}}}}
+	}
+	p.exprLev--
+
+	return &ast.FuncLit{Type: typ, Body: body}
+}
+
+// patch: parse either a parenthesized expression or type, or a lambda () => expr or (x, y) => expr.
+// The opening parenthesis has already been consumed
+func (p *parser) parseParenOrLambda(lparen token.Pos) ast.Expr {
+	if p.tok == token.RPAREN {
+		p.next()
+		return p.parseLambda(lparen, nil)
+	}
+	p.exprLev++
+	x := p.parseRhsOrType() // types may be parenthesized: (some type)
+	p.exprLev--
+	if ident, ok := x.(*ast.Ident); ok && p.tok == token.COMMA {
+		p.next()
+		params := append([]*ast.Ident{ident}, p.parseIdentList()...)
+		p.expect(token.RPAREN)
+		return p.parseLambda(lparen, params)
+	}
+	rparen := p.expect(token.RPAREN)
+	if ident, ok := x.(*ast.Ident); ok && p.tok == etoken.LAMBDA_ARROW {
+		return p.parseLambda(lparen, []*ast.Ident{ident})
+	}
+	return &ast.ParenExpr{Lparen: lparen, X: x, Rparen: rparen}
+}
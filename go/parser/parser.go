@@ -46,6 +46,8 @@ type parser struct {
 
 	tok0      token.Token // patch: Previous token
 	macroChar rune        // patch: prefix for quote operators ' ` , ,@
+	nesting   int         // patch: depth of ( [ { at current token, used by Parse() to skip statements with errors
+	resync    bool        // patch: if set, the first error in a top-level statement panics with resync{}, see Parse()
 
 	// Next token
 	pos token.Pos   // token position
@@ -87,6 +89,12 @@ func (p *parser) init(fset *etoken.FileSet, filename string, lineOffset int, src
 	if mode&ParseComments != 0 {
 		m = scanner.ScanComments
 	}
+	if mode&Lambdas != 0 {
+		m |= scanner.ScanLambdas
+	}
+	if mode&BigNums != 0 {
+		m |= scanner.ScanBigNums
+	}
 	if mode&CopySources != 0 {
 		p.file.SetSourceForContent(src)
 	}
@@ -107,6 +115,8 @@ func (p *parser) init(fset *etoken.FileSet, filename string, lineOffset int, src
 	p.pos = token.NoPos
 	p.tok = token.ILLEGAL
 	p.lit = ""
+	p.nesting = 0
+	p.resync = false
 
 	p.syncPos = token.NoPos
 	p.syncCnt = 0
@@ -364,6 +374,7 @@ func (p *parser) next() {
 	prev := p.pos
 	p.tok0 = p.tok
 	p.next0()
+	p.updateNesting()
 
 	if p.tok == token.COMMENT {
 		var comment *ast.CommentGroup
@@ -400,6 +411,16 @@ type bailout struct{}
 func (p *parser) error(pos token.Pos, msg string) {
 	epos := p.file.Position(pos)
 
+	if p.resync {
+		// patch: Parse() will skip the rest of the statement,
+		// thus errors on the same line are not spurious
+		if len(p.errors) > 10 {
+			panic(bailout{})
+		}
+		p.errors.Add(epos, msg)
+		panic(resync{})
+	}
+
 	// If AllErrors is not set, discard errors reported on the same line
 	// as the last recorded error and stop parsing if there are more than
 	// 10 errors.
@@ -1004,15 +1025,13 @@ func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
 		typ = p.parseTypeName()
 		ident, _ = typ.(*ast.Ident)
 	}
-	if ident != nil {
-		idents = []*ast.Ident{ident}
-	}
 	if GENERICS_V2_CTI() && p.tok == etoken.HASH {
 		genericParams = p.parseGenericParams()
 	}
 
 	if isMethod || (ident != nil && p.tok == token.LPAREN) {
-		// method
+		// method. An embedded interface has no name: do not declare it
+		idents = []*ast.Ident{ident}
 		scope := ast.NewScope(nil) // method scope
 		params, results := p.parseSignature(scope)
 		typ = &ast.FuncType{Func: token.NoPos, Params: params, Results: results}
@@ -1228,7 +1247,10 @@ func (p *parser) parseOperand(lhs bool) ast.Expr {
 	switch p.tok {
 	case token.IDENT:
 		var x ast.Expr = p.parseIdent()
-		if _GENERICS_HASH() && p.tok == etoken.HASH {
+		if p.tok == etoken.LAMBDA_ARROW {
+			// patch: lambda x => expr
+			return p.parseLambda(x.Pos(), []*ast.Ident{x.(*ast.Ident)})
+		} else if _GENERICS_HASH() && p.tok == etoken.HASH {
 			// parse Foo#[T1,T2...]
 			x = p.parseHash(x)
 		} else if !lhs {
@@ -1244,12 +1266,26 @@ func (p *parser) parseOperand(lhs bool) ast.Expr {
 	case token.LPAREN:
 		lparen := p.pos
 		p.next()
+		if p.mode&Lambdas != 0 {
+			// patch: lambda () => expr or (x, y) => expr
+			return p.parseParenOrLambda(lparen)
+		}
 		p.exprLev++
 		x := p.parseRhsOrType() // types may be parenthesized: (some type)
 		p.exprLev--
 		rparen := p.expect(token.RPAREN)
 		return &ast.ParenExpr{Lparen: lparen, X: x, Rparen: rparen}
 
+	case etoken.BACKSLASH:
+		// patch: lambda \x, y -> expr
+		pos := p.pos
+		p.next()
+		var params []*ast.Ident
+		if p.tok == token.IDENT {
+			params = p.parseIdentList()
+		}
+		return p.parseLambda(pos, params)
+
 	case token.FUNC, etoken.LAMBDA:
 		// patch: lambda. equivalent to func, useful to resolve ambiguities between closures
 		// and function/method declarations
@@ -2380,8 +2416,10 @@ type parseSpecFunction func(doc *ast.CommentGroup, keyword token.Token, iota int
 func isValidImport(lit string) bool {
 	const illegalChars = `!"#$%&'()*,:;<=>?[\]^{|}` + "`\uFFFD"
 	s, _ := strconv.Unquote(lit) // go/scanner returns a legal string literal
+	// patch: also accept URLs as "https://host:port/file.go", imported by gomacro if enabled
+	url := strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
 	for _, r := range s {
-		if !unicode.IsGraphic(r) || unicode.IsSpace(r) || strings.ContainsRune(illegalChars, r) {
+		if !unicode.IsGraphic(r) || unicode.IsSpace(r) || strings.ContainsRune(illegalChars, r) && !(url && r == ':') {
 			return false
 		}
 	}
@@ -68,9 +68,24 @@ func (p *parser) parseQuote() ast.Expr {
 	}
 
 	expr, _ := MakeQuote(p, op, opPos, node)
+
+	// patch: typed hole ~,expr:Type
+	// to avoid ambiguities with key: value, case expr: and slice expressions,
+	// ':' must immediately follow expr, and Type must immediately follow ':'
+	if op == etoken.UNQUOTE && node != nil && p.tok == token.COLON && p.pos == node.End() {
+		if ch := p.scanner.NextChar(); ch >= 0 && ch != p.macroChar && !isSpace(ch) {
+			p.next()
+			typ := p.parseType()
+			expr.X.(*ast.FuncLit).Type.Results = &ast.FieldList{List: []*ast.Field{{Type: typ}}}
+		}
+	}
 	return expr
 }
 
+func isSpace(ch rune) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
 func (p *parser) parseBlockStmtQuoted() *ast.BlockStmt {
 	if p.trace {
 		defer un(trace(p, "BlockStmtQuoted"))
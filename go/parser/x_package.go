@@ -25,7 +25,7 @@ func init() {
 			"Mode":   r.TypeOf((*Mode)(nil)).Elem(),
 			"Parser": r.TypeOf((*Parser)(nil)).Elem(),
 		}, Wrappers: map[string][]string{
-			"Parser": []string{"Configure", "Init", "Parse"},
+			"Parser": []string{"Comments", "Configure", "Init", "Parse"},
 		},
 	}
 }
@@ -425,6 +425,40 @@ func (p *printer) signature(params, result *ast.FieldList) {
 	}
 }
 
+// patch: return true if x is a lambda created by the parser with mode Lambdas,
+// i.e. if its parameters have no type
+func isLambda(x *ast.FuncLit) bool {
+	params := x.Type.Params
+	return x.Type.Results == nil && params != nil && len(params.List) == 1 && params.List[0].Type == nil
+}
+
+// patch: print a lambda as x => expr or (x, y) => { ... }
+func (p *printer) lambda(x *ast.FuncLit) {
+	names := x.Type.Params.List[0].Names
+	if len(names) == 1 {
+		p.print(x.Type.Func)
+		p.expr(names[0])
+	} else {
+		p.print(x.Type.Func, token.LPAREN)
+		for i, name := range names {
+			if i != 0 {
+				p.print(token.COMMA, blank)
+			}
+			p.expr(name)
+		}
+		p.print(token.RPAREN)
+	}
+	p.print(blank, etoken.LAMBDA_ARROW, blank)
+	if body := x.Body; body.Lbrace == token.NoPos && len(body.List) == 1 {
+		// expression body, wrapped by the parser in a return statement
+		if ret, ok := body.List[0].(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+			p.expr(ret.Results[0])
+			return
+		}
+	}
+	p.block(x.Body, 1)
+}
+
 func identListSize(list []*ast.Ident, maxSize int) (size int) {
 	for i, x := range list {
 		if i > 0 {
@@ -828,6 +862,11 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 			case etoken.QUOTE, etoken.QUASIQUOTE, etoken.UNQUOTE, etoken.UNQUOTE_SPLICE:
 				if flit, ok := x.X.(*ast.FuncLit); ok {
 					p.block(flit.Body, 1)
+					// typed hole ~,{expr}:Type
+					if results := flit.Type.Results; results != nil && len(results.List) == 1 {
+						p.print(token.COLON)
+						p.expr(results.List[0].Type)
+					}
 					return
 				}
 				p.print(blank)
@@ -839,6 +878,10 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.print(x)
 
 	case *ast.FuncLit:
+		if isLambda(x) {
+			p.lambda(x)
+			break
+		}
 		p.expr(x.Type)
 		p.funcBody(p.distanceFrom(x.Type.Pos()), blank, x.Body)
 
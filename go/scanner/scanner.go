@@ -98,6 +98,13 @@ func (s *Scanner) peek() byte {
 	return 0
 }
 
+// patch: NextChar returns the character immediately following the most recently scanned token,
+// without advancing the scanner. Returns -1 at EOF.
+// Used by the parser to recognize typed holes ~,expr:Type inside quasiquotes
+func (s *Scanner) NextChar() rune {
+	return s.ch
+}
+
 // A mode value is a set of flags (or 0).
 // They control scanner behavior.
 //
@@ -106,6 +113,8 @@ type Mode uint
 const (
 	ScanComments    Mode = 1 << iota // return comments as COMMENT tokens
 	dontInsertSemis                  // do not automatically insert semicolons - for testing only
+	ScanLambdas                      // patch: return \ => -> as BACKSLASH and LAMBDA_ARROW tokens
+	ScanBigNums                      // patch: accept number literals with suffix 'n', as 123n and 1.5n
 )
 
 // Init prepares the scanner s to tokenize the text src by setting the
@@ -478,6 +487,9 @@ func (s *Scanner) scanNumber() (token.Token, string) {
 	if s.ch == 'i' {
 		tok = token.IMAG
 		s.next()
+	} else if s.ch == 'n' && s.mode&ScanBigNums != 0 {
+		// patch: suffix 'n' marks big number literals. token is still INT or FLOAT
+		s.next()
 	}
 
 	lit := string(s.src[offs:s.offset])
@@ -873,8 +885,12 @@ scanAgain:
 				insertSemi = true
 			}
 		case '-':
-			tok = s.switch3(token.SUB, token.SUB_ASSIGN, '-', token.DEC)
-			if tok == token.DEC {
+			if s.ch == '>' && s.mode&ScanLambdas != 0 {
+				// patch: -> in lambda expressions \x -> expr
+				s.next()
+				tok = etoken.LAMBDA_ARROW
+				lit = "->"
+			} else if tok = s.switch3(token.SUB, token.SUB_ASSIGN, '-', token.DEC); tok == token.DEC {
 				insertSemi = true
 			}
 		case '*':
@@ -929,7 +945,14 @@ scanAgain:
 		case '>':
 			tok = s.switch4(token.GTR, token.GEQ, '>', token.SHR, token.SHR_ASSIGN)
 		case '=':
-			tok = s.switch2(token.ASSIGN, token.EQL)
+			if s.ch == '>' && s.mode&ScanLambdas != 0 {
+				// patch: => in lambda expressions x => expr
+				s.next()
+				tok = etoken.LAMBDA_ARROW
+				lit = "=>"
+			} else {
+				tok = s.switch2(token.ASSIGN, token.EQL)
+			}
 		case '!':
 			tok = s.switch2(token.NOT, token.NEQ)
 		case '&':
@@ -970,6 +993,13 @@ scanAgain:
 					insertSemi = s.insertSemi // preserve insertSemi info
 				}
 			}
+		case '\\':
+			if s.mode&ScanLambdas != 0 {
+				// patch: \ in lambda expressions \x -> expr
+				tok = etoken.BACKSLASH
+				break
+			}
+			fallthrough
 		default:
 			// next reports unexpected BOMs - don't repeat
 			if ch != bom {
@@ -0,0 +1,284 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * expand.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+// Package gomacroast exposes gomacro macroexpansion as a transformation
+// from *ast.File to *ast.File, so that static analysis tools and code generators
+// can process code that uses macros.
+package gomacroast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	r "reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/fast"
+)
+
+// Config configures the macroexpansion performed by Expand
+type Config struct {
+	// Interp declares and executes macros. If nil, Expand creates a new one.
+	// Macros already declared in Interp are expanded too.
+	Interp *fast.Interp
+	// KeepMacros, if true, keeps macro declarations in the returned files.
+	// By default they are removed, because they are not valid Go.
+	KeepMacros bool
+}
+
+type expander struct {
+	fset    *token.FileSet
+	ir      *fast.Interp
+	files   []*token.File            // files being expanded
+	imports map[*ast.ImportSpec]bool // imports used by macros
+}
+
+// Expand macroexpands files, which must belong to fset and to the same package.
+// It first declares all the macros found in files, together with the imports they use,
+// then expands all macro calls and returns the resulting files.
+// Input files are not modified.
+//
+// Positions of the code not created by macros are preserved.
+// Code created by macros declared in files is positioned inside such macros,
+// while code created by other macros is positioned at the enclosing macro call
+func Expand(fset *token.FileSet, files []*ast.File, cfg *Config) ([]*ast.File, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	x := expander{fset: fset, ir: cfg.Interp, imports: make(map[*ast.ImportSpec]bool)}
+	if x.ir == nil {
+		x.ir = fast.New()
+	}
+	for _, file := range files {
+		if tf := fset.File(file.Pos()); tf != nil {
+			x.files = append(x.files, tf)
+		}
+	}
+	for _, file := range files {
+		if err := x.declareMacros(file); err != nil {
+			return nil, err
+		}
+	}
+	outs := make([]*ast.File, len(files))
+	for i, file := range files {
+		out, err := x.expandFile(file, cfg.KeepMacros)
+		if err != nil {
+			return nil, err
+		}
+		outs[i] = out
+	}
+	return outs, nil
+}
+
+// return true if decl is a macro declaration
+func isMacro(decl ast.Decl) bool {
+	fun, ok := decl.(*ast.FuncDecl)
+	// the parser marks macros with a non-nil, empty receiver list
+	return ok && fun.Recv != nil && len(fun.Recv.List) == 0
+}
+
+// declare the macros found in file, and the imports they use
+func (x *expander) declareMacros(file *ast.File) error {
+	var macros []ast.Decl
+	used := make(map[string]bool)
+	for _, decl := range file.Decls {
+		if isMacro(decl) {
+			macros = append(macros, decl)
+			usedNames(decl, used)
+		}
+	}
+	for _, spec := range file.Imports {
+		if !used[importName(spec)] {
+			continue
+		}
+		x.imports[spec] = true
+		decl := &ast.GenDecl{TokPos: spec.Pos(), Tok: token.IMPORT, Specs: []ast.Spec{spec}}
+		if err := x.eval(decl); err != nil {
+			return err
+		}
+	}
+	for _, decl := range macros {
+		if err := x.eval(decl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add to used the names of packages referenced by node
+func usedNames(node ast.Node, used map[string]bool) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+// return the name used in source code to refer to an imported package
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
+
+// macroexpand, compile and execute a declaration
+func (x *expander) eval(decl ast.Decl) error {
+	return x.try(decl, func() {
+		ir := x.ir
+		node, _ := ir.Comp.MacroExpandNodeCodewalk(decl)
+		ir.RunExpr(ir.CompileNode(node))
+	})
+}
+
+// return a copy of file with all macro calls expanded
+func (x *expander) expandFile(file *ast.File, keepMacros bool) (*ast.File, error) {
+	out := *file
+	out.Decls = make([]ast.Decl, 0, len(file.Decls))
+	for _, decl := range file.Decls {
+		if isMacro(decl) {
+			if keepMacros {
+				out.Decls = append(out.Decls, decl)
+			}
+			continue
+		} else if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			// nothing to expand
+			out.Decls = append(out.Decls, decl)
+			continue
+		}
+		var node ast.Node
+		err := x.try(decl, func() {
+			node, _ = x.ir.Comp.MacroExpandNodeCodewalk(decl)
+		})
+		if err != nil {
+			return nil, err
+		}
+		outdecl, ok := node.(ast.Decl)
+		if !ok {
+			return nil, fmt.Errorf("%v: macroexpansion of declaration produced %T, expecting ast.Decl",
+				x.fset.Position(decl.Pos()), node)
+		}
+		x.fixPositions(outdecl)
+		out.Decls = append(out.Decls, outdecl)
+	}
+	if !keepMacros {
+		x.removeUnusedImports(&out)
+	}
+	return &out, nil
+}
+
+// remove the imports used only by macro declarations,
+// otherwise type-checking the expanded file would fail
+func (x *expander) removeUnusedImports(file *ast.File) {
+	used := make(map[string]bool)
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); !ok || gen.Tok != token.IMPORT {
+			usedNames(decl, used)
+		}
+	}
+	unused := func(spec ast.Spec) bool {
+		ispec, ok := spec.(*ast.ImportSpec)
+		return ok && x.imports[ispec] && !used[importName(ispec)]
+	}
+	decls := file.Decls[:0]
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			// copy gen: input files must not be modified
+			outgen := *gen
+			outgen.Specs = nil
+			for _, spec := range gen.Specs {
+				if !unused(spec) {
+					outgen.Specs = append(outgen.Specs, spec)
+				}
+			}
+			if len(outgen.Specs) == 0 {
+				continue
+			}
+			decl = &outgen
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+
+	imports := make([]*ast.ImportSpec, 0, len(file.Imports))
+	for _, spec := range file.Imports {
+		if !unused(spec) {
+			imports = append(imports, spec)
+		}
+	}
+	file.Imports = imports
+}
+
+// execute f, converting panics to errors positioned at node
+func (x *expander) try(node ast.Node, f func()) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%v: %v", x.fset.Position(node.Pos()), rec)
+		}
+	}()
+	f()
+	return nil
+}
+
+var rtypeOfPos = r.TypeOf(token.NoPos)
+
+// fixPositions replaces the positions outside the files being expanded,
+// which are meaningless in fset, with the position of the closest enclosing node
+// that has a meaningful one.
+// Such positions can only appear in nodes created by macros declared elsewhere
+func (x *expander) fixPositions(node ast.Node) {
+	stack := []token.Pos{node.Pos()}
+	ast.Inspect(node, func(node ast.Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		parent := stack[len(stack)-1]
+		if v := r.ValueOf(node); v.Kind() == r.Ptr && !v.IsNil() && v.Elem().Kind() == r.Struct {
+			v = v.Elem()
+			for i, n := 0, v.NumField(); i < n; i++ {
+				if f := v.Field(i); f.Type() == rtypeOfPos && f.CanSet() {
+					if pos := token.Pos(f.Int()); pos.IsValid() && !x.inFiles(pos) {
+						f.SetInt(int64(parent))
+					}
+				}
+			}
+		}
+		pos := node.Pos()
+		if !x.inFiles(pos) {
+			pos = parent
+		}
+		stack = append(stack, pos)
+		return true
+	})
+}
+
+func (x *expander) inFiles(pos token.Pos) bool {
+	for _, tf := range x.files {
+		if base := tf.Base(); int(pos) >= base && int(pos) <= base+tf.Size() {
+			return true
+		}
+	}
+	return false
+}
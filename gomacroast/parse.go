@@ -0,0 +1,91 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * parse.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package gomacroast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+
+	"github.com/cosmos72/gomacro/go/etoken"
+	mp "github.com/cosmos72/gomacro/go/parser"
+)
+
+// ParseFile parses the gomacro source code src, which may contain macro declarations,
+// and adds it to fset as a file named filename.
+// Its signature matches golang.org/x/tools/go/packages.Config.ParseFile,
+// so it can be used to load packages containing macros before calling Expand
+func ParseFile(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	tf := fset.AddFile(filename, -1, len(src))
+	tf.SetLines(lineOffsets(src))
+
+	// parse into a private etoken.FileSet, padded so that
+	// the parsed file has the same base, hence the same positions, as tf
+	efset := etoken.NewFileSet()
+	if pad := tf.Base() - efset.Base() - 1; pad >= 0 {
+		efset.AddFile("", -1, pad, 0)
+	}
+	var parser mp.Parser
+	parser.Configure(mp.ParseComments|mp.DeclarationErrors, 0)
+	parser.Init(efset, filename, 0, src)
+	nodes, err := parser.Parse()
+	if err != nil {
+		return nil, err
+	}
+	file := &ast.File{Comments: parser.Comments()}
+	for _, node := range nodes {
+		decl, ok := node.(ast.Decl)
+		if !ok {
+			return nil, fmt.Errorf("%v: expected declaration, found %T", fset.Position(node.Pos()), node)
+		}
+		gen, _ := decl.(*ast.GenDecl)
+		if gen == nil {
+			file.Decls = append(file.Decls, decl)
+			continue
+		}
+		switch gen.Tok {
+		case token.PACKAGE:
+			if file.Name != nil {
+				return nil, fmt.Errorf("%v: duplicate package clause", fset.Position(gen.Pos()))
+			}
+			file.Package = gen.TokPos
+			file.Name = gen.Specs[0].(*ast.ValueSpec).Names[0]
+			file.Doc = gen.Specs[0].(*ast.ValueSpec).Doc
+			continue
+		case token.IMPORT:
+			for _, spec := range gen.Specs {
+				file.Imports = append(file.Imports, spec.(*ast.ImportSpec))
+			}
+		}
+		file.Decls = append(file.Decls, decl)
+	}
+	if file.Name == nil {
+		return nil, fmt.Errorf("%s: expected package clause", filename)
+	}
+	return file, nil
+}
+
+// return the offset of the first character of each line in src
+func lineOffsets(src []byte) []int {
+	lines := []int{0}
+	for i, ch := range src {
+		if ch == '\n' && i+1 < len(src) {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
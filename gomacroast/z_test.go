@@ -0,0 +1,124 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * z_test.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package gomacroast
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/cosmos72/gomacro/fast"
+)
+
+const srcMacros = `package foo
+
+import "go/ast"
+
+~macro unless(cond, body ast.Node) ast.Node {
+	return ~"{if !(~,cond) { ~,body }}
+}
+
+func Abs(x int) int {
+	unless; x >= 0; { x = -x }
+	return x
+}
+`
+
+func TestExpandParsed(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := ParseFile(fset, "foo.gomacro", []byte(srcMacros))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err := Expand(fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := format(t, fset, outs[0])
+	if strings.Contains(out, "macro") || strings.Contains(out, "unless") {
+		t.Errorf("macro not expanded:\n%s", out)
+	}
+	if !strings.Contains(out, "if !(x >= 0) {") {
+		t.Errorf("unexpected macroexpansion:\n%s", out)
+	}
+	// position of code not created by macros must be preserved
+	fun := outs[0].Decls[len(outs[0].Decls)-1].(*ast.FuncDecl)
+	if pos := fset.Position(fun.Name.Pos()); pos.Filename != "foo.gomacro" || pos.Line != 9 || pos.Column != 6 {
+		t.Errorf("wrong position of function Abs: %v", pos)
+	}
+	// input file must be unchanged
+	if len(file.Decls) != 3 {
+		t.Errorf("input file was modified: expecting 3 declarations, found %d", len(file.Decls))
+	}
+	// expanded code must be valid Go
+	typecheck(t, fset, outs[0])
+}
+
+func TestExpandInterp(t *testing.T) {
+	ir := fast.New()
+	ir.Eval(`~macro twice(stmt interface{}) interface{} { return ~"{~,stmt; ~,stmt} }`)
+
+	const src = `package bar
+
+func Incr2(x int) int {
+	twice; x++
+	return x
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "bar.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err := Expand(fset, []*ast.File{file}, &Config{Interp: ir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := format(t, fset, outs[0])
+	if strings.Count(out, "x++") != 2 {
+		t.Errorf("unexpected macroexpansion:\n%s", out)
+	}
+	// code created by macros declared elsewhere is positioned at the macro call
+	ast.Inspect(outs[0], func(node ast.Node) bool {
+		if node != nil && node.Pos().IsValid() && fset.File(node.Pos()) == nil {
+			t.Errorf("node %T has position %d outside fset", node, node.Pos())
+		}
+		return true
+	})
+	typecheck(t, fset, outs[0])
+}
+
+func format(t *testing.T, fset *token.FileSet, file *ast.File) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func typecheck(t *testing.T, fset *token.FileSet, file *ast.File) {
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check(file.Name.Name, fset, []*ast.File{file}, nil); err != nil {
+		t.Errorf("expanded code does not type-check: %v", err)
+	}
+}
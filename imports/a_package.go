@@ -49,6 +49,7 @@ func init() {
 	Packages["github.com/cosmos72/gomacro/imports"] = Package{
 		Binds: map[string]Value{
 			"Packages": ValueOf(&Packages).Elem(),
+			"Register": ValueOf(Register),
 		},
 		Types: map[string]Type{
 			"Package":           TypeOf((*Package)(nil)).Elem(),
@@ -0,0 +1,138 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * a_registry.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package imports
+
+import (
+	"sort"
+	"sync"
+)
+
+// PackagesLock protects Packages from concurrent accesses.
+// Code that modifies Packages after init(), while interpreters may be running,
+// must hold it for writing. Registry holds it for reading while accessing Packages
+var PackagesLock sync.RWMutex
+
+// Register adds pkg to the global Packages, merging it with the package already present at path.
+// It is called by the init() of files generated by "gomacro gen --embed", and can also be called
+// by embedders to make their own bindings importable by all interpreters
+func Register(path string, pkg Package) {
+	PackagesLock.Lock()
+	Packages.MergePackage(path, PackageUnderlying(pkg))
+	PackagesLock.Unlock()
+}
+
+// Registry is a set of packages, safe for concurrent use, layered on top of the global Packages:
+// lookups search the registry first, then Packages. Modifications only affect the registry,
+// so that interpreters with different registries can import different sets of packages
+// without interfering with each other.
+type Registry struct {
+	lock    sync.RWMutex
+	pkgs    PackageMap
+	deleted map[string]bool // packages of the global Packages hidden by Delete()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{pkgs: make(PackageMap), deleted: make(map[string]bool)}
+}
+
+// Lookup returns the package at path, searching the registry then the global Packages
+func (reg *Registry) Lookup(path string) (Package, bool) {
+	reg.lock.RLock()
+	defer reg.lock.RUnlock()
+	return reg.lookup(path)
+}
+
+// must be called with reg.lock held
+func (reg *Registry) lookup(path string) (Package, bool) {
+	if pkg, found := reg.pkgs[path]; found {
+		return pkg, true
+	} else if reg.deleted[path] {
+		return Package{}, false
+	}
+	PackagesLock.RLock()
+	pkg, found := Packages[path]
+	PackagesLock.RUnlock()
+	return pkg, found
+}
+
+// Store adds or replaces the package at path in the registry
+func (reg *Registry) Store(path string, pkg Package) {
+	reg.lock.Lock()
+	reg.pkgs[path] = pkg
+	delete(reg.deleted, path)
+	reg.lock.Unlock()
+}
+
+// Merge adds the packages srcs to the registry, merging them with the packages already present
+func (reg *Registry) Merge(srcs map[string]PackageUnderlying) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	for path, src := range srcs {
+		reg.mergePackage(path, src)
+	}
+}
+
+// MergePackage adds the package src to the registry, merging it with the package already present at path
+func (reg *Registry) MergePackage(path string, src PackageUnderlying) {
+	reg.lock.Lock()
+	reg.mergePackage(path, src)
+	reg.lock.Unlock()
+}
+
+// must be called with reg.lock held
+func (reg *Registry) mergePackage(path string, src PackageUnderlying) {
+	pkg, found := reg.pkgs[path]
+	if !found {
+		// copy the maps: src and the global Packages may be shared with other registries
+		pkg = Package{}
+		pkg.LazyInit(path)
+		if old, found := reg.lookup(path); found {
+			pkg.Merge(PackageUnderlying(old))
+		}
+		delete(reg.deleted, path)
+	}
+	pkg.Merge(src)
+	reg.pkgs[path] = pkg
+}
+
+// Delete removes the package at path from the registry.
+// If the global Packages contains it, it is hidden instead
+func (reg *Registry) Delete(path string) {
+	reg.lock.Lock()
+	delete(reg.pkgs, path)
+	reg.deleted[path] = true
+	reg.lock.Unlock()
+}
+
+// Paths returns the sorted paths of all the packages visible from the registry
+func (reg *Registry) Paths() []string {
+	reg.lock.RLock()
+	defer reg.lock.RUnlock()
+	paths := make([]string, 0, len(reg.pkgs))
+	for path := range reg.pkgs {
+		paths = append(paths, path)
+	}
+	PackagesLock.RLock()
+	for path := range Packages {
+		if _, found := reg.pkgs[path]; !found && !reg.deleted[path] {
+			paths = append(paths, path)
+		}
+	}
+	PackagesLock.RUnlock()
+	sort.Strings(paths)
+	return paths
+}
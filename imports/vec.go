@@ -0,0 +1,42 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * vec.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package imports
+
+import (
+	. "reflect"
+
+	"github.com/cosmos72/gomacro/vec"
+)
+
+// allow interpreted code to import "vec" without the go toolchain
+func init() {
+	Packages["vec"] = Package{
+		Name: "vec",
+		Binds: map[string]Value{
+			"AddDotFloat64": ValueOf(vec.AddDotFloat64),
+			"AddDotInt":     ValueOf(vec.AddDotInt),
+			"AddSumFloat64": ValueOf(vec.AddSumFloat64),
+			"AddSumInt":     ValueOf(vec.AddSumInt),
+			"DotFloat64":    ValueOf(vec.DotFloat64),
+			"DotInt":        ValueOf(vec.DotInt),
+			"ScaleFloat64":  ValueOf(vec.ScaleFloat64),
+			"ScaleInt":      ValueOf(vec.ScaleInt),
+			"SumFloat64":    ValueOf(vec.SumFloat64),
+			"SumInt":        ValueOf(vec.SumInt),
+		},
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * vec.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+// Package vec contains compiled implementations of simple numeric loops
+// on []float64 and []int.
+//
+// Interpreted code can import it as "vec", and the fast interpreter
+// can route the equivalent interpreted loops to it, see ":set vec-loops on".
+//
+// All functions process the elements in order, hence they return exactly
+// the same results as the loops they replace, including floating point rounding.
+package vec
+
+// SumFloat64 returns the sum of the elements of s
+func SumFloat64(s []float64) float64 {
+	return AddSumFloat64(0, s)
+}
+
+// AddSumFloat64 returns the value of acc after
+// for _, x := range s { acc += x }
+func AddSumFloat64(acc float64, s []float64) float64 {
+	for _, x := range s {
+		acc += x
+	}
+	return acc
+}
+
+// SumInt returns the sum of the elements of s
+func SumInt(s []int) int {
+	return AddSumInt(0, s)
+}
+
+// AddSumInt returns the value of acc after
+// for _, x := range s { acc += x }
+func AddSumInt(acc int, s []int) int {
+	for _, x := range s {
+		acc += x
+	}
+	return acc
+}
+
+// DotFloat64 returns the dot product of a and b.
+// It panics if len(b) < len(a)
+func DotFloat64(a, b []float64) float64 {
+	return AddDotFloat64(0, a, b)
+}
+
+// AddDotFloat64 returns the value of acc after
+// for i := range a { acc += a[i] * b[i] }
+// It panics if len(b) < len(a)
+func AddDotFloat64(acc float64, a, b []float64) float64 {
+	b = b[:len(a)]
+	for i, x := range a {
+		// explicit conversion forbids fusing into a multiply-add,
+		// which would round differently than the interpreter
+		acc += float64(x * b[i])
+	}
+	return acc
+}
+
+// DotInt returns the dot product of a and b.
+// It panics if len(b) < len(a)
+func DotInt(a, b []int) int {
+	return AddDotInt(0, a, b)
+}
+
+// AddDotInt returns the value of acc after
+// for i := range a { acc += a[i] * b[i] }
+// It panics if len(b) < len(a)
+func AddDotInt(acc int, a, b []int) int {
+	b = b[:len(a)]
+	for i, x := range a {
+		acc += x * b[i]
+	}
+	return acc
+}
+
+// ScaleFloat64 multiplies in place each element of s by k
+func ScaleFloat64(s []float64, k float64) {
+	for i := range s {
+		s[i] *= k
+	}
+}
+
+// ScaleInt multiplies in place each element of s by k
+func ScaleInt(s []int, k int) {
+	for i := range s {
+		s[i] *= k
+	}
+}
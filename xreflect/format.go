@@ -0,0 +1,228 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * format.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package xreflect
+
+import (
+	"fmt"
+	r "reflect"
+	"sort"
+	"strconv"
+)
+
+// Formatter wraps v, which must have type t, into a fmt.Formatter
+// that prints it as compiled Go code would:
+// struct fields are printed with the names declared by interpreted code, i.e. %+v does not show
+// the internal names created by the interpreter, and Error() or String() methods
+// declared by interpreted code are called for the verbs %v %s %q %x %X.
+//
+// Verbs %#v and %p are passed unchanged to package fmt,
+// while %T is handled by package fmt itself and prints the wrapper type
+func Formatter(v Value, t Type) fmt.Formatter {
+	return formatValue{v, t, 0}
+}
+
+type formatValue struct {
+	v     Value
+	t     Type
+	depth int
+}
+
+var rTypeOfString = rbasictypes[r.String]
+
+func (f formatValue) Format(s fmt.State, verb rune) {
+	v, t := f.v, f.t
+	format := formatString(s, verb)
+	switch {
+	case !v.IsValid():
+		fmt.Fprint(s, "<nil>")
+		return
+	case verb == 'p' || (verb == 'v' && s.Flag('#')):
+		if v.CanInterface() {
+			fmt.Fprintf(s, format, v.Interface())
+			return
+		}
+	case verb == 'v' || verb == 's' || verb == 'q' || verb == 'x' || verb == 'X':
+		for _, name := range [...]string{"Error", "String"} {
+			if fun, recv, ok := interpretedMethod(v, t, name, rTypeOfString); ok {
+				str := fun.Call([]r.Value{recv})[0].String()
+				fmt.Fprintf(s, format, str)
+				return
+			}
+		}
+	}
+	switch t.Kind() {
+	case r.Interface:
+		if v.IsNil() {
+			fmt.Fprint(s, "<nil>")
+			return
+		}
+		if IsEmulatedInterface(t) {
+			v, t = FromEmulatedInterface(v)
+		} else {
+			v = v.Elem()
+			t = t.Universe().FromReflectType(v.Type())
+		}
+		formatValue{v, t, f.depth}.Format(s, verb)
+	case r.Ptr:
+		if f.depth == 0 && !v.IsNil() {
+			switch t.Elem().Kind() {
+			case r.Array, r.Slice, r.Struct, r.Map:
+				fmt.Fprint(s, "&")
+				formatValue{v.Elem(), t.Elem(), f.depth + 1}.Format(s, verb)
+				return
+			}
+		}
+		formatPointer(s, v)
+	case r.Struct:
+		fmt.Fprint(s, "{")
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if i != 0 {
+				fmt.Fprint(s, " ")
+			}
+			if verb == 'v' && s.Flag('+') {
+				fmt.Fprint(s, t.Field(i).Name, ":")
+			}
+			formatValue{v.Field(i), t.Field(i).Type, f.depth + 1}.Format(s, verb)
+		}
+		fmt.Fprint(s, "}")
+	case r.Array, r.Slice:
+		if t.Elem().Kind() == r.Uint8 && verb != 'v' && verb != 'd' {
+			bytes := make([]byte, v.Len())
+			for i := range bytes {
+				bytes[i] = byte(v.Index(i).Uint())
+			}
+			fmt.Fprintf(s, format, bytes)
+			return
+		}
+		fmt.Fprint(s, "[")
+		for i, n := 0, v.Len(); i < n; i++ {
+			if i != 0 {
+				fmt.Fprint(s, " ")
+			}
+			formatValue{v.Index(i), t.Elem(), f.depth + 1}.Format(s, verb)
+		}
+		fmt.Fprint(s, "]")
+	case r.Map:
+		fmt.Fprint(s, "map[")
+		keys := v.MapKeys()
+		sortKeys(keys)
+		for i, key := range keys {
+			if i != 0 {
+				fmt.Fprint(s, " ")
+			}
+			formatValue{key, t.Key(), f.depth + 1}.Format(s, verb)
+			fmt.Fprint(s, ":")
+			formatValue{v.MapIndex(key), t.Elem(), f.depth + 1}.Format(s, verb)
+		}
+		fmt.Fprint(s, "]")
+	case r.Chan, r.Func, r.UnsafePointer:
+		formatPointer(s, v)
+	default:
+		fmt.Fprintf(s, format, basicInterface(v))
+	}
+}
+
+// rebuild the format string that produced the call to Format()
+func formatString(s fmt.State, verb rune) string {
+	buf := []byte{'%'}
+	for _, flag := range [...]byte{'+', '-', '#', ' ', '0'} {
+		if s.Flag(int(flag)) {
+			buf = append(buf, flag)
+		}
+	}
+	if width, ok := s.Width(); ok {
+		buf = strconv.AppendInt(buf, int64(width), 10)
+	}
+	if prec, ok := s.Precision(); ok {
+		buf = append(buf, '.')
+		buf = strconv.AppendInt(buf, int64(prec), 10)
+	}
+	return string(append(buf, string(verb)...))
+}
+
+func formatPointer(s fmt.State, v Value) {
+	if v.IsNil() {
+		fmt.Fprint(s, "<nil>")
+	} else {
+		fmt.Fprintf(s, "0x%x", v.Pointer())
+	}
+}
+
+// return the value of basic kind contained in v.
+// works also for values obtained from unexported struct fields
+func basicInterface(v Value) interface{} {
+	switch v.Kind() {
+	case r.Bool:
+		return v.Bool()
+	case r.Int:
+		return int(v.Int())
+	case r.Int8:
+		return int8(v.Int())
+	case r.Int16:
+		return int16(v.Int())
+	case r.Int32:
+		return int32(v.Int())
+	case r.Int64:
+		return v.Int()
+	case r.Uint:
+		return uint(v.Uint())
+	case r.Uint8:
+		return uint8(v.Uint())
+	case r.Uint16:
+		return uint16(v.Uint())
+	case r.Uint32:
+		return uint32(v.Uint())
+	case r.Uint64:
+		return v.Uint()
+	case r.Uintptr:
+		return uintptr(v.Uint())
+	case r.Float32:
+		return float32(v.Float())
+	case r.Float64:
+		return v.Float()
+	case r.Complex64:
+		return complex64(v.Complex())
+	case r.Complex128:
+		return v.Complex()
+	case r.String:
+		return v.String()
+	}
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return nil
+}
+
+// sort map keys in the same order used by package fmt, at least for basic kinds
+func sortKeys(keys []Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+			return a.Int() < b.Int()
+		case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+			return a.Uint() < b.Uint()
+		case r.Float32, r.Float64:
+			return a.Float() < b.Float()
+		case r.String:
+			return a.String() < b.String()
+		case r.Bool:
+			return !a.Bool() && b.Bool()
+		}
+		return fmt.Sprint(basicInterface(a)) < fmt.Sprint(basicInterface(b))
+	})
+}
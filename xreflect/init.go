@@ -21,6 +21,7 @@ import (
 	"unsafe"
 
 	"github.com/cosmos72/gomacro/go/types"
+	"github.com/cosmos72/gomacro/imports"
 )
 
 var rbasictypes = []r.Type{
@@ -96,7 +97,7 @@ func (v *Universe) makeForward() Type {
 }
 
 func NewUniverse() *Universe {
-	v := &Universe{}
+	v := &Universe{Imports: imports.NewRegistry()}
 	v.BasicTypes = v.makeBasicTypes()
 	v.addBasicTypesMethodsCTI()
 	v.TypeOfForward = v.makeForward()
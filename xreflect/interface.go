@@ -30,8 +30,12 @@ func IsEmulatedInterface(t Type) bool {
 	return xt.kind == r.Interface && xt.rtype.Kind() == r.Ptr
 }
 
-// extract the concrete value and type contained in an emulated interface
+// extract the concrete value and type contained in an emulated interface.
+// returns the zero Value and nil Type if the emulated interface is nil
 func FromEmulatedInterface(v Value) (Value, Type) {
+	if !v.IsValid() || v.IsNil() {
+		return Value{}, nil
+	}
 	h := v.Elem().Field(0).Interface().(InterfaceHeader)
 	return h.val, h.typ
 }
@@ -161,10 +165,10 @@ func (v *Universe) InterfaceOf(pkg *Package, methodnames []string, methodtypes [
 
 	// for reflect.Type, approximate an interface as a pointer-to-struct:
 	// one field for the wrapped object: type is interface{},
-	// one field for each explicit method: type is the method type i.e. a function
-	rfields := make([]r.StructField, 1+len(methodtypes), 1+gtype.NumMethods())
-	rfields[0] = approxInterfaceHeader()
-
+	// one field for each method, including the ones of embedded interfaces: type is the method type i.e. a function.
+	// Fields must follow the order of gtype.Method(i), which sorts the explicit and embedded methods together
+	// and removes duplicates, as the methods of io.Reader and io.ReadWriter embedded in the same interface
+	rmethods := make(map[string]r.Type, gtype.NumMethods())
 	for i, methodtype := range methodtypes {
 		name := methodnames[i]
 		if etoken.GENERICS.V2_CTI() && methodtype.Kind() == r.Map {
@@ -173,16 +177,23 @@ func (v *Universe) InterfaceOf(pkg *Package, methodnames []string, methodtypes [
 		if methodtype.Kind() != r.Func {
 			errorf(methodtype, "interface contains non-function: %s %v", name, methodtype)
 		}
-		rfields[i+1] = approxInterfaceMethodAsField(name, methodtype.ReflectType())
+		rmethods[types.Id((*types.Package)(pkg), name)] = methodtype.ReflectType()
 	}
 	for _, e := range embeddeds {
 		n := e.NumMethod()
 		for i := 0; i < n; i++ {
 			method := e.Method(i)
-			rtype := rRemoveReceiver(method.Type.ReflectType()) // receiver is the embedded interface, remove it
-			rfields = append(rfields, approxInterfaceMethodAsField(method.Name, rtype))
+			// receiver is the embedded interface, remove it
+			rmethods[types.Id((*types.Package)(method.Pkg), method.Name)] = rRemoveReceiver(method.Type.ReflectType())
 		}
 	}
+	n := gtype.NumMethods()
+	rfields := make([]r.StructField, 1+n)
+	rfields[0] = approxInterfaceHeader()
+	for i := 0; i < n; i++ {
+		gmethod := gtype.Method(i)
+		rfields[i+1] = approxInterfaceMethodAsField(gmethod.Name(), rmethods[gmethod.Id()])
+	}
 	// interfaces may have lots of methods, thus a lot of fields in the proxy struct.
 	// Use a pointer to the proxy struct
 	rtype := r.PtrTo(r.StructOf(rfields))
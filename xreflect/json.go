@@ -0,0 +1,547 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * json.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package xreflect
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	r "reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	rTypeOfJSONMarshaler = r.TypeOf((*json.Marshaler)(nil)).Elem()
+	rTypeOfTextMarshaler = r.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	rTypeOfError         = r.TypeOf((*error)(nil)).Elem()
+)
+
+// MarshalJSON returns the JSON encoding of v, which must have type t.
+//
+// It follows the same rules as encoding/json.Marshal, using the field names, tags and embedding
+// declared by interpreted code instead of the ones visible to package reflect:
+// internal fields created by the interpreter are skipped, unexported fields are skipped,
+// fields of embedded structs are promoted, and `json:"..."` tags are honored.
+// MarshalJSON and MarshalText methods declared by interpreted code are called too.
+//
+// Values stored in non-emulated interfaces are encoded according to their reflect.Type,
+// which does not remember which interpreted struct fields are embedded.
+func MarshalJSON(v Value, t Type) ([]byte, error) {
+	var e jsonEncoder
+	if err := e.encode(v, t, false); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// JSONMarshaler wraps v, which must have type t, into a json.Marshaler
+// that can be passed to encoding/json functions. See MarshalJSON for details.
+func JSONMarshaler(v Value, t Type) json.Marshaler {
+	return jsonValue{v, t}
+}
+
+type jsonValue struct {
+	v Value
+	t Type
+}
+
+func (j jsonValue) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(j.v, j.t)
+}
+
+// maximum pointer depth before reporting a cycle
+const jsonMaxDepth = 1000
+
+type jsonEncoder struct {
+	buf   bytes.Buffer
+	depth int
+}
+
+type jsonError struct {
+	t   Type
+	msg string
+}
+
+func (err *jsonError) Error() string {
+	return fmt.Sprintf("json: unsupported value of type %v: %s", err.t, err.msg)
+}
+
+func (e *jsonEncoder) encode(v Value, t Type, quoted bool) error {
+	if !v.IsValid() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	if done, err := e.encodeMarshaler(v, t); done {
+		return err
+	}
+	switch k := t.Kind(); k {
+	case r.Bool, r.Int, r.Int8, r.Int16, r.Int32, r.Int64,
+		r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr,
+		r.Float32, r.Float64:
+		data, err := json.Marshal(v.fwd().Convert(basicReflectType(k)).Interface())
+		if err != nil {
+			return err
+		}
+		if quoted {
+			e.buf.WriteByte('"')
+			e.buf.Write(data)
+			e.buf.WriteByte('"')
+		} else {
+			e.buf.Write(data)
+		}
+	case r.String:
+		data, _ := json.Marshal(v.String())
+		if quoted {
+			data, _ = json.Marshal(string(data))
+		}
+		e.buf.Write(data)
+	case r.Interface:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		if IsEmulatedInterface(t) {
+			v, t = FromEmulatedInterface(v)
+		} else {
+			v = v.Elem()
+			t = t.Universe().FromReflectType(v.Type())
+		}
+		return e.encode(v, t, false)
+	case r.Ptr:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		if e.depth++; e.depth > jsonMaxDepth {
+			return &jsonError{t, "encountered a cycle"}
+		}
+		err := e.encode(v.Elem(), t.Elem(), false)
+		e.depth--
+		return err
+	case r.Struct:
+		return e.encodeStruct(v, t)
+	case r.Map:
+		return e.encodeMap(v, t)
+	case r.Slice:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		if t.Elem().Kind() == r.Uint8 && !hasJSONMarshaler(t.Elem()) {
+			data, _ := json.Marshal(v.fwd().Convert(rTypeOfByteSlice).Interface())
+			e.buf.Write(data)
+			return nil
+		}
+		return e.encodeArray(v, t)
+	case r.Array:
+		return e.encodeArray(v, t)
+	default:
+		return &json.UnsupportedTypeError{Type: v.Type()}
+	}
+	return nil
+}
+
+// return the reflect.Type of predeclared basic type with given kind
+func basicReflectType(k r.Kind) r.Type {
+	return rbasictypes[k]
+}
+
+func (e *jsonEncoder) encodeArray(v Value, t Type) error {
+	telem := t.Elem()
+	e.buf.WriteByte('[')
+	for i, n := 0, v.Len(); i < n; i++ {
+		if i != 0 {
+			e.buf.WriteByte(',')
+		}
+		if err := e.encode(v.Index(i), telem, false); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte(']')
+	return nil
+}
+
+func (e *jsonEncoder) encodeMap(v Value, t Type) error {
+	if v.IsNil() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	tkey, telem := t.Key(), t.Elem()
+	keys := v.MapKeys()
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		name, err := jsonMapKey(key, tkey)
+		if err != nil {
+			return err
+		}
+		names[i] = name
+	}
+	perm := make([]int, len(keys))
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.Slice(perm, func(i, j int) bool {
+		return names[perm[i]] < names[perm[j]]
+	})
+	e.buf.WriteByte('{')
+	for i, p := range perm {
+		if i != 0 {
+			e.buf.WriteByte(',')
+		}
+		data, _ := json.Marshal(names[p])
+		e.buf.Write(data)
+		e.buf.WriteByte(':')
+		if err := e.encode(v.MapIndex(keys[p]), telem, false); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+// convert a map key to string, as encoding/json does
+func jsonMapKey(key Value, t Type) (string, error) {
+	if t.Kind() == r.String {
+		return key.String(), nil
+	}
+	if fun, recv, ok := interpretedMethod(key, t, "MarshalText", rTypeOfByteSlice, rTypeOfError); ok {
+		data, err := callMarshaler(fun, recv)
+		return string(data), err
+	}
+	if key.Type().Implements(rTypeOfTextMarshaler) {
+		data, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(data), err
+	}
+	switch t.Kind() {
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", &json.UnsupportedTypeError{Type: key.Type()}
+}
+
+// call MarshalJSON or MarshalText methods, either declared by interpreted code or compiled.
+// return done = true if one of them was found.
+func (e *jsonEncoder) encodeMarshaler(v Value, t Type) (done bool, err error) {
+	if fun, recv, ok := interpretedMethod(v, t, "MarshalJSON", rTypeOfByteSlice, rTypeOfError); ok {
+		data, err := callMarshaler(fun, recv)
+		if err == nil {
+			err = json.Compact(&e.buf, data)
+		}
+		return true, err
+	} else if fun, recv, ok := interpretedMethod(v, t, "MarshalText", rTypeOfByteSlice, rTypeOfError); ok {
+		data, err := callMarshaler(fun, recv)
+		if err == nil {
+			data, err = json.Marshal(string(data))
+			e.buf.Write(data)
+		}
+		return true, err
+	}
+	rv := v.fwd()
+	rtype := rv.Type()
+	if !rtype.Implements(rTypeOfJSONMarshaler) && !rtype.Implements(rTypeOfTextMarshaler) {
+		if rv.Kind() == r.Ptr || !rv.CanAddr() {
+			return false, nil
+		}
+		// also call methods with pointer receiver, as encoding/json does
+		rv = rv.Addr()
+		rtype = rv.Type()
+	}
+	if rtype.Kind() == r.Ptr && rv.IsNil() {
+		if rtype.Implements(rTypeOfJSONMarshaler) || rtype.Implements(rTypeOfTextMarshaler) {
+			e.buf.WriteString("null")
+			return true, nil
+		}
+		return false, nil
+	}
+	if !rv.CanInterface() {
+		return false, nil
+	}
+	if m, ok := rv.Interface().(json.Marshaler); ok {
+		data, err := m.MarshalJSON()
+		if err == nil {
+			err = json.Compact(&e.buf, data)
+		}
+		return true, err
+	} else if m, ok := rv.Interface().(encoding.TextMarshaler); ok {
+		data, err := m.MarshalText()
+		if err == nil {
+			data, err = json.Marshal(string(data))
+			e.buf.Write(data)
+		}
+		return true, err
+	}
+	return false, nil
+}
+
+// return true if t has a MarshalJSON or MarshalText method
+func hasJSONMarshaler(t Type) bool {
+	for _, name := range [...]string{"MarshalJSON", "MarshalText"} {
+		if _, count := t.MethodByName(name, ""); count == 1 {
+			return true
+		}
+	}
+	rtype := t.ReflectType()
+	return rtype.Implements(rTypeOfJSONMarshaler) || rtype.Implements(rTypeOfTextMarshaler) ||
+		r.PtrTo(rtype).Implements(rTypeOfJSONMarshaler) || r.PtrTo(rtype).Implements(rTypeOfTextMarshaler)
+}
+
+// find a method declared by interpreted code with given name, no arguments and given results.
+// return the method implementation and the receiver to pass to it.
+// methods with pointer receiver are only returned if v is addressable, as encoding/json does
+func interpretedMethod(v Value, t Type, name string, out ...r.Type) (fun r.Value, recv r.Value, ok bool) {
+	if t.Kind() == r.Interface {
+		return
+	}
+	mtd, count := t.MethodByName(name, "")
+	if count != 1 || mtd.Funs == nil || len(*mtd.Funs) <= mtd.Index {
+		return
+	}
+	fun = (*mtd.Funs)[mtd.Index]
+	if fun.Kind() != r.Func {
+		return
+	}
+	tfun := fun.Type()
+	if tfun.NumIn() != 1 || tfun.NumOut() != len(out) {
+		return
+	}
+	for i, tout := range out {
+		if tfun.Out(i) != tout {
+			return
+		}
+	}
+	recv = v.fwd()
+	for _, i := range mtd.FieldIndex {
+		if recv.Kind() == r.Ptr {
+			if recv.IsNil() {
+				return
+			}
+			recv = recv.Elem()
+		}
+		recv = Value{recv.Field(i)}.fwd()
+	}
+	if !recv.CanInterface() {
+		// values obtained from unexported fields cannot be passed to methods
+		return
+	}
+	trecv := tfun.In(0)
+	switch {
+	case recv.Type() == trecv:
+	case recv.Kind() == r.Ptr && recv.Type().Elem() == trecv:
+		if recv.IsNil() {
+			return
+		}
+		recv = recv.Elem()
+	case recv.CanAddr() && r.PtrTo(recv.Type()) == trecv:
+		recv = recv.Addr()
+	default:
+		return
+	}
+	return fun, recv, true
+}
+
+func callMarshaler(fun r.Value, recv r.Value) ([]byte, error) {
+	ret := fun.Call([]r.Value{recv})
+	data := ret[0].Bytes()
+	if err := ret[1]; !err.IsNil() {
+		return data, err.Interface().(error)
+	}
+	return data, nil
+}
+
+// ------------------------- struct fields -------------------------------------
+
+// jsonField describes a struct field visible to encoding/json
+type jsonField struct {
+	name      string
+	tagged    bool
+	index     []int
+	typ       Type
+	omitEmpty bool
+	quoted    bool
+}
+
+func (e *jsonEncoder) encodeStruct(v Value, t Type) error {
+	e.buf.WriteByte('{')
+	first := true
+fields:
+	for _, f := range jsonFields(t) {
+		fv := v
+		for _, i := range f.index {
+			if fv.Kind() == r.Ptr {
+				if fv.IsNil() {
+					continue fields
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(i)
+		}
+		if f.omitEmpty && isEmptyJSONValue(fv) {
+			continue
+		}
+		if first {
+			first = false
+		} else {
+			e.buf.WriteByte(',')
+		}
+		data, _ := json.Marshal(f.name)
+		e.buf.Write(data)
+		e.buf.WriteByte(':')
+		if err := e.encode(fv, f.typ, f.quoted); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+func isEmptyJSONValue(v Value) bool {
+	switch v.Kind() {
+	case r.Array, r.Map, r.Slice, r.String:
+		return v.Len() == 0
+	case r.Bool:
+		return !v.Bool()
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		return v.Int() == 0
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		return v.Uint() == 0
+	case r.Float32, r.Float64:
+		return v.Float() == 0
+	case r.Interface, r.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// jsonFields returns the fields of struct type t that encoding/json would encode,
+// applying the same rules: breadth-first visit of embedded structs,
+// and for each name the shallowest field wins, preferring tagged fields.
+func jsonFields(t Type) []jsonField {
+	var fields []jsonField
+	current := []jsonField{}
+	next := []jsonField{{typ: t}}
+	visited := map[r.Type]bool{}
+
+	for len(next) != 0 {
+		current, next = next, current[:0]
+		for _, f := range current {
+			if rtype := f.typ.ReflectType(); visited[rtype] {
+				continue
+			} else {
+				visited[rtype] = true
+			}
+			for i, n := 0, f.typ.NumField(); i < n; i++ {
+				sf := f.typ.Field(i)
+				ft := sf.Type
+				if sf.Anonymous {
+					if ft.Kind() == r.Ptr {
+						ft = ft.Elem()
+					}
+					if !token.IsExported(sf.Name) && ft.Kind() != r.Struct {
+						continue
+					}
+				} else if !token.IsExported(sf.Name) {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := tag, ""
+				if comma := strings.IndexByte(tag, ','); comma >= 0 {
+					name, opts = tag[:comma], tag[comma:]
+				}
+				index := make([]int, len(f.index)+1)
+				copy(index, f.index)
+				index[len(f.index)] = i
+
+				if name == "" && sf.Anonymous && ft.Kind() == r.Struct {
+					next = append(next, jsonField{name: ft.Name(), index: index, typ: ft})
+					continue
+				}
+				field := jsonField{
+					name:      name,
+					tagged:    name != "",
+					index:     index,
+					typ:       sf.Type,
+					omitEmpty: strings.Contains(opts, ",omitempty"),
+				}
+				if field.name == "" {
+					field.name = sf.Name
+				}
+				if strings.Contains(opts, ",string") {
+					switch ft.Kind() {
+					case r.Bool, r.Int, r.Int8, r.Int16, r.Int32, r.Int64,
+						r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr,
+						r.Float32, r.Float64, r.String:
+						field.quoted = true
+					}
+				}
+				fields = append(fields, field)
+			}
+		}
+	}
+	return dominantJSONFields(fields)
+}
+
+// for each name, keep only the dominant field. Drop names that have no dominant field
+func dominantJSONFields(fields []jsonField) []jsonField {
+	sort.SliceStable(fields, func(i, j int) bool {
+		fi, fj := &fields[i], &fields[j]
+		if fi.name != fj.name {
+			return fi.name < fj.name
+		}
+		if len(fi.index) != len(fj.index) {
+			return len(fi.index) < len(fj.index)
+		}
+		return fi.tagged && !fj.tagged
+	})
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j == i+1 {
+			out = append(out, fields[i])
+		} else if f0, f1 := fields[i], fields[i+1]; len(f0.index) < len(f1.index) || (f0.tagged && !f1.tagged) {
+			out = append(out, f0)
+		}
+		i = j
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return lessIndex(out[i].index, out[j].index)
+	})
+	return out
+}
+
+func lessIndex(a, b []int) bool {
+	for k, x := range a {
+		if k >= len(b) {
+			return false
+		}
+		if x != b[k] {
+			return x < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
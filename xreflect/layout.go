@@ -0,0 +1,123 @@
+/*
+ * gomacro - A Go interpreter with Lisp-like macros
+ *
+ * Copyright (C) 2017-2019 Massimiliano Ghilardi
+ *
+ *     This Source Code Form is subject to the terms of the Mozilla Public
+ *     License, v. 2.0. If a copy of the MPL was not distributed with this
+ *     file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ *
+ * layout.go
+ *
+ *  Created on Oct 16, 2026
+ *      Author Massimiliano Ghilardi
+ */
+
+package xreflect
+
+import (
+	"fmt"
+	r "reflect"
+	"unsafe"
+)
+
+// LayoutCompatible returns true if values of types a and b have the same memory layout,
+// i.e. if the memory of a value of type a can be reinterpreted as a value of type b.
+//
+// Both types must have the same size and alignment, structs must have the same number of fields
+// at the same offsets, arrays the same length, and numbers or booleans the same kind.
+// Pointers, strings, slices, maps, channels, functions and interfaces
+// must have identical reflect.Type, since the garbage collector and the runtime
+// depend on their exact type.
+//
+// If the layouts differ, also returns a description of the first difference found.
+func LayoutCompatible(a, b Type) (ok bool, reason string) {
+	reason = layoutDiff(a, b, "")
+	return len(reason) == 0, reason
+}
+
+func layoutDiff(a, b Type, path string) string {
+	if a == nil || b == nil {
+		return layoutReason(path, "missing type")
+	}
+	a, b = a.resolve(), b.resolve()
+	ka, kb := a.Kind(), b.Kind()
+	if ka != kb {
+		return layoutReason(path, fmt.Sprintf("different kinds %v and %v", ka, kb))
+	}
+	if sa, sb := a.Size(), b.Size(); sa != sb {
+		return layoutReason(path, fmt.Sprintf("different sizes %d and %d", sa, sb))
+	}
+	if aa, ab := a.Align(), b.Align(); aa != ab {
+		return layoutReason(path, fmt.Sprintf("different alignments %d and %d", aa, ab))
+	}
+	switch ka {
+	case r.Bool, r.Int, r.Int8, r.Int16, r.Int32, r.Int64,
+		r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr,
+		r.Float32, r.Float64, r.Complex64, r.Complex128:
+		return ""
+	case r.Array:
+		if na, nb := a.Len(), b.Len(); na != nb {
+			return layoutReason(path, fmt.Sprintf("different array lengths %d and %d", na, nb))
+		}
+		return layoutDiff(a.Elem(), b.Elem(), path+"[]")
+	case r.Struct:
+		n := a.NumField()
+		if nb := b.NumField(); n != nb {
+			return layoutReason(path, fmt.Sprintf("different number of fields %d and %d", n, nb))
+		}
+		for i := 0; i < n; i++ {
+			fa, fb := a.Field(i), b.Field(i)
+			fpath := fa.Name
+			if len(path) != 0 {
+				fpath = path + "." + fpath
+			}
+			if fa.Offset != fb.Offset {
+				return layoutReason(fpath, fmt.Sprintf("different offsets %d and %d (field %s)",
+					fa.Offset, fb.Offset, fb.Name))
+			}
+			if reason := layoutDiff(fa.Type, fb.Type, fpath); len(reason) != 0 {
+				return reason
+			}
+		}
+		return ""
+	default:
+		// pointers, strings, slices, maps, channels, functions, interfaces and unsafe.Pointer
+		if a.ReflectType() != b.ReflectType() {
+			return layoutReason(path, fmt.Sprintf("cannot reinterpret %v as %v", a, b))
+		}
+		return ""
+	}
+}
+
+func layoutReason(path string, reason string) string {
+	if len(path) == 0 {
+		return reason
+	}
+	return path + ": " + reason
+}
+
+// ConvertLayout reinterprets v, which must have type from, as a value of type to.
+// Typically used to convert interpreted structs to compiled structs passed to cgo or syscall,
+// which expect a specific memory layout.
+//
+// Returns an error, instead of silently reinterpreting memory, if LayoutCompatible(from, to) is false.
+// The returned value is a copy: modifying it does not affect v.
+func ConvertLayout(v Value, from, to Type) (Value, error) {
+	if ok, reason := LayoutCompatible(from, to); !ok {
+		return Value{}, fmt.Errorf("cannot convert %v to %v: incompatible memory layout: %s", from, to, reason)
+	}
+	rv := v.fwd()
+	rfrom := from.resolve().ReflectType()
+	if !rv.IsValid() {
+		return Value{}, fmt.Errorf("cannot convert invalid value to %v", to)
+	} else if rv.Type() != rfrom {
+		return Value{}, fmt.Errorf("cannot convert %v to %v: value has type %v, expecting %v", v, to, rv.Type(), rfrom)
+	}
+	ptr := r.New(to.resolve().ReflectType())
+	// copy v with type from, so that pointers inside v are written with the proper write barriers:
+	// LayoutCompatible guarantees they are located at the same offsets, with the same types, in to
+	r.NewAt(rfrom, unsafe.Pointer(ptr.Pointer())).Elem().Set(rv)
+	return Value{ptr.Elem()}, nil
+}
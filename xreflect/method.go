@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"go/ast"
 	r "reflect"
+	"strings"
 
 	"github.com/cosmos72/gomacro/go/etoken"
 
@@ -299,30 +300,136 @@ func resizemethodvalues(t *xtype) {
 	}
 }
 
+// MethodMismatchKind describes why a type does not provide a method required by an interface
+type MethodMismatchKind int
+
+const (
+	MethodMissing         MethodMismatchKind = iota // the type has no method with the required name
+	MethodPointerReceiver                           // the method has pointer receiver, but the type is not a pointer
+	MethodWrongType                                 // the method has a different signature
+	MethodAmbiguous                                 // several embedded fields provide a method with the required name
+)
+
+// MethodMismatch describes a method required by an interface that a type does not provide
+type MethodMismatch struct {
+	Kind MethodMismatchKind
+	Want Method  // the method required by the interface
+	Have *Method // the method with the same name provided by the type. nil if missing or ambiguous
+}
+
+func (m MethodMismatch) String() string {
+	switch m.Kind {
+	case MethodPointerReceiver:
+		return fmt.Sprintf("method %s has pointer receiver", m.Want.Name)
+	case MethodWrongType:
+		return fmt.Sprintf("wrong type for method %s: have %s, want %s", m.Want.Name, methodSignature(m.Have), methodSignature(&m.Want))
+	case MethodAmbiguous:
+		return fmt.Sprintf("ambiguous selector for method %s", m.Want.Name)
+	default:
+		return fmt.Sprintf("missing method %s", m.Want.Name)
+	}
+}
+
+// return the type of a method without its receiver, if present.
+// The methods of compiled interfaces have the interface as receiver
+func withoutReceiver(t Type) Type {
+	if sig, ok := t.GoType().(*types.Signature); ok && sig.Recv() != nil {
+		return removeReceiver(t)
+	}
+	return t
+}
+
+// return the method name followed by its signature without receiver, as "Read(p []uint8) (n int, err error)"
+func methodSignature(m *Method) string {
+	if m.GoFun != nil {
+		if sig, ok := m.GoFun.Type().(*types.Signature); ok {
+			sig = types.NewSignature(nil, sig.Params(), sig.Results(), sig.Variadic())
+			return m.Name + strings.TrimPrefix(typeutil.String2("", sig), "func")
+		}
+	}
+	return m.Name + " " + m.Type.String()
+}
+
 // return one of the methods defined by interface tinterf but missing from t
 func MissingMethod(t, tinterf Type) *Method {
+	if mismatches := methodMismatches(t, tinterf, false); len(mismatches) != 0 {
+		return &mismatches[0].Want
+	}
+	return nil
+}
+
+// MethodMismatches returns the methods defined by interface tinterf that t does not provide,
+// each with the reason why. Returns nil if t implements tinterf
+func MethodMismatches(t, tinterf Type) []MethodMismatch {
+	return methodMismatches(t, tinterf, true)
+}
+
+// if all is false, stop at the first mismatch
+func methodMismatches(t, tinterf Type, all bool) []MethodMismatch {
 	n := tinterf.NumMethod()
-	var mtdinterf Method
-	if t == nil && n > 0 {
-		mtdinterf = tinterf.Method(0)
-		return &mtdinterf
+	var mismatches []MethodMismatch
+	if t == nil {
+		for i := 0; i < n && (all || i == 0); i++ {
+			mismatches = append(mismatches, MethodMismatch{Kind: MethodMissing, Want: tinterf.Method(i)})
+		}
+		return mismatches
 	}
 	xt := unwrap(t)
 	xtinterf := unwrap(tinterf)
-	for i := 0; i < n; i++ {
-		mtdinterf = tinterf.Method(i)
-		mtd, count := t.MethodByName(mtdinterf.Name, mtdinterf.Pkg.Name())
-		if count == 1 {
-			tfunc := mtd.Type
-			if t.Kind() != r.Interface {
-				tfunc = removeReceiver(tfunc)
-			}
-			fmt.Printf("MissingMethod: comparing %v against expected interface method %v\n", tfunc, mtdinterf)
-			if mtdinterf.Type.IdenticalTo(tfunc) && matchReceiverType(xt, xtinterf) {
+	tsrc, addressable := t, false
+	if t.Kind() == r.Ptr && t.Name() == "" {
+		// Type.MethodByName wants T, not *T, even for methods with pointer receiver
+		tsrc, addressable = t.Elem(), true
+	}
+	for i := 0; i < n && (all || len(mismatches) == 0); i++ {
+		mtdinterf := tinterf.Method(i)
+		mtd, count := tsrc.MethodByName(mtdinterf.Name, mtdinterf.Pkg.Name())
+		switch count {
+		case 0:
+			mismatches = append(mismatches, MethodMismatch{Kind: MethodMissing, Want: mtdinterf})
+			continue
+		case 1:
+		default:
+			mismatches = append(mismatches, MethodMismatch{Kind: MethodAmbiguous, Want: mtdinterf})
+			continue
+		}
+		tfunc := mtd.Type
+		if tsrc.Kind() != r.Interface {
+			if !addressable && !InMethodSet(tsrc, &mtd) {
+				mismatches = append(mismatches, MethodMismatch{Kind: MethodPointerReceiver, Want: mtdinterf, Have: &mtd})
 				continue
 			}
+			tfunc = removeReceiver(tfunc)
+		} else {
+			tfunc = withoutReceiver(tfunc)
+		}
+		if !withoutReceiver(mtdinterf.Type).IdenticalTo(tfunc) || !matchReceiverType(xt, xtinterf) {
+			mismatches = append(mismatches, MethodMismatch{Kind: MethodWrongType, Want: mtdinterf, Have: &mtd})
 		}
-		return &mtdinterf
 	}
-	return nil
+	return mismatches
+}
+
+// InMethodSet returns true if mtd, as returned by t.MethodByName(), belongs
+// to the method set of t and not only to the method set of *t:
+// that's the case unless mtd has a pointer receiver and t is not a pointer,
+// or the embedded field containing mtd is not reached through a pointer
+func InMethodSet(t Type, mtd *Method) bool {
+	if t.Kind() == r.Interface || t.Kind() == r.Ptr {
+		return true
+	}
+	if mtd.Type == nil || mtd.Type.NumIn() == 0 || mtd.Type.In(0).Kind() != r.Ptr {
+		return true
+	}
+	// pointer receiver: only reachable if some embedded field along the path is a pointer
+	for _, index := range mtd.FieldIndex {
+		if t.Kind() == r.Ptr {
+			return true
+		}
+		if t.Kind() != r.Struct {
+			break
+		}
+		t = t.Field(index).Type
+	}
+	return t.Kind() == r.Ptr
 }
@@ -22,6 +22,7 @@ import (
 
 	"github.com/cosmos72/gomacro/go/types"
 	"github.com/cosmos72/gomacro/go/typeutil"
+	"github.com/cosmos72/gomacro/imports"
 )
 
 type Types struct {
@@ -42,6 +43,7 @@ type Universe struct {
 	TryResolve      func(name, pkgpath string) Type
 	Packages        map[string]*Package
 	Importer        *Importer
+	Imports         *imports.Registry // compiled packages importable from this Universe, layered on top of imports.Packages
 	RebuildDepth    int
 	DebugDepth      int
 	mutex           sync.Mutex
@@ -13,34 +13,41 @@ import (
 func init() {
 	imports.Packages["github.com/cosmos72/gomacro/xreflect"] = imports.Package{
 		Binds: map[string]r.Value{
-			"DefaultImporter":    r.ValueOf(DefaultImporter),
-			"GensymAnonymous":    r.ValueOf(GensymAnonymous),
-			"GensymPrivate":      r.ValueOf(GensymPrivate),
-			"MaxDepth":           r.ValueOf(MaxDepth),
-			"MissingMethod":      r.ValueOf(MissingMethod),
-			"NewUniverse":        r.ValueOf(NewUniverse),
-			"QName1":             r.ValueOf(QName1),
-			"QName2":             r.ValueOf(QName2),
-			"QNameGo":            r.ValueOf(QNameGo),
-			"QNameGo2":           r.ValueOf(QNameGo2),
-			"StrGensymAnonymous": r.ValueOf(StrGensymAnonymous),
-			"StrGensymInterface": r.ValueOf(StrGensymInterface),
-			"StrGensymPrivate":   r.ValueOf(StrGensymPrivate),
-			"Zero":               r.ValueOf(Zero),
+			"DefaultImporter":       r.ValueOf(DefaultImporter),
+			"GensymAnonymous":       r.ValueOf(GensymAnonymous),
+			"GensymPrivate":         r.ValueOf(GensymPrivate),
+			"MaxDepth":              r.ValueOf(MaxDepth),
+			"MethodAmbiguous":       r.ValueOf(MethodAmbiguous),
+			"MethodMismatches":      r.ValueOf(MethodMismatches),
+			"MethodMissing":         r.ValueOf(MethodMissing),
+			"MethodPointerReceiver": r.ValueOf(MethodPointerReceiver),
+			"MethodWrongType":       r.ValueOf(MethodWrongType),
+			"MissingMethod":         r.ValueOf(MissingMethod),
+			"NewUniverse":           r.ValueOf(NewUniverse),
+			"QName1":                r.ValueOf(QName1),
+			"QName2":                r.ValueOf(QName2),
+			"QNameGo":               r.ValueOf(QNameGo),
+			"QNameGo2":              r.ValueOf(QNameGo2),
+			"StrGensymAnonymous":    r.ValueOf(StrGensymAnonymous),
+			"StrGensymInterface":    r.ValueOf(StrGensymInterface),
+			"StrGensymPrivate":      r.ValueOf(StrGensymPrivate),
+			"Zero":                  r.ValueOf(Zero),
 		},
 		Types: map[string]r.Type{
-			"Error":           r.TypeOf((*Error)(nil)).Elem(),
-			"Importer":        r.TypeOf((*Importer)(nil)).Elem(),
-			"InterfaceHeader": r.TypeOf((*InterfaceHeader)(nil)).Elem(),
-			"Method":          r.TypeOf((*Method)(nil)).Elem(),
-			"Package":         r.TypeOf((*Package)(nil)).Elem(),
-			"QName":           r.TypeOf((*QName)(nil)).Elem(),
-			"QNameI":          r.TypeOf((*QNameI)(nil)).Elem(),
-			"StructField":     r.TypeOf((*StructField)(nil)).Elem(),
-			"Type":            r.TypeOf((*Type)(nil)).Elem(),
-			"Types":           r.TypeOf((*Types)(nil)).Elem(),
-			"Universe":        r.TypeOf((*Universe)(nil)).Elem(),
-			"Value":           r.TypeOf((*Value)(nil)).Elem(),
+			"Error":              r.TypeOf((*Error)(nil)).Elem(),
+			"Importer":           r.TypeOf((*Importer)(nil)).Elem(),
+			"InterfaceHeader":    r.TypeOf((*InterfaceHeader)(nil)).Elem(),
+			"Method":             r.TypeOf((*Method)(nil)).Elem(),
+			"MethodMismatch":     r.TypeOf((*MethodMismatch)(nil)).Elem(),
+			"MethodMismatchKind": r.TypeOf((*MethodMismatchKind)(nil)).Elem(),
+			"Package":            r.TypeOf((*Package)(nil)).Elem(),
+			"QName":              r.TypeOf((*QName)(nil)).Elem(),
+			"QNameI":             r.TypeOf((*QNameI)(nil)).Elem(),
+			"StructField":        r.TypeOf((*StructField)(nil)).Elem(),
+			"Type":               r.TypeOf((*Type)(nil)).Elem(),
+			"Types":              r.TypeOf((*Types)(nil)).Elem(),
+			"Universe":           r.TypeOf((*Universe)(nil)).Elem(),
+			"Value":              r.TypeOf((*Value)(nil)).Elem(),
 		},
 		Proxies: map[string]r.Type{
 			"QNameI": r.TypeOf((*QNameI_github_com_cosmos72_gomacro_xreflect)(nil)).Elem(),
@@ -753,3 +753,54 @@ func inspect(label string, t types.Type) {
 		debugf("  underlying:\t%v", t.Underlying())
 	}
 }
+
+func TestLayoutCompatible(t *testing.T) {
+	type Host struct {
+		A int32
+		B *int
+		C [2]uint16
+	}
+	thost := u.TypeOf(Host{})
+	tptr := u.PtrTo(u.BasicTypes[r.Int])
+	tarr := u.ArrayOf(2, u.BasicTypes[r.Uint16])
+	pkg := u.LoadPackage("main")
+	tpriv := u.StructOf([]StructField{
+		{Name: "a", Pkg: pkg, Type: u.BasicTypes[r.Int32]},
+		{Name: "b", Pkg: pkg, Type: tptr},
+		{Name: "c", Pkg: pkg, Type: tarr},
+	})
+	ok, reason := LayoutCompatible(tpriv, thost)
+	is(t, ok, true)
+	is(t, reason, "")
+
+	n := 7
+	v := New(tpriv).Elem()
+	v.Field(0).SetInt(-3)
+	v.Field(1).Set(ValueOf(&n))
+	v.Field(2).Index(1).SetUint(9)
+	conv, err := ConvertLayout(v, tpriv, thost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is(t, conv.Interface(), Host{A: -3, B: &n, C: [2]uint16{0, 9}})
+
+	tbad := u.StructOf([]StructField{
+		{Name: "a", Pkg: pkg, Type: u.BasicTypes[r.Int32]},
+		{Name: "b", Pkg: pkg, Type: u.BasicTypes[r.Uintptr]},
+		{Name: "c", Pkg: pkg, Type: tarr},
+	})
+	ok, reason = LayoutCompatible(tbad, thost)
+	is(t, ok, false)
+	is(t, reason, "b: different kinds uintptr and ptr")
+	_, err = ConvertLayout(New(tbad).Elem(), tbad, thost)
+	istrue(t, err != nil)
+
+	tshort := u.StructOf([]StructField{
+		{Name: "a", Pkg: pkg, Type: u.BasicTypes[r.Int16]},
+		{Name: "b", Pkg: pkg, Type: tptr},
+		{Name: "c", Pkg: pkg, Type: tarr},
+	})
+	ok, reason = LayoutCompatible(tshort, thost)
+	is(t, ok, false)
+	is(t, reason, "a: different kinds int16 and int32")
+}